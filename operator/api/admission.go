@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// admissionVars are the variables of admission rules, run is the RunSpec with its JSON
+// field names.
+var admissionVars = []string{"run"}
+
+// AdmissionRule rejects runs its expression does not hold for, e.g. {"name":
+// "nightly-shards", "expression": "run.suite != 'nightly' || run.shards <= 8",
+// "message": "nightly suites may not exceed 8 shards"}. See expr.go for the language.
+type AdmissionRule struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+	// Message tells the rejected caller what to change, the expression without.
+	Message string `json:"message,omitempty"`
+}
+
+func (r AdmissionRule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("admission rules need a name")
+	}
+	if _, err := compileExpr(r.Expression, admissionVars...); err != nil {
+		return fmt.Errorf("admission rule %s: %w", r.Name, err)
+	}
+
+	return nil
+}
+
+func (r AdmissionRule) message() string {
+	if r.Message != "" {
+		return r.Message
+	}
+
+	return r.Expression + " does not hold"
+}
+
+// admissionError is returned when a run violates admission rules.
+type admissionError struct {
+	violations []AdmissionViolation
+}
+
+func (e *admissionError) Error() string {
+	var msgs []string
+	for _, v := range e.violations {
+		msgs = append(msgs, v.Rule+": "+v.Msg)
+	}
+
+	return "rejected by admission rules: " + strings.Join(msgs, "; ")
+}
+
+// AdmissionViolation is a rule a run violates, with the message of the rule.
+type AdmissionViolation struct {
+	Rule string `json:"rule"`
+	Msg  string `json:"msg"`
+}
+
+// runVars exposes a RunSpec to expressions. Unlike in its JSON encoding empty fields are
+// kept, so rules compare with zero values and empty maps rather than null.
+func runVars(spec RunSpec) map[string]interface{} {
+	vars := map[string]interface{}{}
+	v := reflect.ValueOf(spec)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+
+		var value interface{}
+		if data, err := json.Marshal(v.Field(i).Interface()); err == nil {
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			decoder.UseNumber()
+			decoder.Decode(&value)
+		}
+		if value == nil {
+			switch field.Type.Kind() {
+			case reflect.Map:
+				value = map[string]interface{}{}
+			case reflect.Slice:
+				value = []interface{}{}
+			}
+		}
+		vars[name] = exprValue(value)
+	}
+
+	return vars
+}
+
+// admitRun checks a run against the admission rules of the settings and records the
+// decision, see decisions.go. Rules that cannot be evaluated for the run, e.g. comparing
+// a string with a number, reject it.
+func admitRun(ctx context.Context, clientset *kubernetes.Clientset, settings Settings, spec RunSpec) error {
+	if len(settings.AdmissionRules) == 0 {
+		return nil
+	}
+
+	violations := evalAdmissionRules(settings.AdmissionRules, spec)
+	recordAdmissionDecision(ctx, clientset, spec, violations)
+	if len(violations) > 0 {
+		return &admissionError{violations: violations}
+	}
+
+	return nil
+}
+
+// evalAdmissionRules returns the rules a run violates.
+func evalAdmissionRules(rules []AdmissionRule, spec RunSpec) []AdmissionViolation {
+	vars := map[string]interface{}{"run": runVars(spec)}
+	violations := []AdmissionViolation{}
+	for _, rule := range rules {
+		expr, err := compileExpr(rule.Expression, admissionVars...)
+		if err != nil {
+			violations = append(violations, AdmissionViolation{Rule: rule.Name, Msg: err.Error()})
+			continue
+		}
+		admitted, err := evalBool(expr, vars)
+		if err != nil {
+			violations = append(violations, AdmissionViolation{Rule: rule.Name, Msg: "cannot evaluate " + rule.Expression + ": " + err.Error()})
+			continue
+		}
+		if !admitted {
+			violations = append(violations, AdmissionViolation{Rule: rule.Name, Msg: rule.message()})
+		}
+	}
+
+	return violations
+}
+
+// runErrorStatus answers a failure to create a run, 409 when its name is taken, 429 when
+// the namespace runs too many runs, 400 when it lacks cost labels and 403 when a hook or an admission rule rejected it or its
+// credentials are of a service account not allowed for them.
+func runErrorStatus(err error) int {
+	var veto *hookVetoError
+	var rejected *admissionError
+	switch {
+	case apierrors.IsAlreadyExists(err), errors.Is(err, errRerunChanged):
+		return http.StatusConflict
+	case errors.Is(err, errRunLimit):
+		return http.StatusTooManyRequests
+	case errors.Is(err, errMissingCostLabels):
+		return http.StatusBadRequest
+	case errors.As(err, &veto), errors.As(err, &rejected), errors.Is(err, errCredentialsServiceAccount):
+		return http.StatusForbidden
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// artifactKinds maps the files Playwright writes to the output directory of a test to the
+// kind of artifact.
+var artifactKinds = map[string]string{
+	".zip":  "trace",
+	".webm": "video",
+	".png":  "screenshot",
+	".jpg":  "screenshot",
+	".jpeg": "screenshot",
+}
+
+// The poster image and preview generateVideoPreviews writes next to a video.
+const (
+	videoPosterSuffix  = ".poster.jpg"
+	videoPreviewSuffix = ".preview.webm"
+)
+
+// Artifact is a trace, video or screenshot of a test. Paths are relative to the
+// checkpoint directory of the run, which the dashboard serves below /live/<uid>/.
+type Artifact struct {
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	Kind     string    `json:"kind"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Poster   string    `json:"poster,omitempty"`
+	Preview  string    `json:"preview,omitempty"`
+}
+
+// TestArtifacts are the artifacts of one attempt of a test. Test is the output directory
+// Playwright names after the file, title and project of the test, with a -retryN suffix
+// for retries. Failed tests leave a test-failed-N.png or error-context.md.
+type TestArtifacts struct {
+	Test      string     `json:"test"`
+	Shard     *int       `json:"shard,omitempty"`
+	Failed    bool       `json:"failed"`
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+type RunArtifacts struct {
+	RunRef
+	Tests []TestArtifacts `json:"tests"`
+}
+
+// runArtifacts walks the checkpoint directory of a run, which holds the output directory
+// of every test, below shard-N for sharded runs.
+func runArtifacts(job *batchv1.Job) ([]TestArtifacts, error) {
+	dir := filepath.Join(resultsDir, "checkpoints", string(job.UID))
+	sharded := job.Spec.CompletionMode != nil && *job.Spec.CompletionMode == batchv1.IndexedCompletion
+
+	byTest := map[string]*TestArtifacts{}
+	previews := map[string]bool{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		testDir, name := path.Split(rel)
+
+		var shard *int
+		if sharded {
+			prefix, rest, ok := strings.Cut(testDir, "/")
+			index, err := strconv.Atoi(strings.TrimPrefix(prefix, "shard-"))
+			if !ok || !strings.HasPrefix(prefix, "shard-") || err != nil {
+				return nil
+			}
+			shard, testDir = &index, rest
+		}
+		if testDir == "" {
+			// results.json and the resume state of the run script
+			return nil
+		}
+
+		key := path.Dir(rel)
+		test := byTest[key]
+		if test == nil {
+			test = &TestArtifacts{Test: strings.TrimSuffix(testDir, "/"), Shard: shard, Artifacts: []Artifact{}}
+			byTest[key] = test
+		}
+
+		if name == "error-context.md" || strings.HasPrefix(name, "test-failed-") {
+			test.Failed = true
+		}
+		if strings.HasSuffix(name, videoPosterSuffix) || strings.HasSuffix(name, videoPreviewSuffix) {
+			previews[rel] = true
+			return nil
+		}
+		kind, ok := artifactKinds[strings.ToLower(path.Ext(name))]
+		if !ok {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		test.Artifacts = append(test.Artifacts, Artifact{Name: name, Path: rel, Kind: kind, Size: info.Size(), Modified: info.ModTime()})
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return []TestArtifacts{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tests := make([]TestArtifacts, 0, len(byTest))
+	for _, test := range byTest {
+		if len(test.Artifacts) == 0 {
+			continue
+		}
+		for i := range test.Artifacts {
+			a := &test.Artifacts[i]
+			if a.Kind != "video" {
+				continue
+			}
+			base := strings.TrimSuffix(a.Path, path.Ext(a.Path))
+			if previews[base+videoPosterSuffix] {
+				a.Poster = base + videoPosterSuffix
+			}
+			if previews[base+videoPreviewSuffix] {
+				a.Preview = base + videoPreviewSuffix
+			}
+		}
+		sort.Slice(test.Artifacts, func(i, j int) bool {
+			return test.Artifacts[i].Name < test.Artifacts[j].Name
+		})
+		tests = append(tests, *test)
+	}
+	sort.Slice(tests, func(i, j int) bool {
+		if tests[i].Test != tests[j].Test {
+			return tests[i].Test < tests[j].Test
+		}
+		return tests[i].Shard != nil && tests[j].Shard != nil && *tests[i].Shard < *tests[j].Shard
+	})
+
+	return tests, nil
+}
+
+// GET /runs/{id}/artifacts?namespace=ns lists the traces, videos and screenshots of a run
+// by test, the run by Job UID or name.
+func getRunArtifacts(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	job, err := findRun(r.Context(), clientset, getNamespace(r.URL.Query().Get("namespace")), r.PathValue("id"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if job == nil {
+		writeError(w, "run not found", http.StatusNotFound)
+		return
+	}
+
+	tests, err := runArtifacts(job)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, RunArtifacts{
+		RunRef: RunRef{Namespace: job.Namespace, Name: job.Name, UID: string(job.UID)},
+		Tests:  tests,
+	})
+}
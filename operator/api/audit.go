@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/syslog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"shared/clientip"
+	"shared/logging"
+)
+
+const (
+	auditConfigMap = "playwright-audit"
+	auditEventsKey = "events.json"
+	// maxAuditEvents bounds the events kept in the ConfigMap, the oldest are dropped
+	// first, the SIEM keeps all of them.
+	maxAuditEvents = 200
+	// maxAuditBody is how much of a request body is read for the audit, maxAuditPayload
+	// how much of the redacted payload is kept.
+	maxAuditBody    = 1 << 20
+	maxAuditPayload = 2048
+
+	// auditUserHeader names the signed in user the dashboard acts for.
+	auditUserHeader = "X-Playwright-User"
+)
+
+// auditSecretKeys are parts of the keys whose values are redacted from payloads.
+var auditSecretKeys = []string{"secret", "password", "passwd", "token", "apikey", "api_key", "credential", "authorization", "privatekey", "webhook"}
+
+// AuditEvent is a mutating request to the API. Each event carries the hash of the one
+// before, so removed or changed events break the chain, see verifyAuditChain.
+type AuditEvent struct {
+	Seq   int64     `json:"seq"`
+	Time  time.Time `json:"time"`
+	Actor string    `json:"actor,omitempty"`
+	// OnBehalfOf is the signed in user of the dashboard, as the dashboard tells.
+	OnBehalfOf string `json:"onBehalfOf,omitempty"`
+	Client     string `json:"client,omitempty"`
+	RequestID  string `json:"requestId,omitempty"`
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Query      string `json:"query,omitempty"`
+	Route      string `json:"route,omitempty"`
+	Status     int    `json:"status"`
+	// Payload is the request body with secrets redacted, a string of its start if it was
+	// too long.
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Truncated bool            `json:"truncated,omitempty"`
+	PrevHash  string          `json:"prevHash"`
+	Hash      string          `json:"hash"`
+}
+
+// hash returns the SHA-256 of the event without its hash.
+func (e AuditEvent) hash() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditVerification is the result of checking the chain of the kept events.
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	From     int64  `json:"from,omitempty"`
+	BrokenAt *int64 `json:"brokenAt,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+func verifyAuditChain(events []AuditEvent) AuditVerification {
+	v := AuditVerification{Valid: true, Checked: len(events)}
+	if len(events) > 0 {
+		v.From = events[0].Seq
+	}
+	for i, e := range events {
+		reason := ""
+		switch {
+		case e.Hash != e.hash():
+			reason = "hash does not match the event"
+		case i > 0 && e.PrevHash != events[i-1].Hash:
+			reason = "prevHash does not match the event before"
+		case i > 0 && e.Seq != events[i-1].Seq+1:
+			reason = "sequence has a gap"
+		}
+		if reason != "" {
+			seq := e.Seq
+			v.Valid, v.BrokenAt, v.Reason = false, &seq, reason
+			break
+		}
+	}
+
+	return v
+}
+
+// redactSecrets replaces the values of keys that look like secrets and the values of env
+// maps, which may hold secrets, by ***.
+func redactSecrets(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for k, v := range value {
+			lower := strings.ToLower(k)
+			secret := false
+			for _, part := range auditSecretKeys {
+				if strings.Contains(lower, part) {
+					secret = true
+					break
+				}
+			}
+			switch env, isMap := v.(map[string]interface{}); {
+			case secret && v != nil:
+				value[k] = "***"
+			case lower == "env" && isMap:
+				for name := range env {
+					env[name] = "***"
+				}
+			default:
+				value[k] = redactSecrets(v)
+			}
+		}
+		return value
+	case []interface{}:
+		for i, v := range value {
+			value[i] = redactSecrets(v)
+		}
+		return value
+	}
+
+	return value
+}
+
+// auditPayload returns the redacted body of a request, JSON and form bodies with their
+// contents and others by type and size.
+func auditPayload(contentType string, body []byte) (json.RawMessage, bool) {
+	if len(body) == 0 {
+		return nil, false
+	}
+
+	var value interface{}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, false
+		}
+		fields := map[string]interface{}{}
+		for k, v := range form {
+			fields[k] = strings.Join(v, ",")
+		}
+		value = fields
+	default:
+		if err := json.Unmarshal(body, &value); err != nil {
+			value = map[string]interface{}{"contentType": contentType, "bytes": len(body)}
+		}
+	}
+
+	data, err := json.Marshal(redactSecrets(value))
+	if err != nil {
+		return nil, false
+	}
+	if len(data) > maxAuditPayload {
+		data, _ = json.Marshal(string(data[:maxAuditPayload]))
+		return data, true
+	}
+
+	return data, false
+}
+
+// auditActor names the caller by the claims of its token.
+func auditActor(claims map[string]interface{}) string {
+	for _, claim := range []string{"preferred_username", "email", "azp", "client_id", "sub"} {
+		if v, ok := claims[claim].(string); ok && v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// auditLog chains the events of mutating requests, keeps the latest in a ConfigMap and
+// sends all of them to the syslog server and webhook of the SIEM.
+type auditLog struct {
+	clientset *kubernetes.Clientset
+	events    chan AuditEvent
+	// slots holds a token per request being recorded, so events never wait for room
+	slots   chan struct{}
+	webhook string
+
+	syslogNetwork, syslogAddr string
+	syslog                    *syslog.Writer
+}
+
+// newAuditLogFromEnv reads AUDIT_SYSLOG_ADDR, like udp://siem.example.com:514 or
+// tcp://siem.example.com:601, and AUDIT_WEBHOOK, events are only kept in the ConfigMap
+// without.
+func newAuditLogFromEnv(clientset *kubernetes.Clientset) (*auditLog, error) {
+	a := newAuditLog(clientset, maxPendingAuditEvents)
+	a.webhook = os.Getenv("AUDIT_WEBHOOK")
+	if addr := os.Getenv("AUDIT_SYSLOG_ADDR"); addr != "" {
+		u, err := url.Parse(addr)
+		if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+			return nil, fmt.Errorf("AUDIT_SYSLOG_ADDR must be udp://host:port or tcp://host:port")
+		}
+		a.syslogNetwork, a.syslogAddr = u.Scheme, u.Host
+	}
+
+	return a, nil
+}
+
+// maxPendingAuditEvents bounds the events waiting to be saved.
+const maxPendingAuditEvents = 1000
+
+func newAuditLog(clientset *kubernetes.Clientset, pending int) *auditLog {
+	return &auditLog{clientset: clientset, events: make(chan AuditEvent, pending), slots: make(chan struct{}, pending)}
+}
+
+// middleware records the mutating requests the handler serves. It runs after
+// authentication, which sets the claims. Requests are refused with 503 while as many
+// events as the log holds are pending, as they could not be recorded.
+func (a *auditLog) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case a.slots <- struct{}{}:
+		default:
+			log.Printf("audit log is full, refusing %s %s", r.Method, r.URL.Path)
+			w.Header().Set("Retry-After", "5")
+			writeError(w, "the audit log is full, try again later", http.StatusServiceUnavailable)
+			return
+		}
+
+		var body []byte
+		if r.Body != nil {
+			body, _ = io.ReadAll(io.LimitReader(r.Body, maxAuditBody))
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		}
+		recorder := &logging.StatusRecorder{ResponseWriter: w}
+		// handlers that panic are recorded as failed, they may have changed something
+		defer func() {
+			p := recover()
+			event := AuditEvent{
+				Time:       time.Now().UTC(),
+				Actor:      auditActor(requestClaims(r)),
+				OnBehalfOf: r.Header.Get(auditUserHeader),
+				Client:     clientip.FromRequest(r),
+				RequestID:  logging.RequestID(r.Context()),
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				Query:      r.URL.RawQuery,
+				Route:      r.Pattern,
+				Status:     recorder.Status,
+			}
+			switch {
+			case p != nil:
+				event.Status = http.StatusInternalServerError
+			case event.Status == 0:
+				event.Status = http.StatusOK
+			}
+			event.Payload, event.Truncated = auditPayload(r.Header.Get("Content-Type"), body)
+
+			// the slot leaves room for the event
+			a.events <- event
+			if p != nil {
+				panic(p)
+			}
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+func loadAuditEvents(ctx context.Context, clientset *kubernetes.Clientset) (*corev1.ConfigMap, []AuditEvent, error) {
+	namespace := getNamespace("")
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, auditConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: auditConfigMap, Namespace: namespace}}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	events := []AuditEvent{}
+	if data := cm.Data[auditEventsKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &events); err != nil {
+			return nil, nil, fmt.Errorf("decoding %s: %w", auditConfigMap, err)
+		}
+	}
+
+	return cm, events, nil
+}
+
+func saveAuditEvents(ctx context.Context, clientset *kubernetes.Clientset, cm *corev1.ConfigMap, events []AuditEvent) error {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[auditEventsKey] = string(data)
+
+	if cm.ResourceVersion == "" {
+		_, err = clientset.CoreV1().ConfigMaps(cm.Namespace).Create(ctx, cm, metav1.CreateOptions{})
+	} else {
+		_, err = clientset.CoreV1().ConfigMaps(cm.Namespace).Update(ctx, cm, metav1.UpdateOptions{})
+	}
+
+	return err
+}
+
+// append chains the events to the kept ones and saves them, it returns the chained
+// events.
+func (a *auditLog) append(ctx context.Context, pending []AuditEvent) ([]AuditEvent, error) {
+	for attempt := 0; ; attempt++ {
+		cm, events, err := loadAuditEvents(ctx, a.clientset)
+		if err != nil {
+			return nil, err
+		}
+
+		var last AuditEvent
+		if len(events) > 0 {
+			last = events[len(events)-1]
+		}
+		chained := make([]AuditEvent, len(pending))
+		for i, e := range pending {
+			e.Seq, e.PrevHash = last.Seq+1, last.Hash
+			e.Hash = e.hash()
+			chained[i], last = e, e
+		}
+
+		events = append(events, chained...)
+		if len(events) > maxAuditEvents {
+			events = events[len(events)-maxAuditEvents:]
+		}
+		err = saveAuditEvents(ctx, a.clientset, cm, events)
+		if err == nil {
+			return chained, nil
+		}
+		if (!apierrors.IsConflict(err) && !apierrors.IsAlreadyExists(err)) || attempt == 4 {
+			return nil, err
+		}
+	}
+}
+
+func (a *auditLog) export(ctx context.Context, e AuditEvent) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if a.syslogAddr != "" && a.syslog == nil {
+		// the writer dials again after failed writes once it connected
+		a.syslog, err = syslog.Dial(a.syslogNetwork, a.syslogAddr, syslog.LOG_NOTICE|syslog.LOG_AUTH, "playwright-operator")
+		if err != nil {
+			log.Printf("cannot connect to the audit syslog server: %v", err)
+		}
+	}
+	if a.syslog != nil {
+		if err := a.syslog.Notice(string(data)); err != nil {
+			log.Printf("cannot send audit event %d to syslog: %v", e.Seq, err)
+		}
+	}
+	if a.webhook == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.webhook, bytes.NewReader(data))
+	if err != nil {
+		log.Printf("cannot send audit event %d: %v", e.Seq, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		log.Printf("cannot send audit event %d: %v", e.Seq, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		log.Printf("audit webhook answered %s for event %d", resp.Status, e.Seq)
+	}
+}
+
+// run chains and saves the recorded events, several at once when they pile up, and
+// exports them. Events that cannot be saved are logged with their payload.
+func (a *auditLog) run(ctx context.Context) {
+	for {
+		var pending []AuditEvent
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-a.events:
+			<-a.slots
+			pending = append(pending, e)
+		}
+	drain:
+		for len(pending) < maxAuditEvents {
+			select {
+			case e := <-a.events:
+				<-a.slots
+				pending = append(pending, e)
+			default:
+				break drain
+			}
+		}
+
+		chained, err := a.append(ctx, pending)
+		if err != nil {
+			for _, e := range pending {
+				data, _ := json.Marshal(e)
+				log.Printf("cannot save audit event: %v: %s", err, data)
+			}
+			continue
+		}
+		for _, e := range chained {
+			a.export(ctx, e)
+		}
+	}
+}
+
+// GET /admin/audit?limit=n&actor=name&path=prefix lists the latest audit events, the
+// newest first.
+func listAuditEvents(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	query := r.URL.Query()
+	limit := maxAuditEvents
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	actor, prefix := query.Get("actor"), query.Get("path")
+
+	_, events, err := loadAuditEvents(r.Context(), clientset)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	latest := []AuditEvent{}
+	for i := len(events) - 1; i >= 0 && len(latest) < limit; i-- {
+		e := events[i]
+		if actor != "" && e.Actor != actor && e.OnBehalfOf != actor {
+			continue
+		}
+		if !strings.HasPrefix(e.Path, prefix) {
+			continue
+		}
+		latest = append(latest, e)
+	}
+
+	respondJSON(w, latest)
+}
+
+// GET /admin/audit/verify checks the hash chain of the kept audit events.
+func verifyAuditEvents(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	_, events, err := loadAuditEvents(r.Context(), clientset)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, verifyAuditChain(events))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuditMiddlewareRefusesWhenFull(t *testing.T) {
+	a := newAuditLog(nil, 2)
+	served := 0
+	handler := a.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/runs", strings.NewReader(`{"image": "playwright"}`)))
+		want := http.StatusCreated
+		if i == 2 {
+			want = http.StatusServiceUnavailable
+		}
+		if w.Code != want {
+			t.Errorf("request %d: status %d, want %d", i, w.Code, want)
+		}
+	}
+	if served != 2 {
+		t.Errorf("served %d requests, want 2", served)
+	}
+	if len(a.events) != 2 {
+		t.Fatalf("recorded %d events, want 2", len(a.events))
+	}
+	if e := <-a.events; e.Method != http.MethodPost || e.Path != "/runs" || e.Status != http.StatusCreated {
+		t.Errorf("event = %+v", e)
+	}
+
+	// reads are not recorded and never refused
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jobs", nil))
+	if w.Code != http.StatusCreated {
+		t.Errorf("GET status %d, want %d", w.Code, http.StatusCreated)
+	}
+}
+
+func TestAuditMiddlewareRecordsPanics(t *testing.T) {
+	a := newAuditLog(nil, 1)
+	handler := a.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	func() {
+		defer func() {
+			if p := recover(); p != http.ErrAbortHandler {
+				t.Errorf("recovered %v, want the panic of the handler", p)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/runs/abc", nil))
+	}()
+	if e := <-a.events; e.Status != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", e.Status)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// authRealm names the API in the WWW-Authenticate challenges.
+const authRealm = "playwright-operator"
+
+// unauthenticatedPaths are served without a token of the issuer: probes, Prometheus
+// scrapes, the warm pool agents, which prove their pod with a service account token
+// instead, see warmAssignment, and the description of the API.
+var unauthenticatedPaths = map[string]bool{
+	"/healthz":             true,
+	"/metrics":             true,
+	"/warmpool/assignment": true,
+	"/openapi.json":        true,
+	"/docs":                true,
+}
+
+type authConfig struct {
+	// issuer is the OpenID Connect issuer whose tokens are accepted, authentication is
+	// disabled without.
+	issuer   string
+	audience string
+	// allowedGroups admits tokens with one of these groups or roles, any valid token
+	// without.
+	allowedGroups []string
+	// groupClaims are the claims holding groups and roles, nested ones with dots, e.g.
+	// realm_access.roles of Keycloak.
+	groupClaims []string
+	// userClaims are the claims matched against the members of the synced directory
+	// groups, see syncDirectory.
+	userClaims []string
+}
+
+// authConfigFromEnv reads AUTH_OIDC_ISSUER, AUTH_AUDIENCE, AUTH_ALLOWED_GROUPS,
+// AUTH_GROUP_CLAIMS and DIRECTORY_USER_CLAIMS, the lists comma separated.
+func authConfigFromEnv() authConfig {
+	return authConfig{
+		issuer:        os.Getenv("AUTH_OIDC_ISSUER"),
+		audience:      os.Getenv("AUTH_AUDIENCE"),
+		allowedGroups: splitList(os.Getenv("AUTH_ALLOWED_GROUPS")),
+		groupClaims:   splitList(envOrDefault("AUTH_GROUP_CLAIMS", "groups,roles")),
+		userClaims:    splitList(envOrDefault("DIRECTORY_USER_CLAIMS", "email,preferred_username")),
+	}
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// claimStrings returns the strings of a claim, nested in objects along the dots of name.
+func claimStrings(claims map[string]interface{}, name string) []string {
+	var value interface{} = claims
+	for _, part := range strings.Split(name, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[part]
+	}
+
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var values []string
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+
+	return nil
+}
+
+// allowed tells whether the claims of a token carry one of the allowed groups or roles.
+func (cfg authConfig) allowed(claims map[string]interface{}) bool {
+	if len(cfg.allowedGroups) == 0 {
+		return true
+	}
+
+	return cfg.memberOf(claims, cfg.allowedGroups)
+}
+
+// memberOf tells whether the claims of a token carry one of groups, or its user is a
+// member of one in the directory.
+func (cfg authConfig) memberOf(claims map[string]interface{}, groups []string) bool {
+	var carried []string
+	for _, name := range cfg.groupClaims {
+		carried = append(carried, claimStrings(claims, name)...)
+	}
+	for _, name := range cfg.userClaims {
+		for _, user := range claimStrings(claims, name) {
+			carried = append(carried, directory.groupsOf(user)...)
+		}
+	}
+
+	for _, group := range carried {
+		for _, g := range groups {
+			if group == g {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+type claimsContextKey struct{}
+
+// requestClaims returns the claims of the token of a request, nil without authentication.
+func requestClaims(r *http.Request) map[string]interface{} {
+	claims, _ := r.Context().Value(claimsContextKey{}).(map[string]interface{})
+	return claims
+}
+
+// tokenUser is the name of the user of a token, empty without authentication.
+func tokenUser(claims map[string]interface{}) string {
+	for _, claim := range []string{"name", "preferred_username", "email"} {
+		if user, _ := claims[claim].(string); user != "" {
+			return user
+		}
+	}
+
+	return ""
+}
+
+// requestUser is who made a request: the user of its token with authentication, by,
+// what the caller claims, without.
+func requestUser(r *http.Request, by string) string {
+	if claims := requestClaims(r); claims != nil {
+		return tokenUser(claims)
+	}
+
+	return by
+}
+
+// requireAdmin answers 403 to tokens with none of the ADMIN_GROUPS, which may change how
+// the API works for everyone, and tells whether the request may go on. Any token may
+// without ADMIN_GROUPS, any request without authentication.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	claims := requestClaims(r)
+	if claims == nil {
+		return true
+	}
+	if groups := splitList(os.Getenv("ADMIN_GROUPS")); len(groups) > 0 && !authConfigFromEnv().memberOf(claims, groups) {
+		writeError(w, "none of the groups or roles of the token may administer the API", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// authMiddleware requires a bearer token of the issuer of cfg on every request outside of
+// unauthenticatedPaths. Requests without a valid token are answered with 401, tokens
+// without an allowed group or role with 403, both with a challenge as of RFC 6750.
+func authMiddleware(cfg authConfig, next http.Handler) http.Handler {
+	if cfg.issuer == "" {
+		return next
+	}
+
+	verifier := newOIDCVerifier(cfg.issuer, cfg.audience)
+	challenge := func(w http.ResponseWriter, status int, code, description string) {
+		value := fmt.Sprintf("Bearer realm=%q", authRealm)
+		if code != "" {
+			value += fmt.Sprintf(", error=%q, error_description=%q", code, description)
+		}
+		w.Header().Set("WWW-Authenticate", value)
+		writeError(w, http.StatusText(status), status)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unauthenticatedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !strings.EqualFold(scheme, "Bearer") || token == "" {
+			challenge(w, http.StatusUnauthorized, "", "")
+			return
+		}
+
+		claims, err := verifier.verify(r.Context(), strings.TrimSpace(token))
+		if err != nil {
+			log.Printf("rejected token for %s %s: %v", r.Method, r.URL.Path, err)
+			challenge(w, http.StatusUnauthorized, "invalid_token", err.Error())
+			return
+		}
+		if !cfg.allowed(claims) {
+			challenge(w, http.StatusForbidden, "insufficient_scope", "none of the groups or roles of the token is allowed")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey{}, claims)))
+	})
+}
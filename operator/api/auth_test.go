@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func withClaims(r *http.Request, claims map[string]interface{}) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), claimsContextKey{}, claims))
+}
+
+func TestTokenUser(t *testing.T) {
+	for _, tc := range []struct {
+		claims map[string]interface{}
+		want   string
+	}{
+		{map[string]interface{}{"name": "Alice", "email": "alice@example.com"}, "Alice"},
+		{map[string]interface{}{"preferred_username": "alice", "email": "alice@example.com"}, "alice"},
+		{map[string]interface{}{"email": "alice@example.com"}, "alice@example.com"},
+		{map[string]interface{}{"sub": "1234"}, ""},
+		{nil, ""},
+	} {
+		if got := tokenUser(tc.claims); got != tc.want {
+			t.Errorf("tokenUser(%v) = %q, want %q", tc.claims, got, tc.want)
+		}
+	}
+}
+
+func TestRequestUser(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/runs/abc/signoff", nil)
+	if got := requestUser(r, "mallory"); got != "mallory" {
+		t.Errorf("without authentication requestUser = %q, want the claimed user", got)
+	}
+	r = withClaims(r, map[string]interface{}{"preferred_username": "alice"})
+	if got := requestUser(r, "mallory"); got != "alice" {
+		t.Errorf("with authentication requestUser = %q, want the user of the token", got)
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	t.Setenv("AUTH_GROUP_CLAIMS", "groups")
+	admin := map[string]interface{}{"groups": []interface{}{"playwright-admins"}}
+	developer := map[string]interface{}{"groups": []interface{}{"developers"}}
+
+	for _, tc := range []struct {
+		name   string
+		groups string
+		claims map[string]interface{}
+		want   bool
+	}{
+		{"without authentication", "playwright-admins", nil, true},
+		{"admin", "playwright-admins", admin, true},
+		{"not an admin", "playwright-admins", developer, false},
+		{"without ADMIN_GROUPS", "", developer, true},
+	} {
+		t.Setenv("ADMIN_GROUPS", tc.groups)
+		r := httptest.NewRequest(http.MethodPut, "/admin/settings", nil)
+		if tc.claims != nil {
+			r = withClaims(r, tc.claims)
+		}
+		w := httptest.NewRecorder()
+		if got := requireAdmin(w, r); got != tc.want {
+			t.Errorf("%s: requireAdmin = %v, want %v", tc.name, got, tc.want)
+		}
+		if !tc.want && w.Code != http.StatusForbidden {
+			t.Errorf("%s: status %d, want 403", tc.name, w.Code)
+		}
+	}
+}
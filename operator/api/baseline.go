@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	baselineConfigMap = "playwright-baselines"
+	baselineKey       = "baselines.json"
+	// baselinePinReason is the reason of the pins of baselines, see pinBaseline.
+	baselinePinReason = "baseline"
+)
+
+// Baseline is the run a suite is compared against.
+type Baseline struct {
+	Run    string    `json:"run"`
+	UID    string    `json:"uid"`
+	State  string    `json:"state"`
+	By     string    `json:"by,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// SuiteBaseline holds the current baseline of a suite and branch and the ones it replaced.
+type SuiteBaseline struct {
+	Suite   string     `json:"suite"`
+	Branch  string     `json:"branch,omitempty"`
+	Current *Baseline  `json:"current,omitempty"`
+	History []Baseline `json:"history,omitempty"`
+}
+
+type BaselineRequest struct {
+	Run    string `json:"run"`
+	Branch string `json:"branch"`
+	By     string `json:"by"`
+	Reason string `json:"reason"`
+}
+
+// baselines maps suite to branch to baseline, an empty branch applies to all branches.
+type baselines map[string]map[string]*SuiteBaseline
+
+func loadBaselines(ctx context.Context, clientset *kubernetes.Clientset, namespace string) (*corev1.ConfigMap, baselines, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, baselineConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: baselineConfigMap, Namespace: namespace}}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	all := baselines{}
+	if data := cm.Data[baselineKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &all); err != nil {
+			return nil, nil, fmt.Errorf("decoding %s: %w", baselineConfigMap, err)
+		}
+	}
+
+	return cm, all, nil
+}
+
+func saveBaselines(ctx context.Context, clientset *kubernetes.Clientset, cm *corev1.ConfigMap, all baselines) error {
+	data, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[baselineKey] = string(data)
+
+	if cm.ResourceVersion == "" {
+		_, err = clientset.CoreV1().ConfigMaps(cm.Namespace).Create(ctx, cm, metav1.CreateOptions{})
+	} else {
+		_, err = clientset.CoreV1().ConfigMaps(cm.Namespace).Update(ctx, cm, metav1.UpdateOptions{})
+	}
+
+	return err
+}
+
+// suiteBaseline returns the baseline of a suite and branch, falling back to the
+// branch independent baseline. It returns nil when none is set.
+func suiteBaseline(ctx context.Context, clientset *kubernetes.Clientset, namespace, suite, branch string) (*SuiteBaseline, error) {
+	_, all, err := loadBaselines(ctx, clientset, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return all.effective(suite, branch), nil
+}
+
+// effective looks up the baseline of suiteBaseline.
+func (all baselines) effective(suite, branch string) *SuiteBaseline {
+	if b := all[suite][branch]; b != nil && b.Current != nil {
+		return b
+	}
+	if b := all[suite][""]; b != nil && b.Current != nil {
+		return b
+	}
+
+	return nil
+}
+
+// GET /suites/{name}/baseline?namespace=ns&branch=b
+//
+// Returns the baseline the gate and comparisons of the branch use, that of all branches
+// when the branch has none of its own. Its branch tells which one it is.
+func getBaseline(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+	suite := r.PathValue("name")
+	branch := r.URL.Query().Get("branch")
+
+	b, err := suiteBaseline(r.Context(), clientset, namespace, suite, branch)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if b == nil {
+		writeError(w, fmt.Sprintf("suite %s has no baseline", suite), http.StatusNotFound)
+		return
+	}
+
+	respondJSON(w, b)
+}
+
+// isBaseline tells whether a run is the current baseline of its suite on any branch.
+func isBaseline(all baselines, job *batchv1.Job) bool {
+	for _, b := range all[job.Labels[suiteLabel]] {
+		if b.Current != nil && b.Current.UID == string(job.UID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pinBaseline pins a run that becomes a baseline, so cleanup, retention and the TTL
+// controller keep the reference of the comparisons.
+func pinBaseline(ctx context.Context, clientset *kubernetes.Clientset, job *batchv1.Job, by string) error {
+	if isPinned(job) {
+		return nil
+	}
+
+	patch, err := pinPatch(job, PinEvent{Action: "pin", By: by, Reason: baselinePinReason, Time: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(patch)
+	_, err = clientset.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, data, metav1.PatchOptions{})
+
+	return err
+}
+
+// unpinBaseline unpins a replaced baseline that was pinned for being one, unless it is
+// still the baseline of another branch or was signed off. Failures are logged, the run
+// merely stays pinned.
+func unpinBaseline(ctx context.Context, clientset *kubernetes.Clientset, all baselines, namespace string, replaced Baseline, by string) {
+	job, err := clientset.BatchV1().Jobs(namespace).Get(ctx, replaced.Run, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return
+	}
+	if err != nil {
+		log.Printf("cannot unpin the replaced baseline %s/%s: %v", namespace, replaced.Run, err)
+		return
+	}
+	history := pinHistory(job)
+	if string(job.UID) != replaced.UID || !isPinned(job) || isSignedOff(job) || isBaseline(all, job) ||
+		len(history) == 0 || history[len(history)-1].Reason != baselinePinReason {
+		return
+	}
+
+	patch, err := pinPatch(job, PinEvent{Action: "unpin", By: by, Reason: baselinePinReason, Time: time.Now().UTC()})
+	if err == nil {
+		data, _ := json.Marshal(patch)
+		_, err = clientset.BatchV1().Jobs(namespace).Patch(ctx, job.Name, types.MergePatchType, data, metav1.PatchOptions{})
+	}
+	if err != nil {
+		log.Printf("cannot unpin the replaced baseline %s/%s: %v", namespace, replaced.Run, err)
+	}
+}
+
+// POST /suites/{name}/baseline?namespace=ns with {"run": "jobname", "branch": "b", "by": "...", "reason": "..."}
+//
+// With authentication, by is the user of the token. The run is pinned while it is a
+// baseline, see pinBaseline, the baseline it replaces is unpinned again.
+func setBaseline(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+	suite := r.PathValue("name")
+
+	var req BaselineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Run == "" {
+		writeError(w, "run is required", http.StatusBadRequest)
+		return
+	}
+
+	job, err := clientset.BatchV1().Jobs(namespace).Get(r.Context(), req.Run, metav1.GetOptions{})
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if job.Labels[suiteLabel] != suite {
+		writeError(w, fmt.Sprintf("run %s does not belong to suite %s", req.Run, suite), http.StatusBadRequest)
+		return
+	}
+
+	baseline := Baseline{
+		Run:    job.Name,
+		UID:    string(job.UID),
+		State:  jobState(job),
+		By:     requestUser(r, req.By),
+		Reason: req.Reason,
+		Time:   time.Now().UTC(),
+	}
+	if err := pinBaseline(r.Context(), clientset, job, baseline.By); err != nil {
+		respondError(w, fmt.Errorf("cannot pin the baseline: %w", err))
+		return
+	}
+
+	// the ConfigMap is shared by all suites, concurrent updates are retried
+	var updated *SuiteBaseline
+	var saved baselines
+	for attempt := 0; ; attempt++ {
+		cm, all, err := loadBaselines(r.Context(), clientset, namespace)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+
+		if all[suite] == nil {
+			all[suite] = map[string]*SuiteBaseline{}
+		}
+		updated = all[suite][req.Branch]
+		if updated == nil {
+			updated = &SuiteBaseline{Suite: suite, Branch: req.Branch}
+			all[suite][req.Branch] = updated
+		}
+		if updated.Current != nil {
+			updated.History = append(updated.History, *updated.Current)
+		}
+		updated.Current = &baseline
+
+		err = saveBaselines(r.Context(), clientset, cm, all)
+		if err == nil {
+			saved = all
+			break
+		}
+		if (!apierrors.IsConflict(err) && !apierrors.IsAlreadyExists(err)) || attempt == 4 {
+			respondError(w, err)
+			return
+		}
+	}
+
+	if n := len(updated.History); n > 0 && updated.History[n-1].UID != baseline.UID {
+		unpinBaseline(r.Context(), clientset, saved, namespace, updated.History[n-1], baseline.By)
+	}
+
+	respondJSON(w, updated)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestIsBaseline(t *testing.T) {
+	all := baselines{
+		"checkout": {
+			"":     {Suite: "checkout", Current: &Baseline{Run: "checkout-1", UID: "uid-1"}, History: []Baseline{{Run: "checkout-0", UID: "uid-0"}}},
+			"main": {Suite: "checkout", Branch: "main", Current: &Baseline{Run: "checkout-2", UID: "uid-2"}},
+		},
+	}
+	run := func(suite, uid string) *batchv1.Job {
+		return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{UID: types.UID("uid-" + uid), Labels: map[string]string{suiteLabel: suite}}}
+	}
+
+	for _, tc := range []struct {
+		job  *batchv1.Job
+		want bool
+	}{
+		{run("checkout", "1"), true},
+		{run("checkout", "2"), true},
+		// replaced baselines are no longer protected
+		{run("checkout", "0"), false},
+		{run("search", "1"), false},
+	} {
+		if got := isBaseline(all, tc.job); got != tc.want {
+			t.Errorf("isBaseline(%s of %s) = %v, want %v", tc.job.UID, tc.job.Labels[suiteLabel], got, tc.want)
+		}
+	}
+}
+
+func TestEffectiveBaseline(t *testing.T) {
+	all := baselines{
+		"checkout": {
+			"":        {Suite: "checkout", Current: &Baseline{Run: "checkout-1"}},
+			"main":    {Suite: "checkout", Branch: "main", Current: &Baseline{Run: "checkout-2"}},
+			"cleared": {Suite: "checkout", Branch: "cleared", History: []Baseline{{Run: "checkout-0"}}},
+		},
+		"search": {
+			"main": {Suite: "search", Branch: "main", Current: &Baseline{Run: "search-1"}},
+		},
+	}
+
+	for _, tc := range []struct {
+		suite, branch string
+		want          string
+	}{
+		{"checkout", "main", "checkout-2"},
+		// branches without a baseline of their own are compared with that of all branches
+		{"checkout", "feature", "checkout-1"},
+		{"checkout", "cleared", "checkout-1"},
+		{"checkout", "", "checkout-1"},
+		{"search", "feature", ""},
+		{"billing", "main", ""},
+	} {
+		got := ""
+		if b := all.effective(tc.suite, tc.branch); b != nil {
+			got = b.Current.Run
+		}
+		if got != tc.want {
+			t.Errorf("effective(%s, %s) = %q, want %q", tc.suite, tc.branch, got, tc.want)
+		}
+	}
+}
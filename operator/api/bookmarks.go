@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const bookmarksKey = "bookmarks.json"
+
+// LogBookmark highlights the lines From to To of the logs of a pod of a run, counted
+// from 1 over the whole log.
+type LogBookmark struct {
+	ID        string    `json:"id"`
+	Pod       string    `json:"pod"`
+	Container string    `json:"container,omitempty"`
+	From      int       `json:"from"`
+	To        int       `json:"to"`
+	Note      string    `json:"note"`
+	By        string    `json:"by,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+// The bookmarks of a run are stored in a ConfigMap owned by its Job, so they are
+// removed together with the run.
+func bookmarksConfigMapName(job *batchv1.Job) string {
+	return "playwright-bookmarks-" + string(job.UID)
+}
+
+func loadBookmarks(ctx context.Context, clientset *kubernetes.Clientset, job *batchv1.Job) (*corev1.ConfigMap, []LogBookmark, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(job.Namespace).Get(ctx, bookmarksConfigMapName(job), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      bookmarksConfigMapName(job),
+				Namespace: job.Namespace,
+				OwnerReferences: []metav1.OwnerReference{
+					*metav1.NewControllerRef(job, batchv1.SchemeGroupVersion.WithKind("Job")),
+				},
+			},
+		}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	var bookmarks []LogBookmark
+	if data := cm.Data[bookmarksKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &bookmarks); err != nil {
+			return nil, nil, fmt.Errorf("decoding %s: %w", cm.Name, err)
+		}
+	}
+
+	return cm, bookmarks, nil
+}
+
+func saveBookmarks(ctx context.Context, clientset *kubernetes.Clientset, cm *corev1.ConfigMap, bookmarks []LogBookmark) error {
+	data, err := json.Marshal(bookmarks)
+	if err != nil {
+		return err
+	}
+
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[bookmarksKey] = string(data)
+
+	if cm.ResourceVersion == "" {
+		_, err = clientset.CoreV1().ConfigMaps(cm.Namespace).Create(ctx, cm, metav1.CreateOptions{})
+	} else {
+		_, err = clientset.CoreV1().ConfigMaps(cm.Namespace).Update(ctx, cm, metav1.UpdateOptions{})
+	}
+
+	return err
+}
+
+// updateBookmarks applies fn to the bookmarks of a run, retrying on concurrent updates.
+func updateBookmarks(ctx context.Context, clientset *kubernetes.Clientset, job *batchv1.Job, fn func([]LogBookmark) []LogBookmark) error {
+	for attempt := 0; ; attempt++ {
+		cm, bookmarks, err := loadBookmarks(ctx, clientset, job)
+		if err != nil {
+			return err
+		}
+
+		err = saveBookmarks(ctx, clientset, cm, fn(bookmarks))
+		if err == nil {
+			return nil
+		}
+		if (!apierrors.IsConflict(err) && !apierrors.IsAlreadyExists(err)) || attempt == 4 {
+			return err
+		}
+	}
+}
+
+// runForRequest resolves the run of a /runs/{id} request, answering 404 when it does not exist.
+func runForRequest(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) *batchv1.Job {
+	job, err := findRun(r.Context(), clientset, getNamespace(r.URL.Query().Get("namespace")), r.PathValue("id"))
+	if err != nil {
+		respondError(w, err)
+		return nil
+	}
+	if job == nil {
+		writeError(w, "run not found", http.StatusNotFound)
+		return nil
+	}
+
+	return job
+}
+
+// GET /runs/{id}/bookmarks?namespace=ns&pod=name lists the bookmarks of a run, of one
+// pod if given, in log order.
+func listBookmarks(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	job := runForRequest(w, r, clientset)
+	if job == nil {
+		return
+	}
+
+	_, bookmarks, err := loadBookmarks(r.Context(), clientset, job)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	pod := r.URL.Query().Get("pod")
+	result := []LogBookmark{}
+	for _, b := range bookmarks {
+		if pod == "" || b.Pod == pod {
+			result = append(result, b)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Pod != result[j].Pod {
+			return result[i].Pod < result[j].Pod
+		}
+		return result[i].From < result[j].From
+	})
+
+	respondJSON(w, result)
+}
+
+// POST /runs/{id}/bookmarks?namespace=ns with {"pod": "...", "from": 10, "to": 12, "note": "...", "by": "..."}
+func createBookmark(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	job := runForRequest(w, r, clientset)
+	if job == nil {
+		return
+	}
+
+	var bookmark LogBookmark
+	if err := json.NewDecoder(r.Body).Decode(&bookmark); err != nil {
+		writeError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if bookmark.Pod == "" {
+		writeError(w, "pod is required", http.StatusBadRequest)
+		return
+	}
+	if bookmark.To == 0 {
+		bookmark.To = bookmark.From
+	}
+	if bookmark.From < 1 || bookmark.To < bookmark.From {
+		writeError(w, "from must be at least 1 and to not before from", http.StatusBadRequest)
+		return
+	}
+
+	id, err := randomSuffix()
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	bookmark.ID = id
+	bookmark.Created = time.Now().UTC()
+
+	if err := updateBookmarks(r.Context(), clientset, job, func(bookmarks []LogBookmark) []LogBookmark {
+		return append(bookmarks, bookmark)
+	}); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSONStatus(w, http.StatusCreated, bookmark)
+}
+
+// DELETE /runs/{id}/bookmarks/{bookmark}?namespace=ns
+func deleteBookmark(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	job := runForRequest(w, r, clientset)
+	if job == nil {
+		return
+	}
+
+	id := r.PathValue("bookmark")
+	found := false
+	if err := updateBookmarks(r.Context(), clientset, job, func(bookmarks []LogBookmark) []LogBookmark {
+		kept := bookmarks[:0]
+		for _, b := range bookmarks {
+			if b.ID == id {
+				found = true
+				continue
+			}
+			kept = append(kept, b)
+		}
+		return kept
+	}); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	if !found {
+		writeError(w, "bookmark not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	browserMatrixConfigMap = "playwright-browser-matrix"
+	browserMatrixKey       = "matrix.json"
+	browserProbeName       = "browser-versions"
+)
+
+// browserProbeScript prints the browser versions bundled with the Playwright of the image
+// as its termination message. It never fails, a missing probe only skips the check.
+const browserProbeScript = `node -e '
+const v = {};
+for (const b of require("playwright-core/browsers.json").browsers) if (b.browserVersion) v[b.name] = b.browserVersion;
+require("fs").writeFileSync("/dev/termination-log", JSON.stringify(v));
+' || true`
+
+// BrowserMatrix maps browser names to the versions a suite supports, e.g.
+// {"chromium": ">=120 <131"}. Constraints compare dotted versions and are all required.
+type BrowserMatrix map[string]string
+
+// browserMatrices maps suites to their matrix.
+type browserMatrices map[string]BrowserMatrix
+
+// browserProbe runs before the tests in the image of the run to report its browsers.
+func browserProbe(image string) corev1.Container {
+	return corev1.Container{
+		Name:                     browserProbeName,
+		Image:                    image,
+		Command:                  []string{"sh", "-c", browserProbeScript},
+		TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+	}
+}
+
+// browserVersions returns the versions reported by the probe of the first pod that ran it.
+func browserVersions(pods []corev1.Pod) map[string]string {
+	for _, pod := range pods {
+		for _, status := range pod.Status.InitContainerStatuses {
+			if status.Name != browserProbeName || status.State.Terminated == nil {
+				continue
+			}
+
+			var versions map[string]string
+			if err := json.Unmarshal([]byte(status.State.Terminated.Message), &versions); err == nil && len(versions) > 0 {
+				return versions
+			}
+		}
+	}
+
+	return nil
+}
+
+// compareVersions compares dotted numeric versions, missing parts count as zero.
+func compareVersions(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(pb[i])
+		}
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// satisfies reports whether version meets every constraint. Constraints compare only as
+// many version parts as they name, so "<131" admits 130.0.6723.31.
+func satisfies(version, constraints string) (bool, error) {
+	for _, c := range strings.FieldsFunc(constraints, func(r rune) bool { return r == ' ' || r == ',' }) {
+		want := strings.TrimLeft(c, "<>=!")
+		op := c[:len(c)-len(want)]
+		if want == "" || strings.Trim(want, "0123456789.") != "" {
+			return false, fmt.Errorf("invalid constraint %q", c)
+		}
+
+		got := version
+		if parts := strings.Split(version, "."); len(parts) > strings.Count(want, ".")+1 {
+			got = strings.Join(parts[:strings.Count(want, ".")+1], ".")
+		}
+
+		cmp := compareVersions(got, want)
+		var ok bool
+		switch op {
+		case ">=":
+			ok = cmp >= 0
+		case ">":
+			ok = cmp > 0
+		case "<=":
+			ok = cmp <= 0
+		case "<":
+			ok = cmp < 0
+		case "=", "":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		default:
+			return false, fmt.Errorf("invalid constraint %q", c)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (m BrowserMatrix) validate() error {
+	for browser, constraints := range m {
+		if _, err := satisfies("0", constraints); err != nil {
+			return fmt.Errorf("%s: %w", browser, err)
+		}
+	}
+
+	return nil
+}
+
+// skew lists the browsers that ran outside the matrix, browsers the matrix does not
+// mention are not checked.
+func (m BrowserMatrix) skew(versions map[string]string) []string {
+	var warnings []string
+	for browser, constraints := range m {
+		version, ok := versions[browser]
+		if !ok {
+			continue
+		}
+		if ok, err := satisfies(version, constraints); err == nil && !ok {
+			warnings = append(warnings, fmt.Sprintf("%s %s is outside the supported versions %s", browser, version, constraints))
+		}
+	}
+	sort.Strings(warnings)
+
+	return warnings
+}
+
+func loadBrowserMatrices(ctx context.Context, clientset *kubernetes.Clientset, namespace string) (*corev1.ConfigMap, browserMatrices, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, browserMatrixConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: browserMatrixConfigMap, Namespace: namespace}}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	all := browserMatrices{}
+	if data := cm.Data[browserMatrixKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &all); err != nil {
+			return nil, nil, fmt.Errorf("decoding %s: %w", browserMatrixConfigMap, err)
+		}
+	}
+
+	return cm, all, nil
+}
+
+// browserSkew checks the browsers a run used against the matrix of its suite.
+func browserSkew(ctx context.Context, clientset *kubernetes.Clientset, namespace, suite string, versions map[string]string) ([]string, error) {
+	if suite == "" || len(versions) == 0 {
+		return nil, nil
+	}
+
+	_, all, err := loadBrowserMatrices(ctx, clientset, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return all[suite].skew(versions), nil
+}
+
+// GET /suites/{name}/browsers?namespace=ns
+func getBrowserMatrix(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	_, all, err := loadBrowserMatrices(r.Context(), clientset, getNamespace(r.URL.Query().Get("namespace")))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	matrix := all[r.PathValue("name")]
+	if matrix == nil {
+		matrix = BrowserMatrix{}
+	}
+
+	respondJSON(w, matrix)
+}
+
+// PUT /suites/{name}/browsers?namespace=ns with {"chromium": ">=120 <131"}, an empty
+// object removes the matrix.
+func setBrowserMatrix(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+	suite := r.PathValue("name")
+
+	var matrix BrowserMatrix
+	if err := json.NewDecoder(r.Body).Decode(&matrix); err != nil {
+		writeError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := matrix.validate(); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for attempt := 0; ; attempt++ {
+		cm, all, err := loadBrowserMatrices(r.Context(), clientset, namespace)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+
+		if len(matrix) == 0 {
+			delete(all, suite)
+		} else {
+			all[suite] = matrix
+		}
+
+		data, err := json.Marshal(all)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[browserMatrixKey] = string(data)
+
+		if cm.ResourceVersion == "" {
+			_, err = clientset.CoreV1().ConfigMaps(namespace).Create(r.Context(), cm, metav1.CreateOptions{})
+		} else {
+			_, err = clientset.CoreV1().ConfigMaps(namespace).Update(r.Context(), cm, metav1.UpdateOptions{})
+		}
+		if err == nil {
+			break
+		}
+		if (!apierrors.IsConflict(err) && !apierrors.IsAlreadyExists(err)) || attempt == 4 {
+			respondError(w, err)
+			return
+		}
+	}
+
+	respondJSON(w, matrix)
+}
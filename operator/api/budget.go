@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+const (
+	budgetMaxDurationAnnotation     = "playwright.operator/budget-max-duration"
+	budgetMaxTestDurationAnnotation = "playwright.operator/budget-max-test-duration"
+	budgetMaxFlakyAnnotation        = "playwright.operator/budget-max-flaky"
+
+	budgetVerdictPassed  = "passed"
+	budgetVerdictFailed  = "failed-on-budget"
+	budgetVerdictPending = "pending"
+)
+
+// RunBudget declares limits a run has to stay within to pass, even if all tests passed.
+// Durations use Go syntax, e.g. "30m".
+type RunBudget struct {
+	MaxDuration     string `json:"maxDuration,omitempty"`
+	MaxTestDuration string `json:"maxTestDuration,omitempty"`
+	MaxFlaky        *int   `json:"maxFlaky,omitempty"`
+}
+
+// BudgetResult is the outcome of evaluating the budget of a run.
+type BudgetResult struct {
+	Verdict     string   `json:"verdict"`
+	Violations  []string `json:"violations,omitempty"`
+	Unevaluated []string `json:"unevaluated,omitempty"`
+}
+
+func (b *RunBudget) validate() error {
+	for _, v := range []string{b.MaxDuration, b.MaxTestDuration} {
+		if v == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(v); err != nil {
+			return fmt.Errorf("invalid budget duration %q: %w", v, err)
+		}
+	}
+	if b.MaxFlaky != nil && *b.MaxFlaky < 0 {
+		return fmt.Errorf("maxFlaky must not be negative")
+	}
+
+	return nil
+}
+
+// annotations stores the budget on the Job so it is evaluated from the Job alone.
+func (b *RunBudget) annotations() map[string]string {
+	annotations := map[string]string{}
+	if b.MaxDuration != "" {
+		annotations[budgetMaxDurationAnnotation] = b.MaxDuration
+	}
+	if b.MaxTestDuration != "" {
+		annotations[budgetMaxTestDurationAnnotation] = b.MaxTestDuration
+	}
+	if b.MaxFlaky != nil {
+		annotations[budgetMaxFlakyAnnotation] = strconv.Itoa(*b.MaxFlaky)
+	}
+
+	return annotations
+}
+
+// maxBudgetTestViolations bounds the tests named as over the max test duration.
+const maxBudgetTestViolations = 10
+
+// evaluateBudget checks a finished run against the budget declared in its annotations.
+// It returns nil for runs without a budget. Per-test limits are checked against the
+// parsed results, see runResults, and reported as unevaluated while there are none.
+func evaluateBudget(job *batchv1.Job) *BudgetResult {
+	maxDuration := job.Annotations[budgetMaxDurationAnnotation]
+	maxTestDuration := job.Annotations[budgetMaxTestDurationAnnotation]
+	maxFlaky := job.Annotations[budgetMaxFlakyAnnotation]
+	if maxDuration == "" && maxTestDuration == "" && maxFlaky == "" {
+		return nil
+	}
+
+	result := &BudgetResult{Verdict: budgetVerdictPassed}
+	if job.Status.StartTime == nil || job.Status.CompletionTime == nil {
+		result.Verdict = budgetVerdictPending
+		return result
+	}
+
+	if maxDuration != "" {
+		limit, err := time.ParseDuration(maxDuration)
+		if err != nil {
+			result.Unevaluated = append(result.Unevaluated, fmt.Sprintf("max duration: %v", err))
+		} else if d := job.Status.CompletionTime.Sub(job.Status.StartTime.Time); d > limit {
+			result.Violations = append(result.Violations,
+				fmt.Sprintf("run took %s, budget is %s", d.Round(time.Second), limit))
+		}
+	}
+	if maxTestDuration != "" || maxFlaky != "" {
+		results, err := runResults(job)
+		if err == nil && results == nil {
+			err = fmt.Errorf("no parsed test results")
+		}
+		if maxTestDuration != "" {
+			limit, parseErr := time.ParseDuration(maxTestDuration)
+			switch {
+			case err != nil:
+				result.Unevaluated = append(result.Unevaluated, fmt.Sprintf("max test duration: %v", err))
+			case parseErr != nil:
+				result.Unevaluated = append(result.Unevaluated, fmt.Sprintf("max test duration: %v", parseErr))
+			default:
+				result.Violations = append(result.Violations, testDurationViolations(results, limit)...)
+			}
+		}
+		if maxFlaky != "" {
+			limit, parseErr := strconv.Atoi(maxFlaky)
+			switch {
+			case err != nil:
+				result.Unevaluated = append(result.Unevaluated, fmt.Sprintf("max flaky tests: %v", err))
+			case parseErr != nil:
+				result.Unevaluated = append(result.Unevaluated, fmt.Sprintf("max flaky tests: %v", parseErr))
+			case int(results.Counts.Flaky) > limit:
+				result.Violations = append(result.Violations,
+					fmt.Sprintf("%d tests were flaky, budget is %d", results.Counts.Flaky, limit))
+			}
+		}
+	}
+
+	if len(result.Violations) > 0 {
+		result.Verdict = budgetVerdictFailed
+	}
+
+	return result
+}
+
+// testDurationViolations names the tests that took longer than the max test duration, all
+// of their attempts included.
+func testDurationViolations(results *RunResults, limit time.Duration) []string {
+	var violations []string
+	over := 0
+	for _, spec := range results.Specs {
+		d := time.Duration(spec.DurationMs) * time.Millisecond
+		if d <= limit {
+			continue
+		}
+		over++
+		if over <= maxBudgetTestViolations {
+			name := spec.Title
+			if spec.Project != "" {
+				name += " [" + spec.Project + "]"
+			}
+			violations = append(violations, fmt.Sprintf("test %q took %s, budget is %s", name, d.Round(time.Millisecond), limit))
+		}
+	}
+	if over > maxBudgetTestViolations {
+		violations = append(violations, fmt.Sprintf("%d more tests took longer than %s", over-maxBudgetTestViolations, limit))
+	}
+
+	return violations
+}
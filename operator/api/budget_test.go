@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func budgetJob(annotations map[string]string) *batchv1.Job {
+	start := metav1.NewTime(time.Now().Add(-10 * time.Minute))
+	end := metav1.NewTime(start.Add(5 * time.Minute))
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: "default", UID: "3f1d6c0e-0000-4000-8000-000000000001", Annotations: annotations},
+		Status:     batchv1.JobStatus{StartTime: &start, CompletionTime: &end},
+	}
+}
+
+func TestEvaluateBudget(t *testing.T) {
+	dir := useResultsDir(t)
+	report := `{"stats": {"expected": 1, "flaky": 2}, "suites": [{"title": "login.spec.ts", "specs": [
+		{"title": "fast", "file": "login.spec.ts", "tests": [{"projectName": "chromium", "status": "expected", "results": [{"duration": 800}]}]},
+		{"title": "slow", "file": "login.spec.ts", "tests": [{"projectName": "chromium", "status": "flaky", "results": [{"duration": 40000}, {"duration": 30000}]}]},
+		{"title": "retried", "file": "login.spec.ts", "tests": [{"projectName": "firefox", "status": "flaky", "results": [{"duration": 500}, {"duration": 600}]}]}
+	]}]}`
+	file := filepath.Join(dir, "checkpoints", "3f1d6c0e-0000-4000-8000-000000000001", "results.json")
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(report), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		annotations map[string]string
+		want        BudgetResult
+	}{
+		{"within", map[string]string{budgetMaxDurationAnnotation: "10m", budgetMaxTestDurationAnnotation: "2m", budgetMaxFlakyAnnotation: "2"},
+			BudgetResult{Verdict: budgetVerdictPassed}},
+		{"run too long", map[string]string{budgetMaxDurationAnnotation: "1m"},
+			BudgetResult{Verdict: budgetVerdictFailed, Violations: []string{"run took 5m0s, budget is 1m0s"}}},
+		{"test too long", map[string]string{budgetMaxTestDurationAnnotation: "1m"},
+			BudgetResult{Verdict: budgetVerdictFailed, Violations: []string{`test "slow [chromium]" took 1m10s, budget is 1m0s`}}},
+		{"too flaky", map[string]string{budgetMaxFlakyAnnotation: "1"},
+			BudgetResult{Verdict: budgetVerdictFailed, Violations: []string{"2 tests were flaky, budget is 1"}}},
+	} {
+		got := evaluateBudget(budgetJob(tc.annotations))
+		if got == nil || !reflect.DeepEqual(*got, tc.want) {
+			t.Errorf("%s: evaluateBudget() = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestEvaluateBudgetWithoutResults(t *testing.T) {
+	useResultsDir(t)
+
+	got := evaluateBudget(budgetJob(map[string]string{budgetMaxTestDurationAnnotation: "1m", budgetMaxFlakyAnnotation: "0"}))
+	want := &BudgetResult{Verdict: budgetVerdictPassed, Unevaluated: []string{
+		"max test duration: no parsed test results",
+		"max flaky tests: no parsed test results",
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("evaluateBudget() = %+v, want %+v", got, want)
+	}
+	if got := evaluateBudget(budgetJob(nil)); got != nil {
+		t.Errorf("evaluateBudget() without a budget = %+v, want nil", got)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"shared/buildinfo"
+)
+
+// NotificationDriver is a channel the API sends alerts through, Source names the alerts:
+// "runs" for the completions of runs, "slo" or "monitors".
+type NotificationDriver struct {
+	Driver string `json:"driver"`
+	Source string `json:"source"`
+}
+
+// Capabilities describes what an installation supports, so clients show only what works.
+// Features that depend on configuration are read from the environment and the settings of
+// the API.
+type Capabilities struct {
+	Version buildinfo.Info `json:"version"`
+	// Auth is the authentication of API requests, "oidc" for bearer tokens of an OpenID
+	// Connect issuer, see authMiddleware, "none" when the API relies on the network and
+	// RBAC of the cluster.
+	Auth string `json:"auth"`
+	// Storage is where reports and artifacts are kept, "pvc" for the PersistentVolumeClaim
+	// shared by all runs or the provider of the bucket reports are uploaded to, see
+	// resultsStore.
+	Storage       string               `json:"storage"`
+	Notifications []NotificationDriver `json:"notifications"`
+	// Analytics are the run statistics, SLOs and Prometheus metrics.
+	Analytics bool `json:"analytics"`
+	// Exec is interactive access to run pods, which the API does not offer.
+	Exec bool `json:"exec"`
+	// MultiCluster is set when runs can be started on other clusters than the one of the
+	// API.
+	MultiCluster      bool `json:"multiCluster"`
+	TestRunController bool `json:"testRunController"`
+	WarmPool          bool `json:"warmPool"`
+	VideoPreviews     bool `json:"videoPreviews"`
+	// Telemetry is set when usage statistics are sent, see reportTelemetry.
+	Telemetry bool `json:"telemetry"`
+	// ArtifactScan is set when artifacts are scanned for malware, see scanRunArtifacts.
+	ArtifactScan bool `json:"artifactScan"`
+}
+
+// capabilities describes the installation, with runDrivers of runNotificationDrivers.
+func capabilities(settings Settings, runDrivers []NotificationDriver) Capabilities {
+	caps := Capabilities{
+		Version:       buildinfo.Get(),
+		Auth:          "none",
+		Storage:       "pvc",
+		Notifications: append([]NotificationDriver{}, runDrivers...),
+		Analytics:     true,
+		WarmPool:      warmPoolFromEnv().enabled(),
+		VideoPreviews: videoPreviewImage() != "" && settings.feature(featureVideoPreviews),
+		Telemetry:     os.Getenv("TELEMETRY_ENDPOINT") != "",
+		ArtifactScan:  artifactScanningEnabled(),
+	}
+	if store, _ := resultsStoreFromEnv(); store != nil {
+		caps.Storage = store.Provider
+	}
+	if authConfigFromEnv().issuer != "" {
+		caps.Auth = "oidc"
+	}
+	caps.TestRunController, _ = strconv.ParseBool(os.Getenv("TESTRUN_CONTROLLER"))
+	if settings.SLOAlertWebhook != "" {
+		caps.Notifications = append(caps.Notifications, NotificationDriver{Driver: "webhook", Source: "slo"})
+	}
+	if settings.MonitorAlertWebhook != "" {
+		caps.Notifications = append(caps.Notifications, NotificationDriver{Driver: "webhook", Source: "monitors"})
+	}
+
+	return caps
+}
+
+// GET /capabilities
+func getCapabilities(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset, informers *runInformers) {
+	settings, err := effectiveSettings(r.Context(), clientset)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	namespaces, err := runNamespaces.list(r.Context(), clientset)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	// the runs of all namespaces are cached, notifyRunCompletions holds their informers
+	var jobs []*batchv1.Job
+	for _, job := range informers.jobs.list("", jobQuery{}) {
+		jobs = append(jobs, &job)
+	}
+	respondJSON(w, capabilities(settings, runNotificationDrivers(r.Context(), clientset, namespaces, jobs)))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestCapabilitiesReportEveryNotificationDriver(t *testing.T) {
+	t.Setenv("DEFAULT_NAMESPACE", "tests")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/tests" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(corev1.Namespace{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+			ObjectMeta: metav1.ObjectMeta{Name: "tests", Annotations: map[string]string{notifyAnnotation: "teams=secret:hooks/teams"}},
+		})
+	}))
+	defer srv.Close()
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := []*batchv1.Job{
+		{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{notifyAnnotation: "slack=https://hooks.slack.com/services/T0/B0/x,webhook=https://ci.example.com/runs"}}},
+		{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{notifyAnnotation: "pager=https://example.com"}}},
+		{},
+	}
+	caps := capabilities(Settings{SLOAlertWebhook: "https://alerts.example.com/slo"}, runNotificationDrivers(context.Background(), clientset, []string{"tests"}, jobs))
+
+	want := []NotificationDriver{
+		{Driver: sinkSlack, Source: "runs"},
+		{Driver: sinkTeams, Source: "runs"},
+		{Driver: sinkWebhook, Source: "runs"},
+		{Driver: "webhook", Source: "slo"},
+	}
+	if !reflect.DeepEqual(caps.Notifications, want) {
+		t.Errorf("notifications = %+v, want %+v", caps.Notifications, want)
+	}
+
+	if caps := capabilities(Settings{}, nil); caps.Notifications == nil || len(caps.Notifications) != 0 {
+		t.Errorf("without drivers notifications = %#v, want empty", caps.Notifications)
+	}
+}
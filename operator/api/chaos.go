@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+// Runs with CPU pressure carry chaosLabel, pending until their pods run and active until
+// the pressure is torn down, see reconcileChaos. The pressure Jobs in the target namespace
+// are labeled with the UID of their run.
+const (
+	chaosLabel                     = "playwright.operator/chaos"
+	chaosPending                   = "pending"
+	chaosActive                    = "active"
+	chaosRunLabel                  = "playwright.operator/chaos-run"
+	cpuPressureAnnotation          = "playwright.operator/cpu-pressure"
+	cpuPressureNamespaceAnnotation = "playwright.operator/cpu-pressure-namespace"
+	netemContainerName             = "netem"
+	maxPressureWorkers             = 16
+)
+
+// RunChaos degrades the conditions a run tests under, for suites checking the resilience
+// of the application. Latency and Jitter use Go syntax, e.g. "200ms".
+type RunChaos struct {
+	// Latency, Jitter and PacketLoss apply to all traffic leaving the pod of the run,
+	// through a netem qdisc set up by a sidecar.
+	Latency string `json:"latency,omitempty"`
+	Jitter  string `json:"jitter,omitempty"`
+	// PacketLoss is the share of dropped packets in percent.
+	PacketLoss float64 `json:"packetLoss,omitempty"`
+
+	CPUPressure *CPUPressure `json:"cpuPressure,omitempty"`
+}
+
+// CPUPressure keeps busy workers running in the namespace of the application under test
+// while the run is active. The namespace must be one of CHAOS_NAMESPACES.
+type CPUPressure struct {
+	Namespace string `json:"namespace"`
+	Workers   int    `json:"workers"`
+	// CPU limits each worker, it defaults to a whole core.
+	CPU string `json:"cpu,omitempty"`
+}
+
+// chaosDuration parses a duration of the chaos options, empty means none.
+func chaosDuration(v string) (time.Duration, error) {
+	if v == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid chaos duration %q", v)
+	}
+
+	return d, nil
+}
+
+func (c *RunChaos) validate() error {
+	latency, err := chaosDuration(c.Latency)
+	if err != nil {
+		return err
+	}
+	if _, err := chaosDuration(c.Jitter); err != nil {
+		return err
+	}
+	if c.Jitter != "" && latency == 0 {
+		return fmt.Errorf("jitter needs a latency")
+	}
+	if c.PacketLoss < 0 || c.PacketLoss > 100 {
+		return fmt.Errorf("packetLoss must be between 0 and 100")
+	}
+
+	if p := c.CPUPressure; p != nil {
+		if p.Namespace == "" {
+			return fmt.Errorf("cpuPressure needs the namespace of the application under test")
+		}
+		if !chaosNamespaceAllowed(p.Namespace) {
+			return fmt.Errorf("cpuPressure is not allowed in namespace %s, see CHAOS_NAMESPACES", p.Namespace)
+		}
+		if p.Workers < 1 || p.Workers > maxPressureWorkers {
+			return fmt.Errorf("cpuPressure workers must be between 1 and %d", maxPressureWorkers)
+		}
+		if p.CPU != "" {
+			if _, err := resource.ParseQuantity(p.CPU); err != nil {
+				return fmt.Errorf("invalid cpuPressure cpu %q", p.CPU)
+			}
+		}
+	}
+
+	return nil
+}
+
+// chaosNamespaceAllowed tells whether CPU pressure may run in a namespace, one of the
+// comma separated CHAOS_NAMESPACES. Without, CPU pressure is disabled.
+func chaosNamespaceAllowed(namespace string) bool {
+	for _, allowed := range strings.Split(os.Getenv("CHAOS_NAMESPACES"), ",") {
+		if strings.TrimSpace(allowed) == namespace {
+			return true
+		}
+	}
+
+	return false
+}
+
+// netemArgs returns the netem options for tc, or nothing without network faults.
+func (c *RunChaos) netemArgs() string {
+	var args []string
+	latency, _ := chaosDuration(c.Latency)
+	if latency > 0 {
+		args = append(args, "delay", fmt.Sprintf("%dus", latency.Microseconds()))
+		if jitter, _ := chaosDuration(c.Jitter); jitter > 0 {
+			args = append(args, fmt.Sprintf("%dus", jitter.Microseconds()))
+		}
+	}
+	if c.PacketLoss > 0 {
+		args = append(args, "loss", fmt.Sprintf("%g%%", c.PacketLoss))
+	}
+
+	return strings.Join(args, " ")
+}
+
+// addChaos sets up the faults of a run on its Job. Network faults come from a sidecar
+// sharing the network of the pod, which the tests only start once the qdisc is in place.
+func addChaos(job *batchv1.Job, chaos *RunChaos) {
+	if args := chaos.netemArgs(); args != "" {
+		script := fmt.Sprintf("tc qdisc add dev eth0 root netem %s || exit 1\ntrap 'exit 0' TERM\nsleep infinity & wait", args)
+		pod := &job.Spec.Template.Spec
+		pod.InitContainers = append(pod.InitContainers, corev1.Container{
+			Name:          netemContainerName,
+			Image:         envOrDefault("CHAOS_NETEM_IMAGE", "nicolaka/netshoot:v0.13"),
+			Command:       []string{"sh", "-c", script},
+			RestartPolicy: ptr.To(corev1.ContainerRestartPolicyAlways),
+			SecurityContext: &corev1.SecurityContext{
+				Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"NET_ADMIN"}},
+			},
+			StartupProbe: &corev1.Probe{
+				ProbeHandler: corev1.ProbeHandler{
+					Exec: &corev1.ExecAction{Command: []string{"sh", "-c", "tc qdisc show dev eth0 | grep -q netem"}},
+				},
+				PeriodSeconds:    1,
+				FailureThreshold: 30,
+			},
+		})
+	}
+
+	if chaos.CPUPressure != nil {
+		data, _ := json.Marshal(chaos.CPUPressure)
+		if job.Labels == nil {
+			job.Labels = map[string]string{}
+		}
+		job.Labels[chaosLabel] = chaosPending
+		if job.Annotations == nil {
+			job.Annotations = map[string]string{}
+		}
+		job.Annotations[cpuPressureAnnotation] = string(data)
+		job.Annotations[cpuPressureNamespaceAnnotation] = chaos.CPUPressure.Namespace
+	}
+}
+
+// runCPUPressure returns the CPU pressure a run asked for, nil for none.
+func runCPUPressure(run *batchv1.Job) (*CPUPressure, error) {
+	v := run.Annotations[cpuPressureAnnotation]
+	if v == "" {
+		return nil, nil
+	}
+
+	var p CPUPressure
+	if err := json.Unmarshal([]byte(v), &p); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", cpuPressureAnnotation, err)
+	}
+	if err := (&RunChaos{CPUPressure: &p}).validate(); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// chaosStarted tells whether a run started testing, with a pod whose containers all run.
+func chaosStarted(run *batchv1.Job) bool {
+	return ptr.Deref(run.Status.Ready, 0) > 0
+}
+
+// startCPUPressure creates the busy workers of a started run, unless they run already.
+// They stop on their own after CHAOS_MAX_DURATION, in case the run is deleted before it
+// finished.
+func startCPUPressure(ctx context.Context, clientset *kubernetes.Clientset, run *batchv1.Job, p *CPUPressure) error {
+	cpu := resource.MustParse("1")
+	if p.CPU != "" {
+		cpu = resource.MustParse(p.CPU)
+	}
+	maxDuration, err := time.ParseDuration(envOrDefault("CHAOS_MAX_DURATION", "1h"))
+	if err != nil {
+		return fmt.Errorf("invalid CHAOS_MAX_DURATION: %w", err)
+	}
+
+	existing, err := clientset.BatchV1().Jobs(p.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: chaosRunLabel + "=" + string(run.UID),
+	})
+	if err != nil {
+		return err
+	}
+	if len(existing.Items) > 0 {
+		return nil
+	}
+
+	labels := spawnedLabels(run, map[string]string{chaosRunLabel: string(run.UID)})
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "playwright-cpu-pressure-",
+			Namespace:    p.Namespace,
+			Labels:       labels,
+		},
+		Spec: batchv1.JobSpec{
+			Parallelism:           ptr.To(int32(p.Workers)),
+			Completions:           ptr.To(int32(p.Workers)),
+			BackoffLimit:          ptr.To[int32](0),
+			ActiveDeadlineSeconds: ptr.To(int64(maxDuration.Seconds())),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: copyLabels(labels)},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:    "stress",
+							Image:   envOrDefault("CHAOS_STRESS_IMAGE", "busybox:1.36"),
+							Command: []string{"sh", "-c", "while :; do :; done"},
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{corev1.ResourceCPU: cpu},
+								Limits:   corev1.ResourceList{corev1.ResourceCPU: cpu},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	created, err := clientset.BatchV1().Jobs(p.Namespace).Create(ctx, job, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("starting cpu pressure in namespace %s: %w", p.Namespace, err)
+	}
+	log.Printf("started cpu pressure %s/%s for run %s/%s", created.Namespace, created.Name, run.Namespace, run.Name)
+
+	return nil
+}
+
+// stopCPUPressure deletes the workers of a run.
+func stopCPUPressure(ctx context.Context, clientset *kubernetes.Clientset, run *batchv1.Job) error {
+	namespace := run.Annotations[cpuPressureNamespaceAnnotation]
+	if namespace == "" {
+		return nil
+	}
+
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: chaosRunLabel + "=" + string(run.UID),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs.Items {
+		err := clientset.BatchV1().Jobs(namespace).Delete(ctx, job.Name, metav1.DeleteOptions{
+			PropagationPolicy: ptr.To(metav1.DeletePropagationBackground),
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reconcileChaos starts the CPU pressure of runs once their pods run, and stops it when
+// they finished and drops their chaos label. Failures are logged and retried on the next
+// tick, the run itself goes on.
+func reconcileChaos(ctx context.Context, clientset *kubernetes.Clientset, informers *runInformers, namespace string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		jobs, err := informers.runs(ctx, namespace, chaosLabel)
+		if err != nil {
+			log.Printf("cannot list runs with chaos: %v", err)
+			continue
+		}
+
+		for i := range jobs {
+			job := &jobs[i]
+			switch state := jobState(job); {
+			case state == jobStateSucceeded || state == jobStateFailed || state == jobStateCancelled:
+				tearDownChaos(ctx, clientset, job)
+			case job.Labels[chaosLabel] == chaosPending && chaosStarted(job):
+				p, err := runCPUPressure(job)
+				if err == nil && p != nil {
+					err = startCPUPressure(ctx, clientset, job, p)
+				}
+				if err != nil {
+					log.Printf("cannot start cpu pressure of run %s/%s: %v", job.Namespace, job.Name, err)
+					continue
+				}
+				setChaosLabel(ctx, clientset, job, chaosActive)
+			}
+		}
+	}
+}
+
+// tearDownChaos stops the CPU pressure of a finished run and drops its chaos label.
+func tearDownChaos(ctx context.Context, clientset *kubernetes.Clientset, job *batchv1.Job) {
+	if err := stopCPUPressure(ctx, clientset, job); err != nil {
+		log.Printf("cannot stop cpu pressure of run %s/%s: %v", job.Namespace, job.Name, err)
+		return
+	}
+	if setChaosLabel(ctx, clientset, job, "") && job.Labels[chaosLabel] == chaosActive {
+		log.Printf("stopped cpu pressure of run %s/%s", job.Namespace, job.Name)
+	}
+}
+
+// setChaosLabel sets the chaos label of a run, empty removes it.
+func setChaosLabel(ctx context.Context, clientset *kubernetes.Clientset, job *batchv1.Job, value string) bool {
+	var label interface{}
+	if value != "" {
+		label = value
+	}
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{chaosLabel: label},
+		},
+	})
+	if _, err := clientset.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		log.Printf("cannot label run %s/%s: %v", job.Namespace, job.Name, err)
+		return false
+	}
+
+	return true
+}
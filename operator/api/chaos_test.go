@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestCPUPressureNamespaces(t *testing.T) {
+	chaos := &RunChaos{CPUPressure: &CPUPressure{Namespace: "shop", Workers: 2}}
+
+	t.Setenv("CHAOS_NAMESPACES", "")
+	if err := chaos.validate(); err == nil || !strings.Contains(err.Error(), "not allowed in namespace shop") {
+		t.Errorf("validate() without CHAOS_NAMESPACES = %v, want the namespace rejected", err)
+	}
+	t.Setenv("CHAOS_NAMESPACES", "checkout, shop")
+	if err := chaos.validate(); err != nil {
+		t.Errorf("validate() of an allowed namespace = %v", err)
+	}
+	chaos.CPUPressure.Namespace = "kube-system"
+	if err := chaos.validate(); err == nil {
+		t.Error("validate() accepted a namespace outside CHAOS_NAMESPACES")
+	}
+}
+
+func TestCPUPressureWaitsForTheRun(t *testing.T) {
+	t.Setenv("CHAOS_NAMESPACES", "shop")
+	job, err := newRunJob(RunSpec{Namespace: "tests", Image: "mcr.microsoft.com/playwright:v1.50.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pressure := &CPUPressure{Namespace: "shop", Workers: 2, CPU: "500m"}
+	addChaos(job, &RunChaos{CPUPressure: pressure})
+
+	if job.Labels[chaosLabel] != chaosPending {
+		t.Errorf("chaos label = %q, want %q until the run started", job.Labels[chaosLabel], chaosPending)
+	}
+	if got, err := runCPUPressure(job); err != nil || *got != *pressure {
+		t.Errorf("runCPUPressure() = %+v, %v, want %+v", got, err, pressure)
+	}
+	if chaosStarted(job) {
+		t.Error("a run without ready pods counts as started")
+	}
+	job.Status.Ready = ptr.To(int32(1))
+	if !chaosStarted(job) {
+		t.Error("a run with a ready pod does not count as started")
+	}
+
+	// reruns start their own pressure
+	job.ObjectMeta = metav1.ObjectMeta{Name: "run", Namespace: "tests", Labels: map[string]string{chaosLabel: chaosActive}, Annotations: job.Annotations}
+	if rerun := newRerunJob(job); rerun.Labels[chaosLabel] != chaosPending {
+		t.Errorf("chaos label of the rerun = %q, want %q", rerun.Labels[chaosLabel], chaosPending)
+	}
+	if rerun := newRerunJob(&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "run", Labels: map[string]string{chaosLabel: chaosActive}}}); rerun.Labels[chaosLabel] != "" {
+		t.Errorf("chaos label of a rerun without pressure = %q, want none", rerun.Labels[chaosLabel])
+	}
+}
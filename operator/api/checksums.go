@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// checksumLabel marks the runs whose report directories have a checksum manifest.
+	checksumLabel = "playwright.operator/checksums"
+
+	checksumManifestName = "checksums.json"
+	// checksumManifestVersion 2 manifests are written by the API once a run finished,
+	// version 1 ones were written by the dashboard on first request.
+	checksumManifestVersion = 2
+)
+
+// ChecksumManifest lists the SHA-256 digest of every file of a report directory of a run.
+// Signature is the Ed25519 signature of manifestPayload with the key KeyID, both empty
+// without ARTIFACT_MANIFEST_KEY.
+type ChecksumManifest struct {
+	Version   int               `json:"version"`
+	Algorithm string            `json:"algorithm"`
+	Generated time.Time         `json:"generated"`
+	Run       RunRef            `json:"run"`
+	Files     map[string]string `json:"files"`
+	Signature string            `json:"signature,omitempty"`
+	KeyID     string            `json:"keyId,omitempty"`
+}
+
+// manifestKey reads the key of ARTIFACT_MANIFEST_KEY, see seedKey. Manifests are not
+// signed without.
+func manifestKey() (ed25519.PrivateKey, error) {
+	return seedKey("ARTIFACT_MANIFEST_KEY")
+}
+
+// manifestPayload is what the signature of a manifest covers: a header naming the run and
+// the time, and the digests in sha256sum format sorted by path. The dashboard builds the
+// same to verify it.
+func manifestPayload(m *ChecksumManifest) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "playwright-checksums v%d %s %s %s\n", m.Version, m.Run.UID, m.Algorithm, m.Generated.UTC().Format(time.RFC3339Nano))
+
+	paths := make([]string, 0, len(m.Files))
+	for p := range m.Files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		fmt.Fprintf(&b, "%s  %s\n", m.Files[p], p)
+	}
+
+	return []byte(b.String())
+}
+
+func fileDigest(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// buildChecksumManifest digests the files below a report directory, but its manifest.
+func buildChecksumManifest(dir string, run RunRef, now time.Time) (*ChecksumManifest, error) {
+	manifest := &ChecksumManifest{
+		Version:   checksumManifestVersion,
+		Algorithm: "sha256",
+		Generated: now.UTC(),
+		Run:       run,
+		Files:     map[string]string{},
+	}
+
+	err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == checksumManifestName {
+			return nil
+		}
+
+		sum, err := fileDigest(file)
+		if err != nil {
+			return err
+		}
+		manifest.Files[rel] = sum
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// writeRunManifests writes a signed manifest to every report directory of a finished run,
+// the one of the run for the merged report and archived raw reports and those of its
+// pods. It returns how many directories it wrote one to.
+func writeRunManifests(job *batchv1.Job, podUIDs []types.UID, key ed25519.PrivateKey, now time.Time) (int, error) {
+	run := RunRef{Namespace: job.Namespace, Name: job.Name, UID: string(job.UID)}
+	dirs := []string{filepath.Join(resultsDir, string(job.UID))}
+	for _, pod := range podUIDs {
+		dirs = append(dirs, filepath.Join(resultsDir, string(pod)))
+	}
+
+	written := 0
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		manifest, err := buildChecksumManifest(dir, run, now)
+		if err != nil {
+			return written, err
+		}
+		if key != nil {
+			public := key.Public().(ed25519.PublicKey)
+			manifest.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifestPayload(manifest)))
+			manifest.KeyID = keyID(public)
+		}
+
+		err = writeFileAtomic(filepath.Join(dir, checksumManifestName), func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(manifest)
+		})
+		if err != nil {
+			return written, err
+		}
+		written++
+	}
+
+	return written, nil
+}
+
+// signRunReports writes the checksum manifests of finished runs once their raw reports
+// are archived, the last change to their report directories, and labels the runs with
+// checksumLabel. Runs finished before manifests were written by the API get theirs here
+// as well, replacing those the dashboard wrote on first request.
+func signRunReports(ctx context.Context, clientset *kubernetes.Clientset, informers *runInformers, namespace string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		key, err := manifestKey()
+		if err != nil {
+			log.Printf("cannot sign checksum manifests: %v", err)
+			continue
+		}
+		jobs, err := informers.runs(ctx, namespace, runsSelector+","+rawReportLabel+",!"+checksumLabel+",!"+reportMergeLabel)
+		if err != nil {
+			log.Printf("cannot list runs to write checksum manifests of: %v", err)
+			continue
+		}
+
+		for i := range jobs {
+			job := &jobs[i]
+			podUIDs, err := runPodUIDs(ctx, clientset, job)
+			if err != nil {
+				log.Printf("cannot list the pods of run %s/%s: %v", job.Namespace, job.Name, err)
+				continue
+			}
+			if _, err := writeRunManifests(job, podUIDs, key, time.Now()); err != nil {
+				log.Printf("cannot write the checksum manifests of run %s/%s: %v", job.Namespace, job.Name, err)
+				continue
+			}
+
+			patch, _ := json.Marshal(map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": map[string]interface{}{checksumLabel: "true"},
+				},
+			})
+			if _, err := clientset.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+				log.Printf("cannot label run %s/%s: %v", job.Namespace, job.Name, err)
+			}
+		}
+	}
+}
+
+// GET /checksums/key returns the public key checksum manifests are verified with, which
+// the dashboard takes as ARTIFACT_MANIFEST_PUBLIC_KEY.
+func getManifestKey(w http.ResponseWriter, r *http.Request) {
+	key, err := manifestKey()
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if key == nil {
+		writeError(w, "checksum manifests are not signed, ARTIFACT_MANIFEST_KEY is not set", http.StatusNotFound)
+		return
+	}
+
+	public := key.Public().(ed25519.PublicKey)
+	respondJSON(w, SignOffKey{Algorithm: "Ed25519", KeyID: keyID(public), PublicKey: base64.StdEncoding.EncodeToString(public)})
+}
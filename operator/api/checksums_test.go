@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestWriteRunManifests(t *testing.T) {
+	dir := useResultsDir(t)
+	now := time.Now()
+	writeStoredFile(t, filepath.Join(dir, runningPodUID, "index.html"), now)
+	writeStoredFile(t, filepath.Join(dir, runningPodUID, "data", "trace.zip"), now)
+	writeStoredFile(t, filepath.Join(dir, runningJobUID, "raw", "results.json.gz"), now)
+
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "run", UID: runningJobUID}}
+	written, err := writeRunManifests(job, []types.UID{runningPodUID, orphanUID}, key, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 2 {
+		t.Fatalf("wrote %d manifests, want one for the run and one for its pod", written)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, runningPodUID, checksumManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest ChecksumManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != 2 || manifest.Files["data/trace.zip"] == "" {
+		t.Errorf("files = %v, want index.html and data/trace.zip", manifest.Files)
+	}
+	if manifest.Run.UID != runningJobUID {
+		t.Errorf("run = %+v, want the run of the pod", manifest.Run)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(manifest.Signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := key.Public().(ed25519.PublicKey)
+	if !ed25519.Verify(public, manifestPayload(&manifest), signature) {
+		t.Error("the signature does not match the manifest read back")
+	}
+
+	manifest.Files["index.html"] = "0000"
+	if ed25519.Verify(public, manifestPayload(&manifest), signature) {
+		t.Error("the signature matches a tampered manifest")
+	}
+}
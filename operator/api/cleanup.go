@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	retentionLogConfigMap = "playwright-retention-log"
+	retentionLogKey       = "deletions.json"
+	// maxRetentionLog bounds the deletions kept in the log, the oldest are dropped first.
+	maxRetentionLog = 500
+	// orphanGracePeriod spares results without a Job that were written lately, their run
+	// may have been created after the runs were listed.
+	orphanGracePeriod = time.Hour
+)
+
+// runUID matches the directories of runs on the results volume.
+var runUID = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// ReportRetention removes the reports, checkpoints and soak snapshots of finished runs from
+// the results volume, see removeRunResults. Runs past MaxAge go first, then the oldest runs
+// beyond MaxCount and MaxTotalSize. The settings hold the retention of all results, the
+// policy of a suite that of its runs. Pinned and running runs count, but are kept.
+type ReportRetention struct {
+	// MaxAge is a duration like 720h or 30d since a run finished.
+	MaxAge   string `json:"maxAge,omitempty"`
+	MaxCount int    `json:"maxCount,omitempty"`
+	// MaxTotalSize is a quantity like 50Gi.
+	MaxTotalSize string `json:"maxTotalSize,omitempty"`
+	// DeleteJobs deletes the Jobs of pruned runs as well, which would otherwise stay until
+	// their ttlSecondsAfterFinished.
+	DeleteJobs bool `json:"deleteJobs,omitempty"`
+	// DryRun only logs what would be removed.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+func (r *ReportRetention) validate() error {
+	if r.MaxAge != "" {
+		if _, err := parseWindow(r.MaxAge); err != nil {
+			return fmt.Errorf("maxAge: %w", err)
+		}
+	}
+	if r.MaxCount < 0 {
+		return fmt.Errorf("maxCount must not be negative")
+	}
+	if r.MaxTotalSize != "" {
+		if q, err := resource.ParseQuantity(r.MaxTotalSize); err != nil || q.Sign() < 0 {
+			return fmt.Errorf("maxTotalSize must be a quantity like 50Gi")
+		}
+	}
+	if r.MaxAge == "" && r.MaxCount == 0 && r.MaxTotalSize == "" {
+		return fmt.Errorf("one of maxAge, maxCount and maxTotalSize is required")
+	}
+
+	return nil
+}
+
+// storedRun are the results of a run on the volume. Job is nil once the Job is gone.
+type storedRun struct {
+	uid  string
+	job  *batchv1.Job
+	time time.Time
+	size int64
+	// protected runs are running, pinned or orphans in their grace period.
+	protected bool
+	// podUIDs name the directories of the HTML reports of runs without shards.
+	podUIDs []types.UID
+}
+
+// dirUsage returns the size of the files below dir and when it was modified last.
+func dirUsage(dir string) (int64, time.Time, error) {
+	var size int64
+	var modified time.Time
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			size += info.Size()
+		}
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+		return nil
+	})
+
+	return size, modified, err
+}
+
+// storedRuns lists the runs with a report or checkpoint on the results volume, the newest
+// first. The directories named after the pods of a run, recorded on the Job or of the
+// pods, count as the results of the run.
+func storedRuns(jobs []batchv1.Job, pods []corev1.Pod, now time.Time) ([]storedRun, error) {
+	byUID := map[string]*batchv1.Job{}
+	owner := map[string]string{}
+	for i := range jobs {
+		byUID[string(jobs[i].UID)] = &jobs[i]
+		for _, pod := range recordedPodUIDs(&jobs[i]) {
+			owner[string(pod)] = string(jobs[i].UID)
+		}
+	}
+	for _, pod := range pods {
+		if uid := pod.Labels[batchv1.ControllerUidLabel]; byUID[uid] != nil {
+			owner[string(pod.UID)] = uid
+		}
+	}
+
+	runs := map[string]*storedRun{}
+	for _, parent := range []string{resultsDir, filepath.Join(resultsDir, "checkpoints")} {
+		entries, err := os.ReadDir(parent)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() || !runUID.MatchString(entry.Name()) {
+				continue
+			}
+			size, modified, err := dirUsage(filepath.Join(parent, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+
+			uid := entry.Name()
+			if job, ok := owner[uid]; ok && parent == resultsDir {
+				uid = job
+			}
+			run := runs[uid]
+			if run == nil {
+				run = &storedRun{uid: uid, job: byUID[uid]}
+				runs[uid] = run
+			}
+			if uid != entry.Name() {
+				run.podUIDs = append(run.podUIDs, types.UID(entry.Name()))
+			}
+			run.size += size
+			if modified.After(run.time) {
+				run.time = modified
+			}
+		}
+	}
+
+	sorted := make([]storedRun, 0, len(runs))
+	for _, run := range runs {
+		switch {
+		case run.job == nil:
+			run.protected = now.Sub(run.time) < orphanGracePeriod
+		case isPinned(run.job):
+			run.protected = true
+		default:
+			if finished, ok := finishedAt(run.job); ok {
+				run.time = finished
+			} else {
+				run.protected = true
+			}
+		}
+		sorted = append(sorted, *run)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].time.After(sorted[j].time)
+	})
+
+	return sorted, nil
+}
+
+// expired returns the reasons the retention removes runs for by UID. runs are sorted the
+// newest first.
+func (r *ReportRetention) expired(runs []storedRun, now time.Time) map[string]string {
+	maxAge, _ := parseWindow(r.MaxAge)
+	var maxSize int64
+	if r.MaxTotalSize != "" {
+		q, _ := resource.ParseQuantity(r.MaxTotalSize)
+		maxSize = q.Value()
+	}
+
+	reasons := map[string]string{}
+	var total int64
+	for i, run := range runs {
+		total += run.size
+		if run.protected {
+			continue
+		}
+
+		switch {
+		case r.MaxAge != "" && now.Sub(run.time) > maxAge:
+			reasons[run.uid] = "older than " + r.MaxAge
+		case r.MaxCount > 0 && i >= r.MaxCount:
+			reasons[run.uid] = fmt.Sprintf("beyond the latest %d runs", r.MaxCount)
+		case maxSize > 0 && total > maxSize:
+			reasons[run.uid] = "beyond " + r.MaxTotalSize
+		}
+	}
+
+	return reasons
+}
+
+// RetentionDeletion is an entry of the retention log. Policy is "settings" or the name of
+// the suite whose policy removed the results.
+type RetentionDeletion struct {
+	Time       time.Time `json:"time"`
+	UID        string    `json:"uid"`
+	Run        string    `json:"run,omitempty"`
+	Suite      string    `json:"suite,omitempty"`
+	Policy     string    `json:"policy"`
+	Reason     string    `json:"reason"`
+	SizeBytes  int64     `json:"sizeBytes"`
+	JobDeleted bool      `json:"jobDeleted,omitempty"`
+	DryRun     bool      `json:"dryRun,omitempty"`
+}
+
+func loadRetentionLog(ctx context.Context, clientset *kubernetes.Clientset) (*corev1.ConfigMap, []RetentionDeletion, error) {
+	namespace := getNamespace("")
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, retentionLogConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: retentionLogConfigMap, Namespace: namespace}}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	deletions := []RetentionDeletion{}
+	if data := cm.Data[retentionLogKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &deletions); err != nil {
+			return nil, nil, fmt.Errorf("decoding %s: %w", retentionLogConfigMap, err)
+		}
+	}
+
+	return cm, deletions, nil
+}
+
+func saveRetentionLog(ctx context.Context, clientset *kubernetes.Clientset, cm *corev1.ConfigMap, deletions []RetentionDeletion) error {
+	if len(deletions) > maxRetentionLog {
+		deletions = deletions[len(deletions)-maxRetentionLog:]
+	}
+	data, err := json.Marshal(deletions)
+	if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[retentionLogKey] = string(data)
+
+	if cm.ResourceVersion == "" {
+		_, err = clientset.CoreV1().ConfigMaps(cm.Namespace).Create(ctx, cm, metav1.CreateOptions{})
+	} else {
+		_, err = clientset.CoreV1().ConfigMaps(cm.Namespace).Update(ctx, cm, metav1.UpdateOptions{})
+	}
+
+	return err
+}
+
+// retentionDecision is why a run is removed, by the policy of the settings or a suite.
+type retentionDecision struct {
+	policy    string
+	reason    string
+	retention *ReportRetention
+}
+
+// applyRetention removes the results that the retention of the settings and of the suites
+// expire and appends them to the log. Dry runs are logged once per run and policy. The
+// runs of all namespaces are weighed together, results of runs outside namespaces count
+// as orphans.
+func applyRetention(ctx context.Context, clientset *kubernetes.Clientset, namespaces []string, now time.Time) error {
+	settings, err := effectiveSettings(ctx, clientset)
+	if err != nil {
+		return err
+	}
+	var (
+		jobs     []batchv1.Job
+		pods     []corev1.Pod
+		policies = map[string]map[string]SuitePolicy{}
+	)
+	for _, namespace := range namespaces {
+		_, nsPolicies, err := loadSuitePolicies(ctx, clientset, namespace)
+		if err != nil {
+			return err
+		}
+		policies[namespace] = nsPolicies
+		nsJobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{LabelSelector: runsSelector})
+		if err != nil {
+			return err
+		}
+		nsPods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: batchv1.ControllerUidLabel})
+		if err != nil {
+			return err
+		}
+		jobs, pods = append(jobs, nsJobs.Items...), append(pods, nsPods.Items...)
+	}
+	runs, err := storedRuns(jobs, pods, now)
+	if err != nil {
+		return err
+	}
+
+	decisions := map[string]retentionDecision{}
+	decide := func(policy string, retention *ReportRetention, runs []storedRun) {
+		for uid, reason := range retention.expired(runs, now) {
+			// a policy that removes the results wins over one that would in a dry run
+			if d, ok := decisions[uid]; !ok || d.retention.DryRun && !retention.DryRun {
+				decisions[uid] = retentionDecision{policy: policy, reason: reason, retention: retention}
+			}
+		}
+	}
+	if settings.ReportRetention != nil {
+		decide("settings", settings.ReportRetention, runs)
+	}
+	for namespace, nsPolicies := range policies {
+		for suite, policy := range nsPolicies {
+			if policy.ReportRetention == nil {
+				continue
+			}
+			var suiteRuns []storedRun
+			for _, run := range runs {
+				if run.job != nil && run.job.Namespace == namespace && run.job.Labels[suiteLabel] == suite {
+					suiteRuns = append(suiteRuns, run)
+				}
+			}
+			decide(suite, policy.ReportRetention, suiteRuns)
+		}
+	}
+	if len(decisions) == 0 {
+		return nil
+	}
+
+	cm, deletions, err := loadRetentionLog(ctx, clientset)
+	if err != nil {
+		return err
+	}
+	dryRunLogged := map[string]bool{}
+	for _, d := range deletions {
+		if d.DryRun {
+			dryRunLogged[d.UID+"/"+d.Policy] = true
+		}
+	}
+
+	logged := len(deletions)
+	for _, run := range runs {
+		d, ok := decisions[run.uid]
+		if !ok || d.retention.DryRun && dryRunLogged[run.uid+"/"+d.policy] {
+			continue
+		}
+
+		deletion := RetentionDeletion{
+			Time:      now.UTC(),
+			UID:       run.uid,
+			Policy:    d.policy,
+			Reason:    d.reason,
+			SizeBytes: run.size,
+			DryRun:    d.retention.DryRun,
+		}
+		if run.job != nil {
+			deletion.Run = run.job.Name
+			deletion.Suite = run.job.Labels[suiteLabel]
+		}
+		if d.retention.DryRun {
+			log.Printf("retention dry run: would remove the results of run %s (%s, %s)", run.uid, d.policy, d.reason)
+			deletions = append(deletions, deletion)
+			continue
+		}
+
+		if err := removeRunResults(types.UID(run.uid), run.podUIDs); err != nil {
+			log.Printf("cannot remove the results of run %s: %v", run.uid, err)
+			continue
+		}
+		if run.job != nil && d.retention.DeleteJobs {
+			err := clientset.BatchV1().Jobs(run.job.Namespace).Delete(ctx, run.job.Name, metav1.DeleteOptions{
+				PropagationPolicy: ptr.To(metav1.DeletePropagationBackground),
+				Preconditions:     &metav1.Preconditions{UID: ptr.To(run.job.UID)},
+			})
+			if err != nil && !apierrors.IsNotFound(err) {
+				log.Printf("cannot delete run %s/%s: %v", run.job.Namespace, run.job.Name, err)
+			}
+			deletion.JobDeleted = err == nil
+		}
+		log.Printf("removed the results of run %s (%s, %s)", run.uid, d.policy, d.reason)
+		deletions = append(deletions, deletion)
+	}
+	if len(deletions) == logged {
+		return nil
+	}
+
+	return saveRetentionLog(ctx, clientset, cm, deletions)
+}
+
+// enforceRetention applies the retention of the settings and suites to the results volume,
+// for the runs of every namespace the API lists runs in.
+func enforceRetention(ctx context.Context, clientset *kubernetes.Clientset, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		namespaces, err := runNamespaces.list(ctx, clientset)
+		if err != nil {
+			log.Printf("cannot list the namespaces of runs: %v", err)
+			continue
+		}
+		if err := applyRetention(ctx, clientset, namespaces, time.Now()); err != nil {
+			log.Printf("cannot apply the retention of results: %v", err)
+		}
+	}
+}
+
+// GET /admin/retention/log?limit=n&dryRun=true|false lists the latest removals of the
+// retention, the newest first.
+func listRetentionLog(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	query := r.URL.Query()
+	limit := maxRetentionLog
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	var dryRun *bool
+	if v := query.Get("dryRun"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, "dryRun must be true or false", http.StatusBadRequest)
+			return
+		}
+		dryRun = &b
+	}
+
+	_, deletions, err := loadRetentionLog(r.Context(), clientset)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	latest := []RetentionDeletion{}
+	for i := len(deletions) - 1; i >= 0 && len(latest) < limit; i-- {
+		if dryRun != nil && deletions[i].DryRun != *dryRun {
+			continue
+		}
+		latest = append(latest, deletions[i])
+	}
+
+	respondJSON(w, latest)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	runningJobUID = "00000000-0000-4000-8000-000000000001"
+	runningPodUID = "00000000-0000-4000-8000-000000000002"
+	pinnedJobUID  = "00000000-0000-4000-8000-000000000003"
+	pinnedPodUID  = "00000000-0000-4000-8000-000000000004"
+	orphanUID     = "00000000-0000-4000-8000-000000000005"
+)
+
+// useResultsDir points resultsDir to a temporary directory for the test.
+func useResultsDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	previous := resultsDir
+	resultsDir = dir
+	t.Cleanup(func() { resultsDir = previous })
+
+	return dir
+}
+
+func writeStoredFile(t *testing.T, file string, modified time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("<html></html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{file, filepath.Dir(file)} {
+		if err := os.Chtimes(p, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStoredRunsKeepsReportsOfPods(t *testing.T) {
+	dir := useResultsDir(t)
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+
+	// a fresh run without shards writes its report below the UID of its pod
+	writeStoredFile(t, filepath.Join(dir, runningPodUID, "index.html"), now)
+	writeStoredFile(t, filepath.Join(dir, "checkpoints", runningJobUID, "results.json"), now)
+	// a pinned run whose pod is gone, recorded on the Job
+	writeStoredFile(t, filepath.Join(dir, pinnedPodUID, "index.html"), old)
+	// a report whose run is gone
+	writeStoredFile(t, filepath.Join(dir, orphanUID, "index.html"), old)
+
+	completed := metav1.NewTime(old)
+	jobs := []batchv1.Job{
+		{ObjectMeta: metav1.ObjectMeta{Name: "running", UID: runningJobUID}},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pinned", UID: pinnedJobUID, Annotations: map[string]string{
+				pinnedAnnotation:     "true",
+				reportPodsAnnotation: pinnedPodUID,
+			}},
+			Status: batchv1.JobStatus{CompletionTime: &completed},
+		},
+	}
+	pods := []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "running-abcde", UID: runningPodUID, Labels: map[string]string{batchv1.ControllerUidLabel: runningJobUID}}},
+	}
+
+	runs, err := storedRuns(jobs, pods, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byUID := map[string]storedRun{}
+	for _, run := range runs {
+		byUID[run.uid] = run
+	}
+	if len(byUID) != 3 {
+		t.Fatalf("want the running, pinned and orphaned run, got %+v", runs)
+	}
+	for _, want := range []struct {
+		uid       string
+		pod       types.UID
+		protected bool
+	}{
+		{runningJobUID, runningPodUID, true},
+		{pinnedJobUID, pinnedPodUID, true},
+		{orphanUID, "", false},
+	} {
+		run, ok := byUID[want.uid]
+		if !ok {
+			t.Errorf("run %s is missing", want.uid)
+			continue
+		}
+		if run.protected != want.protected {
+			t.Errorf("run %s: protected = %v, want %v", want.uid, run.protected, want.protected)
+		}
+		if want.pod != "" && (len(run.podUIDs) != 1 || run.podUIDs[0] != want.pod) {
+			t.Errorf("run %s: podUIDs = %v, want [%s]", want.uid, run.podUIDs, want.pod)
+		}
+	}
+
+	retention := &ReportRetention{MaxAge: "1h", MaxCount: 1}
+	expired := retention.expired(runs, now)
+	if _, ok := expired[orphanUID]; !ok {
+		t.Errorf("the orphaned report is kept: %v", expired)
+	}
+	for _, uid := range []string{runningJobUID, pinnedJobUID, runningPodUID, pinnedPodUID} {
+		if reason, ok := expired[uid]; ok {
+			t.Errorf("run %s expires: %s", uid, reason)
+		}
+	}
+}
+
+func TestStoredRunsSparesFreshOrphans(t *testing.T) {
+	dir := useResultsDir(t)
+	now := time.Now()
+	writeStoredFile(t, filepath.Join(dir, orphanUID, "index.html"), now.Add(-time.Minute))
+
+	runs, err := storedRuns(nil, nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || !runs[0].protected {
+		t.Fatalf("a report written in the grace period is not protected: %+v", runs)
+	}
+}
+
+func TestRemoveRunResultsRemovesPodReports(t *testing.T) {
+	dir := useResultsDir(t)
+	now := time.Now()
+	writeStoredFile(t, filepath.Join(dir, runningPodUID, "index.html"), now)
+	writeStoredFile(t, filepath.Join(dir, "checkpoints", runningJobUID, "results.json"), now)
+	writeStoredFile(t, filepath.Join(dir, orphanUID, "index.html"), now)
+
+	if err := removeRunResults(runningJobUID, []types.UID{runningPodUID, "../" + orphanUID}); err != nil {
+		t.Fatal(err)
+	}
+	for _, gone := range []string{runningPodUID, filepath.Join("checkpoints", runningJobUID)} {
+		if _, err := os.Stat(filepath.Join(dir, gone)); !os.IsNotExist(err) {
+			t.Errorf("%s is still there: %v", gone, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, orphanUID)); err != nil {
+		t.Errorf("a path that is no pod UID was removed: %v", err)
+	}
+}
+
+func TestApplyRetentionWeighsAllNamespaces(t *testing.T) {
+	t.Setenv("DEFAULT_NAMESPACE", "tests")
+	dir := useResultsDir(t)
+	now := time.Now()
+	const (
+		oldUID = "00000000-0000-4000-8000-000000000006"
+		newUID = "00000000-0000-4000-8000-000000000007"
+	)
+	writeStoredFile(t, filepath.Join(dir, oldUID, "index.html"), now.Add(-3*time.Hour))
+	writeStoredFile(t, filepath.Join(dir, newUID, "index.html"), now.Add(-2*time.Hour))
+
+	finished := func(namespace, name, uid string, at time.Time) batchv1.Job {
+		completed := metav1.NewTime(at)
+		return batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: types.UID(uid)},
+			Status:     batchv1.JobStatus{CompletionTime: &completed},
+		}
+	}
+	jobs := map[string]batchv1.Job{
+		"tests": finished("tests", "old", oldUID, now.Add(-3*time.Hour)),
+		"blog":  finished("blog", "new", newUID, now.Add(-2*time.Hour)),
+	}
+	settings, _ := json.Marshal(Settings{ReportRetention: &ReportRetention{MaxCount: 1, DeleteJobs: true}})
+
+	var deleted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		switch {
+		case r.Method == http.MethodDelete:
+			deleted = append(deleted, parts[len(parts)-3]+"/"+parts[len(parts)-1])
+			json.NewEncoder(w).Encode(metav1.Status{Status: metav1.StatusSuccess})
+		case r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+			io.Copy(w, r.Body)
+		case strings.HasSuffix(r.URL.Path, "/configmaps/"+settingsConfigMap):
+			json.NewEncoder(w).Encode(corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: settingsConfigMap, Namespace: "tests", ResourceVersion: "1"},
+				Data:       map[string]string{settingsKey: string(settings)},
+			})
+		case strings.Contains(r.URL.Path, "/configmaps/"):
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(metav1.Status{Status: metav1.StatusFailure, Reason: metav1.StatusReasonNotFound, Code: http.StatusNotFound})
+		case strings.HasSuffix(r.URL.Path, "/jobs"):
+			json.NewEncoder(w).Encode(batchv1.JobList{Items: []batchv1.Job{jobs[parts[len(parts)-2]]}})
+		default:
+			json.NewEncoder(w).Encode(corev1.PodList{})
+		}
+	}))
+	defer srv.Close()
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL, ContentConfig: rest.ContentConfig{ContentType: "application/json"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applyRetention(context.Background(), clientset, []string{"blog", "tests"}, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, newUID)); err != nil {
+		t.Errorf("the latest run of another namespace was removed as an orphan: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, oldUID)); !os.IsNotExist(err) {
+		t.Errorf("the run beyond the latest one is kept: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0] != "tests/old" {
+		t.Errorf("deleted jobs %v, want [tests/old]", deleted)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// runSpecAnnotation holds the RunSpec a Job was built from, as JSON.
+	runSpecAnnotation = "playwright.operator/run-spec"
+	// clonedFromAnnotation names the run a run was cloned from.
+	clonedFromAnnotation = "playwright.operator/cloned-from"
+)
+
+// RunOverrides are the parameters that can be changed when cloning a run. Unset fields
+// keep the value of the original run, empty strings clear it.
+type RunOverrides struct {
+	Grep    *string `json:"grep,omitempty"`
+	Browser *string `json:"browser,omitempty"`
+	BaseURL *string `json:"baseURL,omitempty"`
+}
+
+// storedRunSpec returns the spec a run was created with. Runs created before the spec
+// was stored cannot be cloned.
+func storedRunSpec(job *batchv1.Job) (*RunSpec, error) {
+	data := job.Annotations[runSpecAnnotation]
+	if data == "" {
+		return nil, fmt.Errorf("run %s/%s has no stored spec", job.Namespace, job.Name)
+	}
+
+	var spec RunSpec
+	if err := json.Unmarshal([]byte(data), &spec); err != nil {
+		return nil, fmt.Errorf("decoding spec of run %s/%s: %w", job.Namespace, job.Name, err)
+	}
+	spec.Namespace = job.Namespace
+
+	return &spec, nil
+}
+
+func (o RunOverrides) apply(spec *RunSpec) {
+	if o.Grep != nil {
+		spec.Grep = *o.Grep
+	}
+	if o.Browser != nil {
+		spec.Browser = *o.Browser
+	}
+	if o.BaseURL != nil {
+		spec.BaseURL = *o.BaseURL
+	}
+}
+
+// GET /runs/{id}/spec?namespace=ns
+func getRunSpec(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	job := runForRequest(w, r, clientset)
+	if job == nil {
+		return
+	}
+
+	spec, err := storedRunSpec(job)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	respondJSON(w, spec)
+}
+
+// POST /runs/{id}/clone?namespace=ns with {"grep": "@smoke", "browser": "firefox",
+// "baseURL": "https://staging.example.com"} starts a copy of a run with the given
+// parameters changed.
+func cloneRun(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	job := runForRequest(w, r, clientset)
+	if job == nil {
+		return
+	}
+
+	spec, err := storedRunSpec(job)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var overrides RunOverrides
+	if err := json.NewDecoder(r.Body).Decode(&overrides); err != nil {
+		writeError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	overrides.apply(spec)
+
+	// building the Job first tells invalid parameters apart from failures to create it
+	if _, err := newRunJob(*spec); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created, err := createRun(r.Context(), clientset, *spec)
+	if err != nil {
+		writeError(w, err.Error(), runErrorStatus(err))
+		return
+	}
+
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{clonedFromAnnotation: job.Name},
+		},
+	})
+	created, err = clientset.BatchV1().Jobs(created.Namespace).Patch(r.Context(), created.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSONStatus(w, http.StatusCreated, created)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"sort"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	failureNew      = "new"
+	failureExisting = "existing"
+)
+
+// RunComparison relates a run to the baseline of its suite or, without one, to the
+// previous finished run. New failures block merges, existing ones are known issues.
+//
+// With parsed results of both runs the failed tests are compared one by one, NewFailures
+// did not fail in the other run, ExistingFailures did and Fixed failed there only.
+// Failure is "new" as soon as one test fails anew. Without results the runs are compared
+// as a whole.
+type RunComparison struct {
+	Against          string         `json:"against"`
+	Run              string         `json:"run"`
+	State            string         `json:"state"`
+	Failure          string         `json:"failure,omitempty"`
+	PerTest          bool           `json:"perTest"`
+	NewFailures      []ComparedTest `json:"newFailures,omitempty"`
+	ExistingFailures []ComparedTest `json:"existingFailures,omitempty"`
+	Fixed            []ComparedTest `json:"fixed,omitempty"`
+}
+
+// ComparedTest names a test in one project.
+type ComparedTest struct {
+	File    string `json:"file"`
+	Title   string `json:"title"`
+	Project string `json:"project,omitempty"`
+}
+
+// compareRun returns nil for runs outside a suite or without anything to compare against.
+func compareRun(ctx context.Context, clientset *kubernetes.Clientset, informers *runInformers, job *batchv1.Job) (*RunComparison, error) {
+	suite := job.Labels[suiteLabel]
+	if suite == "" {
+		return nil, nil
+	}
+	branch := job.Labels[branchLabel]
+
+	var cmp *RunComparison
+	var against *batchv1.Job
+	baseline, err := suiteBaseline(ctx, clientset, job.Namespace, suite, branch)
+	if err != nil {
+		return nil, err
+	}
+	if baseline != nil && baseline.Current.UID != string(job.UID) {
+		cmp = &RunComparison{Against: "baseline", Run: baseline.Current.Run, State: baseline.Current.State}
+		against, err = clientset.BatchV1().Jobs(job.Namespace).Get(ctx, baseline.Current.Run, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			against, err = nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if against != nil && string(against.UID) != baseline.Current.UID {
+			against = nil
+		}
+	} else {
+		runs, err := listSuiteRuns(ctx, informers, job.Namespace, suite, branch)
+		if err != nil {
+			return nil, err
+		}
+		for _, run := range finishedRuns(runs) {
+			if run.UID != job.UID && run.CreationTimestamp.Before(&job.CreationTimestamp) {
+				cmp = &RunComparison{Against: "previous", Run: run.Name, State: jobState(&run)}
+				against = &run
+				break
+			}
+		}
+	}
+
+	if cmp == nil {
+		return nil, nil
+	}
+
+	if against != nil {
+		results, err := runResults(job)
+		if err != nil {
+			return nil, err
+		}
+		previous, err := runResults(against)
+		if err != nil {
+			return nil, err
+		}
+		if results != nil && previous != nil {
+			compareTests(cmp, results, previous)
+			return cmp, nil
+		}
+	}
+
+	if jobState(job) == jobStateFailed {
+		cmp.Failure = failureNew
+		if cmp.State == jobStateFailed {
+			cmp.Failure = failureExisting
+		}
+	}
+
+	return cmp, nil
+}
+
+// compareTests fills in the failed tests of a run compared to those of the run it is
+// compared against.
+func compareTests(cmp *RunComparison, results, against *RunResults) {
+	failed, failedBefore := failedTests(results), failedTests(against)
+	cmp.PerTest = true
+	for test := range failed {
+		if failedBefore[test] {
+			cmp.ExistingFailures = append(cmp.ExistingFailures, test)
+		} else {
+			cmp.NewFailures = append(cmp.NewFailures, test)
+		}
+	}
+	// tests that are gone from the run did not pass, they are not fixed
+	ran := map[ComparedTest]bool{}
+	for _, spec := range results.Specs {
+		ran[ComparedTest{File: spec.File, Title: spec.Title, Project: spec.Project}] = true
+	}
+	for test := range failedBefore {
+		if !failed[test] && ran[test] {
+			cmp.Fixed = append(cmp.Fixed, test)
+		}
+	}
+	for _, tests := range [][]ComparedTest{cmp.NewFailures, cmp.ExistingFailures, cmp.Fixed} {
+		sortComparedTests(tests)
+	}
+
+	switch {
+	case len(cmp.NewFailures) > 0:
+		cmp.Failure = failureNew
+	case len(cmp.ExistingFailures) > 0:
+		cmp.Failure = failureExisting
+	}
+}
+
+// failedTests returns the tests of a run that failed in all attempts.
+func failedTests(results *RunResults) map[ComparedTest]bool {
+	failed := map[ComparedTest]bool{}
+	for _, spec := range results.Specs {
+		if spec.Status == "failed" {
+			failed[ComparedTest{File: spec.File, Title: spec.Title, Project: spec.Project}] = true
+		}
+	}
+
+	return failed
+}
+
+func sortComparedTests(tests []ComparedTest) {
+	sort.Slice(tests, func(i, j int) bool {
+		if tests[i].File != tests[j].File {
+			return tests[i].File < tests[j].File
+		}
+		if tests[i].Title != tests[j].Title {
+			return tests[i].Title < tests[j].Title
+		}
+		return tests[i].Project < tests[j].Project
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareTests(t *testing.T) {
+	spec := func(title, project, status string) SpecResult {
+		return SpecResult{File: "checkout.spec.ts", Title: title, Project: project, Status: status}
+	}
+	test := func(title, project string) ComparedTest {
+		return ComparedTest{File: "checkout.spec.ts", Title: title, Project: project}
+	}
+	previous := &RunResults{Specs: []SpecResult{
+		spec("pays", "chromium", "failed"),
+		spec("pays", "firefox", "passed"),
+		spec("refunds", "chromium", "failed"),
+		spec("removed", "chromium", "failed"),
+		spec("ships", "chromium", "passed"),
+	}}
+	results := &RunResults{Specs: []SpecResult{
+		spec("pays", "chromium", "failed"),
+		spec("pays", "firefox", "failed"),
+		spec("refunds", "chromium", "passed"),
+		spec("ships", "chromium", "flaky"),
+		spec("added", "chromium", "failed"),
+	}}
+
+	cmp := &RunComparison{Against: "baseline", Run: "checkout-1", State: jobStateFailed}
+	compareTests(cmp, results, previous)
+	want := &RunComparison{
+		Against:          "baseline",
+		Run:              "checkout-1",
+		State:            jobStateFailed,
+		Failure:          failureNew,
+		PerTest:          true,
+		NewFailures:      []ComparedTest{test("added", "chromium"), test("pays", "firefox")},
+		ExistingFailures: []ComparedTest{test("pays", "chromium")},
+		Fixed:            []ComparedTest{test("refunds", "chromium")},
+	}
+	if !reflect.DeepEqual(cmp, want) {
+		t.Errorf("compareTests() = %+v, want %+v", cmp, want)
+	}
+
+	// a run failing only where the other run failed as well has existing failures only
+	cmp = &RunComparison{}
+	compareTests(cmp, previous, previous)
+	if cmp.Failure != failureExisting || len(cmp.NewFailures) != 0 || len(cmp.Fixed) != 0 {
+		t.Errorf("compareTests() of equal runs = %+v, want existing failures only", cmp)
+	}
+
+	cmp = &RunComparison{}
+	compareTests(cmp, &RunResults{Specs: []SpecResult{spec("pays", "chromium", "passed")}}, previous)
+	if cmp.Failure != "" || !reflect.DeepEqual(cmp.Fixed, []ComparedTest{test("pays", "chromium")}) {
+		t.Errorf("compareTests() of a passing run = %+v, want pays fixed and no failure", cmp)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// defaultContainerAnnotation names the container kubectl shows the logs of by default.
+const defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+// PodContainer is a container of a run pod, e.g. the Playwright container, a report
+// uploader sidecar or an init container preparing the browsers.
+type PodContainer struct {
+	Name string `json:"name"`
+	Init bool   `json:"init,omitempty"`
+	// Default is the container shown when logs are requested without one.
+	Default bool `json:"default,omitempty"`
+}
+
+// defaultContainer returns the container of the default-container annotation, or the
+// first one.
+func defaultContainer(pod *corev1.Pod) string {
+	if name := pod.Annotations[defaultContainerAnnotation]; name != "" {
+		for _, c := range pod.Spec.Containers {
+			if c.Name == name {
+				return name
+			}
+		}
+	}
+	if len(pod.Spec.Containers) > 0 {
+		return pod.Spec.Containers[0].Name
+	}
+
+	return ""
+}
+
+// podContainers lists the init containers and containers of a pod in the order they start.
+func podContainers(pod *corev1.Pod) []PodContainer {
+	def := defaultContainer(pod)
+
+	var containers []PodContainer
+	for _, c := range pod.Spec.InitContainers {
+		containers = append(containers, PodContainer{Name: c.Name, Init: true})
+	}
+	for _, c := range pod.Spec.Containers {
+		containers = append(containers, PodContainer{Name: c.Name, Default: c.Name == def})
+	}
+
+	return containers
+}
+
+// podLogOptions reads the PodLogOptions of a logs request: container, tailLines (or
+// tail), sinceSeconds, sinceTime as RFC 3339, previous and timestamps.
+func podLogOptions(query url.Values) (*corev1.PodLogOptions, error) {
+	opts := &corev1.PodLogOptions{
+		Container:  query.Get("container"),
+		Previous:   query.Get("previous") == "true",
+		Timestamps: query.Get("timestamps") == "true",
+	}
+
+	tail := query.Get("tailLines")
+	if tail == "" {
+		tail = query.Get("tail")
+	}
+	if tail != "" {
+		n, err := strconv.ParseInt(tail, 10, 64)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("tailLines must be a positive number of lines")
+		}
+		opts.TailLines = &n
+	}
+
+	if v := query.Get("sinceSeconds"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("sinceSeconds must be a positive number of seconds")
+		}
+		opts.SinceSeconds = &n
+	}
+	if v := query.Get("sinceTime"); v != "" {
+		if opts.SinceSeconds != nil {
+			return nil, fmt.Errorf("sinceSeconds and sinceTime cannot be combined")
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("sinceTime must be an RFC 3339 time")
+		}
+		opts.SinceTime = &metav1.Time{Time: t}
+	}
+
+	return opts, nil
+}
+
+// containerLogs reads the logs of a container with the other options of opts.
+func containerLogs(ctx context.Context, clientset *kubernetes.Clientset, namespace, pod, container string, opts corev1.PodLogOptions) (string, error) {
+	opts.Container = container
+	stream, err := clientset.CoreV1().Pods(namespace).GetLogs(pod, &opts).Stream(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// allContainerLogs reads the logs of all containers of a pod, each line prefixed with
+// the name of its container as by kubectl logs --all-containers --prefix. Containers that
+// have no logs yet, e.g. because they did not start, report why instead.
+func allContainerLogs(ctx context.Context, clientset *kubernetes.Clientset, pod *corev1.Pod, opts corev1.PodLogOptions) string {
+	var b strings.Builder
+	for _, c := range podContainers(pod) {
+		prefix := "[" + c.Name + "] "
+
+		logs, err := containerLogs(ctx, clientset, pod.Namespace, pod.Name, c.Name, opts)
+		if err != nil {
+			b.WriteString(prefix + "logs unavailable: " + err.Error() + "\n")
+			continue
+		}
+
+		scanner := bufio.NewScanner(strings.NewReader(logs))
+		scanner.Buffer(make([]byte, 64*1024), maxLogLine)
+		for scanner.Scan() {
+			b.WriteString(prefix + scanner.Text() + "\n")
+		}
+	}
+
+	return b.String()
+}
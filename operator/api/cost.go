@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The cost of a run is stored on its Job once it finished, its pods are gone with the Job
+// TTL. Runs whose cost no longer changes are labeled with costFinalLabel.
+const (
+	costAnnotation = "playwright.operator/cost"
+	costFinalLabel = "playwright.operator/cost-final"
+
+	costSourceEstimate = "estimate"
+	costSourceMeasured = "opencost"
+)
+
+// RunCost is the cost of the pods of a run, estimated from their requests and runtime or
+// measured by OpenCost or Kubecost.
+type RunCost struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+	Source   string  `json:"source"`
+	// Final costs are no longer reconciled, measured ones settle when late cost data had
+	// time to arrive.
+	Final     bool      `json:"final"`
+	Pods      []string  `json:"pods,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// costConfig prices the estimate and locates the allocation API of OpenCost, or of
+// Kubecost, which serves the same API. Measured costs are disabled without its URL.
+type costConfig struct {
+	OpenCostURL     string
+	Currency        string
+	CPUHourly       float64
+	MemoryGiBHourly float64
+	// DefaultCPU and DefaultMemory are assumed for containers without requests.
+	DefaultCPU    resource.Quantity
+	DefaultMemory resource.Quantity
+	// Settle is how long after a run finished its measured cost is still reconciled.
+	Settle time.Duration
+}
+
+func costConfigFromEnv() (costConfig, error) {
+	cfg := costConfig{
+		OpenCostURL: strings.TrimSuffix(os.Getenv("OPENCOST_URL"), "/"),
+		Currency:    envOrDefault("COST_CURRENCY", "USD"),
+	}
+
+	var err error
+	// the defaults are the prices OpenCost assumes without a cloud pricing source
+	if cfg.CPUHourly, err = strconv.ParseFloat(envOrDefault("COST_CPU_HOURLY", "0.031611"), 64); err != nil {
+		return cfg, fmt.Errorf("invalid COST_CPU_HOURLY: %w", err)
+	}
+	if cfg.MemoryGiBHourly, err = strconv.ParseFloat(envOrDefault("COST_MEMORY_GIB_HOURLY", "0.004237"), 64); err != nil {
+		return cfg, fmt.Errorf("invalid COST_MEMORY_GIB_HOURLY: %w", err)
+	}
+	if cfg.DefaultCPU, err = resource.ParseQuantity(envOrDefault("COST_DEFAULT_CPU", "1")); err != nil {
+		return cfg, fmt.Errorf("invalid COST_DEFAULT_CPU: %w", err)
+	}
+	if cfg.DefaultMemory, err = resource.ParseQuantity(envOrDefault("COST_DEFAULT_MEMORY", "2Gi")); err != nil {
+		return cfg, fmt.Errorf("invalid COST_DEFAULT_MEMORY: %w", err)
+	}
+	if cfg.Settle, err = time.ParseDuration(envOrDefault("COST_SETTLE", "6h")); err != nil {
+		return cfg, fmt.Errorf("invalid COST_SETTLE: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// storedCost returns the cost stored on a run, nil for runs without.
+func storedCost(job *batchv1.Job) *RunCost {
+	data := job.Annotations[costAnnotation]
+	if data == "" {
+		return nil
+	}
+
+	var cost RunCost
+	if err := json.Unmarshal([]byte(data), &cost); err != nil {
+		return nil
+	}
+
+	return &cost
+}
+
+// runCost returns the stored cost of a run, or an estimate from its pods until there is
+// one.
+func runCost(job *batchv1.Job, pods []corev1.Pod, now time.Time) *RunCost {
+	if cost := storedCost(job); cost != nil {
+		return cost
+	}
+	if len(pods) == 0 {
+		return nil
+	}
+
+	cfg, err := costConfigFromEnv()
+	if err != nil {
+		return nil
+	}
+	cost := estimateCost(cfg, pods, now)
+
+	return &cost
+}
+
+// estimateCost prices the requests of the containers of pods by how long the pods ran,
+// until now for pods still running.
+func estimateCost(cfg costConfig, pods []corev1.Pod, now time.Time) RunCost {
+	cost := RunCost{Currency: cfg.Currency, Source: costSourceEstimate, UpdatedAt: now}
+	for _, pod := range pods {
+		cost.Pods = append(cost.Pods, pod.Name)
+		if pod.Status.StartTime == nil {
+			continue
+		}
+
+		end := now
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			end = pod.Status.StartTime.Time
+			for _, status := range pod.Status.ContainerStatuses {
+				if t := status.State.Terminated; t != nil && t.FinishedAt.After(end) {
+					end = t.FinishedAt.Time
+				}
+			}
+		}
+		hours := end.Sub(pod.Status.StartTime.Time).Hours()
+
+		for _, c := range pod.Spec.Containers {
+			cpu, memory := cfg.DefaultCPU, cfg.DefaultMemory
+			if q, ok := c.Resources.Requests[corev1.ResourceCPU]; ok {
+				cpu = q
+			}
+			if q, ok := c.Resources.Requests[corev1.ResourceMemory]; ok {
+				memory = q
+			}
+			cost.Amount += hours * (cpu.AsApproximateFloat64()*cfg.CPUHourly + memory.AsApproximateFloat64()/(1<<30)*cfg.MemoryGiBHourly)
+		}
+	}
+	sort.Strings(cost.Pods)
+
+	return cost
+}
+
+// allocationResponse is the answer of the allocation API, a set of allocations per step
+// of the window, a single one when accumulated.
+type allocationResponse struct {
+	Code    int                              `json:"code"`
+	Message string                           `json:"message"`
+	Data    []map[string]allocationByPodItem `json:"data"`
+}
+
+type allocationByPodItem struct {
+	Properties struct {
+		Namespace string `json:"namespace"`
+		Pod       string `json:"pod"`
+	} `json:"properties"`
+	TotalCost float64 `json:"totalCost"`
+}
+
+// measuredCost queries the allocation API for the cost of pods of a namespace between
+// start and end. It returns the sum of the pods found and whether all were, costs of the
+// latest hours are often missing as they are processed in batches.
+func measuredCost(ctx context.Context, cfg costConfig, namespace string, pods []string, start, end time.Time) (float64, bool, error) {
+	query := url.Values{}
+	query.Set("window", start.UTC().Format(time.RFC3339)+","+end.UTC().Format(time.RFC3339))
+	query.Set("aggregate", "pod")
+	query.Set("accumulate", "true")
+	query.Set("filter", fmt.Sprintf("namespace:%q", namespace))
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.OpenCostURL+"/allocation/compute?"+query.Encode(), nil)
+	if err != nil {
+		return 0, false, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, false, fmt.Errorf("allocation API answered %s", resp.Status)
+	}
+
+	var allocations allocationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&allocations); err != nil {
+		return 0, false, fmt.Errorf("invalid allocation response: %w", err)
+	}
+	if allocations.Code != 0 && allocations.Code != http.StatusOK {
+		return 0, false, fmt.Errorf("allocation API answered %d: %s", allocations.Code, allocations.Message)
+	}
+
+	wanted := map[string]bool{}
+	for _, pod := range pods {
+		wanted[pod] = true
+	}
+	found := map[string]bool{}
+	var total float64
+	for _, set := range allocations.Data {
+		for _, item := range set {
+			if item.Properties.Namespace == namespace && wanted[item.Properties.Pod] {
+				found[item.Properties.Pod] = true
+				total += item.TotalCost
+			}
+		}
+	}
+
+	return total, len(found) == len(wanted), nil
+}
+
+// finishedAt returns when a finished run completed or failed.
+func finishedAt(job *batchv1.Job) (time.Time, bool) {
+	if job.Status.CompletionTime != nil {
+		return job.Status.CompletionTime.Time, true
+	}
+
+	return failedAt(job)
+}
+
+// reconcileRunCost updates the stored cost of a finished run: the estimate from its pods
+// first, replaced by the measured cost once the allocation API has all of its pods. The
+// measured cost is queried again until it settled, as cost data of the last hours arrives
+// late and is corrected.
+func reconcileRunCost(ctx context.Context, clientset *kubernetes.Clientset, cfg costConfig, job *batchv1.Job, now time.Time) error {
+	finished, ok := finishedAt(job)
+	if !ok {
+		return nil
+	}
+
+	pods, err := clientset.CoreV1().Pods(job.Namespace).List(ctx, metav1.ListOptions{LabelSelector: batchv1.JobNameLabel + "=" + job.Name})
+	if err != nil {
+		return err
+	}
+
+	cost := storedCost(job)
+	if (cost == nil || cost.Source == costSourceEstimate) && len(pods.Items) > 0 {
+		estimate := estimateCost(cfg, pods.Items, now)
+		cost = &estimate
+	}
+	if cost == nil {
+		// the pods were deleted before the cost of the run was stored
+		cost = &RunCost{Currency: cfg.Currency, Source: costSourceEstimate, UpdatedAt: now}
+	}
+
+	settled := now.Sub(finished) > cfg.Settle
+	if cfg.OpenCostURL != "" && len(cost.Pods) > 0 {
+		start := finished
+		if job.Status.StartTime != nil {
+			start = job.Status.StartTime.Time
+		}
+		// allocations are kept per hour, a window of whole hours covers all of the pods
+		amount, complete, err := measuredCost(ctx, cfg, job.Namespace, cost.Pods, start.Truncate(time.Hour), finished.Truncate(time.Hour).Add(time.Hour))
+		if err != nil {
+			log.Printf("cannot query the cost of run %s/%s: %v", job.Namespace, job.Name, err)
+		} else if complete {
+			cost.Amount, cost.Source, cost.Currency, cost.UpdatedAt = amount, costSourceMeasured, cfg.Currency, now
+		}
+		cost.Final = settled
+	} else {
+		cost.Final = true
+	}
+
+	data, err := json.Marshal(cost)
+	if err != nil {
+		return err
+	}
+	metadata := map[string]interface{}{
+		"annotations": map[string]interface{}{costAnnotation: string(data)},
+	}
+	if cost.Final {
+		metadata["labels"] = map[string]interface{}{costFinalLabel: "true"}
+	}
+	patch, _ := json.Marshal(map[string]interface{}{"metadata": metadata})
+	_, err = clientset.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+
+	return err
+}
+
+// reconcileRunCosts stores the costs of finished runs and reconciles them with OpenCost
+// until they are final.
+func reconcileRunCosts(ctx context.Context, clientset *kubernetes.Clientset, informers *runInformers, namespace string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cfg, err := costConfigFromEnv()
+		if err != nil {
+			log.Printf("cannot reconcile run costs: %v", err)
+			continue
+		}
+
+		jobs, err := informers.runs(ctx, namespace, runsSelector+",!"+costFinalLabel)
+		if err != nil {
+			log.Printf("cannot list runs to reconcile costs: %v", err)
+			continue
+		}
+
+		now := time.Now()
+		for i := range jobs {
+			job := &jobs[i]
+			if err := reconcileRunCost(ctx, clientset, cfg, job, now); err != nil {
+				log.Printf("cannot reconcile the cost of run %s/%s: %v", job.Namespace, job.Name, err)
+			}
+		}
+	}
+}
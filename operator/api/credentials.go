@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	credentialsLabel         = "playwright.operator/credentials"
+	credentialsTokenKey      = "token"
+	defaultCredentialsEnvVar = "RUN_TOKEN"
+	defaultCredentialsTTL    = 3600
+	// minCredentialsTTL is the shortest expiration the TokenRequest API issues.
+	minCredentialsTTL = 600
+
+	// runCredentialsLabel marks the service accounts runs may request tokens of, tokens of
+	// any other service account of the namespace are refused.
+	runCredentialsLabel = "playwright.operator/run-credentials"
+
+	// orphanedCredentialsAge is how long a credentials Secret may exist without a Job owning
+	// it, the Job is created and takes it over right after the Secret.
+	orphanedCredentialsAge = 10 * time.Minute
+)
+
+// RunCredentials requests a short-lived token of a service account of the application
+// under test, one labelled playwright.operator/run-credentials=true. The token is bound
+// to a Secret owned by the run and stops being valid as soon as the Secret is deleted
+// after the run finished.
+type RunCredentials struct {
+	ServiceAccount    string   `json:"serviceAccount"`
+	Audiences         []string `json:"audiences,omitempty"`
+	ExpirationSeconds int64    `json:"expirationSeconds,omitempty"`
+	EnvVar            string   `json:"envVar,omitempty"`
+}
+
+// errCredentialsServiceAccount rejects runs requesting tokens of service accounts that are
+// not allowed for run credentials.
+var errCredentialsServiceAccount = errors.New("the service account may not be used for run credentials")
+
+func credentialsSecretName(jobName string) string {
+	return jobName + "-credentials"
+}
+
+func randomSuffix() (string, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func (c *RunCredentials) validate() error {
+	if c.ServiceAccount == "" {
+		return fmt.Errorf("credentials: serviceAccount is required")
+	}
+	if c.ExpirationSeconds != 0 && c.ExpirationSeconds < minCredentialsTTL {
+		return fmt.Errorf("credentials: expirationSeconds must be at least %d", minCredentialsTTL)
+	}
+
+	return nil
+}
+
+// addRunCredentials injects the token of the credentials Secret into the run containers.
+// The Secret is created before the Job, see mintRunCredentials, so the Job needs its
+// final name up front.
+func addRunCredentials(job *batchv1.Job, creds *RunCredentials) error {
+	if err := creds.validate(); err != nil {
+		return err
+	}
+	if job.Name == "" {
+		suffix, err := randomSuffix()
+		if err != nil {
+			return err
+		}
+		job.Name = job.GenerateName + suffix
+		job.GenerateName = ""
+	}
+
+	envVar := creds.EnvVar
+	if envVar == "" {
+		envVar = defaultCredentialsEnvVar
+	}
+
+	if job.Labels == nil {
+		job.Labels = map[string]string{}
+	}
+	job.Labels[credentialsLabel] = "true"
+
+	for i := range job.Spec.Template.Spec.Containers {
+		c := &job.Spec.Template.Spec.Containers[i]
+		c.Env = append(c.Env, corev1.EnvVar{
+			Name: envVar,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: credentialsSecretName(job.Name)},
+					Key:                  credentialsTokenKey,
+				},
+			},
+		})
+	}
+
+	return nil
+}
+
+// checkCredentialsServiceAccount refuses tokens of service accounts that are not labelled
+// with runCredentialsLabel, runs must not borrow the identity of the operator or of other
+// workloads of the namespace.
+func checkCredentialsServiceAccount(ctx context.Context, clientset *kubernetes.Clientset, namespace string, creds *RunCredentials) error {
+	sa, err := clientset.CoreV1().ServiceAccounts(namespace).Get(ctx, creds.ServiceAccount, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("%w: %s does not exist", errCredentialsServiceAccount, creds.ServiceAccount)
+	}
+	if err != nil {
+		return err
+	}
+	if sa.Labels[runCredentialsLabel] != "true" {
+		return fmt.Errorf("%w: %s is not labelled %s=true", errCredentialsServiceAccount, creds.ServiceAccount, runCredentialsLabel)
+	}
+
+	return nil
+}
+
+// mintRunCredentials creates the credentials Secret of a Job about to be created and
+// stores a token bound to it from the TokenRequest API, so the run containers start with
+// it. The Job takes the Secret over with ownRunCredentials once it is created.
+func mintRunCredentials(ctx context.Context, clientset *kubernetes.Clientset, job *batchv1.Job, creds *RunCredentials) (*corev1.Secret, error) {
+	if err := checkCredentialsServiceAccount(ctx, clientset, job.Namespace, creds); err != nil {
+		return nil, err
+	}
+	expiration := creds.ExpirationSeconds
+	if expiration == 0 {
+		expiration = defaultCredentialsTTL
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      credentialsSecretName(job.Name),
+			Namespace: job.Namespace,
+			Labels:    map[string]string{credentialsLabel: "true"},
+		},
+		Type: corev1.SecretTypeOpaque,
+	}
+
+	secret, err := clientset.CoreV1().Secrets(job.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("creating credentials secret: %w", err)
+	}
+
+	token, err := clientset.CoreV1().ServiceAccounts(job.Namespace).CreateToken(ctx, creds.ServiceAccount, &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences:         creds.Audiences,
+			ExpirationSeconds: ptr.To(expiration),
+			BoundObjectRef: &authenticationv1.BoundObjectReference{
+				Kind:       "Secret",
+				APIVersion: "v1",
+				Name:       secret.Name,
+				UID:        secret.UID,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		revokeRunCredentials(ctx, clientset, secret)
+		return nil, fmt.Errorf("requesting token for service account %s: %w", creds.ServiceAccount, err)
+	}
+
+	secret.Data = map[string][]byte{credentialsTokenKey: []byte(token.Status.Token)}
+	updated, err := clientset.CoreV1().Secrets(job.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+	if err != nil {
+		revokeRunCredentials(ctx, clientset, secret)
+		return nil, fmt.Errorf("storing token: %w", err)
+	}
+
+	return updated, nil
+}
+
+// ownRunCredentials makes the created Job the owner of its credentials Secret, which is
+// garbage collected with it.
+func ownRunCredentials(ctx context.Context, clientset *kubernetes.Clientset, job *batchv1.Job, secret *corev1.Secret) error {
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"ownerReferences": []metav1.OwnerReference{
+				*metav1.NewControllerRef(job, batchv1.SchemeGroupVersion.WithKind("Job")),
+			},
+		},
+	})
+	_, err := clientset.CoreV1().Secrets(secret.Namespace).Patch(ctx, secret.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+
+	return err
+}
+
+// revokeRunCredentials deletes the credentials Secret of a run that was not created,
+// which invalidates the token bound to it.
+func revokeRunCredentials(ctx context.Context, clientset *kubernetes.Clientset, secret *corev1.Secret) {
+	err := clientset.CoreV1().Secrets(secret.Namespace).Delete(ctx, secret.Name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Printf("cannot revoke credentials %s/%s: %v", secret.Namespace, secret.Name, err)
+	}
+}
+
+// revokeFinishedCredentials periodically deletes the credentials Secrets of finished runs,
+// which invalidates the tokens bound to them, in every namespace the API lists runs in.
+// Secrets no Job took over are deleted after orphanedCredentialsAge.
+func revokeFinishedCredentials(ctx context.Context, clientset *kubernetes.Clientset, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		namespaces, err := runNamespaces.list(ctx, clientset)
+		if err != nil {
+			log.Printf("cannot list the namespaces of runs: %v", err)
+			continue
+		}
+		for _, namespace := range namespaces {
+			revokeNamespaceCredentials(ctx, clientset, namespace)
+		}
+	}
+}
+
+func revokeNamespaceCredentials(ctx context.Context, clientset *kubernetes.Clientset, namespace string) {
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: credentialsLabel + "=true",
+	})
+	if err != nil {
+		log.Printf("cannot list runs with credentials in %s: %v", namespace, err)
+		return
+	}
+
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if state := jobState(job); state != jobStateSucceeded && state != jobStateFailed && state != jobStateCancelled {
+			continue
+		}
+
+		err := clientset.CoreV1().Secrets(job.Namespace).Delete(ctx, credentialsSecretName(job.Name), metav1.DeleteOptions{})
+		if err == nil {
+			log.Printf("revoked credentials of run %s/%s", job.Namespace, job.Name)
+		} else if !apierrors.IsNotFound(err) {
+			log.Printf("cannot revoke credentials of run %s/%s: %v", job.Namespace, job.Name, err)
+		}
+	}
+
+	secrets, err := clientset.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: credentialsLabel + "=true",
+	})
+	if err != nil {
+		log.Printf("cannot list credentials in %s: %v", namespace, err)
+		return
+	}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if orphanedCredentials(secret, time.Now()) {
+			log.Printf("revoking credentials %s/%s of a run that was not created", secret.Namespace, secret.Name)
+			revokeRunCredentials(ctx, clientset, secret)
+		}
+	}
+}
+
+// orphanedCredentials tells whether a credentials Secret was left behind by a run whose
+// Job was not created or did not take it over.
+func orphanedCredentials(secret *corev1.Secret, now time.Time) bool {
+	return len(secret.OwnerReferences) == 0 && now.Sub(secret.CreationTimestamp.Time) > orphanedCredentialsAge
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAddRunCredentials(t *testing.T) {
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{GenerateName: "playwright-"}}
+	job.Spec.Template.Spec.Containers = []corev1.Container{{Name: "playwright"}, {Name: "proxy"}}
+
+	if err := addRunCredentials(job, &RunCredentials{ServiceAccount: "app-under-test"}); err != nil {
+		t.Fatal(err)
+	}
+	if job.GenerateName != "" || len(job.Name) != len("playwright-")+6 {
+		t.Errorf("the Job needs its name before the Secret is created, got %q", job.Name)
+	}
+	for _, c := range job.Spec.Template.Spec.Containers {
+		if len(c.Env) != 1 || c.Env[0].Name != defaultCredentialsEnvVar || c.Env[0].ValueFrom.SecretKeyRef.Name != credentialsSecretName(job.Name) {
+			t.Errorf("container %s env = %+v, want the token of the credentials Secret", c.Name, c.Env)
+		}
+	}
+
+	for name, creds := range map[string]*RunCredentials{
+		"no service account": {},
+		"short expiration":   {ServiceAccount: "app-under-test", ExpirationSeconds: 60},
+	} {
+		if err := addRunCredentials(&batchv1.Job{}, creds); err == nil {
+			t.Errorf("%s: want an error", name)
+		}
+	}
+}
+
+func TestOrphanedCredentials(t *testing.T) {
+	now := time.Now()
+	secret := func(age time.Duration, owned bool) *corev1.Secret {
+		s := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(now.Add(-age))}}
+		if owned {
+			s.OwnerReferences = []metav1.OwnerReference{{Kind: "Job", Name: "run"}}
+		}
+		return s
+	}
+
+	for _, tc := range []struct {
+		name   string
+		secret *corev1.Secret
+		want   bool
+	}{
+		{"owned", secret(time.Hour, true), false},
+		{"being created", secret(time.Minute, false), false},
+		{"left behind", secret(time.Hour, false), true},
+	} {
+		if got := orphanedCredentials(tc.secret, now); got != tc.want {
+			t.Errorf("%s: orphanedCredentials = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
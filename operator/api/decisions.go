@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	admissionDecisionsConfigMap = "playwright-admission-decisions"
+	admissionDecisionsKey       = "decisions.json"
+	// maxAdmissionDecisions bounds the decisions kept, the oldest are dropped first.
+	maxAdmissionDecisions = 200
+	// admissionDecisionPath is the path of admission decisions in the decision logs, as OPA
+	// logs the package of the policy.
+	admissionDecisionPath = "playwright/admission"
+)
+
+// AdmissionDecision is an admission check of a run in the format of OPA decision logs, so
+// they can be shipped to the same place as the decisions of Gatekeeper.
+type AdmissionDecision struct {
+	DecisionID string                  `json:"decision_id"`
+	Path       string                  `json:"path"`
+	Input      AdmissionDecisionInput  `json:"input"`
+	Result     AdmissionDecisionResult `json:"result"`
+	Timestamp  time.Time               `json:"timestamp"`
+}
+
+type AdmissionDecisionInput struct {
+	// Run is the checked RunSpec with the values of its env masked, they may hold secrets.
+	Run RunSpec `json:"run"`
+}
+
+type AdmissionDecisionResult struct {
+	Allowed    bool                 `json:"allowed"`
+	Violations []AdmissionViolation `json:"violations"`
+}
+
+func loadAdmissionDecisions(ctx context.Context, clientset *kubernetes.Clientset) (*corev1.ConfigMap, []AdmissionDecision, error) {
+	namespace := getNamespace("")
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, admissionDecisionsConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: admissionDecisionsConfigMap, Namespace: namespace}}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	decisions := []AdmissionDecision{}
+	if data := cm.Data[admissionDecisionsKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &decisions); err != nil {
+			return nil, nil, fmt.Errorf("decoding %s: %w", admissionDecisionsConfigMap, err)
+		}
+	}
+
+	return cm, decisions, nil
+}
+
+func saveAdmissionDecisions(ctx context.Context, clientset *kubernetes.Clientset, cm *corev1.ConfigMap, decisions []AdmissionDecision) error {
+	data, err := json.Marshal(decisions)
+	if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[admissionDecisionsKey] = string(data)
+
+	if cm.ResourceVersion == "" {
+		_, err = clientset.CoreV1().ConfigMaps(cm.Namespace).Create(ctx, cm, metav1.CreateOptions{})
+	} else {
+		_, err = clientset.CoreV1().ConfigMaps(cm.Namespace).Update(ctx, cm, metav1.UpdateOptions{})
+	}
+
+	return err
+}
+
+// recordAdmissionDecision adds the decision on a run to the decision log. Failures are
+// logged, the run is admitted or rejected regardless.
+func recordAdmissionDecision(ctx context.Context, clientset *kubernetes.Clientset, spec RunSpec, violations []AdmissionViolation) {
+	if len(spec.Env) > 0 {
+		masked := make(map[string]string, len(spec.Env))
+		for k := range spec.Env {
+			masked[k] = "***"
+		}
+		spec.Env = masked
+	}
+	decision := AdmissionDecision{
+		DecisionID: string(uuid.NewUUID()),
+		Path:       admissionDecisionPath,
+		Input:      AdmissionDecisionInput{Run: spec},
+		Result:     AdmissionDecisionResult{Allowed: len(violations) == 0, Violations: violations},
+		Timestamp:  time.Now().UTC(),
+	}
+
+	for attempt := 0; ; attempt++ {
+		cm, decisions, err := loadAdmissionDecisions(ctx, clientset)
+		if err != nil {
+			log.Printf("cannot record admission decision %s: %v", decision.DecisionID, err)
+			return
+		}
+
+		decisions = append(decisions, decision)
+		if len(decisions) > maxAdmissionDecisions {
+			decisions = decisions[len(decisions)-maxAdmissionDecisions:]
+		}
+
+		err = saveAdmissionDecisions(ctx, clientset, cm, decisions)
+		if err == nil {
+			return
+		}
+		if (!apierrors.IsConflict(err) && !apierrors.IsAlreadyExists(err)) || attempt == 4 {
+			log.Printf("cannot record admission decision %s: %v", decision.DecisionID, err)
+			return
+		}
+	}
+}
+
+// GET /admin/admission/decisions?limit=n&denied=true lists the latest admission decisions,
+// the newest first, denied=true only those that rejected a run.
+func listAdmissionDecisions(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	query := r.URL.Query()
+	limit := maxAdmissionDecisions
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	deniedOnly := query.Get("denied") == "true"
+
+	_, decisions, err := loadAdmissionDecisions(r.Context(), clientset)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	latest := []AdmissionDecision{}
+	for i := len(decisions) - 1; i >= 0 && len(latest) < limit; i-- {
+		if deniedOnly && decisions[i].Result.Allowed {
+			continue
+		}
+		latest = append(latest, decisions[i])
+	}
+
+	respondJSON(w, latest)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+// deletePropagation is the propagation of deleted runs, JOB_DELETE_PROPAGATION or
+// Foreground, which keeps the Job until its pods are gone.
+func deletePropagation(value string) (metav1.DeletionPropagation, bool) {
+	if value == "" {
+		value = envOrDefault("JOB_DELETE_PROPAGATION", string(metav1.DeletePropagationForeground))
+	}
+	for _, p := range []metav1.DeletionPropagation{metav1.DeletePropagationForeground, metav1.DeletePropagationBackground} {
+		if strings.EqualFold(value, string(p)) {
+			return p, true
+		}
+	}
+
+	return "", false
+}
+
+// reportPodsAnnotation records the UIDs of the pods of a finished run. Runs without shards
+// write their HTML report to a directory named after the UID of their pod, the annotation
+// keeps those directories attributable once the pods are gone.
+const reportPodsAnnotation = "playwright.operator/report-pods"
+
+// runPodUIDs returns the UIDs of the pods of a run, the recorded ones and those of the
+// pods that still exist.
+func runPodUIDs(ctx context.Context, clientset *kubernetes.Clientset, job *batchv1.Job) ([]types.UID, error) {
+	pods, err := clientset.CoreV1().Pods(job.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: batchv1.ControllerUidLabel + "=" + string(job.UID),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	uids := recordedPodUIDs(job)
+	for _, pod := range pods.Items {
+		if !slices.Contains(uids, pod.UID) {
+			uids = append(uids, pod.UID)
+		}
+	}
+
+	return uids, nil
+}
+
+// recordedPodUIDs returns the pod UIDs of reportPodsAnnotation, ignoring anything that is
+// not a UID so the annotation cannot point outside the results volume.
+func recordedPodUIDs(job *batchv1.Job) []types.UID {
+	var uids []types.UID
+	for _, uid := range strings.Split(job.Annotations[reportPodsAnnotation], ",") {
+		if runUID.MatchString(uid) {
+			uids = append(uids, types.UID(uid))
+		}
+	}
+
+	return uids
+}
+
+func joinUIDs(uids []types.UID) string {
+	parts := make([]string, len(uids))
+	for i, uid := range uids {
+		parts[i] = string(uid)
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// removeRunResults deletes the HTML reports, the checkpoint, the soak snapshots and the
+// artifact scan of a run from the results volume. The HTML report of a run is below its
+// UID with shards, below the UIDs of its pods without.
+func removeRunResults(uid types.UID, podUIDs []types.UID) error {
+	dirs := []string{filepath.Join(resultsDir, string(uid)), filepath.Join(resultsDir, "checkpoints", string(uid)), soakSnapshotsFile(uid), artifactScanFile(uid)}
+	for _, pod := range podUIDs {
+		if runUID.MatchString(string(pod)) {
+			dirs = append(dirs, filepath.Join(resultsDir, string(pod)))
+		}
+	}
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DELETE /jobs?namespace=ns&name=job&propagation=foreground|background&results=true
+// deletes a run, and its results with results=true. Pinned runs have to be unpinned
+// first.
+func deleteJob(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	query := r.URL.Query()
+	namespace := getNamespace(query.Get("namespace"))
+	name := query.Get("name")
+	if namespace == "" || name == "" {
+		writeError(w, "namespace and name parameters required", http.StatusBadRequest)
+		return
+	}
+	propagation, ok := deletePropagation(query.Get("propagation"))
+	if !ok {
+		writeError(w, "propagation must be foreground or background", http.StatusBadRequest)
+		return
+	}
+	withResults, _ := strconv.ParseBool(query.Get("results"))
+
+	job, err := clientset.BatchV1().Jobs(namespace).Get(r.Context(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		writeError(w, "job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if isPinned(job) {
+		writeError(w, "the run is pinned, unpin it first", http.StatusConflict)
+		return
+	}
+
+	// the pods go with the Job, their UIDs name its reports
+	var podUIDs []types.UID
+	if withResults {
+		if podUIDs, err = runPodUIDs(r.Context(), clientset, job); err != nil {
+			respondError(w, err)
+			return
+		}
+	}
+
+	// the precondition spares a run that was recreated under the same name since
+	err = clientset.BatchV1().Jobs(namespace).Delete(r.Context(), name, metav1.DeleteOptions{
+		PropagationPolicy: ptr.To(propagation),
+		Preconditions:     &metav1.Preconditions{UID: ptr.To(job.UID)},
+	})
+	if apierrors.IsNotFound(err) {
+		writeError(w, "job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	log.Printf("deleted run %s/%s", namespace, name)
+
+	if withResults {
+		if err := removeRunResults(job.UID, podUIDs); err != nil {
+			writeError(w, "the run was deleted, its results not: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("deleted results of run %s/%s", namespace, name)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// directoryConfigMap keeps the synced groups, so they survive restarts and directory
+	// outages.
+	directoryConfigMap = "playwright-directory"
+	directoryGroupsKey = "groups.json"
+
+	defaultDirectorySyncInterval = 15 * time.Minute
+	scimPageSize                 = 100
+)
+
+// Directory are the groups of the company directory with the user names and emails of
+// their members, those of nested groups included. Token users that are members count as
+// members of the group, like with a group claim.
+type Directory struct {
+	Synced time.Time           `json:"synced"`
+	Error  string              `json:"error,omitempty"`
+	Groups map[string][]string `json:"groups"`
+}
+
+// DirectoryStatus is the result of the last sync with the member counts of the groups.
+type DirectoryStatus struct {
+	Source string         `json:"source"`
+	Synced *time.Time     `json:"synced,omitempty"`
+	Error  string         `json:"error,omitempty"`
+	Groups map[string]int `json:"groups"`
+}
+
+// UserGroups are the groups of a user in the directory.
+type UserGroups struct {
+	User   string   `json:"user"`
+	Groups []string `json:"groups"`
+}
+
+// directoryCache indexes the synced groups by user.
+type directoryCache struct {
+	mu     sync.RWMutex
+	dir    Directory
+	byUser map[string][]string
+}
+
+var directory directoryCache
+
+func (c *directoryCache) set(dir Directory) {
+	byUser := map[string][]string{}
+	for group, members := range dir.Groups {
+		for _, member := range members {
+			member = strings.ToLower(member)
+			byUser[member] = append(byUser[member], group)
+		}
+	}
+	for _, groups := range byUser {
+		sort.Strings(groups)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dir, c.byUser = dir, byUser
+}
+
+// groupsOf returns the groups of a user name or email, case-insensitively.
+func (c *directoryCache) groupsOf(user string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.byUser[strings.ToLower(user)]
+}
+
+func (c *directoryCache) status() DirectoryStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	status := DirectoryStatus{Source: os.Getenv("DIRECTORY_SCIM_URL"), Error: c.dir.Error, Groups: map[string]int{}}
+	if !c.dir.Synced.IsZero() {
+		synced := c.dir.Synced
+		status.Synced = &synced
+	}
+	for group, members := range c.dir.Groups {
+		status.Groups[group] = len(members)
+	}
+
+	return status
+}
+
+func directorySyncInterval() time.Duration {
+	if d, err := parseWindow(os.Getenv("DIRECTORY_SYNC_INTERVAL")); err == nil && d > 0 {
+		return d
+	}
+
+	return defaultDirectorySyncInterval
+}
+
+// scimClient reads groups and users of a SCIM 2.0 service provider, like those of Entra
+// ID, Okta or Keycloak, with a bearer token.
+type scimClient struct {
+	base   string
+	token  string
+	filter string
+}
+
+// scimClientFromEnv reads DIRECTORY_SCIM_URL, DIRECTORY_SCIM_TOKEN and
+// DIRECTORY_SCIM_GROUP_FILTER, a SCIM filter of the groups to sync like
+// displayName sw "playwright-". It returns nil without URL.
+func scimClientFromEnv() *scimClient {
+	base := strings.TrimSuffix(os.Getenv("DIRECTORY_SCIM_URL"), "/")
+	if base == "" {
+		return nil
+	}
+
+	return &scimClient{base: base, token: os.Getenv("DIRECTORY_SCIM_TOKEN"), filter: os.Getenv("DIRECTORY_SCIM_GROUP_FILTER")}
+}
+
+type scimMember struct {
+	Value string `json:"value"`
+	Type  string `json:"type,omitempty"`
+}
+
+type scimResource struct {
+	ID          string       `json:"id"`
+	DisplayName string       `json:"displayName"`
+	Members     []scimMember `json:"members"`
+	UserName    string       `json:"userName"`
+	Emails      []struct {
+		Value string `json:"value"`
+	} `json:"emails"`
+}
+
+// scimTimeout bounds the request of a page.
+const scimTimeout = 30 * time.Second
+
+// list reads all pages of a resource type.
+func (c *scimClient) list(ctx context.Context, resource string, query url.Values) ([]scimResource, error) {
+	var all []scimResource
+	for start := 1; ; {
+		query.Set("startIndex", strconv.Itoa(start))
+		query.Set("count", strconv.Itoa(scimPageSize))
+		resources, total, err := c.page(ctx, resource, query)
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, resources...)
+		start += len(resources)
+		if len(resources) == 0 || start > total {
+			return all, nil
+		}
+	}
+}
+
+// page reads a page of a resource type and the total number of resources.
+func (c *scimClient) page(ctx context.Context, resource string, query url.Values) ([]scimResource, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, scimTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+"/"+resource+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/scim+json, application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	var page struct {
+		TotalResults int            `json:"totalResults"`
+		Resources    []scimResource `json:"Resources"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&page)
+	if resp.StatusCode >= 400 {
+		return nil, 0, fmt.Errorf("SCIM %s answered %s", resource, resp.Status)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("decoding SCIM %s: %w", resource, err)
+	}
+
+	return page.Resources, page.TotalResults, nil
+}
+
+// fetch reads the groups and resolves their members, nested groups included, to user
+// names and emails.
+func (c *scimClient) fetch(ctx context.Context) (map[string][]string, error) {
+	query := url.Values{"attributes": {"displayName,members"}}
+	if c.filter != "" {
+		query.Set("filter", c.filter)
+	}
+	groups, err := c.list(ctx, "Groups", query)
+	if err != nil {
+		return nil, err
+	}
+	users, err := c.list(ctx, "Users", url.Values{"attributes": {"userName,emails"}})
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string][]string{}
+	for _, u := range users {
+		if u.UserName != "" {
+			names[u.ID] = append(names[u.ID], u.UserName)
+		}
+		for _, email := range u.Emails {
+			if email.Value != "" && email.Value != u.UserName {
+				names[u.ID] = append(names[u.ID], email.Value)
+			}
+		}
+	}
+	byID := map[string]scimResource{}
+	for _, g := range groups {
+		byID[g.ID] = g
+	}
+
+	var members func(g scimResource, seen map[string]bool) []string
+	members = func(g scimResource, seen map[string]bool) []string {
+		seen[g.ID] = true
+		var out []string
+		for _, m := range g.Members {
+			if nested, ok := byID[m.Value]; ok && m.Type != "User" {
+				if !seen[nested.ID] {
+					out = append(out, members(nested, seen)...)
+				}
+				continue
+			}
+			out = append(out, names[m.Value]...)
+		}
+		return out
+	}
+
+	result := map[string][]string{}
+	for _, g := range groups {
+		if g.DisplayName == "" {
+			continue
+		}
+		unique := map[string]bool{}
+		for _, name := range members(g, map[string]bool{}) {
+			unique[name] = true
+		}
+		list := make([]string, 0, len(unique))
+		for name := range unique {
+			list = append(list, name)
+		}
+		sort.Strings(list)
+		result[g.DisplayName] = list
+	}
+
+	return result, nil
+}
+
+func loadDirectory(ctx context.Context, clientset *kubernetes.Clientset, namespace string) (*corev1.ConfigMap, Directory, error) {
+	var dir Directory
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, directoryConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: directoryConfigMap, Namespace: namespace}}, dir, nil
+	}
+	if err != nil {
+		return nil, dir, err
+	}
+	if data := cm.Data[directoryGroupsKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &dir); err != nil {
+			return nil, dir, fmt.Errorf("decoding %s: %w", cm.Name, err)
+		}
+	}
+
+	return cm, dir, nil
+}
+
+func saveDirectory(ctx context.Context, clientset *kubernetes.Clientset, cm *corev1.ConfigMap, dir Directory) error {
+	data, err := json.Marshal(dir)
+	if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[directoryGroupsKey] = string(data)
+
+	if cm.ResourceVersion == "" {
+		_, err = clientset.CoreV1().ConfigMaps(cm.Namespace).Create(ctx, cm, metav1.CreateOptions{})
+	} else {
+		_, err = clientset.CoreV1().ConfigMaps(cm.Namespace).Update(ctx, cm, metav1.UpdateOptions{})
+	}
+
+	return err
+}
+
+// syncDirectory copies the groups of the SCIM directory on start and every interval, so
+// the allowed and sign-off groups follow it without group claims in tokens. A failed
+// sync keeps the groups of the last one and records the error.
+func syncDirectory(ctx context.Context, clientset *kubernetes.Clientset, client *scimClient, namespace string, interval time.Duration) {
+	if _, dir, err := loadDirectory(ctx, clientset, namespace); err != nil {
+		log.Printf("cannot load directory groups: %v", err)
+	} else {
+		directory.set(dir)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cm, dir, err := loadDirectory(ctx, clientset, namespace)
+		if err != nil {
+			log.Printf("cannot load directory groups: %v", err)
+		} else {
+			groups, err := client.fetch(ctx)
+			if err != nil {
+				log.Printf("cannot sync directory groups: %v", err)
+				dir.Error = err.Error()
+			} else {
+				dir = Directory{Synced: time.Now().UTC(), Groups: groups}
+			}
+			directory.set(dir)
+			if err := saveDirectory(ctx, clientset, cm, dir); err != nil {
+				log.Printf("cannot save directory groups: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GET /directory/groups?user=name returns the groups of a user name or email in the
+// directory, the dashboard adds them to those of the token at sign in.
+func getUserGroups(w http.ResponseWriter, r *http.Request) {
+	user := r.URL.Query().Get("user")
+	if user == "" {
+		writeError(w, "user is required", http.StatusBadRequest)
+		return
+	}
+
+	groups := directory.groupsOf(user)
+	if groups == nil {
+		groups = []string{}
+	}
+	respondJSON(w, UserGroups{User: user, Groups: groups})
+}
+
+// GET /admin/directory
+func getDirectoryStatus(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, directory.status())
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ErrorResponse is the body of all error responses.
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail has the status of the response as code, and for errors of the Kubernetes
+// API their reason, like Forbidden or TooManyRequests.
+type ErrorDetail struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message"`
+}
+
+// writeError answers a request with an error like http.Error, with an ErrorResponse as
+// body.
+func writeError(w http.ResponseWriter, message string, code int) {
+	writeErrorDetail(w, ErrorDetail{Code: code, Message: message})
+}
+
+func writeErrorDetail(w http.ResponseWriter, detail ErrorDetail) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(detail.Code)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: detail})
+}
+
+// kubeErrorStatus maps errors of the Kubernetes API, wrapped ones included, to the status
+// of the response. Other errors are internal errors.
+func kubeErrorStatus(err error) int {
+	switch {
+	case apierrors.IsNotFound(err):
+		return http.StatusNotFound
+	case apierrors.IsForbidden(err):
+		return http.StatusForbidden
+	case apierrors.IsTooManyRequests(err):
+		return http.StatusTooManyRequests
+	case apierrors.IsTimeout(err), apierrors.IsServerTimeout(err), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case apierrors.IsServiceUnavailable(err):
+		return http.StatusServiceUnavailable
+	case apierrors.IsConflict(err), apierrors.IsAlreadyExists(err):
+		return http.StatusConflict
+	case apierrors.IsInvalid(err):
+		return http.StatusUnprocessableEntity
+	case apierrors.IsBadRequest(err):
+		return http.StatusBadRequest
+	case apierrors.IsGone(err), apierrors.IsResourceExpired(err):
+		return http.StatusGone
+	case apierrors.IsRequestEntityTooLargeError(err):
+		return http.StatusRequestEntityTooLarge
+	}
+
+	return http.StatusInternalServerError
+}
+
+// respondError answers a request with the status kubeErrorStatus maps an error to, and
+// with the Retry-After the Kubernetes API suggests for throttled requests.
+func respondError(w http.ResponseWriter, err error) {
+	detail := ErrorDetail{Code: kubeErrorStatus(err), Message: err.Error()}
+	if reason := apierrors.ReasonForError(err); reason != metav1.StatusReasonUnknown {
+		detail.Reason = string(reason)
+	}
+	if seconds, ok := apierrors.SuggestsClientDelay(err); ok && detail.Code >= 429 {
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	}
+
+	writeErrorDetail(w, detail)
+}
@@ -0,0 +1,896 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Expressions of admission rules are a small subset of CEL: null, bool, int, double and
+// string literals, lists, variables with field selection and indexing, the operators
+// ! - * / % + < <= > >= == != in && || and ?:, the has macro and the functions size,
+// int, string, startsWith, endsWith, contains and matches. As in CEL, missing map keys
+// and fields are errors, which && and || absorb when their other side decides, so rules
+// on optional labels test them first, e.g. has(run.labels.approved) or
+// "approved" in run.labels.
+type exprNode interface {
+	eval(vars map[string]interface{}) (interface{}, error)
+}
+
+// compileExpr parses an expression that may refer to the given variables.
+func compileExpr(src string, vars ...string) (exprNode, error) {
+	tokens, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens, vars: vars}
+	node, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEnd {
+		return nil, fmt.Errorf("unexpected %q at %d", tok.text, tok.pos)
+	}
+
+	return node, nil
+}
+
+// evalBool evaluates an expression that must result in a bool.
+func evalBool(node exprNode, vars map[string]interface{}) (bool, error) {
+	v, err := node.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression results in %s, not bool", exprType(v))
+	}
+
+	return b, nil
+}
+
+// exprValue converts a value decoded from JSON with UseNumber to the values of
+// expressions, integral numbers become int64.
+func exprValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = exprValue(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = exprValue(v[k])
+		}
+	}
+
+	return v
+}
+
+func exprType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case int64:
+		return "int"
+	case float64:
+		return "double"
+	case string:
+		return "string"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "map"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
+
+const (
+	tokenEnd = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOp
+)
+
+type exprToken struct {
+	kind  int
+	text  string
+	value interface{}
+	pos   int
+}
+
+func lexExpr(src string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			text := src[i:j]
+			var value interface{}
+			var err error
+			if strings.Contains(text, ".") {
+				value, err = strconv.ParseFloat(text, 64)
+			} else {
+				value, err = strconv.ParseInt(text, 10, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at %d", text, i)
+			}
+			tokens = append(tokens, exprToken{kind: tokenNumber, text: text, value: value, pos: i})
+			i = j
+
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] != '\\' {
+					b.WriteByte(src[j])
+					continue
+				}
+				j++
+				if j == len(src) {
+					break
+				}
+				switch src[j] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				case '\\', '"', '\'':
+					b.WriteByte(src[j])
+				default:
+					return nil, fmt.Errorf("invalid escape \\%c at %d", src[j], j)
+				}
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, exprToken{kind: tokenString, text: src[i : j+1], value: b.String(), pos: i})
+			i = j + 1
+
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] >= 'a' && src[j] <= 'z' || src[j] >= 'A' && src[j] <= 'Z' || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, exprToken{kind: tokenIdent, text: src[i:j], pos: i})
+			i = j
+
+		default:
+			op := ""
+			if i+1 < len(src) {
+				switch two := src[i : i+2]; two {
+				case "&&", "||", "==", "!=", "<=", ">=":
+					op = two
+				}
+			}
+			if op == "" && strings.IndexByte("!<>+-*/%?:.,()[]", c) >= 0 {
+				op = string(c)
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", string(c), i)
+			}
+			tokens = append(tokens, exprToken{kind: tokenOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, exprToken{kind: tokenEnd, text: "end of expression", pos: len(src)}), nil
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+	vars   []string
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEnd {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is one of the operators.
+func (p *exprParser) accept(ops ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokenOp && tok.kind != tokenIdent {
+		return "", false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+
+	return "", false
+}
+
+func (p *exprParser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		tok := p.peek()
+		return fmt.Errorf("expected %q at %d, got %q", op, tok.pos, tok.text)
+	}
+
+	return nil
+}
+
+// expr parses the conditional operator, the operators below bind tighter in order.
+func (p *exprParser) expr() (exprNode, error) {
+	cond, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.accept("?"); !ok {
+		return cond, nil
+	}
+
+	then, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+
+	return &condNode{cond: cond, then: then, otherwise: otherwise}, nil
+}
+
+// exprPrecedence lists the binary operators from the loosest to the tightest binding.
+var exprPrecedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">=", "in"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *exprParser) binary(level int) (exprNode, error) {
+	if level == len(exprPrecedence) {
+		return p.unary()
+	}
+
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept(exprPrecedence[level]...)
+		if !ok {
+			return left, nil
+		}
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) unary() (exprNode, error) {
+	if op, ok := p.accept("!", "-"); ok {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+
+	return p.member()
+}
+
+func (p *exprParser) member() (exprNode, error) {
+	node, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, ok := p.accept("."); ok {
+			tok := p.next()
+			if tok.kind != tokenIdent {
+				return nil, fmt.Errorf("expected a field name at %d, got %q", tok.pos, tok.text)
+			}
+			if _, ok := p.accept("("); ok {
+				args, err := p.args(")")
+				if err != nil {
+					return nil, err
+				}
+				if node, err = newCallNode(tok.text, append([]exprNode{node}, args...), true); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			node = &selectNode{operand: node, field: tok.text}
+			continue
+		}
+		if _, ok := p.accept("["); ok {
+			index, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			node = &indexNode{operand: node, index: index}
+			continue
+		}
+
+		return node, nil
+	}
+}
+
+func (p *exprParser) primary() (exprNode, error) {
+	tok := p.next()
+	switch {
+	case tok.kind == tokenNumber || tok.kind == tokenString:
+		return &literalNode{value: tok.value}, nil
+
+	case tok.kind == tokenIdent:
+		switch tok.text {
+		case "true", "false":
+			return &literalNode{value: tok.text == "true"}, nil
+		case "null":
+			return &literalNode{}, nil
+		}
+		if tok.text == "has" {
+			return p.has()
+		}
+		if _, ok := p.accept("("); ok {
+			args, err := p.args(")")
+			if err != nil {
+				return nil, err
+			}
+			return newCallNode(tok.text, args, false)
+		}
+		for _, name := range p.vars {
+			if name == tok.text {
+				return &varNode{name: name}, nil
+			}
+		}
+		return nil, fmt.Errorf("undeclared reference to %q at %d", tok.text, tok.pos)
+
+	case tok.text == "(":
+		node, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(")")
+
+	case tok.text == "[":
+		items, err := p.args("]")
+		if err != nil {
+			return nil, err
+		}
+		return &listNode{items: items}, nil
+	}
+
+	return nil, fmt.Errorf("unexpected %q at %d", tok.text, tok.pos)
+}
+
+// has parses the argument of the has macro, which must be a field selection.
+func (p *exprParser) has() (exprNode, error) {
+	open := p.peek()
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	arg, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	sel, ok := arg.(*selectNode)
+	if !ok {
+		return nil, fmt.Errorf("invalid argument to has() at %d, it takes a field selection", open.pos)
+	}
+
+	return &hasNode{operand: sel.operand, field: sel.field}, nil
+}
+
+// args parses comma separated expressions up to the closing token.
+func (p *exprParser) args(closing string) ([]exprNode, error) {
+	var args []exprNode
+	if _, ok := p.accept(closing); ok {
+		return args, nil
+	}
+	for {
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if _, ok := p.accept(closing); ok {
+			return args, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+type varNode struct {
+	name string
+}
+
+func (n *varNode) eval(vars map[string]interface{}) (interface{}, error) {
+	return vars[n.name], nil
+}
+
+type listNode struct {
+	items []exprNode
+}
+
+func (n *listNode) eval(vars map[string]interface{}) (interface{}, error) {
+	list := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		v, err := item.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = v
+	}
+
+	return list, nil
+}
+
+type selectNode struct {
+	operand exprNode
+	field   string
+}
+
+func (n *selectNode) eval(vars map[string]interface{}) (interface{}, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot select %s of %s", n.field, exprType(v))
+	}
+	field, ok := m[n.field]
+	if !ok {
+		return nil, fmt.Errorf("no such key: %s", n.field)
+	}
+
+	return field, nil
+}
+
+// hasNode tests the presence of a field, has(run.labels.approved).
+type hasNode struct {
+	operand exprNode
+	field   string
+}
+
+func (n *hasNode) eval(vars map[string]interface{}) (interface{}, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot test %s of %s", n.field, exprType(v))
+	}
+	_, found := m[n.field]
+
+	return found, nil
+}
+
+type indexNode struct {
+	operand, index exprNode
+}
+
+func (n *indexNode) eval(vars map[string]interface{}) (interface{}, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	index, err := n.index.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		key, ok := index.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot index a map with %s", exprType(index))
+		}
+		value, found := v[key]
+		if !found {
+			return nil, fmt.Errorf("no such key: %s", key)
+		}
+		return value, nil
+	case []interface{}:
+		i, ok := index.(int64)
+		if !ok {
+			return nil, fmt.Errorf("cannot index a list with %s", exprType(index))
+		}
+		if i < 0 || i >= int64(len(v)) {
+			return nil, fmt.Errorf("index %d out of range of a list of %d", i, len(v))
+		}
+		return v[i], nil
+	}
+
+	return nil, fmt.Errorf("cannot index %s", exprType(v))
+}
+
+type condNode struct {
+	cond, then, otherwise exprNode
+}
+
+func (n *condNode) eval(vars map[string]interface{}) (interface{}, error) {
+	cond, err := evalBool(n.cond, vars)
+	if err != nil {
+		return nil, err
+	}
+	if cond {
+		return n.then.eval(vars)
+	}
+
+	return n.otherwise.eval(vars)
+}
+
+type unaryNode struct {
+	op      string
+	operand exprNode
+}
+
+func (n *unaryNode) eval(vars map[string]interface{}) (interface{}, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := v.(type) {
+	case bool:
+		if n.op == "!" {
+			return !v, nil
+		}
+	case int64:
+		if n.op == "-" {
+			return -v, nil
+		}
+	case float64:
+		if n.op == "-" {
+			return -v, nil
+		}
+	}
+
+	return nil, fmt.Errorf("cannot apply %s to %s", n.op, exprType(v))
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *binaryNode) eval(vars map[string]interface{}) (interface{}, error) {
+	// && and || only evaluate the right side when the left one does not decide, an error
+	// of the left side only counts when the right one does not decide either, as in CEL
+	if n.op == "&&" || n.op == "||" {
+		decisive := n.op == "||"
+		left, leftErr := evalBool(n.left, vars)
+		if leftErr == nil && left == decisive {
+			return left, nil
+		}
+		right, err := evalBool(n.right, vars)
+		if err != nil {
+			return nil, err
+		}
+		if right == decisive || leftErr == nil {
+			return right, nil
+		}
+		return nil, leftErr
+	}
+
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return exprEqual(left, right), nil
+	case "!=":
+		return !exprEqual(left, right), nil
+	case "<", "<=", ">", ">=":
+		c, err := exprCompare(left, right)
+		if err != nil {
+			return nil, err
+		}
+		switch n.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case "in":
+		switch container := right.(type) {
+		case []interface{}:
+			for _, item := range container {
+				if exprEqual(left, item) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case map[string]interface{}:
+			key, ok := left.(string)
+			if !ok {
+				return nil, fmt.Errorf("cannot look up %s in a map", exprType(left))
+			}
+			_, found := container[key]
+			return found, nil
+		}
+		return nil, fmt.Errorf("cannot apply in to %s", exprType(right))
+	}
+
+	return exprArithmetic(n.op, left, right)
+}
+
+func exprNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+
+	return 0, false
+}
+
+func exprEqual(a, b interface{}) bool {
+	if x, ok := exprNumber(a); ok {
+		y, ok := exprNumber(b)
+		return ok && x == y
+	}
+	if x, ok := a.([]interface{}); ok {
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !exprEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func exprCompare(a, b interface{}) (int, error) {
+	if x, ok := exprNumber(a); ok {
+		if y, ok := exprNumber(b); ok {
+			switch {
+			case x < y:
+				return -1, nil
+			case x > y:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	if x, ok := a.(string); ok {
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), nil
+		}
+	}
+	// false orders before true, so comparisons chain like in CEL, e.g. a < b == true
+	if x, ok := a.(bool); ok {
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0, nil
+			case y:
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+
+	return 0, fmt.Errorf("cannot compare %s and %s", exprType(a), exprType(b))
+}
+
+func exprArithmetic(op string, a, b interface{}) (interface{}, error) {
+	if op == "+" {
+		switch x := a.(type) {
+		case string:
+			if y, ok := b.(string); ok {
+				return x + y, nil
+			}
+		case []interface{}:
+			if y, ok := b.([]interface{}); ok {
+				return append(append([]interface{}{}, x...), y...), nil
+			}
+		}
+	}
+
+	if x, ok := a.(int64); ok {
+		if y, ok := b.(int64); ok {
+			switch op {
+			case "+":
+				return x + y, nil
+			case "-":
+				return x - y, nil
+			case "*":
+				return x * y, nil
+			}
+			if y == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			if op == "/" {
+				return x / y, nil
+			}
+			return x % y, nil
+		}
+	}
+	if x, ok := exprNumber(a); ok {
+		if y, ok := exprNumber(b); ok {
+			switch op {
+			case "+":
+				return x + y, nil
+			case "-":
+				return x - y, nil
+			case "*":
+				return x * y, nil
+			case "/":
+				return x / y, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("cannot apply %s to %s and %s", op, exprType(a), exprType(b))
+}
+
+// exprFunctions maps the functions to their number of arguments, methods count their
+// receiver.
+var exprFunctions = map[string]int{
+	"size":       1,
+	"int":        1,
+	"string":     1,
+	"startsWith": 2,
+	"endsWith":   2,
+	"contains":   2,
+	"matches":    2,
+}
+
+type callNode struct {
+	name string
+	args []exprNode
+}
+
+func newCallNode(name string, args []exprNode, method bool) (exprNode, error) {
+	arity, ok := exprFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	if len(args) != arity {
+		if method {
+			return nil, fmt.Errorf("%s takes %d arguments", name, arity-1)
+		}
+		return nil, fmt.Errorf("%s takes %d arguments", name, arity)
+	}
+
+	return &callNode{name: name, args: args}, nil
+}
+
+func (n *callNode) eval(vars map[string]interface{}) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	switch n.name {
+	case "size":
+		switch v := args[0].(type) {
+		case string:
+			return int64(utf8.RuneCountInString(v)), nil
+		case []interface{}:
+			return int64(len(v)), nil
+		case map[string]interface{}:
+			return int64(len(v)), nil
+		}
+	case "int":
+		switch v := args[0].(type) {
+		case int64:
+			return v, nil
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, fmt.Errorf("cannot convert %v to int", v)
+			}
+			return int64(v), nil
+		case string:
+			i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("cannot convert %q to int", v)
+			}
+			return i, nil
+		}
+	case "string":
+		switch v := args[0].(type) {
+		case string:
+			return v, nil
+		case bool, int64, float64:
+			return fmt.Sprint(v), nil
+		}
+	default:
+		s, ok := args[0].(string)
+		arg, argOK := args[1].(string)
+		if !ok || !argOK {
+			break
+		}
+		switch n.name {
+		case "startsWith":
+			return strings.HasPrefix(s, arg), nil
+		case "endsWith":
+			return strings.HasSuffix(s, arg), nil
+		case "contains":
+			return strings.Contains(s, arg), nil
+		}
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", arg, err)
+		}
+		return re.MatchString(s), nil
+	}
+
+	types := make([]string, len(args))
+	for i, arg := range args {
+		types[i] = exprType(arg)
+	}
+	return nil, fmt.Errorf("no overload of %s for %s", n.name, strings.Join(types, ", "))
+}
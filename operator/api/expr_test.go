@@ -0,0 +1,126 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEvalExpr(t *testing.T) {
+	vars := map[string]interface{}{
+		"run": map[string]interface{}{
+			"suite":  "nightly",
+			"shards": int64(4),
+			"labels": map[string]interface{}{"team": "checkout"},
+			"env":    []interface{}{"CI", "DEBUG"},
+		},
+	}
+
+	for _, tc := range []struct {
+		expr string
+		want interface{}
+	}{
+		{`1 + 2 * 3`, int64(7)},
+		{`7 / 2`, int64(3)},
+		{`-7 % 3`, int64(-1)},
+		{`7.0 / 2`, 3.5},
+		{`"a" + 'b'`, "ab"},
+		{`[1] + [2]`, []interface{}{int64(1), int64(2)}},
+		{`1 == 1.0`, true},
+		{`"nightly" < "smoke"`, true},
+		{`run.suite == "nightly" ? run.shards : 1`, int64(4)},
+		{`run.shards <= 8 && run.suite.startsWith("night")`, true},
+		{`run.labels["team"] == "checkout"`, true},
+		{`run.env[1]`, "DEBUG"},
+		{`"CI" in run.env`, true},
+		{`"approved" in run.labels`, false},
+		{`has(run.labels.team)`, true},
+		{`has(run.labels.approved)`, false},
+		{`!has(run.labels.approved) || run.labels.approved == "true"`, true},
+		{`size(run.env) + size("äb") + size(run.labels)`, int64(5)},
+		{`int("42") + int(2.9)`, int64(44)},
+		{`string(run.shards)`, "4"},
+		{`run.suite.matches("^night")`, true},
+		{`run.suite.contains("igh") && !run.suite.endsWith("x")`, true},
+		// comparisons chain left to right like in CEL, false orders before true
+		{`1 < 2 == true`, true},
+		{`1 < 2 < true`, false},
+		{`false < true`, true},
+		// && and || absorb errors when their other side decides, in either order
+		{`run.labels.approved == "true" || true`, true},
+		{`run.labels.approved == "true" && false`, false},
+		{`false && run.labels.approved == "true"`, false},
+		{`true || run.labels.approved == "true"`, true},
+	} {
+		node, err := compileExpr(tc.expr, admissionVars...)
+		if err != nil {
+			t.Errorf("compileExpr(%s): %v", tc.expr, err)
+			continue
+		}
+		got, err := node.eval(vars)
+		if err != nil {
+			t.Errorf("eval(%s): %v", tc.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("eval(%s) = %#v, want %#v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestEvalExprErrors(t *testing.T) {
+	vars := map[string]interface{}{
+		"run": map[string]interface{}{
+			"shards": int64(4),
+			"labels": map[string]interface{}{},
+			"env":    []interface{}{},
+		},
+	}
+
+	for _, tc := range []struct {
+		expr, err string
+	}{
+		{`run.labels.approved == "true"`, "no such key: approved"},
+		{`run.labels["approved"] == "true"`, "no such key: approved"},
+		{`run.missing`, "no such key: missing"},
+		{`run.labels.approved == "true" || false`, "no such key: approved"},
+		{`true && run.labels.approved == "true"`, "no such key: approved"},
+		{`1 < 2 < 3`, "cannot compare bool and int"},
+		{`run.shards < "8"`, "cannot compare int and string"},
+		{`run.env[0]`, "out of range"},
+		{`1 / 0`, "division by zero"},
+		{`int("four")`, "cannot convert"},
+		{`size(1)`, "no overload of size for int"},
+		{`run.shards ? 1 : 2`, "not bool"},
+	} {
+		node, err := compileExpr(tc.expr, admissionVars...)
+		if err != nil {
+			t.Errorf("compileExpr(%s): %v", tc.expr, err)
+			continue
+		}
+		_, err = node.eval(vars)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("eval(%s) error %v, want %q", tc.expr, err, tc.err)
+		}
+	}
+}
+
+func TestCompileExprErrors(t *testing.T) {
+	for _, tc := range []struct {
+		expr, err string
+	}{
+		{`job.name`, `undeclared reference to "job"`},
+		{`has(run.labels["team"])`, "invalid argument to has()"},
+		{`has(run)`, "invalid argument to has()"},
+		{`run.suite.trim()`, "unknown function trim"},
+		{`size(run.env, 1)`, "size takes 1 arguments"},
+		{`run.shards >`, "unexpected"},
+		{`(run.shards`, `expected ")"`},
+		{`"unterminated`, "unterminated string"},
+		{`run.shards & 1`, `unexpected "&"`},
+	} {
+		if _, err := compileExpr(tc.expr, admissionVars...); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("compileExpr(%s) error %v, want %q", tc.expr, err, tc.err)
+		}
+	}
+}
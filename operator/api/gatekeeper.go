@@ -0,0 +1,477 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// The admission rules are exported as a Gatekeeper ConstraintTemplate and Constraint, so
+// clusters running OPA Gatekeeper enforce them on every run Job, including those not
+// created through the API, and report existing runs that violate them in its audit.
+// The Rego of the template derives the run from the Job like rerunSpec does, from its pod
+// template and labels, and checks it with the expressions of the rules translated to
+// Rego. The RunSpec stored on the Job, see runSpecAnnotation, only fills in the fields the
+// Job does not tell, so Jobs created without or with a forged annotation are checked
+// against what they run.
+const (
+	gatekeeperTemplateName   = "playwrightadmissionrules"
+	gatekeeperKind           = "PlaywrightAdmissionRules"
+	gatekeeperConstraintName = "playwright-admission-rules"
+)
+
+// regoPrelude implements the semantics of the expression language the translated rules
+// rely on: undefined missing keys, no comparisons across types and integer division.
+const regoPrelude = `pw_update {
+	input.review.operation == "UPDATE"
+}
+
+pw_run = run {
+	run := object.union(object.union(pw_defaults, pw_stored_spec), pw_job_spec(input.review.object))
+}
+
+pw_stored_spec = spec {
+	spec := json.unmarshal(input.review.object.metadata.annotations["` + runSpecAnnotation + `"])
+	is_object(spec)
+} else = {} {
+	true
+}
+
+pw_job_spec(job) = spec {
+	pod := job.spec.template.spec
+	container := pw_first(object.get(pod, "containers", []))
+	labels := object.get(job.metadata, "labels", {})
+	spec := {
+		"namespace": job.metadata.namespace,
+		"labels": labels,
+		"suite": object.get(labels, "` + suiteLabel + `", ""),
+		"branch": object.get(labels, "` + branchLabel + `", ""),
+		"image": object.get(container, "image", ""),
+		"command": object.get(container, "command", []),
+		"env": {e.name: object.get(e, "value", "") | e := object.get(container, "env", [])[_]; not e.valueFrom},
+		"serviceAccountName": object.get(pod, "serviceAccountName", ""),
+		"imagePullSecrets": [s.name | s := object.get(pod, "imagePullSecrets", [])[_]],
+		"shards": pw_shards(job),
+		"ttlSecondsAfterFinished": object.get(job.spec, "ttlSecondsAfterFinished", null),
+	}
+}
+
+pw_first(xs) = x {
+	x := xs[0]
+} else = {} {
+	true
+}
+
+pw_shards(job) = n {
+	job.spec.completionMode == "Indexed"
+	n := job.spec.completions
+} else = 0 {
+	true
+}
+
+pw_get(x, k) = v {
+	is_object(x)
+	v := x[k]
+}
+
+pw_has(x, k) {
+	is_object(x)
+	_ = x[k]
+}
+
+pw_get(x, k) = v {
+	is_array(x)
+	v := x[k]
+}
+
+pw_in(x, y) {
+	is_array(y)
+	y[_] == x
+}
+
+pw_in(x, y) {
+	is_object(y)
+	_ = y[x]
+}
+
+pw_comparable(a, b) {
+	is_number(a)
+	is_number(b)
+}
+
+pw_comparable(a, b) {
+	is_string(a)
+	is_string(b)
+}
+
+pw_comparable(a, b) {
+	is_boolean(a)
+	is_boolean(b)
+}
+
+pw_integral(x) {
+	is_number(x)
+	floor(x) == x
+}
+
+pw_trunc(x) = y {
+	x >= 0
+	y := floor(x)
+}
+
+pw_trunc(x) = y {
+	x < 0
+	y := ceil(x)
+}
+
+pw_add(a, b) = c {
+	is_number(a)
+	is_number(b)
+	c := a + b
+}
+
+pw_add(a, b) = c {
+	is_string(a)
+	is_string(b)
+	c := concat("", [a, b])
+}
+
+pw_add(a, b) = c {
+	is_array(a)
+	is_array(b)
+	c := array.concat(a, b)
+}
+
+pw_div(a, b) = c {
+	pw_integral(a)
+	pw_integral(b)
+	b != 0
+	c := pw_trunc(a / b)
+}
+
+pw_div(a, b) = c {
+	is_number(a)
+	is_number(b)
+	not pw_integral(a)
+	c := a / b
+}
+
+pw_div(a, b) = c {
+	pw_integral(a)
+	is_number(b)
+	not pw_integral(b)
+	c := a / b
+}
+
+pw_rem(a, b) = c {
+	pw_integral(a)
+	pw_integral(b)
+	b != 0
+	c := a % b
+}
+
+pw_int(x) = y {
+	is_number(x)
+	y := pw_trunc(x)
+}
+
+pw_int(x) = y {
+	is_string(x)
+	y := to_number(trim_space(x))
+	pw_integral(y)
+}
+
+pw_string(x) = x {
+	is_string(x)
+}
+
+pw_string(x) = y {
+	is_number(x)
+	y := sprintf("%v", [x])
+}
+
+pw_string(x) = y {
+	is_boolean(x)
+	y := sprintf("%v", [x])
+}
+`
+
+// regoWriter translates expressions to Rego rules of the run, boolean expressions become
+// the bodies of rules that hold when the expression does. Where the expression errors,
+// e.g. for a type mismatch, the Rego is undefined instead, which rejects runs like the
+// API does unless the error is negated.
+type regoWriter struct {
+	prefix  string
+	n       int
+	helpers []string
+}
+
+// rule renders a rule named name that holds for the run when the expression does.
+func (w *regoWriter) rule(name string, node exprNode) {
+	w.helpers = append(w.helpers, regoRule(name+"(run)", w.bodies(node))...)
+}
+
+func regoRule(head string, bodies [][]string) []string {
+	var rules []string
+	for _, body := range bodies {
+		rules = append(rules, head+" {\n\t"+strings.Join(body, "\n\t")+"\n}\n")
+	}
+
+	return rules
+}
+
+func (w *regoWriter) helper() string {
+	w.n++
+	return fmt.Sprintf("%s_%d", w.prefix, w.n)
+}
+
+// bodies returns the alternative bodies of which one holds when the expression does.
+func (w *regoWriter) bodies(node exprNode) [][]string {
+	switch n := node.(type) {
+	case *literalNode:
+		if b, ok := n.value.(bool); ok {
+			return [][]string{{strconv.FormatBool(b)}}
+		}
+	case *unaryNode:
+		if n.op == "!" {
+			return [][]string{{"not " + w.literal(n.operand)}}
+		}
+	case *condNode:
+		cond := w.literal(n.cond)
+		return [][]string{
+			append([]string{cond}, w.conjunction(n.then)...),
+			append([]string{"not " + cond}, w.conjunction(n.otherwise)...),
+		}
+	case *binaryNode:
+		switch n.op {
+		case "&&":
+			return [][]string{append(w.conjunction(n.left), w.conjunction(n.right)...)}
+		case "||":
+			return append(w.bodies(n.left), w.bodies(n.right)...)
+		case "==", "!=":
+			return [][]string{{w.term(n.left) + " " + n.op + " " + w.term(n.right)}}
+		case "<", "<=", ">", ">=":
+			left, right := w.term(n.left), w.term(n.right)
+			return [][]string{{"pw_comparable(" + left + ", " + right + ")", left + " " + n.op + " " + right}}
+		case "in":
+			return [][]string{{"pw_in(" + w.term(n.left) + ", " + w.term(n.right) + ")"}}
+		}
+	case *hasNode:
+		return [][]string{{"pw_has(" + w.term(n.operand) + ", " + regoJSON(n.field) + ")"}}
+	case *callNode:
+		builtins := map[string]string{"startsWith": "startswith", "endsWith": "endswith", "contains": "contains"}
+		switch {
+		case builtins[n.name] != "":
+			return [][]string{{builtins[n.name] + "(" + w.term(n.args[0]) + ", " + w.term(n.args[1]) + ")"}}
+		case n.name == "matches":
+			return [][]string{{"regex.match(" + w.term(n.args[1]) + ", " + w.term(n.args[0]) + ")"}}
+		}
+	}
+
+	return [][]string{{w.term(node) + " == true"}}
+}
+
+// conjunction returns the expression as a single body, with alternatives moved to a rule.
+func (w *regoWriter) conjunction(node exprNode) []string {
+	bodies := w.bodies(node)
+	if len(bodies) == 1 {
+		return bodies[0]
+	}
+
+	name := w.helper()
+	w.helpers = append(w.helpers, regoRule(name+"(run)", bodies)...)
+	return []string{name + "(run)"}
+}
+
+// literal returns the expression as a single expression of a body, as not requires.
+func (w *regoWriter) literal(node exprNode) string {
+	body := w.conjunction(node)
+	if len(body) == 1 {
+		return body[0]
+	}
+
+	name := w.helper()
+	w.helpers = append(w.helpers, regoRule(name+"(run)", [][]string{body})...)
+	return name + "(run)"
+}
+
+// boolValue moves a boolean expression used as a value to a rule that is true or false.
+func (w *regoWriter) boolValue(node exprNode) string {
+	name := w.helper()
+	var b strings.Builder
+	for i, body := range w.bodies(node) {
+		if i == 0 {
+			b.WriteString(name + "(run) = true {\n")
+		} else {
+			b.WriteString(" else = true {\n")
+		}
+		b.WriteString("\t" + strings.Join(body, "\n\t") + "\n}")
+	}
+	b.WriteString(" else = false {\n\ttrue\n}\n")
+	w.helpers = append(w.helpers, b.String())
+
+	return name + "(run)"
+}
+
+// term translates an expression used as a value.
+func (w *regoWriter) term(node exprNode) string {
+	switch n := node.(type) {
+	case *literalNode:
+		return regoJSON(n.value)
+	case *varNode:
+		return n.name
+	case *selectNode:
+		return "pw_get(" + w.term(n.operand) + ", " + regoJSON(n.field) + ")"
+	case *indexNode:
+		return "pw_get(" + w.term(n.operand) + ", " + w.term(n.index) + ")"
+	case *listNode:
+		items := make([]string, len(n.items))
+		for i, item := range n.items {
+			items[i] = w.term(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case *unaryNode:
+		if n.op == "-" {
+			return "(0 - " + w.term(n.operand) + ")"
+		}
+	case *condNode:
+		name := w.helper()
+		cond := w.literal(n.cond)
+		w.helpers = append(w.helpers, fmt.Sprintf("%s(run) = x {\n\t%s\n\tx := %s\n} else = x {\n\tx := %s\n}\n",
+			name, cond, w.term(n.then), w.term(n.otherwise)))
+		return name + "(run)"
+	case *binaryNode:
+		switch n.op {
+		case "+":
+			return "pw_add(" + w.term(n.left) + ", " + w.term(n.right) + ")"
+		case "-", "*":
+			return "(" + w.term(n.left) + " " + n.op + " " + w.term(n.right) + ")"
+		case "/":
+			return "pw_div(" + w.term(n.left) + ", " + w.term(n.right) + ")"
+		case "%":
+			return "pw_rem(" + w.term(n.left) + ", " + w.term(n.right) + ")"
+		}
+	case *callNode:
+		switch n.name {
+		case "size":
+			return "count(" + w.term(n.args[0]) + ")"
+		case "int":
+			return "pw_int(" + w.term(n.args[0]) + ")"
+		case "string":
+			return "pw_string(" + w.term(n.args[0]) + ")"
+		}
+	}
+
+	return w.boolValue(node)
+}
+
+// regoJSON writes a value as a Rego term, JSON values are ones.
+func regoJSON(v interface{}) string {
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(v)
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// gatekeeperRego translates the admission rules to the Rego of the ConstraintTemplate,
+// with a violation for each rule a run does not satisfy.
+func gatekeeperRego(rules []AdmissionRule) (string, error) {
+	var b strings.Builder
+	b.WriteString("package " + gatekeeperTemplateName + "\n\n")
+	for i, rule := range rules {
+		expr, err := compileExpr(rule.Expression, admissionVars...)
+		if err != nil {
+			return "", fmt.Errorf("admission rule %s: %w", rule.Name, err)
+		}
+
+		name := fmt.Sprintf("rule_%d", i+1)
+		w := &regoWriter{prefix: name}
+		w.rule(name, expr)
+
+		msg := regoJSON(rule.Name + ": " + rule.message())
+		fmt.Fprintf(&b, "# %s: %s\n", rule.Name, strings.ReplaceAll(rule.Expression, "\n", " "))
+		fmt.Fprintf(&b, "violation[{\"msg\": msg}] {\n\tnot pw_update\n\trun := pw_run\n\tnot %s(run)\n\tmsg := %s\n}\n\n", name, msg)
+		for _, helper := range w.helpers {
+			b.WriteString(helper + "\n")
+		}
+	}
+	b.WriteString("pw_defaults = " + regoJSON(runVars(RunSpec{})) + "\n\n")
+	b.WriteString(regoPrelude)
+
+	return b.String(), nil
+}
+
+// GET /admin/admission/gatekeeper?namespace=ns&enforcementAction=dryrun exports the
+// admission rules as a List of a Gatekeeper ConstraintTemplate and its Constraint for
+// kubectl apply. The Constraint matches the run Jobs of all namespaces, or of the given
+// one, and denies violations unless another enforcementAction is given.
+func exportGatekeeper(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	query := r.URL.Query()
+	action := query.Get("enforcementAction")
+	if action == "" {
+		action = "deny"
+	}
+	if action != "deny" && action != "dryrun" && action != "warn" {
+		writeError(w, "enforcementAction must be deny, dryrun or warn", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := effectiveSettings(r.Context(), clientset)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	rego, err := gatekeeperRego(settings.AdmissionRules)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	// the labels of runsSelector, Jobs with one of them are not runs
+	var notRuns []interface{}
+	for _, label := range []string{monitorLabel, warmLabel, chaosRunLabel, previewRunLabel, mergeRunLabel} {
+		notRuns = append(notRuns, map[string]interface{}{"key": label, "operator": "DoesNotExist"})
+	}
+	match := map[string]interface{}{
+		"kinds":         []interface{}{map[string]interface{}{"apiGroups": []string{"batch"}, "kinds": []string{"Job"}}},
+		"labelSelector": map[string]interface{}{"matchExpressions": notRuns},
+	}
+	if namespace := query.Get("namespace"); namespace != "" {
+		match["namespaces"] = []string{namespace}
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items": []interface{}{
+			map[string]interface{}{
+				"apiVersion": "templates.gatekeeper.sh/v1",
+				"kind":       "ConstraintTemplate",
+				"metadata":   map[string]interface{}{"name": gatekeeperTemplateName},
+				"spec": map[string]interface{}{
+					"crd": map[string]interface{}{
+						"spec": map[string]interface{}{"names": map[string]interface{}{"kind": gatekeeperKind}},
+					},
+					"targets": []interface{}{
+						map[string]interface{}{"target": "admission.k8s.gatekeeper.sh", "rego": rego},
+					},
+				},
+			},
+			map[string]interface{}{
+				"apiVersion": "constraints.gatekeeper.sh/v1beta1",
+				"kind":       gatekeeperKind,
+				"metadata":   map[string]interface{}{"name": gatekeeperConstraintName},
+				"spec": map[string]interface{}{
+					"enforcementAction": action,
+					"match":             match,
+				},
+			},
+		},
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGatekeeperRego(t *testing.T) {
+	rego, err := gatekeeperRego([]AdmissionRule{
+		{Name: "nightly-shards", Expression: `run.suite != "nightly" || run.shards <= 8`, Message: "nightly suites may not exceed 8 shards"},
+		{Name: "approved", Expression: `!has(run.labels.release) || run.labels.approved == "true"`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"package " + gatekeeperTemplateName + "\n",
+		`msg := "nightly-shards: nightly suites may not exceed 8 shards"`,
+		"rule_1(run) {\n\tpw_get(run, \"suite\") != \"nightly\"\n}",
+		"rule_1(run) {\n\tpw_comparable(pw_get(run, \"shards\"), 8)\n\tpw_get(run, \"shards\") <= 8\n}",
+		"rule_2(run) {\n\tnot pw_has(pw_get(run, \"labels\"), \"release\")\n}",
+		`msg := "approved: !has(run.labels.release) || run.labels.approved == \"true\" does not hold"`,
+		"pw_defaults = {",
+		// the run is derived from the Job, the stored spec only fills in the rest
+		"run := object.union(object.union(pw_defaults, pw_stored_spec), pw_job_spec(input.review.object))",
+		`"image": object.get(container, "image", ""),`,
+		regoPrelude,
+	} {
+		if !strings.Contains(rego, want) {
+			t.Errorf("rego lacks %q:\n%s", want, rego)
+		}
+	}
+}
+
+func TestGatekeeperRegoInvalidRule(t *testing.T) {
+	_, err := gatekeeperRego([]AdmissionRule{{Name: "broken", Expression: `run.shards <`}})
+	if err == nil || !strings.Contains(err.Error(), "admission rule broken") {
+		t.Errorf("error %v, want one naming the rule", err)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	gateVerdictPass = "pass"
+	gateVerdictFail = "fail"
+)
+
+// GateResponse is the promotion verdict for the latest finished run of a suite.
+type GateResponse struct {
+	Suite       string   `json:"suite"`
+	Branch      string   `json:"branch,omitempty"`
+	Verdict     string   `json:"verdict"`
+	Run         string   `json:"run"`
+	RunState    string   `json:"runState"`
+	PassRate    float64  `json:"passRate"`
+	MinPassRate float64  `json:"minPassRate"`
+	Window      int      `json:"window"`
+	Baseline    string   `json:"baseline,omitempty"`
+	Reasons     []string `json:"reasons,omitempty"`
+	Warnings    []string `json:"warnings,omitempty"`
+}
+
+// GET /gates/{suite}/latest?namespace=ns&branch=b&minPassRate=0.9&window=10
+//
+// The verdict passes when the latest finished run succeeded within its budget and the
+// share of succeeded runs among the last window finished runs reaches minPassRate. With a
+// suite baseline, only tests that did not fail in the baseline fail the latest run.
+// Tests that failed there too, and runs whose failed tests are all suppressed, are
+// warnings instead and count as succeeded in the pass rate.
+// Failing verdicts are answered with 412 so `curl -f` can be used as a pipeline step.
+func suiteGate(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset, informers *runInformers) {
+	query := r.URL.Query()
+	namespace := getNamespace(query.Get("namespace"))
+	suite := r.PathValue("suite")
+	branch := query.Get("branch")
+
+	minPassRate, err := strconv.ParseFloat(envOrDefault("GATE_MIN_PASS_RATE", "1"), 64)
+	if v := query.Get("minPassRate"); v != "" {
+		minPassRate, err = strconv.ParseFloat(v, 64)
+	}
+	if err != nil || minPassRate < 0 || minPassRate > 1 {
+		writeError(w, "minPassRate must be a number between 0 and 1", http.StatusBadRequest)
+		return
+	}
+
+	window := 10
+	if v := query.Get("window"); v != "" {
+		window, err = strconv.Atoi(v)
+		if err != nil || window < 1 {
+			writeError(w, "window must be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	runs, err := listSuiteRuns(r.Context(), informers, namespace, suite, branch)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	finished := finishedRuns(runs)
+	if len(finished) == 0 {
+		writeError(w, fmt.Sprintf("suite %s has no finished runs", suite), http.StatusNotFound)
+		return
+	}
+	if len(finished) > window {
+		finished = finished[:window]
+	}
+
+	latest := &finished[0]
+	resp := GateResponse{
+		Suite:       suite,
+		Branch:      branch,
+		Verdict:     gateVerdictPass,
+		Run:         latest.Name,
+		RunState:    jobState(latest),
+		MinPassRate: minPassRate,
+		Window:      len(finished),
+	}
+
+	rules, err := cachedSuppressions(r.Context(), informers, namespace)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	baseline, err := suiteBaseline(r.Context(), clientset, namespace, suite, branch)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	var against *RunResults
+	if baseline != nil {
+		resp.Baseline = baseline.Current.Run
+		if against, err = baselineResults(r.Context(), clientset, namespace, baseline.Current); err != nil {
+			respondError(w, err)
+			return
+		}
+	}
+
+	resp.PassRate = passRate(finished, rules, against)
+	if baseline != nil && baseline.Current.UID == string(latest.UID) {
+		against = nil
+	}
+	judgeLatestRun(&resp, latest, suppressionFor(rules, latest), against)
+	if budget := evaluateBudget(latest); budget != nil && budget.Verdict == budgetVerdictFailed {
+		resp.Reasons = append(resp.Reasons, budget.Violations...)
+	}
+	if resp.PassRate < minPassRate {
+		resp.Reasons = append(resp.Reasons,
+			fmt.Sprintf("pass rate %.2f of the last %d runs is below %.2f", resp.PassRate, resp.Window, minPassRate))
+	}
+
+	status := http.StatusOK
+	if len(resp.Reasons) > 0 {
+		resp.Verdict = gateVerdictFail
+		status = http.StatusPreconditionFailed
+	}
+
+	respondJSONStatus(w, status, resp)
+}
+
+// judgeLatestRun adds the reasons and warnings of the latest run to the verdict. Compared
+// to the results of the baseline, only tests that did not fail there fail the verdict,
+// tests that failed there too are known issues and warnings.
+func judgeLatestRun(resp *GateResponse, latest *batchv1.Job, suppression *RunSuppression, against *RunResults) {
+	if suppression.suppressed() {
+		resp.Warnings = append(resp.Warnings, fmt.Sprintf("latest run %s failed, its %d failed tests are suppressed until %s: %s",
+			latest.Name, len(suppression.Tests), suppression.expires().Format(time.RFC3339), suppression.reason()))
+		return
+	}
+	if resp.RunState == jobStateSucceeded {
+		return
+	}
+
+	var results *RunResults
+	if against != nil && resp.RunState == jobStateFailed {
+		var err error
+		if results, err = runResults(latest); err != nil {
+			log.Printf("cannot read the results of %s/%s for the gate: %v", latest.Namespace, latest.Name, err)
+		}
+	}
+	if results == nil {
+		resp.Reasons = append(resp.Reasons, fmt.Sprintf("latest run %s %s", latest.Name, resp.RunState))
+		return
+	}
+
+	var cmp RunComparison
+	compareTests(&cmp, results, against)
+	var failures, suppressed []string
+	for _, test := range cmp.NewFailures {
+		if suppression.covers(test) {
+			suppressed = append(suppressed, test.Title)
+		} else {
+			failures = append(failures, test.Title)
+		}
+	}
+	if len(failures) > 0 {
+		resp.Reasons = append(resp.Reasons, fmt.Sprintf("new failures: %d tests of the latest run %s did not fail in the baseline run %s: %s",
+			len(failures), latest.Name, resp.Baseline, strings.Join(failures, ", ")))
+	}
+	if len(results.Errors) > 0 || len(results.MissingShards) > 0 || len(cmp.NewFailures)+len(cmp.ExistingFailures) == 0 {
+		resp.Reasons = append(resp.Reasons, fmt.Sprintf("latest run %s failed outside of its tests", latest.Name))
+	}
+	if len(cmp.ExistingFailures) > 0 {
+		resp.Warnings = append(resp.Warnings, fmt.Sprintf("%d tests of the latest run %s failed in the baseline run %s too",
+			len(cmp.ExistingFailures), latest.Name, resp.Baseline))
+	}
+	if len(suppressed) > 0 {
+		resp.Warnings = append(resp.Warnings, fmt.Sprintf("%d new failures of the latest run %s are suppressed: %s",
+			len(suppressed), latest.Name, strings.Join(suppressed, ", ")))
+	}
+}
+
+// baselineResults returns the parsed results of a baseline run, nil when the run is gone or
+// has none.
+func baselineResults(ctx context.Context, clientset *kubernetes.Clientset, namespace string, baseline *Baseline) (*RunResults, error) {
+	job, err := clientset.BatchV1().Jobs(namespace).Get(ctx, baseline.Run, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) || err == nil && string(job.UID) != baseline.UID {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return runResults(job)
+}
+
+// passRate is the share of runs that succeeded, failed only in suppressed tests or, with
+// the results of the baseline, only in tests that failed in the baseline too.
+func passRate(runs []batchv1.Job, rules []SuppressionRule, against *RunResults) float64 {
+	passed := 0
+	for i := range runs {
+		if outcome := runOutcome(&runs[i], rules); outcome == jobStateSucceeded || outcome == runStateSuppressed || knownFailures(&runs[i], against) {
+			passed++
+		}
+	}
+
+	return float64(passed) / float64(len(runs))
+}
+
+// knownFailures tells whether a failed run failed only in tests that failed in the
+// baseline too.
+func knownFailures(job *batchv1.Job, against *RunResults) bool {
+	if against == nil || jobState(job) != jobStateFailed {
+		return false
+	}
+	results, err := runResults(job)
+	if err != nil || results == nil || len(results.Errors) > 0 || len(results.MissingShards) > 0 {
+		return false
+	}
+
+	var cmp RunComparison
+	compareTests(&cmp, results, against)
+
+	return cmp.Failure == failureExisting
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGateComparesTestsWithTheBaseline(t *testing.T) {
+	dir := useResultsDir(t)
+	latest := batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "smoke-2", UID: "3b1f4c3e-0000-4000-8000-000000000725"},
+		Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+			{Type: batchv1.JobFailed, Status: corev1.ConditionTrue},
+		}},
+	}
+	writeJSONReport(t, filepath.Join(dir, "checkpoints", string(latest.UID), "results.json"), "unexpected")
+	baseline := func(status string) *RunResults {
+		return &RunResults{Specs: []SpecResult{{File: "login.spec.ts", Title: "a", Project: "chromium", Status: status}}}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		against  *RunResults
+		rules    []SuppressionRule
+		reason   string
+		warning  string
+		passRate float64
+	}{
+		{name: "new failure", against: baseline("passed"), reason: "new failures: 1 tests of the latest run smoke-2 did not fail in the baseline run smoke-1: a"},
+		{name: "existing failure", against: baseline("failed"), warning: "1 tests of the latest run smoke-2 failed in the baseline run smoke-1 too", passRate: 1},
+		{name: "without baseline results", reason: "latest run smoke-2 failed"},
+		{
+			name:     "suppressed",
+			against:  baseline("passed"),
+			rules:    []SuppressionRule{{ID: "a", Pattern: "^a$", Reason: "known", Expires: time.Now().Add(time.Hour)}},
+			warning:  "latest run smoke-2 failed, its 1 failed tests are suppressed",
+			passRate: 1,
+		},
+	} {
+		resp := GateResponse{Run: latest.Name, RunState: jobStateFailed, Baseline: "smoke-1"}
+		judgeLatestRun(&resp, &latest, suppressionFor(tc.rules, &latest), tc.against)
+
+		if got := strings.Join(resp.Reasons, "; "); !strings.HasPrefix(got, tc.reason) || (tc.reason == "") != (got == "") {
+			t.Errorf("%s: reasons %q, want %q", tc.name, got, tc.reason)
+		}
+		if got := strings.Join(resp.Warnings, "; "); !strings.HasPrefix(got, tc.warning) || (tc.warning == "") != (got == "") {
+			t.Errorf("%s: warnings %q, want %q", tc.name, got, tc.warning)
+		}
+		if got := passRate([]batchv1.Job{latest}, tc.rules, tc.against); got != tc.passRate {
+			t.Errorf("%s: pass rate %.2f, want %.2f", tc.name, got, tc.passRate)
+		}
+	}
+}
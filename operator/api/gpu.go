@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+const defaultGPUResource = "nvidia.com/gpu"
+
+// RunGPU requests GPUs for suites that need hardware accelerated rendering, like WebGL or
+// video playback. The browsers still have to be launched with GPU support by the suite.
+type RunGPU struct {
+	Count int `json:"count"`
+	// Resource is the extended resource of the device plugin, nvidia.com/gpu by default.
+	Resource string `json:"resource,omitempty"`
+	// NodeSelector and RuntimeClassName select the GPU nodes and their container runtime,
+	// e.g. {"cloud.google.com/gke-accelerator": "nvidia-l4"} and "nvidia".
+	NodeSelector     map[string]string `json:"nodeSelector,omitempty"`
+	RuntimeClassName string            `json:"runtimeClassName,omitempty"`
+}
+
+func (g *RunGPU) resourceName() corev1.ResourceName {
+	if g.Resource == "" {
+		return defaultGPUResource
+	}
+
+	return corev1.ResourceName(g.Resource)
+}
+
+func (g *RunGPU) validate() error {
+	if g.Count < 1 {
+		return fmt.Errorf("gpu count must be at least 1")
+	}
+	if name := string(g.resourceName()); !strings.Contains(name, "/") {
+		return fmt.Errorf("gpu resource %q is not an extended resource like %s", name, defaultGPUResource)
+	}
+
+	return nil
+}
+
+// addGPU requests the GPUs for the test container and schedules the pod onto GPU nodes,
+// tolerating the taint device plugins commonly put on them.
+func addGPU(spec *corev1.PodSpec, g *RunGPU) {
+	name := g.resourceName()
+	quantity := *resource.NewQuantity(int64(g.Count), resource.DecimalSI)
+
+	c := &spec.Containers[0]
+	if c.Resources.Limits == nil {
+		c.Resources.Limits = corev1.ResourceList{}
+	}
+	c.Resources.Limits[name] = quantity
+	// the NVIDIA runtime exposes only compute by default, rendering needs the graphics libraries
+	if name == defaultGPUResource {
+		c.Env = append(c.Env, corev1.EnvVar{Name: "NVIDIA_DRIVER_CAPABILITIES", Value: "all"})
+	}
+
+	if len(g.NodeSelector) > 0 {
+		if spec.NodeSelector == nil {
+			spec.NodeSelector = map[string]string{}
+		}
+		for k, v := range g.NodeSelector {
+			spec.NodeSelector[k] = v
+		}
+	}
+	spec.Tolerations = append(spec.Tolerations, corev1.Toleration{
+		Key:      string(name),
+		Operator: corev1.TolerationOpExists,
+		Effect:   corev1.TaintEffectNoSchedule,
+	})
+	if g.RuntimeClassName != "" {
+		spec.RuntimeClassName = ptr.To(g.RuntimeClassName)
+	}
+}
+
+// validateGPU checks that a node matching the selector exposes enough of the GPU resource,
+// so a run fails right away when the device plugin is missing instead of staying pending.
+func validateGPU(ctx context.Context, clientset *kubernetes.Clientset, g *RunGPU) error {
+	if g.RuntimeClassName != "" {
+		_, err := clientset.NodeV1().RuntimeClasses().Get(ctx, g.RuntimeClassName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("runtime class %s does not exist", g.RuntimeClassName)
+		}
+		if err != nil {
+			return fmt.Errorf("runtime class %s: %w", g.RuntimeClassName, err)
+		}
+	}
+
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(g.NodeSelector).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("listing nodes: %w", err)
+	}
+
+	name := g.resourceName()
+	for _, node := range nodes.Items {
+		if allocatable, ok := node.Status.Allocatable[name]; ok && allocatable.Value() >= int64(g.Count) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no node exposes %d %s, is its device plugin installed?", g.Count, name)
+}
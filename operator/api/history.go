@@ -0,0 +1,800 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// historyLabel marks the runs whose test outcomes are in the history of their suite.
+const historyLabel = "playwright.operator/history-recorded"
+
+// TestOutcome is the status of a test in a run, see SpecResult.
+type TestOutcome struct {
+	File    string `json:"file"`
+	Title   string `json:"title"`
+	Project string `json:"project,omitempty"`
+	Status  string `json:"status"`
+}
+
+// HistoryRun are the outcomes of the tests of a finished run.
+type HistoryRun struct {
+	UID      string        `json:"uid"`
+	Run      string        `json:"run"`
+	Time     time.Time     `json:"time"`
+	Outcomes []TestOutcome `json:"outcomes"`
+}
+
+// testKey identifies a test across the runs of a suite.
+type testKey struct {
+	File, Title, Project string
+}
+
+// historyPartitionLayout names the partitions of the history of a suite, one per month
+// of the time its runs finished.
+const historyPartitionLayout = "2006-01"
+
+// historyMu serializes the writers of history partitions.
+var historyMu sync.Mutex
+
+// historyDir keeps the outcomes of the runs of a suite as JSON lines in the results
+// volume, partitioned by month, see historyPartition.
+func historyDir(root, namespace, suite string) string {
+	return filepath.Join(root, "history", namespace, suite)
+}
+
+func historyPartition(root, namespace, suite, month string) string {
+	return filepath.Join(historyDir(root, namespace, suite), month+".jsonl")
+}
+
+// historyArchiveKey names the archived partition of a month in the results store, below
+// the history prefix, see archiveHistory.
+func historyArchiveKey(namespace, suite, month string) string {
+	return namespace + "/" + suite + "/" + month + ".jsonl.gz"
+}
+
+// historyHotWindow is how long partitions stay on the results volume before archiveHistory
+// moves them to the results store, from HISTORY_HOT_WINDOW, 90 days by default.
+func historyHotWindow() time.Duration {
+	if d, err := parseWindow(os.Getenv("HISTORY_HOT_WINDOW")); err == nil {
+		return d
+	}
+	return 90 * 24 * time.Hour
+}
+
+// historyMonths returns the partitions covering since to until.
+func historyMonths(since, until time.Time) []string {
+	var months []string
+	month := time.Date(since.UTC().Year(), since.UTC().Month(), 1, 0, 0, 0, 0, time.UTC)
+	for !month.After(until) {
+		months = append(months, month.Format(historyPartitionLayout))
+		month = month.AddDate(0, 1, 0)
+	}
+	return months
+}
+
+// archivable reports whether a partition ended before the hot window.
+func archivable(month string, now time.Time) bool {
+	start, err := time.Parse(historyPartitionLayout, month)
+	return err == nil && start.AddDate(0, 1, 0).Before(now.Add(-historyHotWindow()))
+}
+
+func decodeHistory(r io.Reader, since, until time.Time) ([]HistoryRun, error) {
+	runs := []HistoryRun{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var run HistoryRun
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			return nil, err
+		}
+		if !run.Time.Before(since) && (until.IsZero() || !run.Time.After(until)) {
+			runs = append(runs, run)
+		}
+	}
+
+	return runs, scanner.Err()
+}
+
+// readPartition returns the runs of a partition file from since to until, zero times are
+// unbounded. Partitions that do not exist have none.
+func readPartition(file string, since, until time.Time) ([]HistoryRun, error) {
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []HistoryRun{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return decodeHistory(f, since, until)
+}
+
+// readArchivedPartition returns the runs of a partition archived to the results store,
+// none if it was not archived.
+func readArchivedPartition(ctx context.Context, store *resultsStore, namespace, suite, month string, since, until time.Time) ([]HistoryRun, error) {
+	body, err := store.get(ctx, "history", historyArchiveKey(namespace, suite, month))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []HistoryRun{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	zr, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeHistory(zr, since, until)
+}
+
+// readHistory returns the runs of a suite that finished from since to until. Partitions
+// archived to the results store are fetched from it, the slow path of queries reaching
+// back beyond the hot window.
+func readHistory(ctx context.Context, store *resultsStore, namespace, suite string, since, until time.Time) ([]HistoryRun, error) {
+	runs := []HistoryRun{}
+	now := time.Now()
+	for _, month := range historyMonths(since, until) {
+		local, err := readPartition(historyPartition(resultsDir, namespace, suite, month), since, until)
+		if err != nil {
+			return nil, err
+		}
+		if store != nil && archivable(month, now) {
+			archived, err := readArchivedPartition(ctx, store, namespace, suite, month, since, until)
+			if err != nil {
+				return nil, fmt.Errorf("reading the archived history of %s: %w", month, err)
+			}
+			local = mergeHistory(archived, local)
+		}
+		runs = append(runs, local...)
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].Time.Before(runs[j].Time)
+	})
+
+	return runs, nil
+}
+
+// mergeHistory returns the runs of both, those of newer replacing the ones of older with
+// the same UID.
+func mergeHistory(older, newer []HistoryRun) []HistoryRun {
+	seen := map[string]bool{}
+	for _, run := range newer {
+		seen[run.UID] = true
+	}
+	merged := make([]HistoryRun, 0, len(older)+len(newer))
+	for _, run := range older {
+		if !seen[run.UID] {
+			merged = append(merged, run)
+		}
+	}
+	merged = append(merged, newer...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Time.Before(merged[j].Time)
+	})
+
+	return merged
+}
+
+func writePartition(file string, runs []HistoryRun) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(file, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		for _, run := range runs {
+			if err := enc.Encode(run); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// appendHistory appends a run to the partition of the month it finished.
+func appendHistory(namespace, suite string, run HistoryRun) error {
+	line, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	file := historyPartition(resultsDir, namespace, suite, run.Time.UTC().Format(historyPartitionLayout))
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// partitionHistory is the migration moving the runs of the history files of suites,
+// history/<namespace>/<suite>.jsonl, to the monthly partitions of the suites.
+func partitionHistory(root string) error {
+	namespaces, err := os.ReadDir(filepath.Join(root, "history"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, ns := range namespaces {
+		if !ns.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(root, "history", ns.Name()))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			suite, ok := strings.CutSuffix(entry.Name(), ".jsonl")
+			if entry.IsDir() || !ok {
+				continue
+			}
+			if err := partitionSuiteHistory(root, ns.Name(), suite); err != nil {
+				return fmt.Errorf("history of %s/%s: %w", ns.Name(), suite, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func partitionSuiteHistory(root, namespace, suite string) error {
+	legacy := filepath.Join(root, "history", namespace, suite+".jsonl")
+	runs, err := readPartition(legacy, time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+	byMonth := map[string][]HistoryRun{}
+	for _, run := range runs {
+		month := run.Time.UTC().Format(historyPartitionLayout)
+		byMonth[month] = append(byMonth[month], run)
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	for month, moved := range byMonth {
+		// a crash of an earlier attempt may have left the partition with some of them
+		file := historyPartition(root, namespace, suite, month)
+		existing, err := readPartition(file, time.Time{}, time.Time{})
+		if err != nil {
+			return err
+		}
+		if err := writePartition(file, mergeHistory(existing, moved)); err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(legacy)
+}
+
+// archiveHistory moves the partitions that ended before the hot window from the results
+// volume to the results store. A partition archived before is merged with the one on the
+// volume, runs recorded late end up on the volume again.
+func archiveHistory(ctx context.Context, store *resultsStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		files, err := filepath.Glob(filepath.Join(resultsDir, "history", "*", "*", "*.jsonl"))
+		if err != nil {
+			log.Printf("cannot list history partitions: %v", err)
+			continue
+		}
+		archived := 0
+		for _, file := range files {
+			month := strings.TrimSuffix(filepath.Base(file), ".jsonl")
+			if !archivable(month, time.Now()) {
+				continue
+			}
+			suiteDir := filepath.Dir(file)
+			namespace, suite := filepath.Base(filepath.Dir(suiteDir)), filepath.Base(suiteDir)
+			if err := archivePartition(ctx, store, namespace, suite, month); err != nil {
+				log.Printf("cannot archive the history of %s/%s of %s: %v", namespace, suite, month, err)
+				continue
+			}
+			archived++
+		}
+		if archived > 0 {
+			log.Printf("archived %d history partitions to %s", archived, store.Provider)
+		}
+	}
+}
+
+func archivePartition(ctx context.Context, store *resultsStore, namespace, suite, month string) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	file := historyPartition(resultsDir, namespace, suite, month)
+	local, err := readPartition(file, time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+	archived, err := readArchivedPartition(ctx, store, namespace, suite, month, time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	gz := file + ".gz"
+	err = writeFileAtomic(gz, func(w io.Writer) error {
+		zw := gzip.NewWriter(w)
+		enc := json.NewEncoder(zw)
+		for _, run := range mergeHistory(archived, local) {
+			if err := enc.Encode(run); err != nil {
+				return err
+			}
+		}
+		return zw.Close()
+	})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(gz)
+	if err := store.put(ctx, "history", historyArchiveKey(namespace, suite, month), gz); err != nil {
+		return err
+	}
+
+	return os.Remove(file)
+}
+
+func historyOutcomes(results *RunResults) []TestOutcome {
+	var outcomes []TestOutcome
+	for _, spec := range results.Specs {
+		outcomes = append(outcomes, TestOutcome{File: spec.File, Title: spec.Title, Project: spec.Project, Status: spec.Status})
+	}
+	return outcomes
+}
+
+// recordHistory appends the outcomes of a finished run to the history of its suite and
+// refreshes the aggregate of the day it finished. Runs without a JSON report record
+// nothing.
+func recordHistory(ctx context.Context, store *resultsStore, job *batchv1.Job) error {
+	results, err := runResults(job)
+	if err != nil || results == nil {
+		return err
+	}
+	finished, _ := finishedAt(job)
+
+	run := HistoryRun{UID: string(job.UID), Run: job.Name, Time: finished.UTC(), Outcomes: historyOutcomes(results)}
+
+	suite := job.Labels[suiteLabel]
+	if err := appendHistory(job.Namespace, suite, run); err != nil {
+		return err
+	}
+
+	return refreshHistoryDay(ctx, store, job.Namespace, suite, run.Time.Format(time.DateOnly))
+}
+
+// recordTestHistory records the outcomes of finished runs of suites and labels the runs
+// with historyLabel. Sharded runs wait for the Job merging their reports.
+func recordTestHistory(ctx context.Context, clientset *kubernetes.Clientset, informers *runInformers, store *resultsStore, namespace string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		jobs, err := informers.runs(ctx, namespace, runsSelector+","+suiteLabel+",!"+historyLabel+",!"+reportMergeLabel)
+		if err != nil {
+			log.Printf("cannot list runs to record in the test history: %v", err)
+			continue
+		}
+
+		for i := range jobs {
+			job := &jobs[i]
+			if state := jobState(job); state != jobStateSucceeded && state != jobStateFailed {
+				continue
+			}
+
+			if err := recordHistory(ctx, store, job); err != nil {
+				log.Printf("cannot record run %s/%s in the test history: %v", job.Namespace, job.Name, err)
+				continue
+			}
+
+			patch, _ := json.Marshal(map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": map[string]interface{}{historyLabel: "true"},
+				},
+			})
+			if _, err := clientset.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+				log.Printf("cannot label run %s/%s: %v", job.Namespace, job.Name, err)
+			}
+		}
+	}
+}
+
+// FlakyTest is a test that alternated between passing and failing. Flips counts the
+// changes between passed and failed from one run to the next, Flaky the runs it only
+// passed on a retry. Outcomes are its statuses, the oldest first.
+type FlakyTest struct {
+	File     string   `json:"file"`
+	Title    string   `json:"title"`
+	Project  string   `json:"project,omitempty"`
+	Runs     int      `json:"runs"`
+	Failed   int      `json:"failed"`
+	Flaky    int      `json:"flaky"`
+	Flips    int      `json:"flips"`
+	Rate     float64  `json:"rate"`
+	Outcomes []string `json:"outcomes"`
+}
+
+// FlakinessDay is the share of the test results of a day that were unstable: flaky, or
+// passed or failed unlike the run of the test before.
+type FlakinessDay struct {
+	Day  string  `json:"day"`
+	Rate float64 `json:"rate"`
+}
+
+type FlakyTestsResponse struct {
+	Namespace string         `json:"namespace"`
+	Suite     string         `json:"suite"`
+	Window    string         `json:"window"`
+	Runs      int            `json:"runs"`
+	Tests     []FlakyTest    `json:"tests"`
+	Trend     []FlakinessDay `json:"trend"`
+}
+
+// TestDay aggregates the outcomes of a test on a day. Unstable counts the results that
+// were flaky or flipped from the result before on the same day, First and Last are the
+// first and last status of the day with flaky counted as passed.
+type TestDay struct {
+	File     string   `json:"file"`
+	Title    string   `json:"title"`
+	Project  string   `json:"project,omitempty"`
+	Runs     int      `json:"runs"`
+	Failed   int      `json:"failed"`
+	Flaky    int      `json:"flaky"`
+	Flips    int      `json:"flips"`
+	Unstable int      `json:"unstable"`
+	First    string   `json:"first"`
+	Last     string   `json:"last"`
+	Outcomes []string `json:"outcomes"`
+}
+
+// HistoryDay is the daily aggregate of the history of a suite, refreshed from the runs
+// of the day whenever one is recorded, so flakiness over long windows reads one small
+// file per day instead of every run.
+type HistoryDay struct {
+	Day   string    `json:"day"`
+	Runs  int       `json:"runs"`
+	Tests []TestDay `json:"tests"`
+}
+
+func historyDayFile(root, namespace, suite, day string) string {
+	return filepath.Join(historyDir(root, namespace, suite), "days", day+".json")
+}
+
+// aggregateDay aggregates the runs of a day, the oldest first.
+func aggregateDay(day string, runs []HistoryRun) HistoryDay {
+	aggregate := HistoryDay{Day: day, Runs: len(runs), Tests: []TestDay{}}
+	index := map[testKey]int{}
+
+	for _, run := range runs {
+		for _, outcome := range run.Outcomes {
+			if outcome.Status != "passed" && outcome.Status != "failed" && outcome.Status != "flaky" {
+				continue
+			}
+			key := testKey{outcome.File, outcome.Title, outcome.Project}
+			i, ok := index[key]
+			if !ok {
+				i = len(aggregate.Tests)
+				index[key] = i
+				aggregate.Tests = append(aggregate.Tests, TestDay{File: outcome.File, Title: outcome.Title, Project: outcome.Project})
+			}
+			test := &aggregate.Tests[i]
+			test.Runs++
+			test.Outcomes = append(test.Outcomes, outcome.Status)
+
+			unstable := false
+			switch outcome.Status {
+			case "flaky":
+				test.Flaky++
+				unstable = true
+			case "failed":
+				test.Failed++
+			}
+			// flaky runs passed in the end
+			status := outcome.Status
+			if status == "flaky" {
+				status = "passed"
+			}
+			if test.Last != "" && test.Last != status {
+				test.Flips++
+				unstable = true
+			}
+			if test.First == "" {
+				test.First = status
+			}
+			test.Last = status
+			if unstable {
+				test.Unstable++
+			}
+		}
+	}
+
+	return aggregate
+}
+
+// refreshHistoryDay aggregates the runs of a suite that finished on a day again.
+func refreshHistoryDay(ctx context.Context, store *resultsStore, namespace, suite, day string) error {
+	start, err := time.Parse(time.DateOnly, day)
+	if err != nil {
+		return err
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	runs, err := readHistory(ctx, store, namespace, suite, start, start.AddDate(0, 0, 1).Add(-time.Nanosecond))
+	if err != nil {
+		return err
+	}
+
+	return writeHistoryDay(resultsDir, namespace, suite, aggregateDay(day, runs))
+}
+
+// writeHistoryDay writes the aggregate of a day, its callers hold historyMu.
+func writeHistoryDay(root, namespace, suite string, aggregate HistoryDay) error {
+	file := historyDayFile(root, namespace, suite, aggregate.Day)
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(file, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(aggregate)
+	})
+}
+
+// readHistoryDays returns the aggregates of the days from since to until, the oldest
+// first. Days without runs have none.
+func readHistoryDays(namespace, suite string, since, until time.Time) ([]HistoryDay, error) {
+	days := []HistoryDay{}
+	first := time.Date(since.UTC().Year(), since.UTC().Month(), since.UTC().Day(), 0, 0, 0, 0, time.UTC)
+	for day := first; !day.After(until); day = day.AddDate(0, 0, 1) {
+		data, err := os.ReadFile(historyDayFile(resultsDir, namespace, suite, day.Format(time.DateOnly)))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var aggregate HistoryDay
+		if err := json.Unmarshal(data, &aggregate); err != nil {
+			return nil, fmt.Errorf("aggregate of %s: %w", day.Format(time.DateOnly), err)
+		}
+		days = append(days, aggregate)
+	}
+
+	return days, nil
+}
+
+// aggregateHistory is the migration building the daily aggregates of the partitions of
+// the history of every suite.
+func aggregateHistory(root string) error {
+	files, err := filepath.Glob(filepath.Join(root, "history", "*", "*", "*.jsonl"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		suiteDir := filepath.Dir(file)
+		namespace, suite := filepath.Base(filepath.Dir(suiteDir)), filepath.Base(suiteDir)
+		runs, err := readPartition(file, time.Time{}, time.Time{})
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		sort.SliceStable(runs, func(i, j int) bool {
+			return runs[i].Time.Before(runs[j].Time)
+		})
+
+		byDay := map[string][]HistoryRun{}
+		for _, run := range runs {
+			day := run.Time.UTC().Format(time.DateOnly)
+			byDay[day] = append(byDay[day], run)
+		}
+		historyMu.Lock()
+		for day, runs := range byDay {
+			if err := writeHistoryDay(root, namespace, suite, aggregateDay(day, runs)); err != nil {
+				historyMu.Unlock()
+				return err
+			}
+		}
+		historyMu.Unlock()
+	}
+
+	return nil
+}
+
+// flakyTests finds the tests of the daily aggregates, the oldest first, that alternated
+// between passing and failing or passed on a retry, the flakiest first. Rate is the share
+// of the runs of a test that were unstable.
+func flakyTests(days []HistoryDay) ([]FlakyTest, []FlakinessDay) {
+	tests := map[testKey]*FlakyTest{}
+	previous := map[testKey]string{}
+	trend := []FlakinessDay{}
+
+	for _, day := range days {
+		results, unstable := 0, 0
+		for _, t := range day.Tests {
+			key := testKey{t.File, t.Title, t.Project}
+			test := tests[key]
+			if test == nil {
+				test = &FlakyTest{File: t.File, Title: t.Title, Project: t.Project}
+				tests[key] = test
+			}
+			test.Runs += t.Runs
+			test.Failed += t.Failed
+			test.Flaky += t.Flaky
+			test.Flips += t.Flips
+			test.Outcomes = append(test.Outcomes, t.Outcomes...)
+			results += t.Runs
+			unstable += t.Unstable
+
+			// the first result of the day flipped from the last of the days before, flaky
+			// ones are unstable anyway
+			if prev, ok := previous[key]; ok && prev != t.First {
+				test.Flips++
+				if len(t.Outcomes) > 0 && t.Outcomes[0] != "flaky" {
+					unstable++
+				}
+			}
+			previous[key] = t.Last
+		}
+		if results > 0 {
+			trend = append(trend, FlakinessDay{Day: day.Day, Rate: float64(unstable) / float64(results)})
+		}
+	}
+
+	flaky := []FlakyTest{}
+	for _, test := range tests {
+		if test.Flips == 0 && test.Flaky == 0 {
+			continue
+		}
+		test.Rate = float64(test.Flips+test.Flaky) / float64(test.Runs)
+		flaky = append(flaky, *test)
+	}
+	sort.Slice(flaky, func(i, j int) bool {
+		if flaky[i].Rate != flaky[j].Rate {
+			return flaky[i].Rate > flaky[j].Rate
+		}
+		return flaky[i].Title < flaky[j].Title
+	})
+
+	return flaky, trend
+}
+
+// historyQuery reads the namespace and suite parameters of history queries, writing the
+// error of invalid ones.
+func historyQuery(w http.ResponseWriter, query url.Values) (namespace, suite string, ok bool) {
+	namespace = getNamespace(query.Get("namespace"))
+	suite = query.Get("suite")
+	if suite == "" {
+		writeError(w, "suite parameter required", http.StatusBadRequest)
+		return "", "", false
+	}
+	// both name the history directory
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		writeError(w, fmt.Sprintf("invalid namespace %q", namespace), http.StatusBadRequest)
+		return "", "", false
+	}
+	if err := validateLabels(map[string]string{suiteLabel: suite}); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return "", "", false
+	}
+
+	return namespace, suite, true
+}
+
+// GET /tests/flaky?namespace=ns&suite=name&window=30d reports the tests of a suite that
+// alternated between passing and failing in the runs of the window, from the daily
+// aggregates of the days the window touches.
+func getFlakyTests(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	namespace, suite, ok := historyQuery(w, query)
+	if !ok {
+		return
+	}
+	window := query.Get("window")
+	if window == "" {
+		window = "30d"
+	}
+	d, err := parseWindow(window)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	days, err := readHistoryDays(namespace, suite, now.Add(-d), now)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	resp := FlakyTestsResponse{Namespace: namespace, Suite: suite, Window: window}
+	for _, day := range days {
+		resp.Runs += day.Runs
+	}
+	resp.Tests, resp.Trend = flakyTests(days)
+
+	respondJSON(w, resp)
+}
+
+type TestHistoryResponse struct {
+	Namespace string       `json:"namespace"`
+	Suite     string       `json:"suite"`
+	Runs      []HistoryRun `json:"runs"`
+}
+
+// GET /tests/history?namespace=ns&suite=name&since=30d&until=RFC3339 returns the test
+// outcomes of the runs of a suite, the oldest first. Since defaults to 30 days ago, ranges
+// beyond the hot window read the partitions archived to the results store.
+func getTestHistory(w http.ResponseWriter, r *http.Request, store *resultsStore) {
+	query := r.URL.Query()
+	namespace, suite, ok := historyQuery(w, query)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	since, until, err := parseTimeRange(query, now)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if since.IsZero() {
+		since = now.AddDate(0, 0, -30)
+	}
+	if until.IsZero() {
+		until = now
+	}
+
+	runs, err := readHistory(r.Context(), store, namespace, suite, since, until)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, TestHistoryResponse{Namespace: namespace, Suite: suite, Runs: runs})
+}
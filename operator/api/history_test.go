@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"shared/objectstore"
+)
+
+// fakeStore is a blob container of the results store in memory.
+func fakeStore(t *testing.T) (*resultsStore, map[string][]byte) {
+	t.Helper()
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = data
+		case http.MethodGet:
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(data)
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return &resultsStore{Store: &objectstore.Store{Provider: "azure", Endpoint: srv.URL, Bucket: "results", SASToken: "sig=test"}}, objects
+}
+
+func historyRun(uid string, finished time.Time, statuses ...string) HistoryRun {
+	run := HistoryRun{UID: uid, Run: "run-" + uid, Time: finished}
+	for i, status := range statuses {
+		run.Outcomes = append(run.Outcomes, TestOutcome{File: "login.spec.ts", Title: string(rune('a' + i)), Status: status})
+	}
+	return run
+}
+
+func TestHistoryPartitions(t *testing.T) {
+	useResultsDir(t)
+	january := time.Date(2026, time.January, 31, 23, 0, 0, 0, time.UTC)
+	february := time.Date(2026, time.February, 1, 1, 0, 0, 0, time.UTC)
+	for _, run := range []HistoryRun{historyRun("2", february, "failed"), historyRun("1", january, "passed")} {
+		if err := appendHistory("default", "smoke", run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, month := range []string{"2026-01", "2026-02"} {
+		if _, err := os.Stat(historyPartition(resultsDir, "default", "smoke", month)); err != nil {
+			t.Errorf("partition %s: %v", month, err)
+		}
+	}
+
+	runs, err := readHistory(context.Background(), nil, "default", "smoke", january.Add(-time.Hour), february)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].UID != "1" || runs[1].UID != "2" {
+		t.Fatalf("runs = %+v, want both, the oldest first", runs)
+	}
+
+	runs, err = readHistory(context.Background(), nil, "default", "smoke", february, february.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].UID != "2" {
+		t.Errorf("runs = %+v, want the one of February", runs)
+	}
+}
+
+func TestPartitionHistory(t *testing.T) {
+	dir := useResultsDir(t)
+	january := time.Date(2026, time.January, 10, 12, 0, 0, 0, time.UTC)
+	legacy := filepath.Join(dir, "history", "default", "smoke.jsonl")
+	if err := writePartition(legacy, []HistoryRun{
+		historyRun("1", january, "passed"),
+		historyRun("2", january.AddDate(0, 1, 0), "failed"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// an attempt that crashed moved the first run already
+	if err := writePartition(historyPartition(dir, "default", "smoke", "2026-01"), []HistoryRun{historyRun("1", january, "passed")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := partitionHistory(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("the history file of the suite is still there: %v", err)
+	}
+	runs, err := readHistory(context.Background(), nil, "default", "smoke", january.AddDate(0, 0, -1), january.AddDate(0, 2, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		t.Errorf("runs = %+v, want each run once", runs)
+	}
+}
+
+func TestArchivedHistoryIsReadFromTheStore(t *testing.T) {
+	useResultsDir(t)
+	store, objects := fakeStore(t)
+	old := time.Now().AddDate(-1, 0, 0)
+	month := old.UTC().Format(historyPartitionLayout)
+	if err := appendHistory("default", "smoke", historyRun("1", old, "passed")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := archivePartition(context.Background(), store, "default", "smoke", month); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(historyPartition(resultsDir, "default", "smoke", month)); !os.IsNotExist(err) {
+		t.Errorf("the archived partition is still on the volume: %v", err)
+	}
+	if _, ok := objects["/results/history/default/smoke/"+month+".jsonl.gz"]; !ok {
+		t.Fatalf("objects = %v, want the archived partition", objects)
+	}
+
+	// a run recorded late is merged with the archived ones
+	if err := appendHistory("default", "smoke", historyRun("2", old.Add(time.Minute), "failed")); err != nil {
+		t.Fatal(err)
+	}
+	runs, err := readHistory(context.Background(), store, "default", "smoke", old.Add(-time.Hour), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		data, _ := json.Marshal(runs)
+		t.Fatalf("runs = %s, want the archived and the late one", data)
+	}
+	if err := archivePartition(context.Background(), store, "default", "smoke", month); err != nil {
+		t.Fatal(err)
+	}
+	runs, err = readHistory(context.Background(), store, "default", "smoke", old.Add(-time.Hour), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		t.Errorf("runs = %+v, want both after archiving again", runs)
+	}
+}
+
+func TestFlakyTestsFromDailyAggregates(t *testing.T) {
+	useResultsDir(t)
+	monday := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+	tuesday := monday.AddDate(0, 0, 1)
+	// test a flips within both days, test b from one day to the next
+	runs := []HistoryRun{
+		historyRun("1", monday, "passed", "passed"),
+		historyRun("2", monday.Add(time.Hour), "failed"),
+		historyRun("3", tuesday, "failed", "failed"),
+		historyRun("4", tuesday.Add(time.Hour), "flaky"),
+		historyRun("5", tuesday.Add(2*time.Hour), "passed"),
+	}
+	for _, run := range runs {
+		if err := appendHistory("default", "smoke", run); err != nil {
+			t.Fatal(err)
+		}
+		if err := refreshHistoryDay(context.Background(), nil, "default", "smoke", run.Time.Format(time.DateOnly)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	days, err := readHistoryDays("default", "smoke", monday.Add(-time.Hour), tuesday.Add(3*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 2 || days[0].Runs != 2 || days[1].Runs != 3 {
+		t.Fatalf("days = %+v, want Monday with 2 runs and Tuesday with 3", days)
+	}
+
+	tests, trend := flakyTests(days)
+	if len(tests) != 2 {
+		t.Fatalf("tests = %+v, want a and b", tests)
+	}
+	byTitle := map[string]FlakyTest{}
+	for _, test := range tests {
+		byTitle[test.Title] = test
+	}
+	if a := byTitle["a"]; a.Runs != 5 || a.Failed != 2 || a.Flaky != 1 || a.Flips != 2 || a.Rate != 0.6 {
+		t.Errorf("a = %+v, want 5 runs, 2 failed, 1 flaky and 2 flips", a)
+	}
+	if b := byTitle["b"]; b.Runs != 2 || b.Flips != 1 {
+		t.Errorf("b = %+v, want the flip from Monday to Tuesday", b)
+	}
+	want := []FlakinessDay{{Day: "2026-03-02", Rate: 1.0 / 3}, {Day: "2026-03-03", Rate: 0.5}}
+	if len(trend) != 2 || trend[0] != want[0] || trend[1] != want[1] {
+		t.Errorf("trend = %+v, want %+v", trend, want)
+	}
+
+	// the migration builds the same aggregates from the partitions
+	if err := os.RemoveAll(filepath.Join(historyDir(resultsDir, "default", "smoke"), "days")); err != nil {
+		t.Fatal(err)
+	}
+	if err := aggregateHistory(resultsDir); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := readHistoryDays("default", "smoke", monday, tuesday)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := json.Marshal(rebuilt); string(got) != string(mustJSON(t, days)) {
+		t.Errorf("rebuilt aggregates = %s, want %s", got, mustJSON(t, days))
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// HistoryReparse is the progress of parsing the stored reports of the runs in the history
+// again, after a fix of the parser or a new field of TestOutcome. Runs whose reports are
+// gone keep their recorded outcomes and count as Missing.
+type HistoryReparse struct {
+	Namespace string    `json:"namespace"`
+	Suite     string    `json:"suite,omitempty"`
+	Since     time.Time `json:"since"`
+	Until     time.Time `json:"until"`
+	Running   bool      `json:"running"`
+	Total     int       `json:"total"`
+	Reparsed  int       `json:"reparsed"`
+	Missing   int       `json:"missing"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+var (
+	historyReparseMu sync.Mutex
+	// historyReparse is the latest re-parse, nil before the first.
+	historyReparse *HistoryReparse
+)
+
+func updateHistoryReparse(update func(*HistoryReparse)) {
+	historyReparseMu.Lock()
+	defer historyReparseMu.Unlock()
+	update(historyReparse)
+}
+
+// historySuites returns the suites of a namespace with a history.
+func historySuites(namespace string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(resultsDir, "history", namespace))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var suites []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			suites = append(suites, entry.Name())
+		}
+	}
+	return suites, nil
+}
+
+// storedRunJob stands in for the Job of a run in the history, which may be gone, to read
+// its stored reports with runResults. The shards of sharded runs are the shard-N
+// directories of their checkpoints and archived reports.
+func storedRunJob(namespace string, run HistoryRun) *batchv1.Job {
+	uid := types.UID(run.UID)
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: run.Run, UID: uid}}
+
+	shards := int32(0)
+	for _, dir := range []string{filepath.Join(resultsDir, "checkpoints", run.UID), rawReportDir(uid, nil)} {
+		matches, _ := filepath.Glob(filepath.Join(dir, "shard-*"))
+		for _, match := range matches {
+			if i, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(match), "shard-")); err == nil && int32(i) >= shards {
+				shards = int32(i) + 1
+			}
+		}
+	}
+	if shards > 0 {
+		mode := batchv1.IndexedCompletion
+		job.Spec.CompletionMode = &mode
+		job.Spec.Completions = &shards
+	}
+
+	return job
+}
+
+// reparseHistory parses the stored reports of the runs of the suites of a re-parse again
+// and replaces their outcomes in the partitions, then refreshes the aggregates of their
+// days.
+func reparseHistory(ctx context.Context, store *resultsStore, namespace string, suites []string, since, until time.Time) error {
+	runs := map[string][]HistoryRun{}
+	for _, suite := range suites {
+		suiteRuns, err := readHistory(ctx, store, namespace, suite, since, until)
+		if err != nil {
+			return fmt.Errorf("history of %s: %w", suite, err)
+		}
+		runs[suite] = suiteRuns
+		updateHistoryReparse(func(p *HistoryReparse) { p.Total += len(suiteRuns) })
+	}
+
+	for _, suite := range suites {
+		byMonth := map[string][]HistoryRun{}
+		days := map[string]bool{}
+		for _, run := range runs[suite] {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			results, err := runResults(storedRunJob(namespace, run))
+			if err != nil {
+				return fmt.Errorf("run %s of %s: %w", run.Run, suite, err)
+			}
+			if results == nil {
+				updateHistoryReparse(func(p *HistoryReparse) { p.Missing++ })
+				continue
+			}
+			run.Outcomes = historyOutcomes(results)
+			month := run.Time.UTC().Format(historyPartitionLayout)
+			byMonth[month] = append(byMonth[month], run)
+			days[run.Time.UTC().Format(time.DateOnly)] = true
+			updateHistoryReparse(func(p *HistoryReparse) { p.Reparsed++ })
+		}
+
+		for month, reparsed := range byMonth {
+			if err := rewritePartition(ctx, store, namespace, suite, month, reparsed); err != nil {
+				return fmt.Errorf("history of %s of %s: %w", suite, month, err)
+			}
+		}
+		for day := range days {
+			if err := refreshHistoryDay(ctx, store, namespace, suite, day); err != nil {
+				return fmt.Errorf("aggregate of %s of %s: %w", suite, day, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// rewritePartition replaces runs in the partition of a month. Archived partitions are
+// written to the volume whole and archived again, see archiveHistory.
+func rewritePartition(ctx context.Context, store *resultsStore, namespace, suite, month string, runs []HistoryRun) error {
+	start, err := time.Parse(historyPartitionLayout, month)
+	if err != nil {
+		return err
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	existing, err := readHistory(ctx, store, namespace, suite, start, start.AddDate(0, 1, 0).Add(-time.Nanosecond))
+	if err != nil {
+		return err
+	}
+
+	return writePartition(historyPartition(resultsDir, namespace, suite, month), mergeHistory(existing, runs))
+}
+
+// POST /admin/history/reparse?namespace=ns&suite=name&since=30d&until=RFC3339 parses the
+// stored reports of the runs in the history of a suite, or of every suite of the
+// namespace, again in the background. Since defaults to 30 days ago.
+// GET /admin/history/reparse reports the progress of the latest.
+func startHistoryReparse(w http.ResponseWriter, r *http.Request, store *resultsStore) {
+	query := r.URL.Query()
+	namespace := getNamespace(query.Get("namespace"))
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		writeError(w, fmt.Sprintf("invalid namespace %q", namespace), http.StatusBadRequest)
+		return
+	}
+	suites := []string{}
+	if suite := query.Get("suite"); suite != "" {
+		if err := validateLabels(map[string]string{suiteLabel: suite}); err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		suites = append(suites, suite)
+	} else {
+		var err error
+		if suites, err = historySuites(namespace); err != nil {
+			respondError(w, err)
+			return
+		}
+	}
+	now := time.Now()
+	since, until, err := parseTimeRange(query, now)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if since.IsZero() {
+		since = now.AddDate(0, 0, -30)
+	}
+	if until.IsZero() {
+		until = now
+	}
+
+	historyReparseMu.Lock()
+	if historyReparse != nil && historyReparse.Running {
+		historyReparseMu.Unlock()
+		writeError(w, "a re-parse of the history is running", http.StatusConflict)
+		return
+	}
+	historyReparse = &HistoryReparse{
+		Namespace: namespace,
+		Suite:     query.Get("suite"),
+		Since:     since.UTC(),
+		Until:     until.UTC(),
+		Running:   true,
+		Started:   now.UTC(),
+	}
+	progress := *historyReparse
+	historyReparseMu.Unlock()
+
+	// the re-parse outlives the request
+	ctx := context.WithoutCancel(r.Context())
+	go func() {
+		err := reparseHistory(ctx, store, namespace, suites, since, until)
+		if err != nil {
+			log.Printf("cannot re-parse the test history of %s: %v", namespace, err)
+		}
+		updateHistoryReparse(func(p *HistoryReparse) {
+			p.Running = false
+			p.Finished = time.Now().UTC()
+			if err != nil {
+				p.Error = err.Error()
+			}
+		})
+	}()
+
+	respondJSONStatus(w, http.StatusAccepted, progress)
+}
+
+func getHistoryReparse(w http.ResponseWriter, r *http.Request) {
+	historyReparseMu.Lock()
+	defer historyReparseMu.Unlock()
+	if historyReparse == nil {
+		writeError(w, "the history was not re-parsed yet", http.StatusNotFound)
+		return
+	}
+
+	respondJSON(w, *historyReparse)
+}
+
+// historyRetention is how long the test history is kept, from HISTORY_RETENTION like 400d.
+// It is kept forever without.
+func historyRetention() (time.Duration, error) {
+	v := os.Getenv("HISTORY_RETENTION")
+	if v == "" {
+		return 0, nil
+	}
+	d, err := parseWindow(v)
+	if err != nil {
+		return 0, fmt.Errorf("HISTORY_RETENTION: %w", err)
+	}
+
+	return d, nil
+}
+
+// historyExpired reports whether a partition ended before the retention.
+func historyExpired(month string, retention time.Duration, now time.Time) bool {
+	start, err := time.Parse(historyPartitionLayout, month)
+	return err == nil && start.AddDate(0, 1, 0).Before(now.Add(-retention))
+}
+
+// pruneHistory removes the partitions of the history, archived ones included, and the
+// daily aggregates of the months that ended before the retention.
+func pruneHistory(ctx context.Context, store *resultsStore, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		suiteDirs, err := filepath.Glob(filepath.Join(resultsDir, "history", "*", "*"))
+		if err != nil {
+			log.Printf("cannot list the test history: %v", err)
+			continue
+		}
+		for _, dir := range suiteDirs {
+			namespace, suite := filepath.Base(filepath.Dir(dir)), filepath.Base(dir)
+			for _, month := range historyMonthsOf(dir) {
+				if !historyExpired(month, retention, time.Now()) {
+					continue
+				}
+				if err := pruneHistoryMonth(ctx, store, namespace, suite, month); err != nil {
+					log.Printf("cannot remove the history of %s/%s of %s: %v", namespace, suite, month, err)
+				}
+			}
+		}
+	}
+}
+
+// historyMonthsOf returns the months of the partitions and daily aggregates of the history
+// of a suite, archived partitions keep the aggregates of their days on the volume.
+func historyMonthsOf(dir string) []string {
+	months := map[string]bool{}
+	partitions, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	for _, file := range partitions {
+		months[strings.TrimSuffix(filepath.Base(file), ".jsonl")] = true
+	}
+	days, _ := filepath.Glob(filepath.Join(dir, "days", "*.json"))
+	for _, file := range days {
+		if day := filepath.Base(file); len(day) >= len(historyPartitionLayout) {
+			months[day[:len(historyPartitionLayout)]] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(months))
+	for month := range months {
+		sorted = append(sorted, month)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func pruneHistoryMonth(ctx context.Context, store *resultsStore, namespace, suite, month string) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	// the archived partition goes first, the aggregates are how it is found again
+	if store != nil {
+		if err := store.delete(ctx, "history", historyArchiveKey(namespace, suite, month)); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(historyPartition(resultsDir, namespace, suite, month)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	days, err := filepath.Glob(filepath.Join(historyDir(resultsDir, namespace, suite), "days", month+"-*.json"))
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		if err := os.Remove(day); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
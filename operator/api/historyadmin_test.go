@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeJSONReport(t *testing.T, file, status string) {
+	t.Helper()
+	report := `{"suites": [{"title": "login.spec.ts", "specs": [{"title": "a", "file": "login.spec.ts", "tests": [{"projectName": "chromium", "status": "` + status + `"}]}]}]}`
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(report), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReparseHistory(t *testing.T) {
+	dir := useResultsDir(t)
+	finished := time.Now().UTC().Add(-time.Hour)
+	day := finished.Format(time.DateOnly)
+	// recorded before the project was part of the outcomes
+	for _, run := range []HistoryRun{historyRun(runningJobUID, finished, "passed"), historyRun(pinnedJobUID, finished.Add(time.Minute), "passed")} {
+		if err := appendHistory("default", "smoke", run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeJSONReport(t, filepath.Join(dir, "checkpoints", runningJobUID, "results.json"), "unexpected")
+	// the report of the second run is gone
+
+	historyReparse = &HistoryReparse{Running: true}
+	t.Cleanup(func() { historyReparse = nil })
+	if err := reparseHistory(context.Background(), nil, "default", []string{"smoke"}, finished.Add(-time.Hour), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if historyReparse.Total != 2 || historyReparse.Reparsed != 1 || historyReparse.Missing != 1 {
+		t.Errorf("progress = %+v, want 1 of 2 runs re-parsed and 1 missing", historyReparse)
+	}
+
+	runs, err := readHistory(context.Background(), nil, "default", "smoke", finished.Add(-time.Hour), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("runs = %+v, want both", runs)
+	}
+	if got := runs[0].Outcomes; len(got) != 1 || got[0].Status != "failed" || got[0].Project != "chromium" {
+		t.Errorf("outcomes = %+v, want the failure in chromium of the report", got)
+	}
+	if got := runs[1].Outcomes; len(got) != 1 || got[0].Status != "passed" {
+		t.Errorf("outcomes = %+v, want the recorded ones of the run without report", got)
+	}
+
+	days, err := readHistoryDays("default", "smoke", finished, finished)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 1 || days[0].Day != day || len(days[0].Tests) != 2 {
+		t.Errorf("days = %+v, want the aggregate of the re-parsed outcomes", days)
+	}
+}
+
+func TestPruneHistoryMonth(t *testing.T) {
+	dir := useResultsDir(t)
+	store, objects := fakeStore(t)
+	old := time.Date(2024, time.May, 3, 10, 0, 0, 0, time.UTC)
+	if err := appendHistory("default", "smoke", historyRun("1", old, "passed")); err != nil {
+		t.Fatal(err)
+	}
+	if err := refreshHistoryDay(context.Background(), nil, "default", "smoke", old.Format(time.DateOnly)); err != nil {
+		t.Fatal(err)
+	}
+	if err := archivePartition(context.Background(), store, "default", "smoke", "2024-05"); err != nil {
+		t.Fatal(err)
+	}
+
+	suiteDir := historyDir(dir, "default", "smoke")
+	months := historyMonthsOf(suiteDir)
+	if len(months) != 1 || months[0] != "2024-05" {
+		t.Fatalf("months = %v, want the archived one by its aggregates", months)
+	}
+	if !historyExpired("2024-05", 365*24*time.Hour, time.Date(2025, time.June, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Error("a month that ended more than a year ago is kept")
+	}
+	if historyExpired("2024-05", 365*24*time.Hour, time.Date(2025, time.May, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Error("a month that ended less than a year ago expires")
+	}
+
+	if err := pruneHistoryMonth(context.Background(), store, "default", "smoke", "2024-05"); err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 0 {
+		t.Errorf("objects = %v, want the archived partition removed", objects)
+	}
+	if months := historyMonthsOf(suiteDir); len(months) != 0 {
+		t.Errorf("months = %v, want none", months)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Extension points where the API calls the hooks of the settings.
+const (
+	// hookPreSchedule is called with the RunSpec before a run is created, it can change
+	// the spec or veto the run.
+	hookPreSchedule = "pre-schedule"
+	// hookPostComplete is called with the Job of a finished run, it can add annotations.
+	hookPostComplete = "post-complete"
+	// hookPreNotify is called with an alert before it is sent, it can change or drop it.
+	hookPreNotify = "pre-notify"
+)
+
+// Failure policies of a hook that fails, times out or answers garbage.
+const (
+	// hookFailOpen carries on as if the hook allowed the request unchanged.
+	hookFailOpen = "fail-open"
+	// hookFailClosed vetoes the request.
+	hookFailClosed = "fail-closed"
+)
+
+const (
+	// hooksLabel marks runs that wait for their post-complete hooks.
+	hooksLabel   = "playwright.operator/hooks"
+	hooksPending = "pending"
+
+	defaultHookTimeout = 5 * time.Second
+	maxHookTimeout     = 30 * time.Second
+)
+
+// Hook is an external HTTP endpoint called at an extension point. Hooks of a point are
+// called in order, each one sees the changes of the ones before.
+type Hook struct {
+	Point string `json:"point"`
+	URL   string `json:"url"`
+	// Timeout is a duration like "2s", 5s by default and at most 30s.
+	Timeout       string `json:"timeout,omitempty"`
+	FailurePolicy string `json:"failurePolicy,omitempty"`
+}
+
+func (h Hook) validate() error {
+	if h.Point != hookPreSchedule && h.Point != hookPostComplete && h.Point != hookPreNotify {
+		return fmt.Errorf("hook point must be %q, %q or %q", hookPreSchedule, hookPostComplete, hookPreNotify)
+	}
+	if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("hook url must be an http or https URL")
+	}
+	if h.Timeout != "" {
+		d, err := time.ParseDuration(h.Timeout)
+		if err != nil || d <= 0 || d > maxHookTimeout {
+			return fmt.Errorf("hook timeout must be a duration of at most %s", maxHookTimeout)
+		}
+	}
+	if h.FailurePolicy != "" && h.FailurePolicy != hookFailOpen && h.FailurePolicy != hookFailClosed {
+		return fmt.Errorf("hook failurePolicy must be %q or %q", hookFailOpen, hookFailClosed)
+	}
+
+	return nil
+}
+
+func (h Hook) timeout() time.Duration {
+	if d, err := time.ParseDuration(h.Timeout); err == nil && d > 0 {
+		return d
+	}
+
+	return defaultHookTimeout
+}
+
+// HookRequest is posted to a hook, with the field of its point set.
+type HookRequest struct {
+	Point string       `json:"point"`
+	Run   *RunSpec     `json:"run,omitempty"`
+	Job   *batchv1.Job `json:"job,omitempty"`
+	Alert *HookedAlert `json:"alert,omitempty"`
+}
+
+// HookedAlert is an alert on its way to a notification webhook.
+type HookedAlert struct {
+	// Source is "slo" or "monitors".
+	Source  string          `json:"source"`
+	Webhook string          `json:"webhook"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// HookResponse answers a HookRequest. A missing allowed allows the request, fields that
+// are not set leave it unchanged.
+type HookResponse struct {
+	Allowed *bool  `json:"allowed,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	// Run replaces the RunSpec of a pre-schedule hook.
+	Run *RunSpec `json:"run,omitempty"`
+	// Annotations are set on the run of a post-complete hook.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Payload replaces the alert of a pre-notify hook.
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// hookVetoError is returned when a hook rejects a request.
+type hookVetoError struct {
+	url    string
+	reason string
+}
+
+func (e *hookVetoError) Error() string {
+	if e.reason == "" {
+		return fmt.Sprintf("rejected by hook %s", e.url)
+	}
+	return fmt.Sprintf("rejected by hook %s: %s", e.url, e.reason)
+}
+
+// callHook posts a request to a hook. Failures are vetoes of fail-closed hooks and are
+// ignored by fail-open ones, which then answer with an empty response.
+func callHook(ctx context.Context, hook Hook, req HookRequest) (*HookResponse, error) {
+	resp, err := postHook(ctx, hook, req)
+	if err != nil {
+		if hook.FailurePolicy == hookFailClosed {
+			return nil, &hookVetoError{url: hook.URL, reason: err.Error()}
+		}
+		log.Printf("ignoring failed %s hook %s: %v", hook.Point, hook.URL, err)
+		return &HookResponse{}, nil
+	}
+	if resp.Allowed != nil && !*resp.Allowed {
+		return nil, &hookVetoError{url: hook.URL, reason: resp.Reason}
+	}
+
+	return resp, nil
+}
+
+func postHook(ctx context.Context, hook Hook, req HookRequest) (*HookResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hook.timeout())
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode >= 300 {
+		return nil, fmt.Errorf("hook answered %s", httpResp.Status)
+	}
+
+	var resp HookResponse
+	if httpResp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+			return nil, fmt.Errorf("invalid hook response: %w", err)
+		}
+	}
+
+	return &resp, nil
+}
+
+// hooksAt returns the hooks of an extension point in order.
+func (s Settings) hooksAt(point string) []Hook {
+	var hooks []Hook
+	for _, hook := range s.Hooks {
+		if hook.Point == point {
+			hooks = append(hooks, hook)
+		}
+	}
+
+	return hooks
+}
+
+// preScheduleHooks passes a run through the pre-schedule hooks and returns the spec to
+// create.
+func preScheduleHooks(ctx context.Context, settings Settings, spec RunSpec) (RunSpec, error) {
+	for _, hook := range settings.hooksAt(hookPreSchedule) {
+		resp, err := callHook(ctx, hook, HookRequest{Point: hookPreSchedule, Run: &spec})
+		if err != nil {
+			return spec, err
+		}
+		if resp.Run != nil {
+			// hooks change what runs, not where
+			namespace := spec.Namespace
+			spec = *resp.Run
+			spec.Namespace = namespace
+		}
+	}
+
+	return spec, nil
+}
+
+// notifyWebhook passes an alert through the pre-notify hooks and sends it, vetoed alerts
+// are dropped.
+func notifyWebhook(ctx context.Context, settings Settings, source, webhook string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("cannot encode alert for %s: %v", webhook, err)
+		return
+	}
+
+	for _, hook := range settings.hooksAt(hookPreNotify) {
+		resp, err := callHook(ctx, hook, HookRequest{
+			Point: hookPreNotify,
+			Alert: &HookedAlert{Source: source, Webhook: webhook, Payload: data},
+		})
+		if err != nil {
+			log.Printf("dropping %s alert: %v", source, err)
+			return
+		}
+		if len(resp.Payload) > 0 {
+			data = resp.Payload
+		}
+	}
+
+	postWebhook(ctx, webhook, json.RawMessage(data))
+}
+
+// addCompletionHooks marks a run to be passed to the post-complete hooks once it finished.
+func addCompletionHooks(job *batchv1.Job) {
+	if job.Labels == nil {
+		job.Labels = map[string]string{}
+	}
+	job.Labels[hooksLabel] = hooksPending
+}
+
+// runCompletionHooks passes finished runs to the post-complete hooks, sets the
+// annotations they answer with and drops the hooks label. Runs whose fail-closed hook
+// failed are passed to all hooks again on the next tick.
+func runCompletionHooks(ctx context.Context, clientset *kubernetes.Clientset, informers *runInformers, namespace string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		jobs, err := informers.runs(ctx, namespace, hooksLabel+"="+hooksPending)
+		if err != nil {
+			log.Printf("cannot list runs waiting for their hooks: %v", err)
+			continue
+		}
+		if len(jobs) == 0 {
+			continue
+		}
+
+		settings, err := effectiveSettings(ctx, clientset)
+		if err != nil {
+			log.Printf("cannot load settings: %v", err)
+			continue
+		}
+
+		for i := range jobs {
+			job := &jobs[i]
+			if state := jobState(job); state != jobStateSucceeded && state != jobStateFailed && state != jobStateCancelled {
+				continue
+			}
+
+			annotations := map[string]interface{}{}
+			failed := false
+			for _, hook := range settings.hooksAt(hookPostComplete) {
+				// a finished run cannot be vetoed, only failures of fail-closed hooks hold it back
+				resp, err := postHook(ctx, hook, HookRequest{Point: hookPostComplete, Job: job})
+				if err != nil && hook.FailurePolicy == hookFailClosed {
+					log.Printf("post-complete hook %s of run %s/%s failed, retrying: %v", hook.URL, job.Namespace, job.Name, err)
+					failed = true
+					break
+				}
+				if err != nil {
+					log.Printf("ignoring failed post-complete hook %s of run %s/%s: %v", hook.URL, job.Namespace, job.Name, err)
+					continue
+				}
+				for k, v := range resp.Annotations {
+					annotations[k] = v
+				}
+			}
+			if failed {
+				continue
+			}
+
+			metadata := map[string]interface{}{
+				"labels": map[string]interface{}{hooksLabel: nil},
+			}
+			if len(annotations) > 0 {
+				metadata["annotations"] = annotations
+			}
+			patch, _ := json.Marshal(map[string]interface{}{"metadata": metadata})
+			if _, err := clientset.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+				log.Printf("cannot annotate run %s/%s: %v", job.Namespace, job.Name, err)
+			}
+		}
+	}
+}
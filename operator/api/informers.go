@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// informerResync replays the caches to their handlers, which repairs handlers that
+	// missed an event.
+	informerResync = 10 * time.Minute
+	// informerIdleTimeout stops the informers of namespaces nobody asked about for as long.
+	informerIdleTimeout = 30 * time.Minute
+
+	podsByJobIndex = "job"
+)
+
+// runInformers shares informers of the runs and their pods per namespace, so listings,
+// details and the job watch read from a local cache instead of asking the API server on
+// every request. Runs are also kept in the indexed jobCache. Informers start with the
+// first request of a namespace and stop once it is idle, unless they are held.
+type runInformers struct {
+	clientset *kubernetes.Clientset
+	jobs      *jobCache
+
+	mu         sync.Mutex
+	namespaces map[string]*namespaceInformers
+}
+
+type namespaceInformers struct {
+	jobs cache.SharedIndexInformer
+	pods cache.SharedIndexInformer
+	// suppressions watches the ConfigMap of the suppression rules alone
+	suppressions cache.SharedIndexInformer
+	// updated is the time of the last event or resync in Unix nanoseconds
+	updated atomic.Int64
+	// used is the time of the last request in Unix nanoseconds, holders the number of
+	// handlers added outside of runInformers, which keep the informers running
+	used    atomic.Int64
+	holders int
+	stop    chan struct{}
+}
+
+func newRunInformers(clientset *kubernetes.Clientset) *runInformers {
+	return &runInformers{clientset: clientset, jobs: newJobCache(), namespaces: map[string]*namespaceInformers{}}
+}
+
+// namespace returns the informers of a namespace, starting them if needed.
+func (ri *runInformers) namespace(namespace string) *namespaceInformers {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+
+	return ri.namespaceLocked(namespace)
+}
+
+// hold returns the informers of a namespace and keeps them running until release is
+// called, for callers adding their own event handlers.
+func (ri *runInformers) hold(namespace string) (ni *namespaceInformers, release func()) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+
+	ni = ri.namespaceLocked(namespace)
+	ni.holders++
+	var once sync.Once
+
+	return ni, func() {
+		once.Do(func() {
+			ri.mu.Lock()
+			defer ri.mu.Unlock()
+			ni.holders--
+			ni.used.Store(time.Now().UnixNano())
+		})
+	}
+}
+
+func (ri *runInformers) namespaceLocked(namespace string) *namespaceInformers {
+	if ni, ok := ri.namespaces[namespace]; ok {
+		ni.used.Store(time.Now().UnixNano())
+		return ni
+	}
+	// runs of a stopped informer may still have come in after it was forgotten
+	ri.jobs.forget(namespace)
+
+	jobs := informers.NewSharedInformerFactoryWithOptions(ri.clientset, informerResync,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = runsSelector
+		}))
+	pods := informers.NewSharedInformerFactoryWithOptions(ri.clientset, informerResync,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = batchv1.JobNameLabel
+		}))
+	configMaps := informers.NewSharedInformerFactoryWithOptions(ri.clientset, informerResync,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = "metadata.name=" + suppressionConfigMap
+		}))
+
+	ni := &namespaceInformers{
+		jobs:         jobs.Batch().V1().Jobs().Informer(),
+		pods:         pods.Core().V1().Pods().Informer(),
+		suppressions: configMaps.Core().V1().ConfigMaps().Informer(),
+		stop:         make(chan struct{}),
+	}
+	ni.used.Store(time.Now().UnixNano())
+	ni.pods.AddIndexers(cache.Indexers{podsByJobIndex: func(obj interface{}) ([]string, error) {
+		if pod, ok := obj.(*corev1.Pod); ok {
+			return []string{pod.Labels[batchv1.JobNameLabel]}, nil
+		}
+		return nil, nil
+	}})
+
+	touch := func() { ni.updated.Store(time.Now().UnixNano()) }
+	freshness := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { touch() },
+		UpdateFunc: func(_, _ interface{}) { touch() },
+		DeleteFunc: func(interface{}) { touch() },
+	}
+	ni.jobs.AddEventHandler(ri.jobs)
+	ni.jobs.AddEventHandler(freshness)
+	ni.pods.AddEventHandler(freshness)
+
+	jobs.Start(ni.stop)
+	pods.Start(ni.stop)
+	configMaps.Start(ni.stop)
+	ri.namespaces[namespace] = ni
+
+	return ni
+}
+
+// stopIdle stops the informers of namespaces that were not asked about since idle ago and
+// are not held, and drops their runs from the jobCache. The next request starts them again.
+func (ri *runInformers) stopIdle(idle time.Duration) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+
+	cutoff := time.Now().Add(-idle).UnixNano()
+	for namespace, ni := range ri.namespaces {
+		if ni.holders > 0 || ni.used.Load() > cutoff {
+			continue
+		}
+		close(ni.stop)
+		delete(ri.namespaces, namespace)
+		ri.jobs.forget(namespace)
+	}
+}
+
+// stopIdleInformers stops the informers of idle namespaces every interval, so browsing
+// many namespaces does not keep a watch on each of them.
+func stopIdleInformers(ctx context.Context, ri *runInformers, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ri.stopIdle(informerIdleTimeout)
+		}
+	}
+}
+
+// synced returns the informers of a namespace once they listed it.
+func (ri *runInformers) synced(ctx context.Context, namespace string) (*namespaceInformers, error) {
+	ni := ri.namespace(namespace)
+	if !cache.WaitForCacheSync(ctx.Done(), ni.jobs.HasSynced, ni.pods.HasSynced, ni.suppressions.HasSynced) {
+		return nil, fmt.Errorf("cache of namespace %q did not sync", namespace)
+	}
+
+	return ni, nil
+}
+
+// runs returns copies of the cached runs of a namespace matching a label selector, newest
+// first, for handlers and loops that would otherwise list the Jobs of the API server.
+func (ri *runInformers) runs(ctx context.Context, namespace, selector string) ([]batchv1.Job, error) {
+	query := jobQuery{}
+	if selector != "" {
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			return nil, err
+		}
+		query.selector = parsed
+	}
+	if _, err := ri.synced(ctx, namespace); err != nil {
+		return nil, err
+	}
+
+	return ri.jobs.list(namespace, query), nil
+}
+
+// job returns a copy of a cached run, or nil.
+func (ni *namespaceInformers) job(namespace, name string) *batchv1.Job {
+	obj, ok, _ := ni.jobs.GetIndexer().GetByKey(namespace + "/" + name)
+	if !ok {
+		return nil
+	}
+
+	return obj.(*batchv1.Job).DeepCopy()
+}
+
+// podsOf returns copies of the cached pods of a Job.
+func (ni *namespaceInformers) podsOf(job string) []corev1.Pod {
+	objs, _ := ni.pods.GetIndexer().ByIndex(podsByJobIndex, job)
+	return copyPods(objs)
+}
+
+// allPods returns copies of the cached pods of all Jobs.
+func (ni *namespaceInformers) allPods() []corev1.Pod {
+	return copyPods(ni.pods.GetStore().List())
+}
+
+func copyPods(objs []interface{}) []corev1.Pod {
+	pods := make([]corev1.Pod, 0, len(objs))
+	for _, obj := range objs {
+		if pod, ok := obj.(*corev1.Pod); ok {
+			pods = append(pods, *pod.DeepCopy())
+		}
+	}
+
+	return pods
+}
+
+// setFreshness tells clients how current a cached answer is: X-Cache-Resource-Version
+// is the resource version the runs are synced to, X-Cache-Updated the time of the last
+// change or resync.
+func (ni *namespaceInformers) setFreshness(w http.ResponseWriter) {
+	w.Header().Set("X-Cache-Resource-Version", ni.jobs.LastSyncResourceVersion())
+	if updated := ni.updated.Load(); updated > 0 {
+		w.Header().Set("X-Cache-Updated", time.Unix(0, updated).UTC().Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// emptyClusterServer answers lists of Jobs, Pods and ConfigMaps with no items and keeps
+// watches open.
+func emptyClusterServer(t *testing.T) *kubernetes.Clientset {
+	t.Helper()
+	closing := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("watch") == "true" {
+			select {
+			case <-r.Context().Done():
+			case <-closing:
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		meta := metav1.ListMeta{ResourceVersion: "1"}
+		if strings.HasSuffix(r.URL.Path, "/jobs") {
+			json.NewEncoder(w).Encode(batchv1.JobList{TypeMeta: metav1.TypeMeta{APIVersion: "batch/v1", Kind: "JobList"}, ListMeta: meta})
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/configmaps") {
+			json.NewEncoder(w).Encode(corev1.ConfigMapList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMapList"}, ListMeta: meta})
+			return
+		}
+		json.NewEncoder(w).Encode(corev1.PodList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "PodList"}, ListMeta: meta})
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(closing) })
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return clientset
+}
+
+func TestIdleInformersStop(t *testing.T) {
+	ri := newRunInformers(emptyClusterServer(t))
+	hour := time.Now().Add(-time.Hour).UnixNano()
+
+	idle := ri.namespace("idle")
+	ri.jobs.OnAdd(&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "idle", Name: "e2e", UID: "1"}}, false)
+	idle.used.Store(hour)
+	held, release := ri.hold("held")
+	held.used.Store(hour)
+	ri.namespace("recent")
+
+	ri.stopIdle(informerIdleTimeout)
+
+	ri.mu.Lock()
+	_, idleRunning := ri.namespaces["idle"]
+	_, heldRunning := ri.namespaces["held"]
+	_, recentRunning := ri.namespaces["recent"]
+	ri.mu.Unlock()
+	if idleRunning || !heldRunning || !recentRunning {
+		t.Errorf("running idle=%v held=%v recent=%v, want only the idle informers stopped", idleRunning, heldRunning, recentRunning)
+	}
+	select {
+	case <-idle.stop:
+	default:
+		t.Error("the informers of an idle namespace keep watching")
+	}
+	if jobs := ri.jobs.list("idle", jobQuery{}); len(jobs) != 0 {
+		t.Errorf("the runs of a stopped namespace stay cached: %d", len(jobs))
+	}
+
+	release()
+	release()
+	held.used.Store(hour)
+	ri.stopIdle(informerIdleTimeout)
+	if ni := ri.namespace("held"); ni == held {
+		t.Error("released informers keep running once idle")
+	}
+}
+
+func TestStatsAndSuppressionsComeFromTheInformers(t *testing.T) {
+	rules := `[{"id": "a", "pattern": "^a$", "reason": "known", "expires": "` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}]`
+	var mu sync.Mutex
+	var lists []string
+	closing := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("watch") == "true" {
+			select {
+			case <-r.Context().Done():
+			case <-closing:
+			}
+			return
+		}
+		mu.Lock()
+		lists = append(lists, r.URL.Path+"?"+r.URL.RawQuery)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		meta := metav1.ListMeta{ResourceVersion: "1"}
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/jobs"):
+			json.NewEncoder(w).Encode(batchv1.JobList{TypeMeta: metav1.TypeMeta{APIVersion: "batch/v1", Kind: "JobList"}, ListMeta: meta, Items: []batchv1.Job{
+				{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "e2e-1", UID: "1", Labels: map[string]string{suiteLabel: "e2e"}, CreationTimestamp: metav1.Now()},
+					Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}}},
+			}})
+		case strings.HasSuffix(r.URL.Path, "/configmaps"):
+			json.NewEncoder(w).Encode(corev1.ConfigMapList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMapList"}, ListMeta: meta, Items: []corev1.ConfigMap{
+				{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: suppressionConfigMap}, Data: map[string]string{suppressionKey: rules}},
+			}})
+		default:
+			json.NewEncoder(w).Encode(corev1.PodList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "PodList"}, ListMeta: meta})
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(closing) })
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	informers := newRunInformers(clientset)
+
+	for range 3 {
+		got, err := cachedSuppressions(context.Background(), informers, "shop")
+		if err != nil || len(got) != 1 || got[0].Reason != "known" {
+			t.Fatalf("cachedSuppressions() = %+v, %v", got, err)
+		}
+		rec := httptest.NewRecorder()
+		statusStats(rec, httptest.NewRequest(http.MethodGet, "/stats/status?namespace=shop", nil), informers)
+		if !strings.Contains(rec.Body.String(), `"succeeded": 1`) {
+			t.Fatalf("/stats/status = %s", rec.Body.String())
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(lists) != 3 {
+		t.Errorf("requests to the API server %v, want one list each of Jobs, Pods and the suppressions", lists)
+	}
+	for _, list := range lists {
+		if strings.HasSuffix(strings.SplitN(list, "?", 2)[0], "/configmaps") && !strings.Contains(list, "metadata.name%3D"+suppressionConfigMap) {
+			t.Errorf("the informer lists all ConfigMaps: %s", list)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/btree"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// jobCache keeps Jobs in memory, sharded by namespace so writers of one namespace never
+// block readers of another. Every shard indexes its Jobs by label, by state and by
+// creation time, which keeps filtered and sorted listings cheap on large clusters.
+//
+// The cache is fed through OnAdd, OnUpdate and OnDelete, matching the informer event
+// handler interface.
+type jobCache struct {
+	mu     sync.RWMutex
+	shards map[string]*jobShard
+
+	lookups atomic.Uint64
+}
+
+type jobShard struct {
+	mu      sync.RWMutex
+	jobs    map[types.UID]*batchv1.Job
+	byLabel map[string]map[types.UID]struct{}
+	byState map[string]map[types.UID]struct{}
+	// byCreation is ordered newest first, see newerJob
+	byCreation *btree.BTreeG[*batchv1.Job]
+}
+
+// jobQuery selects Jobs of a cache shard, zero values match everything. selector and
+// fields are the labelSelector and fieldSelector of the request, search the lower case
+// part of the name, see parseJobFilter.
+type jobQuery struct {
+	labels   map[string]string
+	selector labels.Selector
+	fields   fields.Selector
+	state    string
+	since    time.Time
+	until    time.Time
+	search   string
+}
+
+// matches checks a Job against the query without the indexes of a shard.
+func (q jobQuery) matches(job *batchv1.Job) bool {
+	for k, v := range q.labels {
+		if job.Labels[k] != v {
+			return false
+		}
+	}
+	if q.state != "" && jobState(job) != q.state {
+		return false
+	}
+	created := job.CreationTimestamp.Time
+	if (!q.since.IsZero() && created.Before(q.since)) || (!q.until.IsZero() && created.After(q.until)) {
+		return false
+	}
+
+	return q.matchesSelectors(job)
+}
+
+// matchesSelectors checks the label and field selectors and the name search, which have
+// no index.
+func (q jobQuery) matchesSelectors(job *batchv1.Job) bool {
+	if q.search != "" && !strings.Contains(strings.ToLower(job.Name), q.search) {
+		return false
+	}
+	if q.selector != nil && !q.selector.Matches(labels.Set(job.Labels)) {
+		return false
+	}
+	return q.fields == nil || q.fields.Matches(jobFields(job))
+}
+
+// JobCacheStats describes the size and use of the cache.
+type JobCacheStats struct {
+	Shards  int    `json:"shards"`
+	Jobs    int    `json:"jobs"`
+	Lookups uint64 `json:"lookups"`
+}
+
+func newJobCache() *jobCache {
+	return &jobCache{shards: map[string]*jobShard{}}
+}
+
+func newJobShard() *jobShard {
+	return &jobShard{
+		jobs:    map[types.UID]*batchv1.Job{},
+		byLabel: map[string]map[types.UID]struct{}{},
+		byState: map[string]map[types.UID]struct{}{},
+		// updates and deletes find their Job in O(log n) instead of shifting a slice
+		byCreation: btree.NewG(32, newerJob),
+	}
+}
+
+// newerJob orders Jobs newest first and Jobs created in the same second by UID, so the
+// creation index and listings driven by another index agree on the order.
+func newerJob(a, b *batchv1.Job) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.After(b.CreationTimestamp.Time)
+	}
+	return a.UID < b.UID
+}
+
+func (c *jobCache) shard(namespace string, create bool) *jobShard {
+	c.mu.RLock()
+	s := c.shards[namespace]
+	c.mu.RUnlock()
+	if s != nil || !create {
+		return s
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s = c.shards[namespace]; s == nil {
+		s = newJobShard()
+		c.shards[namespace] = s
+	}
+
+	return s
+}
+
+func (c *jobCache) OnAdd(obj interface{}, _ bool) {
+	if job, ok := obj.(*batchv1.Job); ok {
+		c.shard(job.Namespace, true).put(job)
+	}
+}
+
+func (c *jobCache) OnUpdate(_, obj interface{}) {
+	c.OnAdd(obj, false)
+}
+
+func (c *jobCache) OnDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if job, ok := obj.(*batchv1.Job); ok {
+		if s := c.shard(job.Namespace, false); s != nil {
+			s.remove(job.UID)
+		}
+	}
+}
+
+// forget drops the Jobs of a namespace, whose informer stopped.
+func (c *jobCache) forget(namespace string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.shards, namespace)
+}
+
+// list returns copies of the matching Jobs of a namespace, or of all namespaces for "",
+// newest first.
+func (c *jobCache) list(namespace string, q jobQuery) []batchv1.Job {
+	return copyJobs(c.refs(namespace, q))
+}
+
+// refs returns the matching Jobs like list, but the cached Jobs themselves, which callers
+// must not modify. Listings sort and page them and copy only the page they return.
+func (c *jobCache) refs(namespace string, q jobQuery) []*batchv1.Job {
+	c.lookups.Add(1)
+
+	var shards []*jobShard
+	c.mu.RLock()
+	if namespace == "" {
+		for _, s := range c.shards {
+			shards = append(shards, s)
+		}
+	} else if s := c.shards[namespace]; s != nil {
+		shards = append(shards, s)
+	}
+	c.mu.RUnlock()
+
+	var jobs []*batchv1.Job
+	for _, s := range shards {
+		jobs = append(jobs, s.list(q)...)
+	}
+	if len(shards) > 1 {
+		sort.Slice(jobs, func(i, j int) bool { return newerJob(jobs[i], jobs[j]) })
+	}
+
+	return jobs
+}
+
+func copyJobs(refs []*batchv1.Job) []batchv1.Job {
+	if refs == nil {
+		return nil
+	}
+	jobs := make([]batchv1.Job, len(refs))
+	for i, job := range refs {
+		job.DeepCopyInto(&jobs[i])
+	}
+
+	return jobs
+}
+
+func (c *jobCache) stats() JobCacheStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	stats := JobCacheStats{Shards: len(c.shards), Lookups: c.lookups.Load()}
+	for _, s := range c.shards {
+		s.mu.RLock()
+		stats.Jobs += len(s.jobs)
+		s.mu.RUnlock()
+	}
+
+	return stats
+}
+
+func (s *jobShard) put(job *batchv1.Job) {
+	job = job.DeepCopy()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeLocked(job.UID)
+	s.jobs[job.UID] = job
+	for k, v := range job.Labels {
+		addIndex(s.byLabel, k+"="+v, job.UID)
+	}
+	addIndex(s.byState, jobState(job), job.UID)
+	s.byCreation.ReplaceOrInsert(job)
+}
+
+func (s *jobShard) remove(uid types.UID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeLocked(uid)
+}
+
+func (s *jobShard) removeLocked(uid types.UID) {
+	job, ok := s.jobs[uid]
+	if !ok {
+		return
+	}
+
+	delete(s.jobs, uid)
+	for k, v := range job.Labels {
+		removeIndex(s.byLabel, k+"="+v, uid)
+	}
+	removeIndex(s.byState, jobState(job), uid)
+	s.byCreation.Delete(job)
+}
+
+// list walks the span of the creation index between until and since and checks every Job
+// against the label and state indexes and the selectors. When the span holds more Jobs
+// than the smallest matching index, it walks and sorts that index instead.
+func (s *jobShard) list(q jobQuery) []*batchv1.Job {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var filters []map[types.UID]struct{}
+	for k, v := range q.labels {
+		filters = append(filters, s.byLabel[k+"="+v])
+	}
+	if q.state != "" {
+		filters = append(filters, s.byState[q.state])
+	}
+	smallest := -1
+	for i, f := range filters {
+		if smallest < 0 || len(f) < len(filters[smallest]) {
+			smallest = i
+		}
+	}
+	if smallest >= 0 && len(filters[smallest]) == 0 {
+		return nil
+	}
+
+	var jobs []*batchv1.Job
+	walked, complete := 0, true
+	s.window(q, func(job *batchv1.Job) bool {
+		if walked++; smallest >= 0 && walked > len(filters[smallest]) {
+			complete = false
+			return false
+		}
+		for _, f := range filters {
+			if _, ok := f[job.UID]; !ok {
+				return true
+			}
+		}
+		if q.matchesSelectors(job) {
+			jobs = append(jobs, job)
+		}
+		return true
+	})
+	if complete {
+		return jobs
+	}
+
+	jobs = jobs[:0]
+	for uid := range filters[smallest] {
+		if job := s.jobs[uid]; q.matches(job) {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return newerJob(jobs[i], jobs[j]) })
+
+	return jobs
+}
+
+// window visits the Jobs created between until and since newest first, until visit
+// returns false.
+func (s *jobShard) window(q jobQuery, visit func(*batchv1.Job) bool) {
+	walk := func(job *batchv1.Job) bool {
+		if !q.since.IsZero() && job.CreationTimestamp.Time.Before(q.since) {
+			// the index is ordered newest first, everything after is older
+			return false
+		}
+		return visit(job)
+	}
+	if q.until.IsZero() {
+		s.byCreation.Ascend(walk)
+		return
+	}
+
+	// without a UID the pivot orders before every Job created at until
+	pivot := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(q.until)}}
+	s.byCreation.AscendGreaterOrEqual(pivot, walk)
+}
+
+func addIndex(index map[string]map[types.UID]struct{}, key string, uid types.UID) {
+	if index[key] == nil {
+		index[key] = map[types.UID]struct{}{}
+	}
+	index[key][uid] = struct{}{}
+}
+
+func removeIndex(index map[string]map[types.UID]struct{}, key string, uid types.UID) {
+	delete(index[key], uid)
+	if len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
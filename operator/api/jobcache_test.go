@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+func cachedJob(namespace, name string, created time.Time, labels map[string]string) *batchv1.Job {
+	return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Namespace:         namespace,
+		Name:              name,
+		UID:               types.UID(namespace + "/" + name),
+		CreationTimestamp: metav1.NewTime(created),
+		Labels:            labels,
+	}}
+}
+
+func TestJobCache(t *testing.T) {
+	now := time.Now()
+	c := newJobCache()
+	c.OnAdd(cachedJob("tests", "old", now.Add(-time.Hour), map[string]string{suiteLabel: "smoke"}), false)
+	c.OnAdd(cachedJob("tests", "new", now, map[string]string{suiteLabel: "smoke"}), false)
+	c.OnAdd(cachedJob("tests", "other", now.Add(-time.Minute), map[string]string{suiteLabel: "nightly"}), false)
+	c.OnAdd(cachedJob("staging", "run", now.Add(-2*time.Minute), nil), false)
+
+	names := func(jobs []batchv1.Job) []string {
+		var out []string
+		for _, job := range jobs {
+			out = append(out, job.Name)
+		}
+		return out
+	}
+	if got := names(c.list("tests", jobQuery{labels: map[string]string{suiteLabel: "smoke"}})); len(got) != 2 || got[0] != "new" || got[1] != "old" {
+		t.Errorf("list() of the suite = %v, want new and old", got)
+	}
+	if got := names(c.list("", jobQuery{since: now.Add(-5 * time.Minute)})); len(got) != 3 || got[2] != "run" {
+		t.Errorf("list() of all namespaces = %v, want new, other and run", got)
+	}
+
+	// a relabelled Job leaves the index of its old label
+	c.OnUpdate(nil, cachedJob("tests", "old", now.Add(-time.Hour), map[string]string{suiteLabel: "nightly"}))
+	if got := names(c.list("tests", jobQuery{labels: map[string]string{suiteLabel: "smoke"}})); len(got) != 1 {
+		t.Errorf("list() after the update = %v, want new", got)
+	}
+
+	c.OnDelete(cachedJob("tests", "new", now, nil))
+	// deletes the informer missed arrive as tombstones
+	c.OnDelete(cache.DeletedFinalStateUnknown{Key: "staging/run", Obj: cachedJob("staging", "run", now.Add(-2*time.Minute), nil)})
+	if got := names(c.list("", jobQuery{})); len(got) != 2 || got[0] != "other" || got[1] != "old" {
+		t.Errorf("list() after the deletes = %v, want other and old", got)
+	}
+
+	if stats := c.stats(); stats.Shards != 2 || stats.Jobs != 2 || stats.Lookups != 4 {
+		t.Errorf("stats() = %+v, want 2 shards, 2 jobs and 4 lookups", stats)
+	}
+}
+
+func TestJobCacheQueryPlans(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	c := newJobCache()
+	for i := range 100 {
+		c.OnAdd(cachedJob("tests", fmt.Sprintf("nightly-%02d", i), now.Add(-time.Duration(i)*time.Minute), map[string]string{suiteLabel: "nightly"}), false)
+	}
+	// Jobs created in the same second keep their order whichever index drives the listing
+	c.OnAdd(cachedJob("tests", "smoke-b", now.Add(-30*time.Minute), map[string]string{suiteLabel: "smoke"}), false)
+	c.OnAdd(cachedJob("tests", "smoke-a", now.Add(-30*time.Minute), map[string]string{suiteLabel: "smoke"}), false)
+	c.OnAdd(cachedJob("tests", "smoke-c", now.Add(-90*time.Minute), map[string]string{suiteLabel: "smoke"}), false)
+
+	names := func(jobs []*batchv1.Job) string {
+		var out []string
+		for _, job := range jobs {
+			out = append(out, job.Name)
+		}
+		return strings.Join(out, " ")
+	}
+	for _, tc := range []struct {
+		name  string
+		query jobQuery
+		want  string
+	}{
+		{"smallest index", jobQuery{labels: map[string]string{suiteLabel: "smoke"}}, "smoke-a smoke-b smoke-c"},
+		{"smallest index within the window", jobQuery{labels: map[string]string{suiteLabel: "smoke"}, since: now.Add(-time.Hour)}, "smoke-a smoke-b"},
+		{"window", jobQuery{labels: map[string]string{suiteLabel: "nightly"}, since: now.Add(-31 * time.Minute), until: now.Add(-29 * time.Minute)}, "nightly-29 nightly-30 nightly-31"},
+		{"window of the same second", jobQuery{until: now.Add(-30 * time.Minute), since: now.Add(-30 * time.Minute)}, "nightly-30 smoke-a smoke-b"},
+		{"empty index", jobQuery{labels: map[string]string{suiteLabel: "smoke"}, state: jobStateFailed}, ""},
+	} {
+		if got := names(c.refs("tests", tc.query)); got != tc.want {
+			t.Errorf("%s: refs() = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	// updates keep a single entry in the creation index
+	for range 3 {
+		c.OnUpdate(nil, cachedJob("tests", "smoke-b", now.Add(-30*time.Minute), map[string]string{suiteLabel: "smoke"}))
+	}
+	if got := len(c.refs("tests", jobQuery{})); got != 103 {
+		t.Errorf("refs() after the updates = %d Jobs, want 103", got)
+	}
+
+	// list hands out copies, refs the cached Jobs
+	c.list("tests", jobQuery{labels: map[string]string{suiteLabel: "smoke"}})[0].Labels[suiteLabel] = "changed"
+	if got := c.refs("tests", jobQuery{labels: map[string]string{suiteLabel: "smoke"}}); len(got) != 3 || got[0].Labels[suiteLabel] != "smoke" {
+		t.Error("list() returned the cached Jobs")
+	}
+}
+
+func TestJobCacheCollector(t *testing.T) {
+	c := newJobCache()
+	c.OnAdd(cachedJob("tests", "run", time.Now(), nil), false)
+	c.list("tests", jobQuery{})
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(jobCacheCollector{cache: c})
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]float64{}
+	for _, family := range families {
+		m := family.GetMetric()[0]
+		if family.GetType() == dto.MetricType_COUNTER {
+			got[family.GetName()] = m.GetCounter().GetValue()
+		} else {
+			got[family.GetName()] = m.GetGauge().GetValue()
+		}
+	}
+	want := map[string]float64{"playwright_job_cache_shards": 1, "playwright_job_cache_jobs": 1, "playwright_job_cache_lookups_total": 1}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("%s = %v, want %v", name, got[name], value)
+		}
+	}
+}
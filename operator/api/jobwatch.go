@@ -0,0 +1,178 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"shared/shutdown"
+)
+
+const (
+	jobEventAdded   = "added"
+	jobEventUpdated = "updated"
+	jobEventDeleted = "deleted"
+
+	// jobWatchBuffer is the number of events a watcher may fall behind before it is dropped
+	jobWatchBuffer = 256
+)
+
+// JobEvent is a change of a run pushed to the watchers of /jobs/watch. Initial marks the
+// events of the runs that existed when the watch started.
+type JobEvent struct {
+	Type    string       `json:"type"`
+	Initial bool         `json:"initial,omitempty"`
+	Job     *batchv1.Job `json:"job"`
+	Summary JobSummary   `json:"summary"`
+}
+
+// jobWatcher hands the events of the shared run informers to the watchers of
+// /jobs/watch, so many open dashboards cost a single watch on the API server.
+type jobWatcher struct {
+	informers *runInformers
+}
+
+func newJobWatcher(informers *runInformers) *jobWatcher {
+	return &jobWatcher{informers: informers}
+}
+
+// subscribe sends the events of the runs of a namespace matching q to the returned channel,
+// starting with the existing runs. Runs that start or stop matching, like a run failing
+// with a status filter, are added or deleted. The channel is closed after unsubscribing or
+// when the watcher fell more than jobWatchBuffer events behind.
+func (jw *jobWatcher) subscribe(namespace string, q jobQuery) (<-chan JobEvent, func(), error) {
+	events := make(chan JobEvent, jobWatchBuffer)
+	var (
+		mu     sync.Mutex
+		closed bool
+	)
+	send := func(event JobEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case events <- event:
+		default:
+			closed = true
+			close(events)
+		}
+	}
+
+	ni, release := jw.informers.hold(namespace)
+	informer := ni.jobs
+	registration, err := informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, initial bool) {
+			if job, ok := obj.(*batchv1.Job); ok && q.matches(job) {
+				send(JobEvent{Type: jobEventAdded, Initial: initial, Job: job, Summary: summarizeJob(job)})
+			}
+		},
+		UpdateFunc: func(old, obj interface{}) {
+			job, ok := obj.(*batchv1.Job)
+			previous := old.(*batchv1.Job)
+			// resyncs replay unchanged runs
+			if !ok || job.ResourceVersion == previous.ResourceVersion {
+				return
+			}
+			switch matched, matches := q.matches(previous), q.matches(job); {
+			case matched && matches:
+				send(JobEvent{Type: jobEventUpdated, Job: job, Summary: summarizeJob(job)})
+			case matches:
+				send(JobEvent{Type: jobEventAdded, Job: job, Summary: summarizeJob(job)})
+			case matched:
+				send(JobEvent{Type: jobEventDeleted, Job: job, Summary: summarizeJob(job)})
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if job, ok := obj.(*batchv1.Job); ok && q.matches(job) {
+				send(JobEvent{Type: jobEventDeleted, Job: job, Summary: summarizeJob(job)})
+			}
+		},
+	})
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+
+	unsubscribe := func() {
+		if err := informer.RemoveEventHandler(registration); err != nil {
+			log.Printf("cannot remove job watch handler: %v", err)
+		}
+		release()
+		mu.Lock()
+		defer mu.Unlock()
+		if !closed {
+			closed = true
+			close(events)
+		}
+	}
+
+	return events, unsubscribe, nil
+}
+
+// GET /jobs/watch?namespace=ns&suite=name&labelSelector=k=v&fieldSelector=f=v&status=failed
+// upgrades to a WebSocket that receives a JSON
+// JobEvent for every run added, updated or deleted, starting with the existing runs.
+func watchJobs(w http.ResponseWriter, r *http.Request, jw *jobWatcher) {
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+	if namespace == "" {
+		writeError(w, "namespace is required", http.StatusBadRequest)
+		return
+	}
+	query, err := parseJobFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, unsubscribe, err := jw.subscribe(namespace, query)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	defer unsubscribe()
+
+	// the API is not called from browsers, the dashboard relays the events
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		// the deadlines of the server outlive the upgrade, the watch lasts as long as the client
+		ws.SetDeadline(time.Time{})
+
+		done := make(chan struct{})
+		go func() {
+			// the client sends nothing, reading only notices it went away
+			var discard []byte
+			for websocket.Message.Receive(ws, &discard) == nil {
+			}
+			close(done)
+		}()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-shutdown.Draining():
+				// the dashboard watches again, through another pod
+				return
+			case event, ok := <-events:
+				if !ok {
+					log.Printf("job watcher of namespace %s fell behind, closing", namespace)
+					return
+				}
+				ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				if err := websocket.JSON.Send(ws, event); err != nil {
+					return
+				}
+			}
+		}
+	}}
+	server.ServeHTTP(w, r)
+}
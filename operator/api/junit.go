@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// JUnit XML as read by Jenkins, GitLab and Azure Pipelines, with a testsuite per file and
+// project like the JUnit reporter of Playwright.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Hostname  string          `xml:"hostname,attr,omitempty"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name       string           `xml:"name,attr"`
+	Classname  string           `xml:"classname,attr"`
+	Time       string           `xml:"time,attr"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Failure    *junitMessage    `xml:"failure,omitempty"`
+	Error      *junitMessage    `xml:"error,omitempty"`
+	Skipped    *struct{}        `xml:"skipped,omitempty"`
+}
+
+type junitProperties struct {
+	Properties []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func junitSeconds(ms int64) string {
+	return strconv.FormatFloat(float64(ms)/1000, 'f', 3, 64)
+}
+
+// junitReport converts the results of a run. Flaky tests pass with a retries property,
+// errors outside of tests, like a crashed worker, are test cases of an extra suite.
+func junitReport(job *batchv1.Job, results *RunResults) junitTestSuites {
+	report := junitTestSuites{Name: job.Name}
+	timestamp := ""
+	if job.Status.StartTime != nil {
+		timestamp = job.Status.StartTime.UTC().Format(time.RFC3339)
+	}
+
+	index := map[string]int{}
+	durations := map[int]int64{}
+	var total int64
+	for _, spec := range results.Specs {
+		key := spec.File + "\x00" + spec.Project
+		i, ok := index[key]
+		if !ok {
+			i = len(report.Suites)
+			index[key] = i
+			report.Suites = append(report.Suites, junitTestSuite{Name: spec.File, Hostname: spec.Project, Timestamp: timestamp})
+		}
+		suite := &report.Suites[i]
+
+		tc := junitTestCase{Name: spec.Title, Classname: spec.File, Time: junitSeconds(spec.DurationMs)}
+		var properties []junitProperty
+		if spec.Retries > 0 {
+			properties = append(properties, junitProperty{Name: "retries", Value: strconv.Itoa(spec.Retries)})
+		}
+		for _, tag := range spec.Tags {
+			properties = append(properties, junitProperty{Name: "tag", Value: tag})
+		}
+		for _, a := range spec.Annotations {
+			properties = append(properties, junitProperty{Name: a.Type, Value: a.Description})
+		}
+		if len(properties) > 0 {
+			tc.Properties = &junitProperties{Properties: properties}
+		}
+
+		switch spec.Status {
+		case "failed":
+			text := strings.Join(spec.Errors, "\n\n")
+			message, _, _ := strings.Cut(text, "\n")
+			tc.Failure = &junitMessage{Message: message, Type: "FAILURE", Text: text}
+			suite.Failures++
+			report.Failures++
+		case "skipped":
+			tc.Skipped = &struct{}{}
+			suite.Skipped++
+			report.Skipped++
+		}
+		suite.Cases = append(suite.Cases, tc)
+		suite.Tests++
+		report.Tests++
+		durations[i] += spec.DurationMs
+		total += spec.DurationMs
+	}
+	for i := range report.Suites {
+		report.Suites[i].Time = junitSeconds(durations[i])
+	}
+
+	if len(results.Errors) > 0 {
+		suite := junitTestSuite{Name: "errors", Time: junitSeconds(0), Timestamp: timestamp}
+		for i, e := range results.Errors {
+			message, _, _ := strings.Cut(e, "\n")
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Name:      fmt.Sprintf("error %d", i+1),
+				Classname: "errors",
+				Time:      junitSeconds(0),
+				Error:     &junitMessage{Message: message, Type: "ERROR", Text: e},
+			})
+			suite.Tests++
+			suite.Errors++
+			report.Tests++
+			report.Errors++
+		}
+		report.Suites = append(report.Suites, suite)
+	}
+	report.Time = junitSeconds(total)
+
+	return report
+}
+
+// GET /runs/{id}/junit.xml?namespace=ns converts the results of a run by Job UID or name
+// to JUnit XML, for CI pipelines without access to the results volume.
+func getJUnitReport(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	job, err := findRun(r.Context(), clientset, getNamespace(r.URL.Query().Get("namespace")), r.PathValue("id"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if job == nil {
+		writeError(w, "run not found", http.StatusNotFound)
+		return
+	}
+
+	results, err := runResults(job)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if results == nil {
+		writeError(w, "the run has no results yet", http.StatusNotFound)
+		return
+	}
+
+	data, err := xml.MarshalIndent(junitReport(job, results), "", "  ")
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+	w.Write([]byte("\n"))
+}
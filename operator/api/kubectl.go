@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// KubectlCommand is a ready to paste kubectl invocation for a run or one of its pods.
+type KubectlCommand struct {
+	Description string `json:"description"`
+	Command     string `json:"command"`
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9@%+=:,./_-]+$`)
+
+// shellQuote quotes a word for POSIX shells unless it is safe as is.
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+func kubectl(args ...string) string {
+	words := []string{"kubectl"}
+	// KUBECTL_CONTEXT names this cluster in the kubeconfig of dashboard users
+	if context := os.Getenv("KUBECTL_CONTEXT"); context != "" {
+		words = append(words, "--context", context)
+	}
+	words = append(words, args...)
+
+	for i := range words {
+		words[i] = shellQuote(words[i])
+	}
+
+	return strings.Join(words, " ")
+}
+
+// kubectlHints returns commands to inspect a run from the command line. Exec is only
+// offered for running pods.
+func kubectlHints(job *batchv1.Job, pods []corev1.Pod) []KubectlCommand {
+	ns := job.Namespace
+	hints := []KubectlCommand{
+		{"Describe job", kubectl("describe", "job", job.Name, "-n", ns)},
+		{"Delete job and its pods", kubectl("delete", "job", job.Name, "-n", ns)},
+	}
+
+	for _, pod := range pods {
+		for _, c := range pod.Spec.Containers {
+			hints = append(hints, KubectlCommand{
+				fmt.Sprintf("Logs of %s/%s", pod.Name, c.Name),
+				kubectl("logs", pod.Name, "-c", c.Name, "-n", ns),
+			})
+		}
+		hints = append(hints, KubectlCommand{
+			"Describe pod " + pod.Name,
+			kubectl("describe", "pod", pod.Name, "-n", ns),
+		})
+		if pod.Status.Phase == corev1.PodRunning && len(pod.Spec.Containers) > 0 {
+			hints = append(hints, KubectlCommand{
+				"Shell into " + pod.Name,
+				kubectl("exec", "-it", pod.Name, "-c", pod.Spec.Containers[0].Name, "-n", ns, "--", "sh"),
+			})
+		}
+	}
+
+	return hints
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// operatorLabelPrefix is the prefix of the labels the operator sets on runs.
+const operatorLabelPrefix = "playwright.operator/"
+
+// errMissingCostLabels rejects runs without the cost labels of the settings, which cost
+// allocation tools like Kubecost attribute the spend of their pods by.
+var errMissingCostLabels = errors.New("missing cost labels")
+
+// validateLabels checks the syntax of the labels of a run, so invalid ones are rejected
+// before the API server fails to create its Job.
+func validateLabels(labels map[string]string) error {
+	for key, value := range labels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid label %q: %s", key, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("invalid value of label %q: %s", key, strings.Join(errs, ", "))
+		}
+	}
+
+	return nil
+}
+
+// withSuiteLabels returns the labels of a run with those of the policy of its suite it
+// does not set itself, e.g. the team owning the suite.
+func withSuiteLabels(labels map[string]string, policy SuitePolicy) map[string]string {
+	if len(policy.Labels) == 0 {
+		return labels
+	}
+
+	merged := copyLabels(labels)
+	if merged == nil {
+		merged = map[string]string{}
+	}
+	for k, v := range policy.Labels {
+		if _, ok := merged[k]; !ok {
+			merged[k] = v
+		}
+	}
+
+	return merged
+}
+
+// checkCostLabels fails with errMissingCostLabels when a run lacks one of the cost labels
+// of the settings or leaves it empty. Selftests of the operator are exempt.
+func checkCostLabels(settings Settings, spec RunSpec) error {
+	if spec.Labels[selftestLabel] != "" {
+		return nil
+	}
+
+	var missing []string
+	for _, key := range settings.CostLabels {
+		if spec.Labels[key] == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%w: runs need the labels %s, from the trigger or the policy of the suite", errMissingCostLabels, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// runLabels returns the labels a run was triggered with, without those of the operator
+// and the Job controller.
+func runLabels(run *batchv1.Job) map[string]string {
+	labels := map[string]string{}
+	for k, v := range run.Labels {
+		if !strings.HasPrefix(k, operatorLabelPrefix) {
+			labels[k] = v
+		}
+	}
+	for _, key := range jobControllerLabels {
+		delete(labels, key)
+	}
+
+	return labels
+}
+
+// spawnedLabels returns the labels of a Job spawned for a run, like its video previews:
+// its own and those the run was triggered with, so its pods are attributed to the same
+// team.
+func spawnedLabels(run *batchv1.Job, own map[string]string) map[string]string {
+	labels := runLabels(run)
+	for k, v := range own {
+		labels[k] = v
+	}
+
+	return labels
+}
+
+// labelRunPods adds the labels a run was triggered with to its running pods, for warm runs
+// whose pods started before they were claimed. Failures are logged, the pods keep running
+// unattributed.
+func labelRunPods(ctx context.Context, clientset *kubernetes.Clientset, run *batchv1.Job) {
+	labels := runLabels(run)
+	if len(labels) == 0 {
+		return
+	}
+
+	pods, err := clientset.CoreV1().Pods(run.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "job-name=" + run.Name,
+	})
+	if err != nil {
+		log.Printf("cannot label pods of run %s/%s: %v", run.Namespace, run.Name, err)
+		return
+	}
+
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": labels},
+	})
+	for _, pod := range pods.Items {
+		if _, err := clientset.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			log.Printf("cannot label pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// runsSelector leaves out Jobs that are not runs: monitor checks, which are recorded as
+// samples, idle warm runs, the CPU pressure of chaos runs, the video previews of runs and
+// the report merges of sharded runs.
+const runsSelector = "!" + monitorLabel + ",!" + warmLabel + ",!" + chaosRunLabel + ",!" + previewRunLabel + ",!" + mergeRunLabel
+
+// isRun tells whether a Job is a run, see runsSelector.
+func isRun(job *batchv1.Job) bool {
+	selector, err := labels.Parse(runsSelector)
+	return err == nil && selector.Matches(labels.Set(job.Labels))
+}
+
+// maxJobsLimit bounds the page size of the job list.
+const maxJobsLimit = 500
+
+var jobSortKeys = map[string]bool{
+	"creationTimestamp": true,
+	"completionTime":    true,
+	"duration":          true,
+	"failures":          true,
+	"name":              true,
+}
+
+// parseJobSort reads the sort and order query parameters, defaulting to newest first.
+func parseJobSort(query url.Values) (string, bool, error) {
+	key := query.Get("sort")
+	if key == "" {
+		key = "creationTimestamp"
+	}
+	if !jobSortKeys[key] {
+		return "", false, fmt.Errorf("sort must be one of creationTimestamp, completionTime, duration, failures, name")
+	}
+
+	order := query.Get("order")
+	switch order {
+	case "":
+		// names read naturally ascending, timestamps, durations and failures newest/longest/most first
+		return key, key == "name", nil
+	case "asc":
+		return key, true, nil
+	case "desc":
+		return key, false, nil
+	}
+
+	return "", false, fmt.Errorf("order must be asc or desc")
+}
+
+// jobFields are the fields of a run a fieldSelector selects on, the ones the API server
+// supports for Jobs.
+func jobFields(job *batchv1.Job) fields.Set {
+	return fields.Set{
+		"metadata.name":      job.Name,
+		"metadata.namespace": job.Namespace,
+		"status.successful":  strconv.Itoa(int(job.Status.Succeeded)),
+	}
+}
+
+var jobStates = map[string]bool{
+	jobStateRunning:   true,
+	jobStateSucceeded: true,
+	jobStateFailed:    true,
+	jobStateSuspended: true,
+	jobStateCancelled: true,
+}
+
+// parseJobFilter reads the suite, labelSelector, fieldSelector, status and search query
+// parameters. status is the state of a run derived from its Job conditions, see jobState,
+// search a part of the name of a run in any case.
+func parseJobFilter(query url.Values) (jobQuery, error) {
+	var q jobQuery
+	if suite := query.Get("suite"); suite != "" {
+		q.labels = map[string]string{suiteLabel: suite}
+	}
+
+	if v := query.Get("labelSelector"); v != "" {
+		selector, err := labels.Parse(v)
+		if err != nil {
+			return q, fmt.Errorf("invalid labelSelector: %w", err)
+		}
+		q.selector = selector
+	}
+
+	if v := query.Get("fieldSelector"); v != "" {
+		selector, err := fields.ParseSelector(v)
+		if err != nil {
+			return q, fmt.Errorf("invalid fieldSelector: %w", err)
+		}
+		for _, r := range selector.Requirements() {
+			if _, ok := jobFields(&batchv1.Job{})[r.Field]; !ok {
+				return q, fmt.Errorf("fieldSelector supports metadata.name, metadata.namespace and status.successful, not %q", r.Field)
+			}
+		}
+		q.fields = selector
+	}
+
+	if v := query.Get("status"); v != "" {
+		if !jobStates[v] {
+			return q, fmt.Errorf("status must be one of running, succeeded, failed, suspended, cancelled")
+		}
+		q.state = v
+	}
+
+	q.search = strings.ToLower(query.Get("search"))
+
+	return q, nil
+}
+
+// parseJobPage reads the limit and continue query parameters. No limit lists all jobs,
+// continue is the token of the previous page, which is the offset of the next one in the
+// sorted list.
+func parseJobPage(query url.Values) (limit, offset int, err error) {
+	if v := query.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxJobsLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxJobsLimit)
+		}
+	}
+
+	if v := query.Get("continue"); v != "" {
+		if limit == 0 {
+			return 0, 0, fmt.Errorf("continue needs the limit of the previous page")
+		}
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid continue token %q", v)
+		}
+	}
+
+	return limit, offset, nil
+}
+
+// pageJobs cuts a page out of the sorted Jobs and returns the continue token of the next
+// page, if there is one. Runs created or deleted between the requests of two pages shift
+// the later pages by as many runs.
+func pageJobs[J batchv1.Job | *batchv1.Job](jobs []J, limit, offset int) ([]J, string) {
+	if limit == 0 {
+		return jobs, ""
+	}
+	if offset >= len(jobs) {
+		return []J{}, ""
+	}
+
+	end := offset + limit
+	if end >= len(jobs) {
+		return jobs[offset:], ""
+	}
+
+	return jobs[offset:end], strconv.Itoa(end)
+}
+
+func jobDuration(job *batchv1.Job) (time.Duration, bool) {
+	if job.Status.StartTime == nil || job.Status.CompletionTime == nil {
+		return 0, false
+	}
+
+	return job.Status.CompletionTime.Sub(job.Status.StartTime.Time), true
+}
+
+// JobSummary carries the run metadata the dashboard can show as job list columns.
+type JobSummary struct {
+	Suite    string `json:"suite,omitempty"`
+	Branch   string `json:"branch,omitempty"`
+	Owner    string `json:"owner,omitempty"`
+	Platform string `json:"platform,omitempty"`
+	Duration string `json:"duration,omitempty"`
+	Passed   int32  `json:"passed"`
+	Failed   int32  `json:"failed"`
+	// SupersededBy names the run that cancelled this one.
+	SupersededBy string `json:"supersededBy,omitempty"`
+}
+
+func summarizeJob(job *batchv1.Job) JobSummary {
+	summary := JobSummary{
+		Suite:  job.Labels[suiteLabel],
+		Branch: job.Labels[branchLabel],
+		Owner:  job.Labels[ownerLabel],
+		Passed: job.Status.Succeeded,
+		Failed: job.Status.Failed,
+
+		Platform:     job.Labels[platformLabel],
+		SupersededBy: job.Annotations[supersededByAnnotation],
+	}
+	if d, ok := jobDuration(job); ok {
+		summary.Duration = d.Round(time.Second).String()
+	}
+
+	return summary
+}
+
+// sortJobs orders Jobs by key. Jobs without a completion time or duration sort last in
+// both directions, ties keep creation order.
+func sortJobs(jobs []batchv1.Job, key string, asc bool) {
+	sort.SliceStable(jobs, func(i, j int) bool { return lessJob(&jobs[i], &jobs[j], key, asc) })
+}
+
+// sortJobRefs sorts the cached Jobs of jobCache.refs like sortJobs.
+func sortJobRefs(jobs []*batchv1.Job, key string, asc bool) {
+	sort.SliceStable(jobs, func(i, j int) bool { return lessJob(jobs[i], jobs[j], key, asc) })
+}
+
+func lessJob(a, b *batchv1.Job, key string, asc bool) bool {
+	var less, greater bool
+	switch key {
+	case "name":
+		less, greater = a.Name < b.Name, a.Name > b.Name
+	case "completionTime":
+		if a.Status.CompletionTime == nil || b.Status.CompletionTime == nil {
+			return a.Status.CompletionTime != nil && b.Status.CompletionTime == nil
+		}
+		less = a.Status.CompletionTime.Before(b.Status.CompletionTime)
+		greater = b.Status.CompletionTime.Before(a.Status.CompletionTime)
+	case "duration":
+		da, okA := jobDuration(a)
+		db, okB := jobDuration(b)
+		if !okA || !okB {
+			return okA && !okB
+		}
+		less, greater = da < db, da > db
+	case "failures":
+		less, greater = a.Status.Failed < b.Status.Failed, a.Status.Failed > b.Status.Failed
+	default:
+		less = a.CreationTimestamp.Before(&b.CreationTimestamp)
+		greater = b.CreationTimestamp.Before(&a.CreationTimestamp)
+	}
+
+	if asc {
+		return less
+	}
+	return greater
+}
+
+// parseTimeBound accepts an RFC3339 timestamp or a duration relative to now, e.g. "24h" or "7d".
+func parseTimeBound(v string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+
+	d, err := parseWindow(v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC3339 timestamp nor a duration", v)
+	}
+
+	return now.Add(-d), nil
+}
+
+// parseWindow parses a Go duration, additionally accepting whole days like "30d".
+func parseWindow(v string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", v)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", v)
+	}
+
+	return d, nil
+}
+
+// parseTimeRange reads the since and until query parameters, zero times are unbounded.
+func parseTimeRange(query url.Values, now time.Time) (since, until time.Time, err error) {
+	if v := query.Get("since"); v != "" {
+		if since, err = parseTimeBound(v, now); err != nil {
+			return since, until, fmt.Errorf("since: %w", err)
+		}
+	}
+	if v := query.Get("until"); v != "" {
+		if until, err = parseTimeBound(v, now); err != nil {
+			return since, until, fmt.Errorf("until: %w", err)
+		}
+	}
+	if !since.IsZero() && !until.IsZero() && until.Before(since) {
+		return since, until, fmt.Errorf("until must not be before since")
+	}
+
+	return since, until, nil
+}
+
+// filterJobsByTime keeps the Jobs created within the range.
+func filterJobsByTime(jobs []batchv1.Job, since, until time.Time) []batchv1.Job {
+	if since.IsZero() && until.IsZero() {
+		return jobs
+	}
+
+	filtered := jobs[:0]
+	for _, job := range jobs {
+		created := job.CreationTimestamp.Time
+		if (!since.IsZero() && created.Before(since)) || (!until.IsZero() && created.After(until)) {
+			continue
+		}
+		filtered = append(filtered, job)
+	}
+
+	return filtered
+}
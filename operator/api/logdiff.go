@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// diffContext is the number of unchanged lines around each change.
+	diffContext = 3
+	// maxDiffLines bounds the logs of each run that are compared, keeping the last lines.
+	maxDiffLines = 20000
+	// maxDiffBytes bounds the log read of each pod.
+	maxDiffBytes = 8 << 20
+	// maxDiffEdits bounds the effort of the diff, runs differing more are shown as
+	// replaced wholesale in the differing part.
+	maxDiffEdits = 2000
+)
+
+// logNoise matches parts of log lines that differ between any two runs. They are replaced
+// by placeholders before diffing, so only changes in substance show.
+var logNoise = []struct {
+	pattern     *regexp.Regexp
+	placeholder string
+}{
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`), "<timestamp>"},
+	{regexp.MustCompile(`\b\d{2}:\d{2}:\d{2}(\.\d+)?\b`), "<time>"},
+	{regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`\b[0-9a-f]{12,}\b`), "<id>"},
+	{regexp.MustCompile(`\b\d+(\.\d+)?(ms|s|m)\b`), "<duration>"},
+	{regexp.MustCompile(`\b(playwright-run|monitor)-[a-z0-9-]+\b`), "<run>"},
+	{regexp.MustCompile(`:\d{4,5}\b`), ":<port>"},
+}
+
+type LogDiffResponse struct {
+	Base RunRef `json:"base"`
+	Head RunRef `json:"head"`
+	// Diff is a unified diff of the normalized logs, empty when they match.
+	Diff string `json:"diff"`
+}
+
+func normalizeLogLine(line string) string {
+	for _, noise := range logNoise {
+		line = noise.pattern.ReplaceAllString(line, noise.placeholder)
+	}
+
+	return line
+}
+
+// runLogs concatenates the logs of the pods of a run in the order they were created,
+// headed by the pod names.
+func runLogs(ctx context.Context, clientset *kubernetes.Clientset, job *batchv1.Job) ([]string, error) {
+	pods, err := clientset.CoreV1().Pods(job.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", job.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].CreationTimestamp.Before(&pods.Items[j].CreationTimestamp)
+	})
+
+	var lines []string
+	for i, pod := range pods.Items {
+		lines = append(lines, fmt.Sprintf("==> pod %d <==", i+1))
+
+		stream, err := clientset.CoreV1().Pods(job.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+			Container:  runContainer,
+			TailLines:  ptr.To(int64(maxDiffLines)),
+			LimitBytes: ptr.To(int64(maxDiffBytes)),
+		}).Stream(ctx)
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(stream)
+		stream.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			lines = append(lines, normalizeLogLine(line))
+		}
+	}
+
+	if len(lines) > maxDiffLines {
+		lines = lines[len(lines)-maxDiffLines:]
+	}
+
+	return lines, nil
+}
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// diffLines returns the edit script from a to b, using Myers' algorithm on the part
+// between the common prefix and suffix.
+func diffLines(a, b []string) []diffOp {
+	var prefix, suffix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	return ops
+}
+
+// myers returns the edit script from a to b with the linear space variant of Myers'
+// algorithm, which splits the problem at the middle snake of an optimal path. Inputs
+// differing by more than maxDiffEdits are shown as replaced wholesale.
+func myers(a, b []string) []diffOp {
+	if len(a) > 0 && len(b) > 0 {
+		if d, _, _, _, _ := middleSnake(a, b, maxDiffEdits); d < 0 {
+			ops := make([]diffOp, 0, len(a)+len(b))
+			for _, line := range a {
+				ops = append(ops, diffOp{'-', line})
+			}
+			for _, line := range b {
+				ops = append(ops, diffOp{'+', line})
+			}
+			return ops
+		}
+	}
+
+	var ops []diffOp
+	diffSplit(a, b, &ops)
+	return ops
+}
+
+// diffSplit appends the edit script from a to b to ops, recursing on the parts before and
+// after the middle snake.
+func diffSplit(a, b []string, ops *[]diffOp) {
+	switch {
+	case len(a) == 0:
+		for _, line := range b {
+			*ops = append(*ops, diffOp{'+', line})
+		}
+		return
+	case len(b) == 0:
+		for _, line := range a {
+			*ops = append(*ops, diffOp{'-', line})
+		}
+		return
+	}
+
+	d, x, y, u, v := middleSnake(a, b, len(a)+len(b))
+	if d > 1 {
+		diffSplit(a[:x], b[:y], ops)
+		for _, line := range a[x:u] {
+			*ops = append(*ops, diffOp{' ', line})
+		}
+		diffSplit(a[u:], b[v:], ops)
+		return
+	}
+
+	// at most one line was inserted or deleted after the common prefix
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		*ops = append(*ops, diffOp{' ', a[i]})
+		i++
+	}
+	rest := a[i:]
+	if len(a) > len(b) {
+		*ops = append(*ops, diffOp{'-', a[i]})
+		rest = a[i+1:]
+	} else if len(b) > len(a) {
+		*ops = append(*ops, diffOp{'+', b[i]})
+	}
+	for _, line := range rest {
+		*ops = append(*ops, diffOp{' ', line})
+	}
+}
+
+// middleSnake returns the number of edits d from a to b and the snake (x, y) to (u, v) in
+// the middle of an optimal path, searching forward from the start and backward from the
+// end at once. It keeps the furthest x per diagonal only, the backward one counted from
+// the end, and returns d -1 if a and b differ by more than limit edits.
+func middleSnake(a, b []string, limit int) (d, x, y, u, v int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	max := (n + m + 1) / 2
+	if half := (limit + 1) / 2; half < max {
+		max = half
+	}
+	offset := max + 1
+	forward, backward := make([]int, 2*max+3), make([]int, 2*max+3)
+
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			// diagonal k is diagonal delta-k counted from the end
+			if c := delta - k; delta%2 != 0 && c >= -(d-1) && c <= d-1 && x+backward[offset+c] >= n {
+				return 2*d - 1, startX, startY, x, y
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			if c := delta - k; delta%2 == 0 && c >= -d && c <= d && x+forward[offset+c] >= n {
+				return 2 * d, n - x, m - y, n - startX, m - startY
+			}
+		}
+	}
+
+	return -1, 0, 0, 0, 0
+}
+
+// unifiedDiff renders an edit script as unified diff hunks with diffContext lines of context.
+func unifiedDiff(baseName, headName string, ops []diffOp) string {
+	var changes []int
+	for i, op := range ops {
+		if op.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", baseName, headName)
+
+	// line numbers in a and b before each op
+	aLine, bLine := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, op := range ops {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if op.kind != '+' {
+			aLine[i+1]++
+		}
+		if op.kind != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	for c := 0; c < len(changes); {
+		start := changes[c] - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := changes[c] + diffContext + 1
+		for c++; c < len(changes) && changes[c]-diffContext <= end; c++ {
+			end = changes[c] + diffContext + 1
+		}
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", aLine[start]+1, aLine[end]-aLine[start], bLine[start]+1, bLine[end]-bLine[start])
+		for _, op := range ops[start:end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.line)
+			sb.WriteByte('\n')
+		}
+	}
+
+	return sb.String()
+}
+
+// GET /runs/diff/logs?namespace=ns&base=run&head=run with Job names or UIDs
+func diffRunLogs(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	query := r.URL.Query()
+	namespace := getNamespace(query.Get("namespace"))
+	if query.Get("base") == "" || query.Get("head") == "" {
+		writeError(w, "base and head are required", http.StatusBadRequest)
+		return
+	}
+
+	var jobs [2]*batchv1.Job
+	var logs [2][]string
+	for i, id := range []string{query.Get("base"), query.Get("head")} {
+		job, err := findRun(r.Context(), clientset, namespace, id)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		if job == nil {
+			writeError(w, "run not found: "+id, http.StatusNotFound)
+			return
+		}
+
+		lines, err := runLogs(r.Context(), clientset, job)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		jobs[i], logs[i] = job, lines
+	}
+
+	respondJSON(w, LogDiffResponse{
+		Base: RunRef{Namespace: jobs[0].Namespace, Name: jobs[0].Name, UID: string(jobs[0].UID)},
+		Head: RunRef{Namespace: jobs[1].Namespace, Name: jobs[1].Name, UID: string(jobs[1].UID)},
+		Diff: unifiedDiff(jobs[0].Name, jobs[1].Name, diffLines(logs[0], logs[1])),
+	})
+}
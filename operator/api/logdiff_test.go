@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// lcsLength is the length of the longest common subsequence of a and b.
+func lcsLength(a, b []string) int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+// applyDiff checks that ops turn a into b and returns the number of edits.
+func applyDiff(t *testing.T, a, b []string, ops []diffOp) int {
+	t.Helper()
+	var fromA, fromB []string
+	edits := 0
+	for _, op := range ops {
+		if op.kind != '+' {
+			fromA = append(fromA, op.line)
+		}
+		if op.kind != '-' {
+			fromB = append(fromB, op.line)
+		}
+		if op.kind != ' ' {
+			edits++
+		}
+	}
+	if strings.Join(fromA, "\n") != strings.Join(a, "\n") || strings.Join(fromB, "\n") != strings.Join(b, "\n") {
+		t.Fatalf("diff of %q and %q does not apply: %q", a, b, ops)
+	}
+
+	return edits
+}
+
+func TestDiffLinesIsMinimal(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	lines := func() []string {
+		out := make([]string, rng.Intn(30))
+		for i := range out {
+			out[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return out
+	}
+
+	for i := 0; i < 2000; i++ {
+		a, b := lines(), lines()
+		edits := applyDiff(t, a, b, diffLines(a, b))
+		if want := len(a) + len(b) - 2*lcsLength(a, b); edits != want {
+			t.Fatalf("diff of %q and %q has %d edits, want %d", a, b, edits, want)
+		}
+	}
+}
+
+func TestDiffLinesReplacesWholesaleBeyondMaxEdits(t *testing.T) {
+	a, b := make([]string, maxDiffEdits), make([]string, maxDiffEdits)
+	for i := range a {
+		a[i], b[i] = "a", "b"
+	}
+	a = append([]string{"same"}, a...)
+	b = append([]string{"same"}, b...)
+
+	ops := diffLines(a, b)
+	applyDiff(t, a, b, ops)
+	if ops[1].kind != '-' || ops[maxDiffEdits].kind != '-' || ops[maxDiffEdits+1].kind != '+' {
+		t.Errorf("runs differing by more than maxDiffEdits are not replaced wholesale")
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}
+	b := []string{"1", "2", "3", "4", "five", "6", "7", "8", "9", "10", "11"}
+
+	got := strings.Split(unifiedDiff("base", "head", diffLines(a, b)), "\n")
+	want := []string{
+		"--- base",
+		"+++ head",
+		"@@ -2,9 +2,10 @@",
+		" 2", " 3", " 4", "-5", "+five", " 6", " 7", " 8",
+		" 9", " 10", "+11",
+		"",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unifiedDiff() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if diff := unifiedDiff("base", "head", diffLines(a, a)); diff != "" {
+		t.Errorf("unifiedDiff() of equal logs = %q, want none", diff)
+	}
+}
+
+func TestNormalizeLogLine(t *testing.T) {
+	got := normalizeLogLine("2026-10-15T08:00:01.123Z playwright-run-abc12 took 1.5s on :3000")
+	if want := "<timestamp> <run> took <duration> on :<port>"; got != want {
+		t.Errorf("normalizeLogLine() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	logFilterConfigMap = "playwright-log-filters"
+	logFilterKey       = "filters.json"
+
+	// maxArchivedLogBytes bounds the archived logs of each pod of a run.
+	maxArchivedLogBytes = 8 << 20
+)
+
+const (
+	// logFilterHide drops matching lines from log views.
+	logFilterHide = "hide"
+	// logFilterCollapse folds consecutive matching lines into one expandable line.
+	logFilterCollapse = "collapse"
+)
+
+// LogFilter marks known-noisy log lines, like health-check pings or verbose browser
+// warnings, by a regular expression.
+type LogFilter struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	Action  string `json:"action"`
+}
+
+func validateLogFilters(filters []LogFilter) error {
+	names := map[string]bool{}
+	for _, f := range filters {
+		if f.Name == "" || names[f.Name] {
+			return fmt.Errorf("every filter needs a unique name")
+		}
+		names[f.Name] = true
+
+		if _, err := regexp.Compile(f.Pattern); err != nil || f.Pattern == "" {
+			return fmt.Errorf("%s: pattern must be a valid regular expression", f.Name)
+		}
+		if f.Action != logFilterHide && f.Action != logFilterCollapse {
+			return fmt.Errorf("%s: action must be %q or %q", f.Name, logFilterHide, logFilterCollapse)
+		}
+	}
+
+	return nil
+}
+
+func loadLogFilters(ctx context.Context, clientset *kubernetes.Clientset, namespace string) (*corev1.ConfigMap, []LogFilter, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, logFilterConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: logFilterConfigMap, Namespace: namespace}}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	filters := []LogFilter{}
+	if data := cm.Data[logFilterKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &filters); err != nil {
+			return nil, nil, fmt.Errorf("decoding %s: %w", logFilterConfigMap, err)
+		}
+	}
+
+	return cm, filters, nil
+}
+
+// filterLogs drops hidden lines and folds runs of collapsed ones into a single line, like
+// the log view of the dashboard. Filters with invalid patterns, e.g. edited into the
+// ConfigMap by hand, are skipped.
+func filterLogs(lines []string, filters []LogFilter) []string {
+	if len(filters) == 0 {
+		return lines
+	}
+	patterns := make([]*regexp.Regexp, len(filters))
+	for i, f := range filters {
+		patterns[i], _ = regexp.Compile(f.Pattern)
+	}
+	match := func(line string) *LogFilter {
+		for i := range filters {
+			if patterns[i] != nil && patterns[i].MatchString(line) {
+				return &filters[i]
+			}
+		}
+		return nil
+	}
+
+	var kept []string
+	for i := 0; i < len(lines); i++ {
+		f := match(lines[i])
+		if f == nil {
+			kept = append(kept, lines[i])
+			continue
+		}
+		if f.Action != logFilterCollapse {
+			continue
+		}
+		// a single collapsed line is kept as is
+		n := 1
+		for i+n < len(lines) && match(lines[i+n]) == f {
+			n++
+		}
+		if n == 1 {
+			kept = append(kept, lines[i])
+		} else {
+			kept = append(kept, fmt.Sprintf("⋯ %d lines matching %s", n, f.Name))
+		}
+		i += n - 1
+	}
+
+	return kept
+}
+
+// runLogsFile keeps the filtered logs of a run below its HTML report, so they are uploaded
+// and retained with it.
+func runLogsFile(uid types.UID) string {
+	return filepath.Join(resultsDir, string(uid), "logs", "run.log.gz")
+}
+
+// archiveRunLogs writes the logs of the Playwright container of the pods of a finished run,
+// in the order the pods were created and with the log filters of its namespace applied.
+// Pods whose logs are gone are skipped.
+func archiveRunLogs(ctx context.Context, clientset *kubernetes.Clientset, job *batchv1.Job) error {
+	_, filters, err := loadLogFilters(ctx, clientset, job.Namespace)
+	if err != nil {
+		return err
+	}
+	pods, err := clientset.CoreV1().Pods(job.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: batchv1.ControllerUidLabel + "=" + string(job.UID),
+	})
+	if err != nil {
+		return err
+	}
+	if len(pods.Items) == 0 {
+		return nil
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].CreationTimestamp.Before(&pods.Items[j].CreationTimestamp)
+	})
+
+	var lines []string
+	for _, pod := range pods.Items {
+		logs, err := containerLogs(ctx, clientset, pod.Namespace, pod.Name, runContainer, corev1.PodLogOptions{
+			LimitBytes: ptr.To(int64(maxArchivedLogBytes)),
+		})
+		if err != nil {
+			log.Printf("cannot archive the logs of pod %s/%s: %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+		lines = append(lines, "==> "+pod.Name+" <==")
+		if logs != "" {
+			lines = append(lines, filterLogs(strings.Split(strings.TrimSuffix(logs, "\n"), "\n"), filters)...)
+		}
+	}
+
+	return writeFileAtomic(runLogsFile(job.UID), func(w io.Writer) error {
+		gz := gzip.NewWriter(w)
+		gz.Name = job.Name + ".log"
+		for _, line := range lines {
+			if _, err := io.WriteString(gz, line+"\n"); err != nil {
+				return err
+			}
+		}
+		return gz.Close()
+	})
+}
+
+// GET /logfilters?namespace=ns
+func getLogFilters(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	_, filters, err := loadLogFilters(r.Context(), clientset, getNamespace(r.URL.Query().Get("namespace")))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, filters)
+}
+
+// PUT /logfilters?namespace=ns with [{"name": "health", "pattern": "GET /healthz", "action": "hide"}]
+// replaces the filters. With authentication, only ADMIN_GROUPS may change them, as they
+// apply to the archived logs too.
+func setLogFilters(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+
+	var filters []LogFilter
+	if err := json.NewDecoder(r.Body).Decode(&filters); err != nil {
+		writeError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateLogFilters(filters); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filters == nil {
+		filters = []LogFilter{}
+	}
+
+	data, err := json.Marshal(filters)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	for attempt := 0; ; attempt++ {
+		cm, _, err := loadLogFilters(r.Context(), clientset, namespace)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[logFilterKey] = string(data)
+
+		if cm.ResourceVersion == "" {
+			_, err = clientset.CoreV1().ConfigMaps(namespace).Create(r.Context(), cm, metav1.CreateOptions{})
+		} else {
+			_, err = clientset.CoreV1().ConfigMaps(namespace).Update(r.Context(), cm, metav1.UpdateOptions{})
+		}
+		if err == nil {
+			break
+		}
+		if (!apierrors.IsConflict(err) && !apierrors.IsAlreadyExists(err)) || attempt == 4 {
+			respondError(w, err)
+			return
+		}
+	}
+
+	respondJSON(w, filters)
+}
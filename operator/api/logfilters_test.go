@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilterLogs(t *testing.T) {
+	filters := []LogFilter{
+		{Name: "health", Pattern: `GET /healthz`, Action: logFilterHide},
+		{Name: "warnings", Pattern: `^\[warn\]`, Action: logFilterCollapse},
+		{Name: "broken", Pattern: `(`, Action: logFilterHide},
+	}
+	lines := []string{
+		"GET /healthz 200",
+		"Running 3 tests",
+		"[warn] slow font",
+		"[warn] slow image",
+		"[warn] slow script",
+		"GET /healthz 200",
+		"[warn] slow font",
+		"1 failed (",
+	}
+
+	want := []string{
+		"Running 3 tests",
+		"⋯ 3 lines matching warnings",
+		"[warn] slow font",
+		"1 failed (",
+	}
+	if got := filterLogs(lines, filters); !reflect.DeepEqual(got, want) {
+		t.Errorf("filterLogs = %q, want %q", got, want)
+	}
+	if got := filterLogs(lines, nil); !reflect.DeepEqual(got, lines) {
+		t.Errorf("without filters filterLogs = %q, want the lines", got)
+	}
+}
+
+func TestSetLogFiltersRequiresAdmin(t *testing.T) {
+	t.Setenv("AUTH_GROUP_CLAIMS", "groups")
+	t.Setenv("ADMIN_GROUPS", "playwright-admins")
+
+	r := httptest.NewRequest(http.MethodPut, "/logfilters", strings.NewReader(`[]`))
+	r = withClaims(r, map[string]interface{}{"groups": []interface{}{"developers"}})
+	w := httptest.NewRecorder()
+	setLogFilters(w, r, nil)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status %d, want 403", w.Code)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"shared/shutdown"
+)
+
+// maxLogLine bounds the lines of a log stream, longer lines end it.
+const maxLogLine = 1024 * 1024
+
+// GET /pod/logs/stream?namespace=ns&pod=name&container=c&tailLines=n follows the logs of a
+// pod as server-sent events, one message per line, with the options of podLogOptions. An
+// "end" event carries the reason the stream stopped, empty once the container exited. On
+// shutdown the stream stops without one.
+func streamPodLogs(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+	pod := r.URL.Query().Get("pod")
+	if namespace == "" || pod == "" {
+		writeError(w, "namespace and pod are required", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := podLogOptions(r.URL.Query())
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.Follow = true
+	if opts.Container == "" {
+		p, err := clientset.CoreV1().Pods(namespace).Get(r.Context(), pod, metav1.GetOptions{})
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		opts.Container = defaultContainer(p)
+	}
+
+	ctx, cancel := shutdown.StreamContext(r)
+	defer cancel()
+
+	stream, err := clientset.CoreV1().Pods(namespace).GetLogs(pod, opts).Stream(ctx)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	defer stream.Close()
+
+	// the stream lasts as long as the pod runs, well beyond the write timeout of the server
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		respondError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), maxLogLine)
+	for scanner.Scan() {
+		// a carriage return would end the data field early
+		line := strings.ReplaceAll(scanner.Text(), "\r", "")
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", line); err != nil {
+			return
+		}
+		rc.Flush()
+	}
+
+	// without an end event the EventSource of the browser reconnects, to another pod
+	if shutdown.IsDraining() {
+		return
+	}
+
+	reason := ""
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		reason = err.Error()
+	}
+	fmt.Fprintf(w, "event: end\ndata: %s\n\n", strings.ReplaceAll(reason, "\n", " "))
+	rc.Flush()
+}
@@ -3,39 +3,188 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"fmt"
-	"io"
+	"flag"
 	"log"
 	"net/http"
 	"os"
-	"sort"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"shared/buildinfo"
+	"shared/clientip"
+	"shared/logging"
+	"shared/shutdown"
 )
 
+// inClusterPaths are called from inside the cluster by probes, Prometheus and the warm
+// pool agents, the address lists do not apply to them and they are logged at debug level.
+var inClusterPaths = map[string]bool{
+	"/healthz":             true,
+	"/metrics":             true,
+	"/warmpool/assignment": true,
+}
+
 // Response-Typen für JSON-API
 
 type JobListResponse struct {
 	Items    []batchv1.Job `json:"items"`
 	Continue string        `json:"continue,omitempty"`
+	// Suppressed maps the UIDs of failed jobs whose failed tests are all suppressed to the
+	// reasons of the rules.
+	Suppressed map[string]string `json:"suppressed,omitempty"`
+	// Summaries maps job UIDs to the fields shown as job list columns.
+	Summaries map[string]JobSummary `json:"summaries,omitempty"`
+	// Queue maps the UIDs of jobs waiting to start to their queue status.
+	Queue map[string]QueueStatus `json:"queue,omitempty"`
 }
 
 type JobDetailsResponse struct {
-	Job  *batchv1.Job `json:"job"`
-	Pods []corev1.Pod `json:"pods"`
+	Job             *batchv1.Job     `json:"job"`
+	Pods            []corev1.Pod     `json:"pods"`
+	ImagePullErrors []ImagePullError `json:"imagePullErrors,omitempty"`
+	Budget          *BudgetResult    `json:"budget,omitempty"`
+	Comparison      *RunComparison   `json:"comparison,omitempty"`
+	Suppression     *RunSuppression  `json:"suppression,omitempty"`
+	Kubectl         []KubectlCommand `json:"kubectl"`
+	// BrowserVersions are reported by the browser probe, BrowserWarnings list the ones
+	// outside the matrix of the suite.
+	BrowserVersions map[string]string `json:"browserVersions,omitempty"`
+	BrowserWarnings []string          `json:"browserWarnings,omitempty"`
+	Preemptions     []Preemption      `json:"preemptions,omitempty"`
+	Queue           *QueueStatus      `json:"queue,omitempty"`
+	// Matrix breaks the results of the matrix of the run down by device, locale and timezone.
+	Matrix []MatrixRun `json:"matrix,omitempty"`
+	// Containers maps the pods of the run to their containers, for picking the logs.
+	Containers map[string][]PodContainer `json:"containers"`
+	// Shards are the shards of sharded runs, whose merged report is served under the UID
+	// of the run.
+	Shards []ShardStatus `json:"shards,omitempty"`
+	// Cost is the measured cost of the run, or an estimate until OpenCost has it.
+	Cost *RunCost `json:"cost,omitempty"`
+	// SignOff is the sign-off of signed off runs, see signOffRun.
+	SignOff *SignOff `json:"signOff,omitempty"`
 }
 
 func main() {
-	clientset, err := newKubeClient()
+	// controller-runtime already registers the -kubeconfig flag
+	kubeContext := flag.String("context", "", "kubeconfig context to use instead of the current one")
+	logLevel := flag.String("log-level", envOrDefault("LOG_LEVEL", "info"), "minimum level of log messages: debug, info, warn or error")
+	logFormat := flag.String("log-format", envOrDefault("LOG_FORMAT", "text"), "format of log messages: text or json")
+	flag.Parse()
+	if err := logging.Setup(*logLevel, *logFormat); err != nil {
+		log.Fatalf("invalid logging settings: %v", err)
+	}
+
+	config, err := newKubeConfig(flag.Lookup("kubeconfig").Value.String(), *kubeContext)
+	if err != nil {
+		log.Fatalf("cannot load Kubernetes config: %v", err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		log.Fatalf("cannot create Kubernetes client: %v", err)
 	}
 
+	// SIGTERM of a rolling update stops the loops and drains the server
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	schemaVersion, err := checkSchemaVersion(resultsDir)
+	if err != nil {
+		log.Fatalf("cannot migrate %s: %v", resultsDir, err)
+	}
+	go migrate(resultsDir, schemaVersion)
+
+	// listings, details, the job watch, the metrics and the loops of the runs read runs and
+	// pods from here
+	informers := newRunInformers(clientset)
+
+	go revokeFinishedCredentials(ctx, clientset, time.Minute)
+	go warnExpiredSuppressions(ctx, clientset, time.Minute)
+	go trackSLOs(ctx, clientset, getNamespace(""), time.Minute)
+	go recordMonitors(ctx, clientset, getNamespace(""), time.Minute)
+	go maintainWarmPool(ctx, clientset, getNamespace(""), 15*time.Second)
+	if _, err := manifestKey(); err != nil {
+		log.Fatalf("invalid checksum manifest key: %v", err)
+	}
+	store, err := resultsStoreFromEnv()
+	if err != nil {
+		log.Fatalf("cannot configure the results store: %v", err)
+	}
+	retention, err := historyRetention()
+	if err != nil {
+		log.Fatalf("invalid test history retention: %v", err)
+	}
+	scanner, err := artifactScannerFromEnv()
+	if err != nil {
+		log.Fatalf("invalid artifact scan settings: %v", err)
+	}
+	// runs are reconciled in every namespace the API lists them in
+	go watchRunNamespaces(ctx, clientset, time.Minute, func(ctx context.Context, namespace string) {
+		// the loops read the runs from the informers, which keep running for them
+		_, release := informers.hold(namespace)
+		context.AfterFunc(ctx, release)
+		go reconcileChaos(ctx, clientset, informers, namespace, 15*time.Second)
+		go runCompletionHooks(ctx, clientset, informers, namespace, 15*time.Second)
+		if videoPreviewImage() != "" {
+			go generateVideoPreviews(ctx, clientset, informers, namespace, 15*time.Second)
+		}
+		go mergeShardReports(ctx, clientset, informers, namespace, 15*time.Second)
+		go reconcileRunCosts(ctx, clientset, informers, namespace, 5*time.Minute)
+		go snapshotSoakRuns(ctx, clientset, informers, namespace, 10*time.Second)
+		go archiveRunReports(ctx, clientset, informers, namespace, time.Minute)
+		go signRunReports(ctx, clientset, informers, namespace, time.Minute)
+		go syncTestManagement(ctx, clientset, informers, namespace, time.Minute)
+		go recordTestHistory(ctx, clientset, informers, store, namespace, time.Minute)
+		if store != nil {
+			go uploadRunResults(ctx, clientset, informers, store, namespace, time.Minute)
+		}
+		if scanner != nil {
+			go scanRunArtifacts(ctx, clientset, informers, scanner, namespace, time.Minute)
+		}
+	})
+	// the results of all namespaces share the volume, the retention weighs them together
+	go enforceRetention(ctx, clientset, 10*time.Minute)
+	if retention > 0 {
+		go pruneHistory(ctx, store, retention, time.Hour)
+	}
+	if store != nil {
+		go archiveHistory(ctx, store, time.Hour)
+	}
+	if client := scimClientFromEnv(); client != nil {
+		go syncDirectory(ctx, clientset, client, getNamespace(""), directorySyncInterval())
+	}
+	if endpoint := os.Getenv("TELEMETRY_ENDPOINT"); endpoint != "" {
+		go reportTelemetry(ctx, clientset, endpoint, telemetryInterval())
+	}
+
+	if enabled, _ := strconv.ParseBool(os.Getenv("TESTRUN_CONTROLLER")); enabled {
+		go func() {
+			if err := runTestRunController(ctx, config, clientset, getNamespace("")); err != nil {
+				log.Fatalf("PlaywrightTestRun controller failed: %v", err)
+			}
+		}()
+	}
+
+	audit, err := newAuditLogFromEnv(clientset)
+	if err != nil {
+		log.Fatalf("cannot configure the audit log: %v", err)
+	}
+	go audit.run(ctx)
+
+	go notifyRunCompletions(ctx, clientset, informers, time.Minute)
+	go stopIdleInformers(ctx, informers, time.Minute)
+
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
@@ -43,53 +192,453 @@ func main() {
 		w.Write([]byte("ok"))
 	})
 
-	// GET /jobs?namespace=ns&limit=50&continue=token
+	// GET /version
+	mux.HandleFunc("GET /version", func(w http.ResponseWriter, r *http.Request) {
+		respondJSON(w, buildinfo.Get())
+	})
+
+	// GET /openapi.json and GET /docs with Swagger UI
+	mux.HandleFunc("GET /openapi.json", getOpenAPISpec)
+	mux.HandleFunc("GET /docs", getAPIDocs)
+
+	// GET /namespaces
+	mux.HandleFunc("GET /namespaces", func(w http.ResponseWriter, r *http.Request) {
+		getNamespaces(w, r, clientset)
+	})
+
+	// GET /capabilities
+	mux.HandleFunc("GET /capabilities", func(w http.ResponseWriter, r *http.Request) {
+		getCapabilities(w, r, clientset, informers)
+	})
+
+	// GET /admin/settings
+	// PUT /admin/settings with the Settings and who changes them, see putSettings
+	mux.HandleFunc("GET /admin/settings", func(w http.ResponseWriter, r *http.Request) {
+		getSettings(w, r, clientset)
+	})
+	mux.HandleFunc("PUT /admin/settings", func(w http.ResponseWriter, r *http.Request) {
+		putSettings(w, r, clientset)
+	})
+
+	// GET /admin/admission/decisions?limit=n&denied=true as OPA decision logs
+	// GET /admin/admission/gatekeeper?namespace=ns&enforcementAction=deny|dryrun|warn
+	mux.HandleFunc("GET /admin/admission/decisions", func(w http.ResponseWriter, r *http.Request) {
+		listAdmissionDecisions(w, r, clientset)
+	})
+	mux.HandleFunc("GET /admin/admission/gatekeeper", func(w http.ResponseWriter, r *http.Request) {
+		exportGatekeeper(w, r, clientset)
+	})
+
+	// GET /admin/directory with the groups of the last directory sync
+	// GET /directory/groups?user=name
+	mux.HandleFunc("GET /admin/directory", getDirectoryStatus)
+	mux.HandleFunc("GET /directory/groups", getUserGroups)
+
+	// GET /admin/audit?limit=n&actor=name&path=prefix
+	// GET /admin/audit/verify
+	mux.HandleFunc("GET /admin/audit", func(w http.ResponseWriter, r *http.Request) {
+		listAuditEvents(w, r, clientset)
+	})
+	mux.HandleFunc("GET /admin/audit/verify", func(w http.ResponseWriter, r *http.Request) {
+		verifyAuditEvents(w, r, clientset)
+	})
+
+	// GET /admin/scans?namespace=ns
+	// POST /admin/scans/{id}/release?namespace=ns, see releaseArtifacts
+	mux.HandleFunc("GET /admin/scans", func(w http.ResponseWriter, r *http.Request) {
+		listQuarantinedRuns(w, r, clientset)
+	})
+	mux.HandleFunc("POST /admin/scans/{id}/release", func(w http.ResponseWriter, r *http.Request) {
+		releaseArtifacts(w, r, clientset)
+	})
+
+	// POST /admin/history/reparse?namespace=ns&suite=name&since=30d&until=RFC3339
+	// GET /admin/history/reparse
+	mux.HandleFunc("POST /admin/history/reparse", func(w http.ResponseWriter, r *http.Request) {
+		startHistoryReparse(w, r, store)
+	})
+	mux.HandleFunc("GET /admin/history/reparse", getHistoryReparse)
+
+	// POST /admin/results/resync
+	// GET /admin/results/resync
+	mux.HandleFunc("POST /admin/results/resync", func(w http.ResponseWriter, r *http.Request) {
+		startResultsResync(w, r, clientset, store)
+	})
+	mux.HandleFunc("GET /admin/results/resync", getResultsResync)
+
+	// GET /admin/migrations
+	mux.HandleFunc("GET /admin/migrations", getMigrationStatus)
+
+	// GET /admin/retention/log?limit=n&dryRun=true|false
+	mux.HandleFunc("GET /admin/retention/log", func(w http.ResponseWriter, r *http.Request) {
+		listRetentionLog(w, r, clientset)
+	})
+
+	// GET /jobs?namespace=ns&limit=50&continue=token&sort=creationTimestamp|completionTime|duration|name&order=asc|desc&since=24h&until=RFC3339&suite=name&labelSelector=k=v&fieldSelector=metadata.name=job&status=running|succeeded|failed|suspended|cancelled
+	// POST /jobs with a RunSpec, matrix runs answer with a JobListResponse
+	// DELETE /jobs?namespace=ns&name=job&propagation=foreground|background&results=true
 	mux.HandleFunc("/jobs", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-			return
+		switch r.Method {
+		case http.MethodGet:
+			namespace := getNamespace(r.URL.Query().Get("namespace"))
+			listJobs(w, r, clientset, informers, namespace)
+		case http.MethodPost:
+			createJob(w, r, clientset)
+		case http.MethodDelete:
+			deleteJob(w, r, clientset)
+		default:
+			writeError(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
+	})
 
-		namespace := getNamespace(r.URL.Query().Get("namespace"))
-		listJobs(w, r, clientset, namespace)
+	// POST /jobs/rerun?namespace=ns&name=job
+	mux.HandleFunc("POST /jobs/rerun", func(w http.ResponseWriter, r *http.Request) {
+		rerunJob(w, r, clientset)
+	})
+
+	// GET /jobs/watch?namespace=ns&suite=name&labelSelector=k=v&fieldSelector=f=v&status=failed as a WebSocket
+	watcher := newJobWatcher(informers)
+	mux.HandleFunc("GET /jobs/watch", func(w http.ResponseWriter, r *http.Request) {
+		watchJobs(w, r, watcher)
 	})
 
+	// GET /metrics in the Prometheus format, run metrics cover the default namespace
+	mux.Handle("GET /metrics", newMetricsHandler(informers, getNamespace("")))
+
 	// GET /jobs/details?namespace=ns&name=jobname
 	mux.HandleFunc("/jobs/details", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			writeError(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 		namespace := getNamespace(r.URL.Query().Get("namespace"))
 		name := r.URL.Query().Get("name")
 		if namespace == "" || name == "" {
-			http.Error(w, "namespace and name parameters required", http.StatusBadRequest)
+			writeError(w, "namespace and name parameters required", http.StatusBadRequest)
 			return
 		}
-		jobDetails(w, r, clientset, namespace, name)
+		jobDetails(w, r, clientset, informers, namespace, name)
 	})
 
 	mux.HandleFunc("/pod/logs", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			writeError(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
 		podLogs(w, r, clientset)
 	})
 
+	// GET /pod/logs/stream?namespace=ns&pod=name&container=c&tailLines=n as server-sent events
+	mux.HandleFunc("GET /pod/logs/stream", func(w http.ResponseWriter, r *http.Request) {
+		streamPodLogs(w, r, clientset)
+	})
+
+	// GET /runs/{id}?namespace=ns with a Job UID or name
+	mux.HandleFunc("GET /runs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		resolveRun(w, r, clientset)
+	})
+
+	// GET /results?namespace=ns&job=id with a Job UID or name
+	mux.HandleFunc("GET /results", func(w http.ResponseWriter, r *http.Request) {
+		getResults(w, r, clientset)
+	})
+
+	// GET /mergegroups/{id...}?namespace=ns&suites=a,b
+	mux.HandleFunc("GET /mergegroups/{id...}", func(w http.ResponseWriter, r *http.Request) {
+		getMergeGroup(w, r, clientset)
+	})
+
+	// GET /runs/queue?namespace=ns
+	mux.HandleFunc("GET /runs/queue", func(w http.ResponseWriter, r *http.Request) {
+		listQueue(w, r, informers)
+	})
+
+	// GET /runs/diff/logs?namespace=ns&base=run&head=run
+	mux.HandleFunc("GET /runs/diff/logs", func(w http.ResponseWriter, r *http.Request) {
+		diffRunLogs(w, r, clientset)
+	})
+
+	// POST /runs/{id}/signoff?namespace=ns with {"by": "...", "comment": "..."}
+	mux.HandleFunc("POST /runs/{id}/signoff", func(w http.ResponseWriter, r *http.Request) {
+		signOffRun(w, r, clientset)
+	})
+
+	// GET /runs/{id}/signoff?namespace=ns
+	mux.HandleFunc("GET /runs/{id}/signoff", func(w http.ResponseWriter, r *http.Request) {
+		getSignOff(w, r, clientset)
+	})
+
+	// GET /signoff/key
+	mux.HandleFunc("GET /signoff/key", getSignOffKey)
+
+	// GET /checksums/key
+	mux.HandleFunc("GET /checksums/key", getManifestKey)
+
+	// GET /runs/{id}/artifacts?namespace=ns
+	mux.HandleFunc("GET /runs/{id}/artifacts", func(w http.ResponseWriter, r *http.Request) {
+		getRunArtifacts(w, r, clientset)
+	})
+
+	// GET /runs/{id}/report/raw?namespace=ns&format=json|blob&shard=n
+	mux.HandleFunc("GET /runs/{id}/report/raw", func(w http.ResponseWriter, r *http.Request) {
+		getRawReport(w, r, clientset)
+	})
+
+	// GET /runs/{id}/logs/archived?namespace=ns
+	mux.HandleFunc("GET /runs/{id}/logs/archived", func(w http.ResponseWriter, r *http.Request) {
+		getArchivedLogs(w, r, clientset)
+	})
+
+	// GET /runs/{id}/junit.xml?namespace=ns
+	mux.HandleFunc("GET /runs/{id}/junit.xml", func(w http.ResponseWriter, r *http.Request) {
+		getJUnitReport(w, r, clientset)
+	})
+
+	// GET /runs/{id}/scan?namespace=ns with the verdict of the artifact scan
+	mux.HandleFunc("GET /runs/{id}/scan", func(w http.ResponseWriter, r *http.Request) {
+		getArtifactScan(w, r, clientset)
+	})
+
+	// GET /runs/{id}/soak?namespace=ns
+	mux.HandleFunc("GET /runs/{id}/soak", func(w http.ResponseWriter, r *http.Request) {
+		getSoakReport(w, r, clientset)
+	})
+
+	// GET /runs/{id}/spec?namespace=ns
+	mux.HandleFunc("GET /runs/{id}/spec", func(w http.ResponseWriter, r *http.Request) {
+		getRunSpec(w, r, clientset)
+	})
+
+	// POST /runs/{id}/clone?namespace=ns with {"grep": "...", "browser": "...", "baseURL": "..."}
+	mux.HandleFunc("POST /runs/{id}/clone", func(w http.ResponseWriter, r *http.Request) {
+		cloneRun(w, r, clientset)
+	})
+
+	// GET /runs/{id}/bookmarks?namespace=ns&pod=name
+	mux.HandleFunc("GET /runs/{id}/bookmarks", func(w http.ResponseWriter, r *http.Request) {
+		listBookmarks(w, r, clientset)
+	})
+
+	// POST /runs/{id}/bookmarks?namespace=ns
+	mux.HandleFunc("POST /runs/{id}/bookmarks", func(w http.ResponseWriter, r *http.Request) {
+		createBookmark(w, r, clientset)
+	})
+
+	// DELETE /runs/{id}/bookmarks/{bookmark}?namespace=ns
+	mux.HandleFunc("DELETE /runs/{id}/bookmarks/{bookmark}", func(w http.ResponseWriter, r *http.Request) {
+		deleteBookmark(w, r, clientset)
+	})
+
+	// POST /jobs/pin?namespace=ns&name=jobname with an optional {"by": "...", "reason": "..."} body
+	mux.HandleFunc("/jobs/pin", func(w http.ResponseWriter, r *http.Request) {
+		pinHandler(w, r, clientset, true)
+	})
+
+	// POST /jobs/unpin?namespace=ns&name=jobname with an optional {"by": "...", "reason": "..."} body
+	mux.HandleFunc("/jobs/unpin", func(w http.ResponseWriter, r *http.Request) {
+		pinHandler(w, r, clientset, false)
+	})
+
+	// GET /jobs/pinned?namespace=ns
+	mux.HandleFunc("/jobs/pinned", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		listPinned(w, r, clientset, getNamespace(r.URL.Query().Get("namespace")))
+	})
+
+	// GET /gates/{suite}/latest?namespace=ns&branch=b&minPassRate=0.9&window=10
+	mux.HandleFunc("GET /gates/{suite}/latest", func(w http.ResponseWriter, r *http.Request) {
+		suiteGate(w, r, clientset, informers)
+	})
+
+	// GET /stats/status?namespace=ns&window=24h&groupBy=suite|platform|label:<key>
+	mux.HandleFunc("GET /stats/status", func(w http.ResponseWriter, r *http.Request) {
+		statusStats(w, r, informers)
+	})
+
+	// GET /stats/outcomes?namespace=ns&limit=10
+	mux.HandleFunc("GET /stats/outcomes", func(w http.ResponseWriter, r *http.Request) {
+		suiteOutcomes(w, r, informers)
+	})
+
+	// GET /stats/instance?window=24h
+	mux.HandleFunc("GET /stats/instance", func(w http.ResponseWriter, r *http.Request) {
+		getInstanceStats(w, r, clientset)
+	})
+
+	// GET /slo?namespace=ns&window=30d&objective=0.99
+	mux.HandleFunc("GET /slo", func(w http.ResponseWriter, r *http.Request) {
+		sloHandler(w, r, clientset)
+	})
+	mux.HandleFunc("GET /slo/{environment}", func(w http.ResponseWriter, r *http.Request) {
+		sloHandler(w, r, clientset)
+	})
+
+	// GET /monitors?namespace=ns
+	mux.HandleFunc("GET /monitors", func(w http.ResponseWriter, r *http.Request) {
+		listMonitors(w, r, clientset)
+	})
+
+	// POST /monitors?namespace=ns with {"name": "...", "schedule": "*/5 * * * *", "failureThreshold": 3, "run": {...}}
+	mux.HandleFunc("POST /monitors", func(w http.ResponseWriter, r *http.Request) {
+		createMonitor(w, r, clientset)
+	})
+
+	// DELETE /monitors/{name}?namespace=ns
+	mux.HandleFunc("DELETE /monitors/{name}", func(w http.ResponseWriter, r *http.Request) {
+		deleteMonitor(w, r, clientset)
+	})
+
+	// GET /schedules?namespace=ns
+	mux.HandleFunc("GET /schedules", func(w http.ResponseWriter, r *http.Request) {
+		listSchedules(w, r, clientset)
+	})
+
+	// POST /schedules?namespace=ns with {"name": "...", "schedule": "0 6 * * 1-5", "timeZone": "Europe/Berlin",
+	// "suspend": false, "successfulRunsHistoryLimit": 3, "failedRunsHistoryLimit": 1, "run": {...}}
+	mux.HandleFunc("POST /schedules", func(w http.ResponseWriter, r *http.Request) {
+		createSchedule(w, r, clientset)
+	})
+
+	// PATCH /schedules/{name}?namespace=ns with {"suspend": true}
+	mux.HandleFunc("PATCH /schedules/{name}", func(w http.ResponseWriter, r *http.Request) {
+		suspendSchedule(w, r, clientset)
+	})
+
+	// DELETE /schedules/{name}?namespace=ns
+	mux.HandleFunc("DELETE /schedules/{name}", func(w http.ResponseWriter, r *http.Request) {
+		deleteSchedule(w, r, clientset)
+	})
+
+	// GET /monitors/{name}/samples?namespace=ns&window=24h
+	mux.HandleFunc("GET /monitors/{name}/samples", func(w http.ResponseWriter, r *http.Request) {
+		monitorSamples(w, r, clientset)
+	})
+
+	// GET /suites/{name}/browsers?namespace=ns
+	mux.HandleFunc("GET /suites/{name}/browsers", func(w http.ResponseWriter, r *http.Request) {
+		getBrowserMatrix(w, r, clientset)
+	})
+
+	// PUT /suites/{name}/browsers?namespace=ns with {"chromium": ">=120 <131"}
+	mux.HandleFunc("PUT /suites/{name}/browsers", func(w http.ResponseWriter, r *http.Request) {
+		setBrowserMatrix(w, r, clientset)
+	})
+
+	// GET /suites/{name}/policy?namespace=ns
+	mux.HandleFunc("GET /suites/{name}/policy", func(w http.ResponseWriter, r *http.Request) {
+		getSuitePolicy(w, r, clientset)
+	})
+
+	// PUT /suites/{name}/policy?namespace=ns with {"concurrency": "allow|cancel-superseded", "retention": {"passingSamplePercent": 10}}
+	mux.HandleFunc("PUT /suites/{name}/policy", func(w http.ResponseWriter, r *http.Request) {
+		setSuitePolicy(w, r, clientset)
+	})
+
+	// GET /logfilters?namespace=ns
+	mux.HandleFunc("GET /logfilters", func(w http.ResponseWriter, r *http.Request) {
+		getLogFilters(w, r, clientset)
+	})
+
+	// PUT /logfilters?namespace=ns with [{"name": "...", "pattern": "...", "action": "hide|collapse"}]
+	mux.HandleFunc("PUT /logfilters", func(w http.ResponseWriter, r *http.Request) {
+		setLogFilters(w, r, clientset)
+	})
+
+	// GET /warmpool?namespace=ns
+	mux.HandleFunc("GET /warmpool", func(w http.ResponseWriter, r *http.Request) {
+		warmPoolStatus(w, r, clientset)
+	})
+
+	// GET /warmpool/assignment?namespace=ns&pod=name, polled by the agent of warm runs
+	mux.HandleFunc("GET /warmpool/assignment", func(w http.ResponseWriter, r *http.Request) {
+		warmAssignment(w, r, clientset)
+	})
+
+	// GET /tests/flaky?namespace=ns&suite=name&window=30d
+	// GET /tests/history?namespace=ns&suite=name&since=30d&until=RFC3339
+	mux.HandleFunc("GET /tests/flaky", getFlakyTests)
+	mux.HandleFunc("GET /tests/history", func(w http.ResponseWriter, r *http.Request) {
+		getTestHistory(w, r, store)
+	})
+
+	// GET /traceability?namespace=ns&suite=name&annotation=requirement&format=json|csv
+	mux.HandleFunc("GET /traceability", func(w http.ResponseWriter, r *http.Request) {
+		getTraceability(w, r, clientset)
+	})
+
+	// GET /suites/{name}/baseline?namespace=ns&branch=b
+	mux.HandleFunc("GET /suites/{name}/baseline", func(w http.ResponseWriter, r *http.Request) {
+		getBaseline(w, r, clientset)
+	})
+
+	// POST /suites/{name}/baseline?namespace=ns with {"run": "jobname", "branch": "b", "by": "...", "reason": "..."}
+	mux.HandleFunc("POST /suites/{name}/baseline", func(w http.ResponseWriter, r *http.Request) {
+		setBaseline(w, r, clientset)
+	})
+
+	// GET /suppressions?namespace=ns
+	mux.HandleFunc("GET /suppressions", func(w http.ResponseWriter, r *http.Request) {
+		listSuppressions(w, r, clientset)
+	})
+
+	// GET /suppressions/expired
+	mux.HandleFunc("GET /suppressions/expired", func(w http.ResponseWriter, r *http.Request) {
+		listExpiredSuppressions(w, r, clientset)
+	})
+
+	// POST /suppressions?namespace=ns with {"pattern": "...", "reason": "...", "expires": "RFC3339"}
+	mux.HandleFunc("POST /suppressions", func(w http.ResponseWriter, r *http.Request) {
+		createSuppression(w, r, clientset)
+	})
+
+	// DELETE /suppressions/{id}?namespace=ns
+	mux.HandleFunc("DELETE /suppressions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		deleteSuppression(w, r, clientset)
+	})
+
+	// POST /admin/selftest?namespace=ns starts the dashboard self-test, GET reports the latest run
+	mux.HandleFunc("/admin/selftest", func(w http.ResponseWriter, r *http.Request) {
+		namespace := getNamespace(r.URL.Query().Get("namespace"))
+		switch r.Method {
+		case http.MethodPost:
+			startSelftest(w, r, clientset, namespace)
+		case http.MethodGet:
+			selftestStatus(w, r, clientset, namespace)
+		default:
+			writeError(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// POST /selftest/session, asked by the dashboard when the self-test signs in
+	mux.HandleFunc("POST /selftest/session", func(w http.ResponseWriter, r *http.Request) {
+		selftestSession(w, r, clientset)
+	})
+
+	logOpenAPIDrift(mux)
+
+	ipCfg, err := clientip.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("invalid client address settings: %v", err)
+	}
+
 	addr := ":8080"
-	log.Printf("REST API listening on %s", addr)
+	info := buildinfo.Get()
+	log.Printf("REST API %s (%s, built %s) listening on %s", info.Version, info.Commit, info.BuildDate, addr)
 	srv := &http.Server{
 		Addr:              addr,
-		Handler:           loggingMiddleware(mux),
+		Handler:           clientip.Middleware(ipCfg, inClusterPaths, writeError, logging.Middleware(inClusterPaths, metricsMiddleware(authMiddleware(authConfigFromEnv(), audit.middleware(routePatternMiddleware(mux)))))),
 		ReadHeaderTimeout: 5 * time.Second,
 		ReadTimeout:       10 * time.Second,
 		WriteTimeout:      10 * time.Second,
 		IdleTimeout:       60 * time.Second,
 	}
 
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if err := shutdown.Serve(ctx, srv); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("Server Error: %v", err)
 	}
 }
@@ -102,104 +651,266 @@ func getNamespace(namespace string) string {
 	return namespace
 }
 
-func loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		next.ServeHTTP(w, r)
-		log.Printf("%s %s %s %s", r.Host, r.UserAgent(), r.Method, r.URL.String())
-	})
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return fallback
 }
 
-func newKubeClient() (*kubernetes.Clientset, error) {
-	in, err := rest.InClusterConfig()
-	if err == nil {
-		return kubernetes.NewForConfig(in)
+// newKubeConfig uses the in-cluster config unless a kubeconfig or context is given. Outside
+// of a cluster it falls back to the kubeconfig loading rules of kubectl, so the API can run
+// locally against a development cluster.
+func newKubeConfig(kubeconfig, kubeContext string) (*rest.Config, error) {
+	if kubeconfig == "" && kubeContext == "" {
+		in, err := rest.InClusterConfig()
+		if err == nil {
+			log.Printf("using in-cluster Kubernetes config")
+			return in, nil
+		}
+		if err != rest.ErrNotInCluster {
+			return nil, err
+		}
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: kubeContext})
+
+	raw, err := loader.RawConfig()
+	if err != nil {
+		return nil, err
+	}
+	config, err := loader.ClientConfig()
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, err
+	if kubeContext == "" {
+		kubeContext = raw.CurrentContext
+	}
+	source := kubeconfig
+	if source == "" {
+		source = strings.Join(rules.GetLoadingPrecedence(), string(os.PathListSeparator))
+	}
+	log.Printf("using kubeconfig %s, context %s, server %s", source, kubeContext, config.Host)
+
+	return config, nil
 }
 
-func listJobs(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset, namespace string) {
-	ctx := context.Background()
-	opts := metav1.ListOptions{}
+func listJobs(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset, informers *runInformers, namespace string) {
+	ctx := r.Context()
+	limit, offset, err := parseJobPage(r.URL.Query())
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sortKey, asc, err := parseJobSort(r.URL.Query())
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, opts)
+	since, until, err := parseTimeRange(r.URL.Query(), time.Now())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	sort.Slice(jobs.Items, func(i, j int) bool {
-		return jobs.Items[i].CreationTimestamp.After(jobs.Items[j].CreationTimestamp.Time)
-	})
+	query, err := parseJobFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query.since, query.until = since, until
+
+	ni, err := informers.synced(r.Context(), namespace)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	refs := informers.jobs.refs(namespace, query)
+	sortJobRefs(refs, sortKey, asc)
+	refs, next := pageJobs(refs, limit, offset)
+	jobs := copyJobs(refs)
+
+	rules, err := cachedSuppressions(ctx, informers, namespace)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	queue, _, err := runQueue(ctx, informers, namespace)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
 
 	resp := JobListResponse{
-		Items:    jobs.Items,
-		Continue: jobs.Continue,
+		Items:     jobs,
+		Continue:  next,
+		Summaries: map[string]JobSummary{},
+		Queue:     queue,
+	}
+	for i := range jobs {
+		resp.Summaries[string(jobs[i].UID)] = summarizeJob(&jobs[i])
+
+		if suppression := suppressionFor(rules, &jobs[i]); suppression.suppressed() {
+			if resp.Suppressed == nil {
+				resp.Suppressed = map[string]string{}
+			}
+			resp.Suppressed[string(jobs[i].UID)] = suppression.reason()
+		}
 	}
 
+	ni.setFreshness(w)
 	respondJSON(w, resp)
 }
 
 // /jobs/details Handler
-func jobDetails(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset, namespace, name string) {
-	ctx := context.Background()
+func jobDetails(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset, informers *runInformers, namespace, name string) {
+	ctx := r.Context()
 
-	job, err := clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	ni, err := informers.synced(r.Context(), namespace)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err.Error(), http.StatusServiceUnavailable)
 		return
 	}
+	job := ni.job(namespace, name)
+	if job == nil {
+		writeError(w, "job not found", http.StatusNotFound)
+		return
+	}
+	pods := ni.podsOf(name)
 
-	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("job-name=%s", name),
-	})
+	comparison, err := compareRun(ctx, clientset, informers, job)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	rules, err := cachedSuppressions(ctx, informers, namespace)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	versions := browserVersions(pods)
+	browserWarnings, err := browserSkew(ctx, clientset, namespace, job.Labels[suiteLabel], versions)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	matrix, err := matrixBreakdown(ctx, clientset, job)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondError(w, err)
 		return
 	}
 
 	response := JobDetailsResponse{
-		Job:  job,
-		Pods: pods.Items,
+		Job:             job,
+		Pods:            pods,
+		ImagePullErrors: imagePullErrors(pods),
+		Budget:          evaluateBudget(job),
+		Comparison:      comparison,
+		Suppression:     suppressionFor(rules, job),
+		Kubectl:         kubectlHints(job, pods),
+		BrowserVersions: versions,
+		BrowserWarnings: browserWarnings,
+		Preemptions:     preemptions(pods),
+		Matrix:          matrix,
+		Containers:      map[string][]PodContainer{},
+		Shards:          shardStatuses(job, pods),
+		Cost:            runCost(job, pods, time.Now()),
+		SignOff:         storedSignOff(job),
+	}
+	for i := range pods {
+		response.Containers[pods[i].Name] = podContainers(&pods[i])
 	}
 
+	if reason, _ := waitReason(job, pods); reason != "" {
+		queue, _, err := runQueue(ctx, informers, namespace)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		if status, ok := queue[string(job.UID)]; ok {
+			response.Queue = &status
+		}
+	}
+
+	ni.setFreshness(w)
 	respondJSON(w, response)
 }
 
-// GET /jobs/logs?namespace=X&pod=Y
+// GET /pod/logs?namespace=X&pod=Y&container=C&allContainers=true shows the logs of a
+// container, the default container of the pod without one, or of all containers. See
+// podLogOptions for tailLines, sinceSeconds, sinceTime, previous and timestamps, e.g.
+// tailLines=500 for the end of a long run or previous=true for a crashed container.
 func podLogs(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
-	namespace := getNamespace(r.URL.Query().Get("namespace"))
-	pod := r.URL.Query().Get("pod")
+	query := r.URL.Query()
+	namespace := getNamespace(query.Get("namespace"))
+	podName := query.Get("pod")
+	allContainers := query.Get("allContainers") == "true"
 
-	if namespace == "" || pod == "" {
-		http.Error(w, "namespace and pod are required", http.StatusBadRequest)
+	if namespace == "" || podName == "" {
+		writeError(w, "namespace and pod are required", http.StatusBadRequest)
 		return
 	}
 
-	req := clientset.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{})
-	stream, err := req.Stream(r.Context())
+	opts, err := podLogOptions(query)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer stream.Close()
+	container := opts.Container
+
+	// pods with sidecars need a container, which the pod tells when none is given
+	if container == "" || allContainers {
+		pod, err := clientset.CoreV1().Pods(namespace).Get(r.Context(), podName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			writeError(w, "pod not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+
+		if allContainers {
+			respondJSON(w, map[string]string{
+				"logs": allContainerLogs(r.Context(), clientset, pod, *opts),
+			})
+			return
+		}
+		container = defaultContainer(pod)
+	}
 
-	logData, err := io.ReadAll(stream)
+	logs, err := containerLogs(r.Context(), clientset, namespace, podName, container, *opts)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		respondError(w, err)
 		return
 	}
 
 	respondJSON(w, map[string]string{
-		"logs": string(logData),
+		"logs":      logs,
+		"container": container,
 	})
 }
 
 func respondJSON(w http.ResponseWriter, data interface{}) {
+	respondJSONStatus(w, http.StatusOK, data)
+}
+
+func respondJSONStatus(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	enc := json.NewEncoder(w)
 	enc.SetIndent("", "  ")
 	if err := enc.Encode(data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondError(w, err)
 	}
 }
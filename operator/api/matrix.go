@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	// the API image has no time zone database to validate timezones against
+	_ "time/tzdata"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The runs of a matrix share matrixLabel, each records its device, locale and timezone in
+// annotations. Device names like "iPhone 14" are no valid label values.
+const (
+	matrixLabel        = "playwright.operator/matrix"
+	deviceAnnotation   = "playwright.operator/device"
+	localeAnnotation   = "playwright.operator/locale"
+	timezoneAnnotation = "playwright.operator/timezone"
+	maxMatrixRuns      = 20
+)
+
+var (
+	nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+	// localePattern matches BCP 47 tags of a language with optional script and region,
+	// e.g. de, de-CH, zh-Hant-TW or es-419.
+	localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z][a-z]{3})?(-([A-Z]{2}|[0-9]{3}))?$`)
+)
+
+// slug turns a matrix value into a part of a Job name, "iPhone 14" into iphone-14.
+func slug(value string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(value), "-"), "-")
+}
+
+// isMatrix reports whether the spec fans out into several runs.
+func (spec RunSpec) isMatrix() bool {
+	return len(spec.Devices) > 0 || len(spec.Locales) > 0 || len(spec.Timezones) > 0
+}
+
+// validateLocale checks the locale and timezone of a run.
+func validateLocale(locale, timezone string) error {
+	if locale != "" && !localePattern.MatchString(locale) {
+		return fmt.Errorf("invalid locale %q, expected a tag like en-US", locale)
+	}
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+			return fmt.Errorf("invalid timezone %q, expected an IANA name like Europe/Berlin", timezone)
+		}
+	}
+
+	return nil
+}
+
+// posixLocale turns a locale into a value of LANG, de-CH into de_CH.UTF-8.
+func posixLocale(locale string) string {
+	return strings.ReplaceAll(locale, "-", "_") + ".UTF-8"
+}
+
+// matrixAxis returns the values of one dimension of a matrix, a single empty value when
+// the matrix does not vary it.
+func matrixAxis(values []string, single, name string) ([]string, error) {
+	if len(values) == 0 {
+		return []string{""}, nil
+	}
+	if single != "" {
+		return nil, fmt.Errorf("%s and %ss are mutually exclusive", name, name)
+	}
+
+	return values, nil
+}
+
+// matrixRuns expands a run with devices, locales or timezones into one run per
+// combination and validates them. The suite reads them from PLAYWRIGHT_DEVICE,
+// PLAYWRIGHT_LOCALE and PLAYWRIGHT_TIMEZONE, e.g. with
+// use: { ...devices[process.env.PLAYWRIGHT_DEVICE], locale: process.env.PLAYWRIGHT_LOCALE }.
+func matrixRuns(spec RunSpec) ([]RunSpec, error) {
+	devices, err := matrixAxis(spec.Devices, spec.Device, "device")
+	if err != nil {
+		return nil, err
+	}
+	locales, err := matrixAxis(spec.Locales, spec.Locale, "locale")
+	if err != nil {
+		return nil, err
+	}
+	timezones, err := matrixAxis(spec.Timezones, spec.Timezone, "timezone")
+	if err != nil {
+		return nil, err
+	}
+	if n := len(devices) * len(locales) * len(timezones); n > maxMatrixRuns {
+		return nil, fmt.Errorf("a matrix has at most %d runs, not %d", maxMatrixRuns, n)
+	}
+
+	matrix := string(uuid.NewUUID())
+	slugs := map[string]bool{}
+	var runs []RunSpec
+	for _, device := range devices {
+		for _, locale := range locales {
+			for _, timezone := range timezones {
+				run := spec
+				run.Devices, run.Locales, run.Timezones = nil, nil, nil
+				if device != "" {
+					run.Device = device
+				}
+				if locale != "" {
+					run.Locale = locale
+				}
+				if timezone != "" {
+					run.Timezone = timezone
+				}
+				run.matrix = matrix
+
+				var parts []string
+				for _, value := range []string{device, locale, timezone} {
+					if s := slug(value); s != "" {
+						parts = append(parts, s)
+					} else if value != "" {
+						return nil, fmt.Errorf("invalid matrix value %q", value)
+					}
+				}
+				suffix := strings.Join(parts, "-")
+				if slugs[suffix] {
+					return nil, fmt.Errorf("%s is in the matrix twice", strings.Join(run.matrixValues(), ", "))
+				}
+				slugs[suffix] = true
+
+				if run.Name != "" {
+					run.Name += "-" + suffix
+				} else {
+					run.GenerateName = strings.TrimSuffix(run.GenerateName, "-")
+					if run.GenerateName == "" {
+						run.GenerateName = "playwright-run"
+					}
+					run.GenerateName += "-" + suffix + "-"
+				}
+				if _, err := newRunJob(run); err != nil {
+					return nil, fmt.Errorf("%s: %w", strings.Join(run.matrixValues(), ", "), err)
+				}
+				runs = append(runs, run)
+			}
+		}
+	}
+
+	return runs, nil
+}
+
+// matrixValues returns the device, locale and timezone a run of a matrix was given.
+func (spec RunSpec) matrixValues() []string {
+	var values []string
+	for _, value := range []string{spec.Device, spec.Locale, spec.Timezone} {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// createMatrix creates the runs of a matrix, the runs created before a failure are
+// returned with the error.
+func createMatrix(ctx context.Context, clientset *kubernetes.Clientset, runs []RunSpec) ([]batchv1.Job, error) {
+	var created []batchv1.Job
+	for _, run := range runs {
+		job, err := createRun(ctx, clientset, run)
+		if job != nil {
+			created = append(created, *job)
+		}
+		if err != nil {
+			return created, fmt.Errorf("%s: %w", strings.Join(run.matrixValues(), ", "), err)
+		}
+	}
+
+	return created, nil
+}
+
+// MatrixRun is the result of one combination of a matrix.
+type MatrixRun struct {
+	Device    string      `json:"device,omitempty"`
+	Locale    string      `json:"locale,omitempty"`
+	Timezone  string      `json:"timezone,omitempty"`
+	Namespace string      `json:"namespace"`
+	Name      string      `json:"name"`
+	UID       string      `json:"uid"`
+	State     string      `json:"state"`
+	Counts    *TestCounts `json:"counts,omitempty"`
+}
+
+// matrixBreakdown returns the results of all runs of the matrix of a run, or nothing for
+// runs outside of a matrix.
+func matrixBreakdown(ctx context.Context, clientset *kubernetes.Clientset, job *batchv1.Job) ([]MatrixRun, error) {
+	matrix := job.Labels[matrixLabel]
+	if matrix == "" {
+		return nil, nil
+	}
+
+	selector := matrixLabel + "=" + matrix
+	jobs, err := clientset.BatchV1().Jobs(job.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	pods, err := clientset.CoreV1().Pods(job.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	podsByJob := map[string][]corev1.Pod{}
+	for _, pod := range pods.Items {
+		name := pod.Labels[batchv1.JobNameLabel]
+		podsByJob[name] = append(podsByJob[name], pod)
+	}
+
+	runs := make([]MatrixRun, 0, len(jobs.Items))
+	for i := range jobs.Items {
+		j := &jobs.Items[i]
+		runs = append(runs, MatrixRun{
+			Device:    j.Annotations[deviceAnnotation],
+			Locale:    j.Annotations[localeAnnotation],
+			Timezone:  j.Annotations[timezoneAnnotation],
+			Namespace: j.Namespace,
+			Name:      j.Name,
+			UID:       string(j.UID),
+			State:     jobState(j),
+			Counts:    testCounts(podsByJob[j.Name]),
+		})
+	}
+	sort.Slice(runs, func(i, k int) bool {
+		a, b := runs[i], runs[k]
+		if a.Device != b.Device {
+			return a.Device < b.Device
+		}
+		if a.Locale != b.Locale {
+			return a.Locale < b.Locale
+		}
+		return a.Timezone < b.Timezone
+	})
+
+	return runs, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Runs triggered for a merge queue carry the merge group they test, e.g. the head SHA of
+// a GitHub merge_group event. The label holds a label-safe form of the identifier, the
+// annotation the identifier itself.
+const (
+	mergeGroupLabel      = "playwright.operator/merge-group"
+	mergeGroupAnnotation = "playwright.operator/merge-group"
+)
+
+const (
+	mergeGroupPending = "pending"
+	mergeGroupSuccess = "success"
+	mergeGroupFailure = "failure"
+)
+
+type MergeGroupRun struct {
+	Suite string `json:"suite"`
+	Run   RunRef `json:"run"`
+	State string `json:"state"`
+}
+
+// MergeGroupStatus aggregates the latest run of each suite of a merge group.
+type MergeGroupStatus struct {
+	ID    string          `json:"id"`
+	State string          `json:"state"`
+	Runs  []MergeGroupRun `json:"runs"`
+	// Missing lists required suites without a run in the group yet.
+	Missing []string `json:"missing,omitempty"`
+}
+
+// mergeGroupLabelValue returns the identifier when it is a valid label value, and a hash
+// of it otherwise, as merge group refs can be long and contain slashes.
+func mergeGroupLabelValue(id string) string {
+	if len(validation.IsValidLabelValue(id)) == 0 {
+		return id
+	}
+
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])[:40]
+}
+
+// mergeGroupStatus fails when the latest run of any suite failed, and is pending while
+// one runs or a required suite has no run. Cancelled runs are left out.
+func mergeGroupStatus(id string, jobs []batchv1.Job, required []string) MergeGroupStatus {
+	sortJobs(jobs, "creationTimestamp", false)
+
+	status := MergeGroupStatus{ID: id, State: mergeGroupSuccess, Runs: []MergeGroupRun{}}
+	seen := map[string]bool{}
+	for i := range jobs {
+		job := &jobs[i]
+		state := jobState(job)
+		suite := job.Labels[suiteLabel]
+		if state == jobStateCancelled || seen[suite] {
+			continue
+		}
+		seen[suite] = true
+
+		status.Runs = append(status.Runs, MergeGroupRun{
+			Suite: suite,
+			Run:   RunRef{Namespace: job.Namespace, Name: job.Name, UID: string(job.UID)},
+			State: state,
+		})
+		switch state {
+		case jobStateFailed:
+			status.State = mergeGroupFailure
+		case jobStateSucceeded:
+		default:
+			if status.State != mergeGroupFailure {
+				status.State = mergeGroupPending
+			}
+		}
+	}
+	sort.Slice(status.Runs, func(i, j int) bool {
+		return status.Runs[i].Suite < status.Runs[j].Suite
+	})
+
+	for _, suite := range required {
+		if !seen[suite] {
+			status.Missing = append(status.Missing, suite)
+			if status.State != mergeGroupFailure {
+				status.State = mergeGroupPending
+			}
+		}
+	}
+
+	return status
+}
+
+// GET /mergegroups/{id...}?namespace=ns&suites=a,b with ids like gh-readonly-queue/main/pr-1-<sha>
+//
+// Answers 200 when the group succeeded, 412 when it failed and 503 with Retry-After while
+// it is pending, so a merge queue check can wait with `curl -f --retry N`.
+func getMergeGroup(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	query := r.URL.Query()
+	id := r.PathValue("id")
+
+	var required []string
+	for _, suite := range strings.Split(query.Get("suites"), ",") {
+		if suite = strings.TrimSpace(suite); suite != "" {
+			required = append(required, suite)
+		}
+	}
+
+	jobs, err := clientset.BatchV1().Jobs(getNamespace(query.Get("namespace"))).List(r.Context(), metav1.ListOptions{
+		LabelSelector: labels.Set{mergeGroupLabel: mergeGroupLabelValue(id)}.String(),
+	})
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	// hashed label values could collide, the annotation tells
+	var runs []batchv1.Job
+	for _, job := range jobs.Items {
+		if job.Annotations[mergeGroupAnnotation] == id {
+			runs = append(runs, job)
+		}
+	}
+
+	status := mergeGroupStatus(id, runs, required)
+	if len(status.Runs) == 0 && len(required) == 0 {
+		writeError(w, "no runs for merge group "+id, http.StatusNotFound)
+		return
+	}
+
+	switch status.State {
+	case mergeGroupFailure:
+		respondJSONStatus(w, http.StatusPreconditionFailed, status)
+	case mergeGroupPending:
+		w.Header().Set("Retry-After", "30")
+		respondJSONStatus(w, http.StatusServiceUnavailable, status)
+	default:
+		respondJSON(w, status)
+	}
+}
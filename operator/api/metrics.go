@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"shared/logging"
+)
+
+var (
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "playwright_api_request_duration_seconds",
+		Help:    "Latency of the requests to the API by handler, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"handler", "method", "code"})
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "playwright_api_requests_total",
+		Help: "Requests to the API by handler, method and status code.",
+	}, []string{"handler", "method", "code"})
+	expiredSuppressions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "playwright_suppressions_expired",
+		Help: "Suppression rules past their expiry by namespace, see warnExpiredSuppressions.",
+	}, []string{"namespace"})
+
+	runningJobsDesc = prometheus.NewDesc("playwright_running_jobs",
+		"Runs that have not finished yet.", nil, nil)
+	failedRunsDesc = prometheus.NewDesc("playwright_failed_runs_last_24h",
+		"Runs that failed within the last 24 hours.", nil, nil)
+	suiteDurationDesc = prometheus.NewDesc("playwright_suite_run_duration_seconds_average",
+		"Average duration of the succeeded runs of a suite.", []string{"suite"}, nil)
+
+	jobCacheShardsDesc = prometheus.NewDesc("playwright_job_cache_shards",
+		"Namespaces the job cache holds runs of.", nil, nil)
+	jobCacheJobsDesc = prometheus.NewDesc("playwright_job_cache_jobs",
+		"Runs in the job cache.", nil, nil)
+	jobCacheLookupsDesc = prometheus.NewDesc("playwright_job_cache_lookups_total",
+		"Listings served from the job cache.", nil, nil)
+)
+
+// runCollector derives gauges from the runs of a namespace, read from the shared run
+// informers, so scrapes cost no calls to the API server.
+type runCollector struct {
+	informers *runInformers
+	namespace string
+}
+
+func (c runCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- runningJobsDesc
+	ch <- failedRunsDesc
+	ch <- suiteDurationDesc
+}
+
+// failedAt returns when a run failed.
+func failedAt(job *batchv1.Job) (time.Time, bool) {
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			return c.LastTransitionTime.Time, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func (c runCollector) Collect(ch chan<- prometheus.Metric) {
+	informer := c.informers.namespace(c.namespace).jobs
+	// an empty store of a starting informer would report no runs at all
+	if !informer.HasSynced() {
+		return
+	}
+
+	var running, failed int
+	durations := map[string][]time.Duration{}
+	for _, obj := range informer.GetStore().List() {
+		job, ok := obj.(*batchv1.Job)
+		if !ok {
+			continue
+		}
+
+		switch jobState(job) {
+		case jobStateRunning:
+			running++
+		case jobStateFailed:
+			if at, ok := failedAt(job); ok && time.Since(at) < 24*time.Hour {
+				failed++
+			}
+		case jobStateSucceeded:
+			if suite := job.Labels[suiteLabel]; suite != "" {
+				if d, ok := jobDuration(job); ok {
+					durations[suite] = append(durations[suite], d)
+				}
+			}
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(runningJobsDesc, prometheus.GaugeValue, float64(running))
+	ch <- prometheus.MustNewConstMetric(failedRunsDesc, prometheus.GaugeValue, float64(failed))
+	for suite, ds := range durations {
+		var total time.Duration
+		for _, d := range ds {
+			total += d
+		}
+		ch <- prometheus.MustNewConstMetric(suiteDurationDesc, prometheus.GaugeValue, (total / time.Duration(len(ds))).Seconds(), suite)
+	}
+}
+
+// jobCacheCollector reports the size and use of the job cache, see jobCache.stats.
+type jobCacheCollector struct {
+	cache *jobCache
+}
+
+func (c jobCacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- jobCacheShardsDesc
+	ch <- jobCacheJobsDesc
+	ch <- jobCacheLookupsDesc
+}
+
+func (c jobCacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.cache.stats()
+	ch <- prometheus.MustNewConstMetric(jobCacheShardsDesc, prometheus.GaugeValue, float64(stats.Shards))
+	ch <- prometheus.MustNewConstMetric(jobCacheJobsDesc, prometheus.GaugeValue, float64(stats.Jobs))
+	ch <- prometheus.MustNewConstMetric(jobCacheLookupsDesc, prometheus.CounterValue, float64(stats.Lookups))
+}
+
+// newMetricsHandler serves the request metrics, the run metrics of the namespace, the
+// metrics of the job cache and those of the process.
+func newMetricsHandler(informers *runInformers, namespace string) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestDuration,
+		requestsTotal,
+		expiredSuppressions,
+		runCollector{informers: informers, namespace: namespace},
+		jobCacheCollector{cache: informers.jobs},
+	)
+
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+type routePatternContextKey struct{}
+
+// routePatternMiddleware wraps the mux and reports the pattern it routed a request to
+// to metricsMiddleware, as the middlewares in between, e.g. authMiddleware, pass a copy
+// of the request on.
+func routePatternMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if pattern, ok := r.Context().Value(routePatternContextKey{}).(*string); ok {
+			*pattern = r.Pattern
+		}
+	})
+}
+
+// metricsMiddleware records the latency and count of requests by the pattern of the
+// handler that served them, see routePatternMiddleware, unmatched requests count as
+// handler "none".
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &logging.StatusRecorder{ResponseWriter: w}
+		handler := r.Pattern
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), routePatternContextKey{}, &handler)))
+
+		if handler == "" {
+			handler = "none"
+		}
+		if recorder.Status == 0 {
+			recorder.Status = http.StatusOK
+		}
+		code := strconv.Itoa(recorder.Status)
+		requestDuration.WithLabelValues(handler, r.Method, code).Observe(time.Since(start).Seconds())
+		requestsTotal.WithLabelValues(handler, r.Method, code).Inc()
+	})
+}
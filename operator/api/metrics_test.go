@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func requestCount(t *testing.T, handler, method, code string) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := requestsTotal.WithLabelValues(handler, method, code).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+
+	return m.GetCounter().GetValue()
+}
+
+func TestMetricsMiddlewareRecordsPattern(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jobs/{name}", func(w http.ResponseWriter, r *http.Request) {})
+
+	// like authMiddleware, pass a copy of the request with claims on
+	withClaims := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey{}, map[string]interface{}{})))
+		})
+	}
+	handler := metricsMiddleware(withClaims(routePatternMiddleware(mux)))
+
+	before := requestCount(t, "GET /jobs/{name}", http.MethodGet, "200")
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/jobs/checkout-1", nil))
+	if got := requestCount(t, "GET /jobs/{name}", http.MethodGet, "200"); got != before+1 {
+		t.Errorf("requests of the pattern = %v, want %v", got, before+1)
+	}
+
+	before = requestCount(t, "none", http.MethodGet, "404")
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	if got := requestCount(t, "none", http.MethodGet, "404"); got != before+1 {
+		t.Errorf("unmatched requests = %v, want %v", got, before+1)
+	}
+}
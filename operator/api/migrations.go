@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const schemaVersionFile = ".schema-version"
+
+// migration upgrades the data stored below the results directory by one version.
+// Migrations must be idempotent, a crash before the version stamp is written
+// runs the migration again on the next start.
+type migration struct {
+	version     int
+	description string
+	apply       func(root string) error
+}
+
+// migrations are applied in order, new entries are appended with the next version.
+// Versions 1 and 2 were applied by the dashboard before the API took them over.
+var migrations = []migration{
+	{
+		// the API writes the manifests of finished runs since, see signRunReports
+		version:     1,
+		description: "generate checksum manifests for reports stored before integrity checks",
+		apply:       func(string) error { return nil },
+	},
+	{
+		version:     2,
+		description: "remove the unsigned checksum manifests written on first request",
+		apply:       removeFirstRequestManifests,
+	},
+	{
+		version:     3,
+		description: "partition the test history of suites by month",
+		apply:       partitionHistory,
+	},
+	{
+		version:     4,
+		description: "build the daily aggregates of the test history",
+		apply:       aggregateHistory,
+	},
+}
+
+// MigrationStatus is the progress of the migrations of the results directory.
+type MigrationStatus struct {
+	Version  int       `json:"version"`
+	Latest   int       `json:"latest"`
+	Running  bool      `json:"running"`
+	Started  time.Time `json:"started,omitempty"`
+	Finished time.Time `json:"finished,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+var (
+	migrationMu     sync.Mutex
+	migrationStatus MigrationStatus
+)
+
+func setMigrationStatus(update func(*MigrationStatus)) {
+	migrationMu.Lock()
+	defer migrationMu.Unlock()
+	update(&migrationStatus)
+}
+
+func readSchemaVersion(root string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(root, schemaVersionFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+func writeSchemaVersion(root string, version int) error {
+	return os.WriteFile(filepath.Join(root, schemaVersionFile), []byte(strconv.Itoa(version)+"\n"), 0o644)
+}
+
+// checkSchemaVersion returns the schema version of the results directory. It refuses data
+// written by a newer API, a downgrade would silently misread it.
+func checkSchemaVersion(root string) (int, error) {
+	current, err := readSchemaVersion(root)
+	if err != nil {
+		return 0, fmt.Errorf("reading schema version: %w", err)
+	}
+
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return 0, fmt.Errorf("results were written by schema version %d, this API supports up to %d", current, latest)
+	}
+	setMigrationStatus(func(s *MigrationStatus) {
+		s.Version = current
+		s.Latest = latest
+	})
+
+	return current, nil
+}
+
+// migrate brings the results directory forward from version current to the latest schema
+// version. It runs next to the API serving requests, see GET /admin/migrations.
+func migrate(root string, current int) {
+	setMigrationStatus(func(s *MigrationStatus) {
+		s.Running = true
+		s.Started = time.Now().UTC()
+	})
+	err := applyMigrations(root, current)
+	setMigrationStatus(func(s *MigrationStatus) {
+		s.Running = false
+		s.Finished = time.Now().UTC()
+		if err != nil {
+			s.Error = err.Error()
+		}
+	})
+	if err != nil {
+		log.Printf("cannot migrate %s: %v", root, err)
+	}
+}
+
+func applyMigrations(root string, current int) error {
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		log.Printf("Migrating results to schema version %d: %s", m.version, m.description)
+		if err := m.apply(root); err != nil {
+			return fmt.Errorf("migration %d: %w", m.version, err)
+		}
+		if err := writeSchemaVersion(root, m.version); err != nil {
+			return fmt.Errorf("migration %d: %w", m.version, err)
+		}
+		setMigrationStatus(func(s *MigrationStatus) { s.Version = m.version })
+	}
+
+	return nil
+}
+
+// removeFirstRequestManifests removes the version 1 manifests the dashboard wrote when a
+// report was first requested, possibly while its run was still writing it. The API writes
+// signed ones for every finished run instead.
+func removeFirstRequestManifests(root string) error {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		file := filepath.Join(root, entry.Name(), checksumManifestName)
+		data, err := os.ReadFile(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		var manifest struct {
+			Version int `json:"version"`
+		}
+		if json.Unmarshal(data, &manifest) == nil && manifest.Version >= checksumManifestVersion {
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// GET /admin/migrations reports the schema version of the results directory and the
+// progress of its migrations.
+func getMigrationStatus(w http.ResponseWriter, r *http.Request) {
+	migrationMu.Lock()
+	status := migrationStatus
+	migrationMu.Unlock()
+
+	respondJSON(w, status)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateRemovesFirstRequestManifests(t *testing.T) {
+	dir := useResultsDir(t)
+	for uid, manifest := range map[string]string{
+		runningPodUID: `{"version": 1}`,
+		pinnedPodUID:  `{"version": 2}`,
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, uid), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, uid, checksumManifestName), []byte(manifest), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeSchemaVersion(dir, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := checkSchemaVersion(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrate(dir, current)
+
+	if _, err := os.Stat(filepath.Join(dir, runningPodUID, checksumManifestName)); !os.IsNotExist(err) {
+		t.Errorf("the version 1 manifest is still there: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, pinnedPodUID, checksumManifestName)); err != nil {
+		t.Errorf("the version 2 manifest was removed: %v", err)
+	}
+	if version, _ := readSchemaVersion(dir); version != migrations[len(migrations)-1].version {
+		t.Errorf("schema version = %d, want the latest", version)
+	}
+	if migrationStatus.Running || migrationStatus.Error != "" {
+		t.Errorf("status = %+v, want a finished migration", migrationStatus)
+	}
+}
+
+func TestCheckSchemaVersionRefusesNewerData(t *testing.T) {
+	dir := useResultsDir(t)
+	if err := writeSchemaVersion(dir, migrations[len(migrations)-1].version+1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := checkSchemaVersion(dir); err == nil {
+		t.Error("data of a newer schema version is accepted")
+	}
+}
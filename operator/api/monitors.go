@@ -0,0 +1,480 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+// Monitors run a small Playwright script on a schedule through a CronJob. Their Jobs are
+// folded into a compact series of samples and deleted, so they never show up as runs.
+const (
+	monitorLabel               = "playwright.operator/monitor"
+	monitorThresholdAnnotation = "playwright.operator/monitor-failure-threshold"
+	monitorSamplesKey          = "samples.json"
+	// maxMonitorSamples keeps a week of checks every five minutes.
+	maxMonitorSamples = 2016
+)
+
+// MonitorSpec describes a synthetic check. Run is the check itself, without a report.
+type MonitorSpec struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule,omitempty"`
+	// FailureThreshold is the number of consecutive failures that raise an alert.
+	FailureThreshold int     `json:"failureThreshold,omitempty"`
+	Run              RunSpec `json:"run"`
+}
+
+// MonitorSample is one check, kept short as thousands are stored per monitor.
+type MonitorSample struct {
+	Time     time.Time `json:"t"`
+	OK       bool      `json:"ok"`
+	Duration float64   `json:"d,omitempty"`
+}
+
+type monitorState struct {
+	Samples  []MonitorSample `json:"samples"`
+	Alerting bool            `json:"alerting"`
+}
+
+type MonitorStatus struct {
+	Name                string         `json:"name"`
+	Schedule            string         `json:"schedule"`
+	Suspended           bool           `json:"suspended"`
+	FailureThreshold    int            `json:"failureThreshold"`
+	Uptime              float64        `json:"uptime"`
+	ConsecutiveFailures int            `json:"consecutiveFailures"`
+	Alerting            bool           `json:"alerting"`
+	Last                *MonitorSample `json:"last,omitempty"`
+}
+
+type MonitorSamplesResponse struct {
+	Name    string          `json:"name"`
+	Window  string          `json:"window"`
+	Uptime  float64         `json:"uptime"`
+	Samples []MonitorSample `json:"samples"`
+}
+
+func monitorConfigMapName(name string) string {
+	return "playwright-monitor-" + name
+}
+
+// newMonitorCronJob builds the CronJob of a monitor from its run, checks do not overlap
+// and write no HTML report.
+func newMonitorCronJob(namespace string, spec MonitorSpec) (*batchv1.CronJob, error) {
+	if errs := validation.IsDNS1123Label(spec.Name); len(errs) > 0 || len(spec.Name) > 40 {
+		return nil, fmt.Errorf("name must be a DNS label of at most 40 characters")
+	}
+	if spec.Run.Credentials != nil {
+		return nil, fmt.Errorf("monitors do not support run credentials")
+	}
+	if spec.Schedule == "" {
+		spec.Schedule = "*/5 * * * *"
+	}
+	if spec.FailureThreshold == 0 {
+		spec.FailureThreshold = 3
+	}
+	if spec.FailureThreshold < 1 {
+		return nil, fmt.Errorf("failureThreshold must be positive")
+	}
+
+	run := spec.Run
+	run.Namespace = namespace
+	if len(run.Command) == 0 {
+		run.Command = []string{"sh", "-c", "npx playwright test --reporter=line"}
+	}
+	run.Labels = copyLabels(run.Labels)
+	if run.Labels == nil {
+		run.Labels = map[string]string{}
+	}
+	run.Labels[monitorLabel] = spec.Name
+
+	job, err := newRunJob(run)
+	if err != nil {
+		return nil, err
+	}
+	job.Spec.TTLSecondsAfterFinished = ptr.To[int32](3600)
+
+	return &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "monitor-" + spec.Name,
+			Namespace: namespace,
+			Labels:    map[string]string{monitorLabel: spec.Name},
+			Annotations: map[string]string{
+				monitorThresholdAnnotation: strconv.Itoa(spec.FailureThreshold),
+			},
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:                   spec.Schedule,
+			ConcurrencyPolicy:          batchv1.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: ptr.To[int32](1),
+			FailedJobsHistoryLimit:     ptr.To[int32](1),
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: job.Labels, Annotations: job.Annotations},
+				Spec:       job.Spec,
+			},
+		},
+	}, nil
+}
+
+func monitorThreshold(cronJob *batchv1.CronJob) int {
+	n, err := strconv.Atoi(cronJob.Annotations[monitorThresholdAnnotation])
+	if err != nil || n < 1 {
+		return 3
+	}
+
+	return n
+}
+
+func loadMonitorState(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string) (*corev1.ConfigMap, *monitorState, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, monitorConfigMapName(name), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:      monitorConfigMapName(name),
+			Namespace: namespace,
+			Labels:    map[string]string{monitorLabel: name},
+		}}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	state := &monitorState{}
+	if data := cm.Data[monitorSamplesKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), state); err != nil {
+			return nil, nil, fmt.Errorf("decoding %s: %w", cm.Name, err)
+		}
+	}
+
+	return cm, state, nil
+}
+
+func saveMonitorState(ctx context.Context, clientset *kubernetes.Clientset, cm *corev1.ConfigMap, state *monitorState) error {
+	if len(state.Samples) > maxMonitorSamples {
+		state.Samples = state.Samples[len(state.Samples)-maxMonitorSamples:]
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[monitorSamplesKey] = string(data)
+
+	if cm.ResourceVersion == "" {
+		_, err = clientset.CoreV1().ConfigMaps(cm.Namespace).Create(ctx, cm, metav1.CreateOptions{})
+	} else {
+		_, err = clientset.CoreV1().ConfigMaps(cm.Namespace).Update(ctx, cm, metav1.UpdateOptions{})
+	}
+
+	return err
+}
+
+func consecutiveFailures(samples []MonitorSample) int {
+	n := 0
+	for i := len(samples) - 1; i >= 0 && !samples[i].OK; i-- {
+		n++
+	}
+
+	return n
+}
+
+// uptime is the share of successful checks since a time, 1 without any checks.
+func uptime(samples []MonitorSample, since time.Time) float64 {
+	var total, ok int
+	for _, sample := range samples {
+		if sample.Time.Before(since) {
+			continue
+		}
+		total++
+		if sample.OK {
+			ok++
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+
+	return float64(ok) / float64(total)
+}
+
+// GET /monitors?namespace=ns
+func listMonitors(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+
+	cronJobs, err := clientset.BatchV1().CronJobs(namespace).List(r.Context(), metav1.ListOptions{LabelSelector: monitorLabel})
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	since := time.Now().Add(-24 * time.Hour)
+	monitors := []MonitorStatus{}
+	for _, cronJob := range cronJobs.Items {
+		name := cronJob.Labels[monitorLabel]
+		_, state, err := loadMonitorState(r.Context(), clientset, namespace, name)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+
+		status := MonitorStatus{
+			Name:                name,
+			Schedule:            cronJob.Spec.Schedule,
+			Suspended:           ptr.Deref(cronJob.Spec.Suspend, false),
+			FailureThreshold:    monitorThreshold(&cronJob),
+			Uptime:              uptime(state.Samples, since),
+			ConsecutiveFailures: consecutiveFailures(state.Samples),
+			Alerting:            state.Alerting,
+		}
+		if n := len(state.Samples); n > 0 {
+			status.Last = &state.Samples[n-1]
+		}
+		monitors = append(monitors, status)
+	}
+	sort.Slice(monitors, func(i, j int) bool {
+		return monitors[i].Name < monitors[j].Name
+	})
+
+	respondJSON(w, monitors)
+}
+
+// POST /monitors?namespace=ns with a MonitorSpec
+func createMonitor(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+
+	var spec MonitorSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		writeError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if spec.Run.namespacePullSecrets, err = namespaceImagePullSecrets(r.Context(), clientset, namespace); err != nil {
+		respondError(w, err)
+		return
+	}
+	cronJob, err := newMonitorCronJob(namespace, spec)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var pullSecrets []string
+	for _, ref := range cronJob.Spec.JobTemplate.Spec.Template.Spec.ImagePullSecrets {
+		pullSecrets = append(pullSecrets, ref.Name)
+	}
+	if err := validateImagePull(r.Context(), clientset, namespace, spec.Run.Image, pullSecrets); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created, err := clientset.BatchV1().CronJobs(namespace).Create(r.Context(), cronJob, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		writeError(w, "monitor "+spec.Name+" already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSONStatus(w, http.StatusCreated, MonitorStatus{
+		Name:             spec.Name,
+		Schedule:         created.Spec.Schedule,
+		FailureThreshold: monitorThreshold(created),
+		Uptime:           1,
+	})
+}
+
+// DELETE /monitors/{name}?namespace=ns removes the monitor and its samples.
+func deleteMonitor(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+	name := r.PathValue("name")
+
+	err := clientset.BatchV1().CronJobs(namespace).Delete(r.Context(), "monitor-"+name, metav1.DeleteOptions{
+		PropagationPolicy: ptr.To(metav1.DeletePropagationBackground),
+	})
+	if apierrors.IsNotFound(err) {
+		writeError(w, "monitor not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	err = clientset.CoreV1().ConfigMaps(namespace).Delete(r.Context(), monitorConfigMapName(name), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /monitors/{name}/samples?namespace=ns&window=24h
+func monitorSamples(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	query := r.URL.Query()
+	namespace := getNamespace(query.Get("namespace"))
+	name := r.PathValue("name")
+
+	window := query.Get("window")
+	if window == "" {
+		window = "24h"
+	}
+	d, err := parseWindow(window)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	since := time.Now().Add(-d)
+
+	cm, state, err := loadMonitorState(r.Context(), clientset, namespace, name)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if cm.ResourceVersion == "" {
+		writeError(w, "no samples for monitor "+name, http.StatusNotFound)
+		return
+	}
+
+	resp := MonitorSamplesResponse{Name: name, Window: window, Uptime: uptime(state.Samples, since), Samples: []MonitorSample{}}
+	for _, sample := range state.Samples {
+		if !sample.Time.Before(since) {
+			resp.Samples = append(resp.Samples, sample)
+		}
+	}
+
+	respondJSON(w, resp)
+}
+
+// recordMonitors folds finished monitor Jobs into samples, deletes them and alerts once a
+// monitor reaches its threshold of consecutive failures, through the log and
+// MONITOR_ALERT_WEBHOOK if set.
+func recordMonitors(ctx context.Context, clientset *kubernetes.Clientset, namespace string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{LabelSelector: monitorLabel})
+		if err != nil {
+			log.Printf("cannot list monitor checks: %v", err)
+			continue
+		}
+		sortJobs(jobs.Items, "creationTimestamp", true)
+
+		checks := map[string][]batchv1.Job{}
+		for _, job := range finishedRuns(jobs.Items) {
+			name := job.Labels[monitorLabel]
+			checks[name] = append(checks[name], job)
+		}
+
+		for name, finished := range checks {
+			if err := recordMonitorChecks(ctx, clientset, namespace, name, finished); err != nil {
+				log.Printf("cannot record checks of monitor %s: %v", name, err)
+			}
+		}
+	}
+}
+
+func recordMonitorChecks(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string, finished []batchv1.Job) error {
+	threshold := 3
+	if cronJob, err := clientset.BatchV1().CronJobs(namespace).Get(ctx, "monitor-"+name, metav1.GetOptions{}); err == nil {
+		threshold = monitorThreshold(cronJob)
+	}
+
+	var state *monitorState
+	var alert bool
+	for attempt := 0; ; attempt++ {
+		cm, loaded, err := loadMonitorState(ctx, clientset, namespace, name)
+		if err != nil {
+			return err
+		}
+		state = loaded
+
+		// checks whose Job could not be deleted last time are already recorded
+		recorded := map[time.Time]bool{}
+		for _, sample := range state.Samples {
+			recorded[sample.Time] = true
+		}
+
+		for _, job := range finished {
+			if recorded[job.CreationTimestamp.UTC()] {
+				continue
+			}
+			sample := MonitorSample{Time: job.CreationTimestamp.UTC(), OK: jobState(&job) == jobStateSucceeded}
+			if d, ok := jobDuration(&job); ok {
+				sample.Duration = d.Seconds()
+			}
+			state.Samples = append(state.Samples, sample)
+		}
+
+		failing := consecutiveFailures(state.Samples) >= threshold
+		alert = failing != state.Alerting
+		state.Alerting = failing
+
+		err = saveMonitorState(ctx, clientset, cm, state)
+		if err == nil {
+			break
+		}
+		if (!apierrors.IsConflict(err) && !apierrors.IsAlreadyExists(err)) || attempt == 4 {
+			return err
+		}
+	}
+
+	for _, job := range finished {
+		err := clientset.BatchV1().Jobs(namespace).Delete(ctx, job.Name, metav1.DeleteOptions{
+			PropagationPolicy: ptr.To(metav1.DeletePropagationBackground),
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			log.Printf("cannot delete monitor check %s/%s: %v", namespace, job.Name, err)
+		}
+	}
+
+	if alert {
+		status := MonitorStatus{
+			Name:                name,
+			FailureThreshold:    threshold,
+			Uptime:              uptime(state.Samples, time.Now().Add(-24*time.Hour)),
+			ConsecutiveFailures: consecutiveFailures(state.Samples),
+			Alerting:            state.Alerting,
+			Last:                &state.Samples[len(state.Samples)-1],
+		}
+		if state.Alerting {
+			log.Printf("monitor %s failed %d times in a row", name, status.ConsecutiveFailures)
+		} else {
+			log.Printf("monitor %s recovered", name)
+		}
+		settings, err := effectiveSettings(ctx, clientset)
+		if err != nil {
+			log.Printf("cannot load settings: %v", err)
+		} else if settings.MonitorAlertWebhook != "" {
+			notifyWebhook(ctx, settings, "monitors", settings.MonitorAlertWebhook, status)
+		}
+	}
+
+	return nil
+}
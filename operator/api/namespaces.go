@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// namespacesTTL is how long the namespaces the API may list runs in are cached, each
+// namespace costs an access review.
+const namespacesTTL = time.Minute
+
+// NamespaceList are the namespaces runs can be listed in, and the one used without.
+type NamespaceList struct {
+	Namespaces []string `json:"namespaces"`
+	Default    string   `json:"default"`
+}
+
+type namespaceCache struct {
+	mu         sync.Mutex
+	namespaces []string
+	fetched    time.Time
+}
+
+var runNamespaces namespaceCache
+
+// list returns the namespaces whose Jobs the service account of the API may list, of the
+// namespaces matching NAMESPACE_SELECTOR. Without permission to list namespaces only the
+// default namespace is checked.
+func (c *namespaceCache) list(ctx context.Context, clientset *kubernetes.Clientset) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.namespaces != nil && time.Since(c.fetched) < namespacesTTL {
+		return c.namespaces, nil
+	}
+
+	var candidates []string
+	list, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: os.Getenv("NAMESPACE_SELECTOR")})
+	switch {
+	case apierrors.IsForbidden(err):
+		if namespace := getNamespace(""); namespace != "" {
+			candidates = append(candidates, namespace)
+		}
+	case err != nil:
+		return nil, err
+	default:
+		for _, ns := range list.Items {
+			candidates = append(candidates, ns.Name)
+		}
+	}
+
+	namespaces := []string{}
+	for _, namespace := range candidates {
+		review, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: namespace,
+					Verb:      "list",
+					Group:     "batch",
+					Resource:  "jobs",
+				},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if review.Status.Allowed {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	sort.Strings(namespaces)
+
+	c.namespaces, c.fetched = namespaces, time.Now()
+
+	return namespaces, nil
+}
+
+// watchRunNamespaces calls start for every namespace the API lists runs in, checking for
+// new namespaces every interval. The context passed to start is cancelled once its
+// namespace is no longer listed.
+func watchRunNamespaces(ctx context.Context, clientset *kubernetes.Clientset, interval time.Duration, start func(ctx context.Context, namespace string)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	running := map[string]context.CancelFunc{}
+	defer func() {
+		for _, cancel := range running {
+			cancel()
+		}
+	}()
+	for {
+		namespaces, err := runNamespaces.list(ctx, clientset)
+		if err != nil {
+			log.Printf("cannot list the namespaces of runs: %v", err)
+		} else {
+			listed := map[string]bool{}
+			for _, namespace := range namespaces {
+				listed[namespace] = true
+				if running[namespace] == nil {
+					nsCtx, cancel := context.WithCancel(ctx)
+					running[namespace] = cancel
+					go start(nsCtx, namespace)
+				}
+			}
+			for namespace, cancel := range running {
+				if !listed[namespace] {
+					cancel()
+					delete(running, namespace)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GET /namespaces
+func getNamespaces(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	namespaces, err := runNamespaces.list(r.Context(), clientset)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, NamespaceList{Namespaces: namespaces, Default: getNamespace("")})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setRunNamespaces makes runNamespaces.list return namespaces without asking the API server.
+func setRunNamespaces(t *testing.T, namespaces ...string) {
+	t.Helper()
+	runNamespaces.mu.Lock()
+	defer runNamespaces.mu.Unlock()
+	runNamespaces.namespaces, runNamespaces.fetched = namespaces, time.Now()
+	t.Cleanup(func() {
+		runNamespaces.mu.Lock()
+		defer runNamespaces.mu.Unlock()
+		runNamespaces.namespaces = nil
+	})
+}
+
+func TestWatchRunNamespaces(t *testing.T) {
+	setRunNamespaces(t, "shop", "blog")
+
+	var mu sync.Mutex
+	running := map[string]bool{}
+	started := make(chan string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watchRunNamespaces(ctx, nil, 10*time.Millisecond, func(ctx context.Context, namespace string) {
+		mu.Lock()
+		running[namespace] = true
+		mu.Unlock()
+		started <- namespace
+		<-ctx.Done()
+		mu.Lock()
+		running[namespace] = false
+		mu.Unlock()
+	})
+
+	wait := func(want string) {
+		t.Helper()
+		select {
+		case namespace := <-started:
+			if namespace != want && want != "" {
+				t.Errorf("started %s, want %s", namespace, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no watcher started for %s", want)
+		}
+	}
+	wait("")
+	wait("")
+
+	setRunNamespaces(t, "shop", "docs")
+	wait("docs")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		blog, shop := running["blog"], running["shop"]
+		mu.Unlock()
+		if !blog && shop {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("blog running %v, shop running %v, want only the listed namespaces watched", blog, shop)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case namespace := <-started:
+		t.Errorf("%s was started twice", namespace)
+	default:
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// notifyAnnotation lists the sinks the completion of a run is posted to as comma
+	// separated kind=url pairs, kind is slack, teams or webhook, like
+	// "slack=https://hooks.slack.com/services/T0/B0/x,webhook=https://ci.example.com/runs".
+	// A url secret:name/key is read from a Secret of the namespace. Runs and
+	// PlaywrightTestRuns carry it for their suite, the Namespace for all of its runs.
+	notifyAnnotation = "playwright.operator/notify"
+	// notifyOnAnnotation is "always", the default, or "failure" to post failed runs only.
+	notifyOnAnnotation = "playwright.operator/notify-on"
+	// notifiedLabel marks runs whose completion was posted, or that had nothing to post to.
+	notifiedLabel = "playwright.operator/notified"
+
+	notifyAlways  = "always"
+	notifyFailure = "failure"
+
+	// runs that finished longer ago, before the API started, are not posted anymore
+	notifyMaxAge = time.Hour
+)
+
+// Kinds of notification sinks.
+const (
+	sinkSlack   = "slack"
+	sinkTeams   = "teams"
+	sinkWebhook = "webhook"
+)
+
+type NotificationSink struct {
+	Kind string
+	URL  string
+}
+
+// parseNotificationSinks parses the value of notifyAnnotation.
+func parseNotificationSinks(value string) ([]NotificationSink, error) {
+	var sinks []NotificationSink
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kind, target, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("sink %q must be kind=url", entry)
+		}
+		kind = strings.TrimSpace(kind)
+		if kind != sinkSlack && kind != sinkTeams && kind != sinkWebhook {
+			return nil, fmt.Errorf("sink kind must be %q, %q or %q", sinkSlack, sinkTeams, sinkWebhook)
+		}
+		target = strings.TrimSpace(target)
+		if ref, ok := strings.CutPrefix(target, "secret:"); ok {
+			if name, key, ok := strings.Cut(ref, "/"); !ok || name == "" || key == "" {
+				return nil, fmt.Errorf("sink %s must reference a secret as secret:name/key", kind)
+			}
+		} else if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("sink %s must be an http or https URL", kind)
+		}
+		sinks = append(sinks, NotificationSink{Kind: kind, URL: target})
+	}
+
+	return sinks, nil
+}
+
+// runNotificationDrivers returns the kinds of sinks the completions of runs are posted to.
+// They are configured on the namespaces, which notifyRunCompletions watches, and on the
+// runs of jobs.
+func runNotificationDrivers(ctx context.Context, clientset *kubernetes.Clientset, namespaces []string, jobs []*batchv1.Job) []NotificationDriver {
+	var values []string
+	for _, namespace := range namespaces {
+		ns, err := clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+		if err != nil {
+			log.Printf("cannot read the notification sinks of namespace %s: %v", namespace, err)
+			continue
+		}
+		values = append(values, ns.Annotations[notifyAnnotation])
+	}
+	for _, job := range jobs {
+		values = append(values, job.Annotations[notifyAnnotation])
+	}
+
+	configured := map[string]bool{}
+	for _, value := range values {
+		sinks, _ := parseNotificationSinks(value)
+		for _, sink := range sinks {
+			configured[sink.Kind] = true
+		}
+	}
+	drivers := []NotificationDriver{}
+	for _, kind := range []string{sinkSlack, sinkTeams, sinkWebhook} {
+		if configured[kind] {
+			drivers = append(drivers, NotificationDriver{Driver: kind, Source: "runs"})
+		}
+	}
+
+	return drivers
+}
+
+// resolve returns the URL of a sink, reading secret references.
+func (s NotificationSink) resolve(ctx context.Context, clientset *kubernetes.Clientset, namespace string) (string, error) {
+	ref, ok := strings.CutPrefix(s.URL, "secret:")
+	if !ok {
+		return s.URL, nil
+	}
+	name, key, _ := strings.Cut(ref, "/")
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	value, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s", name, key)
+	}
+
+	return strings.TrimSpace(string(value)), nil
+}
+
+// RunNotification is the summary of a finished run posted to generic webhooks, Slack and
+// Teams get it as a message.
+type RunNotification struct {
+	RunRef
+	Suite    string     `json:"suite,omitempty"`
+	Branch   string     `json:"branch,omitempty"`
+	State    string     `json:"state"`
+	Duration string     `json:"duration,omitempty"`
+	Counts   TestCounts `json:"counts"`
+	// ReportURL links the HTML report on the dashboard, set with DASHBOARD_URL.
+	ReportURL string `json:"reportUrl,omitempty"`
+}
+
+func newRunNotification(job *batchv1.Job, counts TestCounts) RunNotification {
+	n := RunNotification{
+		RunRef: RunRef{Namespace: job.Namespace, Name: job.Name, UID: string(job.UID)},
+		Suite:  job.Labels[suiteLabel],
+		Branch: job.Labels[branchLabel],
+		State:  jobState(job),
+		Counts: counts,
+	}
+	if finished, ok := finishedAt(job); ok && job.Status.StartTime != nil {
+		n.Duration = finished.Sub(job.Status.StartTime.Time).Round(time.Second).String()
+	}
+	if dashboard := strings.TrimSuffix(os.Getenv("DASHBOARD_URL"), "/"); dashboard != "" {
+		n.ReportURL = dashboard + "/pw/" + string(job.UID) + "/"
+	}
+
+	return n
+}
+
+func (n RunNotification) text() string {
+	title := n.Name
+	if n.Suite != "" {
+		title += " (" + n.Suite + ")"
+	}
+	text := fmt.Sprintf("Run %s %s", title, n.State)
+	if n.Duration != "" {
+		text += " after " + n.Duration
+	}
+
+	return text + fmt.Sprintf(": %d passed, %d failed, %d flaky, %d skipped",
+		n.Counts.Passed, n.Counts.Failed, n.Counts.Flaky, n.Counts.Skipped)
+}
+
+// payload returns the body a sink of a kind expects: Slack incoming webhooks take text
+// with mrkdwn links, Teams workflows an Adaptive Card.
+func (n RunNotification) payload(kind string) interface{} {
+	switch kind {
+	case sinkSlack:
+		text := n.text()
+		if n.ReportURL != "" {
+			text += " <" + n.ReportURL + "|HTML report>"
+		}
+		return map[string]interface{}{"text": text}
+	case sinkTeams:
+		card := map[string]interface{}{
+			"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+			"type":    "AdaptiveCard",
+			"version": "1.4",
+			"body": []interface{}{
+				map[string]interface{}{"type": "TextBlock", "text": n.text(), "wrap": true},
+			},
+		}
+		if n.ReportURL != "" {
+			card["actions"] = []interface{}{
+				map[string]interface{}{"type": "Action.OpenUrl", "title": "HTML report", "url": n.ReportURL},
+			}
+		}
+		return map[string]interface{}{
+			"type": "message",
+			"attachments": []interface{}{
+				map[string]interface{}{"contentType": "application/vnd.microsoft.card.adaptive", "content": card},
+			},
+		}
+	}
+
+	return n
+}
+
+// runNotifier posts the completions of runs the informer of a namespace sees. Runs are
+// queued once until the informer sees their notified label.
+type runNotifier struct {
+	clientset *kubernetes.Clientset
+	informers *runInformers
+	queue     chan *batchv1.Job
+
+	mu     sync.Mutex
+	queued map[types.UID]bool
+}
+
+// enqueue queues a finished run that was not posted yet. Runs dropped from a full queue
+// are queued again by the next resync.
+func (n *runNotifier) enqueue(obj interface{}) {
+	job, ok := obj.(*batchv1.Job)
+	if !ok {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if job.Labels[notifiedLabel] != "" {
+		delete(n.queued, job.UID)
+		return
+	}
+	if state := jobState(job); state != jobStateSucceeded && state != jobStateFailed {
+		return
+	}
+	if finished, ok := finishedAt(job); !ok || time.Since(finished) > notifyMaxAge {
+		return
+	}
+	if n.queued[job.UID] {
+		return
+	}
+
+	select {
+	case n.queue <- job.DeepCopy():
+		n.queued[job.UID] = true
+	default:
+	}
+}
+
+// notify posts a finished run to its sinks and labels it, runs with an invalid
+// annotation are labelled without being posted.
+func (n *runNotifier) notify(ctx context.Context, job *batchv1.Job) error {
+	ns, err := n.clientset.CoreV1().Namespaces().Get(ctx, job.Namespace, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	// the annotations of the run replace those of its namespace
+	value, notifyOn := ns.Annotations[notifyAnnotation], ns.Annotations[notifyOnAnnotation]
+	if v, ok := job.Annotations[notifyAnnotation]; ok {
+		value = v
+	}
+	if v, ok := job.Annotations[notifyOnAnnotation]; ok {
+		notifyOn = v
+	}
+
+	sinks, err := parseNotificationSinks(value)
+	if err != nil {
+		log.Printf("not notifying about run %s/%s: %v", job.Namespace, job.Name, err)
+		sinks = nil
+	}
+	if notifyOn == notifyFailure && jobState(job) != jobStateFailed {
+		sinks = nil
+	}
+
+	if len(sinks) > 0 {
+		settings, err := effectiveSettings(ctx, n.clientset)
+		if err != nil {
+			return err
+		}
+
+		counts := TestCounts{}
+		if results, err := runResults(job); err == nil && results != nil {
+			counts = results.Counts
+		} else if c := testCounts(n.informers.namespace(job.Namespace).podsOf(job.Name)); c != nil {
+			counts = *c
+		}
+		notification := newRunNotification(job, counts)
+
+		for _, sink := range sinks {
+			target, err := sink.resolve(ctx, n.clientset, job.Namespace)
+			if err != nil {
+				log.Printf("cannot resolve %s sink of run %s/%s: %v", sink.Kind, job.Namespace, job.Name, err)
+				continue
+			}
+			notifyWebhook(ctx, settings, "runs", target, notification.payload(sink.Kind))
+		}
+	}
+
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": map[string]string{notifiedLabel: "true"}},
+	})
+	_, err = n.clientset.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+
+	return err
+}
+
+// notifyRunCompletions posts the summaries of runs as they finish to the sinks of
+// notifyAnnotation, in every namespace the API lists runs in.
+func notifyRunCompletions(ctx context.Context, clientset *kubernetes.Clientset, informers *runInformers, interval time.Duration) {
+	watchRunNamespaces(ctx, clientset, interval, func(ctx context.Context, namespace string) {
+		notifyNamespaceCompletions(ctx, clientset, informers, namespace)
+	})
+}
+
+// notifyNamespaceCompletions posts the completions of the runs of a namespace until ctx
+// is cancelled.
+func notifyNamespaceCompletions(ctx context.Context, clientset *kubernetes.Clientset, informers *runInformers, namespace string) {
+	n := &runNotifier{
+		clientset: clientset,
+		informers: informers,
+		queue:     make(chan *batchv1.Job, 100),
+		queued:    map[types.UID]bool{},
+	}
+
+	ni, release := informers.hold(namespace)
+	defer release()
+	informer := ni.jobs
+	registration, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    n.enqueue,
+		UpdateFunc: func(_, obj interface{}) { n.enqueue(obj) },
+	})
+	if err != nil {
+		log.Printf("cannot watch runs of %s for notifications: %v", namespace, err)
+		return
+	}
+	defer informer.RemoveEventHandler(registration)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-n.queue:
+			if err := n.notify(ctx, job); err != nil {
+				log.Printf("cannot notify about run %s/%s: %v", job.Namespace, job.Name, err)
+				// the next resync queues it again
+				n.mu.Lock()
+				delete(n.queued, job.UID)
+				n.mu.Unlock()
+			}
+		}
+	}
+}
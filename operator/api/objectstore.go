@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"shared/objectstore"
+)
+
+// resultsUploadedLabel marks the runs whose report is in the results store.
+const resultsUploadedLabel = "playwright.operator/results-uploaded"
+
+// resultsStore is the bucket reports are uploaded to once their run finished, see
+// objectstore.Store. Objects are named <prefix><uid>/<path of the report>.
+type resultsStore struct {
+	*objectstore.Store
+}
+
+// resultsStoreFromEnv reads the bucket from RESULTS_STORE and the variables next to it, see
+// manifest/operator.yaml. It returns nil without RESULTS_STORE.
+func resultsStoreFromEnv() (*resultsStore, error) {
+	store, err := objectstore.FromEnv()
+	if store == nil || err != nil {
+		return nil, err
+	}
+
+	return &resultsStore{Store: store}, nil
+}
+
+// newRequest returns an authorized request for the object of a run below the prefix of
+// the store.
+func (s *resultsStore) newRequest(ctx context.Context, method, uid, rel string, body io.Reader) (*http.Request, error) {
+	return s.NewRequest(ctx, method, uid+"/"+rel, body)
+}
+
+// storeTimeout bounds a call to the results store, the transfer of the object included.
+const storeTimeout = 5 * time.Minute
+
+// put uploads a file of the report of a run, typed by its extension so the report renders
+// when it is served from the bucket.
+func (s *resultsStore) put(ctx context.Context, uid, rel, file string) error {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPut, uid, rel, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	if contentType := mime.TypeByExtension(path.Ext(rel)); contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if s.Provider == "azure" {
+		req.Header.Set("X-Ms-Blob-Type", "BlockBlob")
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("uploading %s: %s: %s", rel, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// get downloads an object below the prefix of the store, fs.ErrNotExist if there is none.
+// The deadline of the download ends when the object is closed.
+func (s *resultsStore) get(ctx context.Context, uid, rel string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	req, err := s.newRequest(ctx, http.MethodGet, uid, rel, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		cancel()
+		return nil, fs.ErrNotExist
+	}
+	if resp.StatusCode >= 300 {
+		defer cancel()
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("downloading %s: %s: %s", rel, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return cancelOnClose{ReadCloser: resp.Body, cancel: cancel}, nil
+}
+
+// cancelOnClose releases the context of a response when its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// delete removes an object below the prefix of the store, objects that do not exist are
+// gone already.
+func (s *resultsStore) delete(ctx context.Context, uid, rel string) error {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+
+	req, err := s.newRequest(ctx, http.MethodDelete, uid, rel, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("deleting %s: %s: %s", rel, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// uploadReport uploads the files of the report of a run. Runs without a report upload
+// nothing.
+func (s *resultsStore) uploadReport(ctx context.Context, uid string) (int, error) {
+	dir := filepath.Join(resultsDir, uid)
+	uploaded := 0
+	err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		if err := s.put(ctx, uid, filepath.ToSlash(rel), file); err != nil {
+			return err
+		}
+		uploaded++
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+
+	return uploaded, err
+}
+
+// uploadRun uploads the reports of a run, the one of the run and those of its pods, which
+// runs without shards write their report below.
+func (s *resultsStore) uploadRun(ctx context.Context, uid types.UID, podUIDs []types.UID) (int, error) {
+	uploaded := 0
+	for _, dir := range append([]types.UID{uid}, podUIDs...) {
+		n, err := s.uploadReport(ctx, string(dir))
+		uploaded += n
+		if err != nil {
+			return uploaded, err
+		}
+	}
+
+	return uploaded, nil
+}
+
+// uploadRunResults uploads the reports of finished runs to the results store and labels
+// the runs with resultsUploadedLabel. Runs wait for their original reports to be archived
+// and their checksum manifests, see archiveRunReports and signRunReports, and sharded runs
+// for the Job merging their reports.
+func uploadRunResults(ctx context.Context, clientset *kubernetes.Clientset, informers *runInformers, store *resultsStore, namespace string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		selector := runsSelector + "," + rawReportLabel + "," + checksumLabel + ",!" + resultsUploadedLabel + ",!" + reportMergeLabel
+		if artifactScanningEnabled() {
+			// quarantined reports stay off the bucket
+			selector += "," + scanLabel + " in (" + scanClean + "," + scanReleased + ")"
+		}
+		jobs, err := informers.runs(ctx, namespace, selector)
+		if err != nil {
+			log.Printf("cannot list runs to upload: %v", err)
+			continue
+		}
+		merges, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{LabelSelector: mergeRunLabel})
+		if err != nil {
+			log.Printf("cannot list report merges: %v", err)
+			continue
+		}
+		merging := map[string]bool{}
+		for i := range merges.Items {
+			if jobState(&merges.Items[i]) == jobStateRunning {
+				merging[merges.Items[i].Labels[mergeRunLabel]] = true
+			}
+		}
+
+		for i := range jobs {
+			job := &jobs[i]
+			if state := jobState(job); state != jobStateSucceeded && state != jobStateFailed && state != jobStateCancelled {
+				continue
+			}
+			if merging[string(job.UID)] {
+				continue
+			}
+
+			podUIDs, err := runPodUIDs(ctx, clientset, job)
+			if err != nil {
+				log.Printf("cannot list the pods of run %s/%s: %v", job.Namespace, job.Name, err)
+				continue
+			}
+			uploaded, err := store.uploadRun(ctx, job.UID, podUIDs)
+			if err != nil {
+				log.Printf("cannot upload the report of run %s/%s: %v", job.Namespace, job.Name, err)
+				continue
+			}
+			if uploaded > 0 {
+				log.Printf("uploaded %d report files of run %s/%s to %s", uploaded, job.Namespace, job.Name, store.Provider)
+			}
+
+			patch, _ := json.Marshal(map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": map[string]interface{}{resultsUploadedLabel: "true"},
+				},
+			})
+			if _, err := clientset.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+				log.Printf("cannot label run %s/%s: %v", job.Namespace, job.Name, err)
+			}
+		}
+	}
+}
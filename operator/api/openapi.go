@@ -0,0 +1,88 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// openAPISpec describes the routes registered in main, by hand. checkOpenAPISpec finds the
+// operations that went stale.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// swaggerUIPage renders openAPISpec with Swagger UI.
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="UTF-8" />
+  <title>Playwright Operator API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css" />
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>SwaggerUIBundle({url: "openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+var openAPIPathParam = regexp.MustCompile(`\{[^}]+\}`)
+
+// checkOpenAPISpec returns the operations of openAPISpec the mux has no route for, with
+// path parameters filled in by a placeholder.
+func checkOpenAPISpec(mux *http.ServeMux) ([]string, error) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		return nil, fmt.Errorf("decoding openapi.json: %w", err)
+	}
+
+	var missing []string
+	for path, operations := range spec.Paths {
+		target := openAPIPathParam.ReplaceAllString(path, "x")
+		for method := range operations {
+			req, err := http.NewRequest(strings.ToUpper(method), target, nil)
+			if err != nil {
+				return nil, err
+			}
+			if _, pattern := mux.Handler(req); pattern == "" {
+				missing = append(missing, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	sort.Strings(missing)
+
+	return missing, nil
+}
+
+// logOpenAPIDrift logs the operations of openAPISpec the API does not serve.
+func logOpenAPIDrift(mux *http.ServeMux) {
+	missing, err := checkOpenAPISpec(mux)
+	if err != nil {
+		log.Printf("cannot check the OpenAPI specification: %v", err)
+		return
+	}
+	for _, operation := range missing {
+		log.Printf("openapi.json documents %s, which has no route", operation)
+	}
+}
+
+// GET /openapi.json
+func getOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// GET /docs
+func getAPIDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, swaggerUIPage)
+}
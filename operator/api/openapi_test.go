@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// muxPatterns returns the patterns main registers on its mux, read from the source as the
+// handlers need a cluster to be built.
+func muxPatterns(t *testing.T) []string {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "main.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var patterns []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || (sel.Sel.Name != "Handle" && sel.Sel.Name != "HandleFunc") {
+			return true
+		}
+		if recv, ok := sel.X.(*ast.Ident); !ok || recv.Name != "mux" {
+			return true
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			t.Errorf("mux pattern %v is not a string literal", call.Args[0])
+			return true
+		}
+		pattern, _ := strconv.Unquote(lit.Value)
+		patterns = append(patterns, pattern)
+		return true
+	})
+	if len(patterns) == 0 {
+		t.Fatal("found no routes in main.go")
+	}
+
+	return patterns
+}
+
+func TestOpenAPISpecMatchesRoutes(t *testing.T) {
+	patterns := muxPatterns(t)
+
+	// spec → routes
+	mux := http.NewServeMux()
+	for _, pattern := range patterns {
+		mux.HandleFunc(pattern, func(http.ResponseWriter, *http.Request) {})
+	}
+	missing, err := checkOpenAPISpec(mux)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, operation := range missing {
+		t.Errorf("openapi.json documents %s, which has no route", operation)
+	}
+
+	// routes → spec, patterns without a method are documented with any
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatal(err)
+	}
+	documented := map[string]map[string]bool{}
+	for path, operations := range spec.Paths {
+		path = openAPIPathParam.ReplaceAllString(path, "{}")
+		documented[path] = map[string]bool{}
+		for method := range operations {
+			documented[path][strings.ToUpper(method)] = true
+		}
+	}
+	for _, pattern := range patterns {
+		method, path, ok := strings.Cut(pattern, " ")
+		if !ok {
+			method, path = "", pattern
+		}
+		methods := documented[openAPIPathParam.ReplaceAllString(path, "{}")]
+		if methods == nil || (method != "" && !methods[method]) {
+			t.Errorf("route %s is not documented in openapi.json", pattern)
+		}
+	}
+}
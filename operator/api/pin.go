@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	pinnedAnnotation      = "playwright.operator/pinned"
+	pinnedTTLAnnotation   = "playwright.operator/pinned-ttl"
+	pinHistoryAnnotation  = "playwright.operator/pin-history"
+	pinnedOwnerAnnotation = "playwright.operator/pinned-owner"
+)
+
+// PinEvent is an entry of the pin audit trail kept on the Job.
+type PinEvent struct {
+	Action string    `json:"action"`
+	By     string    `json:"by,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+type PinRequest struct {
+	By     string `json:"by"`
+	Reason string `json:"reason"`
+}
+
+type PinnedRun struct {
+	Name      string     `json:"name"`
+	Namespace string     `json:"namespace"`
+	UID       string     `json:"uid"`
+	History   []PinEvent `json:"history"`
+}
+
+func isPinned(job *batchv1.Job) bool {
+	return job.Annotations[pinnedAnnotation] == "true"
+}
+
+func pinHistory(job *batchv1.Job) []PinEvent {
+	var history []PinEvent
+	if v := job.Annotations[pinHistoryAnnotation]; v != "" {
+		// a broken trail must not block pinning, it is started over
+		_ = json.Unmarshal([]byte(v), &history)
+	}
+
+	return history
+}
+
+func pinHandler(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset, pin bool) {
+	if r.Method != http.MethodPost {
+		writeError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+	name := r.URL.Query().Get("name")
+	if namespace == "" || name == "" {
+		writeError(w, "namespace and name parameters required", http.StatusBadRequest)
+		return
+	}
+
+	setPinned(w, r, clientset, namespace, name, pin)
+}
+
+// setPinned pins or unpins a run. Pinned Jobs lose their ttlSecondsAfterFinished so the
+// TTL controller keeps them, and the owner reference of their CronJob so the history
+// limits of a schedule do not remove them. Both are restored when the run is unpinned.
+// Signed off runs and baselines stay pinned.
+// With authentication, the user of the token is recorded instead of by.
+func setPinned(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset, namespace, name string, pin bool) {
+	var req PinRequest
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			writeError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	job, err := clientset.BatchV1().Jobs(namespace).Get(r.Context(), name, metav1.GetOptions{})
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	if isPinned(job) == pin {
+		respondJSON(w, newPinnedRun(job))
+		return
+	}
+
+	if !pin && isSignedOff(job) {
+		writeError(w, "the run was signed off, it stays pinned", http.StatusConflict)
+		return
+	}
+	if !pin {
+		_, all, err := loadBaselines(r.Context(), clientset, namespace)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		if isBaseline(all, job) {
+			writeError(w, "the run is a baseline of its suite, it stays pinned", http.StatusConflict)
+			return
+		}
+	}
+
+	event := PinEvent{Action: "pin", By: requestUser(r, req.By), Reason: req.Reason, Time: time.Now().UTC()}
+	if !pin {
+		event.Action = "unpin"
+	}
+	patch, err := pinPatch(job, event)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	job, err = clientset.BatchV1().Jobs(namespace).Patch(r.Context(), name, types.MergePatchType, data, metav1.PatchOptions{})
+	if err != nil {
+		respondError(w, fmt.Errorf("cannot %s job: %w", event.Action, err))
+		return
+	}
+
+	respondJSON(w, newPinnedRun(job))
+}
+
+// pinPatch returns the merge patch recording event, a pin or unpin, on job.
+func pinPatch(job *batchv1.Job, event PinEvent) (map[string]interface{}, error) {
+	history, err := json.Marshal(append(pinHistory(job), event))
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := map[string]interface{}{pinHistoryAnnotation: string(history)}
+	metadata := map[string]interface{}{"annotations": annotations}
+	spec := map[string]interface{}{}
+	if event.Action == "pin" {
+		annotations[pinnedAnnotation] = "true"
+		if ttl := job.Spec.TTLSecondsAfterFinished; ttl != nil {
+			annotations[pinnedTTLAnnotation] = strconv.Itoa(int(*ttl))
+			spec["ttlSecondsAfterFinished"] = nil
+		}
+		// the CronJob controller trims the finished Jobs it controls only
+		owners := []metav1.OwnerReference{}
+		var cronJobs []metav1.OwnerReference
+		for _, ref := range job.OwnerReferences {
+			if ref.Kind == "CronJob" {
+				cronJobs = append(cronJobs, ref)
+			} else {
+				owners = append(owners, ref)
+			}
+		}
+		if len(cronJobs) > 0 {
+			data, err := json.Marshal(cronJobs)
+			if err != nil {
+				return nil, err
+			}
+			annotations[pinnedOwnerAnnotation] = string(data)
+			metadata["ownerReferences"] = owners
+		}
+	} else {
+		annotations[pinnedAnnotation] = nil
+		annotations[pinnedTTLAnnotation] = nil
+		annotations[pinnedOwnerAnnotation] = nil
+		if v, ok := job.Annotations[pinnedTTLAnnotation]; ok {
+			if ttl, err := strconv.Atoi(v); err == nil {
+				spec["ttlSecondsAfterFinished"] = ttl
+			}
+		}
+		var cronJobs []metav1.OwnerReference
+		if v := job.Annotations[pinnedOwnerAnnotation]; v != "" && json.Unmarshal([]byte(v), &cronJobs) == nil {
+			metadata["ownerReferences"] = append(append([]metav1.OwnerReference{}, job.OwnerReferences...), cronJobs...)
+		}
+	}
+
+	patch := map[string]interface{}{"metadata": metadata}
+	if len(spec) > 0 {
+		patch["spec"] = spec
+	}
+
+	return patch, nil
+}
+
+func newPinnedRun(job *batchv1.Job) PinnedRun {
+	return PinnedRun{
+		Name:      job.Name,
+		Namespace: job.Namespace,
+		UID:       string(job.UID),
+		History:   pinHistory(job),
+	}
+}
+
+func listPinned(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset, namespace string) {
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(r.Context(), metav1.ListOptions{})
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	pinned := []PinnedRun{}
+	for i := range jobs.Items {
+		if isPinned(&jobs.Items[i]) {
+			pinned = append(pinned, newPinnedRun(&jobs.Items[i]))
+		}
+	}
+
+	respondJSON(w, pinned)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+// applyMergePatch applies a merge patch of pinPatch to a copy of job.
+func applyMergePatch(t *testing.T, job *batchv1.Job, patch map[string]interface{}) *batchv1.Job {
+	t.Helper()
+	var original map[string]interface{}
+	data, _ := json.Marshal(job)
+	if err := json.Unmarshal(data, &original); err != nil {
+		t.Fatal(err)
+	}
+	var merge func(dst, src map[string]interface{})
+	merge = func(dst, src map[string]interface{}) {
+		for k, v := range src {
+			switch v := v.(type) {
+			case nil:
+				delete(dst, k)
+			case map[string]interface{}:
+				nested, _ := dst[k].(map[string]interface{})
+				if nested == nil {
+					nested = map[string]interface{}{}
+				}
+				merge(nested, v)
+				dst[k] = nested
+			default:
+				dst[k] = v
+			}
+		}
+	}
+	var normalized map[string]interface{}
+	data, _ = json.Marshal(patch)
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		t.Fatal(err)
+	}
+	merge(original, normalized)
+
+	patched := &batchv1.Job{}
+	data, _ = json.Marshal(original)
+	if err := json.Unmarshal(data, patched); err != nil {
+		t.Fatal(err)
+	}
+	return patched
+}
+
+func TestPinPatchKeepsScheduledRunsFromTheHistoryLimit(t *testing.T) {
+	cronJob := metav1.OwnerReference{APIVersion: "batch/v1", Kind: "CronJob", Name: "schedule-nightly", UID: "cron-uid", Controller: ptr.To(true)}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "schedule-nightly-1", OwnerReferences: []metav1.OwnerReference{cronJob}},
+		Spec:       batchv1.JobSpec{TTLSecondsAfterFinished: ptr.To(int32(3600))},
+	}
+
+	patch, err := pinPatch(job, PinEvent{Action: "pin", By: "alice", Time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned := applyMergePatch(t, job, patch)
+	if !isPinned(pinned) || len(pinned.OwnerReferences) != 0 || pinned.Spec.TTLSecondsAfterFinished != nil {
+		t.Fatalf("pinned run = %+v, want it pinned without TTL and CronJob owner", pinned.ObjectMeta)
+	}
+
+	patch, err = pinPatch(pinned, PinEvent{Action: "unpin", By: "alice", Time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unpinned := applyMergePatch(t, pinned, patch)
+	if isPinned(unpinned) || !reflect.DeepEqual(unpinned.OwnerReferences, []metav1.OwnerReference{cronJob}) || ptr.Deref(unpinned.Spec.TTLSecondsAfterFinished, 0) != 3600 {
+		t.Errorf("unpinned run = %+v, want the CronJob owner and TTL back", unpinned.ObjectMeta)
+	}
+	if _, ok := unpinned.Annotations[pinnedOwnerAnnotation]; ok {
+		t.Errorf("unpinned run keeps %s", pinnedOwnerAnnotation)
+	}
+	if history := pinHistory(unpinned); len(history) != 2 || history[1].Action != "unpin" {
+		t.Errorf("pin history = %+v, want pin and unpin", history)
+	}
+}
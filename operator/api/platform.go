@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// platformLabel records the platform a run was scheduled on as os-arch, e.g. linux-arm64,
+// for grouping results by platform. Runs without OS or Arch are not labeled, they run
+// wherever the scheduler puts them.
+const (
+	platformLabel = "playwright.operator/platform"
+	linuxOS       = "linux"
+	windowsOS     = "windows"
+)
+
+var platformArchs = map[string]bool{"amd64": true, "arm64": true}
+
+// platform returns the OS and architecture of a run, defaulting the one not given, or
+// nothing when neither is.
+func (spec RunSpec) platform() (string, string) {
+	if spec.OS == "" && spec.Arch == "" {
+		return "", ""
+	}
+
+	os, arch := spec.OS, spec.Arch
+	if os == "" {
+		os = linuxOS
+	}
+	if arch == "" {
+		arch = "amd64"
+	}
+
+	return os, arch
+}
+
+// validatePlatform checks the platform of a run and what runs on Windows nodes can use:
+// the default command, the browser probe, the Linux sandbox and network faults all need a
+// Linux container.
+func validatePlatform(spec RunSpec) error {
+	os, arch := spec.platform()
+	if os == "" {
+		return nil
+	}
+	if os != linuxOS && os != windowsOS {
+		return fmt.Errorf("os must be %s or %s", linuxOS, windowsOS)
+	}
+	if !platformArchs[arch] {
+		return fmt.Errorf("arch must be amd64 or arm64")
+	}
+	if os != windowsOS {
+		return nil
+	}
+
+	if arch != "amd64" {
+		return fmt.Errorf("windows runs need amd64 nodes")
+	}
+	if len(spec.Command) == 0 {
+		return fmt.Errorf("windows runs need a command, the default one is a shell script")
+	}
+	if spec.Browser == "chromium-sandbox" {
+		return fmt.Errorf("the chromium sandbox is not available on windows")
+	}
+	if spec.Chaos != nil && spec.Chaos.netemArgs() != "" {
+		return fmt.Errorf("network faults are not available on windows")
+	}
+
+	return nil
+}
+
+// addPlatform schedules the pod onto nodes of the platform, tolerating the taints cloud
+// providers put on Windows and ARM node pools to keep other workloads off them.
+func addPlatform(spec *corev1.PodSpec, os, arch string) {
+	if spec.NodeSelector == nil {
+		spec.NodeSelector = map[string]string{}
+	}
+	spec.NodeSelector[corev1.LabelOSStable] = os
+	spec.NodeSelector[corev1.LabelArchStable] = arch
+
+	if os == windowsOS {
+		spec.OS = &corev1.PodOS{Name: corev1.Windows}
+		spec.Tolerations = append(spec.Tolerations,
+			corev1.Toleration{Key: "os", Operator: corev1.TolerationOpEqual, Value: windowsOS, Effect: corev1.TaintEffectNoSchedule},
+			corev1.Toleration{Key: "node.kubernetes.io/os", Operator: corev1.TolerationOpEqual, Value: windowsOS, Effect: corev1.TaintEffectNoSchedule},
+		)
+	}
+	if arch == "arm64" {
+		spec.Tolerations = append(spec.Tolerations, corev1.Toleration{
+			Key:      corev1.LabelArchStable,
+			Operator: corev1.TolerationOpEqual,
+			Value:    arch,
+			Effect:   corev1.TaintEffectNoSchedule,
+		})
+	}
+}
+
+// validateNodePlatform checks that the cluster has a node of the platform, so a run fails
+// right away instead of staying pending.
+func validateNodePlatform(ctx context.Context, clientset *kubernetes.Clientset, os, arch string) error {
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{
+			corev1.LabelOSStable:   os,
+			corev1.LabelArchStable: arch,
+		}).String(),
+		Limit: 1,
+	})
+	if err != nil {
+		return fmt.Errorf("listing nodes: %w", err)
+	}
+	if len(nodes.Items) == 0 {
+		return fmt.Errorf("no %s/%s node pool in the cluster", os, arch)
+	}
+
+	return nil
+}
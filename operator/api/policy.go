@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	suitePolicyConfigMap = "playwright-suite-policies"
+	suitePolicyKey       = "policies.json"
+	// supersededByAnnotation names the run that cancelled a superseded run.
+	supersededByAnnotation = "playwright.operator/superseded-by"
+)
+
+// Concurrency policies of a suite.
+const (
+	// concurrencyAllow lets runs of a suite and branch run side by side.
+	concurrencyAllow = "allow"
+	// concurrencyCancelSuperseded cancels the running runs of a suite and branch when a
+	// new one is triggered, for pipelines where only the latest commit matters.
+	concurrencyCancelSuperseded = "cancel-superseded"
+)
+
+type SuitePolicy struct {
+	Concurrency string `json:"concurrency"`
+	// Retention prunes the artifacts of passing tests, all are kept without.
+	Retention *ArtifactRetention `json:"retention,omitempty"`
+	// Labels are added to the runs of the suite that do not set them, e.g. {"team":
+	// "checkout"} for the cost labels of the settings.
+	Labels map[string]string `json:"labels,omitempty"`
+	// ReportRetention prunes the results of the runs of the suite, next to the retention
+	// of the settings.
+	ReportRetention *ReportRetention `json:"reportRetention,omitempty"`
+	// TestManagement pushes the outcomes of the runs of the suite to TestRail or Xray.
+	TestManagement *TestManagement `json:"testManagement,omitempty"`
+}
+
+func (p SuitePolicy) validate() error {
+	if p.Concurrency != concurrencyAllow && p.Concurrency != concurrencyCancelSuperseded {
+		return fmt.Errorf("concurrency must be %q or %q", concurrencyAllow, concurrencyCancelSuperseded)
+	}
+	if err := validateLabels(p.Labels); err != nil {
+		return err
+	}
+	for key := range p.Labels {
+		if strings.HasPrefix(key, operatorLabelPrefix) {
+			return fmt.Errorf("label %q is set by the operator", key)
+		}
+	}
+	if p.ReportRetention != nil {
+		if err := p.ReportRetention.validate(); err != nil {
+			return fmt.Errorf("reportRetention: %w", err)
+		}
+	}
+	if p.TestManagement != nil {
+		if err := p.TestManagement.validate(); err != nil {
+			return fmt.Errorf("testManagement: %w", err)
+		}
+	}
+	if p.Retention != nil {
+		return p.Retention.validate()
+	}
+
+	return nil
+}
+
+func loadSuitePolicies(ctx context.Context, clientset *kubernetes.Clientset, namespace string) (*corev1.ConfigMap, map[string]SuitePolicy, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, suitePolicyConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: suitePolicyConfigMap, Namespace: namespace}}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	policies := map[string]SuitePolicy{}
+	if data := cm.Data[suitePolicyKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &policies); err != nil {
+			return nil, nil, fmt.Errorf("decoding %s: %w", suitePolicyConfigMap, err)
+		}
+	}
+
+	return cm, policies, nil
+}
+
+func suitePolicy(policies map[string]SuitePolicy, suite string) SuitePolicy {
+	policy, ok := policies[suite]
+	if !ok {
+		policy.Concurrency = concurrencyAllow
+	}
+
+	return policy
+}
+
+// cancelSuperseded cancels the other running runs of the suite and branch of a new run,
+// when the policy of the suite asks for it. Runs are cancelled by an elapsed deadline, so
+// they fail with their pods terminated and stay in the history, annotated with the run
+// that superseded them. The other runs of the matrix of a run are its siblings, not older
+// runs, and are kept.
+func cancelSuperseded(ctx context.Context, clientset *kubernetes.Clientset, run *batchv1.Job) error {
+	suite := run.Labels[suiteLabel]
+	if suite == "" {
+		return nil
+	}
+
+	_, policies, err := loadSuitePolicies(ctx, clientset, run.Namespace)
+	if err != nil {
+		return err
+	}
+	if suitePolicy(policies, suite).Concurrency != concurrencyCancelSuperseded {
+		return nil
+	}
+
+	// runs without a branch supersede each other as well
+	selector := labels.Set{suiteLabel: suite}.String()
+	if branch := run.Labels[branchLabel]; branch != "" {
+		selector += "," + labels.Set{branchLabel: branch}.String()
+	} else {
+		selector += ",!" + branchLabel
+	}
+
+	jobs, err := clientset.BatchV1().Jobs(run.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs.Items {
+		if job.UID == run.UID || jobState(&job) != jobStateRunning || matrixSiblings(&job, run) {
+			continue
+		}
+
+		patch, _ := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]string{supersededByAnnotation: run.Name},
+			},
+			"spec": map[string]interface{}{
+				"activeDeadlineSeconds": 1,
+			},
+		})
+		if _, err := clientset.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("cancelling superseded run %s: %w", job.Name, err)
+		}
+		log.Printf("run %s/%s superseded by %s", job.Namespace, job.Name, run.Name)
+	}
+
+	return nil
+}
+
+// supersede cancels the runs a created run supersedes, see cancelSuperseded. Failures are
+// only logged: the run exists, failing its request would make clients create it again.
+func supersede(ctx context.Context, clientset *kubernetes.Clientset, run *batchv1.Job) {
+	if err := cancelSuperseded(ctx, clientset, run); err != nil {
+		log.Printf("cannot cancel the runs superseded by %s/%s: %v", run.Namespace, run.Name, err)
+	}
+}
+
+// matrixSiblings tells whether two runs were created by the same matrix request.
+func matrixSiblings(a, b *batchv1.Job) bool {
+	matrix := a.Labels[matrixLabel]
+	return matrix != "" && matrix == b.Labels[matrixLabel]
+}
+
+// GET /suites/{name}/policy?namespace=ns
+func getSuitePolicy(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	_, policies, err := loadSuitePolicies(r.Context(), clientset, getNamespace(r.URL.Query().Get("namespace")))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, suitePolicy(policies, r.PathValue("name")))
+}
+
+// PUT /suites/{name}/policy?namespace=ns with {"concurrency": "allow|cancel-superseded",
+// "retention": {"passingSamplePercent": 10}, "reportRetention": {"maxCount": 50}},
+// concurrency defaults to allow
+func setSuitePolicy(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+	suite := r.PathValue("name")
+
+	var policy SuitePolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		writeError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if policy.Concurrency == "" {
+		policy.Concurrency = concurrencyAllow
+	}
+	if err := policy.validate(); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for attempt := 0; ; attempt++ {
+		cm, policies, err := loadSuitePolicies(r.Context(), clientset, namespace)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+
+		if policy.Concurrency == concurrencyAllow && policy.Retention == nil {
+			delete(policies, suite)
+		} else {
+			policies[suite] = policy
+		}
+
+		data, err := json.Marshal(policies)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[suitePolicyKey] = string(data)
+
+		if cm.ResourceVersion == "" {
+			_, err = clientset.CoreV1().ConfigMaps(namespace).Create(r.Context(), cm, metav1.CreateOptions{})
+		} else {
+			_, err = clientset.CoreV1().ConfigMaps(namespace).Update(r.Context(), cm, metav1.UpdateOptions{})
+		}
+		if err == nil {
+			break
+		}
+		if (!apierrors.IsConflict(err) && !apierrors.IsAlreadyExists(err)) || attempt == 4 {
+			respondError(w, err)
+			return
+		}
+	}
+
+	respondJSON(w, policy)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMatrixSiblings(t *testing.T) {
+	run := func(matrix string) *batchv1.Job {
+		labels := map[string]string{suiteLabel: "checkout", branchLabel: "main"}
+		if matrix != "" {
+			labels[matrixLabel] = matrix
+		}
+		return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Labels: labels}}
+	}
+
+	for _, tc := range []struct {
+		a, b string
+		want bool
+	}{
+		{"m-1", "m-1", true},
+		{"m-1", "m-2", false},
+		{"m-1", "", false},
+		{"", "", false},
+	} {
+		if got := matrixSiblings(run(tc.a), run(tc.b)); got != tc.want {
+			t.Errorf("matrixSiblings(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
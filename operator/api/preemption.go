@@ -0,0 +1,100 @@
+package main
+
+import (
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const checkpointDir = resultsMountPath + "/checkpoints/$(JOB_UID)"
+
+// resumableRunScript runs the tests with their output kept per Job, and per shard of
+// sharded runs, so a pod replacing a preempted one finds the state of the previous
+// attempt. Playwright records only failed tests in .last-run.json, so the replacement
+// reruns just those when the previous attempt got through all tests, and everything when
+// it was interrupted. The counts of the JSON report are written as the termination
+// message, see testCounts, which is why the shell stays around and passes on the
+// termination of a preempted pod. Suites with an artifact retention prune their artifacts
+// before, see addArtifactRetention. Shards also write a blob report, which are merged
+// into the report of the run once it finished, see startReportMerge.
+const resumableRunScript = `dir="$PLAYWRIGHT_CHECKPOINT_DIR${JOB_COMPLETION_INDEX:+/shard-$JOB_COMPLETION_INDEX}"
+reporters=html,json
+if grep -q '"status": *"failed"' "$dir/.last-run.json" 2>/dev/null; then set -- "$@" --last-failed; fi
+if [ -n "$PLAYWRIGHT_SHARD_TOTAL" ]; then
+  set -- "$@" --shard="$((JOB_COMPLETION_INDEX + 1))/$PLAYWRIGHT_SHARD_TOTAL"
+  reporters=$reporters,blob
+  export PLAYWRIGHT_BLOB_OUTPUT_FILE="$PLAYWRIGHT_CHECKPOINT_DIR/blobs/shard-$JOB_COMPLETION_INDEX.zip"
+fi
+PLAYWRIGHT_JSON_OUTPUT_NAME="$dir/results.json" \
+  npx playwright test --reporter=$reporters --trace on --output "$dir" "$@" &
+trap 'kill -TERM $!' TERM
+wait $!
+status=$?
+if [ -n "$PLAYWRIGHT_PRUNE_SCRIPT" ]; then node -e "$PLAYWRIGHT_PRUNE_SCRIPT" "$dir/results.json"; fi
+node -e '
+const s = JSON.parse(require("fs").readFileSync(process.argv[1])).stats;
+require("fs").writeFileSync("/dev/termination-log", JSON.stringify({passed: s.expected, failed: s.unexpected, flaky: s.flaky, skipped: s.skipped}));
+' "$dir/results.json" 2>/dev/null
+exit $status`
+
+// Preemption is a pod of a run that was terminated by a disruption, like the reclaim of
+// a spot node, and replaced without counting as a failure.
+type Preemption struct {
+	Pod     string    `json:"pod"`
+	Node    string    `json:"node,omitempty"`
+	Reason  string    `json:"reason"`
+	Message string    `json:"message,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// disruptionPolicy replaces pods terminated by disruptions instead of failing the run, as
+// a preempted node says nothing about the tests.
+func disruptionPolicy() *batchv1.PodFailurePolicy {
+	return &batchv1.PodFailurePolicy{
+		Rules: []batchv1.PodFailurePolicyRule{
+			{
+				Action: batchv1.PodFailurePolicyActionIgnore,
+				OnPodConditions: []batchv1.PodFailurePolicyOnPodConditionsPattern{
+					{Type: corev1.DisruptionTarget, Status: corev1.ConditionTrue},
+				},
+			},
+		},
+	}
+}
+
+// checkpointEnv locates the checkpoint of the Job in the results volume.
+func checkpointEnv() []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{
+			Name: "JOB_UID",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.labels['batch.kubernetes.io/controller-uid']"},
+			},
+		},
+		{Name: "PLAYWRIGHT_CHECKPOINT_DIR", Value: checkpointDir},
+	}
+}
+
+// preemptions lists the pods of a run that were disrupted, e.g. by a spot node shutdown
+// (TerminationByKubelet), a drain after a termination notice (EvictionByEvictionAPI) or
+// the scheduler (PreemptionByScheduler).
+func preemptions(pods []corev1.Pod) []Preemption {
+	var found []Preemption
+	for _, pod := range pods {
+		for _, c := range pod.Status.Conditions {
+			if c.Type != corev1.DisruptionTarget || c.Status != corev1.ConditionTrue {
+				continue
+			}
+			found = append(found, Preemption{
+				Pod:     pod.Name,
+				Node:    pod.Spec.NodeName,
+				Reason:  c.Reason,
+				Message: c.Message,
+				Time:    c.LastTransitionTime.Time,
+			})
+		}
+	}
+
+	return found
+}
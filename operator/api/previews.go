@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+// Runs created while previews are enabled carry previewsLabel until their preview Job
+// was started, which is labeled with the UID of its run.
+const (
+	previewsLabel   = "playwright.operator/previews"
+	previewsPending = "pending"
+	previewRunLabel = "playwright.operator/preview-run"
+)
+
+// videoPreviewScript writes a poster image and a small, low frame rate copy next to
+// every video of a run, which the gallery of the dashboard shows instead of the video.
+// The thumbnail filter picks a representative frame rather than the blank first one.
+const videoPreviewScript = `find "$1" -name '*.webm' ! -name '*.preview.webm' | while read -r video; do
+  base="${video%.webm}"
+  ffmpeg -nostdin -loglevel error -y -i "$video" -vf thumbnail,scale=320:-2 -frames:v 1 "$base.poster.jpg"
+  ffmpeg -nostdin -loglevel error -y -i "$video" -vf fps=5,scale=320:-2 -c:v libvpx -b:v 150k -an "$base.preview.webm"
+done`
+
+// videoPreviewImage is the ffmpeg image of the preview Jobs, previews are disabled
+// without.
+func videoPreviewImage() string {
+	return os.Getenv("VIDEO_PREVIEW_IMAGE")
+}
+
+// addVideoPreviews marks a run to get previews of its videos once it finished.
+func addVideoPreviews(job *batchv1.Job) {
+	if job.Labels == nil {
+		job.Labels = map[string]string{}
+	}
+	job.Labels[previewsLabel] = previewsPending
+}
+
+// startVideoPreviews creates the Job generating the previews of a finished run. It mounts
+// the results volume and works on the checkpoint directory of the run, where the gallery
+// finds the videos.
+func startVideoPreviews(ctx context.Context, clientset *kubernetes.Clientset, run *batchv1.Job) error {
+	labels := spawnedLabels(run, map[string]string{previewRunLabel: string(run.UID)})
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "playwright-previews-",
+			Namespace:    run.Namespace,
+			Labels:       labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            ptr.To[int32](1),
+			TTLSecondsAfterFinished: ptr.To[int32](3600),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: copyLabels(labels)},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:    "ffmpeg",
+							Image:   videoPreviewImage(),
+							Command: []string{"sh", "-c", videoPreviewScript, "sh", resultsMountPath + "/checkpoints/" + string(run.UID)},
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: resultsVolumeName, MountPath: resultsMountPath},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: resultsVolumeName,
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: resultsClaimName,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	created, err := clientset.BatchV1().Jobs(run.Namespace).Create(ctx, job, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("starting video previews: %w", err)
+	}
+	log.Printf("started video previews %s/%s for run %s/%s", created.Namespace, created.Name, run.Namespace, run.Name)
+
+	return nil
+}
+
+// generateVideoPreviews starts the preview Jobs of finished runs and drops their previews
+// label.
+func generateVideoPreviews(ctx context.Context, clientset *kubernetes.Clientset, informers *runInformers, namespace string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		jobs, err := informers.runs(ctx, namespace, previewsLabel+"="+previewsPending)
+		if err != nil {
+			log.Printf("cannot list runs waiting for video previews: %v", err)
+			continue
+		}
+
+		for i := range jobs {
+			job := &jobs[i]
+			if state := jobState(job); state != jobStateSucceeded && state != jobStateFailed && state != jobStateCancelled {
+				continue
+			}
+
+			if err := startVideoPreviews(ctx, clientset, job); err != nil {
+				log.Printf("cannot start video previews of run %s/%s: %v", job.Namespace, job.Name, err)
+				continue
+			}
+
+			patch, _ := json.Marshal(map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": map[string]interface{}{previewsLabel: nil},
+				},
+			})
+			if _, err := clientset.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+				log.Printf("cannot label run %s/%s: %v", job.Namespace, job.Name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Reasons a run waits to start.
+const (
+	// queueSuspended runs wait for admission, e.g. by Kueue, which suspends Jobs until
+	// their quota is available.
+	queueSuspended = "suspended"
+	// queueUnschedulable runs wait for capacity on the nodes.
+	queueUnschedulable = "unschedulable"
+	// queueImagePull runs cannot pull their image, see imagePullErrors.
+	queueImagePull = "image-pull"
+	queueStarting  = "starting"
+	queuePending   = "pending"
+)
+
+// typicalRuns is the number of recent finished runs whose median duration estimates when
+// running runs free their capacity.
+const typicalRuns = 20
+
+// QueueStatus explains why a run has not started yet.
+type QueueStatus struct {
+	// Position counts the waiting runs of the namespace created before this one, plus one.
+	Position int       `json:"position"`
+	Waiting  int       `json:"waiting"`
+	Reason   string    `json:"reason"`
+	Message  string    `json:"message,omitempty"`
+	Since    time.Time `json:"since"`
+	// ExpectedStart is estimated for runs waiting for capacity, from when the running
+	// runs are expected to finish.
+	ExpectedStart *time.Time `json:"expectedStart,omitempty"`
+}
+
+type QueuedRun struct {
+	Run   RunRef      `json:"run"`
+	Queue QueueStatus `json:"queue"`
+}
+
+// waitReason tells why a run has not started, or returns "" when it started or finished.
+func waitReason(job *batchv1.Job, pods []corev1.Pod) (string, string) {
+	switch jobState(job) {
+	case jobStateSuspended:
+		return queueSuspended, "the run is suspended until it is admitted"
+	case jobStateRunning:
+	default:
+		return "", ""
+	}
+
+	if len(pods) == 0 {
+		return queuePending, "waiting for the pod to be created"
+	}
+
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodPending {
+			return "", ""
+		}
+	}
+
+	for _, pod := range pods {
+		for _, c := range pod.Status.Conditions {
+			if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse && c.Reason == corev1.PodReasonUnschedulable {
+				return queueUnschedulable, c.Message
+			}
+		}
+	}
+	if errs := imagePullErrors(pods); len(errs) > 0 {
+		return queueImagePull, errs[0].Reason + ": " + errs[0].Message
+	}
+
+	return queueStarting, "pulling the image and creating the containers"
+}
+
+func medianDuration(jobs []batchv1.Job) (time.Duration, bool) {
+	var durations []time.Duration
+	for i := range jobs {
+		if d, ok := jobDuration(&jobs[i]); ok {
+			durations = append(durations, d)
+		}
+		if len(durations) == typicalRuns {
+			break
+		}
+	}
+	if len(durations) == 0 {
+		return 0, false
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	return durations[len(durations)/2], true
+}
+
+// runQueue computes the queue status of the waiting runs of a namespace, by Job UID.
+func runQueue(ctx context.Context, informers *runInformers, namespace string) (map[string]QueueStatus, []batchv1.Job, error) {
+	ni, err := informers.synced(ctx, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	jobs := informers.jobs.list(namespace, jobQuery{})
+
+	// newest finished runs first for the typical duration, oldest waiting runs first
+	sortJobs(jobs, "completionTime", false)
+	typical, haveTypical := medianDuration(finishedRuns(jobs))
+
+	var waiting []batchv1.Job
+	var frees []time.Time
+	statuses := map[string]QueueStatus{}
+	for _, job := range jobs {
+		reason, message := waitReason(&job, ni.podsOf(job.Name))
+		if reason == "" {
+			if job.Status.StartTime != nil && jobState(&job) == jobStateRunning && haveTypical {
+				frees = append(frees, job.Status.StartTime.Add(typical))
+			}
+			continue
+		}
+		waiting = append(waiting, job)
+		statuses[string(job.UID)] = QueueStatus{Reason: reason, Message: message, Since: job.CreationTimestamp.Time}
+	}
+	sortJobs(waiting, "creationTimestamp", true)
+	sort.Slice(frees, func(i, j int) bool { return frees[i].Before(frees[j]) })
+
+	now := time.Now()
+	blocked := 0
+	for i, job := range waiting {
+		status := statuses[string(job.UID)]
+		status.Position = i + 1
+		status.Waiting = len(waiting)
+
+		if status.Reason == queueUnschedulable {
+			// each run finishing makes room for the next blocked run
+			if blocked < len(frees) {
+				start := frees[blocked]
+				if start.Before(now) {
+					start = now
+				}
+				status.ExpectedStart = &start
+			}
+			blocked++
+		}
+		statuses[string(job.UID)] = status
+	}
+
+	return statuses, waiting, nil
+}
+
+// GET /runs/queue?namespace=ns lists the runs waiting to start, in queue order.
+func listQueue(w http.ResponseWriter, r *http.Request, informers *runInformers) {
+	statuses, waiting, err := runQueue(r.Context(), informers, getNamespace(r.URL.Query().Get("namespace")))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	queue := []QueuedRun{}
+	for _, job := range waiting {
+		queue = append(queue, QueuedRun{
+			Run:   RunRef{Namespace: job.Namespace, Name: job.Name, UID: string(job.UID)},
+			Queue: statuses[string(job.UID)],
+		})
+	}
+
+	respondJSON(w, queue)
+}
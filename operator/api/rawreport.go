@@ -0,0 +1,329 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// rawReportLabel marks the runs whose original reports are archived next to their HTML
+// report.
+const rawReportLabel = "playwright.operator/raw-report-archived"
+
+// rawReportDir keeps the reports of a run as Playwright wrote them, below the HTML report
+// of the run so they are uploaded and retained with it: the JSON report gzipped as
+// results.json.gz and, for sharded runs, the blob report as report.zip, both in a
+// shard-N directory per shard.
+func rawReportDir(uid types.UID, shard *int) string {
+	dir := filepath.Join(resultsDir, string(uid), "raw")
+	if shard != nil {
+		dir = filepath.Join(dir, fmt.Sprintf("shard-%d", *shard))
+	}
+
+	return dir
+}
+
+// writeFileAtomic writes a file through a temporary one, so readers never see a partial
+// archive.
+func writeFileAtomic(file string, write func(io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
+
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return writeFileAtomic(dst, func(w io.Writer) error {
+		gz := gzip.NewWriter(w)
+		gz.Name = filepath.Base(src)
+		if _, err := io.Copy(gz, in); err != nil {
+			return err
+		}
+		return gz.Close()
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return writeFileAtomic(dst, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
+
+// archiveRawReports copies the JSON and blob reports of a finished run out of its
+// checkpoint. Missing reports, like those of shards that never ran, are skipped.
+func archiveRawReports(job *batchv1.Job) (int, error) {
+	checkpoint := filepath.Join(resultsDir, "checkpoints", string(job.UID))
+	shards := 0
+	if job.Spec.CompletionMode != nil && *job.Spec.CompletionMode == batchv1.IndexedCompletion && job.Spec.Completions != nil {
+		shards = int(*job.Spec.Completions)
+	}
+
+	archived := 0
+	for i := 0; i < max(shards, 1); i++ {
+		var shard *int
+		report := filepath.Join(checkpoint, "results.json")
+		if shards > 0 {
+			shard = &i
+			report = filepath.Join(checkpoint, fmt.Sprintf("shard-%d", i), "results.json")
+		}
+		dir := rawReportDir(job.UID, shard)
+
+		err := gzipFile(report, filepath.Join(dir, "results.json.gz"))
+		if err == nil {
+			archived++
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return archived, err
+		}
+
+		if shard == nil {
+			continue
+		}
+		err = copyFile(filepath.Join(checkpoint, "blobs", fmt.Sprintf("shard-%d.zip", i)), filepath.Join(dir, "report.zip"))
+		if err == nil {
+			archived++
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return archived, err
+		}
+	}
+
+	return archived, nil
+}
+
+// archiveRunReports archives the original reports and the filtered logs of finished runs
+// and labels the runs with rawReportLabel, recording the UIDs of their pods in
+// reportPodsAnnotation. Sharded runs wait for the Job merging their reports, which
+// replaces the HTML report directory.
+func archiveRunReports(ctx context.Context, clientset *kubernetes.Clientset, informers *runInformers, namespace string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		jobs, err := informers.runs(ctx, namespace, runsSelector+",!"+rawReportLabel+",!"+reportMergeLabel)
+		if err != nil {
+			log.Printf("cannot list runs to archive reports of: %v", err)
+			continue
+		}
+		merges, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{LabelSelector: mergeRunLabel})
+		if err != nil {
+			log.Printf("cannot list report merges: %v", err)
+			continue
+		}
+		merging := map[string]bool{}
+		for i := range merges.Items {
+			if jobState(&merges.Items[i]) == jobStateRunning {
+				merging[merges.Items[i].Labels[mergeRunLabel]] = true
+			}
+		}
+
+		for i := range jobs {
+			job := &jobs[i]
+			if state := jobState(job); state != jobStateSucceeded && state != jobStateFailed && state != jobStateCancelled {
+				continue
+			}
+			if merging[string(job.UID)] {
+				continue
+			}
+
+			if _, err := archiveRawReports(job); err != nil {
+				log.Printf("cannot archive the reports of run %s/%s: %v", job.Namespace, job.Name, err)
+				continue
+			}
+			if err := archiveRunLogs(ctx, clientset, job); err != nil {
+				log.Printf("cannot archive the logs of run %s/%s: %v", job.Namespace, job.Name, err)
+				continue
+			}
+
+			metadata := map[string]interface{}{
+				"labels": map[string]interface{}{rawReportLabel: "true"},
+			}
+			if uids, err := runPodUIDs(ctx, clientset, job); err != nil {
+				log.Printf("cannot list the pods of run %s/%s: %v", job.Namespace, job.Name, err)
+			} else if len(uids) > 0 {
+				metadata["annotations"] = map[string]interface{}{reportPodsAnnotation: joinUIDs(uids)}
+			}
+			patch, _ := json.Marshal(map[string]interface{}{"metadata": metadata})
+			if _, err := clientset.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+				log.Printf("cannot label run %s/%s: %v", job.Namespace, job.Name, err)
+			}
+		}
+	}
+}
+
+// GET /runs/{id}/report/raw?namespace=ns&format=json|blob&shard=n returns an original
+// report of a run, by Job UID or name. JSON reports are sent gzipped to clients accepting
+// it and decompressed to the others, blob reports, which only sharded runs have, as the
+// zip Playwright wrote.
+func getRawReport(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "blob" {
+		writeError(w, "format must be json or blob", http.StatusBadRequest)
+		return
+	}
+	var shard *int
+	if v := query.Get("shard"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, fmt.Sprintf("invalid shard %q", v), http.StatusBadRequest)
+			return
+		}
+		shard = &n
+	}
+	if format == "blob" && shard == nil {
+		writeError(w, "blob reports are per shard, shard parameter required", http.StatusBadRequest)
+		return
+	}
+
+	job, err := findRun(r.Context(), clientset, getNamespace(query.Get("namespace")), r.PathValue("id"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if job == nil {
+		writeError(w, "run not found", http.StatusNotFound)
+		return
+	}
+
+	dir := rawReportDir(job.UID, shard)
+	name := job.Name
+	if shard != nil {
+		name += fmt.Sprintf("-shard-%d", *shard)
+	}
+
+	if format == "blob" {
+		serveRawFile(w, r, filepath.Join(dir, "report.zip"), name+".zip", "application/zip", "")
+		return
+	}
+
+	serveGzipFile(w, r, filepath.Join(dir, "results.json.gz"), name+".json", "application/json")
+}
+
+// GET /runs/{id}/logs/archived?namespace=ns returns the logs of a finished run as archived,
+// with the log filters applied, by Job UID or name.
+func getArchivedLogs(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	job, err := findRun(r.Context(), clientset, getNamespace(r.URL.Query().Get("namespace")), r.PathValue("id"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if job == nil {
+		writeError(w, "run not found", http.StatusNotFound)
+		return
+	}
+
+	file := runLogsFile(job.UID)
+	if _, err := os.Stat(file); errors.Is(err, fs.ErrNotExist) {
+		writeError(w, "the run has no archived logs", http.StatusNotFound)
+		return
+	}
+	serveGzipFile(w, r, file, job.Name+".log", "text/plain; charset=utf-8")
+}
+
+// serveGzipFile serves a gzipped archive as is to clients accepting gzip and decompressed
+// to the others.
+func serveGzipFile(w http.ResponseWriter, r *http.Request, file, filename, contentType string) {
+	w.Header().Set("Vary", "Accept-Encoding")
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		serveRawFile(w, r, file, filename, contentType, "gzip")
+		return
+	}
+
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		writeError(w, "the run has no archived report", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if _, err := io.Copy(w, gz); err != nil {
+		log.Printf("cannot send %s: %v", filename, err)
+	}
+}
+
+// serveRawFile serves an archived report as a download, with ranges for resumed downloads.
+func serveRawFile(w http.ResponseWriter, r *http.Request, file, filename, contentType, encoding string) {
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		writeError(w, "the run has no archived report", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ImagePullError describes a container that cannot start because its image cannot be pulled.
+type ImagePullError struct {
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Image     string `json:"image"`
+	Reason    string `json:"reason"`
+	Message   string `json:"message,omitempty"`
+}
+
+var imagePullReasons = map[string]bool{
+	"ErrImagePull":     true,
+	"ImagePullBackOff": true,
+	"InvalidImageName": true,
+}
+
+// imagePullSecretsAnnotation on a Namespace lists the image pull secrets of the runs in it
+// that name none of their own, comma separated. It replaces DEFAULT_IMAGE_PULL_SECRETS, so
+// the teams sharing an operator pull from registries of their own.
+const imagePullSecretsAnnotation = "playwright.operator/image-pull-secrets"
+
+// namespaceImagePullSecrets returns the secrets of imagePullSecretsAnnotation of a
+// namespace, none without permission to read the namespace.
+func namespaceImagePullSecrets(ctx context.Context, clientset *kubernetes.Clientset, namespace string) ([]string, error) {
+	ns, err := clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if apierrors.IsForbidden(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return splitList(ns.Annotations[imagePullSecretsAnnotation]), nil
+}
+
+// defaultImagePullSecrets returns the secrets configured through DEFAULT_IMAGE_PULL_SECRETS,
+// a comma separated list applied to runs that do not name their own.
+func defaultImagePullSecrets() []string {
+	var secrets []string
+	for _, name := range strings.Split(os.Getenv("DEFAULT_IMAGE_PULL_SECRETS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			secrets = append(secrets, name)
+		}
+	}
+
+	return secrets
+}
+
+// imageRegistry returns the registry host of an image reference, following the docker naming rules.
+func imageRegistry(image string) string {
+	first, _, found := strings.Cut(image, "/")
+	if !found {
+		return "docker.io"
+	}
+	if strings.ContainsAny(first, ".:") || first == "localhost" {
+		return first
+	}
+
+	return "docker.io"
+}
+
+// validateImagePull checks that the pull secrets exist and that at least one of them
+// holds credentials for the registry of the image, so a run fails before it is
+// scheduled instead of ending up in ImagePullBackOff.
+func validateImagePull(ctx context.Context, clientset *kubernetes.Clientset, namespace, image string, secrets []string) error {
+	if len(secrets) == 0 {
+		return nil
+	}
+
+	registry := imageRegistry(image)
+	for _, name := range secrets {
+		secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("image pull secret %s/%s: %w", namespace, name, err)
+		}
+
+		auths, err := dockerAuths(secret)
+		if err != nil {
+			return fmt.Errorf("image pull secret %s/%s: %w", namespace, name, err)
+		}
+
+		for host := range auths {
+			if registryMatches(host, registry) {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("none of the image pull secrets %v has credentials for registry %s", secrets, registry)
+}
+
+func dockerAuths(secret *corev1.Secret) (map[string]json.RawMessage, error) {
+	switch secret.Type {
+	case corev1.SecretTypeDockerConfigJson:
+		var cfg struct {
+			Auths map[string]json.RawMessage `json:"auths"`
+		}
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &cfg); err != nil {
+			return nil, err
+		}
+		return cfg.Auths, nil
+	case corev1.SecretTypeDockercfg:
+		var auths map[string]json.RawMessage
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigKey], &auths); err != nil {
+			return nil, err
+		}
+		return auths, nil
+	}
+
+	return nil, fmt.Errorf("unexpected secret type %s", secret.Type)
+}
+
+// registryMatches compares a docker config auth key, which may be a URL, with a registry host.
+func registryMatches(key, registry string) bool {
+	key = strings.TrimPrefix(key, "https://")
+	key = strings.TrimPrefix(key, "http://")
+	key, _, _ = strings.Cut(key, "/")
+
+	if registry == "docker.io" {
+		return key == "docker.io" || key == "index.docker.io" || key == "registry-1.docker.io"
+	}
+
+	return key == registry
+}
+
+// imagePullErrors collects the containers of the pods that are stuck pulling their image.
+func imagePullErrors(pods []corev1.Pod) []ImagePullError {
+	var errs []ImagePullError
+	for _, pod := range pods {
+		var statuses []corev1.ContainerStatus
+		statuses = append(statuses, pod.Status.InitContainerStatuses...)
+		statuses = append(statuses, pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			waiting := status.State.Waiting
+			if waiting == nil || !imagePullReasons[waiting.Reason] {
+				continue
+			}
+
+			errs = append(errs, ImagePullError{
+				Pod:       pod.Name,
+				Container: status.Name,
+				Image:     status.Image,
+				Reason:    waiting.Reason,
+				Message:   waiting.Message,
+			})
+		}
+	}
+
+	return errs
+}
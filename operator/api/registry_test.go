@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestImagePullSecretsOfTheNamespace(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/namespaces/team-a":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(corev1.Namespace{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+				ObjectMeta: metav1.ObjectMeta{Name: "team-a", Annotations: map[string]string{imagePullSecretsAnnotation: "registry-a, mirror"}},
+			})
+		case "/api/v1/namespaces/team-b":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(metav1.Status{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Status"}, Status: metav1.StatusFailure, Reason: metav1.StatusReasonForbidden, Code: http.StatusForbidden})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DEFAULT_IMAGE_PULL_SECRETS", "registry")
+
+	pullSecrets := func(spec RunSpec) []string {
+		t.Helper()
+		var err error
+		if spec.namespacePullSecrets, err = namespaceImagePullSecrets(context.Background(), clientset, spec.Namespace); err != nil {
+			t.Fatal(err)
+		}
+		job, err := newRunJob(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, ref := range job.Spec.Template.Spec.ImagePullSecrets {
+			names = append(names, ref.Name)
+		}
+		return names
+	}
+	for _, tc := range []struct {
+		name string
+		spec RunSpec
+		want []string
+	}{
+		{"namespace", RunSpec{Namespace: "team-a", Image: "registry.example.com/tests"}, []string{"registry-a", "mirror"}},
+		{"run", RunSpec{Namespace: "team-a", Image: "registry.example.com/tests", ImagePullSecrets: []string{"own"}}, []string{"own"}},
+		// without permission to read the namespace the defaults of the operator apply
+		{"forbidden", RunSpec{Namespace: "team-b", Image: "registry.example.com/tests"}, []string{"registry"}},
+	} {
+		if got := pullSecrets(tc.spec); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: image pull secrets %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+// rerunOfAnnotation names the run a run repeats.
+const rerunOfAnnotation = "playwright.operator/rerun-of"
+
+// jobControllerLabels are set by the Job controller on a Job and its pod template and
+// tie them to the UID of the Job, a copy must not carry them.
+var jobControllerLabels = []string{
+	"controller-uid",
+	batchv1.ControllerUidLabel,
+	"job-name",
+	batchv1.JobNameLabel,
+}
+
+// rerunDropLabels are the labels of a run that describe its own lifecycle rather than
+// what it runs.
+var rerunDropLabels = []string{previewsLabel, hooksLabel, warmLabel, reportMergeLabel, costFinalLabel, resultsUploadedLabel, historyLabel, rawReportLabel, testManagementLabel, notifiedLabel, scanLabel, checksumLabel}
+
+// rerunDropAnnotations are the annotations of a run that record its own state, e.g. its
+// pins, sign-off or cost, rather than how it runs.
+var rerunDropAnnotations = []string{
+	assignmentAnnotation, clonedFromAnnotation, costAnnotation, failureClassAnnotation,
+	pinnedAnnotation, pinnedOwnerAnnotation, pinnedTTLAnnotation, pinHistoryAnnotation, reportPodsAnnotation,
+	signOffAnnotation, soakViolationAnnotation, supersededByAnnotation, testManagementAnnotation,
+}
+
+// newRerunJob copies the pod template and run parameters of a Job into a new Job with a
+// generated name. The annotations are copied except those of rerunDropAnnotations and of
+// the Kubernetes controllers, so the rerun keeps e.g. its merge group, budget and matrix
+// values and can be cloned in turn.
+func newRerunJob(job *batchv1.Job) *batchv1.Job {
+	labels := copyLabels(job.Labels)
+	for _, key := range append(jobControllerLabels, rerunDropLabels...) {
+		delete(labels, key)
+	}
+	// the CPU pressure of the run starts anew with the rerun
+	delete(labels, chaosLabel)
+	if job.Annotations[cpuPressureAnnotation] != "" {
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[chaosLabel] = chaosPending
+	}
+
+	// reruns of reruns are named after the original run instead of stacking suffixes
+	prefix := job.Name
+	if original := job.Annotations[rerunOfAnnotation]; original != "" {
+		prefix = original
+	}
+
+	annotations := map[string]string{}
+	for key, value := range job.Annotations {
+		if !strings.HasPrefix(key, "batch.kubernetes.io/") && !strings.HasPrefix(key, "kubectl.kubernetes.io/last-applied") {
+			annotations[key] = value
+		}
+	}
+	for _, key := range rerunDropAnnotations {
+		delete(annotations, key)
+	}
+	annotations[rerunOfAnnotation] = job.Name
+
+	// pinned runs keep their TTL aside, the rerun is not pinned
+	ttl := job.Spec.TTLSecondsAfterFinished
+	if v, ok := job.Annotations[pinnedTTLAnnotation]; ok && ttl == nil {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			ttl = ptr.To(int32(seconds))
+		}
+	}
+
+	template := job.Spec.Template.DeepCopy()
+	for _, key := range jobControllerLabels {
+		delete(template.Labels, key)
+	}
+
+	// the name of the Job and its pods is limited to 63 characters, the API server
+	// appends five random ones
+	if len(prefix) > 50 {
+		prefix = prefix[:50]
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: prefix + "-rerun-",
+			Namespace:    job.Namespace,
+			Labels:       labels,
+			Annotations:  annotations,
+		},
+		Spec: batchv1.JobSpec{
+			Parallelism:             job.Spec.Parallelism,
+			Completions:             job.Spec.Completions,
+			CompletionMode:          job.Spec.CompletionMode,
+			ActiveDeadlineSeconds:   job.Spec.ActiveDeadlineSeconds,
+			BackoffLimit:            job.Spec.BackoffLimit,
+			BackoffLimitPerIndex:    job.Spec.BackoffLimitPerIndex,
+			MaxFailedIndexes:        job.Spec.MaxFailedIndexes,
+			PodFailurePolicy:        job.Spec.PodFailurePolicy,
+			PodReplacementPolicy:    job.Spec.PodReplacementPolicy,
+			TTLSecondsAfterFinished: ttl,
+			Template:                *template,
+		},
+	}
+}
+
+// errRerunChanged rejects reruns a pre-schedule hook changed, a rerun copies the Job of the
+// run and cannot apply the changes.
+var errRerunChanged = errors.New("a pre-schedule hook changed the run, clone it to start it with the changes")
+
+// rerunSpec is the spec a rerun is checked against, the stored spec of the run or, for
+// runs from before the spec was stored, what the Job tells of it. The labels are those of
+// the rerun, the policy of the suite included.
+func rerunSpec(job, rerun *batchv1.Job) RunSpec {
+	spec := RunSpec{Namespace: job.Namespace}
+	if stored, err := storedRunSpec(job); err == nil {
+		spec = *stored
+	} else {
+		pod := job.Spec.Template.Spec
+		spec.ServiceAccountName = pod.ServiceAccountName
+		spec.TTLSecondsAfterFinished = job.Spec.TTLSecondsAfterFinished
+		spec.Suite = job.Labels[suiteLabel]
+		spec.Branch = job.Labels[branchLabel]
+		if job.Spec.CompletionMode != nil && *job.Spec.CompletionMode == batchv1.IndexedCompletion && job.Spec.Completions != nil {
+			spec.Shards = int(*job.Spec.Completions)
+		}
+		for _, ref := range pod.ImagePullSecrets {
+			spec.ImagePullSecrets = append(spec.ImagePullSecrets, ref.Name)
+		}
+		if len(pod.Containers) > 0 {
+			spec.Image = pod.Containers[0].Image
+			spec.Command = pod.Containers[0].Command
+			spec.Env = map[string]string{}
+			for _, env := range pod.Containers[0].Env {
+				if env.ValueFrom == nil {
+					spec.Env[env.Name] = env.Value
+				}
+			}
+		}
+	}
+	spec.Labels = copyLabels(rerun.Labels)
+
+	return spec
+}
+
+// admitRerun checks a rerun like createRun checks new runs: against the run limit, the
+// cost labels, the pre-schedule hooks and the admission rules.
+func admitRerun(ctx context.Context, clientset *kubernetes.Clientset, settings Settings, job, rerun *batchv1.Job) error {
+	if err := checkRunLimit(ctx, clientset, job.Namespace, settings.MaxRunningRuns, 1); err != nil {
+		return err
+	}
+	spec := rerunSpec(job, rerun)
+	if err := checkCostLabels(settings, spec); err != nil {
+		return err
+	}
+	hooked, err := preScheduleHooks(ctx, settings, spec)
+	if err != nil {
+		return err
+	}
+	before, _ := json.Marshal(spec)
+	after, _ := json.Marshal(hooked)
+	if !bytes.Equal(before, after) {
+		return errRerunChanged
+	}
+
+	return admitRun(ctx, clientset, settings, spec)
+}
+
+// POST /jobs/rerun?namespace=ns&name=job starts a new run with the pod template of a Job,
+// e.g. to retry a flaky suite. Runs with minted credentials are cloned instead, as their
+// pods reference the Secret of the original run. Reruns are rejected like new runs, see
+// createJob, and with 409 when a pre-schedule hook changes them.
+func rerunJob(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	query := r.URL.Query()
+	namespace := getNamespace(query.Get("namespace"))
+	name := query.Get("name")
+	if name == "" {
+		writeError(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	job, err := clientset.BatchV1().Jobs(namespace).Get(r.Context(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		writeError(w, "job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if !isRun(job) {
+		writeError(w, "job is not a run", http.StatusNotFound)
+		return
+	}
+	if job.Labels[credentialsLabel] == "true" {
+		writeError(w, "runs with credentials cannot be rerun, clone them instead", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := effectiveSettings(r.Context(), clientset)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	rerun := newRerunJob(job)
+	if err := admitRerun(r.Context(), clientset, settings, job, rerun); err != nil {
+		writeError(w, err.Error(), runErrorStatus(err))
+		return
+	}
+	if videoPreviewImage() != "" && settings.feature(featureVideoPreviews) {
+		addVideoPreviews(rerun)
+	}
+	if len(settings.hooksAt(hookPostComplete)) > 0 {
+		addCompletionHooks(rerun)
+	}
+	if mergesShardReports(rerun) {
+		addReportMerge(rerun)
+	}
+
+	created, err := clientset.BatchV1().Jobs(namespace).Create(r.Context(), rerun, metav1.CreateOptions{})
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	supersede(r.Context(), clientset, created)
+
+	respondJSONStatus(w, http.StatusCreated, created)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIsRun(t *testing.T) {
+	for _, tc := range []struct {
+		labels map[string]string
+		want   bool
+	}{
+		{map[string]string{suiteLabel: "checkout"}, true},
+		{nil, true},
+		{map[string]string{monitorLabel: "true"}, false},
+		{map[string]string{warmLabel: "true"}, false},
+		{map[string]string{mergeRunLabel: "run-1"}, false},
+	} {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Labels: tc.labels}}
+		if got := isRun(job); got != tc.want {
+			t.Errorf("isRun(%v) = %v, want %v", tc.labels, got, tc.want)
+		}
+	}
+}
+
+func TestRerunSpec(t *testing.T) {
+	completions := int32(3)
+	indexed := batchv1.IndexedCompletion
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "checkout-1",
+			Namespace: "tests",
+			Labels:    map[string]string{suiteLabel: "checkout", branchLabel: "main"},
+		},
+		Spec: batchv1.JobSpec{
+			Completions:    &completions,
+			CompletionMode: &indexed,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					ServiceAccountName: "e2e",
+					ImagePullSecrets:   []corev1.LocalObjectReference{{Name: "registry"}},
+					Containers: []corev1.Container{{
+						Name:    "playwright",
+						Image:   "mcr.microsoft.com/playwright:v1.50.0",
+						Command: []string{"npx", "playwright", "test"},
+						Env: []corev1.EnvVar{
+							{Name: "BASE_URL", Value: "https://shop.example.com"},
+							{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{Key: "token"}}},
+						},
+					}},
+				},
+			},
+		},
+	}
+	rerun := newRerunJob(job)
+
+	spec := rerunSpec(job, rerun)
+	if spec.Namespace != "tests" || spec.Suite != "checkout" || spec.Branch != "main" || spec.Shards != 3 {
+		t.Errorf("spec of the Job = %+v", spec)
+	}
+	if spec.Image != "mcr.microsoft.com/playwright:v1.50.0" || spec.ServiceAccountName != "e2e" || len(spec.ImagePullSecrets) != 1 {
+		t.Errorf("pod of the spec = %+v", spec)
+	}
+	if _, ok := spec.Env["TOKEN"]; ok || spec.Env["BASE_URL"] != "https://shop.example.com" {
+		t.Errorf("env of the spec = %v, want only the values", spec.Env)
+	}
+	if spec.Labels[suiteLabel] != "checkout" {
+		t.Errorf("labels of the spec = %v, want those of the rerun", spec.Labels)
+	}
+
+	job.Annotations = map[string]string{runSpecAnnotation: `{"name":"checkout","suite":"checkout","shards":2,"labels":{"team":"web"}}`}
+	rerun = newRerunJob(job)
+	spec = rerunSpec(job, rerun)
+	if spec.Shards != 2 || spec.Namespace != "tests" {
+		t.Errorf("stored spec = %+v", spec)
+	}
+	if spec.Labels["team"] != "" || spec.Labels[suiteLabel] != "checkout" {
+		t.Errorf("labels of the stored spec = %v, want those of the rerun", spec.Labels)
+	}
+}
+
+func TestNewRerunJobCopiesRunAnnotations(t *testing.T) {
+	ttl := "3600"
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Name:      "checkout-1",
+		Namespace: "tests",
+		Annotations: map[string]string{
+			runSpecAnnotation:                  `{"suite":"checkout"}`,
+			mergeGroupAnnotation:               "refs/heads/gh-readonly-queue/main/pr-1",
+			budgetMaxDurationAnnotation:        "10m",
+			deviceAnnotation:                   "iPhone 14",
+			notifyAnnotation:                   "slack",
+			pinnedAnnotation:                   "true",
+			pinnedTTLAnnotation:                ttl,
+			signOffAnnotation:                  "{}",
+			costAnnotation:                     "0.12",
+			reportPodsAnnotation:               "checkout-1-abc",
+			"batch.kubernetes.io/job-tracking": "",
+			"team.example.com/owner":           "web",
+		},
+	}}
+
+	rerun := newRerunJob(job)
+	for _, key := range []string{runSpecAnnotation, mergeGroupAnnotation, budgetMaxDurationAnnotation, deviceAnnotation, notifyAnnotation, "team.example.com/owner"} {
+		if rerun.Annotations[key] != job.Annotations[key] {
+			t.Errorf("annotation %s = %q, want it copied", key, rerun.Annotations[key])
+		}
+	}
+	for _, key := range []string{pinnedAnnotation, pinnedTTLAnnotation, signOffAnnotation, costAnnotation, reportPodsAnnotation, "batch.kubernetes.io/job-tracking"} {
+		if _, ok := rerun.Annotations[key]; ok {
+			t.Errorf("annotation %s is copied, want it dropped", key)
+		}
+	}
+	if rerun.Annotations[rerunOfAnnotation] != "checkout-1" {
+		t.Errorf("rerun of = %q", rerun.Annotations[rerunOfAnnotation])
+	}
+	if got := rerun.Spec.TTLSecondsAfterFinished; got == nil || *got != 3600 {
+		t.Errorf("TTL of the rerun of a pinned run = %v, want the one set aside", got)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// resultsDir is where the API finds the results volume, see manifest/operator.yaml.
+var resultsDir = resultsMountPath
+
+// ansiEscapes match the terminal colors of error messages.
+var ansiEscapes = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// jsonReport is the part of the output of the Playwright JSON reporter the results are
+// read from. Suites nest by file and describe block.
+type jsonReport struct {
+	Suites []jsonSuite `json:"suites"`
+	Errors []jsonError `json:"errors"`
+	Stats  jsonStats   `json:"stats"`
+}
+
+type jsonStats struct {
+	Expected   int32 `json:"expected"`
+	Unexpected int32 `json:"unexpected"`
+	Flaky      int32 `json:"flaky"`
+	Skipped    int32 `json:"skipped"`
+}
+
+type jsonSuite struct {
+	Title  string      `json:"title"`
+	Specs  []jsonSpec  `json:"specs"`
+	Suites []jsonSuite `json:"suites"`
+}
+
+type jsonSpec struct {
+	Title string     `json:"title"`
+	File  string     `json:"file"`
+	Line  int        `json:"line"`
+	Tags  []string   `json:"tags"`
+	Tests []jsonTest `json:"tests"`
+}
+
+type jsonTest struct {
+	ProjectName string           `json:"projectName"`
+	Status      string           `json:"status"`
+	Annotations []TestAnnotation `json:"annotations"`
+	Results     []jsonTestResult `json:"results"`
+}
+
+// TestAnnotation is an annotation of a test, like {type: "issue", description: "..."}.
+type TestAnnotation struct {
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+}
+
+type jsonTestResult struct {
+	Duration int64       `json:"duration"`
+	Errors   []jsonError `json:"errors"`
+}
+
+type jsonError struct {
+	Message string `json:"message"`
+}
+
+// SpecResult is the outcome of a test in one project. Duration sums up all attempts, the
+// errors are those of the last failed attempt, which tell why flaky tests were retried.
+type SpecResult struct {
+	File        string           `json:"file"`
+	Line        int              `json:"line"`
+	Title       string           `json:"title"`
+	Project     string           `json:"project,omitempty"`
+	Shard       *int             `json:"shard,omitempty"`
+	Status      string           `json:"status"`
+	DurationMs  int64            `json:"durationMs"`
+	Retries     int              `json:"retries"`
+	Errors      []string         `json:"errors,omitempty"`
+	Tags        []string         `json:"tags,omitempty"`
+	Annotations []TestAnnotation `json:"annotations,omitempty"`
+}
+
+// RunResults are the parsed JSON reports of a run. MissingShards lists the shards that
+// did not write a report yet.
+type RunResults struct {
+	RunRef
+	Counts        TestCounts   `json:"counts"`
+	Errors        []string     `json:"errors,omitempty"`
+	MissingShards []int        `json:"missingShards,omitempty"`
+	Specs         []SpecResult `json:"specs"`
+}
+
+// annotationValues returns the values of the annotations of a type of a test, which may
+// list several separated by commas or spaces, like {type: "requirement", description:
+// "REQ-1, REQ-2"}.
+func annotationValues(spec SpecResult, annotationType string) []string {
+	var values []string
+	for _, a := range spec.Annotations {
+		if a.Type == annotationType {
+			values = append(values, strings.FieldsFunc(a.Description, func(r rune) bool { return r == ',' || r == ' ' })...)
+		}
+	}
+
+	return values
+}
+
+// specStatus names the outcomes of the JSON reporter like the test counts do.
+var specStatus = map[string]string{
+	"expected":   "passed",
+	"unexpected": "failed",
+	"flaky":      "flaky",
+	"skipped":    "skipped",
+}
+
+func errorMessages(errs []jsonError) []string {
+	var messages []string
+	for _, e := range errs {
+		messages = append(messages, ansiEscapes.ReplaceAllString(e.Message, ""))
+	}
+
+	return messages
+}
+
+// appendSpecResults flattens the specs of a suite and its nested suites, titles are
+// joined with the describe blocks they are in.
+func appendSpecResults(specs []SpecResult, suite jsonSuite, titles []string, shard *int) []SpecResult {
+	for _, spec := range suite.Specs {
+		title := strings.Join(append(titles, spec.Title), " › ")
+		for _, test := range spec.Tests {
+			result := SpecResult{
+				File:    spec.File,
+				Line:    spec.Line,
+				Title:   title,
+				Project: test.ProjectName,
+				Shard:   shard,
+				Status:  specStatus[test.Status],
+
+				Tags:        spec.Tags,
+				Annotations: test.Annotations,
+			}
+			if result.Status == "" {
+				result.Status = test.Status
+			}
+			for _, attempt := range test.Results {
+				result.DurationMs += attempt.Duration
+				if len(attempt.Errors) > 0 {
+					result.Errors = errorMessages(attempt.Errors)
+				}
+			}
+			if len(test.Results) > 1 {
+				result.Retries = len(test.Results) - 1
+			}
+			specs = append(specs, result)
+		}
+	}
+	for _, nested := range suite.Suites {
+		specs = appendSpecResults(specs, nested, append(titles[:len(titles):len(titles)], nested.Title), shard)
+	}
+
+	return specs
+}
+
+// readJSONReport reads a JSON report, gzipped ones by their .gz extension, see
+// archiveRawReports.
+func readJSONReport(path string) (*jsonReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("decompressing %s: %w", filepath.Base(path), err)
+		}
+		r = gz
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var report jsonReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", filepath.Base(path), err)
+	}
+
+	return &report, nil
+}
+
+// runResults reads the JSON reports the run script writes to the checkpoint of a Job,
+// one per shard of sharded runs. It returns nil if no report exists.
+func runResults(job *batchv1.Job) (*RunResults, error) {
+	dir := filepath.Join(resultsDir, "checkpoints", string(job.UID))
+	shards := 0
+	if job.Spec.CompletionMode != nil && *job.Spec.CompletionMode == batchv1.IndexedCompletion && job.Spec.Completions != nil {
+		shards = int(*job.Spec.Completions)
+	}
+
+	results := &RunResults{
+		RunRef: RunRef{Namespace: job.Namespace, Name: job.Name, UID: string(job.UID)},
+		Specs:  []SpecResult{},
+	}
+	found := false
+	for i := 0; i < max(shards, 1); i++ {
+		var shard *int
+		path := filepath.Join(dir, "results.json")
+		if shards > 0 {
+			shard = &i
+			path = filepath.Join(dir, fmt.Sprintf("shard-%d", i), "results.json")
+		}
+
+		report, err := readJSONReport(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			// the archived report outlives the checkpoint
+			report, err = readJSONReport(filepath.Join(rawReportDir(job.UID, shard), "results.json.gz"))
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			if shard != nil {
+				results.MissingShards = append(results.MissingShards, i)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+
+		results.Counts.Passed += report.Stats.Expected
+		results.Counts.Failed += report.Stats.Unexpected
+		results.Counts.Flaky += report.Stats.Flaky
+		results.Counts.Skipped += report.Stats.Skipped
+		results.Errors = append(results.Errors, errorMessages(report.Errors)...)
+		for _, suite := range report.Suites {
+			// the suites of the top level are the test files, their title is the file name
+			results.Specs = appendSpecResults(results.Specs, suite, nil, shard)
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+
+	return results, nil
+}
+
+// GET /results?namespace=ns&job=id returns the parsed JSON report of a run, by Job UID or
+// name, with the status, duration, retries and errors of every test.
+func getResults(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	id := r.URL.Query().Get("job")
+	if id == "" {
+		writeError(w, "job parameter required", http.StatusBadRequest)
+		return
+	}
+
+	job, err := findRun(r.Context(), clientset, getNamespace(r.URL.Query().Get("namespace")), id)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if job == nil {
+		writeError(w, "run not found", http.StatusNotFound)
+		return
+	}
+
+	results, err := runResults(job)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if results == nil {
+		writeError(w, "the run has no results yet", http.StatusNotFound)
+		return
+	}
+
+	respondJSON(w, results)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ResultsResync is the progress of uploading the reports stored on the results volume to
+// the results store, to move to a newly configured store without losing the reports of
+// earlier runs. Runs that are still running or whose artifacts are quarantined are
+// Skipped, Failures names the runs that could not be uploaded.
+type ResultsResync struct {
+	Running  bool      `json:"running"`
+	Total    int       `json:"total"`
+	Synced   int       `json:"synced"`
+	Skipped  int       `json:"skipped"`
+	Failed   int       `json:"failed"`
+	Files    int       `json:"files"`
+	Failures []string  `json:"failures,omitempty"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// maxResyncFailures bounds the failures reported in the progress, the log has all.
+const maxResyncFailures = 20
+
+var (
+	resultsResyncMu sync.Mutex
+	// resultsResync is the latest re-sync, nil before the first.
+	resultsResync *ResultsResync
+)
+
+func updateResultsResync(update func(*ResultsResync)) {
+	resultsResyncMu.Lock()
+	defer resultsResyncMu.Unlock()
+	update(resultsResync)
+}
+
+// resyncSkipped reports why the reports of a run stay off the store, if they do.
+func resyncSkipped(run storedRun) (string, error) {
+	if run.job != nil {
+		if _, ok := finishedAt(run.job); !ok {
+			return "running", nil
+		}
+	} else if run.protected {
+		// an orphan written in the grace period may be a run that just started
+		return "running", nil
+	}
+
+	scan, err := readArtifactScan(types.UID(run.uid))
+	if err != nil {
+		return "", err
+	}
+	if scan != nil && scan.Status == scanQuarantined {
+		return "quarantined", nil
+	}
+
+	return "", nil
+}
+
+// resyncResults uploads the reports of every stored run to the store and labels the Jobs
+// still there with resultsUploadedLabel.
+func resyncResults(ctx context.Context, clientset *kubernetes.Clientset, store *resultsStore, namespace string) error {
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{LabelSelector: runsSelector})
+	if err != nil {
+		return err
+	}
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: batchv1.ControllerUidLabel})
+	if err != nil {
+		return err
+	}
+	runs, err := storedRuns(jobs.Items, pods.Items, time.Now())
+	if err != nil {
+		return err
+	}
+	updateResultsResync(func(p *ResultsResync) { p.Total = len(runs) })
+
+	for _, run := range runs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		reason, err := resyncSkipped(run)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			updateResultsResync(func(p *ResultsResync) { p.Skipped++ })
+			continue
+		}
+
+		uploaded, err := store.uploadRun(ctx, types.UID(run.uid), run.podUIDs)
+		if err != nil {
+			log.Printf("cannot re-sync the reports of run %s: %v", run.uid, err)
+			updateResultsResync(func(p *ResultsResync) {
+				p.Failed++
+				p.Files += uploaded
+				if len(p.Failures) < maxResyncFailures {
+					p.Failures = append(p.Failures, fmt.Sprintf("%s: %v", run.uid, err))
+				}
+			})
+			continue
+		}
+		updateResultsResync(func(p *ResultsResync) {
+			p.Synced++
+			p.Files += uploaded
+		})
+
+		if run.job != nil && run.job.Labels[resultsUploadedLabel] == "" {
+			patch, _ := json.Marshal(map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": map[string]interface{}{resultsUploadedLabel: "true"},
+				},
+			})
+			if _, err := clientset.BatchV1().Jobs(run.job.Namespace).Patch(ctx, run.job.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+				log.Printf("cannot label run %s/%s: %v", run.job.Namespace, run.job.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// POST /admin/results/resync uploads the reports of every run on the results volume to the
+// results store in the background, finished runs whose artifacts are not quarantined.
+// GET /admin/results/resync reports the progress of the latest.
+func startResultsResync(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset, store *resultsStore) {
+	if store == nil {
+		writeError(w, "no results store is configured, see RESULTS_STORE", http.StatusConflict)
+		return
+	}
+
+	resultsResyncMu.Lock()
+	if resultsResync != nil && resultsResync.Running {
+		resultsResyncMu.Unlock()
+		writeError(w, "a re-sync of the results is running", http.StatusConflict)
+		return
+	}
+	resultsResync = &ResultsResync{Running: true, Started: time.Now().UTC()}
+	progress := *resultsResync
+	resultsResyncMu.Unlock()
+
+	// the re-sync outlives the request
+	ctx := context.WithoutCancel(r.Context())
+	go func() {
+		err := resyncResults(ctx, clientset, store, getNamespace(""))
+		if err != nil {
+			log.Printf("cannot re-sync the results to %s: %v", store.Provider, err)
+		}
+		updateResultsResync(func(p *ResultsResync) {
+			p.Running = false
+			p.Finished = time.Now().UTC()
+			if err != nil {
+				p.Error = err.Error()
+			}
+		})
+	}()
+
+	respondJSONStatus(w, http.StatusAccepted, progress)
+}
+
+func getResultsResync(w http.ResponseWriter, r *http.Request) {
+	resultsResyncMu.Lock()
+	defer resultsResyncMu.Unlock()
+	if resultsResync == nil {
+		writeError(w, "the results were not re-synced yet", http.StatusNotFound)
+		return
+	}
+
+	respondJSON(w, *resultsResync)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestUploadRunUploadsPodReports(t *testing.T) {
+	dir := useResultsDir(t)
+	store, objects := fakeStore(t)
+	now := time.Now()
+	writeStoredFile(t, filepath.Join(dir, runningPodUID, "index.html"), now)
+	writeStoredFile(t, filepath.Join(dir, runningJobUID, "raw", "results.json.gz"), now)
+
+	uploaded, err := store.uploadRun(context.Background(), runningJobUID, []types.UID{runningPodUID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploaded != 2 {
+		t.Errorf("uploaded %d files, want the report of the pod and the raw report of the run", uploaded)
+	}
+	for _, key := range []string{"/results/" + runningPodUID + "/index.html", "/results/" + runningJobUID + "/raw/results.json.gz"} {
+		if _, ok := objects[key]; !ok {
+			t.Errorf("%s is missing: %v", key, objects)
+		}
+	}
+}
+
+func TestResyncSkipped(t *testing.T) {
+	useResultsDir(t)
+	completed := metav1.NewTime(time.Now())
+	finished := &batchv1.Job{Status: batchv1.JobStatus{CompletionTime: &completed}}
+	if err := writeArtifactScan(pinnedJobUID, &ArtifactScan{Status: scanQuarantined}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		run  storedRun
+		want string
+	}{
+		{"finished", storedRun{uid: runningJobUID, job: finished}, ""},
+		{"running", storedRun{uid: runningJobUID, job: &batchv1.Job{}}, "running"},
+		{"fresh orphan", storedRun{uid: orphanUID, protected: true}, "running"},
+		{"orphan", storedRun{uid: orphanUID}, ""},
+		{"quarantined", storedRun{uid: pinnedJobUID, job: finished}, "quarantined"},
+	} {
+		got, err := resyncSkipped(tt.run)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: skipped = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
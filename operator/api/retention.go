@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ArtifactRetention prunes the videos and traces of passing tests once a run finished,
+// keeping those of failed and flaky tests and of a random sample of the passing ones. It
+// is part of the policy of a suite and applies to runs with the default command.
+type ArtifactRetention struct {
+	PassingSamplePercent int `json:"passingSamplePercent"`
+}
+
+func (r *ArtifactRetention) validate() error {
+	if r.PassingSamplePercent < 0 || r.PassingSamplePercent > 100 {
+		return fmt.Errorf("passingSamplePercent must be between 0 and 100")
+	}
+
+	return nil
+}
+
+// pruneArtifactsScript deletes the attachments of passing tests listed in the JSON report
+// from the test output and from the HTML report, which keeps its copies named by their
+// SHA-1 in data/.
+const pruneArtifactsScript = `const fs = require("fs"), path = require("path"), crypto = require("crypto");
+const keep = Number(process.env.PLAYWRIGHT_KEEP_PASSING_PERCENT);
+const walk = (suite, tests) => {
+  for (const s of suite.suites || []) walk(s, tests);
+  for (const spec of suite.specs || []) tests.push(...spec.tests);
+  return tests;
+};
+let pruned = 0;
+for (const test of walk(JSON.parse(fs.readFileSync(process.argv[1])), [])) {
+  if (test.status !== "expected" || Math.random() * 100 < keep) continue;
+  for (const result of test.results) {
+    for (const a of result.attachments || []) {
+      if (!a.path || (a.name !== "video" && a.name !== "trace")) continue;
+      try {
+        const sha1 = crypto.createHash("sha1").update(fs.readFileSync(a.path)).digest("hex");
+        fs.rmSync(path.join(process.env.PLAYWRIGHT_HTML_OUTPUT_DIR, "data", sha1 + path.extname(a.path)), {force: true});
+        fs.rmSync(a.path, {force: true});
+        pruned++;
+      } catch (e) {}
+    }
+  }
+}
+console.log("pruned " + pruned + " videos and traces of passing tests");`
+
+// addArtifactRetention has the run script prune the artifacts of the run, see
+// resumableRunScript.
+func addArtifactRetention(job *batchv1.Job, r *ArtifactRetention) {
+	c := &job.Spec.Template.Spec.Containers[0]
+	c.Env = append(c.Env,
+		corev1.EnvVar{Name: "PLAYWRIGHT_KEEP_PASSING_PERCENT", Value: strconv.Itoa(r.PassingSamplePercent)},
+		corev1.EnvVar{Name: "PLAYWRIGHT_PRUNE_SCRIPT", Value: pruneArtifactsScript},
+	)
+}
@@ -0,0 +1,564 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// runContainer is the container of a run that runs the tests, next to e.g. the
+	// preview and proxy sidecars.
+	runContainer      = "playwright"
+	resultsVolumeName = "playwright-results"
+	resultsMountPath  = "/playwright-results"
+	resultsClaimName  = "playwright-results"
+	maxShards         = 50
+)
+
+// RunSpec describes a Playwright run that the operator turns into a batch Job.
+type RunSpec struct {
+	Name         string   `json:"name,omitempty"`
+	GenerateName string   `json:"generateName,omitempty"`
+	Namespace    string   `json:"namespace,omitempty"`
+	Image        string   `json:"image"`
+	Command      []string `json:"command,omitempty"`
+	Browser      string   `json:"browser,omitempty"`
+
+	// OS and Arch select the node pool of the run, linux or windows and amd64 or arm64.
+	// Either defaults to linux/amd64 when only the other is given.
+	OS   string `json:"os,omitempty"`
+	Arch string `json:"arch,omitempty"`
+
+	// Devices, Locales and Timezones fan the run out into one run per combination, see
+	// matrixRuns. Device, Locale and Timezone are those of one of them. The locale is set
+	// as LANG and PLAYWRIGHT_LOCALE, the timezone as TZ and PLAYWRIGHT_TIMEZONE.
+	Devices   []string `json:"devices,omitempty"`
+	Locales   []string `json:"locales,omitempty"`
+	Timezones []string `json:"timezones,omitempty"`
+	Device    string   `json:"device,omitempty"`
+	Locale    string   `json:"locale,omitempty"`
+	Timezone  string   `json:"timezone,omitempty"`
+	// matrix is the matrixLabel of the runs of a matrix, it is not kept for clones.
+	matrix string
+
+	// Grep selects tests by title, it is passed to the default command only.
+	Grep string `json:"grep,omitempty"`
+	// BaseURL is set as BASE_URL for the Playwright configuration of the suite to read.
+	BaseURL string `json:"baseURL,omitempty"`
+
+	// Suite and Branch are stored as labels, see suiteLabel and branchLabel.
+	Suite  string `json:"suite,omitempty"`
+	Branch string `json:"branch,omitempty"`
+
+	// MergeGroup identifies the merge queue group the run tests, see mergeGroupLabel.
+	MergeGroup string `json:"mergeGroup,omitempty"`
+
+	Env    map[string]string `json:"env,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Shards splits the tests across as many pods of an indexed Job. The default command
+	// passes --shard itself and gets the reports of the shards merged, other commands read
+	// JOB_COMPLETION_INDEX and PLAYWRIGHT_SHARD_TOTAL.
+	Shards int `json:"shards,omitempty"`
+
+	// TTLSecondsAfterFinished lets the TTL controller delete the Job, pinned runs are kept.
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+
+	// ImagePullSecrets default to those of the namespace, see imagePullSecretsAnnotation,
+	// and to DEFAULT_IMAGE_PULL_SECRETS when empty.
+	ImagePullSecrets []string `json:"imagePullSecrets,omitempty"`
+	// namespacePullSecrets are those of imagePullSecretsAnnotation, looked up by the callers
+	// of newRunJob. They are not kept for clones.
+	namespacePullSecrets []string
+
+	// ServiceAccountName defaults to RUN_SERVICE_ACCOUNT. Binding that account to a cloud
+	// identity (EKS IRSA, GKE Workload Identity) lets the pods upload artifacts without
+	// long-lived access keys.
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	Credentials *RunCredentials `json:"credentials,omitempty"`
+	Budget      *RunBudget      `json:"budget,omitempty"`
+	Chaos       *RunChaos       `json:"chaos,omitempty"`
+	GPU         *RunGPU         `json:"gpu,omitempty"`
+	Soak        *RunSoak        `json:"soak,omitempty"`
+}
+
+// newRunJob builds the Job for a run. The report is written to the shared
+// results volume below the pod UID, which is where the dashboard serves it from.
+func newRunJob(spec RunSpec) (*batchv1.Job, error) {
+	if spec.Image == "" {
+		return nil, fmt.Errorf("image is required")
+	}
+	if spec.Shards < 0 || spec.Shards > maxShards {
+		return nil, fmt.Errorf("shards must be between 0 and %d, 0 runs unsharded", maxShards)
+	}
+	if ttl := spec.TTLSecondsAfterFinished; ttl != nil && *ttl < 0 {
+		return nil, fmt.Errorf("ttlSecondsAfterFinished must not be negative")
+	}
+	if err := validatePlatform(spec); err != nil {
+		return nil, err
+	}
+	platformOS, arch := spec.platform()
+	if spec.isMatrix() {
+		return nil, fmt.Errorf("runs with devices, locales or timezones are created by createMatrix")
+	}
+	if err := validateLocale(spec.Locale, spec.Timezone); err != nil {
+		return nil, err
+	}
+	if err := validateLabels(spec.Labels); err != nil {
+		return nil, err
+	}
+
+	command := spec.Command
+	if len(command) == 0 {
+		command = []string{"sh", "-c", resumableRunScript}
+		if spec.Grep != "" {
+			command = append(command, "sh", "--grep", spec.Grep)
+		}
+	} else if spec.Grep != "" {
+		return nil, fmt.Errorf("grep needs the default command")
+	}
+
+	container := corev1.Container{
+		Name:    runContainer,
+		Image:   spec.Image,
+		Command: command,
+		Env: []corev1.EnvVar{
+			{
+				Name: "K8S_UID",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.uid"},
+				},
+			},
+			{Name: "PLAYWRIGHT_HTML_OPEN", Value: "never"},
+			{Name: "PLAYWRIGHT_HTML_OUTPUT_DIR", Value: resultsMountPath + "/$(K8S_UID)/"},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: resultsVolumeName, MountPath: resultsMountPath},
+		},
+	}
+
+	container.Env = append(container.Env, checkpointEnv()...)
+	if spec.Shards > 1 {
+		container.Env = append(container.Env, corev1.EnvVar{Name: "PLAYWRIGHT_SHARD_TOTAL", Value: strconv.Itoa(spec.Shards)})
+	}
+
+	env := spec.environment()
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		container.Env = append(container.Env, corev1.EnvVar{Name: name, Value: env[name]})
+	}
+
+	labels := copyLabels(spec.Labels)
+	if spec.Suite != "" || spec.Branch != "" || spec.MergeGroup != "" || platformOS != "" || spec.matrix != "" {
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		if spec.Suite != "" {
+			labels[suiteLabel] = spec.Suite
+		}
+		if spec.Branch != "" {
+			labels[branchLabel] = spec.Branch
+		}
+		if spec.MergeGroup != "" {
+			labels[mergeGroupLabel] = mergeGroupLabelValue(spec.MergeGroup)
+		}
+		if platformOS != "" {
+			labels[platformLabel] = platformOS + "-" + arch
+		}
+		if spec.matrix != "" {
+			labels[matrixLabel] = spec.matrix
+		}
+	}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      spec.Name,
+			Namespace: spec.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            ptr.To[int32](0),
+			PodFailurePolicy:        disruptionPolicy(),
+			TTLSecondsAfterFinished: spec.TTLSecondsAfterFinished,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: copyLabels(labels),
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers:    []corev1.Container{container},
+					Volumes: []corev1.Volume{
+						{
+							Name: resultsVolumeName,
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: resultsClaimName,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if spec.Shards > 1 {
+		job.Spec.CompletionMode = ptr.To(batchv1.IndexedCompletion)
+		job.Spec.Completions = ptr.To(int32(spec.Shards))
+		job.Spec.Parallelism = ptr.To(int32(spec.Shards))
+	}
+	if mergesShardReports(job) {
+		addReportMerge(job)
+	}
+
+	if job.Name == "" {
+		job.GenerateName = spec.GenerateName
+		if job.GenerateName == "" {
+			job.GenerateName = "playwright-run-"
+		}
+	}
+
+	job.Spec.Template.Spec.ServiceAccountName = spec.ServiceAccountName
+	if job.Spec.Template.Spec.ServiceAccountName == "" {
+		job.Spec.Template.Spec.ServiceAccountName = os.Getenv("RUN_SERVICE_ACCOUNT")
+	}
+
+	pullSecrets := spec.ImagePullSecrets
+	if len(pullSecrets) == 0 {
+		pullSecrets = spec.namespacePullSecrets
+	}
+	if len(pullSecrets) == 0 {
+		pullSecrets = defaultImagePullSecrets()
+	}
+	for _, name := range pullSecrets {
+		job.Spec.Template.Spec.ImagePullSecrets = append(job.Spec.Template.Spec.ImagePullSecrets,
+			corev1.LocalObjectReference{Name: name})
+	}
+
+	// runs of a suite report their browser versions for the check against its matrix,
+	// the probe is a shell script and Windows pods reject the Linux sandbox settings
+	if platformOS != windowsOS {
+		if spec.Suite != "" {
+			job.Spec.Template.Spec.InitContainers = append(job.Spec.Template.Spec.InitContainers, browserProbe(spec.Image))
+		}
+		if err := applyBrowserSandbox(&job.Spec.Template.Spec, spec.Browser); err != nil {
+			return nil, err
+		}
+	} else if _, ok := browserSandboxes[spec.Browser]; !ok && spec.Browser != "" {
+		return nil, fmt.Errorf("unsupported browser %q", spec.Browser)
+	}
+
+	if platformOS != "" {
+		addPlatform(&job.Spec.Template.Spec, platformOS, arch)
+	}
+
+	if spec.GPU != nil {
+		if err := spec.GPU.validate(); err != nil {
+			return nil, err
+		}
+		addGPU(&job.Spec.Template.Spec, spec.GPU)
+	}
+
+	if spec.Credentials != nil {
+		if err := addRunCredentials(job, spec.Credentials); err != nil {
+			return nil, err
+		}
+	}
+
+	if spec.Budget != nil {
+		if err := spec.Budget.validate(); err != nil {
+			return nil, err
+		}
+		job.Annotations = spec.Budget.annotations()
+	}
+
+	if spec.Chaos != nil {
+		if err := spec.Chaos.validate(); err != nil {
+			return nil, err
+		}
+		addChaos(job, spec.Chaos)
+	}
+
+	if spec.Soak != nil {
+		if err := spec.Soak.validate(); err != nil {
+			return nil, err
+		}
+		addSoak(job, spec.Soak)
+	}
+
+	if job.Annotations == nil {
+		job.Annotations = map[string]string{}
+	}
+	if spec.MergeGroup != "" {
+		job.Annotations[mergeGroupAnnotation] = spec.MergeGroup
+	}
+	if spec.Device != "" {
+		job.Annotations[deviceAnnotation] = spec.Device
+	}
+	if spec.Locale != "" {
+		job.Annotations[localeAnnotation] = spec.Locale
+	}
+	if spec.Timezone != "" {
+		job.Annotations[timezoneAnnotation] = spec.Timezone
+	}
+
+	// the spec is kept for cloning the run, without the name a copy cannot reuse
+	stored := spec
+	stored.Name = ""
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return nil, err
+	}
+	job.Annotations[runSpecAnnotation] = string(data)
+
+	return job, nil
+}
+
+// environment returns the variables of the run, including those of its parameters.
+func (spec RunSpec) environment() map[string]string {
+	if spec.BaseURL == "" && spec.Device == "" && spec.Locale == "" && spec.Timezone == "" {
+		return spec.Env
+	}
+
+	env := copyLabels(spec.Env)
+	if env == nil {
+		env = map[string]string{}
+	}
+	if spec.BaseURL != "" {
+		env["BASE_URL"] = spec.BaseURL
+	}
+	if spec.Device != "" {
+		env["PLAYWRIGHT_DEVICE"] = spec.Device
+	}
+	if spec.Locale != "" {
+		env["LANG"] = posixLocale(spec.Locale)
+		env["PLAYWRIGHT_LOCALE"] = spec.Locale
+	}
+	if spec.Timezone != "" {
+		env["TZ"] = spec.Timezone
+		env["PLAYWRIGHT_TIMEZONE"] = spec.Timezone
+	}
+
+	return env
+}
+
+// admitNewRun checks a new run against the run limit, passes it through the pre-schedule
+// hooks, adds the labels of the policy of its suite and checks it against the cost labels
+// and the admission rules. It returns the spec to create.
+func admitNewRun(ctx context.Context, clientset *kubernetes.Clientset, settings Settings, spec RunSpec) (RunSpec, SuitePolicy, error) {
+	var policy SuitePolicy
+	if err := checkRunLimit(ctx, clientset, spec.Namespace, settings.MaxRunningRuns, 1); err != nil {
+		return spec, policy, err
+	}
+	spec, err := preScheduleHooks(ctx, settings, spec)
+	if err != nil {
+		return spec, policy, err
+	}
+	if spec.Suite != "" {
+		_, policies, err := loadSuitePolicies(ctx, clientset, spec.Namespace)
+		if err != nil {
+			return spec, policy, err
+		}
+		policy = suitePolicy(policies, spec.Suite)
+		spec.Labels = withSuiteLabels(spec.Labels, policy)
+	}
+	if err := checkCostLabels(settings, spec); err != nil {
+		return spec, policy, err
+	}
+	if err := admitRun(ctx, clientset, settings, spec); err != nil {
+		return spec, policy, err
+	}
+
+	return spec, policy, nil
+}
+
+// createRun validates a run, creates its Job and sets up the resources the Job depends on.
+func createRun(ctx context.Context, clientset *kubernetes.Clientset, spec RunSpec) (*batchv1.Job, error) {
+	return createPreparedRun(ctx, clientset, spec, nil)
+}
+
+// createPreparedRun is createRun with prepare changing the Job before it is created, e.g.
+// to mount files or set an owner. Such runs are not served from the warm pool, as its
+// Jobs exist already.
+func createPreparedRun(ctx context.Context, clientset *kubernetes.Clientset, spec RunSpec, prepare func(*batchv1.Job) error) (*batchv1.Job, error) {
+	settings, err := effectiveSettings(ctx, clientset)
+	if err != nil {
+		return nil, err
+	}
+	spec, policy, err := admitNewRun(ctx, clientset, settings, spec)
+	if err != nil {
+		return nil, err
+	}
+	if spec.namespacePullSecrets, err = namespaceImagePullSecrets(ctx, clientset, spec.Namespace); err != nil {
+		return nil, err
+	}
+
+	job, err := newRunJob(spec)
+	if err != nil {
+		return nil, err
+	}
+	if policy.Retention != nil && settings.feature(featureArtifactRetention) {
+		addArtifactRetention(job, policy.Retention)
+	}
+	if videoPreviewImage() != "" && settings.feature(featureVideoPreviews) {
+		addVideoPreviews(job)
+	}
+	if len(settings.hooksAt(hookPostComplete)) > 0 {
+		addCompletionHooks(job)
+	}
+
+	if prepare != nil {
+		if err := prepare(job); err != nil {
+			return nil, err
+		}
+	} else {
+		claimed, err := claimWarmRun(ctx, clientset, spec, job)
+		if err != nil {
+			return nil, err
+		}
+		if claimed != nil {
+			supersede(ctx, clientset, claimed)
+			return claimed, nil
+		}
+	}
+
+	var pullSecrets []string
+	for _, ref := range job.Spec.Template.Spec.ImagePullSecrets {
+		pullSecrets = append(pullSecrets, ref.Name)
+	}
+	if err := validateImagePull(ctx, clientset, spec.Namespace, spec.Image, pullSecrets); err != nil {
+		return nil, err
+	}
+	if spec.GPU != nil {
+		if err := validateGPU(ctx, clientset, spec.GPU); err != nil {
+			return nil, err
+		}
+	}
+	if platformOS, arch := spec.platform(); platformOS != "" {
+		if err := validateNodePlatform(ctx, clientset, platformOS, arch); err != nil {
+			return nil, err
+		}
+	}
+	// the containers start with the token, the Secret exists before the Job
+	var credentials *corev1.Secret
+	if spec.Credentials != nil {
+		if credentials, err = mintRunCredentials(ctx, clientset, job, spec.Credentials); err != nil {
+			return nil, err
+		}
+	}
+
+	created, err := clientset.BatchV1().Jobs(spec.Namespace).Create(ctx, job, metav1.CreateOptions{})
+	if err != nil {
+		if credentials != nil {
+			revokeRunCredentials(ctx, clientset, credentials)
+		}
+		return nil, err
+	}
+
+	if credentials != nil {
+		// revokeFinishedCredentials removes Secrets no Job took over
+		if err := ownRunCredentials(ctx, clientset, created, credentials); err != nil {
+			log.Printf("cannot hand the credentials of run %s/%s over to it: %v", created.Namespace, created.Name, err)
+		}
+	}
+
+	supersede(ctx, clientset, created)
+
+	return created, nil
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+
+	return copied
+}
+
+// POST /jobs with a RunSpec, e.g. {"namespace": "ns", "image": "...", "browser":
+// "firefox", "shards": 4, "env": {"BASE_URL": "..."}}, starts a run and returns its Job.
+// Runs without ttlSecondsAfterFinished get the one of the settings, new runs are
+// rejected with 429 while the namespace runs maxRunningRuns of the settings, with 400
+// without the costLabels of the settings and with 403 when a pre-schedule hook vetoes
+// them or they violate an admission rule.
+func createJob(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	var spec RunSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		writeError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	spec.Namespace = getNamespace(spec.Namespace)
+
+	settings, err := effectiveSettings(r.Context(), clientset)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if spec.TTLSecondsAfterFinished == nil {
+		spec.TTLSecondsAfterFinished = settings.RunTTLSecondsAfterFinished
+	}
+
+	if spec.isMatrix() {
+		createJobMatrix(w, r, clientset, spec, settings)
+		return
+	}
+
+	// building the Job first tells invalid specs apart from failures to create it
+	if _, err := newRunJob(spec); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created, err := createRun(r.Context(), clientset, spec)
+	if err != nil {
+		writeError(w, err.Error(), runErrorStatus(err))
+		return
+	}
+
+	respondJSONStatus(w, http.StatusCreated, created)
+}
+
+// createJobMatrix creates the runs of a matrix spec and answers with all of them.
+func createJobMatrix(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset, spec RunSpec, settings Settings) {
+	runs, err := matrixRuns(spec)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// all runs of the matrix start or none, createRun checks each again
+	if err := checkRunLimit(r.Context(), clientset, spec.Namespace, settings.MaxRunningRuns, len(runs)); err != nil {
+		writeError(w, err.Error(), runErrorStatus(err))
+		return
+	}
+
+	created, err := createMatrix(r.Context(), clientset, runs)
+	if err != nil {
+		writeError(w, err.Error(), runErrorStatus(err))
+		return
+	}
+
+	respondJSONStatus(w, http.StatusCreated, JobListResponse{Items: created})
+}
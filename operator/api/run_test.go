@@ -0,0 +1,20 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRunShardsBounds(t *testing.T) {
+	for _, shards := range []int{0, 1, maxShards} {
+		if _, err := newRunJob(RunSpec{Namespace: "tests", Image: "mcr.microsoft.com/playwright:v1.50.0", Shards: shards}); err != nil {
+			t.Errorf("shards %d: %v", shards, err)
+		}
+	}
+	for _, shards := range []int{-1, maxShards + 1} {
+		_, err := newRunJob(RunSpec{Namespace: "tests", Image: "mcr.microsoft.com/playwright:v1.50.0", Shards: shards})
+		if err == nil || !strings.Contains(err.Error(), "between 0 and") {
+			t.Errorf("shards %d: error %v, want the bounds of the shards", shards, err)
+		}
+	}
+}
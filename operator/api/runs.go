@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// RunRef identifies a run for stable links, which use the Job UID because names are
+// reused once a Job is deleted.
+type RunRef struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	UID       string `json:"uid"`
+}
+
+// findRun looks a run up by Job UID or name, it returns nil if neither matches.
+func findRun(ctx context.Context, clientset *kubernetes.Clientset, namespace, id string) (*batchv1.Job, error) {
+	job, err := clientset.BatchV1().Jobs(namespace).Get(ctx, id, metav1.GetOptions{})
+	if err == nil {
+		return job, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range jobs.Items {
+		if string(jobs.Items[i].UID) == id {
+			return &jobs.Items[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// GET /runs/{id}?namespace=ns resolves a Job UID or name
+func resolveRun(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+
+	job, err := findRun(r.Context(), clientset, namespace, r.PathValue("id"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if job == nil {
+		writeError(w, "run not found", http.StatusNotFound)
+		return
+	}
+
+	respondJSON(w, RunRef{Namespace: job.Namespace, Name: job.Name, UID: string(job.UID)})
+}
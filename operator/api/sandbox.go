@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	defaultBrowser = "chromium"
+	shmVolumeName  = "dshm"
+)
+
+// browserSandbox holds the pod settings a browser needs to run inside a container.
+// Browsers use /dev/shm heavily and crash with the 64Mi docker default, so every
+// run gets a memory backed emptyDir sized for its browser.
+type browserSandbox struct {
+	shmSize      resource.Quantity
+	capabilities []corev1.Capability
+	seccomp      corev1.SeccompProfileType
+}
+
+var browserSandboxes = map[string]browserSandbox{
+	"chromium": {
+		shmSize: resource.MustParse("1Gi"),
+		seccomp: corev1.SeccompProfileTypeRuntimeDefault,
+	},
+	// the Chromium user namespace sandbox needs SYS_ADMIN and is blocked by the runtime default profile
+	"chromium-sandbox": {
+		shmSize:      resource.MustParse("1Gi"),
+		capabilities: []corev1.Capability{"SYS_ADMIN"},
+		seccomp:      corev1.SeccompProfileTypeUnconfined,
+	},
+	"firefox": {
+		shmSize: resource.MustParse("512Mi"),
+		seccomp: corev1.SeccompProfileTypeRuntimeDefault,
+	},
+	"webkit": {
+		shmSize: resource.MustParse("512Mi"),
+		seccomp: corev1.SeccompProfileTypeRuntimeDefault,
+	},
+}
+
+// applyBrowserSandbox mounts a /dev/shm volume into every container of the pod
+// and sets the seccomp profile and capabilities required by the browser.
+func applyBrowserSandbox(spec *corev1.PodSpec, browser string) error {
+	if browser == "" {
+		browser = defaultBrowser
+	}
+
+	sandbox, ok := browserSandboxes[browser]
+	if !ok {
+		return fmt.Errorf("unsupported browser %q", browser)
+	}
+
+	spec.Volumes = append(spec.Volumes, corev1.Volume{
+		Name: shmVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{
+				Medium:    corev1.StorageMediumMemory,
+				SizeLimit: ptr.To(sandbox.shmSize),
+			},
+		},
+	})
+
+	for i := range spec.Containers {
+		c := &spec.Containers[i]
+		c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+			Name:      shmVolumeName,
+			MountPath: "/dev/shm",
+		})
+		c.SecurityContext = &corev1.SecurityContext{
+			AllowPrivilegeEscalation: ptr.To(len(sandbox.capabilities) > 0),
+			Capabilities: &corev1.Capabilities{
+				Drop: []corev1.Capability{"ALL"},
+				Add:  sandbox.capabilities,
+			},
+			SeccompProfile: &corev1.SeccompProfile{Type: sandbox.seccomp},
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// scanLabel holds the verdict of the artifact scan of a run, runs without it are not
+	// scanned yet.
+	scanLabel       = "playwright.operator/artifact-scan"
+	scanClean       = "clean"
+	scanQuarantined = "quarantined"
+	scanReleased    = "released"
+
+	// defaultScanMaxSize is the StreamMaxLength of clamd.
+	defaultScanMaxSize = "25Mi"
+	clamdChunkSize     = 64 << 10
+	scanTimeout        = 2 * time.Minute
+)
+
+// ScanFinding is a file of a run the scanner found malware in.
+type ScanFinding struct {
+	File      string `json:"file"`
+	Signature string `json:"signature"`
+}
+
+// ScanRelease records who released quarantined artifacts and why.
+type ScanRelease struct {
+	By     string    `json:"by"`
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+}
+
+// ArtifactScan is the verdict of scanning the report and checkpoint files of a run, kept
+// in the results volume where the dashboard holds back the artifacts of quarantined runs.
+// File paths are relative to the results volume, Skipped lists those over the size limit
+// of the scanner.
+type ArtifactScan struct {
+	Run      RunRef        `json:"run"`
+	Status   string        `json:"status"`
+	Scanner  string        `json:"scanner"`
+	Scanned  time.Time     `json:"scanned"`
+	Files    int           `json:"files"`
+	Skipped  []string      `json:"skipped,omitempty"`
+	Findings []ScanFinding `json:"findings,omitempty"`
+	Release  *ScanRelease  `json:"release,omitempty"`
+}
+
+type ScanReleaseRequest struct {
+	By     string `json:"by"`
+	Reason string `json:"reason"`
+}
+
+func artifactScanFile(uid types.UID) string {
+	return filepath.Join(resultsDir, "scans", string(uid)+".json")
+}
+
+// readArtifactScan returns nil for runs that are not scanned yet.
+func readArtifactScan(uid types.UID) (*ArtifactScan, error) {
+	data, err := os.ReadFile(artifactScanFile(uid))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var scan ArtifactScan
+	if err := json.Unmarshal(data, &scan); err != nil {
+		return nil, fmt.Errorf("decoding the artifact scan of run %s: %w", uid, err)
+	}
+
+	return &scan, nil
+}
+
+func writeArtifactScan(uid types.UID, scan *ArtifactScan) error {
+	return writeFileAtomic(artifactScanFile(uid), func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(scan)
+	})
+}
+
+// artifactScanningEnabled tells whether runs are scanned, their reports are only uploaded
+// to the results store once found clean or released.
+func artifactScanningEnabled() bool {
+	return os.Getenv("ARTIFACT_SCAN_CLAMD") != "" || os.Getenv("ARTIFACT_SCAN_URL") != ""
+}
+
+// artifactScanner scans files with clamd over TCP or with an HTTP API that takes the file
+// as body and answers {"infected": true, "signature": "..."}.
+type artifactScanner struct {
+	clamd   string
+	url     string
+	token   string
+	maxSize int64
+}
+
+// artifactScannerFromEnv reads ARTIFACT_SCAN_CLAMD, the host:port of clamd, or
+// ARTIFACT_SCAN_URL and ARTIFACT_SCAN_TOKEN, and ARTIFACT_SCAN_MAX_SIZE, a quantity like
+// 25Mi. It returns nil without scanner.
+func artifactScannerFromEnv() (*artifactScanner, error) {
+	if !artifactScanningEnabled() {
+		return nil, nil
+	}
+
+	s := &artifactScanner{clamd: os.Getenv("ARTIFACT_SCAN_CLAMD"), url: os.Getenv("ARTIFACT_SCAN_URL"), token: os.Getenv("ARTIFACT_SCAN_TOKEN")}
+	if s.clamd != "" && s.url != "" {
+		return nil, errors.New("set either ARTIFACT_SCAN_CLAMD or ARTIFACT_SCAN_URL")
+	}
+	if s.url != "" {
+		if u, err := url.Parse(s.url); err != nil || u.Host == "" {
+			return nil, fmt.Errorf("ARTIFACT_SCAN_URL %q is not a URL", s.url)
+		}
+	}
+	q, err := resource.ParseQuantity(envOrDefault("ARTIFACT_SCAN_MAX_SIZE", defaultScanMaxSize))
+	if err != nil || q.Sign() <= 0 {
+		return nil, fmt.Errorf("ARTIFACT_SCAN_MAX_SIZE must be a positive quantity like %s", defaultScanMaxSize)
+	}
+	s.maxSize = q.Value()
+
+	return s, nil
+}
+
+func (s *artifactScanner) name() string {
+	if s.clamd != "" {
+		return "clamd " + s.clamd
+	}
+	u, _ := url.Parse(s.url)
+
+	return u.Host
+}
+
+// scanFile returns the signature of the malware found in a file, or "".
+func (s *artifactScanner) scanFile(ctx context.Context, file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, scanTimeout)
+	defer cancel()
+	if s.clamd != "" {
+		return s.clamdScan(ctx, f)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, f)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-File-Name", filepath.Base(file))
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("scanner answered %s", resp.Status)
+	}
+
+	var verdict struct {
+		Infected  bool   `json:"infected"`
+		Signature string `json:"signature"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&verdict); err != nil {
+		return "", fmt.Errorf("decoding the scanner verdict: %w", err)
+	}
+	if verdict.Infected && verdict.Signature == "" {
+		verdict.Signature = "unknown"
+	}
+
+	return verdict.Signature, nil
+}
+
+// clamdScan streams a file with the INSTREAM command of clamd, which answers
+// "stream: OK" or "stream: <signature> FOUND".
+func (s *artifactScanner) clamdScan(ctx context.Context, r io.Reader) (string, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.clamd)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return "", err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return "", err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	reply = strings.TrimSpace(strings.TrimSuffix(reply, "\x00"))
+	result := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case result == "OK":
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), nil
+	}
+
+	return "", fmt.Errorf("clamd answered %q", reply)
+}
+
+// scan scans the report and the checkpoint of a run, files over the size limit are
+// skipped.
+func (s *artifactScanner) scan(ctx context.Context, job *batchv1.Job) (*ArtifactScan, error) {
+	scan := &ArtifactScan{
+		Run:     RunRef{Namespace: job.Namespace, Name: job.Name, UID: string(job.UID)},
+		Status:  scanClean,
+		Scanner: s.name(),
+	}
+	for _, dir := range []string{filepath.Join(resultsDir, string(job.UID)), filepath.Join(resultsDir, "checkpoints", string(job.UID))} {
+		err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(resultsDir, file)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if info.Size() > s.maxSize {
+				scan.Skipped = append(scan.Skipped, rel)
+				return nil
+			}
+
+			signature, err := s.scanFile(ctx, file)
+			if err != nil {
+				return fmt.Errorf("scanning %s: %w", rel, err)
+			}
+			scan.Files++
+			if signature != "" {
+				scan.Findings = append(scan.Findings, ScanFinding{File: rel, Signature: signature})
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if len(scan.Findings) > 0 {
+		scan.Status = scanQuarantined
+	}
+	scan.Scanned = time.Now().UTC()
+
+	return scan, nil
+}
+
+func labelArtifactScan(ctx context.Context, clientset *kubernetes.Clientset, job *batchv1.Job, status string) error {
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{scanLabel: status},
+		},
+	})
+	_, err := clientset.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+
+	return err
+}
+
+// scanRunArtifacts scans the artifacts of finished runs once their reports are archived,
+// see archiveRunReports, and labels the runs with the verdict. Runs the scanner fails for
+// are tried again the next interval.
+func scanRunArtifacts(ctx context.Context, clientset *kubernetes.Clientset, informers *runInformers, scanner *artifactScanner, namespace string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		jobs, err := informers.runs(ctx, namespace, runsSelector+","+rawReportLabel+",!"+scanLabel+",!"+reportMergeLabel)
+		if err != nil {
+			log.Printf("cannot list runs to scan: %v", err)
+			continue
+		}
+
+		for i := range jobs {
+			job := &jobs[i]
+			scan, err := scanner.scan(ctx, job)
+			if err != nil {
+				log.Printf("cannot scan the artifacts of run %s/%s: %v", job.Namespace, job.Name, err)
+				continue
+			}
+			if err := writeArtifactScan(job.UID, scan); err != nil {
+				log.Printf("cannot save the artifact scan of run %s/%s: %v", job.Namespace, job.Name, err)
+				continue
+			}
+			if scan.Status == scanQuarantined {
+				log.Printf("quarantined the artifacts of run %s/%s: %d files with malware", job.Namespace, job.Name, len(scan.Findings))
+			}
+			if err := labelArtifactScan(ctx, clientset, job, scan.Status); err != nil {
+				log.Printf("cannot label run %s/%s: %v", job.Namespace, job.Name, err)
+			}
+		}
+	}
+}
+
+// GET /runs/{id}/scan?namespace=ns
+func getArtifactScan(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	job, err := findRun(r.Context(), clientset, getNamespace(r.URL.Query().Get("namespace")), r.PathValue("id"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if job == nil {
+		writeError(w, "run not found", http.StatusNotFound)
+		return
+	}
+
+	scan, err := readArtifactScan(job.UID)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if scan == nil {
+		writeError(w, "the artifacts of the run are not scanned yet", http.StatusNotFound)
+		return
+	}
+
+	respondJSON(w, scan)
+}
+
+// GET /admin/scans?namespace=ns lists the runs whose artifacts were quarantined, newest
+// scans first.
+func listQuarantinedRuns(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	jobs, err := clientset.BatchV1().Jobs(getNamespace(r.URL.Query().Get("namespace"))).List(r.Context(), metav1.ListOptions{
+		LabelSelector: scanLabel + " in (" + scanQuarantined + "," + scanReleased + ")",
+	})
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	scans := []*ArtifactScan{}
+	for _, job := range jobs.Items {
+		if scan, err := readArtifactScan(job.UID); err == nil && scan != nil {
+			scans = append(scans, scan)
+		}
+	}
+	sort.Slice(scans, func(i, j int) bool { return scans[i].Scanned.After(scans[j].Scanned) })
+
+	respondJSON(w, scans)
+}
+
+// POST /admin/scans/{id}/release?namespace=ns with {"by": "...", "reason": "..."}
+//
+// releaseArtifacts serves the quarantined artifacts of a run again, for findings that are
+// false positives. With authentication, the releaser is the user of the token, by is
+// ignored, and ARTIFACT_RELEASE_GROUPS restricts who may release.
+func releaseArtifacts(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	var req ScanReleaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	release := ScanRelease{By: requestUser(r, req.By), Reason: strings.TrimSpace(req.Reason), Time: time.Now().UTC()}
+	if claims := requestClaims(r); claims != nil {
+		cfg := authConfigFromEnv()
+		if groups := splitList(os.Getenv("ARTIFACT_RELEASE_GROUPS")); len(groups) > 0 && !cfg.memberOf(claims, groups) {
+			writeError(w, "none of the groups or roles of the token may release quarantined artifacts", http.StatusForbidden)
+			return
+		}
+		for _, claim := range []string{"name", "preferred_username", "email"} {
+			if release.By != "" {
+				break
+			}
+			release.By, _ = claims[claim].(string)
+		}
+	}
+	if release.By == "" || release.Reason == "" {
+		writeError(w, "who releases the artifacts and why is required", http.StatusBadRequest)
+		return
+	}
+
+	job, err := findRun(r.Context(), clientset, getNamespace(r.URL.Query().Get("namespace")), r.PathValue("id"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if job == nil {
+		writeError(w, "run not found", http.StatusNotFound)
+		return
+	}
+	scan, err := readArtifactScan(job.UID)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if scan == nil || scan.Status != scanQuarantined {
+		writeError(w, "the artifacts of the run are not quarantined", http.StatusConflict)
+		return
+	}
+
+	scan.Status = scanReleased
+	scan.Release = &release
+	if err := writeArtifactScan(job.UID, scan); err != nil {
+		respondError(w, err)
+		return
+	}
+	if err := labelArtifactScan(r.Context(), clientset, job, scanReleased); err != nil {
+		respondError(w, err)
+		return
+	}
+	log.Printf("quarantined artifacts of run %s/%s released by %s: %s", job.Namespace, job.Name, release.By, release.Reason)
+
+	respondJSON(w, scan)
+}
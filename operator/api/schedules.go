@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+// Schedules start runs on a cron schedule through a CronJob. Unlike the checks of
+// monitors their Jobs are regular runs, labelled with the schedule that started them.
+const scheduleLabel = "playwright.operator/schedule"
+
+// upcomingRuns is the number of upcoming run times reported per schedule.
+const upcomingRuns = 3
+
+type ScheduleSpec struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	// TimeZone is the IANA time zone of the schedule, the one of the controller manager
+	// without.
+	TimeZone string `json:"timeZone,omitempty"`
+	Suspend  bool   `json:"suspend,omitempty"`
+	// SuccessfulRunsHistoryLimit and FailedRunsHistoryLimit are the finished runs kept,
+	// 3 and 1 by default as for CronJobs. Pinned runs, signed off ones included, do not
+	// count and are kept, see setPinned.
+	SuccessfulRunsHistoryLimit *int32  `json:"successfulRunsHistoryLimit,omitempty"`
+	FailedRunsHistoryLimit     *int32  `json:"failedRunsHistoryLimit,omitempty"`
+	Run                        RunSpec `json:"run"`
+}
+
+type ScheduleStatus struct {
+	Name                       string     `json:"name"`
+	Schedule                   string     `json:"schedule"`
+	TimeZone                   string     `json:"timeZone,omitempty"`
+	Suspended                  bool       `json:"suspended"`
+	SuccessfulRunsHistoryLimit int32      `json:"successfulRunsHistoryLimit"`
+	FailedRunsHistoryLimit     int32      `json:"failedRunsHistoryLimit"`
+	LastRun                    *time.Time `json:"lastRun,omitempty"`
+	LastSuccessfulRun          *time.Time `json:"lastSuccessfulRun,omitempty"`
+	// Upcoming are the next times the schedule starts a run, empty while suspended.
+	Upcoming []time.Time `json:"upcoming"`
+	// Active are the names of the runs of the schedule that have not finished.
+	Active []string `json:"active,omitempty"`
+}
+
+func scheduleCronJobName(name string) string {
+	return "schedule-" + name
+}
+
+// newScheduleCronJob builds the CronJob of a schedule from its run, runs do not overlap.
+func newScheduleCronJob(namespace string, spec ScheduleSpec, settings Settings) (*batchv1.CronJob, error) {
+	if errs := validation.IsDNS1123Label(spec.Name); len(errs) > 0 || len(spec.Name) > 40 {
+		return nil, fmt.Errorf("name must be a DNS label of at most 40 characters")
+	}
+	if spec.Run.Credentials != nil {
+		return nil, fmt.Errorf("schedules do not support run credentials")
+	}
+	if spec.Run.isMatrix() {
+		return nil, fmt.Errorf("schedules do not support matrix runs")
+	}
+	if _, err := parseCron(spec.Schedule); err != nil {
+		return nil, fmt.Errorf("invalid schedule: %w", err)
+	}
+	if spec.TimeZone != "" {
+		if _, err := time.LoadLocation(spec.TimeZone); err != nil {
+			return nil, fmt.Errorf("invalid timeZone: %w", err)
+		}
+	}
+	for _, limit := range []*int32{spec.SuccessfulRunsHistoryLimit, spec.FailedRunsHistoryLimit} {
+		if limit != nil && *limit < 0 {
+			return nil, fmt.Errorf("history limits must not be negative")
+		}
+	}
+
+	run := spec.Run
+	run.Namespace = namespace
+	if run.TTLSecondsAfterFinished == nil {
+		run.TTLSecondsAfterFinished = settings.RunTTLSecondsAfterFinished
+	}
+	run.Labels = copyLabels(run.Labels)
+	if run.Labels == nil {
+		run.Labels = map[string]string{}
+	}
+	run.Labels[scheduleLabel] = spec.Name
+
+	job, err := newRunJob(run)
+	if err != nil {
+		return nil, err
+	}
+	if videoPreviewImage() != "" && settings.feature(featureVideoPreviews) {
+		addVideoPreviews(job)
+	}
+
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      scheduleCronJobName(spec.Name),
+			Namespace: namespace,
+			Labels:    map[string]string{scheduleLabel: spec.Name},
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:                   spec.Schedule,
+			Suspend:                    ptr.To(spec.Suspend),
+			ConcurrencyPolicy:          batchv1.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: ptr.To(ptr.Deref(spec.SuccessfulRunsHistoryLimit, 3)),
+			FailedJobsHistoryLimit:     ptr.To(ptr.Deref(spec.FailedRunsHistoryLimit, 1)),
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: job.Labels, Annotations: job.Annotations},
+				Spec:       job.Spec,
+			},
+		},
+	}
+	if spec.TimeZone != "" {
+		cronJob.Spec.TimeZone = ptr.To(spec.TimeZone)
+	}
+
+	return cronJob, nil
+}
+
+// scheduleStatus reports a schedule, upcoming runs are computed from now.
+func scheduleStatus(cronJob *batchv1.CronJob, now time.Time) ScheduleStatus {
+	status := ScheduleStatus{
+		Name:                       cronJob.Labels[scheduleLabel],
+		Schedule:                   cronJob.Spec.Schedule,
+		TimeZone:                   ptr.Deref(cronJob.Spec.TimeZone, ""),
+		Suspended:                  ptr.Deref(cronJob.Spec.Suspend, false),
+		SuccessfulRunsHistoryLimit: ptr.Deref(cronJob.Spec.SuccessfulJobsHistoryLimit, 3),
+		FailedRunsHistoryLimit:     ptr.Deref(cronJob.Spec.FailedJobsHistoryLimit, 1),
+		Upcoming:                   []time.Time{},
+	}
+	if t := cronJob.Status.LastScheduleTime; t != nil {
+		status.LastRun = &t.Time
+	}
+	if t := cronJob.Status.LastSuccessfulTime; t != nil {
+		status.LastSuccessfulRun = &t.Time
+	}
+	for _, ref := range cronJob.Status.Active {
+		status.Active = append(status.Active, ref.Name)
+	}
+
+	if !status.Suspended {
+		location := time.Local
+		if status.TimeZone != "" {
+			if loc, err := time.LoadLocation(status.TimeZone); err == nil {
+				location = loc
+			}
+		}
+		if schedule, err := parseCron(status.Schedule); err == nil {
+			status.Upcoming = schedule.upcoming(now.In(location), upcomingRuns)
+		}
+	}
+
+	return status
+}
+
+// GET /schedules?namespace=ns
+func listSchedules(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+
+	cronJobs, err := clientset.BatchV1().CronJobs(namespace).List(r.Context(), metav1.ListOptions{LabelSelector: scheduleLabel})
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	now := time.Now()
+	schedules := []ScheduleStatus{}
+	for i := range cronJobs.Items {
+		schedules = append(schedules, scheduleStatus(&cronJobs.Items[i], now))
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].Name < schedules[j].Name
+	})
+
+	respondJSON(w, schedules)
+}
+
+// POST /schedules?namespace=ns with a ScheduleSpec
+func createSchedule(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+
+	var spec ScheduleSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		writeError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	settings, err := effectiveSettings(r.Context(), clientset)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if spec.Run.Suite != "" {
+		_, policies, err := loadSuitePolicies(r.Context(), clientset, namespace)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		spec.Run.Labels = withSuiteLabels(spec.Run.Labels, suitePolicy(policies, spec.Run.Suite))
+	}
+	if err := checkCostLabels(settings, spec.Run); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if spec.Run.namespacePullSecrets, err = namespaceImagePullSecrets(r.Context(), clientset, namespace); err != nil {
+		respondError(w, err)
+		return
+	}
+	cronJob, err := newScheduleCronJob(namespace, spec, settings)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// the CronJob starts the runs itself, so they are admitted once for the schedule
+	run := spec.Run
+	run.Namespace = namespace
+	if err := admitRun(r.Context(), clientset, settings, run); err != nil {
+		writeError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var pullSecrets []string
+	for _, ref := range cronJob.Spec.JobTemplate.Spec.Template.Spec.ImagePullSecrets {
+		pullSecrets = append(pullSecrets, ref.Name)
+	}
+	if err := validateImagePull(r.Context(), clientset, namespace, spec.Run.Image, pullSecrets); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created, err := clientset.BatchV1().CronJobs(namespace).Create(r.Context(), cronJob, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		writeError(w, "schedule "+spec.Name+" already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSONStatus(w, http.StatusCreated, scheduleStatus(created, time.Now()))
+}
+
+// PATCH /schedules/{name}?namespace=ns with {"suspend": true} suspends or resumes a
+// schedule.
+func suspendSchedule(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+
+	var req struct {
+		Suspend *bool `json:"suspend"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Suspend == nil {
+		writeError(w, "suspend is required", http.StatusBadRequest)
+		return
+	}
+
+	patch, _ := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{"suspend": *req.Suspend},
+	})
+	patched, err := clientset.BatchV1().CronJobs(namespace).Patch(r.Context(), scheduleCronJobName(r.PathValue("name")),
+		types.MergePatchType, patch, metav1.PatchOptions{})
+	if apierrors.IsNotFound(err) {
+		writeError(w, "schedule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, scheduleStatus(patched, time.Now()))
+}
+
+// DELETE /schedules/{name}?namespace=ns removes the schedule, its runs are kept until
+// their TTL.
+func deleteSchedule(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+
+	// orphaning keeps the runs the CronJob owns
+	err := clientset.BatchV1().CronJobs(namespace).Delete(r.Context(), scheduleCronJobName(r.PathValue("name")), metav1.DeleteOptions{
+		PropagationPolicy: ptr.To(metav1.DeletePropagationOrphan),
+	})
+	if apierrors.IsNotFound(err) {
+		writeError(w, "schedule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	selftestLabel = "playwright.operator/selftest"
+
+	// selftestTokenAudience is the audience of the service account token the self-test signs
+	// in to the dashboard with, see selftestSession.
+	selftestTokenAudience = "playwright-operator-selftest"
+	selftestTokenEnvVar   = "SELFTEST_TOKEN"
+)
+
+// SelftestStatus reports the latest run of the bundled dashboard suite.
+type SelftestStatus struct {
+	Name      string     `json:"name"`
+	Namespace string     `json:"namespace"`
+	State     string     `json:"state"`
+	Created   time.Time  `json:"created"`
+	Completed *time.Time `json:"completed,omitempty"`
+}
+
+func newSelftestStatus(job *batchv1.Job) SelftestStatus {
+	status := SelftestStatus{
+		Name:      job.Name,
+		Namespace: job.Namespace,
+		State:     jobState(job),
+		Created:   job.CreationTimestamp.Time,
+	}
+	if job.Status.CompletionTime != nil {
+		status.Completed = &job.Status.CompletionTime.Time
+	}
+
+	return status
+}
+
+// startSelftest runs the Playwright suite in operator/selftest against the dashboard of this installation.
+// With SELFTEST_SERVICE_ACCOUNT the run gets a token of that service account as
+// SELFTEST_TOKEN, which signs it in to dashboards requiring authentication.
+func startSelftest(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset, namespace string) {
+	spec := RunSpec{
+		Namespace:    namespace,
+		GenerateName: "operator-selftest-",
+		Image:        envOrDefault("SELFTEST_IMAGE", "localhost:5001/operator/selftest"),
+		Env: map[string]string{
+			"DASHBOARD_URL": envOrDefault("SELFTEST_DASHBOARD_URL", "http://operator:3000"),
+		},
+		Labels: map[string]string{selftestLabel: "true"},
+	}
+	if account := os.Getenv("SELFTEST_SERVICE_ACCOUNT"); account != "" {
+		spec.Credentials = &RunCredentials{
+			ServiceAccount: account,
+			Audiences:      []string{selftestTokenAudience},
+			EnvVar:         selftestTokenEnvVar,
+		}
+	}
+
+	created, err := createRun(r.Context(), clientset, spec)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSONStatus(w, http.StatusAccepted, newSelftestStatus(created))
+}
+
+func selftestStatus(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset, namespace string) {
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(r.Context(), metav1.ListOptions{
+		LabelSelector: selftestLabel + "=true",
+	})
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	if len(jobs.Items) == 0 {
+		writeError(w, "no self-test has been run", http.StatusNotFound)
+		return
+	}
+
+	sort.Slice(jobs.Items, func(i, j int) bool {
+		return jobs.Items[i].CreationTimestamp.After(jobs.Items[j].CreationTimestamp.Time)
+	})
+
+	respondJSON(w, newSelftestStatus(&jobs.Items[0]))
+}
+
+// SelftestSession is the service account a self-test signs in to the dashboard as.
+type SelftestSession struct {
+	Subject   string `json:"subject"`
+	Namespace string `json:"namespace"`
+}
+
+// POST /selftest/session {"token": "..."}
+//
+// The dashboard asks with its own token whether a self-test may sign in with the token of
+// the request body: a token of SELFTEST_SERVICE_ACCOUNT in a namespace of runs, for the
+// audience of the self-test. The token is bound to the credentials Secret of the run and
+// stops being valid with it.
+func selftestSession(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		writeError(w, "a token is required", http.StatusBadRequest)
+		return
+	}
+	account := os.Getenv("SELFTEST_SERVICE_ACCOUNT")
+	if account == "" {
+		writeError(w, "the self-test has no service account, see SELFTEST_SERVICE_ACCOUNT", http.StatusNotFound)
+		return
+	}
+
+	review, err := clientset.AuthenticationV1().TokenReviews().Create(r.Context(), &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: req.Token, Audiences: []string{selftestTokenAudience}},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	namespaces, err := runNamespaces.list(r.Context(), clientset)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	session, err := checkSelftestToken(review.Status, account, namespaces)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	respondJSON(w, session)
+}
+
+// checkSelftestToken checks the review of a token against the service account of the
+// self-test in one of namespaces.
+func checkSelftestToken(status authenticationv1.TokenReviewStatus, account string, namespaces []string) (SelftestSession, error) {
+	if !status.Authenticated {
+		return SelftestSession{}, fmt.Errorf("invalid token: %s", status.Error)
+	}
+	if !slices.Contains(status.Audiences, selftestTokenAudience) {
+		return SelftestSession{}, errors.New("the token is not for the self-test")
+	}
+	user, ok := strings.CutPrefix(status.User.Username, "system:serviceaccount:")
+	namespace, name, _ := strings.Cut(user, ":")
+	if !ok || name != account || !slices.Contains(namespaces, namespace) {
+		return SelftestSession{}, errors.New("the token is not of the service account of the self-test")
+	}
+
+	return SelftestSession{Subject: status.User.Username, Namespace: namespace}, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+func TestCheckSelftestToken(t *testing.T) {
+	review := func(username string, audiences ...string) authenticationv1.TokenReviewStatus {
+		return authenticationv1.TokenReviewStatus{
+			Authenticated: true,
+			Audiences:     audiences,
+			User:          authenticationv1.UserInfo{Username: username},
+		}
+	}
+	namespaces := []string{"default", "tests"}
+
+	for _, tc := range []struct {
+		name   string
+		status authenticationv1.TokenReviewStatus
+		ok     bool
+	}{
+		{"self-test", review("system:serviceaccount:tests:playwright-selftest", selftestTokenAudience), true},
+		{"unauthenticated", authenticationv1.TokenReviewStatus{Error: "token expired"}, false},
+		{"other audience", review("system:serviceaccount:tests:playwright-selftest", warmTokenAudience), false},
+		{"other service account", review("system:serviceaccount:tests:operator", selftestTokenAudience), false},
+		{"namespace without runs", review("system:serviceaccount:team:playwright-selftest", selftestTokenAudience), false},
+		{"user", review("playwright-selftest", selftestTokenAudience), false},
+	} {
+		session, err := checkSelftestToken(tc.status, "playwright-selftest", namespaces)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: checkSelftestToken error %v, want ok %v", tc.name, err, tc.ok)
+		}
+		if tc.ok && session.Namespace != "tests" {
+			t.Errorf("%s: session = %+v, want the namespace tests", tc.name, session)
+		}
+	}
+}
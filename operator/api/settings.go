@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	settingsConfigMap = "playwright-settings"
+	settingsKey       = "settings.json"
+	settingsAuditKey  = "audit.json"
+	// maxSettingsAudit bounds the changes kept in the audit of the settings.
+	maxSettingsAudit = 100
+)
+
+// Feature flags of the settings, features are enabled unless switched off.
+const (
+	featureVideoPreviews     = "videoPreviews"
+	featureArtifactRetention = "artifactRetention"
+)
+
+var knownFeatures = map[string]bool{
+	featureVideoPreviews:     true,
+	featureArtifactRetention: true,
+}
+
+// Settings tune a running installation without redeploying it. Unset fields fall back to
+// the environment of the API, see settingsFromEnv.
+type Settings struct {
+	// RunTTLSecondsAfterFinished is the ttlSecondsAfterFinished of runs that do not set
+	// one, overriding RUN_TTL_SECONDS_AFTER_FINISHED.
+	RunTTLSecondsAfterFinished *int32 `json:"runTTLSecondsAfterFinished,omitempty"`
+	// MaxRunningRuns rejects new runs while as many runs of the namespace are running,
+	// zero is unlimited.
+	MaxRunningRuns int `json:"maxRunningRuns,omitempty"`
+	// SLOAlertWebhook and MonitorAlertWebhook override SLO_ALERT_WEBHOOK and
+	// MONITOR_ALERT_WEBHOOK.
+	SLOAlertWebhook     string `json:"sloAlertWebhook,omitempty"`
+	MonitorAlertWebhook string `json:"monitorAlertWebhook,omitempty"`
+	// Features switches features off, e.g. {"videoPreviews": false}.
+	Features map[string]bool `json:"features,omitempty"`
+	// Hooks are called at the extension points of the API, see hooks.go.
+	Hooks []Hook `json:"hooks,omitempty"`
+	// AdmissionRules are checked for every new run after the pre-schedule hooks, see
+	// admission.go.
+	AdmissionRules []AdmissionRule `json:"admissionRules,omitempty"`
+	// CostLabels are the labels every run needs, set by its trigger or the policy of its
+	// suite, e.g. ["team", "cost-center"]. Runs pass them on to their pods, see labels.go.
+	CostLabels []string `json:"costLabels,omitempty"`
+	// ReportRetention prunes the results volume, see cleanup.go.
+	ReportRetention *ReportRetention `json:"reportRetention,omitempty"`
+}
+
+func (s Settings) validate() error {
+	if s.RunTTLSecondsAfterFinished != nil && *s.RunTTLSecondsAfterFinished < 0 {
+		return fmt.Errorf("runTTLSecondsAfterFinished must not be negative")
+	}
+	if s.MaxRunningRuns < 0 {
+		return fmt.Errorf("maxRunningRuns must not be negative")
+	}
+	for field, webhook := range map[string]string{"sloAlertWebhook": s.SLOAlertWebhook, "monitorAlertWebhook": s.MonitorAlertWebhook} {
+		if webhook == "" {
+			continue
+		}
+		if u, err := url.Parse(webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s must be an http or https URL", field)
+		}
+	}
+	for name := range s.Features {
+		if !knownFeatures[name] {
+			return fmt.Errorf("unknown feature %q", name)
+		}
+	}
+	for _, hook := range s.Hooks {
+		if err := hook.validate(); err != nil {
+			return err
+		}
+	}
+	for _, rule := range s.AdmissionRules {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+	}
+	for _, key := range s.CostLabels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid cost label %q: %s", key, strings.Join(errs, ", "))
+		}
+	}
+	if s.ReportRetention != nil {
+		if err := s.ReportRetention.validate(); err != nil {
+			return fmt.Errorf("reportRetention: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// feature tells whether a feature is enabled.
+func (s Settings) feature(name string) bool {
+	enabled, ok := s.Features[name]
+	return !ok || enabled
+}
+
+// settingsFromEnv returns the settings that apply where none are stored.
+func settingsFromEnv() (Settings, error) {
+	ttl, err := strconv.ParseInt(envOrDefault("RUN_TTL_SECONDS_AFTER_FINISHED", "604800"), 10, 32)
+	if err != nil {
+		return Settings{}, fmt.Errorf("invalid RUN_TTL_SECONDS_AFTER_FINISHED: %w", err)
+	}
+
+	return Settings{
+		RunTTLSecondsAfterFinished: ptr.To(int32(ttl)),
+		SLOAlertWebhook:            os.Getenv("SLO_ALERT_WEBHOOK"),
+		MonitorAlertWebhook:        os.Getenv("MONITOR_ALERT_WEBHOOK"),
+		Features:                   map[string]bool{featureVideoPreviews: true, featureArtifactRetention: true},
+	}, nil
+}
+
+// merge returns the defaults overridden by the fields set in s.
+func (s Settings) merge(defaults Settings) Settings {
+	merged := defaults
+	if s.RunTTLSecondsAfterFinished != nil {
+		merged.RunTTLSecondsAfterFinished = s.RunTTLSecondsAfterFinished
+	}
+	if s.MaxRunningRuns != 0 {
+		merged.MaxRunningRuns = s.MaxRunningRuns
+	}
+	if s.SLOAlertWebhook != "" {
+		merged.SLOAlertWebhook = s.SLOAlertWebhook
+	}
+	if s.MonitorAlertWebhook != "" {
+		merged.MonitorAlertWebhook = s.MonitorAlertWebhook
+	}
+	merged.Hooks = s.Hooks
+	merged.AdmissionRules = s.AdmissionRules
+	merged.CostLabels = s.CostLabels
+	merged.ReportRetention = s.ReportRetention
+
+	merged.Features = map[string]bool{}
+	for name, enabled := range defaults.Features {
+		merged.Features[name] = enabled
+	}
+	for name, enabled := range s.Features {
+		merged.Features[name] = enabled
+	}
+
+	return merged
+}
+
+// errRunLimit rejects runs while the namespace runs maxRunningRuns of the settings.
+var errRunLimit = errors.New("too many running runs")
+
+// checkRunLimit fails with errRunLimit when starting more runs would make the namespace
+// run more than limit runs, zero is unlimited.
+func checkRunLimit(ctx context.Context, clientset *kubernetes.Clientset, namespace string, limit, starting int) error {
+	if limit == 0 {
+		return nil
+	}
+
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{LabelSelector: runsSelector})
+	if err != nil {
+		return err
+	}
+
+	running := 0
+	for i := range jobs.Items {
+		if jobState(&jobs.Items[i]) == jobStateRunning {
+			running++
+		}
+	}
+	if running+starting > limit {
+		return fmt.Errorf("%w: %d of at most %d runs are running in namespace %s, %d more cannot start", errRunLimit, running, limit, namespace, starting)
+	}
+
+	return nil
+}
+
+// SettingsChange records who changed which settings.
+type SettingsChange struct {
+	By     string    `json:"by,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	Time   time.Time `json:"time"`
+	// Fields are the JSON names of the changed settings.
+	Fields   []string `json:"fields"`
+	Previous Settings `json:"previous"`
+}
+
+type SettingsRequest struct {
+	Settings
+	By     string `json:"by"`
+	Reason string `json:"reason"`
+}
+
+type SettingsResponse struct {
+	// Settings are the stored settings, Effective what applies with the defaults of the
+	// environment.
+	Settings  Settings         `json:"settings"`
+	Effective Settings         `json:"effective"`
+	Audit     []SettingsChange `json:"audit"`
+}
+
+// changedSettings returns the JSON names of the fields that differ between a and b.
+func changedSettings(a, b Settings) []string {
+	fields := []string{}
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	for i := 0; i < va.NumField(); i++ {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			name, _, _ := strings.Cut(va.Type().Field(i).Tag.Get("json"), ",")
+			fields = append(fields, name)
+		}
+	}
+
+	return fields
+}
+
+// loadSettings reads the settings of the installation, which are kept in the namespace
+// of the API.
+func loadSettings(ctx context.Context, clientset *kubernetes.Clientset) (*corev1.ConfigMap, Settings, []SettingsChange, error) {
+	namespace := getNamespace("")
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, settingsConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: settingsConfigMap, Namespace: namespace}}
+	} else if err != nil {
+		return nil, Settings{}, nil, err
+	}
+
+	var settings Settings
+	if data := cm.Data[settingsKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &settings); err != nil {
+			return nil, Settings{}, nil, fmt.Errorf("decoding %s: %w", settingsConfigMap, err)
+		}
+	}
+	audit := []SettingsChange{}
+	if data := cm.Data[settingsAuditKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &audit); err != nil {
+			return nil, Settings{}, nil, fmt.Errorf("decoding %s: %w", settingsConfigMap, err)
+		}
+	}
+
+	return cm, settings, audit, nil
+}
+
+// effectiveSettings returns the stored settings merged onto the defaults of the
+// environment.
+func effectiveSettings(ctx context.Context, clientset *kubernetes.Clientset) (Settings, error) {
+	defaults, err := settingsFromEnv()
+	if err != nil {
+		return Settings{}, err
+	}
+	_, settings, _, err := loadSettings(ctx, clientset)
+	if err != nil {
+		return Settings{}, err
+	}
+
+	return settings.merge(defaults), nil
+}
+
+func settingsResponse(settings Settings, audit []SettingsChange) (SettingsResponse, error) {
+	defaults, err := settingsFromEnv()
+	if err != nil {
+		return SettingsResponse{}, err
+	}
+
+	return SettingsResponse{Settings: settings, Effective: settings.merge(defaults), Audit: audit}, nil
+}
+
+// GET /admin/settings
+func getSettings(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	_, settings, audit, err := loadSettings(r.Context(), clientset)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	resp, err := settingsResponse(settings, audit)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, resp)
+}
+
+// PUT /admin/settings with the Settings, "by" and "reason", e.g. {"maxRunningRuns": 10,
+// "features": {"videoPreviews": false}, "by": "alice"}, replaces the stored settings and
+// records the change in the audit. With authentication, only ADMIN_GROUPS may change the
+// settings and the audit records the name of the token, "by" is ignored.
+func putSettings(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	var req SettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.By = requestUser(r, req.By)
+	if err := req.Settings.validate(); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var audit []SettingsChange
+	for attempt := 0; ; attempt++ {
+		cm, previous, stored, err := loadSettings(r.Context(), clientset)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+
+		audit = stored
+		if fields := changedSettings(previous, req.Settings); len(fields) > 0 {
+			audit = append(audit, SettingsChange{
+				By:       req.By,
+				Reason:   req.Reason,
+				Time:     time.Now().UTC(),
+				Fields:   fields,
+				Previous: previous,
+			})
+		}
+		if len(audit) > maxSettingsAudit {
+			audit = audit[len(audit)-maxSettingsAudit:]
+		}
+
+		err = saveSettings(r.Context(), clientset, cm, req.Settings, audit)
+		if err == nil {
+			break
+		}
+		if (!apierrors.IsConflict(err) && !apierrors.IsAlreadyExists(err)) || attempt == 4 {
+			respondError(w, err)
+			return
+		}
+	}
+
+	resp, err := settingsResponse(req.Settings, audit)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, resp)
+}
+
+func saveSettings(ctx context.Context, clientset *kubernetes.Clientset, cm *corev1.ConfigMap, settings Settings, audit []SettingsChange) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	auditData, err := json.Marshal(audit)
+	if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[settingsKey] = string(data)
+	cm.Data[settingsAuditKey] = string(auditData)
+
+	if cm.ResourceVersion == "" {
+		_, err = clientset.CoreV1().ConfigMaps(cm.Namespace).Create(ctx, cm, metav1.CreateOptions{})
+	} else {
+		_, err = clientset.CoreV1().ConfigMaps(cm.Namespace).Update(ctx, cm, metav1.UpdateOptions{})
+	}
+
+	return err
+}
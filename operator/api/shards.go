@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+// Sharded runs carry reportMergeLabel until the Job merging the blob reports of their
+// shards was started, which is labeled with the UID of its run.
+const (
+	reportMergeLabel   = "playwright.operator/report-merge"
+	reportMergePending = "pending"
+	mergeRunLabel      = "playwright.operator/merge-run"
+)
+
+// mergeReportsScript merges the blob reports the shards wrote to the blobs directory of
+// the checkpoint of the run, see resumableRunScript, into the HTML report of the run.
+// Runs cancelled before any shard finished have none.
+const mergeReportsScript = `ls "$1"/*.zip >/dev/null 2>&1 || exit 0
+npx playwright merge-reports --reporter html "$1"`
+
+// ShardStatus is the state of a shard of a sharded run, from its latest pod.
+type ShardStatus struct {
+	Index  int         `json:"index"`
+	State  string      `json:"state"`
+	Pod    string      `json:"pod,omitempty"`
+	Counts *TestCounts `json:"counts,omitempty"`
+}
+
+// addReportMerge marks a sharded run to get its reports merged once it finished.
+func addReportMerge(job *batchv1.Job) {
+	if job.Labels == nil {
+		job.Labels = map[string]string{}
+	}
+	job.Labels[reportMergeLabel] = reportMergePending
+}
+
+// mergesShardReports tells whether the shards of a run write blob reports to merge, which
+// the default command does.
+func mergesShardReports(job *batchv1.Job) bool {
+	if job.Spec.CompletionMode == nil || *job.Spec.CompletionMode != batchv1.IndexedCompletion {
+		return false
+	}
+	for _, c := range job.Spec.Template.Spec.Containers {
+		if c.Name == runContainer && len(c.Command) > 2 && c.Command[2] == resumableRunScript {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shardStatuses returns the state of every shard of a run, nothing for runs that are not
+// sharded. Shards without a pod yet are pending.
+func shardStatuses(job *batchv1.Job, pods []corev1.Pod) []ShardStatus {
+	if job.Spec.CompletionMode == nil || *job.Spec.CompletionMode != batchv1.IndexedCompletion || job.Spec.Completions == nil {
+		return nil
+	}
+
+	podsByIndex := map[int][]corev1.Pod{}
+	for _, pod := range pods {
+		index, err := strconv.Atoi(pod.Annotations[batchv1.JobCompletionIndexAnnotation])
+		if err != nil {
+			continue
+		}
+		podsByIndex[index] = append(podsByIndex[index], pod)
+	}
+	completed := parseIndexes(job.Status.CompletedIndexes)
+
+	shards := make([]ShardStatus, int(*job.Spec.Completions))
+	for i := range shards {
+		shard := ShardStatus{Index: i, State: "pending"}
+		if indexPods := podsByIndex[i]; len(indexPods) > 0 {
+			sort.Slice(indexPods, func(a, b int) bool {
+				return indexPods[a].CreationTimestamp.After(indexPods[b].CreationTimestamp.Time)
+			})
+			shard.Pod = indexPods[0].Name
+			switch indexPods[0].Status.Phase {
+			case corev1.PodRunning:
+				shard.State = jobStateRunning
+			case corev1.PodSucceeded:
+				shard.State = jobStateSucceeded
+			case corev1.PodFailed:
+				shard.State = jobStateFailed
+			}
+			shard.Counts = testCounts(indexPods)
+		}
+		if completed[i] {
+			shard.State = jobStateSucceeded
+		}
+		shards[i] = shard
+	}
+
+	return shards
+}
+
+// parseIndexes reads the completed indexes of a Job, e.g. "1,3-5".
+func parseIndexes(s string) map[int]bool {
+	indexes := map[int]bool{}
+	for _, part := range strings.Split(s, ",") {
+		first, last, found := strings.Cut(part, "-")
+		from, err := strconv.Atoi(first)
+		if err != nil {
+			continue
+		}
+		to := from
+		if found {
+			if to, err = strconv.Atoi(last); err != nil {
+				continue
+			}
+		}
+		for i := from; i <= to; i++ {
+			indexes[i] = true
+		}
+	}
+
+	return indexes
+}
+
+// startReportMerge creates the Job merging the blob reports of the shards of a finished
+// run into its HTML report, in the image of the run, which has Playwright. The merged
+// report is written where the dashboard serves reports by the UID of the run.
+func startReportMerge(ctx context.Context, clientset *kubernetes.Clientset, run *batchv1.Job) error {
+	podSpec := run.Spec.Template.Spec
+	var image, workingDir string
+	for _, c := range podSpec.Containers {
+		if c.Name == runContainer {
+			image, workingDir = c.Image, c.WorkingDir
+		}
+	}
+	if image == "" {
+		return fmt.Errorf("run has no playwright container")
+	}
+
+	labels := spawnedLabels(run, map[string]string{mergeRunLabel: string(run.UID)})
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "playwright-merge-",
+			Namespace:    run.Namespace,
+			Labels:       labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            ptr.To[int32](1),
+			TTLSecondsAfterFinished: ptr.To[int32](3600),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: copyLabels(labels)},
+				Spec: corev1.PodSpec{
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: podSpec.ServiceAccountName,
+					ImagePullSecrets:   podSpec.ImagePullSecrets,
+					Containers: []corev1.Container{
+						{
+							Name:       "merge",
+							Image:      image,
+							WorkingDir: workingDir,
+							Command:    []string{"sh", "-c", mergeReportsScript, "sh", resultsMountPath + "/checkpoints/" + string(run.UID) + "/blobs"},
+							Env: []corev1.EnvVar{
+								{Name: "PLAYWRIGHT_HTML_OPEN", Value: "never"},
+								{Name: "PLAYWRIGHT_HTML_OUTPUT_DIR", Value: resultsMountPath + "/" + string(run.UID) + "/"},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: resultsVolumeName, MountPath: resultsMountPath},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: resultsVolumeName,
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: resultsClaimName,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	created, err := clientset.BatchV1().Jobs(run.Namespace).Create(ctx, job, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("starting report merge: %w", err)
+	}
+	log.Printf("started report merge %s/%s for run %s/%s", created.Namespace, created.Name, run.Namespace, run.Name)
+
+	return nil
+}
+
+// mergeShardReports starts the report merges of finished sharded runs and drops their
+// report merge label.
+func mergeShardReports(ctx context.Context, clientset *kubernetes.Clientset, informers *runInformers, namespace string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		jobs, err := informers.runs(ctx, namespace, reportMergeLabel+"="+reportMergePending)
+		if err != nil {
+			log.Printf("cannot list runs waiting for a report merge: %v", err)
+			continue
+		}
+
+		for i := range jobs {
+			job := &jobs[i]
+			if state := jobState(job); state != jobStateSucceeded && state != jobStateFailed && state != jobStateCancelled {
+				continue
+			}
+
+			if err := startReportMerge(ctx, clientset, job); err != nil {
+				log.Printf("cannot merge reports of run %s/%s: %v", job.Namespace, job.Name, err)
+				continue
+			}
+
+			patch, _ := json.Marshal(map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": map[string]interface{}{reportMergeLabel: nil},
+				},
+			})
+			if _, err := clientset.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+				log.Printf("cannot label run %s/%s: %v", job.Namespace, job.Name, err)
+			}
+		}
+	}
+}
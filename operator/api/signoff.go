@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// signOffAnnotation holds the SignOff of a signed off run, as JSON. The digests of its
+// report files are kept in the results volume, in sha256sum format so they can be checked
+// with it, see signOffListing.
+const signOffAnnotation = "playwright.operator/signoff"
+
+// SignOffStatement is what a sign-off attests, the signature covers its JSON encoding.
+type SignOffStatement struct {
+	Run RunRef `json:"run"`
+	// Outcome is the state of the run when it was signed off.
+	Outcome string `json:"outcome"`
+	By      string `json:"by"`
+	// Subject is the subject of the token the sign-off was requested with, empty without
+	// authentication.
+	Subject string    `json:"subject,omitempty"`
+	Comment string    `json:"comment,omitempty"`
+	Time    time.Time `json:"time"`
+	// Archive is the SHA-256 digest of the listing of the digests of the report files.
+	Archive string `json:"archive"`
+	Files   int    `json:"files"`
+}
+
+// SignOff is a signed statement. Digest is the SHA-256 digest of the statement, Signature
+// its Ed25519 signature with the key KeyID, both empty without SIGNOFF_KEY.
+type SignOff struct {
+	SignOffStatement
+	Digest    string `json:"digest"`
+	Signature string `json:"signature,omitempty"`
+	KeyID     string `json:"keyId,omitempty"`
+}
+
+// SignOffVerification compares a sign-off with the run and its report files now.
+type SignOffVerification struct {
+	SignOff  *SignOff `json:"signOff"`
+	Valid    bool     `json:"valid"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+type SignOffRequest struct {
+	By      string `json:"by"`
+	Comment string `json:"comment"`
+}
+
+// SignOffKey is the public key sign-offs are verified with.
+type SignOffKey struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"keyId"`
+	PublicKey string `json:"publicKey"`
+}
+
+func isSignedOff(job *batchv1.Job) bool {
+	return job.Annotations[signOffAnnotation] != ""
+}
+
+func storedSignOff(job *batchv1.Job) *SignOff {
+	data := job.Annotations[signOffAnnotation]
+	if data == "" {
+		return nil
+	}
+
+	var signOff SignOff
+	if err := json.Unmarshal([]byte(data), &signOff); err != nil {
+		return nil
+	}
+
+	return &signOff
+}
+
+// signOffKey reads the Ed25519 key of SIGNOFF_KEY. Sign-offs are not signed without.
+func signOffKey() (ed25519.PrivateKey, error) {
+	return seedKey("SIGNOFF_KEY")
+}
+
+// seedKey reads an Ed25519 key from a variable holding a base64 encoded 32 byte seed, e.g.
+// from openssl rand -base64 32, nil if it is not set.
+func seedKey(name string) (ed25519.PrivateKey, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%s must be a base64 encoded 32 byte seed", name)
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// keyID names a public key by its SHA-256 digest, so verifiers pick the right one after
+// the key was rotated.
+func keyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// signOffListing is where the digests of the report files of a signed off run are kept.
+func signOffListing(uid types.UID) string {
+	return filepath.Join(resultsDir, "signoffs", string(uid)+".sha256")
+}
+
+// reportDigests returns the SHA-256 digests of the report files of a run, the merged
+// report of sharded runs and the report of each pod, by their path in the results volume.
+func reportDigests(job *batchv1.Job, podUIDs []types.UID) (map[string]string, error) {
+	digests := map[string]string{}
+	for _, uid := range append([]types.UID{job.UID}, podUIDs...) {
+		err := filepath.WalkDir(filepath.Join(resultsDir, string(uid)), func(path string, d fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil || d.IsDir() {
+				return err
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			h := sha256.New()
+			if _, err := io.Copy(h, f); err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(resultsDir, path)
+			if err != nil {
+				return err
+			}
+			digests[filepath.ToSlash(rel)] = hex.EncodeToString(h.Sum(nil))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return digests, nil
+}
+
+// formatListing writes digests as sha256sum does, sorted by path.
+func formatListing(digests map[string]string) []byte {
+	paths := make([]string, 0, len(digests))
+	for path := range digests {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&b, "%s  %s\n", digests[path], path)
+	}
+
+	return []byte(b.String())
+}
+
+func parseListing(data []byte) map[string]string {
+	digests := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		if sum, path, ok := strings.Cut(scanner.Text(), "  "); ok {
+			digests[path] = sum
+		}
+	}
+
+	return digests
+}
+
+// POST /runs/{id}/signoff?namespace=ns with {"by": "...", "comment": "..."}
+//
+// signOffRun freezes a finished run: it is pinned for good, the digests of its report
+// files are stored and a statement of who signed off what is signed and recorded on the
+// run. With authentication, the signer is the user of the token, by is ignored, and
+// SIGNOFF_GROUPS restricts who may sign off.
+func signOffRun(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	var req SignOffRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	statement := SignOffStatement{By: requestUser(r, req.By), Comment: req.Comment, Time: time.Now().UTC()}
+	if claims := requestClaims(r); claims != nil {
+		cfg := authConfigFromEnv()
+		if groups := splitList(os.Getenv("SIGNOFF_GROUPS")); len(groups) > 0 && !cfg.memberOf(claims, groups) {
+			writeError(w, "none of the groups or roles of the token may sign off runs", http.StatusForbidden)
+			return
+		}
+		statement.Subject, _ = claims["sub"].(string)
+	}
+	if statement.By == "" {
+		writeError(w, "who signs off is required", http.StatusBadRequest)
+		return
+	}
+
+	key, err := signOffKey()
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	job, err := findRun(r.Context(), clientset, getNamespace(r.URL.Query().Get("namespace")), r.PathValue("id"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if job == nil {
+		writeError(w, "run not found", http.StatusNotFound)
+		return
+	}
+	if signOff := storedSignOff(job); signOff != nil {
+		writeError(w, fmt.Sprintf("the run was signed off by %s at %s", signOff.By, signOff.Time.Format(time.RFC3339)), http.StatusConflict)
+		return
+	}
+	statement.Outcome = jobState(job)
+	if statement.Outcome != jobStateSucceeded && statement.Outcome != jobStateFailed {
+		writeError(w, "only finished runs can be signed off", http.StatusConflict)
+		return
+	}
+	statement.Run = RunRef{Namespace: job.Namespace, Name: job.Name, UID: string(job.UID)}
+
+	podUIDs, err := runPodUIDs(r.Context(), clientset, job)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	digests, err := reportDigests(job, podUIDs)
+	if err != nil {
+		writeError(w, "cannot read the report files: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	listing := formatListing(digests)
+	if err := os.MkdirAll(filepath.Dir(signOffListing(job.UID)), 0o755); err != nil {
+		respondError(w, err)
+		return
+	}
+	if err := os.WriteFile(signOffListing(job.UID), listing, 0o644); err != nil {
+		writeError(w, "cannot store the report digests: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	archive := sha256.Sum256(listing)
+	statement.Archive = hex.EncodeToString(archive[:])
+	statement.Files = len(digests)
+
+	signOff, err := signStatement(statement, key)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	data, err := json.Marshal(signOff)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	patch := map[string]interface{}{"metadata": map[string]interface{}{"annotations": map[string]interface{}{}}}
+	if !isPinned(job) {
+		if patch, err = pinPatch(job, PinEvent{Action: "pin", By: statement.By, Reason: "sign-off", Time: statement.Time}); err != nil {
+			respondError(w, err)
+			return
+		}
+	}
+	patch["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})[signOffAnnotation] = string(data)
+	body, _ := json.Marshal(patch)
+	if _, err := clientset.BatchV1().Jobs(job.Namespace).Patch(r.Context(), job.Name, types.MergePatchType, body, metav1.PatchOptions{}); err != nil {
+		respondError(w, fmt.Errorf("cannot record the sign-off: %w", err))
+		return
+	}
+	log.Printf("run %s/%s signed off by %s", job.Namespace, job.Name, statement.By)
+
+	respondJSONStatus(w, http.StatusCreated, signOff)
+}
+
+func signStatement(statement SignOffStatement, key ed25519.PrivateKey) (*SignOff, error) {
+	data, err := json.Marshal(statement)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(data)
+
+	signOff := &SignOff{SignOffStatement: statement, Digest: hex.EncodeToString(digest[:])}
+	if key != nil {
+		signOff.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+		signOff.KeyID = keyID(key.Public().(ed25519.PublicKey))
+	}
+
+	return signOff, nil
+}
+
+// verifySignOff checks the signature of a sign-off and the report files of its run
+// against the stored digests.
+func verifySignOff(job *batchv1.Job, podUIDs []types.UID, signOff *SignOff, key ed25519.PrivateKey) []string {
+	var problems []string
+
+	data, _ := json.Marshal(signOff.SignOffStatement)
+	if digest := sha256.Sum256(data); hex.EncodeToString(digest[:]) != signOff.Digest {
+		problems = append(problems, "the statement does not match its digest")
+	}
+	switch {
+	case signOff.Signature == "":
+		problems = append(problems, "the sign-off is not signed")
+	case key == nil || keyID(key.Public().(ed25519.PublicKey)) != signOff.KeyID:
+		problems = append(problems, fmt.Sprintf("the sign-off was signed with key %s, which is not configured", signOff.KeyID))
+	default:
+		signature, err := base64.StdEncoding.DecodeString(signOff.Signature)
+		if err != nil || !ed25519.Verify(key.Public().(ed25519.PublicKey), data, signature) {
+			problems = append(problems, "the signature is invalid")
+		}
+	}
+
+	listing, err := os.ReadFile(signOffListing(job.UID))
+	if err != nil {
+		return append(problems, "the report digests cannot be read: "+err.Error())
+	}
+	if archive := sha256.Sum256(listing); hex.EncodeToString(archive[:]) != signOff.Archive {
+		problems = append(problems, "the stored report digests were changed")
+	}
+	digests, err := reportDigests(job, podUIDs)
+	if err != nil {
+		return append(problems, "the report files cannot be read: "+err.Error())
+	}
+	signed := parseListing(listing)
+	var changed []string
+	for path, sum := range signed {
+		if digests[path] != sum {
+			changed = append(changed, path)
+		}
+	}
+	for path := range digests {
+		if _, ok := signed[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	for _, path := range changed {
+		problems = append(problems, "changed since the sign-off: "+path)
+	}
+
+	return problems
+}
+
+// GET /runs/{id}/signoff?namespace=ns
+func getSignOff(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	job, err := findRun(r.Context(), clientset, getNamespace(r.URL.Query().Get("namespace")), r.PathValue("id"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if job == nil {
+		writeError(w, "run not found", http.StatusNotFound)
+		return
+	}
+	signOff := storedSignOff(job)
+	if signOff == nil {
+		writeError(w, "the run was not signed off", http.StatusNotFound)
+		return
+	}
+
+	key, err := signOffKey()
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	podUIDs, err := runPodUIDs(r.Context(), clientset, job)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	problems := verifySignOff(job, podUIDs, signOff, key)
+	respondJSON(w, SignOffVerification{SignOff: signOff, Valid: len(problems) == 0, Problems: problems})
+}
+
+// GET /signoff/key
+func getSignOffKey(w http.ResponseWriter, r *http.Request) {
+	key, err := signOffKey()
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if key == nil {
+		writeError(w, "sign-offs are not signed, SIGNOFF_KEY is not set", http.StatusNotFound)
+		return
+	}
+
+	public := key.Public().(ed25519.PublicKey)
+	respondJSON(w, SignOffKey{Algorithm: "Ed25519", KeyID: keyID(public), PublicKey: base64.StdEncoding.EncodeToString(public)})
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Smoke runs labeled with an environment measure its availability. Their failures are
+// classified once they finish, and only environment errors count against the SLO.
+const (
+	environmentLabel       = "playwright.operator/environment"
+	failureClassAnnotation = "playwright.operator/failure-class"
+)
+
+const (
+	failureClassEnvironment    = "environment"
+	failureClassTest           = "test"
+	failureClassInfrastructure = "infrastructure"
+)
+
+// environmentErrors match Playwright and Node.js output of an unreachable or broken
+// environment, as opposed to assertion failures of the tests.
+var environmentErrors = regexp.MustCompile(`net::ERR_(CONNECTION_REFUSED|CONNECTION_RESET|CONNECTION_TIMED_OUT|NAME_NOT_RESOLVED|ADDRESS_UNREACHABLE|CERT_[A-Z_]+|SSL_[A-Z_]+)` +
+	`|ECONNREFUSED|ECONNRESET|ENOTFOUND|EAI_AGAIN` +
+	`|\b(502 Bad Gateway|503 Service Unavailable|504 Gateway Time-?out)\b` +
+	`|page\.goto: Timeout \d+ms exceeded`)
+
+// SLOReport is the availability of an environment over a window, as seen by its smoke runs.
+type SLOReport struct {
+	Environment string  `json:"environment"`
+	Objective   float64 `json:"objective"`
+	Window      string  `json:"window"`
+	Runs        int     `json:"runs"`
+	// EnvironmentErrors counts failed runs classified as environment errors.
+	EnvironmentErrors int `json:"environmentErrors"`
+	// Unclassified counts failed runs whose classification is still pending.
+	Unclassified int     `json:"unclassified"`
+	Availability float64 `json:"availability"`
+	// BudgetRemaining is the share of the error budget left, negative once overspent.
+	BudgetRemaining float64 `json:"budgetRemaining"`
+	Exhausted       bool    `json:"exhausted"`
+	// BurnRate maps windows to how fast the budget is spent, 1 spends exactly the budget.
+	BurnRate map[string]float64 `json:"burnRate"`
+}
+
+func sloObjective(v string) (float64, error) {
+	if v == "" {
+		v = envOrDefault("SLO_OBJECTIVE", "0.99")
+	}
+
+	objective, err := strconv.ParseFloat(v, 64)
+	if err != nil || objective <= 0 || objective >= 1 {
+		return 0, fmt.Errorf("objective must be between 0 and 1, exclusive")
+	}
+
+	return objective, nil
+}
+
+func sloWindow(v string) (string, time.Duration, error) {
+	if v == "" {
+		v = envOrDefault("SLO_WINDOW", "30d")
+	}
+
+	d, err := parseWindow(v)
+	if err != nil || d == 0 {
+		return "", 0, fmt.Errorf("invalid window %q", v)
+	}
+
+	return v, d, nil
+}
+
+func environmentError(job *batchv1.Job) bool {
+	return jobState(job) == jobStateFailed && job.Annotations[failureClassAnnotation] == failureClassEnvironment
+}
+
+func errorRate(jobs []batchv1.Job, since time.Time) float64 {
+	var runs, errors int
+	for i := range jobs {
+		if jobs[i].CreationTimestamp.Time.Before(since) {
+			continue
+		}
+		runs++
+		if environmentError(&jobs[i]) {
+			errors++
+		}
+	}
+	if runs == 0 {
+		return 0
+	}
+
+	return float64(errors) / float64(runs)
+}
+
+// computeSLO evaluates the finished smoke runs of one environment.
+func computeSLO(environment string, jobs []batchv1.Job, objective float64, window string, d time.Duration, now time.Time) SLOReport {
+	report := SLOReport{Environment: environment, Objective: objective, Window: window, Availability: 1, BudgetRemaining: 1}
+
+	jobs = filterJobsByTime(finishedRuns(jobs), now.Add(-d), time.Time{})
+	for i := range jobs {
+		report.Runs++
+		if environmentError(&jobs[i]) {
+			report.EnvironmentErrors++
+		} else if jobState(&jobs[i]) == jobStateFailed && jobs[i].Annotations[failureClassAnnotation] == "" {
+			report.Unclassified++
+		}
+	}
+
+	if report.Runs > 0 {
+		rate := float64(report.EnvironmentErrors) / float64(report.Runs)
+		report.Availability = 1 - rate
+		report.BudgetRemaining = 1 - rate/(1-objective)
+		report.Exhausted = report.BudgetRemaining <= 0
+	}
+
+	report.BurnRate = map[string]float64{
+		"1h":   errorRate(jobs, now.Add(-time.Hour)) / (1 - objective),
+		"6h":   errorRate(jobs, now.Add(-6*time.Hour)) / (1 - objective),
+		window: errorRate(jobs, now.Add(-d)) / (1 - objective),
+	}
+
+	return report
+}
+
+// environmentSLOs reports every environment with smoke runs in a namespace, by name.
+func environmentSLOs(ctx context.Context, clientset *kubernetes.Clientset, namespace string, objective float64, window string, d time.Duration) ([]SLOReport, error) {
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{LabelSelector: environmentLabel})
+	if err != nil {
+		return nil, err
+	}
+
+	byEnvironment := map[string][]batchv1.Job{}
+	for _, job := range jobs.Items {
+		env := job.Labels[environmentLabel]
+		byEnvironment[env] = append(byEnvironment[env], job)
+	}
+
+	now := time.Now()
+	reports := []SLOReport{}
+	for env, runs := range byEnvironment {
+		reports = append(reports, computeSLO(env, runs, objective, window, d, now))
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Environment < reports[j].Environment
+	})
+
+	return reports, nil
+}
+
+// GET /slo?namespace=ns&window=30d&objective=0.99 and GET /slo/{environment}
+func sloHandler(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	query := r.URL.Query()
+
+	objective, err := sloObjective(query.Get("objective"))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	window, d, err := sloWindow(query.Get("window"))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reports, err := environmentSLOs(r.Context(), clientset, getNamespace(query.Get("namespace")), objective, window, d)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	env := r.PathValue("environment")
+	if env == "" {
+		respondJSON(w, reports)
+		return
+	}
+	for _, report := range reports {
+		if report.Environment == env {
+			respondJSON(w, report)
+			return
+		}
+	}
+
+	writeError(w, "no smoke runs for environment "+env, http.StatusNotFound)
+}
+
+// classifyFailure tells environment errors apart from test failures by the logs of the
+// run. Pods that never ran the tests properly are infrastructure failures.
+func classifyFailure(ctx context.Context, clientset *kubernetes.Clientset, job *batchv1.Job) (string, error) {
+	pods, err := clientset.CoreV1().Pods(job.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", job.Name),
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(imagePullErrors(pods.Items)) > 0 {
+		return failureClassInfrastructure, nil
+	}
+
+	tail := int64(500)
+	for _, pod := range pods.Items {
+		if pod.Status.Reason == "Evicted" {
+			return failureClassInfrastructure, nil
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if t := status.State.Terminated; t != nil && t.Reason == "OOMKilled" {
+				return failureClassInfrastructure, nil
+			}
+		}
+
+		stream, err := clientset.CoreV1().Pods(job.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{Container: runContainer, TailLines: &tail}).Stream(ctx)
+		if err != nil {
+			return "", err
+		}
+		logs, err := io.ReadAll(stream)
+		stream.Close()
+		if err != nil {
+			return "", err
+		}
+
+		if environmentErrors.Match(logs) {
+			return failureClassEnvironment, nil
+		}
+	}
+
+	return failureClassTest, nil
+}
+
+// trackSLOs classifies failed smoke runs and alerts once whenever the error budget of an
+// environment is exhausted, through the log and SLO_ALERT_WEBHOOK if set.
+func trackSLOs(ctx context.Context, clientset *kubernetes.Clientset, namespace string, interval time.Duration) {
+	exhausted := map[string]bool{}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{LabelSelector: environmentLabel})
+		if err != nil {
+			log.Printf("cannot list smoke runs: %v", err)
+			continue
+		}
+
+		for i := range jobs.Items {
+			job := &jobs.Items[i]
+			if jobState(job) != jobStateFailed || job.Annotations[failureClassAnnotation] != "" {
+				continue
+			}
+
+			class, err := classifyFailure(ctx, clientset, job)
+			if err != nil {
+				log.Printf("cannot classify failure of run %s/%s: %v", job.Namespace, job.Name, err)
+				continue
+			}
+
+			patch, _ := json.Marshal(map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{failureClassAnnotation: class},
+				},
+			})
+			if _, err := clientset.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+				log.Printf("cannot annotate run %s/%s: %v", job.Namespace, job.Name, err)
+			}
+		}
+
+		objective, err := sloObjective("")
+		if err != nil {
+			log.Printf("invalid SLO_OBJECTIVE: %v", err)
+			continue
+		}
+		window, d, err := sloWindow("")
+		if err != nil {
+			log.Printf("invalid SLO_WINDOW: %v", err)
+			continue
+		}
+
+		reports, err := environmentSLOs(ctx, clientset, namespace, objective, window, d)
+		if err != nil {
+			log.Printf("cannot evaluate SLOs: %v", err)
+			continue
+		}
+
+		for _, report := range reports {
+			if report.Exhausted == exhausted[report.Environment] {
+				continue
+			}
+			exhausted[report.Environment] = report.Exhausted
+
+			if report.Exhausted {
+				log.Printf("error budget of environment %s exhausted: availability %.4f below objective %.4f over %s",
+					report.Environment, report.Availability, report.Objective, report.Window)
+			} else {
+				log.Printf("error budget of environment %s recovered", report.Environment)
+			}
+			settings, err := effectiveSettings(ctx, clientset)
+			if err != nil {
+				log.Printf("cannot load settings: %v", err)
+			} else if settings.SLOAlertWebhook != "" {
+				notifyWebhook(ctx, settings, "slo", settings.SLOAlertWebhook, report)
+			}
+		}
+	}
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Soak runs carry soakLabel until they finish, their options are kept in soakAnnotation.
+// A run failed on a leak threshold is annotated with the violation.
+const (
+	soakLabel               = "playwright.operator/soak"
+	soakActive              = "active"
+	soakAnnotation          = "playwright.operator/soak"
+	soakViolationAnnotation = "playwright.operator/soak-violation"
+
+	minSoakInterval     = 10 * time.Second
+	defaultSoakInterval = time.Minute
+	defaultSoakWarmup   = 5 * time.Minute
+)
+
+// RunSoak marks an endurance run, which the API snapshots every Interval while it runs.
+// Durations use Go syntax, e.g. "30s".
+type RunSoak struct {
+	// Interval between snapshots, 1m by default.
+	Interval string `json:"interval,omitempty"`
+	// Warmup is left out of the memory growth, browsers and caches settle first. 5m by
+	// default.
+	Warmup string `json:"warmup,omitempty"`
+	// MaxMemory fails the run once a pod uses more memory, e.g. "2Gi".
+	MaxMemory string `json:"maxMemory,omitempty"`
+	// MaxMemoryGrowth fails the run once the memory of a pod grew by more than this many
+	// percent since the first snapshot after the warmup.
+	MaxMemoryGrowth float64 `json:"maxMemoryGrowth,omitempty"`
+}
+
+// SoakPodUsage is the usage of a pod of a soak run. Browser is the playwright container,
+// which runs the browsers and the test runner, the pod adds sidecars.
+type SoakPodUsage struct {
+	Pod                string `json:"pod"`
+	MemoryBytes        int64  `json:"memoryBytes"`
+	CPUMillicores      int64  `json:"cpuMillicores"`
+	BrowserMemoryBytes int64  `json:"browserMemoryBytes"`
+	BrowserCPU         int64  `json:"browserCpuMillicores"`
+}
+
+// SoakSnapshot is the health of a soak run at a time. Tests counts the tests that wrote
+// their output so far, which every test does with traces on.
+type SoakSnapshot struct {
+	Time  time.Time      `json:"time"`
+	Pods  []SoakPodUsage `json:"pods"`
+	Tests int            `json:"tests"`
+}
+
+// SoakReport are the snapshots of a soak run and why it failed on a threshold, if so.
+type SoakReport struct {
+	RunRef
+	Soak      RunSoak        `json:"soak"`
+	Snapshots []SoakSnapshot `json:"snapshots"`
+	Violation string         `json:"violation,omitempty"`
+}
+
+func soakDuration(v string, fallback time.Duration) (time.Duration, error) {
+	if v == "" {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid soak duration %q", v)
+	}
+
+	return d, nil
+}
+
+func (s *RunSoak) validate() error {
+	interval, err := soakDuration(s.Interval, defaultSoakInterval)
+	if err != nil {
+		return err
+	}
+	if interval < minSoakInterval {
+		return fmt.Errorf("soak interval must be at least %s", minSoakInterval)
+	}
+	if _, err := soakDuration(s.Warmup, defaultSoakWarmup); err != nil {
+		return err
+	}
+	if s.MaxMemory != "" {
+		if _, err := resource.ParseQuantity(s.MaxMemory); err != nil {
+			return fmt.Errorf("invalid soak maxMemory %q", s.MaxMemory)
+		}
+	}
+	if s.MaxMemoryGrowth < 0 {
+		return fmt.Errorf("soak maxMemoryGrowth must not be negative")
+	}
+
+	return nil
+}
+
+// addSoak marks a run for snapshots and keeps its options on the Job.
+func addSoak(job *batchv1.Job, soak *RunSoak) {
+	options, _ := json.Marshal(soak)
+	if job.Labels == nil {
+		job.Labels = map[string]string{}
+	}
+	job.Labels[soakLabel] = soakActive
+	if job.Annotations == nil {
+		job.Annotations = map[string]string{}
+	}
+	job.Annotations[soakAnnotation] = string(options)
+}
+
+// runSoak returns the soak options of a run, nil for other runs.
+func runSoak(job *batchv1.Job) *RunSoak {
+	v, ok := job.Annotations[soakAnnotation]
+	if !ok {
+		return nil
+	}
+
+	var soak RunSoak
+	if err := json.Unmarshal([]byte(v), &soak); err != nil {
+		return nil
+	}
+
+	return &soak
+}
+
+// soakSnapshotsFile keeps the snapshots of a run as JSON lines in the results volume.
+func soakSnapshotsFile(uid types.UID) string {
+	return filepath.Join(resultsDir, "soak", string(uid)+".jsonl")
+}
+
+func readSoakSnapshots(uid types.UID) ([]SoakSnapshot, error) {
+	f, err := os.Open(soakSnapshotsFile(uid))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []SoakSnapshot{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	snapshots := []SoakSnapshot{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var snapshot SoakSnapshot
+		if err := json.Unmarshal(scanner.Bytes(), &snapshot); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, scanner.Err()
+}
+
+func appendSoakSnapshot(uid types.UID, snapshot SoakSnapshot) error {
+	line, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(soakSnapshotsFile(uid)), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(soakSnapshotsFile(uid), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// podMetrics is the part of the PodMetrics of the metrics API the snapshots read.
+type podMetrics struct {
+	Items []struct {
+		Metadata   metav1.ObjectMeta `json:"metadata"`
+		Containers []struct {
+			Name  string              `json:"name"`
+			Usage corev1.ResourceList `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+// runPodUsage reads the usage of the pods of a run from the metrics API, which
+// metrics-server provides.
+func runPodUsage(ctx context.Context, clientset *kubernetes.Clientset, job *batchv1.Job) ([]SoakPodUsage, error) {
+	data, err := clientset.CoreV1().RESTClient().Get().
+		AbsPath("/apis/metrics.k8s.io/v1beta1/namespaces", job.Namespace, "pods").
+		Param("labelSelector", batchv1.JobNameLabel+"="+job.Name).
+		DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading pod metrics: %w", err)
+	}
+
+	var metrics podMetrics
+	if err := json.Unmarshal(data, &metrics); err != nil {
+		return nil, err
+	}
+
+	usage := []SoakPodUsage{}
+	for _, item := range metrics.Items {
+		pod := SoakPodUsage{Pod: item.Metadata.Name}
+		for _, c := range item.Containers {
+			memory, cpu := c.Usage.Memory().Value(), c.Usage.Cpu().MilliValue()
+			pod.MemoryBytes += memory
+			pod.CPUMillicores += cpu
+			if c.Name == runContainer {
+				pod.BrowserMemoryBytes, pod.BrowserCPU = memory, cpu
+			}
+		}
+		usage = append(usage, pod)
+	}
+
+	return usage, nil
+}
+
+// testProgress counts the output directories of the tests in the checkpoint of a run,
+// below shard-N for sharded runs.
+func testProgress(job *batchv1.Job) int {
+	dir := filepath.Join(resultsDir, "checkpoints", string(job.UID))
+	entries, _ := os.ReadDir(dir)
+
+	tests := 0
+	for _, e := range entries {
+		switch {
+		case !e.IsDir() || e.Name() == "blobs":
+		case strings.HasPrefix(e.Name(), "shard-"):
+			shard, _ := os.ReadDir(filepath.Join(dir, e.Name()))
+			for _, s := range shard {
+				if s.IsDir() {
+					tests++
+				}
+			}
+		default:
+			tests++
+		}
+	}
+
+	return tests
+}
+
+// soakViolation checks the snapshots of a run against its leak thresholds.
+func soakViolation(soak *RunSoak, start time.Time, snapshots []SoakSnapshot) string {
+	if len(snapshots) == 0 {
+		return ""
+	}
+	latest := snapshots[len(snapshots)-1]
+
+	if soak.MaxMemory != "" {
+		limit := resource.MustParse(soak.MaxMemory)
+		for _, pod := range latest.Pods {
+			if pod.MemoryBytes > limit.Value() {
+				return fmt.Sprintf("pod %s uses %s of memory, the limit is %s",
+					pod.Pod, resource.NewQuantity(pod.MemoryBytes, resource.BinarySI), soak.MaxMemory)
+			}
+		}
+	}
+
+	if soak.MaxMemoryGrowth > 0 {
+		warmup, _ := soakDuration(soak.Warmup, defaultSoakWarmup)
+		baseline := map[string]int64{}
+		for _, snapshot := range snapshots {
+			if snapshot.Time.Before(start.Add(warmup)) {
+				continue
+			}
+			for _, pod := range snapshot.Pods {
+				if _, ok := baseline[pod.Pod]; !ok && pod.MemoryBytes > 0 {
+					baseline[pod.Pod] = pod.MemoryBytes
+				}
+			}
+		}
+		for _, pod := range latest.Pods {
+			base, ok := baseline[pod.Pod]
+			if !ok {
+				continue
+			}
+			if growth := float64(pod.MemoryBytes-base) / float64(base) * 100; growth > soak.MaxMemoryGrowth {
+				return fmt.Sprintf("memory of pod %s grew by %.0f%% since the warmup, the limit is %g%%",
+					pod.Pod, growth, soak.MaxMemoryGrowth)
+			}
+		}
+	}
+
+	return ""
+}
+
+// failSoakRun fails a run that broke a leak threshold by an elapsed deadline, like
+// cancelSuperseded does, so its pods are terminated and it stays in the history.
+func failSoakRun(ctx context.Context, clientset *kubernetes.Clientset, job *batchv1.Job, violation string) error {
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{soakViolationAnnotation: violation},
+		},
+		"spec": map[string]interface{}{
+			"activeDeadlineSeconds": 1,
+		},
+	})
+	_, err := clientset.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+
+	return err
+}
+
+// snapshotSoakRuns takes the snapshots of the active soak runs when their interval is up,
+// fails runs that broke a leak threshold and drops the label of finished runs.
+func snapshotSoakRuns(ctx context.Context, clientset *kubernetes.Clientset, informers *runInformers, namespace string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	taken := map[types.UID]time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		jobs, err := informers.runs(ctx, namespace, soakLabel+"="+soakActive)
+		if err != nil {
+			log.Printf("cannot list soak runs: %v", err)
+			continue
+		}
+
+		active := map[types.UID]time.Time{}
+		for i := range jobs {
+			job := &jobs[i]
+			soak := runSoak(job)
+			state := jobState(job)
+			if soak == nil || (state != jobStateRunning && state != jobStateSuspended) {
+				finishSoakRun(ctx, clientset, job)
+				continue
+			}
+
+			active[job.UID] = taken[job.UID]
+			if state != jobStateRunning || job.Status.StartTime == nil {
+				continue
+			}
+			every, _ := soakDuration(soak.Interval, defaultSoakInterval)
+			if time.Since(taken[job.UID]) < every {
+				continue
+			}
+
+			usage, err := runPodUsage(ctx, clientset, job)
+			if err != nil {
+				log.Printf("cannot snapshot soak run %s/%s: %v", job.Namespace, job.Name, err)
+				continue
+			}
+			snapshot := SoakSnapshot{Time: time.Now().UTC(), Pods: usage, Tests: testProgress(job)}
+			if err := appendSoakSnapshot(job.UID, snapshot); err != nil {
+				log.Printf("cannot store snapshot of soak run %s/%s: %v", job.Namespace, job.Name, err)
+				continue
+			}
+			active[job.UID] = snapshot.Time
+
+			snapshots, err := readSoakSnapshots(job.UID)
+			if err != nil {
+				log.Printf("cannot read snapshots of soak run %s/%s: %v", job.Namespace, job.Name, err)
+				continue
+			}
+			if violation := soakViolation(soak, job.Status.StartTime.Time, snapshots); violation != "" {
+				if err := failSoakRun(ctx, clientset, job, violation); err != nil {
+					log.Printf("cannot fail soak run %s/%s: %v", job.Namespace, job.Name, err)
+					continue
+				}
+				log.Printf("soak run %s/%s failed: %s", job.Namespace, job.Name, violation)
+			}
+		}
+		taken = active
+	}
+}
+
+// finishSoakRun drops the label of a soak run that is no longer running, its snapshots
+// stay.
+func finishSoakRun(ctx context.Context, clientset *kubernetes.Clientset, job *batchv1.Job) {
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{soakLabel: nil},
+		},
+	})
+	if _, err := clientset.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		log.Printf("cannot label soak run %s/%s: %v", job.Namespace, job.Name, err)
+	}
+}
+
+// GET /runs/{id}/soak?namespace=ns returns the snapshots of a soak run, by Job UID or
+// name.
+func getSoakReport(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	job, err := findRun(r.Context(), clientset, getNamespace(r.URL.Query().Get("namespace")), r.PathValue("id"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if job == nil {
+		writeError(w, "run not found", http.StatusNotFound)
+		return
+	}
+	soak := runSoak(job)
+	if soak == nil {
+		writeError(w, "the run is no soak run", http.StatusNotFound)
+		return
+	}
+
+	snapshots, err := readSoakSnapshots(job.UID)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, SoakReport{
+		RunRef:    RunRef{Namespace: job.Namespace, Name: job.Name, UID: string(job.UID)},
+		Soak:      *soak,
+		Snapshots: snapshots,
+		Violation: job.Annotations[soakViolationAnnotation],
+	})
+}
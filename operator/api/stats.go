@@ -0,0 +1,194 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+type StatusCounts struct {
+	Active    int `json:"active"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Cancelled int `json:"cancelled"`
+	// Suppressed counts the failed runs whose failed tests are all suppressed, warnings
+	// rather than failures.
+	Suppressed int `json:"suppressed"`
+}
+
+type StatusGroup struct {
+	Key    string       `json:"key"`
+	Counts StatusCounts `json:"counts"`
+}
+
+type StatusStatsResponse struct {
+	Namespace string        `json:"namespace"`
+	Window    string        `json:"window,omitempty"`
+	Total     StatusCounts  `json:"total"`
+	GroupBy   string        `json:"groupBy,omitempty"`
+	Groups    []StatusGroup `json:"groups,omitempty"`
+}
+
+func (c *StatusCounts) add(job *batchv1.Job, rules []SuppressionRule) {
+	switch runOutcome(job, rules) {
+	case jobStateSucceeded:
+		c.Succeeded++
+	case jobStateFailed:
+		c.Failed++
+	case runStateSuppressed:
+		c.Suppressed++
+	case jobStateCancelled:
+		c.Cancelled++
+	default:
+		c.Active++
+	}
+}
+
+// groupLabel maps the groupBy parameter to the label jobs are grouped by:
+// "suite" for the suite label, "platform" for the platform label or "label:<key>" for
+// any label.
+func groupLabel(groupBy string) (string, bool) {
+	if groupBy == "suite" {
+		return suiteLabel, true
+	}
+	if groupBy == "platform" {
+		return platformLabel, true
+	}
+	if key, ok := strings.CutPrefix(groupBy, "label:"); ok && key != "" {
+		return key, true
+	}
+
+	return "", false
+}
+
+// runStateSuppressed is the outcome of failed runs whose failed tests are all suppressed.
+const runStateSuppressed = "suppressed"
+
+// runOutcome is the state of a run in rollups, where failed runs whose failed tests are
+// all suppressed are warnings.
+func runOutcome(job *batchv1.Job, rules []SuppressionRule) string {
+	state := jobState(job)
+	if state == jobStateFailed && suppressionFor(rules, job).suppressed() {
+		return runStateSuppressed
+	}
+
+	return state
+}
+
+// GET /stats/status?namespace=ns&window=24h&groupBy=suite|platform|label:<key>
+func statusStats(w http.ResponseWriter, r *http.Request, informers *runInformers) {
+	query := r.URL.Query()
+	namespace := getNamespace(query.Get("namespace"))
+
+	var since time.Time
+	if v := query.Get("window"); v != "" {
+		d, err := parseWindow(v)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		since = time.Now().Add(-d)
+	}
+
+	groupBy := query.Get("groupBy")
+	label, ok := groupLabel(groupBy)
+	if groupBy != "" && !ok {
+		writeError(w, "groupBy must be suite, platform or label:<key>", http.StatusBadRequest)
+		return
+	}
+
+	ni, err := informers.synced(r.Context(), namespace)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	jobs := informers.jobs.list(namespace, jobQuery{since: since})
+
+	rules, err := cachedSuppressions(r.Context(), informers, namespace)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	resp := StatusStatsResponse{Namespace: namespace, Window: query.Get("window"), GroupBy: groupBy}
+	groups := map[string]*StatusCounts{}
+	for _, job := range jobs {
+		resp.Total.add(&job, rules)
+
+		if label != "" {
+			key := job.Labels[label]
+			if groups[key] == nil {
+				groups[key] = &StatusCounts{}
+			}
+			groups[key].add(&job, rules)
+		}
+	}
+
+	for key, counts := range groups {
+		resp.Groups = append(resp.Groups, StatusGroup{Key: key, Counts: *counts})
+	}
+	sort.Slice(resp.Groups, func(i, j int) bool {
+		return resp.Groups[i].Key < resp.Groups[j].Key
+	})
+
+	ni.setFreshness(w)
+	respondJSON(w, resp)
+}
+
+type RunOutcome struct {
+	Run string `json:"run"`
+	// State is that of the run, or suppressed for failed runs whose failed tests are all
+	// suppressed.
+	State string `json:"state"`
+}
+
+type SuiteOutcomesResponse struct {
+	Namespace string `json:"namespace"`
+	// Suites maps suite names to their last finished runs, oldest first.
+	Suites map[string][]RunOutcome `json:"suites"`
+}
+
+// GET /stats/outcomes?namespace=ns&limit=10
+func suiteOutcomes(w http.ResponseWriter, r *http.Request, informers *runInformers) {
+	query := r.URL.Query()
+	namespace := getNamespace(query.Get("namespace"))
+
+	limit := 10
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			writeError(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	jobs, err := informers.runs(r.Context(), namespace, suiteLabel)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	rules, err := cachedSuppressions(r.Context(), informers, namespace)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	resp := SuiteOutcomesResponse{Namespace: namespace, Suites: map[string][]RunOutcome{}}
+	for _, run := range finishedRuns(jobs) {
+		suite := run.Labels[suiteLabel]
+		if len(resp.Suites[suite]) < limit {
+			resp.Suites[suite] = append(resp.Suites[suite], RunOutcome{Run: run.Name, State: runOutcome(&run, rules)})
+		}
+	}
+	for _, outcomes := range resp.Suites {
+		slices.Reverse(outcomes)
+	}
+
+	respondJSON(w, resp)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	jobStateRunning   = "running"
+	jobStateSucceeded = "succeeded"
+	jobStateFailed    = "failed"
+	jobStateSuspended = "suspended"
+	// jobStateCancelled runs failed because a newer run superseded them.
+	jobStateCancelled = "cancelled"
+)
+
+// jobState derives the state of a run from the Job conditions.
+func jobState(job *batchv1.Job) string {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+
+		switch c.Type {
+		case batchv1.JobComplete:
+			return jobStateSucceeded
+		case batchv1.JobFailed:
+			if job.Annotations[supersededByAnnotation] != "" {
+				return jobStateCancelled
+			}
+			return jobStateFailed
+		case batchv1.JobSuspended:
+			return jobStateSuspended
+		}
+	}
+
+	return jobStateRunning
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Runs belong to a suite, and optionally a branch, through these Job labels.
+const (
+	suiteLabel  = "playwright.operator/suite"
+	branchLabel = "playwright.operator/branch"
+	ownerLabel  = "playwright.operator/owner"
+)
+
+// listSuiteRuns returns the runs of a suite, newest first. An empty branch matches all branches.
+func listSuiteRuns(ctx context.Context, informers *runInformers, namespace, suite, branch string) ([]batchv1.Job, error) {
+	selector := labels.Set{suiteLabel: suite}
+	if branch != "" {
+		selector[branchLabel] = branch
+	}
+
+	return informers.runs(ctx, namespace, selector.String())
+}
+
+// finishedRuns filters runs that succeeded or failed, keeping their order.
+func finishedRuns(runs []batchv1.Job) []batchv1.Job {
+	var finished []batchv1.Job
+	for _, run := range runs {
+		if state := jobState(&run); state == jobStateSucceeded || state == jobStateFailed {
+			finished = append(finished, run)
+		}
+	}
+
+	return finished
+}
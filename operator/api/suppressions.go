@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	suppressionConfigMap = "playwright-suppressions"
+	suppressionKey       = "suppressions.json"
+)
+
+// SuppressionRule downgrades matching failures to warnings until it expires. The pattern
+// is a regular expression matched against the titles of failed tests, with their
+// describe blocks separated by " › ", e.g. "checkout › pays with PayPal".
+type SuppressionRule struct {
+	ID string `json:"id"`
+	// Namespace is the namespace of the rule, filled in when it is loaded.
+	Namespace string    `json:"namespace,omitempty"`
+	Pattern   string    `json:"pattern"`
+	Reason    string    `json:"reason"`
+	Expires   time.Time `json:"expires"`
+	By        string    `json:"by,omitempty"`
+	Created   time.Time `json:"created"`
+	Expired   bool      `json:"expired"`
+}
+
+func (rule *SuppressionRule) active(now time.Time) bool {
+	return now.Before(rule.Expires)
+}
+
+// matches reports whether the rule applies to a test. Invalid patterns are rejected when
+// the rule is created, so they never match.
+func (rule *SuppressionRule) matches(spec SpecResult) bool {
+	re, err := regexp.Compile(rule.Pattern)
+	if err != nil {
+		return false
+	}
+
+	return re.MatchString(spec.Title)
+}
+
+// loadSuppressions reads the rules of a namespace from the API server, along with their
+// ConfigMap to update them. Reads without updates take cachedSuppressions.
+func loadSuppressions(ctx context.Context, clientset *kubernetes.Clientset, namespace string) (*corev1.ConfigMap, []SuppressionRule, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, suppressionConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: suppressionConfigMap, Namespace: namespace}}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	rules, err := decodeSuppressions(cm, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cm, rules, nil
+}
+
+// cachedSuppressions reads the rules of a namespace from the informer of their ConfigMap.
+func cachedSuppressions(ctx context.Context, informers *runInformers, namespace string) ([]SuppressionRule, error) {
+	ni, err := informers.synced(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok, err := ni.suppressions.GetStore().GetByKey(namespace + "/" + suppressionConfigMap)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return decodeSuppressions(obj.(*corev1.ConfigMap), namespace)
+}
+
+func decodeSuppressions(cm *corev1.ConfigMap, namespace string) ([]SuppressionRule, error) {
+	var rules []SuppressionRule
+	if data := cm.Data[suppressionKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &rules); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", suppressionConfigMap, err)
+		}
+	}
+
+	now := time.Now()
+	for i := range rules {
+		rules[i].Namespace = namespace
+		rules[i].Expired = !rules[i].active(now)
+	}
+
+	return rules, nil
+}
+
+func saveSuppressions(ctx context.Context, clientset *kubernetes.Clientset, cm *corev1.ConfigMap, rules []SuppressionRule) error {
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[suppressionKey] = string(data)
+
+	if cm.ResourceVersion == "" {
+		_, err = clientset.CoreV1().ConfigMaps(cm.Namespace).Create(ctx, cm, metav1.CreateOptions{})
+	} else {
+		_, err = clientset.CoreV1().ConfigMaps(cm.Namespace).Update(ctx, cm, metav1.UpdateOptions{})
+	}
+
+	return err
+}
+
+// RunSuppression are the failed tests of a run that active rules suppress. The failure
+// of the run is only downgraded to a warning when all of them are, see suppressed.
+type RunSuppression struct {
+	Tests []SuppressedTest `json:"tests"`
+	// Unsuppressed counts the failed tests no active rule matches, and failures outside
+	// of the tests, e.g. errors of the report or shards without one.
+	Unsuppressed int `json:"unsuppressed"`
+}
+
+// SuppressedTest is a failed test and the rule that suppresses it.
+type SuppressedTest struct {
+	File    string    `json:"file"`
+	Title   string    `json:"title"`
+	Rule    string    `json:"rule"`
+	Reason  string    `json:"reason"`
+	Expires time.Time `json:"expires"`
+}
+
+// suppressed tells whether every failure of the run is suppressed.
+func (s *RunSuppression) suppressed() bool {
+	return s != nil && len(s.Tests) > 0 && s.Unsuppressed == 0
+}
+
+// expires is when the first of the rules expires.
+func (s *RunSuppression) expires() time.Time {
+	expires := s.Tests[0].Expires
+	for _, test := range s.Tests {
+		if test.Expires.Before(expires) {
+			expires = test.Expires
+		}
+	}
+
+	return expires
+}
+
+// covers tells whether a rule suppresses a failed test of the run.
+func (s *RunSuppression) covers(test ComparedTest) bool {
+	if s == nil {
+		return false
+	}
+	for _, suppressed := range s.Tests {
+		if suppressed.File == test.File && suppressed.Title == test.Title {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reason joins the distinct reasons of the rules.
+func (s *RunSuppression) reason() string {
+	var reasons []string
+	seen := map[string]bool{}
+	for _, test := range s.Tests {
+		if !seen[test.Reason] {
+			seen[test.Reason] = true
+			reasons = append(reasons, test.Reason)
+		}
+	}
+
+	return strings.Join(reasons, "; ")
+}
+
+// suppressionFor matches the failed tests of a failed run, from its results, against the
+// active rules. It returns nil when the run did not fail, no rule is active or no test
+// is suppressed.
+func suppressionFor(rules []SuppressionRule, job *batchv1.Job) *RunSuppression {
+	if jobState(job) != jobStateFailed {
+		return nil
+	}
+	var active []SuppressionRule
+	for _, rule := range rules {
+		if !rule.Expired {
+			active = append(active, rule)
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+
+	results, err := runResults(job)
+	if err != nil {
+		log.Printf("cannot read the results of %s/%s for suppressions: %v", job.Namespace, job.Name, err)
+		return nil
+	}
+	if results == nil {
+		return nil
+	}
+
+	return suppressResults(active, results)
+}
+
+// suppressResults matches the failed tests of results against the active rules.
+func suppressResults(active []SuppressionRule, results *RunResults) *RunSuppression {
+	suppression := &RunSuppression{Unsuppressed: len(results.Errors) + len(results.MissingShards)}
+	failed := 0
+	for _, spec := range results.Specs {
+		if spec.Status != "failed" {
+			continue
+		}
+		failed++
+
+		matched := false
+		for _, rule := range active {
+			if rule.matches(spec) {
+				suppression.Tests = append(suppression.Tests, SuppressedTest{
+					File: spec.File, Title: spec.Title, Rule: rule.ID, Reason: rule.Reason, Expires: rule.Expires,
+				})
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			suppression.Unsuppressed++
+		}
+	}
+	// a run that failed without a failed test failed for another reason
+	if failed == 0 {
+		suppression.Unsuppressed++
+	}
+	if len(suppression.Tests) == 0 {
+		return nil
+	}
+
+	return suppression
+}
+
+// GET /suppressions?namespace=ns
+func listSuppressions(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	_, rules, err := loadSuppressions(r.Context(), clientset, getNamespace(r.URL.Query().Get("namespace")))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if rules == nil {
+		rules = []SuppressionRule{}
+	}
+
+	respondJSON(w, rules)
+}
+
+// GET /suppressions/expired lists the expired rules of all namespaces runs are listed in,
+// whose failures are reported again until the rules are renewed or removed.
+func listExpiredSuppressions(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	namespaces, err := runNamespaces.list(r.Context(), clientset)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	expired := []SuppressionRule{}
+	for _, namespace := range namespaces {
+		_, rules, err := loadSuppressions(r.Context(), clientset, namespace)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		for _, rule := range rules {
+			if rule.Expired {
+				expired = append(expired, rule)
+			}
+		}
+	}
+
+	respondJSON(w, expired)
+}
+
+// POST /suppressions?namespace=ns with {"pattern": "...", "reason": "...", "expires": "RFC3339", "by": "..."}
+func createSuppression(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+
+	var rule SuppressionRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := regexp.Compile(rule.Pattern); err != nil || rule.Pattern == "" {
+		writeError(w, "pattern must be a valid regular expression", http.StatusBadRequest)
+		return
+	}
+	if rule.Reason == "" {
+		writeError(w, "reason is required", http.StatusBadRequest)
+		return
+	}
+	if !rule.Expires.After(time.Now()) {
+		writeError(w, "expires must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	id, err := randomSuffix()
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	rule.ID = id
+	rule.Namespace = namespace
+	rule.By = requestUser(r, rule.By)
+	rule.Created = time.Now().UTC()
+	rule.Expired = false
+
+	if err := updateSuppressions(r.Context(), clientset, namespace, func(rules []SuppressionRule) []SuppressionRule {
+		return append(rules, rule)
+	}); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSONStatus(w, http.StatusCreated, rule)
+}
+
+// DELETE /suppressions/{id}?namespace=ns
+func deleteSuppression(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+	id := r.PathValue("id")
+
+	found := false
+	if err := updateSuppressions(r.Context(), clientset, namespace, func(rules []SuppressionRule) []SuppressionRule {
+		kept := rules[:0]
+		for _, rule := range rules {
+			if rule.ID == id {
+				found = true
+				continue
+			}
+			kept = append(kept, rule)
+		}
+		return kept
+	}); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	if !found {
+		writeError(w, "suppression not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// updateSuppressions applies fn to the stored rules, retrying on concurrent updates.
+func updateSuppressions(ctx context.Context, clientset *kubernetes.Clientset, namespace string, fn func([]SuppressionRule) []SuppressionRule) error {
+	for attempt := 0; ; attempt++ {
+		cm, rules, err := loadSuppressions(ctx, clientset, namespace)
+		if err != nil {
+			return err
+		}
+
+		err = saveSuppressions(ctx, clientset, cm, fn(rules))
+		if err == nil {
+			return nil
+		}
+		if (!apierrors.IsConflict(err) && !apierrors.IsAlreadyExists(err)) || attempt == 4 {
+			return err
+		}
+	}
+}
+
+// warnExpiredSuppressions logs once for every rule of the run namespaces that passed its
+// deadline, and exports the expired rules per namespace as a metric to alert on, so known
+// issues do not stay hidden after the agreed date.
+func warnExpiredSuppressions(ctx context.Context, clientset *kubernetes.Clientset, interval time.Duration) {
+	warned := map[string]bool{}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		namespaces, err := runNamespaces.list(ctx, clientset)
+		if err != nil {
+			log.Printf("cannot list run namespaces: %v", err)
+			continue
+		}
+
+		for _, namespace := range namespaces {
+			_, rules, err := loadSuppressions(ctx, clientset, namespace)
+			if err != nil {
+				log.Printf("cannot load suppressions of %s: %v", namespace, err)
+				continue
+			}
+
+			expired := 0
+			for _, rule := range rules {
+				if !rule.Expired {
+					continue
+				}
+				expired++
+				if !warned[namespace+"/"+rule.ID] {
+					warned[namespace+"/"+rule.ID] = true
+					log.Printf("suppression %s/%s (%q: %s) expired on %s, matching failures are reported again",
+						namespace, rule.ID, rule.Pattern, rule.Reason, rule.Expires.Format(time.RFC3339))
+				}
+			}
+			expiredSuppressions.WithLabelValues(namespace).Set(float64(expired))
+		}
+	}
+}
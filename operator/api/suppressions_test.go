@@ -0,0 +1,118 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestSuppressResults(t *testing.T) {
+	expires := time.Now().Add(24 * time.Hour)
+	rules := []SuppressionRule{
+		{ID: "paypal", Pattern: `checkout › pays with PayPal`, Reason: "sandbox is down", Expires: expires},
+		{ID: "search", Pattern: `^search › `, Reason: "index rebuild", Expires: expires},
+	}
+	spec := func(title, status string) SpecResult {
+		return SpecResult{File: "shop.spec.ts", Title: title, Status: status}
+	}
+
+	for _, tc := range []struct {
+		name         string
+		results      RunResults
+		tests        int
+		unsuppressed int
+		suppressed   bool
+	}{
+		{"all failures suppressed", RunResults{Specs: []SpecResult{
+			spec("checkout › pays with PayPal", "failed"),
+			spec("search › finds shoes", "failed"),
+			spec("checkout › pays by card", "passed"),
+		}}, 2, 0, true},
+		{"another test failed", RunResults{Specs: []SpecResult{
+			spec("checkout › pays with PayPal", "failed"),
+			spec("checkout › pays by card", "failed"),
+		}}, 1, 1, false},
+		{"the report has errors", RunResults{Errors: []string{"global setup failed"}, Specs: []SpecResult{
+			spec("checkout › pays with PayPal", "failed"),
+		}}, 1, 1, false},
+		{"a shard is missing", RunResults{MissingShards: []int{1}, Specs: []SpecResult{
+			spec("search › finds shoes", "failed"),
+		}}, 1, 1, false},
+		{"flaky tests are no failures", RunResults{Specs: []SpecResult{
+			spec("checkout › pays with PayPal", "flaky"),
+		}}, 0, 0, false},
+		{"no rule matches", RunResults{Specs: []SpecResult{
+			spec("account › signs up", "failed"),
+		}}, 0, 0, false},
+	} {
+		got := suppressResults(rules, &tc.results)
+		if got.suppressed() != tc.suppressed {
+			t.Errorf("%s: suppressed = %v, want %v", tc.name, got.suppressed(), tc.suppressed)
+		}
+		if got == nil {
+			if tc.tests > 0 {
+				t.Errorf("%s: no suppression, want %d suppressed tests", tc.name, tc.tests)
+			}
+			continue
+		}
+		if len(got.Tests) != tc.tests || got.Unsuppressed != tc.unsuppressed {
+			t.Errorf("%s: %d suppressed and %d unsuppressed, want %d and %d", tc.name, len(got.Tests), got.Unsuppressed, tc.tests, tc.unsuppressed)
+		}
+	}
+}
+
+func TestSuppressionForReadsTheResults(t *testing.T) {
+	dir := useResultsDir(t)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "smoke-1", UID: "3b1f4c3e-0000-4000-8000-000000000728"},
+		Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+			{Type: batchv1.JobFailed, Status: corev1.ConditionTrue},
+		}},
+	}
+	writeJSONReport(t, filepath.Join(dir, "checkpoints", string(job.UID), "results.json"), "unexpected")
+
+	rule := SuppressionRule{ID: "a", Pattern: "^a$", Reason: "known", Expires: time.Now().Add(time.Hour)}
+	if got := suppressionFor([]SuppressionRule{rule}, job); !got.suppressed() || got.reason() != "known" {
+		t.Errorf("suppression = %+v, want the failed test suppressed", got)
+	}
+
+	rule.Expired = true
+	if got := suppressionFor([]SuppressionRule{rule}, job); got != nil {
+		t.Errorf("suppression by an expired rule = %+v, want none", got)
+	}
+}
+
+func TestSuppressedRunsInRollups(t *testing.T) {
+	dir := useResultsDir(t)
+	run := func(uid string, condition batchv1.JobConditionType) batchv1.Job {
+		return batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "smoke-" + uid, UID: types.UID(uid)},
+			Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: condition, Status: corev1.ConditionTrue},
+			}},
+		}
+	}
+	suppressed, failed, passed := run("1", batchv1.JobFailed), run("2", batchv1.JobFailed), run("3", batchv1.JobComplete)
+	writeJSONReport(t, filepath.Join(dir, "checkpoints", "1", "results.json"), "unexpected")
+	rules := []SuppressionRule{{ID: "a", Pattern: "^a$", Reason: "known", Expires: time.Now().Add(time.Hour)}}
+
+	var counts StatusCounts
+	for _, job := range []batchv1.Job{suppressed, failed, passed} {
+		counts.add(&job, rules)
+	}
+	if want := (StatusCounts{Succeeded: 1, Failed: 1, Suppressed: 1}); counts != want {
+		t.Errorf("counts = %+v, want %+v", counts, want)
+	}
+
+	if got := passRate([]batchv1.Job{suppressed, passed}, rules, nil); got != 1 {
+		t.Errorf("pass rate of a suppressed and a passed run = %.2f, want 1", got)
+	}
+	if got := passRate([]batchv1.Job{failed, passed}, rules, nil); got != 0.5 {
+		t.Errorf("pass rate of a failed and a passed run = %.2f, want 0.5", got)
+	}
+}
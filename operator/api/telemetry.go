@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// defaultTelemetryInterval is how often usage statistics are sent, and the window they
+// cover.
+const defaultTelemetryInterval = 24 * time.Hour
+
+// InstanceStats are aggregate usage statistics of an installation. They hold counts only,
+// no names of namespaces, suites, branches or users, nor URLs or labels.
+type InstanceStats struct {
+	// InstanceID tells reports of the same cluster apart, a hash of the UID of its
+	// kube-system namespace.
+	InstanceID   string       `json:"instanceId"`
+	Window       string       `json:"window"`
+	Capabilities Capabilities `json:"capabilities"`
+	Namespaces   int          `json:"namespaces"`
+	// Runs counts the runs created within the window by state, "total" counts all.
+	Runs map[string]int `json:"runs"`
+	// Features counts the Jobs created within the window that use a feature, see
+	// runFeatures.
+	Features map[string]int `json:"features"`
+	// ErrorClasses counts the failed runs by failure class, "unclassified" those the SLO
+	// tracking did not classify yet.
+	ErrorClasses map[string]int `json:"errorClasses"`
+}
+
+// runFeatures returns the features a Job of the operator uses.
+func runFeatures(job *batchv1.Job) []string {
+	var features []string
+	has := func(feature string, ok bool) {
+		if ok {
+			features = append(features, feature)
+		}
+	}
+	label := func(key string) bool { _, ok := job.Labels[key]; return ok }
+	annotation := func(key string) bool { _, ok := job.Annotations[key]; return ok }
+
+	has("shards", job.Spec.CompletionMode != nil && *job.Spec.CompletionMode == batchv1.IndexedCompletion &&
+		job.Spec.Completions != nil && *job.Spec.Completions > 1)
+	has("matrix", label(matrixLabel))
+	has("schedules", label(scheduleLabel))
+	has("monitors", label(monitorLabel))
+	has("chaos", label(chaosLabel))
+	has("warmPool", label(warmLabel))
+	has("videoPreviews", label(previewRunLabel))
+	has("mergeGroups", label(mergeGroupLabel))
+	has("hooks", label(hooksLabel))
+	has("credentials", label(credentialsLabel))
+	has("budgets", annotation(budgetMaxDurationAnnotation) || annotation(budgetMaxTestDurationAnnotation) || annotation(budgetMaxFlakyAnnotation))
+	has("reruns", annotation(rerunOfAnnotation))
+	has("clones", annotation(clonedFromAnnotation))
+	has("pins", annotation(pinnedAnnotation))
+	has("signOffs", annotation(signOffAnnotation))
+	has("soak", annotation(soakAnnotation))
+
+	return features
+}
+
+// instanceID hashes the UID of the kube-system namespace, which stays the same for the
+// life of a cluster. Without permission to read it the ID is empty.
+func instanceID(ctx context.Context, clientset *kubernetes.Clientset) string {
+	ns, err := clientset.CoreV1().Namespaces().Get(ctx, metav1.NamespaceSystem, metav1.GetOptions{})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(ns.UID))
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// instanceStats collects the statistics of the runs created within window in the
+// namespaces the API may list runs in.
+func instanceStats(ctx context.Context, clientset *kubernetes.Clientset, window time.Duration) (InstanceStats, error) {
+	settings, err := effectiveSettings(ctx, clientset)
+	if err != nil {
+		return InstanceStats{}, err
+	}
+	namespaces, err := runNamespaces.list(ctx, clientset)
+	if err != nil {
+		return InstanceStats{}, err
+	}
+
+	stats := InstanceStats{
+		InstanceID:   instanceID(ctx, clientset),
+		Window:       window.String(),
+		Namespaces:   len(namespaces),
+		Runs:         map[string]int{},
+		Features:     map[string]int{},
+		ErrorClasses: map[string]int{},
+	}
+
+	runs, err := labels.Parse(runsSelector)
+	if err != nil {
+		return InstanceStats{}, err
+	}
+	since := time.Now().Add(-window)
+	var notified []*batchv1.Job
+	for _, namespace := range namespaces {
+		jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return InstanceStats{}, err
+		}
+		for i := range jobs.Items {
+			if runs.Matches(labels.Set(jobs.Items[i].Labels)) {
+				notified = append(notified, &jobs.Items[i])
+			}
+		}
+
+		for _, job := range filterJobsByTime(jobs.Items, since, time.Time{}) {
+			for _, feature := range runFeatures(&job) {
+				stats.Features[feature]++
+			}
+			if !runs.Matches(labels.Set(job.Labels)) {
+				continue
+			}
+
+			state := jobState(&job)
+			stats.Runs["total"]++
+			stats.Runs[state]++
+			if state == jobStateFailed {
+				class := job.Annotations[failureClassAnnotation]
+				if class == "" {
+					class = "unclassified"
+				}
+				stats.ErrorClasses[class]++
+			}
+		}
+	}
+	stats.Capabilities = capabilities(settings, runNotificationDrivers(ctx, clientset, namespaces, notified))
+
+	return stats, nil
+}
+
+// GET /stats/instance?window=24h shows the usage statistics, which TELEMETRY_ENDPOINT
+// receives when set.
+func getInstanceStats(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	window := defaultTelemetryInterval
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := parseWindow(v)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+
+	stats, err := instanceStats(r.Context(), clientset, window)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, stats)
+}
+
+// telemetryInterval reads TELEMETRY_INTERVAL, 24h by default.
+func telemetryInterval() time.Duration {
+	if d, err := parseWindow(os.Getenv("TELEMETRY_INTERVAL")); err == nil && d > 0 {
+		return d
+	}
+
+	return defaultTelemetryInterval
+}
+
+// reportTelemetry sends the usage statistics of every interval to endpoint. Telemetry is
+// opt-in, the API starts this only with TELEMETRY_ENDPOINT set. Failures are logged and
+// the statistics of that interval are dropped.
+func reportTelemetry(ctx context.Context, clientset *kubernetes.Clientset, endpoint string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stats, err := instanceStats(ctx, clientset, interval)
+		if err != nil {
+			log.Printf("cannot collect usage statistics: %v", err)
+			continue
+		}
+		if err := sendTelemetry(ctx, endpoint, stats); err != nil {
+			log.Printf("cannot send usage statistics to %s: %v", endpoint, err)
+		}
+	}
+}
+
+func sendTelemetry(ctx context.Context, endpoint string, stats InstanceStats) error {
+	body, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+
+	return nil
+}
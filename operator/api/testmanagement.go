@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// testManagementLabel marks the finished runs whose outcomes were pushed to the
+	// test-management tool of their suite, or that have none.
+	testManagementLabel = "playwright.operator/test-management-synced"
+	// testManagementAnnotation links the TestRail run or Xray test execution of a run.
+	testManagementAnnotation = "playwright.operator/test-management-run"
+)
+
+// Test-management tools the outcomes of runs are pushed to.
+const (
+	testManagementTestRail = "testrail"
+	testManagementXray     = "xray"
+)
+
+// defaultCasePatterns find case IDs in test titles and tags: C1234 for TestRail and Jira
+// issue keys like SHOP-42 for Xray.
+var defaultCasePatterns = map[string]string{
+	testManagementTestRail: `\bC(\d+)\b`,
+	testManagementXray:     `\b[A-Z][A-Z0-9_]+-\d+\b`,
+}
+
+// TestManagement pushes the outcomes of the finished runs of a suite to TestRail, as a
+// test run of Project (and SuiteID for projects with several suites), or to Xray, as a
+// test execution in the Jira project Project. Tests name their cases in an annotation of
+// AnnotationType, like {type: "testrail", description: "C1234"}, or in their title or
+// tags, matched by CasePattern. The credentials are those of the environment of the API,
+// see manifest/operator.yaml.
+type TestManagement struct {
+	Provider       string `json:"provider"`
+	Project        string `json:"project"`
+	SuiteID        int    `json:"suiteID,omitempty"`
+	AnnotationType string `json:"annotationType,omitempty"`
+	// CasePattern defaults to C1234 for TestRail and issue keys for Xray, its first group
+	// is the case ID if it has one.
+	CasePattern string `json:"casePattern,omitempty"`
+}
+
+func (t *TestManagement) validate() error {
+	if t.Provider != testManagementTestRail && t.Provider != testManagementXray {
+		return fmt.Errorf("provider must be %q or %q", testManagementTestRail, testManagementXray)
+	}
+	if t.Project == "" {
+		return fmt.Errorf("project is required")
+	}
+	if t.Provider == testManagementTestRail {
+		if _, err := strconv.Atoi(t.Project); err != nil {
+			return fmt.Errorf("project must be the ID of the TestRail project")
+		}
+	}
+	if _, err := regexp.Compile(t.casePattern()); err != nil {
+		return fmt.Errorf("invalid casePattern: %w", err)
+	}
+
+	return nil
+}
+
+func (t *TestManagement) annotationType() string {
+	if t.AnnotationType != "" {
+		return t.AnnotationType
+	}
+	return t.Provider
+}
+
+func (t *TestManagement) casePattern() string {
+	if t.CasePattern != "" {
+		return t.CasePattern
+	}
+	return defaultCasePatterns[t.Provider]
+}
+
+// CaseOutcome is the outcome of a test-management case over the tests covering it: failed
+// if one of them failed, skipped if all were skipped and passed otherwise.
+type CaseOutcome struct {
+	Case       string
+	Status     string
+	DurationMs int64
+	Tests      []string
+	Errors     []string
+}
+
+// caseOutcomes maps the tests of a run to the cases they name.
+func (t *TestManagement) caseOutcomes(specs []SpecResult) []CaseOutcome {
+	pattern := regexp.MustCompile(t.casePattern())
+	find := func(s string) []string {
+		var ids []string
+		for _, m := range pattern.FindAllStringSubmatch(s, -1) {
+			ids = append(ids, m[len(m)-1])
+		}
+		return ids
+	}
+
+	cases := map[string]*CaseOutcome{}
+	for _, spec := range specs {
+		ids := find(spec.Title)
+		for _, tag := range spec.Tags {
+			ids = append(ids, find(tag)...)
+		}
+		for _, id := range annotationValues(spec, t.annotationType()) {
+			ids = append(ids, find(id)...)
+		}
+
+		test := spec.Title
+		if spec.Project != "" {
+			test += " [" + spec.Project + "]"
+		}
+		seen := map[string]bool{}
+		for _, id := range ids {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			c := cases[id]
+			if c == nil {
+				c = &CaseOutcome{Case: id, Status: "skipped"}
+				cases[id] = c
+			}
+			c.Tests = append(c.Tests, test+": "+spec.Status)
+			c.DurationMs += spec.DurationMs
+			switch {
+			case spec.Status == "failed":
+				c.Status = "failed"
+				c.Errors = append(c.Errors, spec.Errors...)
+			case spec.Status == "skipped":
+			case c.Status != "failed":
+				c.Status = "passed"
+			}
+		}
+	}
+
+	outcomes := make([]CaseOutcome, 0, len(cases))
+	for _, c := range cases {
+		outcomes = append(outcomes, *c)
+	}
+	sort.Slice(outcomes, func(i, j int) bool {
+		return outcomes[i].Case < outcomes[j].Case
+	})
+
+	return outcomes
+}
+
+// comment describes the tests of a case in the result pushed for it.
+func (c CaseOutcome) comment(run string) string {
+	comment := "Playwright run " + run + "\n" + strings.Join(c.Tests, "\n")
+	if len(c.Errors) > 0 {
+		comment += "\n\n" + c.Errors[0]
+	}
+
+	return comment
+}
+
+// testManagementRequest sends a JSON request and decodes the JSON answer into out.
+func testManagementRequest(ctx context.Context, method, url string, body interface{}, out interface{}, authorize func(*http.Request)) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	authorize(req)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s answered %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// TestRail statuses of results.
+const (
+	testRailPassed = 1
+	testRailFailed = 5
+)
+
+// pushTestRail adds a TestRail run with the cases of the run and their results, and
+// returns its URL. Skipped cases stay untested.
+func pushTestRail(ctx context.Context, t *TestManagement, job *batchv1.Job, outcomes []CaseOutcome) (string, error) {
+	base := strings.TrimSuffix(os.Getenv("TESTRAIL_URL"), "/")
+	user, key := os.Getenv("TESTRAIL_USER"), os.Getenv("TESTRAIL_API_KEY")
+	if base == "" || user == "" || key == "" {
+		return "", fmt.Errorf("TESTRAIL_URL, TESTRAIL_USER and TESTRAIL_API_KEY are required")
+	}
+	authorize := func(req *http.Request) { req.SetBasicAuth(user, key) }
+
+	type result struct {
+		CaseID   int    `json:"case_id"`
+		StatusID int    `json:"status_id"`
+		Comment  string `json:"comment"`
+		Elapsed  string `json:"elapsed,omitempty"`
+	}
+	var caseIDs []int
+	var results []result
+	for _, c := range outcomes {
+		id, err := strconv.Atoi(strings.TrimPrefix(c.Case, "C"))
+		if err != nil {
+			log.Printf("ignoring TestRail case %q of run %s/%s: not a case ID", c.Case, job.Namespace, job.Name)
+			continue
+		}
+		caseIDs = append(caseIDs, id)
+		if c.Status == "skipped" {
+			continue
+		}
+		r := result{CaseID: id, StatusID: testRailPassed, Comment: c.comment(job.Name)}
+		if c.Status == "failed" {
+			r.StatusID = testRailFailed
+		}
+		// TestRail rejects elapsed times below a second
+		if c.DurationMs >= 1000 {
+			r.Elapsed = fmt.Sprintf("%ds", c.DurationMs/1000)
+		}
+		results = append(results, r)
+	}
+	if len(caseIDs) == 0 {
+		return "", nil
+	}
+
+	run := map[string]interface{}{
+		"name":        fmt.Sprintf("%s %s", job.Labels[suiteLabel], job.Name),
+		"description": fmt.Sprintf("Playwright run %s/%s", job.Namespace, job.Name),
+		"include_all": false,
+		"case_ids":    caseIDs,
+	}
+	if t.SuiteID != 0 {
+		run["suite_id"] = t.SuiteID
+	}
+	var created struct {
+		ID  int    `json:"id"`
+		URL string `json:"url"`
+	}
+	if err := testManagementRequest(ctx, http.MethodPost, base+"/index.php?/api/v2/add_run/"+t.Project, run, &created, authorize); err != nil {
+		return "", err
+	}
+	if len(results) > 0 {
+		path := fmt.Sprintf("/index.php?/api/v2/add_results_for_cases/%d", created.ID)
+		if err := testManagementRequest(ctx, http.MethodPost, base+path, map[string]interface{}{"results": results}, nil, authorize); err != nil {
+			return "", fmt.Errorf("adding the results to TestRail run %d: %w", created.ID, err)
+		}
+	}
+
+	return created.URL, nil
+}
+
+// pushXray imports a test execution with the outcomes of the run into Xray Cloud and
+// returns its Jira URL if XRAY_JIRA_URL is set.
+func pushXray(ctx context.Context, t *TestManagement, job *batchv1.Job, outcomes []CaseOutcome) (string, error) {
+	base := strings.TrimSuffix(os.Getenv("XRAY_URL"), "/")
+	if base == "" {
+		base = "https://xray.cloud.getxray.app"
+	}
+	clientID, secret := os.Getenv("XRAY_CLIENT_ID"), os.Getenv("XRAY_CLIENT_SECRET")
+	if clientID == "" || secret == "" {
+		return "", fmt.Errorf("XRAY_CLIENT_ID and XRAY_CLIENT_SECRET are required")
+	}
+	if len(outcomes) == 0 {
+		return "", nil
+	}
+
+	var token string
+	credentials := map[string]string{"client_id": clientID, "client_secret": secret}
+	if err := testManagementRequest(ctx, http.MethodPost, base+"/api/v2/authenticate", credentials, &token, func(*http.Request) {}); err != nil {
+		return "", fmt.Errorf("authenticating with Xray: %w", err)
+	}
+
+	statuses := map[string]string{"passed": "PASSED", "failed": "FAILED", "skipped": "TODO"}
+	var tests []map[string]string
+	for _, c := range outcomes {
+		tests = append(tests, map[string]string{"testKey": c.Case, "status": statuses[c.Status], "comment": c.comment(job.Name)})
+	}
+	execution := map[string]interface{}{
+		"info": map[string]string{
+			"project":     t.Project,
+			"summary":     fmt.Sprintf("%s %s", job.Labels[suiteLabel], job.Name),
+			"description": fmt.Sprintf("Playwright run %s/%s", job.Namespace, job.Name),
+		},
+		"tests": tests,
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	authorize := func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }
+	if err := testManagementRequest(ctx, http.MethodPost, base+"/api/v2/import/execution", execution, &created, authorize); err != nil {
+		return "", err
+	}
+
+	if jira := strings.TrimSuffix(os.Getenv("XRAY_JIRA_URL"), "/"); jira != "" && created.Key != "" {
+		return jira + "/browse/" + created.Key, nil
+	}
+	return "", nil
+}
+
+// pushTestManagement pushes the outcomes of a finished run to the test-management tool of
+// its suite and returns the link to them, if there is one.
+func pushTestManagement(ctx context.Context, t *TestManagement, job *batchv1.Job) (string, error) {
+	results, err := runResults(job)
+	if err != nil || results == nil {
+		return "", err
+	}
+	outcomes := t.caseOutcomes(results.Specs)
+
+	if t.Provider == testManagementXray {
+		return pushXray(ctx, t, job, outcomes)
+	}
+	return pushTestRail(ctx, t, job, outcomes)
+}
+
+// syncTestManagement pushes the outcomes of the finished runs of suites with a
+// TestManagement policy and labels all finished runs with testManagementLabel. Sharded
+// runs wait for the Job merging their reports.
+func syncTestManagement(ctx context.Context, clientset *kubernetes.Clientset, informers *runInformers, namespace string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		jobs, err := informers.runs(ctx, namespace, runsSelector+","+suiteLabel+",!"+testManagementLabel+",!"+reportMergeLabel)
+		if err != nil {
+			log.Printf("cannot list runs to sync with test management: %v", err)
+			continue
+		}
+		if len(jobs) == 0 {
+			continue
+		}
+		_, policies, err := loadSuitePolicies(ctx, clientset, namespace)
+		if err != nil {
+			log.Printf("cannot load suite policies: %v", err)
+			continue
+		}
+
+		for i := range jobs {
+			job := &jobs[i]
+			if state := jobState(job); state != jobStateSucceeded && state != jobStateFailed {
+				continue
+			}
+
+			metadata := map[string]interface{}{
+				"labels": map[string]interface{}{testManagementLabel: "true"},
+			}
+			if t := suitePolicy(policies, job.Labels[suiteLabel]).TestManagement; t != nil {
+				link, err := pushTestManagement(ctx, t, job)
+				if err != nil {
+					log.Printf("cannot push run %s/%s to %s: %v", job.Namespace, job.Name, t.Provider, err)
+					continue
+				}
+				if link != "" {
+					metadata["annotations"] = map[string]interface{}{testManagementAnnotation: link}
+				}
+			}
+
+			patch, _ := json.Marshal(map[string]interface{}{"metadata": metadata})
+			if _, err := clientset.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+				log.Printf("cannot label run %s/%s: %v", job.Namespace, job.Name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	testConfigVolumeName = "playwright-config"
+	testConfigMountPath  = "/playwright-config"
+)
+
+// TestCounts are the outcomes of the tests of a pod, as written by resumableRunScript.
+type TestCounts struct {
+	Passed  int32 `json:"passed"`
+	Failed  int32 `json:"failed"`
+	Flaky   int32 `json:"flaky"`
+	Skipped int32 `json:"skipped"`
+}
+
+// testCounts returns the counts of the latest pod that reported them.
+func testCounts(pods []corev1.Pod) *TestCounts {
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].CreationTimestamp.After(pods[j].CreationTimestamp.Time)
+	})
+
+	for _, pod := range pods {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name != runContainer || status.State.Terminated == nil {
+				continue
+			}
+
+			var counts TestCounts
+			if err := json.Unmarshal([]byte(status.State.Terminated.Message), &counts); err == nil {
+				return &counts
+			}
+		}
+	}
+
+	return nil
+}
+
+// testConfigFile returns the Playwright configuration among the files of a run.
+func testConfigFile(config map[string]string) string {
+	for _, name := range []string{"playwright.config.ts", "playwright.config.js", "playwright.config.mjs"} {
+		if _, ok := config[name]; ok {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// testRunReconciler creates the resources of a PlaywrightTestRun and mirrors its Job in
+// the status. The Job and ConfigMap are owned by the run and deleted with it, the results
+// claim is shared with the dashboard and only created when missing.
+type testRunReconciler struct {
+	client.Client
+	clientset *kubernetes.Clientset
+}
+
+func (r *testRunReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var run PlaywrightTestRun
+	if err := r.Get(ctx, req.NamespacedName, &run); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if run.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+
+	status := run.Status.DeepCopy()
+	status.ObservedGeneration = run.Generation
+
+	cm, err := r.ensureConfig(ctx, &run)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if cm != nil {
+		status.ConfigMap = cm.Name
+	}
+
+	if err := r.ensureResultsClaim(ctx, run.Namespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	job, err := r.ensureJob(ctx, &run, cm)
+	if err != nil {
+		status.Message = err.Error()
+		if err := r.updateStatus(ctx, &run, status); err != nil {
+			return ctrl.Result{}, err
+		}
+		switch code := runErrorStatus(err); {
+		case code == http.StatusTooManyRequests:
+			return ctrl.Result{RequeueAfter: runLimitRequeue}, nil
+		case code >= 400 && code < 500:
+			// rejected runs stay rejected until their spec changes
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	status.JobName = job.Name
+	status.Phase = jobState(job)
+	status.Message = ""
+	status.StartTime = job.Status.StartTime
+	status.CompletionTime = job.Status.CompletionTime
+
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name}); err != nil {
+		return ctrl.Result{}, err
+	}
+	if counts := testCounts(pods.Items); counts != nil {
+		status.Passed, status.Failed, status.Flaky, status.Skipped = counts.Passed, counts.Failed, counts.Flaky, counts.Skipped
+	}
+
+	return ctrl.Result{}, r.updateStatus(ctx, &run, status)
+}
+
+func (r *testRunReconciler) updateStatus(ctx context.Context, run *PlaywrightTestRun, status *PlaywrightTestRunStatus) error {
+	if equality.Semantic.DeepEqual(run.Status, *status) {
+		return nil
+	}
+
+	run.Status = *status
+	return r.Status().Update(ctx, run)
+}
+
+// ensureConfig keeps the ConfigMap of the run in line with its configuration files.
+func (r *testRunReconciler) ensureConfig(ctx context.Context, run *PlaywrightTestRun) (*corev1.ConfigMap, error) {
+	if len(run.Spec.Config) == 0 {
+		return nil, nil
+	}
+
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: run.Name + "-config", Namespace: run.Namespace}}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, cm, func() error {
+		cm.Data = copyLabels(run.Spec.Config)
+		return controllerutil.SetControllerReference(run, cm, r.Scheme())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("config of run %s/%s: %w", run.Namespace, run.Name, err)
+	}
+
+	return cm, nil
+}
+
+// ensureResultsClaim creates the results claim like manifest/pvc.yaml does, on the
+// default storage class and with RESULTS_CLAIM_SIZE.
+func (r *testRunReconciler) ensureResultsClaim(ctx context.Context, namespace string) error {
+	var pvc corev1.PersistentVolumeClaim
+	err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: resultsClaimName}, &pvc)
+	if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	size, err := resource.ParseQuantity(envOrDefault("RESULTS_CLAIM_SIZE", "512Mi"))
+	if err != nil {
+		return fmt.Errorf("invalid RESULTS_CLAIM_SIZE: %w", err)
+	}
+
+	pvc = corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: resultsClaimName, Namespace: namespace},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: size,
+				},
+			},
+		},
+	}
+	if err := r.Create(ctx, &pvc); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	return nil
+}
+
+// ensureJob returns the Job of the run, named after it, and creates it through createRun on
+// the first reconcile. The Job is not updated afterwards, a changed spec needs a new run.
+func (r *testRunReconciler) ensureJob(ctx context.Context, run *PlaywrightTestRun, cm *corev1.ConfigMap) (*batchv1.Job, error) {
+	var job batchv1.Job
+	err := r.Get(ctx, types.NamespacedName{Namespace: run.Namespace, Name: run.Name}, &job)
+	if err == nil {
+		if !metav1.IsControlledBy(&job, run) {
+			return nil, fmt.Errorf("job %s/%s exists and is not owned by the run", job.Namespace, job.Name)
+		}
+		return &job, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	spec := RunSpec{
+		Name:               run.Name,
+		Namespace:          run.Namespace,
+		Image:              run.Spec.Image,
+		Command:            run.Spec.Command,
+		Browser:            run.Spec.Browser,
+		Suite:              run.Spec.Suite,
+		Branch:             run.Spec.Branch,
+		Env:                run.Spec.Env,
+		ImagePullSecrets:   run.Spec.ImagePullSecrets,
+		ServiceAccountName: run.Spec.ServiceAccountName,
+	}
+	// the default command takes the configuration as arguments of its shell
+	if name := testConfigFile(run.Spec.Config); len(spec.Command) == 0 && name != "" {
+		spec.Command = []string{"sh", "-c", resumableRunScript, "sh", "--config", testConfigMountPath + "/" + name}
+	}
+
+	// declared runs are admitted and prepared like those started through the API
+	return createPreparedRun(ctx, r.clientset, spec, func(created *batchv1.Job) error {
+		if cm != nil {
+			pod := &created.Spec.Template.Spec
+			pod.Volumes = append(pod.Volumes, corev1.Volume{
+				Name: testConfigVolumeName,
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: cm.Name}},
+				},
+			})
+			container := &pod.Containers[0]
+			container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+				Name: testConfigVolumeName, MountPath: testConfigMountPath, ReadOnly: true,
+			})
+			container.Env = append(container.Env, corev1.EnvVar{Name: "PLAYWRIGHT_TEST_CONFIG_DIR", Value: testConfigMountPath})
+		}
+
+		// runs of a declared suite post their completion where the PlaywrightTestRun says
+		for _, key := range []string{notifyAnnotation, notifyOnAnnotation} {
+			if v, ok := run.Annotations[key]; ok {
+				created.Annotations[key] = v
+			}
+		}
+
+		return controllerutil.SetControllerReference(run, created, r.Scheme())
+	})
+}
+
+// runLimitRequeue is how long the creation of a run waits while the namespace runs
+// maxRunningRuns of the settings.
+const runLimitRequeue = 30 * time.Second
+
+// podTestRun maps a pod to the PlaywrightTestRun of its Job, which is named after the run.
+// Pods of other Jobs map to runs that do not exist and are dropped by Reconcile.
+func podTestRun(_ context.Context, obj client.Object) []reconcile.Request {
+	ref := metav1.GetControllerOf(obj)
+	if ref == nil || ref.Kind != "Job" {
+		return nil
+	}
+
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: ref.Name}}}
+}
+
+// runTestRunController reconciles the PlaywrightTestRuns of a namespace until ctx is done.
+// It is started with TESTRUN_CONTROLLER=true, as it needs the CRD of manifest/crd.yaml.
+func runTestRunController(ctx context.Context, config *rest.Config, clientset *kubernetes.Clientset, namespace string) error {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return err
+	}
+	if err := testRunSchemeBuilder.AddToScheme(scheme); err != nil {
+		return err
+	}
+
+	mgr, err := ctrl.NewManager(config, ctrl.Options{
+		Scheme:  scheme,
+		Cache:   cache.Options{DefaultNamespaces: map[string]cache.Config{namespace: {}}},
+		Metrics: metricsserver.Options{BindAddress: "0"},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = ctrl.NewControllerManagedBy(mgr).
+		For(&PlaywrightTestRun{}).
+		Owns(&batchv1.Job{}).
+		Owns(&corev1.ConfigMap{}).
+		// the test counts in the status come from the pods of the Job
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(podTestRun)).
+		Complete(&testRunReconciler{Client: mgr.GetClient(), clientset: clientset})
+	if err != nil {
+		return err
+	}
+
+	return mgr.Start(ctx)
+}
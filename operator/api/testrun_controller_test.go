@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestPodTestRun(t *testing.T) {
+	owned := func(kind, name string, controller bool) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "tests", Name: name + "-abcde",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: kind, Name: name, Controller: ptr.To(controller)}},
+		}}
+	}
+
+	if got, want := podTestRun(context.Background(), owned("Job", "checkout", true)), []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "tests", Name: "checkout"}},
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pod of a Job maps to %v, want %v", got, want)
+	}
+	for name, pod := range map[string]*corev1.Pod{
+		"no owner":       {ObjectMeta: metav1.ObjectMeta{Namespace: "tests", Name: "debug"}},
+		"not controller": owned("Job", "checkout", false),
+		"not a Job":      owned("ReplicaSet", "web", true),
+	} {
+		if got := podTestRun(context.Background(), pod); got != nil {
+			t.Errorf("%s: maps to %v, want nothing", name, got)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+// testRunGroupVersion is the API of PlaywrightTestRun, see manifest/crd.yaml.
+var testRunGroupVersion = schema.GroupVersion{Group: "playwright.operator", Version: "v1alpha1"}
+
+var testRunSchemeBuilder = &scheme.Builder{GroupVersion: testRunGroupVersion}
+
+func init() {
+	testRunSchemeBuilder.Register(&PlaywrightTestRun{}, &PlaywrightTestRunList{})
+}
+
+// PlaywrightTestRun declares a run. Its controller creates the Job of the run, a
+// ConfigMap with the test configuration and the results claim, and reports the outcome
+// of the run in its status.
+type PlaywrightTestRun struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PlaywrightTestRunSpec   `json:"spec,omitempty"`
+	Status PlaywrightTestRunStatus `json:"status,omitempty"`
+}
+
+type PlaywrightTestRunList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []PlaywrightTestRun `json:"items"`
+}
+
+// PlaywrightTestRunSpec holds the fields of RunSpec that make sense for a declared run.
+type PlaywrightTestRunSpec struct {
+	Image   string   `json:"image"`
+	Command []string `json:"command,omitempty"`
+	Browser string   `json:"browser,omitempty"`
+
+	Suite  string `json:"suite,omitempty"`
+	Branch string `json:"branch,omitempty"`
+
+	Env map[string]string `json:"env,omitempty"`
+
+	// Config maps file names to the contents of the test configuration, mounted at
+	// testConfigMountPath. A playwright.config.* file is passed to the default command.
+	Config map[string]string `json:"config,omitempty"`
+
+	ImagePullSecrets   []string `json:"imagePullSecrets,omitempty"`
+	ServiceAccountName string   `json:"serviceAccountName,omitempty"`
+}
+
+type PlaywrightTestRunStatus struct {
+	// Phase is the state of the Job, see jobState.
+	Phase     string `json:"phase,omitempty"`
+	JobName   string `json:"jobName,omitempty"`
+	ConfigMap string `json:"configMap,omitempty"`
+	Message   string `json:"message,omitempty"`
+
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// The counts are reported by the default command once the tests finished.
+	Passed  int32 `json:"passed"`
+	Failed  int32 `json:"failed"`
+	Flaky   int32 `json:"flaky"`
+	Skipped int32 `json:"skipped"`
+
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+func (in *PlaywrightTestRun) DeepCopyInto(out *PlaywrightTestRun) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+func (in *PlaywrightTestRun) DeepCopy() *PlaywrightTestRun {
+	if in == nil {
+		return nil
+	}
+	out := new(PlaywrightTestRun)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *PlaywrightTestRun) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+func (in *PlaywrightTestRunList) DeepCopyInto(out *PlaywrightTestRunList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]PlaywrightTestRun, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+func (in *PlaywrightTestRunList) DeepCopy() *PlaywrightTestRunList {
+	if in == nil {
+		return nil
+	}
+	out := new(PlaywrightTestRunList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *PlaywrightTestRunList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+func (in *PlaywrightTestRunSpec) DeepCopyInto(out *PlaywrightTestRunSpec) {
+	*out = *in
+	out.Command = append([]string(nil), in.Command...)
+	out.ImagePullSecrets = append([]string(nil), in.ImagePullSecrets...)
+	out.Env = copyLabels(in.Env)
+	out.Config = copyLabels(in.Config)
+}
+
+func (in *PlaywrightTestRunStatus) DeepCopyInto(out *PlaywrightTestRunStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		out.StartTime = in.StartTime.DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		out.CompletionTime = in.CompletionTime.DeepCopy()
+	}
+}
+
+func (in *PlaywrightTestRunStatus) DeepCopy() *PlaywrightTestRunStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PlaywrightTestRunStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// defaultRequirementAnnotation is the annotation type tests reference requirements with,
+// like test.info().annotations.push({type: "requirement", description: "REQ-12"}).
+const defaultRequirementAnnotation = "requirement"
+
+// CoveringTest is a test covering a requirement, with its status in the latest finished
+// run of its suite.
+type CoveringTest struct {
+	Suite   string `json:"suite"`
+	Run     string `json:"run"`
+	File    string `json:"file"`
+	Title   string `json:"title"`
+	Project string `json:"project,omitempty"`
+	Status  string `json:"status"`
+}
+
+// Requirement is a row of the traceability matrix. Status is failed if a covering test
+// failed, skipped if all were skipped and passed otherwise.
+type Requirement struct {
+	ID     string         `json:"id"`
+	Status string         `json:"status"`
+	Tests  []CoveringTest `json:"tests"`
+}
+
+type TraceabilityMatrix struct {
+	Namespace  string        `json:"namespace"`
+	Annotation string        `json:"annotation"`
+	Generated  time.Time     `json:"generated"`
+	Runs       []RunRef      `json:"runs"`
+	Rows       []Requirement `json:"requirements"`
+}
+
+// latestResults returns the results of the latest finished run with a JSON report of
+// every suite of a namespace, or of one suite.
+func latestResults(ctx context.Context, clientset *kubernetes.Clientset, namespace, suite string) ([]*RunResults, []batchv1.Job, error) {
+	selector := runsSelector + "," + suiteLabel
+	if suite != "" {
+		selector = runsSelector + "," + suiteLabel + "=" + suite
+	}
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(jobs.Items, func(i, j int) bool {
+		return jobs.Items[i].CreationTimestamp.After(jobs.Items[j].CreationTimestamp.Time)
+	})
+
+	var results []*RunResults
+	var runs []batchv1.Job
+	done := map[string]bool{}
+	for _, job := range finishedRuns(jobs.Items) {
+		if done[job.Labels[suiteLabel]] {
+			continue
+		}
+		r, err := runResults(&job)
+		if err != nil {
+			return nil, nil, err
+		}
+		if r == nil {
+			continue
+		}
+		done[job.Labels[suiteLabel]] = true
+		results = append(results, r)
+		runs = append(runs, job)
+	}
+
+	return results, runs, nil
+}
+
+// traceabilityMatrix maps the requirements the tests of runs reference to the tests.
+func traceabilityMatrix(results []*RunResults, suites []string, annotation string) []Requirement {
+	rows := map[string]*Requirement{}
+	for i, r := range results {
+		for _, spec := range r.Specs {
+			seen := map[string]bool{}
+			for _, id := range annotationValues(spec, annotation) {
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+
+				row := rows[id]
+				if row == nil {
+					row = &Requirement{ID: id, Status: "skipped"}
+					rows[id] = row
+				}
+				row.Tests = append(row.Tests, CoveringTest{
+					Suite:   suites[i],
+					Run:     r.Name,
+					File:    spec.File,
+					Title:   spec.Title,
+					Project: spec.Project,
+					Status:  spec.Status,
+				})
+				switch {
+				case spec.Status == "failed":
+					row.Status = "failed"
+				case spec.Status == "skipped":
+				case row.Status != "failed":
+					row.Status = "passed"
+				}
+			}
+		}
+	}
+
+	matrix := make([]Requirement, 0, len(rows))
+	for _, row := range rows {
+		matrix = append(matrix, *row)
+	}
+	sort.Slice(matrix, func(i, j int) bool {
+		return matrix[i].ID < matrix[j].ID
+	})
+
+	return matrix
+}
+
+// GET /traceability?namespace=ns&suite=name&annotation=requirement&format=json|csv maps
+// the requirements referenced by annotations of the tests to the tests covering them and
+// their status in the latest finished run of every suite, or of one. The CSV export has a
+// row per requirement and test.
+func getTraceability(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	query := r.URL.Query()
+	namespace := getNamespace(query.Get("namespace"))
+	suite := query.Get("suite")
+	if suite != "" {
+		if err := validateLabels(map[string]string{suiteLabel: suite}); err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	annotation := query.Get("annotation")
+	if annotation == "" {
+		annotation = defaultRequirementAnnotation
+	}
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		writeError(w, "format must be json or csv", http.StatusBadRequest)
+		return
+	}
+
+	results, runs, err := latestResults(r.Context(), clientset, namespace, suite)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	suites := make([]string, len(runs))
+	matrix := TraceabilityMatrix{Namespace: namespace, Annotation: annotation, Generated: time.Now().UTC(), Runs: []RunRef{}}
+	for i := range runs {
+		suites[i] = runs[i].Labels[suiteLabel]
+		matrix.Runs = append(matrix.Runs, results[i].RunRef)
+	}
+	matrix.Rows = traceabilityMatrix(results, suites, annotation)
+
+	if format != "csv" {
+		respondJSON(w, matrix)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "traceability-"+namespace+".csv"))
+	out := csv.NewWriter(w)
+	out.Write([]string{"requirement", "requirement status", "suite", "run", "file", "test", "project", "test status"})
+	for _, row := range matrix.Rows {
+		for _, test := range row.Tests {
+			out.Write([]string{row.ID, row.Status, test.Suite, test.Run, test.File, test.Title, test.Project, test.Status})
+		}
+	}
+	out.Flush()
+}
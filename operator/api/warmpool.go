@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+// The warm pool keeps runs started ahead of time, with the image pulled and an agent
+// waiting for work. Claiming one turns it into a regular run, so it completes, lists and
+// reports like any other Job.
+const (
+	warmLabel            = "playwright.operator/warm"
+	warmIdle             = "idle"
+	assignmentAnnotation = "playwright.operator/assignment"
+
+	// warmTokenAudience is the audience of the service account token warm runs prove
+	// their pod with when polling for their assignment, which holds the environment of
+	// the run, secrets included.
+	warmTokenAudience = "playwright-operator-warmpool"
+	warmTokenVolume   = "warmpool-token"
+	warmTokenDir      = "/var/run/secrets/playwright-operator"
+	// podUIDExtra names the pod a service account token is bound to in the user of its
+	// review.
+	podUIDExtra = "authentication.kubernetes.io/pod-uid"
+)
+
+// warmAgentScript polls the API for the assignment of its pod, then runs the assigned
+// command with the assigned environment and exits with its status. The token of the pod
+// is read on each poll, the kubelet rotates it.
+const warmAgentScript = `
+const url = process.env.OPERATOR_URL + "/warmpool/assignment?namespace=" +
+  encodeURIComponent(process.env.POD_NAMESPACE) + "&pod=" + encodeURIComponent(process.env.POD_NAME);
+(async () => {
+  for (;;) {
+    try {
+      const token = require("fs").readFileSync(process.env.WARM_POOL_TOKEN_FILE, "utf8").trim();
+      const res = await fetch(url, { headers: { Authorization: "Bearer " + token } });
+      if (res.status === 200) {
+        const a = await res.json();
+        const child = require("child_process").spawn(a.command[0], a.command.slice(1),
+          { stdio: "inherit", env: { ...process.env, ...a.env } });
+        child.on("exit", (code) => process.exit(code === null ? 1 : code));
+        return;
+      }
+    } catch (e) {}
+    await new Promise((r) => setTimeout(r, 1000));
+  }
+})();
+`
+
+// Assignment is the work handed to a warm run.
+type Assignment struct {
+	Command []string          `json:"command"`
+	Env     map[string]string `json:"env,omitempty"`
+}
+
+type WarmPoolStatus struct {
+	Enabled bool   `json:"enabled"`
+	Image   string `json:"image,omitempty"`
+	Browser string `json:"browser,omitempty"`
+	Size    int    `json:"size"`
+	Idle    int    `json:"idle"`
+}
+
+type warmPoolConfig struct {
+	size    int
+	image   string
+	browser string
+	maxAge  time.Duration
+	// pullSecrets are those of the namespace of the pool, see imagePullSecretsAnnotation.
+	pullSecrets []string
+}
+
+// warmPoolFromEnv reads WARM_POOL_SIZE, WARM_POOL_IMAGE, WARM_POOL_BROWSER and
+// WARM_POOL_MAX_AGE. The pool is disabled without a size or image.
+func warmPoolFromEnv() warmPoolConfig {
+	cfg := warmPoolConfig{
+		image:   os.Getenv("WARM_POOL_IMAGE"),
+		browser: os.Getenv("WARM_POOL_BROWSER"),
+		maxAge:  time.Hour,
+	}
+	cfg.size, _ = strconv.Atoi(os.Getenv("WARM_POOL_SIZE"))
+	if d, err := time.ParseDuration(os.Getenv("WARM_POOL_MAX_AGE")); err == nil && d > 0 {
+		cfg.maxAge = d
+	}
+
+	return cfg
+}
+
+func (cfg warmPoolConfig) enabled() bool {
+	return cfg.size > 0 && cfg.image != ""
+}
+
+// fits reports whether a warm run can take a run. Runs with their own name, identity,
+// credentials, chaos, GPUs, shards or platform need a Job of their own.
+func (cfg warmPoolConfig) fits(spec RunSpec) bool {
+	return cfg.enabled() &&
+		spec.Image == cfg.image &&
+		spec.Browser == cfg.browser &&
+		spec.Name == "" &&
+		spec.GenerateName == "" &&
+		spec.ServiceAccountName == "" &&
+		len(spec.ImagePullSecrets) == 0 &&
+		spec.Credentials == nil &&
+		spec.Chaos == nil &&
+		spec.GPU == nil &&
+		spec.OS == "" &&
+		spec.Arch == "" &&
+		spec.Device == "" &&
+		spec.Locale == "" &&
+		spec.Timezone == "" &&
+		!spec.isMatrix() &&
+		spec.Shards <= 1
+}
+
+func newWarmJob(namespace string, cfg warmPoolConfig) (*batchv1.Job, error) {
+	job, err := newRunJob(RunSpec{
+		Namespace: namespace,
+		Image:     cfg.image,
+		Browser:   cfg.browser,
+		Command:   []string{"node", "-e", warmAgentScript},
+		Labels:    map[string]string{warmLabel: warmIdle},
+		Env: map[string]string{
+			"OPERATOR_URL": envOrDefault("WARM_POOL_OPERATOR_URL", "http://operator:8080"),
+		},
+		namespacePullSecrets: cfg.pullSecrets,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	container := &job.Spec.Template.Spec.Containers[0]
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: "POD_NAME", ValueFrom: &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+		}},
+		corev1.EnvVar{Name: "POD_NAMESPACE", ValueFrom: &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"},
+		}},
+		corev1.EnvVar{Name: "WARM_POOL_TOKEN_FILE", Value: warmTokenDir + "/token"},
+	)
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      warmTokenVolume,
+		MountPath: warmTokenDir,
+		ReadOnly:  true,
+	})
+	// a token bound to the pod, see warmAssignment
+	job.Spec.Template.Spec.Volumes = append(job.Spec.Template.Spec.Volumes, corev1.Volume{
+		Name: warmTokenVolume,
+		VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+			Sources: []corev1.VolumeProjection{{ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+				Audience:          warmTokenAudience,
+				ExpirationSeconds: ptr.To(int64(600)),
+				Path:              "token",
+			}}},
+		}},
+	})
+
+	return job, nil
+}
+
+func listIdleWarmJobs(ctx context.Context, clientset *kubernetes.Clientset, namespace string) ([]batchv1.Job, error) {
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{LabelSelector: warmLabel + "=" + warmIdle})
+	if err != nil {
+		return nil, err
+	}
+
+	var idle []batchv1.Job
+	for _, job := range jobs.Items {
+		if jobState(&job) == jobStateRunning && job.DeletionTimestamp == nil {
+			idle = append(idle, job)
+		}
+	}
+	sortJobs(idle, "creationTimestamp", true)
+
+	return idle, nil
+}
+
+// claimWarmRun hands a run to the oldest idle warm run whose pod is up. The Job the run
+// would be created as lends the claimed one its labels, annotations and TTL, and the
+// command and environment of its container, so completion hooks, previews and artifact
+// retention apply to warm runs as well. It returns nil when none is available, the run
+// is then created as a Job of its own.
+func claimWarmRun(ctx context.Context, clientset *kubernetes.Clientset, spec RunSpec, run *batchv1.Job) (*batchv1.Job, error) {
+	cfg := warmPoolFromEnv()
+	if !cfg.fits(spec) {
+		return nil, nil
+	}
+
+	idle, err := listIdleWarmJobs(ctx, clientset, spec.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range idle {
+		job := &idle[i]
+		if job.Status.Ready == nil || *job.Status.Ready == 0 {
+			continue
+		}
+
+		delete(job.Labels, warmLabel)
+		for k, v := range run.Labels {
+			job.Labels[k] = v
+		}
+		if job.Annotations == nil {
+			job.Annotations = map[string]string{}
+		}
+		for k, v := range run.Annotations {
+			job.Annotations[k] = v
+		}
+		assignment, err := json.Marshal(runAssignment(spec, run, job))
+		if err != nil {
+			return nil, err
+		}
+		job.Annotations[assignmentAnnotation] = string(assignment)
+		job.Spec.TTLSecondsAfterFinished = run.Spec.TTLSecondsAfterFinished
+
+		// the resource version of the listing makes concurrent claims of one Job conflict
+		claimed, err := clientset.BatchV1().Jobs(job.Namespace).Update(ctx, job, metav1.UpdateOptions{})
+		if apierrors.IsConflict(err) || apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		log.Printf("run %s/%s claimed from the warm pool", claimed.Namespace, claimed.Name)
+		labelRunPods(ctx, clientset, claimed)
+		return claimed, nil
+	}
+
+	return nil, nil
+}
+
+// runAssignment is the command of the container of a run for a warm run and the
+// environment the warm container lacks: the one of the spec and the values the operator
+// set on the container of the run only, e.g. for artifact retention.
+func runAssignment(spec RunSpec, run, warm *batchv1.Job) Assignment {
+	container := run.Spec.Template.Spec.Containers[0]
+	warmEnv := map[string]bool{}
+	for _, e := range warm.Spec.Template.Spec.Containers[0].Env {
+		warmEnv[e.Name] = true
+	}
+
+	env := spec.environment()
+	for _, e := range container.Env {
+		if _, ok := env[e.Name]; !ok && !warmEnv[e.Name] && e.ValueFrom == nil {
+			env[e.Name] = e.Value
+		}
+	}
+
+	return Assignment{Command: container.Command, Env: env}
+}
+
+// warmPodToken reviews the bearer token of a request for the assignment of a warm run,
+// it must be a service account token of the pod for warmTokenAudience.
+func warmPodToken(ctx context.Context, clientset *kubernetes.Clientset, r *http.Request, pod *corev1.Pod) error {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return errors.New("a service account token of the pod is required")
+	}
+
+	review, err := clientset.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token, Audiences: []string{warmTokenAudience}},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+
+	return checkWarmPodToken(review.Status, pod)
+}
+
+// checkWarmPodToken checks the review of a token against the pod it claims to be of.
+func checkWarmPodToken(status authenticationv1.TokenReviewStatus, pod *corev1.Pod) error {
+	if !status.Authenticated {
+		return fmt.Errorf("invalid token: %s", status.Error)
+	}
+	if !slices.Contains(status.Audiences, warmTokenAudience) {
+		return errors.New("the token is not for the warm pool")
+	}
+	account := pod.Spec.ServiceAccountName
+	if account == "" {
+		account = "default"
+	}
+	if status.User.Username != "system:serviceaccount:"+pod.Namespace+":"+account {
+		return errors.New("the token is not of the service account of the pod")
+	}
+	podUIDs := status.User.Extra[podUIDExtra]
+	if len(podUIDs) != 1 || podUIDs[0] != string(pod.UID) {
+		return errors.New("the token is not bound to the pod")
+	}
+
+	return nil
+}
+
+// GET /warmpool/assignment?namespace=ns&pod=name answers 204 until the run of the pod is
+// claimed. The agent authenticates with a token bound to its pod, no other caller may read
+// the assignment.
+func warmAssignment(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+
+	pod, err := clientset.CoreV1().Pods(namespace).Get(r.Context(), r.URL.Query().Get("pod"), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		writeError(w, "pod not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	if err := warmPodToken(r.Context(), clientset, r, pod); err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+authRealm+`"`)
+		writeError(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	job, err := clientset.BatchV1().Jobs(namespace).Get(r.Context(), pod.Labels["job-name"], metav1.GetOptions{})
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	data := job.Annotations[assignmentAnnotation]
+	if data == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(data))
+}
+
+// GET /warmpool?namespace=ns
+func warmPoolStatus(w http.ResponseWriter, r *http.Request, clientset *kubernetes.Clientset) {
+	cfg := warmPoolFromEnv()
+	status := WarmPoolStatus{Enabled: cfg.enabled(), Image: cfg.image, Browser: cfg.browser, Size: cfg.size}
+
+	idle, err := listIdleWarmJobs(r.Context(), clientset, getNamespace(r.URL.Query().Get("namespace")))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	status.Idle = len(idle)
+
+	respondJSON(w, status)
+}
+
+// maintainWarmPool tops the pool up to its size and replaces idle runs older than the
+// maximum age, so their image and browsers stay current.
+func maintainWarmPool(ctx context.Context, clientset *kubernetes.Clientset, namespace string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cfg := warmPoolFromEnv()
+		if !cfg.enabled() {
+			continue
+		}
+
+		idle, err := listIdleWarmJobs(ctx, clientset, namespace)
+		if err != nil {
+			log.Printf("cannot list the warm pool: %v", err)
+			continue
+		}
+
+		fresh := 0
+		for _, job := range idle {
+			if time.Since(job.CreationTimestamp.Time) < cfg.maxAge && fresh < cfg.size {
+				fresh++
+				continue
+			}
+			err := clientset.BatchV1().Jobs(namespace).Delete(ctx, job.Name, metav1.DeleteOptions{
+				PropagationPolicy: ptr.To(metav1.DeletePropagationBackground),
+			})
+			if err != nil && !apierrors.IsNotFound(err) {
+				log.Printf("cannot recycle warm run %s/%s: %v", namespace, job.Name, err)
+			}
+		}
+
+		if fresh < cfg.size {
+			if cfg.pullSecrets, err = namespaceImagePullSecrets(ctx, clientset, namespace); err != nil {
+				log.Printf("cannot read the image pull secrets of namespace %s: %v", namespace, err)
+				continue
+			}
+		}
+		for ; fresh < cfg.size; fresh++ {
+			job, err := newWarmJob(namespace, cfg)
+			if err == nil {
+				_, err = clientset.BatchV1().Jobs(namespace).Create(ctx, job, metav1.CreateOptions{})
+			}
+			if err != nil {
+				log.Printf("cannot start a warm run of %s: %v", cfg.image, err)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCheckWarmPodToken(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "tests", Name: "warm-abc", UID: "pod-uid"}}
+	review := func(update func(*authenticationv1.TokenReviewStatus)) authenticationv1.TokenReviewStatus {
+		status := authenticationv1.TokenReviewStatus{
+			Authenticated: true,
+			Audiences:     []string{warmTokenAudience},
+			User: authenticationv1.UserInfo{
+				Username: "system:serviceaccount:tests:default",
+				Extra:    map[string]authenticationv1.ExtraValue{podUIDExtra: {"pod-uid"}},
+			},
+		}
+		if update != nil {
+			update(&status)
+		}
+		return status
+	}
+
+	for _, tc := range []struct {
+		name   string
+		status authenticationv1.TokenReviewStatus
+		ok     bool
+	}{
+		{"bound to the pod", review(nil), true},
+		{"not authenticated", review(func(s *authenticationv1.TokenReviewStatus) { s.Authenticated = false }), false},
+		{"other audience", review(func(s *authenticationv1.TokenReviewStatus) { s.Audiences = []string{"https://kubernetes.default.svc"} }), false},
+		{"other namespace", review(func(s *authenticationv1.TokenReviewStatus) { s.User.Username = "system:serviceaccount:other:default" }), false},
+		{"other pod", review(func(s *authenticationv1.TokenReviewStatus) {
+			s.User.Extra[podUIDExtra] = authenticationv1.ExtraValue{"other-uid"}
+		}), false},
+		{"not bound", review(func(s *authenticationv1.TokenReviewStatus) { s.User.Extra = nil }), false},
+	} {
+		if err := checkWarmPodToken(tc.status, pod); (err == nil) != tc.ok {
+			t.Errorf("%s: checkWarmPodToken error %v, want ok %v", tc.name, err, tc.ok)
+		}
+	}
+}
+
+func TestNewWarmJobMountsPodToken(t *testing.T) {
+	job, err := newWarmJob("tests", warmPoolConfig{size: 1, image: "mcr.microsoft.com/playwright:v1.50.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var projection *corev1.ServiceAccountTokenProjection
+	for _, v := range job.Spec.Template.Spec.Volumes {
+		if v.Name == warmTokenVolume && v.Projected != nil {
+			projection = v.Projected.Sources[0].ServiceAccountToken
+		}
+	}
+	if projection == nil || projection.Audience != warmTokenAudience {
+		t.Fatalf("want a projected token for %s, got %+v", warmTokenAudience, projection)
+	}
+	mounted := false
+	for _, m := range job.Spec.Template.Spec.Containers[0].VolumeMounts {
+		mounted = mounted || m.Name == warmTokenVolume
+	}
+	if !mounted {
+		t.Error("the agent container does not mount the token")
+	}
+}
+
+func TestRunAssignmentCarriesTheRunEnvironment(t *testing.T) {
+	cfg := warmPoolConfig{size: 1, image: "mcr.microsoft.com/playwright:v1.50.0"}
+	warm, err := newWarmJob("tests", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := RunSpec{Namespace: "tests", Image: cfg.image, BaseURL: "https://shop.example.com"}
+	run, err := newRunJob(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addArtifactRetention(run, &ArtifactRetention{PassingSamplePercent: 10})
+
+	assignment := runAssignment(spec, run, warm)
+	if assignment.Env["BASE_URL"] != "https://shop.example.com" {
+		t.Errorf("env of the spec is missing: %v", assignment.Env)
+	}
+	if assignment.Env["PLAYWRIGHT_KEEP_PASSING_PERCENT"] != "10" || assignment.Env["PLAYWRIGHT_PRUNE_SCRIPT"] == "" {
+		t.Errorf("env of the artifact retention is missing: %v", assignment.Env)
+	}
+	if _, ok := assignment.Env["PLAYWRIGHT_HTML_OUTPUT_DIR"]; ok {
+		t.Errorf("env the warm container has is assigned again: %v", assignment.Env)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// httpClient makes the outgoing calls of the API, e.g. to webhooks, hooks, the directory
+// and the object store. Callers set a deadline on the context of each call, the timeout
+// of the client bounds those that do not, a stalled response body included.
+var httpClient = &http.Client{Timeout: 10 * time.Minute}
+
+// webhookTimeout bounds the delivery of an alert, so an endpoint that does not answer
+// does not stall the loop that sends it.
+const webhookTimeout = 10 * time.Second
+
+// postWebhook sends an alert as JSON. Failures are logged, alerts are best effort.
+func postWebhook(ctx context.Context, url string, payload interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("cannot encode alert for %s: %v", url, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("cannot send alert to %s: %v", url, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		log.Printf("cannot send alert to %s: %v", url, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		log.Printf("alert webhook %s answered %s", url, resp.Status)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPostWebhookGivesUpOnAHungEndpoint(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		postWebhook(ctx, server.URL, map[string]string{"status": "failed"})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("postWebhook did not return after the deadline of its context")
+	}
+}
+
+func TestSCIMListReadsAllPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Query().Get("startIndex") {
+		case "1":
+			w.Write([]byte(`{"totalResults":3,"Resources":[{"id":"1"},{"id":"2"}]}`))
+		case "3":
+			w.Write([]byte(`{"totalResults":3,"Resources":[{"id":"3"}]}`))
+		default:
+			w.Write([]byte(`{"totalResults":3,"Resources":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	client := &scimClient{base: server.URL, token: "secret"}
+	resources, err := client.list(context.Background(), "Groups", map[string][]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 3 || resources[2].ID != "3" {
+		t.Errorf("list() = %+v, want the groups 1, 2 and 3", resources)
+	}
+
+	client.token = "wrong"
+	if _, err := client.list(context.Background(), "Groups", map[string][]string{}); err == nil {
+		t.Error("list() with a rejected token succeeded")
+	}
+}
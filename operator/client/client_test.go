@@ -0,0 +1,107 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"client/internal/gen"
+)
+
+var update = flag.Bool("update", false, "regenerate generated.go from openapi.json")
+
+func TestGeneratedClient(t *testing.T) {
+	spec, err := os.ReadFile("../api/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := gen.Generate(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *update {
+		if err := os.WriteFile("generated.go", src, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	current, err := os.ReadFile("generated.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(current, src) {
+		t.Error("generated.go is out of date with openapi.json, run go generate")
+	}
+}
+
+func TestClientRequests(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/runs/a b/scan":
+			w.Write([]byte(`{"status": "clean", "files": 3}`))
+		case "/warmpool/assignment":
+			w.WriteHeader(http.StatusNoContent)
+		case "/admin/scans/abc/release":
+			w.Write([]byte(`{"status": "released"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"code": 404, "reason": "NotFound", "message": "run not found"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL + "/")
+	c.Token = "secret"
+	ctx := context.Background()
+
+	scan, err := c.GetArtifactScan(ctx, GetArtifactScanParams{ID: "a b", Namespace: "tests"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scan.Status != "clean" || scan.Files != 3 {
+		t.Errorf("scan = %+v", scan)
+	}
+	if got.URL.EscapedPath() != "/runs/a%20b/scan" || got.URL.Query().Get("namespace") != "tests" {
+		t.Errorf("requested %s", got.URL)
+	}
+	if got.Header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("Authorization = %q", got.Header.Get("Authorization"))
+	}
+
+	assignment, err := c.GetWarmAssignment(ctx, GetWarmAssignmentParams{Pod: "warm-1"})
+	if err != nil || assignment != nil {
+		t.Errorf("without assignment got %v, %v", assignment, err)
+	}
+	if got.URL.Query().Get("pod") != "warm-1" || got.URL.Query().Has("namespace") {
+		t.Errorf("requested %s", got.URL)
+	}
+
+	if _, err := c.ReleaseArtifacts(ctx, ReleaseArtifactsParams{ID: "abc"}, ScanReleaseRequest{Reason: "false positive"}); err != nil {
+		t.Fatal(err)
+	}
+	if got.Method != http.MethodPost || got.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("sent %s with %q", got.Method, got.Header.Get("Content-Type"))
+	}
+	var release ScanReleaseRequest
+	if err := json.Unmarshal(gotBody, &release); err != nil || release.Reason != "false positive" {
+		t.Errorf("sent %s", gotBody)
+	}
+
+	_, err = c.GetRun(ctx, GetRunParams{ID: "missing"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Reason != "NotFound" || apiErr.Message != "run not found" {
+		t.Errorf("error = %v", err)
+	}
+}
@@ -0,0 +1,636 @@
+// Package gen generates the operations and types of the client from the OpenAPI
+// specification of the API.
+package gen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type schema struct {
+	Ref                  string          `json:"$ref"`
+	Type                 string          `json:"type"`
+	Format               string          `json:"format"`
+	Description          string          `json:"description"`
+	Required             []string        `json:"required"`
+	Properties           json.RawMessage `json:"properties"`
+	Items                *schema         `json:"items"`
+	AdditionalProperties json.RawMessage `json:"additionalProperties"`
+	AllOf                []*schema       `json:"allOf"`
+}
+
+type parameter struct {
+	Ref         string  `json:"$ref"`
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description"`
+	Required    bool    `json:"required"`
+	Schema      *schema `json:"schema"`
+}
+
+type content map[string]struct {
+	Schema *schema `json:"schema"`
+}
+
+type response struct {
+	Ref         string  `json:"$ref"`
+	Description string  `json:"description"`
+	Content     content `json:"content"`
+}
+
+type operation struct {
+	OperationID string       `json:"operationId"`
+	Summary     string       `json:"summary"`
+	Parameters  []*parameter `json:"parameters"`
+	RequestBody *struct {
+		Content content `json:"content"`
+	} `json:"requestBody"`
+	Responses json.RawMessage `json:"responses"`
+}
+
+// object is a JSON object with its keys in the order of the document, so the generated code
+// follows the specification.
+type object struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+func decodeObject(data json.RawMessage) (object, error) {
+	obj := object{values: map[string]json.RawMessage{}}
+	if len(data) == 0 {
+		return obj, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return obj, fmt.Errorf("expected a JSON object")
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return obj, err
+		}
+		key := t.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return obj, err
+		}
+		obj.keys = append(obj.keys, key)
+		obj.values[key] = value
+	}
+
+	return obj, nil
+}
+
+type generator struct {
+	decls   []string
+	names   map[string]bool
+	imports map[string]bool
+}
+
+// Generate returns the source of the operations and types of the specification.
+func Generate(spec []byte) ([]byte, error) {
+	var doc struct {
+		Paths      json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas   json.RawMessage      `json:"schemas"`
+			Responses map[string]*response `json:"responses"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, err
+	}
+	g := &generator{names: map[string]bool{}, imports: map[string]bool{}}
+
+	schemas, err := decodeObject(doc.Components.Schemas)
+	if err != nil {
+		return nil, fmt.Errorf("schemas: %w", err)
+	}
+	for _, name := range schemas.keys {
+		g.names[goName(name)] = true
+	}
+	for _, name := range schemas.keys {
+		var s schema
+		if err := json.Unmarshal(schemas.values[name], &s); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+		if err := g.declareType(goName(name), &s); err != nil {
+			return nil, err
+		}
+	}
+
+	paths, err := decodeObject(doc.Paths)
+	if err != nil {
+		return nil, fmt.Errorf("paths: %w", err)
+	}
+	for _, path := range paths.keys {
+		methods, err := decodeObject(paths.values[path])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, method := range methods.keys {
+			var op operation
+			if err := json.Unmarshal(methods.values[method], &op); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+			if err := g.operation(strings.ToUpper(method), path, &op, doc.Components.Responses); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+		}
+	}
+
+	var src bytes.Buffer
+	src.WriteString("// Code generated by go generate from openapi.json. DO NOT EDIT.\n\npackage client\n\nimport (\n")
+	imports := make([]string, 0, len(g.imports))
+	for imp := range g.imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	for _, imp := range imports {
+		fmt.Fprintf(&src, "\t%q\n", imp)
+	}
+	src.WriteString(")\n")
+	for _, decl := range g.decls {
+		src.WriteString("\n")
+		src.WriteString(decl)
+	}
+
+	out, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting the generated code: %w\n%s", err, src.Bytes())
+	}
+
+	return out, nil
+}
+
+// declare reserves the next declaration, so types nested in it follow it.
+func (g *generator) declare() int {
+	g.decls = append(g.decls, "")
+	return len(g.decls) - 1
+}
+
+// declareType declares a component schema, as struct or as defined type.
+func (g *generator) declareType(name string, s *schema) error {
+	if isStruct(s) {
+		return g.declareStruct(name, s)
+	}
+	i := g.declare()
+	typ, err := g.goType(name+"Value", s, false)
+	if err != nil {
+		return err
+	}
+	g.decls[i] = comment(name, s.Description) + fmt.Sprintf("type %s %s\n", name, typ)
+
+	return nil
+}
+
+func isStruct(s *schema) bool {
+	return s.Ref == "" && (len(s.AllOf) > 0 || len(s.Properties) > 0)
+}
+
+func (g *generator) declareStruct(name string, s *schema) error {
+	i := g.declare()
+	var b strings.Builder
+	b.WriteString(comment(name, s.Description))
+	fmt.Fprintf(&b, "type %s struct {\n", name)
+
+	parts := s.AllOf
+	if len(parts) == 0 {
+		parts = []*schema{s}
+	}
+	for _, part := range parts {
+		if part.Ref != "" {
+			fmt.Fprintf(&b, "\t%s\n", refName(part.Ref))
+			continue
+		}
+		props, err := decodeObject(part.Properties)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		for _, prop := range props.keys {
+			var ps schema
+			if err := json.Unmarshal(props.values[prop], &ps); err != nil {
+				return fmt.Errorf("%s.%s: %w", name, prop, err)
+			}
+			required := contains(part.Required, prop)
+			field := goName(prop)
+			typ, err := g.goType(name+field, &ps, !required)
+			if err != nil {
+				return err
+			}
+			tag := prop
+			if !required {
+				tag += ",omitempty"
+			}
+			if ps.Description != "" && ps.Ref == "" {
+				b.WriteString(indent(comment("", ps.Description)))
+			}
+			fmt.Fprintf(&b, "\t%s %s `json:%q`\n", field, typ, tag)
+		}
+	}
+	b.WriteString("}\n")
+	g.decls[i] = b.String()
+
+	return nil
+}
+
+// goType returns the Go type of a schema, declaring nested structs as name. Optional
+// structs and times are pointers, so they are left out when unset.
+func (g *generator) goType(name string, s *schema, optional bool) (string, error) {
+	pointer := ""
+	if optional {
+		pointer = "*"
+	}
+
+	switch {
+	case s.Ref != "":
+		return pointer + refName(s.Ref), nil
+	case isStruct(s):
+		if g.names[name] {
+			return "", fmt.Errorf("type %s is declared twice", name)
+		}
+		g.names[name] = true
+		if err := g.declareStruct(name, s); err != nil {
+			return "", err
+		}
+		return pointer + name, nil
+	}
+
+	switch s.Type {
+	case "string":
+		switch s.Format {
+		case "date-time":
+			g.imports["time"] = true
+			return pointer + "time.Time", nil
+		case "binary":
+			return "[]byte", nil
+		}
+		return "string", nil
+	case "integer":
+		return "int", nil
+	case "number":
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		if s.Items == nil {
+			return "", fmt.Errorf("%s: array without items", name)
+		}
+		item, err := g.goType(name+"Item", s.Items, false)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + item, nil
+	case "object":
+		if len(s.AdditionalProperties) > 0 && s.AdditionalProperties[0] == '{' {
+			var value schema
+			if err := json.Unmarshal(s.AdditionalProperties, &value); err != nil {
+				return "", fmt.Errorf("%s: %w", name, err)
+			}
+			elem, err := g.goType(name+"Value", &value, false)
+			if err != nil {
+				return "", err
+			}
+			return "map[string]" + elem, nil
+		}
+	}
+
+	// free-form objects, like the Kubernetes objects the API passes on
+	g.imports["encoding/json"] = true
+	return "json.RawMessage", nil
+}
+
+// operation declares the method of an operation and the struct of its parameters.
+// WebSockets, which answer 101, are left to WebSocket clients.
+func (g *generator) operation(method, path string, op *operation, shared map[string]*response) error {
+	if op.OperationID == "" {
+		return fmt.Errorf("no operationId")
+	}
+	if bytes.Contains(op.Responses, []byte(`"101"`)) {
+		return nil
+	}
+	name := goName(op.OperationID)
+	g.imports["context"] = true
+
+	// parameters
+	var pathParams, queryParams []*parameter
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "path":
+			pathParams = append(pathParams, p)
+		case "query":
+			queryParams = append(queryParams, p)
+		default:
+			return fmt.Errorf("parameter %s in %s is not supported", p.Name, p.In)
+		}
+	}
+	paramsType := name + "Params"
+	params := map[string]string{}
+	if len(op.Parameters) > 0 {
+		if g.names[paramsType] {
+			return fmt.Errorf("type %s is declared twice", paramsType)
+		}
+		g.names[paramsType] = true
+		var b strings.Builder
+		fmt.Fprintf(&b, "// %s are the parameters of %s.\ntype %s struct {\n", paramsType, name, paramsType)
+		for _, p := range op.Parameters {
+			field := goName(p.Name)
+			typ := "string"
+			if p.Schema != nil {
+				switch p.Schema.Type {
+				case "integer":
+					typ = "int"
+				case "number":
+					typ = "float64"
+				case "boolean":
+					typ = "bool"
+				}
+			}
+			if typ != "string" && !p.Required {
+				typ = "*" + typ
+			}
+			params[p.Name] = typ
+			if p.Description != "" {
+				b.WriteString(indent(comment("", p.Description)))
+			}
+			fmt.Fprintf(&b, "\t%s %s\n", field, typ)
+		}
+		b.WriteString("}\n")
+		g.decls = append(g.decls, b.String())
+	}
+
+	// request body
+	bodyType := ""
+	if op.RequestBody != nil {
+		media, ok := op.RequestBody.Content["application/json"]
+		if !ok || media.Schema == nil {
+			return fmt.Errorf("request bodies other than JSON are not supported")
+		}
+		s := media.Schema
+		if s.Ref == "" && !isStruct(s) && s.Type == "object" && len(s.AdditionalProperties) == 0 {
+			bodyType = "interface{}"
+		} else {
+			typ, err := g.goType(name+"Request", s, false)
+			if err != nil {
+				return err
+			}
+			bodyType = typ
+		}
+	}
+
+	// responses
+	responses, err := decodeObject(op.Responses)
+	if err != nil {
+		return err
+	}
+	var ok *response
+	noContent := false
+	var others []string
+	for _, code := range responses.keys {
+		var resp response
+		if err := json.Unmarshal(responses.values[code], &resp); err != nil {
+			return err
+		}
+		if resp.Ref != "" {
+			ref := shared[strings.TrimPrefix(resp.Ref, "#/components/responses/")]
+			if ref == nil {
+				return fmt.Errorf("unknown response %s", resp.Ref)
+			}
+			resp = *ref
+		}
+		switch code {
+		case "200":
+			ok = &resp
+		case "204":
+			noContent = true
+			others = append(others, code+": "+resp.Description)
+		default:
+			others = append(others, code+": "+resp.Description)
+		}
+	}
+
+	result := ""
+	kind := "none"
+	if ok != nil && len(ok.Content) > 0 {
+		media, isJSON := ok.Content["application/json"]
+		if isJSON && len(ok.Content) == 1 && media.Schema != nil {
+			typ, err := g.goType(name+"Response", media.Schema, false)
+			if err != nil {
+				return err
+			}
+			result, kind = typ, "value"
+			if media.Schema.Ref != "" || isStruct(media.Schema) {
+				kind = "pointer"
+			}
+		} else {
+			g.imports["io"] = true
+			result, kind = "io.ReadCloser", "stream"
+		}
+	}
+
+	// method
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s sends %s %s: %s.\n", name, method, path, strings.TrimSuffix(op.Summary, "."))
+	if kind == "stream" {
+		b.WriteString("// The caller closes the returned body.\n")
+	}
+	if len(others) > 0 {
+		b.WriteString("//\n// Other responses:\n")
+		for _, other := range others {
+			fmt.Fprintf(&b, "//   - %s\n", other)
+		}
+	}
+	args := []string{"ctx context.Context"}
+	if len(op.Parameters) > 0 {
+		args = append(args, "params "+paramsType)
+	}
+	if bodyType != "" {
+		args = append(args, "body "+bodyType)
+	}
+	returns := "error"
+	switch kind {
+	case "pointer":
+		returns = "(*" + result + ", error)"
+	case "value", "stream":
+		returns = "(" + result + ", error)"
+	}
+	fmt.Fprintf(&b, "func (c *Client) %s(%s) %s {\n", name, strings.Join(args, ", "), returns)
+
+	query := "nil"
+	if len(queryParams) > 0 {
+		g.imports["net/url"] = true
+		query = "query"
+		b.WriteString("\tquery := url.Values{}\n")
+		for _, p := range queryParams {
+			field := "params." + goName(p.Name)
+			typ := params[p.Name]
+			value := field
+			if strings.HasPrefix(typ, "*") {
+				value = "*" + field
+			}
+			switch strings.TrimPrefix(typ, "*") {
+			case "int":
+				g.imports["strconv"] = true
+				value = "strconv.Itoa(" + value + ")"
+			case "float64":
+				g.imports["strconv"] = true
+				value = "strconv.FormatFloat(" + value + ", 'f', -1, 64)"
+			case "bool":
+				g.imports["strconv"] = true
+				value = "strconv.FormatBool(" + value + ")"
+			}
+			set := fmt.Sprintf("query.Set(%q, %s)", p.Name, value)
+			switch {
+			case p.Required:
+				fmt.Fprintf(&b, "\t%s\n", set)
+			case typ == "string":
+				fmt.Fprintf(&b, "\tif %s != \"\" {\n\t\t%s\n\t}\n", field, set)
+			default:
+				fmt.Fprintf(&b, "\tif %s != nil {\n\t\t%s\n\t}\n", field, set)
+			}
+		}
+	}
+
+	target, err := pathExpr(path, pathParams)
+	if err != nil {
+		return err
+	}
+	if len(pathParams) > 0 {
+		g.imports["net/url"] = true
+	}
+	body := "nil"
+	if bodyType != "" {
+		body = "body"
+	}
+	call := fmt.Sprintf("%q, %s, %s, %s", method, target, query, body)
+
+	switch kind {
+	case "none":
+		fmt.Fprintf(&b, "\t_, err := c.do(ctx, %s, nil)\n\treturn err\n", call)
+	case "stream":
+		fmt.Fprintf(&b, "\treturn c.stream(ctx, %s)\n", call)
+	default:
+		fmt.Fprintf(&b, "\tvar out %s\n", result)
+		ret := "out"
+		if kind == "pointer" {
+			ret = "&out"
+		}
+		if noContent {
+			g.imports["net/http"] = true
+			fmt.Fprintf(&b, "\tstatus, err := c.do(ctx, %s, &out)\n\tif err != nil || status == http.StatusNoContent {\n\t\treturn nil, err\n\t}\n", call)
+		} else {
+			fmt.Fprintf(&b, "\tif _, err := c.do(ctx, %s, &out); err != nil {\n\t\treturn nil, err\n\t}\n", call)
+		}
+		fmt.Fprintf(&b, "\treturn %s, nil\n", ret)
+	}
+	b.WriteString("}\n")
+	g.decls = append(g.decls, b.String())
+
+	return nil
+}
+
+// pathExpr returns the Go expression of a path with its parameters escaped.
+func pathExpr(path string, params []*parameter) (string, error) {
+	var parts []string
+	rest := path
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated parameter in %s", path)
+		}
+		name := rest[start+1 : start+end]
+		found := false
+		for _, p := range params {
+			found = found || p.Name == name
+		}
+		if !found {
+			return "", fmt.Errorf("path parameter %s is not documented", name)
+		}
+		if rest[:start] != "" {
+			parts = append(parts, fmt.Sprintf("%q", rest[:start]))
+		}
+		parts = append(parts, "url.PathEscape(params."+goName(name)+")")
+		rest = rest[start+end+1:]
+	}
+	if rest != "" {
+		parts = append(parts, fmt.Sprintf("%q", rest))
+	}
+
+	return strings.Join(parts, "+"), nil
+}
+
+func refName(ref string) string {
+	return goName(ref[strings.LastIndexByte(ref, '/')+1:])
+}
+
+// initialisms are written in capitals, as golint wants them.
+var initialisms = map[string]bool{
+	"api": true, "csv": true, "gpu": true, "html": true, "http": true, "id": true, "ip": true,
+	"json": true, "os": true, "pdf": true, "sla": true, "slo": true, "ttl": true, "uid": true,
+	"uri": true, "url": true, "xml": true,
+}
+
+// goName turns a camelCase name of the specification into an exported Go name.
+func goName(name string) string {
+	var words []string
+	start := 0
+	for i, r := range name {
+		if i > start && unicode.IsUpper(r) {
+			words = append(words, name[start:i])
+			start = i
+		}
+	}
+	words = append(words, name[start:])
+
+	var b strings.Builder
+	for _, word := range words {
+		if initialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+
+	return b.String()
+}
+
+// comment returns a doc comment of a declaration, led by its name.
+func comment(name, description string) string {
+	description = strings.TrimSpace(description)
+	if description == "" {
+		return ""
+	}
+	if name != "" {
+		description = name + ": " + description
+	}
+	var b strings.Builder
+	for _, line := range strings.Split(description, "\n") {
+		b.WriteString("// " + line + "\n")
+	}
+
+	return b.String()
+}
+
+func indent(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "\t" + strings.ReplaceAll(strings.TrimSuffix(s, "\n"), "\n", "\n\t") + "\n"
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
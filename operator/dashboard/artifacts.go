@@ -0,0 +1,323 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	checksumManifestName = "checksums.json"
+	// checksumManifestVersion 2 manifests are written and signed by the API once a run
+	// finished, version 1 ones were written here on first request.
+	checksumManifestVersion = 2
+)
+
+var resultsDir = "/playwright-results"
+
+// ChecksumManifest lists the SHA-256 digest of every file of a report directory of a run,
+// see the API. Signature is the Ed25519 signature of manifestPayload.
+type ChecksumManifest struct {
+	Version   int               `json:"version"`
+	Algorithm string            `json:"algorithm"`
+	Generated time.Time         `json:"generated"`
+	Run       RunRef            `json:"run"`
+	Files     map[string]string `json:"files"`
+	Signature string            `json:"signature,omitempty"`
+	KeyID     string            `json:"keyId,omitempty"`
+}
+
+// VerifyResult reports the differences between a run report and its manifest.
+type VerifyResult struct {
+	UID      string   `json:"uid"`
+	Valid    bool     `json:"valid"`
+	Modified []string `json:"modified,omitempty"`
+	Missing  []string `json:"missing,omitempty"`
+	Unlisted []string `json:"unlisted,omitempty"`
+}
+
+// runDir returns the results directory of a run and rejects uids escaping the results root.
+func runDir(uid string) (string, error) {
+	if uid == "" || uid == "." || uid == ".." || strings.ContainsAny(uid, `/\`) {
+		return "", fmt.Errorf("invalid run uid %q", uid)
+	}
+
+	return filepath.Join(resultsDir, uid), nil
+}
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// walkRun calls fn with the slash separated path of every report file of a run.
+func walkRun(dir string, fn func(rel, path string) error) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == checksumManifestName {
+			return nil
+		}
+
+		return fn(rel, path)
+	})
+}
+
+// manifestPayload is what the signature of a manifest covers, as the API builds it.
+func manifestPayload(m *ChecksumManifest) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "playwright-checksums v%d %s %s %s\n", m.Version, m.Run.UID, m.Algorithm, m.Generated.UTC().Format(time.RFC3339Nano))
+
+	paths := make([]string, 0, len(m.Files))
+	for p := range m.Files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		fmt.Fprintf(&b, "%s  %s\n", m.Files[p], p)
+	}
+
+	return []byte(b.String())
+}
+
+// manifestPublicKey reads the key of ARTIFACT_MANIFEST_PUBLIC_KEY, the publicKey of GET
+// /checksums/key of the API. Without it, manifests are not checked for a signature.
+func manifestPublicKey() (ed25519.PublicKey, error) {
+	v := os.Getenv("ARTIFACT_MANIFEST_PUBLIC_KEY")
+	if v == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("ARTIFACT_MANIFEST_PUBLIC_KEY must be a base64 encoded Ed25519 public key")
+	}
+
+	return key, nil
+}
+
+// checkManifest rejects manifests that are not signed with the key of the API, when the
+// dashboard has it.
+func checkManifest(manifest *ChecksumManifest) error {
+	key, err := manifestPublicKey()
+	if err != nil || key == nil {
+		return err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(manifest.Signature)
+	if err != nil || manifest.Signature == "" {
+		return errors.New("the checksum manifest is not signed")
+	}
+	if !ed25519.Verify(key, manifestPayload(manifest), signature) {
+		return errors.New("the signature of the checksum manifest does not match")
+	}
+
+	return nil
+}
+
+// fileStamp identifies the content of a file as long as nobody restores its modification
+// time, which is good enough to skip hashing files that were verified before.
+type fileStamp struct {
+	size     int64
+	modified time.Time
+}
+
+func stampOf(info fs.FileInfo) fileStamp {
+	return fileStamp{size: info.Size(), modified: info.ModTime()}
+}
+
+// maxVerifiedFiles bounds the verification cache, it starts over when it is full.
+const maxVerifiedFiles = 50000
+
+// verifications caches the checked manifests by directory and the verified digests of
+// files by path, so serving a report hashes each of its files once.
+var verifications = struct {
+	sync.Mutex
+	manifests map[string]cachedManifest
+	files     map[string]cachedDigest
+}{manifests: map[string]cachedManifest{}, files: map[string]cachedDigest{}}
+
+type cachedManifest struct {
+	stamp    fileStamp
+	manifest *ChecksumManifest
+}
+
+type cachedDigest struct {
+	stamp  fileStamp
+	digest string
+}
+
+// readChecksumManifest reads and checks the manifest of a report directory, from the
+// cache while the manifest is unchanged.
+func readChecksumManifest(dir string) (*ChecksumManifest, error) {
+	file := filepath.Join(dir, checksumManifestName)
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+
+	verifications.Lock()
+	cached, ok := verifications.manifests[dir]
+	verifications.Unlock()
+	if ok && cached.stamp == stampOf(info) {
+		return cached.manifest, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var manifest ChecksumManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	if err := checkManifest(&manifest); err != nil {
+		return nil, err
+	}
+
+	verifications.Lock()
+	if len(verifications.manifests) >= maxVerifiedFiles {
+		clear(verifications.manifests)
+	}
+	verifications.manifests[dir] = cachedManifest{stamp: stampOf(info), manifest: &manifest}
+	verifications.Unlock()
+
+	return &manifest, nil
+}
+
+// checksumManifest returns the manifest of a report directory. Runs get theirs from the
+// API once they finished, until then there is none.
+func checksumManifest(uid string) (*ChecksumManifest, error) {
+	dir, err := runDir(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	return readChecksumManifest(dir)
+}
+
+// verifyRun compares every file of a run with its stored manifest.
+func verifyRun(uid string) (*VerifyResult, error) {
+	dir, err := runDir(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := readChecksumManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VerifyResult{UID: uid}
+	seen := map[string]bool{}
+	err = walkRun(dir, func(rel, path string) error {
+		want, ok := manifest.Files[rel]
+		if !ok {
+			result.Unlisted = append(result.Unlisted, rel)
+			return nil
+		}
+		seen[rel] = true
+
+		sum, err := fileChecksum(path)
+		if err != nil {
+			return err
+		}
+		if sum != want {
+			result.Modified = append(result.Modified, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for rel := range manifest.Files {
+		if !seen[rel] {
+			result.Missing = append(result.Missing, rel)
+		}
+	}
+	sort.Strings(result.Missing)
+
+	result.Valid = len(result.Modified) == 0 && len(result.Missing) == 0
+
+	return result, nil
+}
+
+// verifyFile checks a single report file against the manifest of its run, hashing it only
+// when it changed since it was last verified. Files of runs without a manifest, like
+// running ones, or files the manifest does not list, are not verified.
+func verifyFile(dir, rel string) (string, error) {
+	manifest, err := readChecksumManifest(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	want, ok := manifest.Files[rel]
+	if !ok {
+		return "", nil
+	}
+
+	file := filepath.Join(dir, filepath.FromSlash(rel))
+	info, err := os.Stat(file)
+	if err != nil {
+		return "", err
+	}
+	verifications.Lock()
+	cached, ok := verifications.files[file]
+	verifications.Unlock()
+	if ok && cached.stamp == stampOf(info) && cached.digest == want {
+		return want, nil
+	}
+
+	sum, err := fileChecksum(file)
+	if err != nil {
+		return "", err
+	}
+	if sum != want {
+		return "", fmt.Errorf("checksum mismatch for %s", rel)
+	}
+
+	verifications.Lock()
+	if len(verifications.files) >= maxVerifiedFiles {
+		clear(verifications.files)
+	}
+	verifications.files[file] = cachedDigest{stamp: stampOf(info), digest: sum}
+	verifications.Unlock()
+
+	return sum, nil
+}
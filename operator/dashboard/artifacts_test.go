@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeSignedManifest(t *testing.T, dir string, key ed25519.PrivateKey, files map[string]string) {
+	t.Helper()
+	manifest := &ChecksumManifest{
+		Version:   checksumManifestVersion,
+		Algorithm: "sha256",
+		Generated: time.Now().UTC(),
+		Run:       RunRef{Namespace: "default", Name: "run", UID: "run-uid"},
+		Files:     map[string]string{},
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		sum, err := fileChecksum(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifest.Files[name] = sum
+	}
+	manifest.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifestPayload(manifest)))
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, checksumManifestName), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	dir := t.TempDir()
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	t.Setenv("ARTIFACT_MANIFEST_PUBLIC_KEY", base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)))
+	writeSignedManifest(t, dir, key, map[string]string{"index.html": "<html></html>"})
+
+	sum, err := verifyFile(dir, "index.html")
+	if err != nil || sum == "" {
+		t.Fatalf("verifyFile = %q, %v, want the digest", sum, err)
+	}
+	if sum, err := verifyFile(dir, "unlisted.html"); err != nil || sum != "" {
+		t.Errorf("unlisted files are not verified, got %q, %v", sum, err)
+	}
+
+	// a changed size or modification time invalidates the cached digest
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>tampered</html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyFile(dir, "index.html"); err == nil {
+		t.Error("a modified file passes")
+	}
+}
+
+func TestVerifyFileRejectsForeignManifests(t *testing.T) {
+	dir := t.TempDir()
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	other := ed25519.NewKeyFromSeed([]byte("0123456789abcdef0123456789abcdef"))
+	t.Setenv("ARTIFACT_MANIFEST_PUBLIC_KEY", base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)))
+	writeSignedManifest(t, dir, other, map[string]string{"index.html": "<html></html>"})
+
+	if _, err := verifyFile(dir, "index.html"); err == nil {
+		t.Error("a manifest signed with another key passes")
+	}
+}
+
+func TestVerifyFileWithoutManifest(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html></html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if sum, err := verifyFile(dir, "index.html"); err != nil || sum != "" {
+		t.Errorf("reports of running runs are served unverified, got %q, %v", sum, err)
+	}
+}
@@ -0,0 +1,819 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sessionCookieName = "pw_session"
+	// loginCookieName keeps the state, nonce and PKCE verifier of a login in progress.
+	loginCookieName = "pw_login"
+	loginTimeout    = 10 * time.Minute
+	// selftestSessionTTL is the lifetime of the token the operator self-test signs in with.
+	selftestSessionTTL = time.Hour
+)
+
+// authConfig signs users in with the authorization code flow of an OpenID Connect issuer
+// and calls the API with the access tokens of the signed in users, so the API checks
+// their groups or roles, and with tokens of the client credentials flow of the same
+// client otherwise. Authentication is disabled without issuer.
+type authConfig struct {
+	issuer        string
+	clientID      string
+	clientSecret  string
+	redirectURL   string
+	scopes        string
+	apiScope      string
+	allowedGroups []string
+	groupClaims   []string
+	// signOffGroups may sign off runs, everyone signed in without.
+	signOffGroups []string
+	sessionKey    []byte
+	sessionTTL    time.Duration
+	secure        bool
+	provider      *oidcProvider
+	// userClaims are looked up in the directory groups the API syncs, whose groups count
+	// like those of the claims.
+	userClaims []string
+	backend    string
+	// releaseGroups may release quarantined artifacts, everyone signed in without.
+	releaseGroups []string
+	// userTokens keeps the access tokens of the signed in users for the calls to the API.
+	userTokens *userTokenStore
+}
+
+// authConfigFromEnv reads AUTH_OIDC_ISSUER, AUTH_CLIENT_ID, AUTH_CLIENT_SECRET,
+// AUTH_REDIRECT_URL (the /auth/callback of the dashboard), AUTH_SCOPES, AUTH_API_SCOPE,
+// AUTH_ALLOWED_GROUPS, AUTH_GROUP_CLAIMS, SIGNOFF_GROUPS, DIRECTORY_USER_CLAIMS,
+// ARTIFACT_RELEASE_GROUPS, SESSION_SECRET and SESSION_TTL. Sessions do not survive
+// restarts without SESSION_SECRET.
+func authConfigFromEnv(backend string) (authConfig, error) {
+	cfg := authConfig{
+		issuer:        strings.TrimSuffix(os.Getenv("AUTH_OIDC_ISSUER"), "/"),
+		clientID:      os.Getenv("AUTH_CLIENT_ID"),
+		clientSecret:  os.Getenv("AUTH_CLIENT_SECRET"),
+		redirectURL:   os.Getenv("AUTH_REDIRECT_URL"),
+		scopes:        envOrDefault("AUTH_SCOPES", "openid profile email"),
+		apiScope:      os.Getenv("AUTH_API_SCOPE"),
+		allowedGroups: splitList(os.Getenv("AUTH_ALLOWED_GROUPS")),
+		groupClaims:   splitList(envOrDefault("AUTH_GROUP_CLAIMS", "groups,roles")),
+		signOffGroups: splitList(os.Getenv("SIGNOFF_GROUPS")),
+		sessionKey:    []byte(os.Getenv("SESSION_SECRET")),
+		userClaims:    splitList(envOrDefault("DIRECTORY_USER_CLAIMS", "email,preferred_username")),
+		backend:       backend,
+		releaseGroups: splitList(os.Getenv("ARTIFACT_RELEASE_GROUPS")),
+	}
+	if cfg.issuer == "" {
+		return cfg, nil
+	}
+	if cfg.clientID == "" || cfg.redirectURL == "" {
+		return cfg, errors.New("AUTH_OIDC_ISSUER needs AUTH_CLIENT_ID and AUTH_REDIRECT_URL")
+	}
+
+	ttl, err := time.ParseDuration(envOrDefault("SESSION_TTL", "8h"))
+	if err != nil {
+		return cfg, fmt.Errorf("invalid SESSION_TTL: %w", err)
+	}
+	cfg.sessionTTL = ttl
+	cfg.secure = strings.HasPrefix(cfg.redirectURL, "https://")
+	cfg.provider = &oidcProvider{issuer: cfg.issuer, client: &http.Client{Timeout: 10 * time.Second}}
+	cfg.userTokens = &userTokenStore{tokens: map[string]*userToken{}}
+	if len(cfg.sessionKey) == 0 {
+		cfg.sessionKey = make([]byte, 32)
+		if _, err := rand.Read(cfg.sessionKey); err != nil {
+			return cfg, err
+		}
+	}
+
+	return cfg, nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// oidcProvider holds the endpoints of the discovery document of the issuer, fetched when
+// first needed so the dashboard starts while the issuer is unavailable.
+type oidcProvider struct {
+	issuer string
+	client *http.Client
+
+	mu                    sync.Mutex
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+func (p *oidcProvider) discover(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.TokenEndpoint != "" {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("discovery of %s answered %s", p.issuer, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(p)
+}
+
+// tokenResponse is the answer of the token endpoint.
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+func (p *oidcProvider) token(ctx context.Context, form url.Values) (*tokenResponse, error) {
+	if err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint answered %s", resp.Status)
+	}
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+
+	return &token, nil
+}
+
+// Session is the signed in user, kept in a cookie signed with the session key.
+type Session struct {
+	Subject string `json:"sub"`
+	Name    string `json:"name,omitempty"`
+	// SignOff is set for users who may sign off runs.
+	SignOff bool      `json:"signOff,omitempty"`
+	Expires time.Time `json:"exp"`
+	// ReleaseArtifacts is set for users who may release quarantined artifacts.
+	ReleaseArtifacts bool `json:"releaseArtifacts,omitempty"`
+	// TokenID finds the access token of the user in userTokens.
+	TokenID string `json:"tid,omitempty"`
+}
+
+// loginState is kept in a cookie signed with the session key between the redirect to the
+// issuer and the callback.
+type loginState struct {
+	State    string    `json:"state"`
+	Nonce    string    `json:"nonce"`
+	Verifier string    `json:"verifier"`
+	Next     string    `json:"next"`
+	Expires  time.Time `json:"exp"`
+}
+
+func (cfg authConfig) sign(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	mac := hmac.New(sha256.New, cfg.sessionKey)
+	mac.Write([]byte(payload))
+
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (cfg authConfig) verify(value string, v interface{}) error {
+	payload, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return errors.New("malformed cookie")
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, cfg.sessionKey)
+	mac.Write([]byte(payload))
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return errors.New("invalid cookie signature")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func (cfg authConfig) setCookie(w http.ResponseWriter, name, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   cfg.secure,
+		// Lax, the issuer redirects back to the callback from another site
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// localPath returns next when it is a path of the dashboard, so the login cannot redirect
+// to another site.
+func localPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+
+	return next
+}
+
+// claimStrings returns the strings of a claim, nested in objects along the dots of name.
+func claimStrings(claims map[string]interface{}, name string) []string {
+	var value interface{} = claims
+	for _, part := range strings.Split(name, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[part]
+	}
+
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var values []string
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+
+	return nil
+}
+
+func (cfg authConfig) allowed(claims map[string]interface{}, directoryGroups []string) bool {
+	if len(cfg.allowedGroups) == 0 {
+		return true
+	}
+
+	return cfg.memberOf(claims, directoryGroups, cfg.allowedGroups)
+}
+
+// memberOf tells whether the claims of a token or the directory groups of its user carry
+// one of groups.
+func (cfg authConfig) memberOf(claims map[string]interface{}, directoryGroups, groups []string) bool {
+	carried := append([]string{}, directoryGroups...)
+	for _, name := range cfg.groupClaims {
+		carried = append(carried, claimStrings(claims, name)...)
+	}
+
+	for _, group := range carried {
+		for _, g := range groups {
+			if group == g {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// idTokenClaims checks the ID token of a code exchange. Its signature is not verified:
+// the dashboard received it from the token endpoint over TLS, which OpenID Connect Core
+// 3.1.3.7 accepts in place of the signature.
+func (cfg authConfig) idTokenClaims(idToken, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed ID token: %w", err)
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, fmt.Errorf("malformed ID token: %w", err)
+	}
+
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != cfg.issuer {
+		return nil, fmt.Errorf("ID token issued by %q", iss)
+	}
+	audience := false
+	switch aud := claims["aud"].(type) {
+	case string:
+		audience = aud == cfg.clientID
+	case []interface{}:
+		for _, a := range aud {
+			audience = audience || a == cfg.clientID
+		}
+	}
+	if !audience {
+		return nil, errors.New("ID token is not for this client")
+	}
+	if exp, _ := claims["exp"].(float64); time.Now().After(time.Unix(int64(exp), 0).Add(time.Minute)) {
+		return nil, errors.New("ID token expired")
+	}
+	if claimed, _ := claims["nonce"].(string); claimed != nonce {
+		return nil, errors.New("ID token for another login")
+	}
+
+	return claims, nil
+}
+
+// GET /auth/login?next=/path redirects to the issuer, which returns to /auth/callback.
+func login(w http.ResponseWriter, r *http.Request, cfg authConfig, provider *oidcProvider) {
+	if err := provider.discover(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	state := loginState{Next: localPath(r.FormValue("next")), Expires: time.Now().Add(loginTimeout)}
+	for _, s := range []*string{&state.State, &state.Nonce, &state.Verifier} {
+		v, err := randomString()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		*s = v
+	}
+	value, err := cfg.sign(state)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cfg.setCookie(w, loginCookieName, value, int(loginTimeout.Seconds()))
+
+	challenge := sha256.Sum256([]byte(state.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {cfg.clientID},
+		"redirect_uri":          {cfg.redirectURL},
+		"scope":                 {strings.TrimSpace(cfg.scopes + " " + cfg.apiScope)},
+		"state":                 {state.State},
+		"nonce":                 {state.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	http.Redirect(w, r, provider.AuthorizationEndpoint+"?"+query.Encode(), http.StatusFound)
+}
+
+// UserGroups are the groups of a user in the directory the API syncs.
+type UserGroups struct {
+	User   string   `json:"user"`
+	Groups []string `json:"groups"`
+}
+
+// directoryGroups returns the groups of the user of the claims in the directory the API
+// syncs, none without directory or if the API cannot be reached.
+func (cfg authConfig) directoryGroups(ctx context.Context, claims map[string]interface{}) []string {
+	var groups []string
+	for _, name := range cfg.userClaims {
+		for _, user := range claimStrings(claims, name) {
+			body, err := getBackend(ctx, cfg.backend+"/directory/groups?"+url.Values{"user": {user}}.Encode())
+			if err != nil {
+				log.Printf("cannot look up the directory groups of %s: %v", user, err)
+				continue
+			}
+			var found UserGroups
+			if err := json.Unmarshal(body, &found); err != nil {
+				log.Printf("cannot decode the directory groups of %s: %v", user, err)
+				continue
+			}
+			groups = append(groups, found.Groups...)
+		}
+	}
+
+	return groups
+}
+
+// GET /auth/callback?code=...&state=... exchanges the code of the issuer for an ID token
+// and starts a session for users with an allowed group or role.
+func loginCallback(w http.ResponseWriter, r *http.Request, cfg authConfig, provider *oidcProvider) {
+	var state loginState
+	c, err := r.Cookie(loginCookieName)
+	if err != nil || cfg.verify(c.Value, &state) != nil || time.Now().After(state.Expires) {
+		http.Error(w, "login expired, sign in again", http.StatusBadRequest)
+		return
+	}
+	cfg.setCookie(w, loginCookieName, "", -1)
+	if msg := r.FormValue("error"); msg != "" {
+		http.Error(w, "sign in failed: "+msg+" "+r.FormValue("error_description"), http.StatusUnauthorized)
+		return
+	}
+	if r.FormValue("state") != state.State {
+		http.Error(w, "login state does not match, sign in again", http.StatusBadRequest)
+		return
+	}
+
+	token, err := provider.token(r.Context(), url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {r.FormValue("code")},
+		"redirect_uri":  {cfg.redirectURL},
+		"client_id":     {cfg.clientID},
+		"client_secret": {cfg.clientSecret},
+		"code_verifier": {state.Verifier},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	claims, err := cfg.idTokenClaims(token.IDToken, state.Nonce)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	directoryGroups := cfg.directoryGroups(r.Context(), claims)
+	if !cfg.allowed(claims, directoryGroups) {
+		http.Error(w, "none of your groups or roles may use the dashboard", http.StatusForbidden)
+		return
+	}
+
+	session := Session{Expires: time.Now().Add(cfg.sessionTTL)}
+	session.Subject, _ = claims["sub"].(string)
+	session.Name, _ = claims["name"].(string)
+	if session.Name == "" {
+		session.Name, _ = claims["email"].(string)
+	}
+	session.SignOff = len(cfg.signOffGroups) == 0 || cfg.memberOf(claims, directoryGroups, cfg.signOffGroups)
+	session.ReleaseArtifacts = len(cfg.releaseGroups) == 0 || cfg.memberOf(claims, directoryGroups, cfg.releaseGroups)
+	if token.AccessToken != "" {
+		if session.TokenID, err = cfg.userTokens.add(token, session.Expires); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	value, err := cfg.sign(session)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cfg.setCookie(w, sessionCookieName, value, int(cfg.sessionTTL.Seconds()))
+	log.Printf("%s (%s) signed in", session.Name, session.Subject)
+
+	http.Redirect(w, r, state.Next, http.StatusFound)
+}
+
+// GET /auth/logout ends the session, and the one at the issuer when it supports it.
+func logout(w http.ResponseWriter, r *http.Request, cfg authConfig, provider *oidcProvider) {
+	var session Session
+	if c, err := r.Cookie(sessionCookieName); err == nil && cfg.verify(c.Value, &session) == nil {
+		cfg.userTokens.remove(session.TokenID)
+	}
+	cfg.setCookie(w, sessionCookieName, "", -1)
+
+	target := "/"
+	if provider.discover(r.Context()) == nil && provider.EndSessionEndpoint != "" {
+		target = provider.EndSessionEndpoint + "?" + url.Values{"client_id": {cfg.clientID}}.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// POST /auth/selftest signs the operator self-test in with the service account token the
+// API requested for its run, sent as bearer token. The API reviews the token, the session
+// carries no permissions to sign off runs or release artifacts.
+func selftestLogin(w http.ResponseWriter, r *http.Request, cfg authConfig) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		http.Error(w, "a service account token of the self-test is required", http.StatusUnauthorized)
+		return
+	}
+
+	payload, _ := json.Marshal(map[string]string{"token": token})
+	body, err := postBackend(r.Context(), cfg.backend+"/selftest/session", payload)
+	if err != nil {
+		log.Printf("rejected the sign in of the self-test: %v", err)
+		http.Error(w, "the token of the self-test was not accepted", http.StatusUnauthorized)
+		return
+	}
+	var reviewed struct {
+		Subject string `json:"subject"`
+	}
+	if err := json.Unmarshal(body, &reviewed); err != nil || reviewed.Subject == "" {
+		http.Error(w, "the API returned no self-test session", http.StatusBadGateway)
+		return
+	}
+
+	session := Session{Subject: reviewed.Subject, Name: "operator self-test", Expires: time.Now().Add(min(cfg.sessionTTL, selftestSessionTTL))}
+	value, err := cfg.sign(session)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cfg.setCookie(w, sessionCookieName, value, int(time.Until(session.Expires).Seconds()))
+	log.Printf("%s (%s) signed in", session.Name, session.Subject)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type sessionContextKey struct{}
+
+// currentSession returns the signed in user, nil without authentication.
+func currentSession(r *http.Request) *Session {
+	session, _ := r.Context().Value(sessionContextKey{}).(*Session)
+	return session
+}
+
+// sessionMiddleware requires a session on every page but the sign in. Pages redirect to
+// the sign in, htmx requests are answered with 401 and an HX-Redirect to it, so expired
+// sessions of polling pages lead there too.
+func sessionMiddleware(cfg authConfig, next http.Handler) http.Handler {
+	if cfg.issuer == "" {
+		return next
+	}
+
+	provider := cfg.provider
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /auth/login", func(w http.ResponseWriter, r *http.Request) { login(w, r, cfg, provider) })
+	mux.HandleFunc("GET /auth/callback", func(w http.ResponseWriter, r *http.Request) { loginCallback(w, r, cfg, provider) })
+	mux.HandleFunc("GET /auth/logout", func(w http.ResponseWriter, r *http.Request) { logout(w, r, cfg, provider) })
+	mux.HandleFunc("POST /auth/selftest", func(w http.ResponseWriter, r *http.Request) { selftestLogin(w, r, cfg) })
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/auth/") {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path == "/healthz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// the hosted trace viewer fetches traces from another origin, without the cookie
+		if r.URL.Path == "/traces" && validTraceToken(cfg, r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// sandboxed reports load their files without the cookie, see reportRedirect
+		if strings.HasPrefix(r.URL.Path, "/reports/") {
+			if _, ok := parseReportToken(cfg, r); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		// partners open shared runs without an account
+		if strings.HasPrefix(r.URL.Path, "/share/") && validShareToken(cfg, r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var session Session
+		if c, err := r.Cookie(sessionCookieName); err == nil && cfg.verify(c.Value, &session) == nil && time.Now().Before(session.Expires) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, &session)))
+			return
+		}
+
+		loginURL := "/auth/login?" + url.Values{"next": {r.URL.RequestURI()}}.Encode()
+		switch {
+		case r.Header.Get("HX-Request") == "true":
+			if current, err := url.Parse(r.Header.Get("HX-Current-URL")); err == nil && current.Path != "" {
+				loginURL = "/auth/login?" + url.Values{"next": {current.RequestURI()}}.Encode()
+			}
+			w.Header().Set("HX-Redirect", loginURL)
+			http.Error(w, "sign in required", http.StatusUnauthorized)
+		case r.Method == http.MethodGet || r.Method == http.MethodHead:
+			http.Redirect(w, r, loginURL, http.StatusFound)
+		default:
+			http.Error(w, "sign in required", http.StatusUnauthorized)
+		}
+	})
+}
+
+// useAPITokens makes the default client, which calls the API, authenticate its requests
+// to backend, as the API requires with authentication.
+func useAPITokens(cfg authConfig, backend string) error {
+	if cfg.issuer == "" {
+		return nil
+	}
+	target, err := url.Parse(backend)
+	if err != nil {
+		return err
+	}
+
+	http.DefaultClient.Transport = &apiTokenTransport{cfg: cfg, host: target.Host, base: http.DefaultTransport}
+
+	return nil
+}
+
+// apiTokenTransport adds the access token of the signed in user to the requests to host
+// made with the context of a page, so the API checks the groups of the user, e.g. for
+// SIGNOFF_GROUPS, and a token of the client credentials flow to the others. The user is
+// named in X-Playwright-User for the audit of the API either way. The client token is
+// reused until shortly before it expires.
+type apiTokenTransport struct {
+	cfg  authConfig
+	host string
+	base http.RoundTripper
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (t *apiTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host {
+		return t.base.RoundTrip(req)
+	}
+
+	session, _ := req.Context().Value(sessionContextKey{}).(*Session)
+	token := ""
+	if session != nil {
+		token = t.cfg.userTokens.accessToken(req.Context(), t.cfg, session.TokenID)
+	}
+	if token == "" {
+		var err error
+		if token, err = t.accessToken(req.Context()); err != nil {
+			return nil, fmt.Errorf("cannot get a token for the API: %w", err)
+		}
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	if session != nil {
+		user := session.Name
+		if user == "" {
+			user = session.Subject
+		}
+		req.Header.Set("X-Playwright-User", user)
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+func (t *apiTokenTransport) accessToken(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Now().Before(t.expires) {
+		return t.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {t.cfg.clientID},
+		"client_secret": {t.cfg.clientSecret},
+	}
+	if t.cfg.apiScope != "" {
+		form.Set("scope", t.cfg.apiScope)
+	}
+	token, err := t.cfg.provider.token(ctx, form)
+	if err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("token response without access_token")
+	}
+
+	t.token = token.AccessToken
+	t.expires = tokenExpiry(time.Now(), token.ExpiresIn)
+
+	return t.token, nil
+}
+
+// userTokenStore keeps the access and refresh tokens of the signed in users in memory, as
+// they would not fit in the session cookie. Sessions of another replica or from before a
+// restart have none and call the API with the client token, like requests without a page.
+type userTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]*userToken
+}
+
+type userToken struct {
+	// mu serializes the refreshes of the token, apart from the other users.
+	mu      sync.Mutex
+	access  string
+	refresh string
+	expires time.Time
+	// session is when the session of the token ends, and the token is forgotten.
+	session time.Time
+}
+
+// add keeps the tokens of a sign in until the session ends and returns their ID.
+func (s *userTokenStore) add(token *tokenResponse, session time.Time) (string, error) {
+	id, err := randomString()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, t := range s.tokens {
+		if now.After(t.session) {
+			delete(s.tokens, id)
+		}
+	}
+	s.tokens[id] = &userToken{
+		access:  token.AccessToken,
+		refresh: token.RefreshToken,
+		expires: tokenExpiry(now, token.ExpiresIn),
+		session: session,
+	}
+
+	return id, nil
+}
+
+func (s *userTokenStore) remove(id string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, id)
+}
+
+// accessToken returns a valid access token of the user, refreshed when it expires, empty
+// when there is none.
+func (s *userTokenStore) accessToken(ctx context.Context, cfg authConfig, id string) string {
+	if s == nil || id == "" {
+		return ""
+	}
+
+	s.mu.Lock()
+	t := s.tokens[id]
+	s.mu.Unlock()
+	if t == nil {
+		return ""
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if time.Now().Before(t.expires) {
+		return t.access
+	}
+	if t.refresh == "" {
+		s.remove(id)
+		return ""
+	}
+
+	refreshed, err := cfg.provider.token(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {t.refresh},
+		"client_id":     {cfg.clientID},
+		"client_secret": {cfg.clientSecret},
+	})
+	if err != nil || refreshed.AccessToken == "" {
+		log.Printf("cannot refresh the token of a session: %v", err)
+		s.remove(id)
+		return ""
+	}
+	t.access = refreshed.AccessToken
+	t.expires = tokenExpiry(time.Now(), refreshed.ExpiresIn)
+	if refreshed.RefreshToken != "" {
+		t.refresh = refreshed.RefreshToken
+	}
+
+	return t.access
+}
+
+// tokenExpiry is when a token of expiresIn seconds is renewed, shortly before it expires.
+func tokenExpiry(now time.Time, expiresIn int) time.Time {
+	return now.Add(time.Duration(max(expiresIn, 60)-30) * time.Second)
+}
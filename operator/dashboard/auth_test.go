@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type recordingTransport struct {
+	requests []*http.Request
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests = append(t.requests, req)
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func TestAPITokenTransportForwardsUserTokens(t *testing.T) {
+	refreshes := 0
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			w.Write([]byte(`{"token_endpoint": "http://` + r.Host + `/token"}`))
+		case "/token":
+			if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != "refresh-1" {
+				http.Error(w, "unexpected grant", http.StatusBadRequest)
+				return
+			}
+			refreshes++
+			w.Write([]byte(`{"access_token": "user-2", "refresh_token": "refresh-2", "expires_in": 300}`))
+		}
+	}))
+	defer issuer.Close()
+
+	cfg := authConfig{
+		issuer:     issuer.URL,
+		clientID:   "dashboard",
+		provider:   &oidcProvider{issuer: issuer.URL, client: issuer.Client()},
+		userTokens: &userTokenStore{tokens: map[string]*userToken{}},
+	}
+	base := &recordingTransport{}
+	transport := &apiTokenTransport{cfg: cfg, host: "api:8080", base: base, token: "client", expires: time.Now().Add(time.Hour)}
+
+	id, err := cfg.userTokens.add(&tokenResponse{AccessToken: "user-1", RefreshToken: "refresh-1", ExpiresIn: 300}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(session *Session) *http.Request {
+		ctx := context.Background()
+		if session != nil {
+			ctx = context.WithValue(ctx, sessionContextKey{}, session)
+		}
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://api:8080/jobs", nil)
+		if _, err := transport.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+		return base.requests[len(base.requests)-1]
+	}
+
+	req := call(&Session{Name: "Alice", TokenID: id})
+	if got := req.Header.Get("Authorization"); got != "Bearer user-1" {
+		t.Errorf("request of a page authenticated with %q, want the token of the user", got)
+	}
+	if got := req.Header.Get("X-Playwright-User"); got != "Alice" {
+		t.Errorf("X-Playwright-User = %q", got)
+	}
+
+	if got := call(nil).Header.Get("Authorization"); got != "Bearer client" {
+		t.Errorf("request without a page authenticated with %q, want the client token", got)
+	}
+	if got := call(&Session{Name: "Bob", TokenID: "unknown"}).Header.Get("Authorization"); got != "Bearer client" {
+		t.Errorf("session without a token authenticated with %q, want the client token", got)
+	}
+
+	cfg.userTokens.tokens[id].expires = time.Now().Add(-time.Second)
+	if got := call(&Session{Name: "Alice", TokenID: id}).Header.Get("Authorization"); got != "Bearer user-2" || refreshes != 1 {
+		t.Errorf("expired token authenticated with %q after %d refreshes, want the refreshed one", got, refreshes)
+	}
+
+	cfg.userTokens.remove(id)
+	if got := call(&Session{Name: "Alice", TokenID: id}).Header.Get("Authorization"); got != "Bearer client" {
+		t.Errorf("signed out session authenticated with %q, want the client token", got)
+	}
+}
+
+func TestSelftestLogin(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Token string `json:"token"`
+		}
+		if r.URL.Path != "/selftest/session" || json.NewDecoder(r.Body).Decode(&req) != nil || req.Token != "sa-token" {
+			http.Error(w, `{"error": {"message": "invalid token"}}`, http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"subject": "system:serviceaccount:default:playwright-selftest", "namespace": "default"}`))
+	}))
+	defer api.Close()
+
+	cfg := authConfig{issuer: "https://issuer.example", sessionKey: []byte("secret"), sessionTTL: 8 * time.Hour, backend: api.URL}
+	handler := sessionMiddleware(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if session := currentSession(r); session == nil || session.SignOff || session.ReleaseArtifacts {
+			t.Errorf("session = %+v, want one of the self-test without permissions", session)
+		}
+	}))
+	login := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/selftest", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := login("other-token"); rec.Code != http.StatusUnauthorized || len(rec.Result().Cookies()) != 0 {
+		t.Errorf("a token the API rejects answered %d with cookies %v", rec.Code, rec.Result().Cookies())
+	}
+
+	rec := login("sa-token")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("sign in answered %d: %s", rec.Code, rec.Body)
+	}
+	cookie := rec.Result().Cookies()[0]
+	if cookie.Name != sessionCookieName || cookie.MaxAge > int(selftestSessionTTL.Seconds()) {
+		t.Errorf("cookie = %+v, want a session of at most the lifetime of the token", cookie)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("pages answered %d to the self-test, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type LogBookmark struct {
+	ID        string    `json:"id"`
+	Pod       string    `json:"pod"`
+	Container string    `json:"container"`
+	From      int       `json:"from"`
+	To        int       `json:"to"`
+	Note      string    `json:"note"`
+	By        string    `json:"by"`
+	Created   time.Time `json:"created"`
+}
+
+// LogLine is a numbered line of the logs page, with the notes of the bookmarks starting
+// at it. Lines collapsed by a log filter are folded into one line naming the filter.
+type LogLine struct {
+	Number      int
+	Text        string
+	Highlighted bool
+	Notes       []LogBookmark
+	Filter      string
+	Folded      []LogLine
+}
+
+func loadBookmarks(ctx context.Context, backend string, run *RunRef, pod string) ([]LogBookmark, error) {
+	query := url.Values{"namespace": {run.Namespace}, "pod": {pod}}
+	body, err := callBackend(ctx, fmt.Sprintf("%s/runs/%s/bookmarks?%s", backend, url.PathEscape(run.UID), query.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	var bookmarks []LogBookmark
+	if err := json.Unmarshal(body, &bookmarks); err != nil {
+		return nil, err
+	}
+
+	return bookmarks, nil
+}
+
+// logLines numbers the logs of a container and marks the bookmarked ranges.
+func logLines(logs, container string, bookmarks []LogBookmark) []LogLine {
+	text := strings.Split(strings.TrimSuffix(logs, "\n"), "\n")
+	lines := make([]LogLine, len(text))
+	for i, t := range text {
+		lines[i] = LogLine{Number: i + 1, Text: t}
+	}
+
+	for _, b := range bookmarks {
+		if b.Container != container || b.From > len(lines) {
+			continue
+		}
+		lines[b.From-1].Notes = append(lines[b.From-1].Notes, b)
+		for n := b.From; n <= b.To && n <= len(lines); n++ {
+			lines[n-1].Highlighted = true
+		}
+	}
+
+	return lines
+}
+
+func logsPageURL(run *RunRef, pod, container, fragment string) string {
+	query := url.Values{"namespace": {run.Namespace}}
+	if container != "" {
+		query.Set("container", container)
+	}
+
+	target := "/runs/" + run.UID + "/logs/" + url.PathEscape(pod) + "?" + query.Encode()
+	if fragment != "" {
+		target += "#" + fragment
+	}
+
+	return target
+}
+
+// POST /runs/{id}/logs/{pod}/bookmarks with the form fields from, to, note, by and container
+func addBookmark(w http.ResponseWriter, r *http.Request, backend string) {
+	run := lookupRun(w, r, backend)
+	if run == nil {
+		return
+	}
+
+	from, _ := strconv.Atoi(r.FormValue("from"))
+	to, _ := strconv.Atoi(r.FormValue("to"))
+	bookmark := LogBookmark{
+		Pod:       r.PathValue("pod"),
+		Container: r.FormValue("container"),
+		From:      from,
+		To:        to,
+		Note:      r.FormValue("note"),
+		By:        r.FormValue("by"),
+	}
+
+	payload, err := json.Marshal(bookmark)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	query := url.Values{"namespace": {run.Namespace}}
+	if _, err := postBackend(r.Context(), fmt.Sprintf("%s/runs/%s/bookmarks?%s", backend, url.PathEscape(run.UID), query.Encode()), payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, logsPageURL(run, bookmark.Pod, bookmark.Container, "L"+strconv.Itoa(from)), http.StatusSeeOther)
+}
+
+// POST /runs/{id}/logs/{pod}/bookmarks/{bookmark}/delete, as forms cannot send DELETE
+func removeBookmark(w http.ResponseWriter, r *http.Request, backend string) {
+	run := lookupRun(w, r, backend)
+	if run == nil {
+		return
+	}
+
+	query := url.Values{"namespace": {run.Namespace}}
+	target := fmt.Sprintf("%s/runs/%s/bookmarks/%s?%s", backend, url.PathEscape(run.UID), url.PathEscape(r.PathValue("bookmark")), query.Encode())
+	if err := deleteBackend(r.Context(), target); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, logsPageURL(run, r.PathValue("pod"), r.FormValue("container"), ""), http.StatusSeeOther)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/url"
+)
+
+// Breadcrumb is one level of the namespace → suite → run → pod → logs navigation. The
+// last crumb is the current page and has no URL.
+type Breadcrumb struct {
+	Title string
+	URL   string
+}
+
+type IndexView struct {
+	Namespace string
+	// Namespaces are offered to pick from, see loadNamespaces.
+	Namespaces  []string
+	Suite       string
+	Breadcrumbs []Breadcrumb
+	// LabelSelector, Status and Search narrow the job list, see statusChips.
+	LabelSelector string
+	Status        string
+	StatusChips   []FilterChip
+	Search        string
+	// Sort and Order are the order of the job list, see sortChips.
+	Sort      string
+	Order     string
+	SortChips []FilterChip
+}
+
+func listURL(namespace, suite string) string {
+	query := url.Values{"namespace": {namespace}}
+	if suite != "" {
+		query.Set("suite", suite)
+	}
+
+	return "/?" + query.Encode()
+}
+
+func runURL(run *RunRef) string {
+	return "/runs/" + run.UID + "?" + url.Values{"namespace": {run.Namespace}}.Encode()
+}
+
+// listBreadcrumbs leads to the job list of a namespace, optionally narrowed to a suite.
+func listBreadcrumbs(namespace, suite string) []Breadcrumb {
+	crumbs := []Breadcrumb{{Title: namespace, URL: listURL(namespace, "")}}
+	if suite != "" {
+		crumbs = append(crumbs, Breadcrumb{Title: suite, URL: listURL(namespace, suite)})
+	}
+
+	return crumbs
+}
+
+func currentPage(crumbs []Breadcrumb) []Breadcrumb {
+	crumbs[len(crumbs)-1].URL = ""
+
+	return crumbs
+}
+
+// runBreadcrumbs leads to a run and, if pod is set, to the logs of one of its pods.
+func runBreadcrumbs(run *RunRef, suite, pod string) []Breadcrumb {
+	crumbs := append(listBreadcrumbs(run.Namespace, suite), Breadcrumb{Title: run.Name, URL: runURL(run)})
+	if pod != "" {
+		crumbs = append(crumbs, Breadcrumb{Title: pod, URL: runURL(run)}, Breadcrumb{Title: "logs"})
+	}
+
+	return currentPage(crumbs)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// browsers are the browsers the API has a sandbox for, offered when cloning a run.
+var browsers = []string{"chromium", "chromium-sandbox", "firefox", "webkit"}
+
+// RunSpec is the part of the stored spec of a run that the clone form shows.
+type RunSpec struct {
+	Image   string            `json:"image"`
+	Command []string          `json:"command"`
+	Browser string            `json:"browser"`
+	Grep    string            `json:"grep"`
+	BaseURL string            `json:"baseURL"`
+	Suite   string            `json:"suite"`
+	Branch  string            `json:"branch"`
+	Env     map[string]string `json:"env"`
+}
+
+type CloneView struct {
+	Run         *RunRef
+	Breadcrumbs []Breadcrumb
+	Spec        RunSpec
+	Browsers    []string
+	CSRFToken   string
+	Error       string
+}
+
+func loadRunSpec(ctx context.Context, backend string, run *RunRef) (RunSpec, error) {
+	query := url.Values{"namespace": {run.Namespace}}
+	body, err := getBackend(ctx, fmt.Sprintf("%s/runs/%s/spec?%s", backend, url.PathEscape(run.UID), query.Encode()))
+	if err != nil {
+		return RunSpec{}, err
+	}
+
+	var spec RunSpec
+	err = json.Unmarshal(body, &spec)
+
+	return spec, err
+}
+
+func renderClone(w http.ResponseWriter, r *http.Request, run *RunRef, spec RunSpec, message string) {
+	crumbs := append(listBreadcrumbs(run.Namespace, spec.Suite),
+		Breadcrumb{Title: run.Name, URL: runURL(run)}, Breadcrumb{Title: "clone"})
+
+	renderTemplate(w, "run_clone.html", CloneView{
+		Run:         run,
+		Breadcrumbs: currentPage(crumbs),
+		Spec:        spec,
+		Browsers:    browsers,
+		CSRFToken:   csrfToken(r),
+		Error:       message,
+	})
+}
+
+// GET /runs/{id}/clone?namespace=ns shows the parameters of a run for starting a
+// modified copy of it.
+func clonePage(w http.ResponseWriter, r *http.Request, backend string) {
+	run := lookupRun(w, r, backend)
+	if run == nil {
+		return
+	}
+
+	spec, err := loadRunSpec(r.Context(), backend, run)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	renderClone(w, r, run, spec, "")
+}
+
+// POST /runs/{id}/clone with the form fields grep, browser and baseURL starts the copy
+// and leads to it. Errors show the form again with the values entered.
+func startClone(w http.ResponseWriter, r *http.Request, backend string) {
+	run := lookupRun(w, r, backend)
+	if run == nil {
+		return
+	}
+
+	overrides := map[string]string{
+		"grep":    r.FormValue("grep"),
+		"browser": r.FormValue("browser"),
+		"baseURL": r.FormValue("baseURL"),
+	}
+	payload, err := json.Marshal(overrides)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	query := url.Values{"namespace": {run.Namespace}}
+	body, err := postBackend(r.Context(), fmt.Sprintf("%s/runs/%s/clone?%s", backend, url.PathEscape(run.UID), query.Encode()), payload)
+	if err != nil {
+		spec, specErr := loadRunSpec(r.Context(), backend, run)
+		if specErr != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		spec.Grep, spec.Browser, spec.BaseURL = overrides["grep"], overrides["browser"], overrides["baseURL"]
+		renderClone(w, r, run, spec, err.Error())
+		return
+	}
+
+	var created Job
+	if err := json.Unmarshal(body, &created); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	http.Redirect(w, r, runURL(&RunRef{Namespace: created.Metadata.Namespace, UID: created.Metadata.UID}), http.StatusSeeOther)
+}
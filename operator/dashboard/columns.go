@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const columnsCookie = "job_columns"
+
+// jobColumns lists the optional job list columns in display order.
+var jobColumns = []struct {
+	Name  string
+	Title string
+}{
+	{"namespace", "Namespace"},
+	{"suite", "Suite"},
+	{"branch", "Branch"},
+	{"duration", "Duration"},
+	{"counts", "Passed/Failed"},
+	{"owner", "Owner"},
+	{"platform", "Platform"},
+}
+
+// defaultColumns is used when JOB_LIST_COLUMNS is not set.
+var defaultColumns = []string{"suite", "duration"}
+
+type JobSummary struct {
+	Suite    string `json:"suite"`
+	Branch   string `json:"branch"`
+	Owner    string `json:"owner"`
+	Platform string `json:"platform"`
+	Duration string `json:"duration"`
+	Passed   int    `json:"passed"`
+	Failed   int    `json:"failed"`
+
+	SupersededBy string `json:"supersededBy"`
+}
+
+type JobColumn struct {
+	Name     string
+	Title    string
+	Selected bool
+}
+
+type JobListView struct {
+	Jobs    []Job
+	Columns []string
+	// Outcomes holds the last finished runs per suite, oldest first.
+	Outcomes map[string][]RunOutcome
+	// Continue is the token of the next page, empty on the last one.
+	Continue string
+	// Watch is the event stream keeping the first page up to date.
+	Watch string
+	// Filtered is set when a label selector, status or search narrows the list.
+	Filtered bool
+}
+
+// JobItemView renders one job of the list, SwapOOB is the hx-swap-oob of a pushed job.
+type JobItemView struct {
+	Job
+	Columns  []string
+	Outcomes map[string][]RunOutcome
+	SwapOOB  string
+}
+
+func (v JobListView) Items() []JobItemView {
+	items := make([]JobItemView, len(v.Jobs))
+	for i, job := range v.Jobs {
+		items[i] = JobItemView{Job: job, Columns: v.Columns, Outcomes: v.Outcomes}
+	}
+
+	return items
+}
+
+// parseColumns keeps the known column names of a comma separated list, in display order.
+func parseColumns(v string) []string {
+	wanted := map[string]bool{}
+	for _, name := range strings.Split(v, ",") {
+		wanted[strings.TrimSpace(name)] = true
+	}
+
+	columns := []string{}
+	for _, c := range jobColumns {
+		if wanted[c.Name] {
+			columns = append(columns, c.Name)
+		}
+	}
+
+	return columns
+}
+
+// columnsFor returns the columns chosen by the user, falling back to the ones configured
+// by the administrator through JOB_LIST_COLUMNS.
+func columnsFor(r *http.Request) []string {
+	if cookie, err := r.Cookie(columnsCookie); err == nil {
+		return parseColumns(cookie.Value)
+	}
+
+	if v, ok := os.LookupEnv("JOB_LIST_COLUMNS"); ok {
+		return parseColumns(v)
+	}
+
+	return defaultColumns
+}
+
+func columnChoices(columns []string) []JobColumn {
+	selected := map[string]bool{}
+	for _, name := range columns {
+		selected[name] = true
+	}
+
+	var choices []JobColumn
+	for _, c := range jobColumns {
+		choices = append(choices, JobColumn{Name: c.Name, Title: c.Title, Selected: selected[c.Name]})
+	}
+
+	return choices
+}
+
+// setColumns stores the columns of the form as the user's preference for a year.
+func setColumns(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	columns := parseColumns(strings.Join(r.Form["columns"], ","))
+	http.SetCookie(w, &http.Cookie{
+		Name:     columnsCookie,
+		Value:    strings.Join(columns, ","),
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	w.Header().Set("HX-Trigger", "columns-changed")
+	renderTemplate(w, "columns.html", columnChoices(columns))
+}
+
+// Column returns the value of a job list column.
+func (j Job) Column(name string) string {
+	switch name {
+	case "namespace":
+		return j.Metadata.Namespace
+	case "suite":
+		return j.Summary.Suite
+	case "branch":
+		return j.Summary.Branch
+	case "duration":
+		return j.Summary.Duration
+	case "counts":
+		return strconv.Itoa(j.Summary.Passed) + "/" + strconv.Itoa(j.Summary.Failed)
+	case "owner":
+		return j.Summary.Owner
+	case "platform":
+		return j.Summary.Platform
+	}
+
+	return ""
+}
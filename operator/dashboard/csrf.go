@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	csrfCookieName = "csrf_token"
+	csrfHeaderName = "X-CSRF-Token"
+	csrfFormField  = "csrf_token"
+)
+
+type csrfContextKey struct{}
+
+type csrfConfig struct {
+	sameSite http.SameSite
+	secure   bool
+}
+
+// csrfConfigFromEnv reads CSRF_COOKIE_SAMESITE (strict, lax or none) and CSRF_COOKIE_SECURE.
+func csrfConfigFromEnv() csrfConfig {
+	cfg := csrfConfig{
+		sameSite: http.SameSiteStrictMode,
+		secure:   os.Getenv("CSRF_COOKIE_SECURE") == "true",
+	}
+
+	switch strings.ToLower(os.Getenv("CSRF_COOKIE_SAMESITE")) {
+	case "lax":
+		cfg.sameSite = http.SameSiteLaxMode
+	case "none":
+		// browsers drop SameSite=None cookies that are not Secure
+		cfg.sameSite = http.SameSiteNoneMode
+		cfg.secure = true
+	}
+
+	return cfg
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// csrfToken returns the token of the current session, for server rendered forms
+// that post the token in the csrf_token field.
+func csrfToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfContextKey{}).(string)
+	return token
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+
+	return false
+}
+
+// sameOrigin rejects cross-site requests that announce themselves with an Origin header.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return u.Host == r.Host
+}
+
+// csrfMiddleware issues a per-session token in a cookie and requires mutating requests
+// to echo it in the X-CSRF-Token header (sent by static/csrf.js for htmx requests) or
+// in the csrf_token form field.
+func csrfMiddleware(cfg csrfConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var token string
+		if c, err := r.Cookie(csrfCookieName); err == nil && c.Value != "" {
+			token = c.Value
+		} else {
+			token, err = newCSRFToken()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookieName,
+				Value:    token,
+				Path:     "/",
+				SameSite: cfg.sameSite,
+				Secure:   cfg.secure,
+			})
+		}
+
+		if !isSafeMethod(r.Method) {
+			sent := r.Header.Get(csrfHeaderName)
+			if sent == "" {
+				sent = r.PostFormValue(csrfFormField)
+			}
+
+			if !sameOrigin(r) || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				http.Error(w, "invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfContextKey{}, token)))
+	})
+}
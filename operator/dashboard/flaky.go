@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// outcomeStripRuns are the latest runs of a test shown in its outcome strip.
+	outcomeStripRuns = 30
+	trendChartWidth  = 300
+	trendChartHeight = 40
+)
+
+// FlakyTest is a test that alternated between passing and failing, see getFlakyTests of
+// the API.
+type FlakyTest struct {
+	File     string   `json:"file"`
+	Title    string   `json:"title"`
+	Project  string   `json:"project,omitempty"`
+	Runs     int      `json:"runs"`
+	Failed   int      `json:"failed"`
+	Flaky    int      `json:"flaky"`
+	Flips    int      `json:"flips"`
+	Rate     float64  `json:"rate"`
+	Outcomes []string `json:"outcomes"`
+}
+
+type FlakinessDay struct {
+	Day  string  `json:"day"`
+	Rate float64 `json:"rate"`
+}
+
+type FlakyTestsResponse struct {
+	Namespace string         `json:"namespace"`
+	Suite     string         `json:"suite"`
+	Window    string         `json:"window"`
+	Runs      int            `json:"runs"`
+	Tests     []FlakyTest    `json:"tests"`
+	Trend     []FlakinessDay `json:"trend"`
+}
+
+// OutcomeMark is a run of a test in its outcome strip.
+type OutcomeMark struct {
+	X     int
+	Color string
+	Title string
+}
+
+type FlakyTestView struct {
+	FlakyTest
+	RatePercent string
+	Strip       []OutcomeMark
+}
+
+type FlakyPageView struct {
+	Namespace   string
+	Suite       string
+	Window      string
+	Runs        int
+	Breadcrumbs []Breadcrumb
+	Tests       []FlakyTestView
+	// Trend are the SVG polyline points of the daily share of unstable results, Peak the
+	// highest share as a percentage.
+	Trend      string
+	Peak       string
+	From       string
+	To         string
+	StripWidth int
+}
+
+var outcomeColors = map[string]string{"passed": "#198754", "failed": "#dc3545", "flaky": "#fd7e14"}
+
+func loadFlakyTests(ctx context.Context, backend, namespace, suite, window string) (*FlakyTestsResponse, error) {
+	query := url.Values{"namespace": {namespace}, "suite": {suite}}
+	if window != "" {
+		query.Set("window", window)
+	}
+	body, err := getBackend(ctx, backend+"/tests/flaky?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	var flaky FlakyTestsResponse
+	if err := json.Unmarshal(body, &flaky); err != nil {
+		return nil, err
+	}
+
+	return &flaky, nil
+}
+
+// outcomeStrip marks the latest runs of a test, the newest to the right.
+func outcomeStrip(outcomes []string) []OutcomeMark {
+	outcomes = outcomes[max(len(outcomes)-outcomeStripRuns, 0):]
+
+	marks := make([]OutcomeMark, 0, len(outcomes))
+	for i, outcome := range outcomes {
+		marks = append(marks, OutcomeMark{X: i * 4, Color: outcomeColors[outcome], Title: outcome})
+	}
+
+	return marks
+}
+
+// trendPoints plots the daily share of unstable results, scaled to the peak.
+func trendPoints(trend []FlakinessDay) (string, float64) {
+	var peak float64
+	for _, day := range trend {
+		peak = max(peak, day.Rate)
+	}
+
+	var points []string
+	for i, day := range trend {
+		x := 0.0
+		if len(trend) > 1 {
+			x = float64(i) / float64(len(trend)-1) * trendChartWidth
+		}
+		y := float64(trendChartHeight)
+		if peak > 0 {
+			y -= day.Rate / peak * trendChartHeight
+		}
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+
+	return strings.Join(points, " "), peak
+}
+
+// GET /suites/{name}/flaky?namespace=ns&window=30d
+func flakyTestsPage(w http.ResponseWriter, r *http.Request, backend string) {
+	namespace := getNamespace(r.FormValue("namespace"))
+	suite := r.PathValue("name")
+	flaky, err := loadFlakyTests(r.Context(), backend, namespace, suite, r.FormValue("window"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	view := FlakyPageView{
+		Namespace:   namespace,
+		Suite:       suite,
+		Window:      flaky.Window,
+		Runs:        flaky.Runs,
+		Breadcrumbs: currentPage(append(listBreadcrumbs(namespace, suite), Breadcrumb{Title: "flaky tests"})),
+		StripWidth:  outcomeStripRuns * 4,
+	}
+	for _, test := range flaky.Tests {
+		view.Tests = append(view.Tests, FlakyTestView{
+			FlakyTest:   test,
+			RatePercent: fmt.Sprintf("%.0f%%", test.Rate*100),
+			Strip:       outcomeStrip(test.Outcomes),
+		})
+	}
+	if len(flaky.Trend) > 0 {
+		points, peak := trendPoints(flaky.Trend)
+		view.Trend = points
+		view.Peak = fmt.Sprintf("%.0f%%", peak*100)
+		view.From = flaky.Trend[0].Day
+		view.To = flaky.Trend[len(flaky.Trend)-1].Day
+	}
+
+	renderTemplate(w, "flaky.html", view)
+}
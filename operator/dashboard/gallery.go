@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Artifact is a trace, video or screenshot of a test, see getRunArtifacts of the API. Its
+// paths are served below /live/<uid>/.
+type Artifact struct {
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	Kind     string    `json:"kind"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Poster   string    `json:"poster,omitempty"`
+	Preview  string    `json:"preview,omitempty"`
+	// SizeText is Size for people.
+	SizeText string `json:"-"`
+}
+
+// TestArtifacts are the artifacts of one attempt of a test.
+type TestArtifacts struct {
+	Test      string     `json:"test"`
+	Shard     *int       `json:"shard,omitempty"`
+	Failed    bool       `json:"failed"`
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+type RunArtifacts struct {
+	RunRef
+	Tests []TestArtifacts `json:"tests"`
+}
+
+// ArtifactsView is the gallery of a run narrowed to the tests whose name contains Test,
+// the artifacts of kind Kind and, with Failed, the failed tests.
+type ArtifactsView struct {
+	Run         *RunRef
+	Breadcrumbs []Breadcrumb
+	Tests       []TestArtifacts
+	// Total counts the tests of the run before filtering.
+	Total  int
+	Test   string
+	Kind   string
+	Failed bool
+	// TraceViewer is set when traces open in a viewer, see openTrace.
+	TraceViewer bool
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
+
+// filterArtifacts keeps the tests whose name contains test, ignoring case, that have
+// artifacts of kind. Only failed tests are kept with failed.
+func filterArtifacts(tests []TestArtifacts, test, kind string, failed bool) []TestArtifacts {
+	var filtered []TestArtifacts
+	for _, t := range tests {
+		if failed && !t.Failed {
+			continue
+		}
+		if test != "" && !strings.Contains(strings.ToLower(t.Test), strings.ToLower(test)) {
+			continue
+		}
+
+		artifacts := []Artifact{}
+		for _, a := range t.Artifacts {
+			if kind == "" || a.Kind == kind {
+				a.SizeText = formatSize(a.Size)
+				artifacts = append(artifacts, a)
+			}
+		}
+		if len(artifacts) == 0 {
+			continue
+		}
+		t.Artifacts = artifacts
+		filtered = append(filtered, t)
+	}
+
+	return filtered
+}
+
+// GET /runs/{id}/artifacts?namespace=ns&test=q&kind=trace|video|screenshot&failed=true
+func runArtifactsPage(w http.ResponseWriter, r *http.Request, backend string) {
+	run := lookupRun(w, r, backend)
+	if run == nil {
+		return
+	}
+
+	body, err := callBackend(r.Context(), backend+"/runs/"+url.PathEscape(run.UID)+"/artifacts?"+url.Values{"namespace": {run.Namespace}}.Encode())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	var artifacts RunArtifacts
+	if err := json.Unmarshal(body, &artifacts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	details, err := loadJobDetails(r.Context(), backend, run.Namespace, run.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	query := r.URL.Query()
+	view := ArtifactsView{
+		Run: run,
+		Breadcrumbs: currentPage(append(listBreadcrumbs(run.Namespace, details.Job.Labels["playwright.operator/suite"]),
+			Breadcrumb{Title: run.Name, URL: runURL(run)}, Breadcrumb{Title: "artifacts"})),
+		Total:  len(artifacts.Tests),
+		Test:   query.Get("test"),
+		Kind:   query.Get("kind"),
+		Failed: query.Get("failed") == "true",
+	}
+	view.Tests = filterArtifacts(artifacts.Tests, view.Test, view.Kind, view.Failed)
+	view.TraceViewer = reportTraceViewer(details) != "" || traceViewerURL() != ""
+
+	renderTemplate(w, "run_artifacts.html", view)
+}
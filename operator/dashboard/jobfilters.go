@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/url"
+)
+
+// jobStatusFilters are the chips narrowing the job list to the runs in a state, see the
+// status parameter of /jobs of the API.
+var jobStatusFilters = []struct{ Title, Status string }{
+	{"All", ""},
+	{"Running", "running"},
+	{"Succeeded", "succeeded"},
+	{"Failed", "failed"},
+}
+
+// jobSortColumns are the chips ordering the job list, see the sort parameter of /jobs of
+// the API. The API lists the newest, longest and most failed runs first by default.
+var jobSortColumns = []struct{ Title, Sort string }{
+	{"Created", "creationTimestamp"},
+	{"Duration", "duration"},
+	{"Failures", "failures"},
+}
+
+// FilterChip links to the job list with a filter applied.
+type FilterChip struct {
+	Title  string
+	URL    string
+	Active bool
+}
+
+// listQuery is the query of the job list of a namespace with the filters and the order of
+// the request, which the chips keep when they change one of them.
+func listQuery(namespace string, form url.Values) url.Values {
+	query := url.Values{"namespace": {namespace}}
+	setJobFilters(query, form)
+	setJobSort(query, form)
+
+	return query
+}
+
+func statusChips(list url.Values) []FilterChip {
+	var chips []FilterChip
+	for _, f := range jobStatusFilters {
+		query := cloneQuery(list)
+		query.Del("status")
+		if f.Status != "" {
+			query.Set("status", f.Status)
+		}
+		chips = append(chips, FilterChip{Title: f.Title, URL: "/?" + query.Encode(), Active: f.Status == list.Get("status")})
+	}
+
+	return chips
+}
+
+// sortChips order the job list by a column, the chip of the current order flips it.
+func sortChips(list url.Values) []FilterChip {
+	current := list.Get("sort")
+	if current == "" {
+		current = "creationTimestamp"
+	}
+	ascending := list.Get("order") == "asc"
+
+	var chips []FilterChip
+	for _, c := range jobSortColumns {
+		query := cloneQuery(list)
+		query.Set("sort", c.Sort)
+		query.Set("order", "desc")
+		chip := FilterChip{Title: c.Title, Active: c.Sort == current}
+		if chip.Active {
+			if ascending {
+				chip.Title += " ↑"
+			} else {
+				chip.Title += " ↓"
+				query.Set("order", "asc")
+			}
+		}
+		chip.URL = "/?" + query.Encode()
+		chips = append(chips, chip)
+	}
+
+	return chips
+}
+
+func cloneQuery(query url.Values) url.Values {
+	clone := url.Values{}
+	for k, v := range query {
+		clone[k] = append([]string(nil), v...)
+	}
+
+	return clone
+}
+
+// setJobFilters copies the filters of the job list from the request to the query of the
+// API.
+func setJobFilters(query url.Values, form url.Values) {
+	for _, key := range []string{"suite", "labelSelector", "status", "search"} {
+		if v := form.Get(key); v != "" {
+			query.Set(key, v)
+		}
+	}
+}
+
+// setJobSort copies the order of the job list from the request to the query of the API.
+func setJobSort(query url.Values, form url.Values) {
+	for _, key := range []string{"sort", "order"} {
+		if v := form.Get(key); v != "" {
+			query.Set(key, v)
+		}
+	}
+}
+
+// newestFirst tells whether the job list has the default order, the only one the job
+// watch keeps, as it puts new jobs on top.
+func newestFirst(form url.Values) bool {
+	sort, order := form.Get("sort"), form.Get("order")
+	return (sort == "" || sort == "creationTimestamp") && (order == "" || order == "desc")
+}
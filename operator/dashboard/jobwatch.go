@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"shared/shutdown"
+)
+
+// JobEvent is a change of a job pushed by the job watch of the API.
+type JobEvent struct {
+	Type    string     `json:"type"`
+	Initial bool       `json:"initial"`
+	Job     Job        `json:"job"`
+	Summary JobSummary `json:"summary"`
+}
+
+// GET /frontend/jobs/watch?namespace=ns&suite=name&labelSelector=k=v&status=failed&search=text
+// relays the job watch of the API to the htmx SSE extension. Every event carries
+// out-of-band swaps: new jobs go on top of the list, changed jobs replace their list item
+// and deleted jobs are removed. Jobs that existed before the watch only refresh their
+// item, the list was rendered with them.
+func relayJobEvents(w http.ResponseWriter, r *http.Request, backend string) {
+	query := url.Values{"namespace": {getNamespace(r.FormValue("namespace"))}}
+	setJobFilters(query, r.Form)
+
+	t, err := currentTemplates()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(backend, "http")+"/jobs/watch?"+query.Encode(), backend)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ws, err := config.DialContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer ws.Close()
+	// closing the socket ends the receive below once the browser went away or on shutdown
+	ctx, cancel := shutdown.StreamContext(r)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		ws.Close()
+	}()
+
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	rc.Flush()
+
+	columns := columnsFor(r)
+	for {
+		var event JobEvent
+		if err := websocket.JSON.Receive(ws, &event); err != nil {
+			return
+		}
+		event.Job.Summary = event.Summary
+
+		var html bytes.Buffer
+		switch {
+		case event.Type == "deleted":
+			fmt.Fprintf(&html, `<div id="job-%s" hx-swap-oob="delete"></div>`, template.HTMLEscapeString(event.Job.Metadata.UID))
+		case event.Type == "added" && !event.Initial:
+			html.WriteString(`<div id="job-list-empty" hx-swap-oob="delete"></div><div hx-swap-oob="afterbegin:#job-list">`)
+			err = t.ExecuteTemplate(&html, "job_item.html", JobItemView{Job: event.Job, Columns: columns})
+			html.WriteString(`</div>`)
+		default:
+			err = t.ExecuteTemplate(&html, "job_item.html", JobItemView{Job: event.Job, Columns: columns, SwapOOB: "true"})
+		}
+		if err != nil {
+			log.Printf("rendering job event: %v", err)
+			return
+		}
+
+		// every line of the HTML needs its own data field
+		fmt.Fprint(w, "event: job\n")
+		for _, line := range strings.Split(html.String(), "\n") {
+			fmt.Fprintf(w, "data: %s\n", line)
+		}
+		fmt.Fprint(w, "\n")
+		rc.Flush()
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// liveArtifactKinds maps the files Playwright writes to its output directory while the
+// tests run to how the gallery shows them.
+var liveArtifactKinds = map[string]string{
+	".png":  "image",
+	".jpg":  "image",
+	".jpeg": "image",
+	".webm": "video",
+	".zip":  "trace",
+}
+
+// Once a run finished, the API can have a poster image and a small preview generated next
+// to every video, see generateVideoPreviews of the API.
+const (
+	posterSuffix  = ".poster.jpg"
+	previewSuffix = ".preview.webm"
+)
+
+// LiveArtifact is a file a test left in the checkpoint directory of a run. Videos link
+// their poster and preview once they exist.
+type LiveArtifact struct {
+	Name     string
+	Path     string
+	Kind     string
+	Modified time.Time
+	Poster   string
+	Preview  string
+}
+
+// LiveTest groups the artifacts of one test. Playwright names failure screenshots
+// test-failed-N.png and writes error-context.md for failed tests.
+type LiveTest struct {
+	Name      string
+	Failed    bool
+	Artifacts []LiveArtifact
+	Modified  time.Time
+}
+
+type LiveArtifactsView struct {
+	UID       string
+	Namespace string
+	Active    bool
+	Tests     []LiveTest
+	Failed    int
+}
+
+// checkpointRunDir returns the output directory a run writes to while its tests execute,
+// below the Job UID.
+func checkpointRunDir(uid string) (string, error) {
+	if _, err := runDir(uid); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(resultsDir, "checkpoints", uid), nil
+}
+
+// liveArtifacts lists the artifacts written so far by test, most recently changed first.
+func liveArtifacts(uid string) ([]LiveTest, error) {
+	dir, err := checkpointRunDir(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	byTest := map[string]*LiveTest{}
+	previews := map[string]bool{}
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		testDir, name := path.Split(rel)
+		if testDir == "" {
+			return nil
+		}
+
+		test := byTest[testDir]
+		if test == nil {
+			test = &LiveTest{Name: strings.TrimSuffix(testDir, "/")}
+			byTest[testDir] = test
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(test.Modified) {
+			test.Modified = info.ModTime()
+		}
+		if name == "error-context.md" || strings.HasPrefix(name, "test-failed-") {
+			test.Failed = true
+		}
+		if strings.HasSuffix(name, posterSuffix) || strings.HasSuffix(name, previewSuffix) {
+			previews[rel] = true
+			return nil
+		}
+		if kind, ok := liveArtifactKinds[strings.ToLower(path.Ext(name))]; ok {
+			test.Artifacts = append(test.Artifacts, LiveArtifact{Name: name, Path: rel, Kind: kind, Modified: info.ModTime()})
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tests := make([]LiveTest, 0, len(byTest))
+	for _, test := range byTest {
+		for i := range test.Artifacts {
+			a := &test.Artifacts[i]
+			if a.Kind != "video" {
+				continue
+			}
+			base := strings.TrimSuffix(a.Path, path.Ext(a.Path))
+			if previews[base+posterSuffix] {
+				a.Poster = base + posterSuffix
+			}
+			if previews[base+previewSuffix] {
+				a.Preview = base + previewSuffix
+			}
+		}
+		sort.Slice(test.Artifacts, func(i, j int) bool {
+			return test.Artifacts[i].Name < test.Artifacts[j].Name
+		})
+		tests = append(tests, *test)
+	}
+	sort.Slice(tests, func(i, j int) bool {
+		return tests[i].Modified.After(tests[j].Modified)
+	})
+
+	return tests, nil
+}
+
+// renderLiveArtifacts renders the gallery of a run. While the run is active the partial
+// polls for new artifacts, the final render after it finished stops polling.
+func renderLiveArtifacts(w http.ResponseWriter, r *http.Request) {
+	uid := r.PathValue("uid")
+	tests, err := liveArtifacts(uid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	view := LiveArtifactsView{UID: uid, Namespace: getNamespace(r.URL.Query().Get("namespace")), Active: r.URL.Query().Get("active") == "true", Tests: tests}
+	for _, test := range tests {
+		if test.Failed {
+			view.Failed++
+		}
+	}
+
+	renderTemplate(w, "live_artifacts.html", view)
+}
+
+// serveLiveArtifact serves a file of the checkpoint directory of a run.
+func serveLiveArtifact(w http.ResponseWriter, r *http.Request) {
+	dir, err := checkpointRunDir(r.PathValue("uid"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if scan, held := heldArtifacts(r.PathValue("uid")); held {
+		renderQuarantine(w, r, r.PathValue("uid"), scan, "")
+		return
+	}
+
+	http.StripPrefix("/live/"+r.PathValue("uid")+"/", http.FileServer(http.Dir(dir))).ServeHTTP(w, r)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type LogDiff struct {
+	Base RunRef `json:"base"`
+	Head RunRef `json:"head"`
+	Diff string `json:"diff"`
+}
+
+// DiffLine is a line of a unified diff, with its kind for styling: file, hunk, add,
+// del or context.
+type DiffLine struct {
+	Kind string
+	Text string
+}
+
+type LogDiffView struct {
+	Namespace string
+	Base      string
+	Head      string
+	Diff      *LogDiff
+	Lines     []DiffLine
+	Error     string
+}
+
+func diffLineKind(line string) string {
+	switch {
+	case strings.HasPrefix(line, "--- "), strings.HasPrefix(line, "+++ "):
+		return "file"
+	case strings.HasPrefix(line, "@@"):
+		return "hunk"
+	case strings.HasPrefix(line, "+"):
+		return "add"
+	case strings.HasPrefix(line, "-"):
+		return "del"
+	}
+
+	return "context"
+}
+
+// GET /diff/logs?namespace=ns&base=run&head=run compares the logs of two runs, e.g. the
+// last green run and a red one.
+func logDiffPage(w http.ResponseWriter, r *http.Request, backend string) {
+	query := r.URL.Query()
+	view := LogDiffView{Namespace: getNamespace(query.Get("namespace")), Base: query.Get("base"), Head: query.Get("head")}
+
+	if view.Base != "" && view.Head != "" {
+		params := url.Values{"namespace": {view.Namespace}, "base": {view.Base}, "head": {view.Head}}
+		body, err := getBackend(r.Context(), backend+"/runs/diff/logs?"+params.Encode())
+		if err != nil {
+			view.Error = err.Error()
+		} else {
+			var diff LogDiff
+			if err := json.Unmarshal(body, &diff); err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			view.Diff = &diff
+			for _, line := range strings.Split(strings.TrimSuffix(diff.Diff, "\n"), "\n") {
+				if line != "" {
+					view.Lines = append(view.Lines, DiffLine{Kind: diffLineKind(line), Text: line})
+				}
+			}
+		}
+	}
+
+	renderTemplate(w, "log_diff.html", view)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// LogFilter hides or collapses known-noisy log lines, see the API for the actions.
+type LogFilter struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	Action  string `json:"action"`
+}
+
+type logFilter struct {
+	LogFilter
+	re *regexp.Regexp
+}
+
+// loadLogFilters fetches the filters configured for a namespace. Log views fall back to
+// raw output when they cannot be loaded.
+func loadLogFilters(ctx context.Context, backend, namespace string) []logFilter {
+	body, err := getBackend(ctx, backend+"/logfilters?"+url.Values{"namespace": {namespace}}.Encode())
+	if err != nil {
+		log.Printf("cannot load log filters: %v", err)
+		return nil
+	}
+
+	var configured []LogFilter
+	if err := json.Unmarshal(body, &configured); err != nil {
+		log.Printf("cannot decode log filters: %v", err)
+		return nil
+	}
+
+	var filters []logFilter
+	for _, f := range configured {
+		re, err := regexp.Compile(f.Pattern)
+		if err != nil {
+			continue
+		}
+		filters = append(filters, logFilter{LogFilter: f, re: re})
+	}
+
+	return filters
+}
+
+func matchLogFilter(filters []logFilter, line string) *logFilter {
+	for i := range filters {
+		if filters[i].re.MatchString(line) {
+			return &filters[i]
+		}
+	}
+
+	return nil
+}
+
+// filterLogLines drops hidden lines and folds runs of collapsed ones into a single line,
+// keeping the numbers of the rest. Bookmarked lines are always shown. It returns the
+// lines and how many of them were filtered.
+func filterLogLines(lines []LogLine, filters []logFilter) ([]LogLine, int) {
+	if len(filters) == 0 {
+		return lines, 0
+	}
+
+	var kept []LogLine
+	filtered := 0
+	for _, line := range lines {
+		f := matchLogFilter(filters, line.Text)
+		if f == nil || line.Highlighted || len(line.Notes) > 0 {
+			kept = append(kept, line)
+			continue
+		}
+
+		filtered++
+		if f.Action != "collapse" {
+			continue
+		}
+		if last := len(kept) - 1; last >= 0 && kept[last].Filter == f.Name {
+			kept[last].Folded = append(kept[last].Folded, line)
+			continue
+		}
+		kept = append(kept, LogLine{Number: line.Number, Filter: f.Name, Folded: []LogLine{line}})
+	}
+
+	// a single collapsed line is shown as is
+	for i := range kept {
+		if len(kept[i].Folded) == 1 {
+			kept[i] = kept[i].Folded[0]
+			filtered--
+		}
+	}
+
+	return kept, filtered
+}
+
+// filterLogText applies the filters to plain logs, marking collapsed runs of lines.
+func filterLogText(logs string, filters []logFilter) (string, int) {
+	if len(filters) == 0 || logs == "" {
+		return logs, 0
+	}
+
+	var lines []LogLine
+	for i, text := range strings.Split(strings.TrimSuffix(logs, "\n"), "\n") {
+		lines = append(lines, LogLine{Number: i + 1, Text: text})
+	}
+	lines, filtered := filterLogLines(lines, filters)
+
+	var sb strings.Builder
+	for _, line := range lines {
+		if line.Folded != nil {
+			fmt.Fprintf(&sb, "⋯ %d lines matching %s\n", len(line.Folded), line.Filter)
+			continue
+		}
+		sb.WriteString(line.Text)
+		sb.WriteByte('\n')
+	}
+
+	return sb.String(), filtered
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+
+	"shared/logging"
+)
+
+// useRequestIDs makes the default client pass the request IDs of pages on to backend,
+// after the API tokens.
+func useRequestIDs(backend string) error {
+	target, err := url.Parse(backend)
+	if err != nil {
+		return err
+	}
+
+	base := http.DefaultClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	http.DefaultClient.Transport = &requestIDTransport{host: target.Host, base: base}
+
+	return nil
+}
+
+// requestIDTransport passes the request ID of the page a request to host is made for on
+// to the API.
+type requestIDTransport struct {
+	host string
+	base http.RoundTripper
+}
+
+func (t *requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := logging.RequestID(req.Context()); id != "" && req.URL.Host == t.host && req.Header.Get(logging.RequestIDHeader) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(logging.RequestIDHeader, id)
+	}
+
+	return t.base.RoundTrip(req)
+}
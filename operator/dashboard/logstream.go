@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"shared/shutdown"
+)
+
+// GET /frontend/pod/logs/stream?namespace=ns&pod=name&container=c relays the log stream of
+// the API to the htmx SSE extension, with every line rendered as HTML. Log filters are not
+// applied to the live output. A stream cut off by a shutdown ends without an end event, so
+// the browser reconnects.
+func relayPodLogs(w http.ResponseWriter, r *http.Request, backend string) {
+	query := url.Values{"namespace": {getNamespace(r.FormValue("namespace"))}, "pod": {r.FormValue("pod")}}
+	if c := r.FormValue("container"); c != "" {
+		query.Set("container", c)
+	}
+
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	// ending replaces the source of the events, which closes it instead of reconnecting
+	end := func(reason string) {
+		message := "Log stream ended."
+		if reason != "" {
+			message = "Log stream ended: " + reason
+		}
+		fmt.Fprintf(w, "event: end\ndata: <div class=\"small text-muted mb-1\">%s</div>\n\n", html.EscapeString(message))
+		rc.Flush()
+	}
+
+	ctx, cancel := shutdown.StreamContext(r)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, backend+"/pod/logs/stream?"+query.Encode(), nil)
+	if err != nil {
+		end(err.Error())
+		return
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		end(err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		end(backendError(resp, body).Error())
+		return
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	event := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: ") && event == "end":
+			end(strings.TrimPrefix(line, "data: "))
+			return
+		case strings.HasPrefix(line, "data: "):
+			fmt.Fprintf(w, "data: <div>%s</div>\n\n", html.EscapeString(strings.TrimPrefix(line, "data: ")))
+			rc.Flush()
+		case line == "":
+			event = ""
+		}
+	}
+
+	// the API or the dashboard shut down, the EventSource of the browser reconnects
+}
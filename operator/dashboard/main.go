@@ -1,21 +1,40 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+
+	"shared/buildinfo"
+	"shared/clientip"
+	"shared/logging"
+	"shared/shutdown"
 )
 
+// inClusterPaths are called from inside the cluster by the probes, the address lists do
+// not apply to them and they are logged at debug level.
+var inClusterPaths = map[string]bool{
+	"/healthz": true,
+}
+
 type Job struct {
 	Metadata struct {
 		UID               string `json:"uid"`
@@ -28,42 +47,301 @@ type Job struct {
 		Succeeded int `json:"succeeded"`
 		Failed    int `json:"failed"`
 	} `json:"status"`
+	// Suppressed holds the reason of the suppression rule matching a failed job.
+	Suppressed string     `json:"-"`
+	Summary    JobSummary `json:"-"`
+	// Queue is set for jobs waiting to start.
+	Queue *QueueStatus `json:"-"`
 }
 
 type JobListResponse struct {
-	Items []Job `json:"items"`
+	Items      []Job                  `json:"items"`
+	Suppressed map[string]string      `json:"suppressed"`
+	Summaries  map[string]JobSummary  `json:"summaries"`
+	Queue      map[string]QueueStatus `json:"queue"`
+	Continue   string                 `json:"continue"`
+}
+
+// RunSuppression are the failed tests of a run that suppression rules match, the run is
+// a known failure when Unsuppressed is 0.
+type RunSuppression struct {
+	Tests []struct {
+		Title   string    `json:"title"`
+		Reason  string    `json:"reason"`
+		Expires time.Time `json:"expires"`
+	} `json:"tests"`
+	Unsuppressed int `json:"unsuppressed"`
+}
+
+type RunOutcome struct {
+	Run   string `json:"run"`
+	State string `json:"state"`
+}
+
+type SuiteOutcomes struct {
+	Suites map[string][]RunOutcome `json:"suites"`
+}
+
+type StatusStats struct {
+	Window string `json:"window"`
+	Total  struct {
+		Active     int `json:"active"`
+		Succeeded  int `json:"succeeded"`
+		Failed     int `json:"failed"`
+		Suppressed int `json:"suppressed"`
+	} `json:"total"`
+}
+
+type ImagePullError struct {
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Image     string `json:"image"`
+	Reason    string `json:"reason"`
+	Message   string `json:"message"`
+}
+
+type BudgetResult struct {
+	Verdict     string   `json:"verdict"`
+	Violations  []string `json:"violations"`
+	Unevaluated []string `json:"unevaluated"`
+}
+
+type RunComparison struct {
+	Against          string         `json:"against"`
+	Run              string         `json:"run"`
+	State            string         `json:"state"`
+	Failure          string         `json:"failure"`
+	PerTest          bool           `json:"perTest"`
+	NewFailures      []ComparedTest `json:"newFailures"`
+	ExistingFailures []ComparedTest `json:"existingFailures"`
+	Fixed            []ComparedTest `json:"fixed"`
+}
+
+type ComparedTest struct {
+	File    string `json:"file"`
+	Title   string `json:"title"`
+	Project string `json:"project"`
 }
 
 type JobDetails struct {
-	Job  batchv1.Job  `json:"job"`
-	Pods []corev1.Pod `json:"pods"`
+	Job             batchv1.Job       `json:"job"`
+	Pods            []corev1.Pod      `json:"pods"`
+	ImagePullErrors []ImagePullError  `json:"imagePullErrors"`
+	Budget          *BudgetResult     `json:"budget"`
+	Comparison      *RunComparison    `json:"comparison"`
+	Suppression     *RunSuppression   `json:"suppression"`
+	Kubectl         []KubectlCommand  `json:"kubectl"`
+	BrowserVersions map[string]string `json:"browserVersions"`
+	BrowserWarnings []string          `json:"browserWarnings"`
+	Preemptions     []Preemption      `json:"preemptions"`
+	Queue           *QueueStatus      `json:"queue"`
+	Matrix          []MatrixRun       `json:"matrix"`
+	// Containers maps the pods of the run to their containers.
+	Containers map[string][]PodContainer `json:"containers"`
+	Shards     []ShardStatus             `json:"shards"`
+	Cost       *RunCost                  `json:"cost"`
+	SignOff    *SignOff                  `json:"signOff"`
+}
+
+// RunCost is the measured cost of a run, or an estimate until OpenCost has it.
+type RunCost struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+	Source   string  `json:"source"`
+	Final    bool    `json:"final"`
+}
+
+// PodContainer is a container of a run pod, e.g. the Playwright container or a sidecar.
+type PodContainer struct {
+	Name    string `json:"name"`
+	Init    bool   `json:"init"`
+	Default bool   `json:"default"`
+}
+
+// MatrixRun is the result of one combination of the matrix a run belongs to.
+type MatrixRun struct {
+	Device    string      `json:"device"`
+	Locale    string      `json:"locale"`
+	Timezone  string      `json:"timezone"`
+	Namespace string      `json:"namespace"`
+	Name      string      `json:"name"`
+	UID       string      `json:"uid"`
+	State     string      `json:"state"`
+	Counts    *TestCounts `json:"counts"`
+}
+
+// ShardStatus is the state of a shard of a sharded run.
+type ShardStatus struct {
+	Index  int         `json:"index"`
+	State  string      `json:"state"`
+	Pod    string      `json:"pod"`
+	Counts *TestCounts `json:"counts"`
+}
+
+// Number is the shard as passed to --shard, which counts from one.
+func (s ShardStatus) Number() int {
+	return s.Index + 1
+}
+
+// Variant names the combination of the run, e.g. "iPhone 14 · de-DE · Europe/Berlin".
+func (m MatrixRun) Variant() string {
+	var parts []string
+	for _, part := range []string{m.Device, m.Locale, m.Timezone} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return strings.Join(parts, " · ")
+}
+
+type TestCounts struct {
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Flaky   int `json:"flaky"`
+	Skipped int `json:"skipped"`
+}
+
+type Preemption struct {
+	Pod     string    `json:"pod"`
+	Node    string    `json:"node"`
+	Reason  string    `json:"reason"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+type KubectlCommand struct {
+	Description string `json:"description"`
+	Command     string `json:"command"`
 }
 
 type JobDetailsView struct {
-	Job      batchv1.Job
-	Pods     []corev1.Pod
-	Start    string
-	Finish   string
-	Duration string
+	Job             batchv1.Job
+	Pods            []corev1.Pod
+	ImagePullErrors []ImagePullError
+	Budget          *BudgetResult
+	Comparison      *RunComparison
+	Suppression     *RunSuppression
+	Kubectl         []KubectlCommand
+	BrowserVersions map[string]string
+	BrowserWarnings []string
+	Preemptions     []Preemption
+	Queue           *QueueStatus
+	Matrix          []MatrixRun
+	Containers      map[string][]PodContainer
+	Shards          []ShardStatus
+	Cost            *RunCost
+	SignOff         *SignOff
+	Breadcrumbs     []Breadcrumb
+	Pinned          bool
+	Active          bool
+	Start           string
+	Finish          string
+	Duration        string
 }
 
-var templates = template.Must(template.New("tmpl").ParseGlob("templates/*.html"))
+var templates = template.Must(parseTemplates())
+
+// devMode re-parses the templates on every request, see -dev.
+var devMode bool
 
 func main() {
+	flag.BoolVar(&devMode, "dev", false, "local development: reload templates on every request, use the API on localhost and serve results from testdata")
+	apiPort := flag.Int("api-port", 8080, "port of the API on localhost in -dev mode")
+	logLevel := flag.String("log-level", envOrDefault("LOG_LEVEL", "info"), "minimum level of log messages: debug, info, warn or error")
+	logFormat := flag.String("log-format", envOrDefault("LOG_FORMAT", "text"), "format of log messages: text or json")
+	flag.Parse()
+	if err := logging.Setup(*logLevel, *logFormat); err != nil {
+		log.Fatalf("invalid logging settings: %v", err)
+	}
+
 	backend := os.Getenv("BACKEND_URL")
 	if backend == "" {
 		backend = "http://localhost:8080"
 	}
 
+	if devMode {
+		backend = fmt.Sprintf("http://localhost:%d", *apiPort)
+		resultsDir = "testdata/playwright-results"
+		log.Printf("Development mode: API at %s, results from %s", backend, resultsDir)
+	}
+
+	authCfg, err := authConfigFromEnv(backend)
+	if err != nil {
+		log.Fatalf("invalid authentication settings: %v", err)
+	}
+	if err := useAPITokens(authCfg, backend); err != nil {
+		log.Fatalf("invalid API address: %v", err)
+	}
+	if err := useRequestIDs(backend); err != nil {
+		log.Fatalf("invalid API address: %v", err)
+	}
+
+	store, err := resultsStoreFromEnv()
+	if err != nil {
+		log.Fatalf("invalid results store settings: %v", err)
+	}
+	projects, err := projectsFromEnv()
+	if err != nil {
+		log.Fatalf("invalid project settings: %v", err)
+	}
+	if _, err := shareLinkTTL(); err != nil {
+		log.Fatalf("invalid share link settings: %v", err)
+	}
+
 	fs := http.FileServer(http.Dir("static"))
 
 	mux := http.NewServeMux()
 	mux.Handle("/", fs)
 
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		namespace := selectedNamespace(r)
+		if namespace == "" {
+			namespace = "default"
+		}
+		suite := r.FormValue("suite")
+		list := listQuery(namespace, r.Form)
+
+		renderTemplate(w, "index.html", IndexView{
+			Namespace:     namespace,
+			Namespaces:    loadNamespaces(r.Context(), backend, namespace),
+			Suite:         suite,
+			Breadcrumbs:   currentPage(listBreadcrumbs(namespace, suite)),
+			LabelSelector: list.Get("labelSelector"),
+			Status:        list.Get("status"),
+			StatusChips:   statusChips(list),
+			Search:        list.Get("search"),
+			Sort:          list.Get("sort"),
+			Order:         list.Get("order"),
+			SortChips:     sortChips(list),
+		})
+	})
+
+	if devMode {
+		// lets the browser talk to the API directly while iterating on the UI
+		target, err := url.Parse(backend)
+		if err != nil {
+			log.Fatalf("invalid API address: %v", err)
+		}
+		mux.Handle("/api/", http.StripPrefix("/api", httputil.NewSingleHostReverseProxy(target)))
+	}
+
 	mux.HandleFunc("/frontend/jobs", func(w http.ResponseWriter, r *http.Request) {
 		namespace := getNamespace(r.FormValue("namespace"))
-		url := fmt.Sprintf("%s/jobs?namespace=%s", backend, namespace)
-		body, err := callBackend(url)
+		if r.FormValue("namespace") != "" {
+			rememberNamespace(w, namespace)
+		}
+		query := url.Values{"namespace": {namespace}}
+		setJobFilters(query, r.Form)
+		watch := "/frontend/jobs/watch?" + query.Encode()
+		// later pages continue in the order of the first one
+		setJobSort(query, r.Form)
+		query.Set("limit", envOrDefault("JOB_LIST_PAGE_SIZE", "50"))
+		if token := r.FormValue("continue"); token != "" {
+			query.Set("continue", token)
+		}
+		// an invalid continue token has to show up as an error, not as an empty page
+		body, err := getBackend(r.Context(), backend+"/jobs?"+query.Encode())
 		if err != nil {
 			http.Error(w, err.Error(), 500)
 			return
@@ -71,73 +349,191 @@ func main() {
 
 		var parsed JobListResponse
 		json.Unmarshal(body, &parsed)
+		for i := range parsed.Items {
+			parsed.Items[i].Suppressed = parsed.Suppressed[parsed.Items[i].Metadata.UID]
+			parsed.Items[i].Summary = parsed.Summaries[parsed.Items[i].Metadata.UID]
+			if queue, ok := parsed.Queue[parsed.Items[i].Metadata.UID]; ok {
+				parsed.Items[i].Queue = &queue
+			}
+		}
+
+		view := JobListView{
+			Jobs:     parsed.Items,
+			Columns:  columnsFor(r),
+			Continue: parsed.Continue,
+			Filtered: r.FormValue("labelSelector") != "" || r.FormValue("status") != "" || r.FormValue("search") != "",
+		}
+		// later pages are appended to the first one, which already watches the jobs, and
+		// new jobs would land on top of lists in other orders
+		if r.FormValue("continue") == "" && newestFirst(r.Form) {
+			view.Watch = watch
+		}
 
-		templates.ExecuteTemplate(w, "job_list.html", parsed.Items)
+		// the outcome sparklines are decoration, the list renders without them
+		body, err = callBackend(r.Context(), fmt.Sprintf("%s/stats/outcomes?namespace=%s&limit=10", backend, namespace))
+		if err != nil {
+			log.Printf("cannot load suite outcomes: %v", err)
+		} else {
+			var outcomes SuiteOutcomes
+			json.Unmarshal(body, &outcomes)
+			view.Outcomes = outcomes.Suites
+		}
+
+		renderTemplate(w, "job_list.html", view)
 	})
 
-	mux.HandleFunc("/frontend/job/details", func(w http.ResponseWriter, r *http.Request) {
-		namespace := getNamespace(r.FormValue("namespace"))
-		name := r.FormValue("name")
+	mux.HandleFunc("GET /frontend/jobs/watch", func(w http.ResponseWriter, r *http.Request) {
+		relayJobEvents(w, r, backend)
+	})
+
+	mux.HandleFunc("GET /frontend/columns", func(w http.ResponseWriter, r *http.Request) {
+		renderTemplate(w, "columns.html", columnChoices(columnsFor(r)))
+	})
+
+	mux.HandleFunc("POST /frontend/columns", setColumns)
 
-		url := fmt.Sprintf("%s/jobs/details?namespace=%s&name=%s", backend, namespace, name)
-		body, err := callBackend(url)
+	mux.HandleFunc("/frontend/stats", func(w http.ResponseWriter, r *http.Request) {
+		namespace := getNamespace(r.FormValue("namespace"))
+		url := fmt.Sprintf("%s/stats/status?namespace=%s&window=24h", backend, namespace)
+		body, err := callBackend(r.Context(), url)
 		if err != nil {
 			http.Error(w, err.Error(), 500)
 			return
 		}
 
-		var details JobDetails
-		json.Unmarshal(body, &details)
+		var stats StatusStats
+		json.Unmarshal(body, &stats)
 
-		// Extract timestamps
-		var startStr, finishStr, durationStr string
+		renderTemplate(w, "stats.html", stats)
+	})
 
-		if details.Job.Status.StartTime != nil {
-			t := details.Job.Status.StartTime.Time
-			startStr = t.Format(time.RFC3339)
-		}
+	mux.HandleFunc("/frontend/job/details", func(w http.ResponseWriter, r *http.Request) {
+		namespace := getNamespace(r.FormValue("namespace"))
+		name := r.FormValue("name")
 
-		if details.Job.Status.CompletionTime != nil {
-			t := details.Job.Status.CompletionTime.Time
-			finishStr = t.Format(time.RFC3339)
-		}
+		renderJobDetails(w, r, backend, namespace, name)
+	})
 
-		if details.Job.Status.StartTime != nil && details.Job.Status.CompletionTime != nil {
-			d := details.Job.Status.CompletionTime.Time.Sub(details.Job.Status.StartTime.Time)
-			durationStr = d.Round(time.Second).String()
-		}
+	mux.HandleFunc("POST /frontend/job/pin", func(w http.ResponseWriter, r *http.Request) {
+		pinJob(w, r, backend, "pin")
+	})
 
-		view := JobDetailsView{
-			Job:      details.Job,
-			Pods:     details.Pods,
-			Start:    startStr,
-			Finish:   finishStr,
-			Duration: durationStr,
-		}
+	mux.HandleFunc("POST /frontend/job/unpin", func(w http.ResponseWriter, r *http.Request) {
+		pinJob(w, r, backend, "unpin")
+	})
+
+	// POST /frontend/job/signoff with namespace, name, by and comment
+	mux.HandleFunc("POST /frontend/job/signoff", func(w http.ResponseWriter, r *http.Request) {
+		signOffJob(w, r, backend)
+	})
+
+	// POST /frontend/job/delete with namespace, name and results=true to remove the results too
+	mux.HandleFunc("POST /frontend/job/delete", func(w http.ResponseWriter, r *http.Request) {
+		deleteJob(w, r, backend)
+	})
+
+	mux.HandleFunc("POST /frontend/job/rerun", func(w http.ResponseWriter, r *http.Request) {
+		rerunJob(w, r, backend)
+	})
 
-		templates.ExecuteTemplate(w, "job_details.html", view)
+	// POST /frontend/job/share with namespace and name, see shareJob
+	mux.HandleFunc("POST /frontend/job/share", func(w http.ResponseWriter, r *http.Request) {
+		shareJob(w, r, backend, authCfg, projects, store)
 	})
 
 	mux.HandleFunc("/frontend/pod/logs", func(w http.ResponseWriter, r *http.Request) {
 		namespace := getNamespace(r.FormValue("namespace"))
 		pod := r.FormValue("pod")
 
-		backendURL := fmt.Sprintf("%s/pod/logs?pod=%s&namespace=%s", backend, pod, namespace)
-		body, err := callBackend(backendURL)
+		if r.FormValue("follow") == "true" {
+			// the logs of all containers cannot be followed at once, the default one is
+			container := r.FormValue("container")
+			if container == allContainers {
+				container = ""
+			}
+			renderTemplate(w, "pod_logs_stream.html", PodLogsView{Namespace: namespace, Pod: pod, Container: container})
+			return
+		}
+
+		logs, err := loadPodLogs(r.Context(), backend, namespace, pod, r.FormValue("container"), r.FormValue("tail"))
 		if err != nil {
 			http.Error(w, err.Error(), 500)
 			return
 		}
-
-		var data struct {
-			Logs string `json:"logs"`
+		logs.Raw = r.FormValue("raw") == "true"
+		if !logs.Raw {
+			logs.Logs, logs.Filtered = filterLogText(logs.Logs, loadLogFilters(r.Context(), backend, namespace))
 		}
-		json.Unmarshal(body, &data)
-		templates.ExecuteTemplate(w, "pod_logs.html", map[string]string{
-			"Namespace": namespace,
-			"Pod":       pod,
-			"Logs":      data.Logs,
-		})
+
+		renderTemplate(w, "pod_logs.html", logs)
+	})
+
+	mux.HandleFunc("GET /frontend/pod/logs/stream", func(w http.ResponseWriter, r *http.Request) {
+		relayPodLogs(w, r, backend)
+	})
+
+	mux.HandleFunc("GET /monitors", func(w http.ResponseWriter, r *http.Request) {
+		monitorsPage(w, r, backend)
+	})
+
+	mux.HandleFunc("GET /schedules", func(w http.ResponseWriter, r *http.Request) {
+		schedulesPage(w, r, backend)
+	})
+
+	mux.HandleFunc("GET /suites/{name}/flaky", func(w http.ResponseWriter, r *http.Request) {
+		flakyTestsPage(w, r, backend)
+	})
+
+	mux.HandleFunc("GET /traceability", func(w http.ResponseWriter, r *http.Request) {
+		traceabilityPage(w, r, backend)
+	})
+
+	mux.HandleFunc("GET /traceability/export", func(w http.ResponseWriter, r *http.Request) {
+		exportTraceability(w, r, backend)
+	})
+
+	// settings of the API, see settings.go
+	mux.HandleFunc("GET /admin/settings", func(w http.ResponseWriter, r *http.Request) {
+		settingsPage(w, r, backend)
+	})
+	mux.HandleFunc("POST /admin/settings", func(w http.ResponseWriter, r *http.Request) {
+		saveSettings(w, r, backend)
+	})
+
+	mux.HandleFunc("GET /diff/logs", func(w http.ResponseWriter, r *http.Request) {
+		logDiffPage(w, r, backend)
+	})
+
+	// stable, shareable pages of a run and its logs, see runs.go
+	mux.HandleFunc("GET /runs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		runPage(w, r, backend)
+	})
+	mux.HandleFunc("GET /runs/{id}/clone", func(w http.ResponseWriter, r *http.Request) {
+		clonePage(w, r, backend)
+	})
+	mux.HandleFunc("POST /runs/{id}/clone", func(w http.ResponseWriter, r *http.Request) {
+		startClone(w, r, backend)
+	})
+	mux.HandleFunc("GET /runs/{id}/report.pdf", func(w http.ResponseWriter, r *http.Request) {
+		runReportPDF(w, r, backend)
+	})
+	mux.HandleFunc("GET /runs/{id}/artifacts", func(w http.ResponseWriter, r *http.Request) {
+		runArtifactsPage(w, r, backend)
+	})
+	// GET /trace?namespace=ns&run=uid&trace=/live/<uid>/<path>
+	mux.HandleFunc("GET /trace", func(w http.ResponseWriter, r *http.Request) {
+		openTrace(w, r, backend, authCfg)
+	})
+	// GET /traces?trace=/live/<uid>/<path>&token=t
+	mux.HandleFunc("GET /traces", serveTrace)
+	mux.HandleFunc("GET /runs/{id}/logs/{pod}", func(w http.ResponseWriter, r *http.Request) {
+		runLogsPage(w, r, backend)
+	})
+	mux.HandleFunc("POST /runs/{id}/logs/{pod}/bookmarks", func(w http.ResponseWriter, r *http.Request) {
+		addBookmark(w, r, backend)
+	})
+	mux.HandleFunc("POST /runs/{id}/logs/{pod}/bookmarks/{bookmark}/delete", func(w http.ResponseWriter, r *http.Request) {
+		removeBookmark(w, r, backend)
 	})
 
 	mux.Handle("/pw/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -149,46 +545,452 @@ func main() {
 		}
 
 		uid := parts[0]
-		root := filepath.Join("/playwright-results", uid)
-		fs := http.StripPrefix("/pw/"+uid+"/", http.FileServer(http.Dir(root)))
-		fs.ServeHTTP(w, r)
+		if _, err := runDir(uid); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if scan, held := heldArtifacts(uid); held {
+			renderQuarantine(w, r, uid, scan, "")
+			return
+		}
+		if reportRedirect(w, r, authCfg, uid, parts[1]) {
+			return
+		}
+
+		serveReportFile(w, r, store, uid, "/pw/"+uid+"/")
 	}))
+	// GET /reports/{token}/{path...} serves a report of /pw/ to signed in users, see reportRedirect
+	mux.HandleFunc("GET /reports/{token}/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		uid, ok := parseReportToken(authCfg, r)
+		if !ok {
+			http.Error(w, "invalid or expired report link", http.StatusForbidden)
+			return
+		}
+		if _, err := runDir(uid); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if scan, held := heldArtifacts(uid); held {
+			renderQuarantine(w, r, uid, scan, "")
+			return
+		}
+
+		serveReportFile(w, r, store, uid, "/reports/"+r.PathValue("token")+"/")
+	})
+
+	// Shared runs and badges, served without sign in on the hosts of projects, see projects.go
+	mux.HandleFunc("GET /share/{token}", func(w http.ResponseWriter, r *http.Request) {
+		viewSharedRun(w, r, backend, authCfg, projects)
+	})
+	mux.HandleFunc("GET /share/{token}/report/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		serveSharedReport(w, r, authCfg, projects, store)
+	})
+	mux.HandleFunc("GET /badges/{namespace}/{suite}", func(w http.ResponseWriter, r *http.Request) {
+		suiteBadge(w, r, backend, projects)
+	})
+
+	// GET /artifacts/{uid}/checksums
+	mux.HandleFunc("GET /artifacts/{uid}/checksums", func(w http.ResponseWriter, r *http.Request) {
+		manifest, err := checksumManifest(r.PathValue("uid"))
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "no checksum manifest for this run, it is written once the run finished", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		respondJSON(w, manifest)
+	})
+
+	// GET /artifacts/{uid}/verify
+	mux.HandleFunc("GET /artifacts/{uid}/verify", func(w http.ResponseWriter, r *http.Request) {
+		result, err := verifyRun(r.PathValue("uid"))
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "no checksum manifest for this run", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		respondJSON(w, result)
+	})
+
+	// GET /frontend/report/{uid}/failures?namespace=ns&suite=name
+	mux.HandleFunc("GET /frontend/report/{uid}/failures", func(w http.ResponseWriter, r *http.Request) {
+		renderReportFailures(w, r, backend)
+	})
+
+	// GET /frontend/runs/{uid}/soak?namespace=ns&active=true
+	mux.HandleFunc("GET /frontend/runs/{uid}/soak", func(w http.ResponseWriter, r *http.Request) {
+		renderSoak(w, r, backend)
+	})
+
+	// GET /frontend/artifacts/{uid}?namespace=ns&active=true
+	mux.HandleFunc("GET /frontend/artifacts/{uid}", renderLiveArtifacts)
+
+	// GET /live/{uid}/{path...}
+	mux.HandleFunc("GET /live/{uid}/{path...}", serveLiveArtifact)
+
+	// POST /admin/scans/{uid}/release
+	mux.HandleFunc("POST /admin/scans/{uid}/release", func(w http.ResponseWriter, r *http.Request) {
+		releaseQuarantine(w, r, backend)
+	})
+
+	// GET /version
+	mux.HandleFunc("GET /version", func(w http.ResponseWriter, r *http.Request) {
+		respondJSON(w, buildinfo.Get())
+	})
+
+	// GET /healthz for the probes, outside of the sessions and address lists
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	ipCfg, err := clientip.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("invalid client address settings: %v", err)
+	}
 
 	addr := ":3000"
-	log.Printf("Dashboard running on %s", addr)
+	info := buildinfo.Get()
+	log.Printf("Dashboard %s (%s, built %s) running on %s", info.Version, info.Commit, info.BuildDate, addr)
 	srv := &http.Server{
 		Addr:              addr,
-		Handler:           loggingMiddleware(mux),
+		Handler:           clientip.Middleware(ipCfg, inClusterPaths, http.Error, logging.Middleware(inClusterPaths, securityHeadersMiddleware(securityConfigFromEnv(), projectHostMiddleware(projects, mux, sessionMiddleware(authCfg, csrfMiddleware(csrfConfigFromEnv(), mux)))))),
 		ReadHeaderTimeout: 5 * time.Second,
 		ReadTimeout:       10 * time.Second,
 		WriteTimeout:      10 * time.Second,
 		IdleTimeout:       60 * time.Second,
 	}
 
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	// SIGTERM of a rolling update drains the server
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	if err := shutdown.Serve(ctx, srv); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("Server Error: %v", err)
 	}
 }
 
-func loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		next.ServeHTTP(w, r)
-		log.Printf("%s %s %s %s", r.Host, r.UserAgent(), r.Method, r.URL.String())
-	})
+func renderJobDetails(w http.ResponseWriter, r *http.Request, backend, namespace, name string) {
+	view, err := loadJobDetails(r.Context(), backend, namespace, name)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	renderTemplate(w, "job_details.html", view)
+}
+
+func loadJobDetails(ctx context.Context, backend, namespace, name string) (JobDetailsView, error) {
+	url := fmt.Sprintf("%s/jobs/details?namespace=%s&name=%s", backend, namespace, name)
+	body, err := callBackend(ctx, url)
+	if err != nil {
+		return JobDetailsView{}, err
+	}
+
+	var details JobDetails
+	json.Unmarshal(body, &details)
+
+	// Extract timestamps
+	var startStr, finishStr, durationStr string
+
+	if details.Job.Status.StartTime != nil {
+		t := details.Job.Status.StartTime.Time
+		startStr = t.Format(time.RFC3339)
+	}
+
+	if details.Job.Status.CompletionTime != nil {
+		t := details.Job.Status.CompletionTime.Time
+		finishStr = t.Format(time.RFC3339)
+	}
+
+	if details.Job.Status.StartTime != nil && details.Job.Status.CompletionTime != nil {
+		d := details.Job.Status.CompletionTime.Time.Sub(details.Job.Status.StartTime.Time)
+		durationStr = d.Round(time.Second).String()
+	}
+
+	run := &RunRef{Namespace: details.Job.Namespace, Name: details.Job.Name, UID: string(details.Job.UID)}
+	view := JobDetailsView{
+		Job:             details.Job,
+		Pods:            details.Pods,
+		ImagePullErrors: details.ImagePullErrors,
+		Budget:          details.Budget,
+		Comparison:      details.Comparison,
+		Suppression:     details.Suppression,
+		Kubectl:         details.Kubectl,
+		BrowserVersions: details.BrowserVersions,
+		BrowserWarnings: details.BrowserWarnings,
+		Preemptions:     details.Preemptions,
+		Queue:           details.Queue,
+		Matrix:          details.Matrix,
+		Containers:      details.Containers,
+		Shards:          details.Shards,
+		Cost:            details.Cost,
+		SignOff:         details.SignOff,
+		Breadcrumbs:     runBreadcrumbs(run, details.Job.Labels["playwright.operator/suite"], ""),
+		Pinned:          details.Job.Annotations["playwright.operator/pinned"] == "true",
+		Active:          details.Job.Status.Active > 0,
+		Start:           startStr,
+		Finish:          finishStr,
+		Duration:        durationStr,
+	}
+
+	return view, nil
+}
+
+// pinJob pins or unpins a run and renders its details again.
+func pinJob(w http.ResponseWriter, r *http.Request, backend, action string) {
+	namespace := getNamespace(r.FormValue("namespace"))
+	name := r.FormValue("name")
+
+	// htmx sends the answer of hx-prompt in the HX-Prompt header
+	reason := r.Header.Get("HX-Prompt")
+	if reason == "" {
+		reason = r.FormValue("reason")
+	}
+
+	payload, err := json.Marshal(map[string]string{"reason": reason})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	url := fmt.Sprintf("%s/jobs/%s?namespace=%s&name=%s", backend, action, namespace, name)
+	if _, err := postBackend(r.Context(), url, payload); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	renderJobDetails(w, r, backend, namespace, name)
+}
+
+// deleteJob deletes a run through the API and replaces its details with a notice, the job
+// watch takes it off the list.
+func deleteJob(w http.ResponseWriter, r *http.Request, backend string) {
+	namespace := getNamespace(r.FormValue("namespace"))
+	name := r.FormValue("name")
+
+	query := url.Values{"namespace": {namespace}, "name": {name}}
+	if r.FormValue("results") == "true" {
+		query.Set("results", "true")
+	}
+	if err := deleteBackend(r.Context(), backend+"/jobs?"+query.Encode()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fmt.Fprintf(w, `<div class="alert alert-secondary">Job %s was deleted.</div>`, template.HTMLEscapeString(name))
+}
+
+// rerunJob starts a new run with the pod template of a Job and links to it, its details
+// are served once the API saw the new Job.
+func rerunJob(w http.ResponseWriter, r *http.Request, backend string) {
+	query := url.Values{"namespace": {getNamespace(r.FormValue("namespace"))}, "name": {r.FormValue("name")}}
+	body, err := postBackend(r.Context(), backend+"/jobs/rerun?"+query.Encode(), nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var created Job
+	if err := json.Unmarshal(body, &created); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	fmt.Fprintf(w, `<div class="alert alert-primary">Started %s. <a href="%s" class="alert-link">Open the rerun</a></div>`,
+		template.HTMLEscapeString(created.Metadata.Name),
+		template.HTMLEscapeString(runURL(&RunRef{Namespace: created.Metadata.Namespace, UID: created.Metadata.UID})))
 }
 
-func callBackend(url string) ([]byte, error) {
-	resp, err := http.Get(url)
+// serveReportFile serves a file of the report directory uid, the path of the request
+// below prefix. Files listed in the checksum manifest of the run are verified first.
+func serveReportFile(w http.ResponseWriter, r *http.Request, store *resultsStore, uid, prefix string) {
+	root, err := runDir(uid)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	rel := strings.TrimPrefix(r.URL.Path, prefix)
+	if rel == "" || strings.HasSuffix(rel, "/") {
+		rel += "index.html"
+	}
+	// reports of runs on other nodes or whose volume is gone are served from the bucket
+	if _, err := os.Stat(root); store != nil && errors.Is(err, os.ErrNotExist) {
+		store.serve(w, r, uid, rel)
+		return
+	}
+	sum, err := verifyFile(root, filepath.ToSlash(filepath.Clean(rel)))
+	if err != nil {
+		http.Error(w, "integrity check failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if sum != "" {
+		w.Header().Set("X-Checksum-Sha256", sum)
+	}
+
+	fs := http.StripPrefix(prefix, http.FileServer(http.Dir(root)))
+	fs.ServeHTTP(w, r)
+}
+
+func parseTemplates() (*template.Template, error) {
+	return template.New("tmpl").ParseGlob("templates/*.html")
+}
+
+// currentTemplates returns the parsed templates, re-parsed in -dev mode.
+func currentTemplates() (*template.Template, error) {
+	if devMode {
+		return parseTemplates()
+	}
+
+	return templates, nil
+}
+
+func renderTemplate(w http.ResponseWriter, name string, data interface{}) {
+	t, err := currentTemplates()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := t.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("rendering %s: %v", name, err)
+	}
+}
+
+// callBackend fetches from the API, error responses included. The request is cancelled
+// with ctx, like when the page load it is for is.
+func callBackend(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	return body, nil
+}
+
+// backendError turns an error response of the API into an error with its message.
+func backendError(resp *http.Response, body []byte) error {
+	var e struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &e) == nil && e.Error.Message != "" {
+		return fmt.Errorf("%s: %s", resp.Status, e.Error.Message)
+	}
+
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+// getBackend fetches from the API and turns error responses into errors.
+func getBackend(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		return nil, backendError(resp, body)
+	}
 
 	return body, nil
 }
 
+// postBackend sends a JSON body to the API and turns error responses into errors. The
+// context of the request of the dashboard names the user in the audit of the API.
+func postBackend(ctx context.Context, url string, payload []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		return nil, backendError(resp, body)
+	}
+
+	return body, nil
+}
+
+// putBackend sends a JSON body to the API with PUT and turns error responses into errors.
+func putBackend(ctx context.Context, url string, payload []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		return nil, backendError(resp, body)
+	}
+
+	return body, nil
+}
+
+// deleteBackend sends a DELETE to the API and turns error responses into errors.
+func deleteBackend(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		return backendError(resp, body)
+	}
+
+	return nil
+}
+
+func respondJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 func getNamespace(namespace string) string {
 	if namespace == "" {
 		namespace = os.Getenv("DEFAULT_NAMESPACE")
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBackendCallsEndWithTheRequest(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	for name, call := range map[string]func(context.Context, string) ([]byte, error){
+		"getBackend":  getBackend,
+		"callBackend": callBackend,
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := call(ctx, backend.URL+"/jobs")
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("%s returns the cancellation of the page request, got %v", name, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s keeps waiting for the API after the page request ended", name)
+		}
+	}
+}
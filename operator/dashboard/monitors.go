@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// uptimeChartWidth is the width of the 24h uptime chart in SVG units, one per five minutes.
+const uptimeChartWidth = 288
+
+type MonitorSample struct {
+	Time     time.Time `json:"t"`
+	OK       bool      `json:"ok"`
+	Duration float64   `json:"d"`
+}
+
+type MonitorStatus struct {
+	Name                string  `json:"name"`
+	Schedule            string  `json:"schedule"`
+	Suspended           bool    `json:"suspended"`
+	FailureThreshold    int     `json:"failureThreshold"`
+	Uptime              float64 `json:"uptime"`
+	ConsecutiveFailures int     `json:"consecutiveFailures"`
+	Alerting            bool    `json:"alerting"`
+}
+
+type UptimeBar struct {
+	X     int
+	OK    bool
+	Title string
+}
+
+type MonitorView struct {
+	MonitorStatus
+	UptimePercent string
+	Bars          []UptimeBar
+}
+
+type MonitorsPageView struct {
+	Namespace   string
+	Monitors    []MonitorView
+	ChartWidth  int
+	Breadcrumbs []Breadcrumb
+}
+
+// uptimeBars places the samples of the last 24h on the chart, newer samples to the right.
+func uptimeBars(samples []MonitorSample, now time.Time) []UptimeBar {
+	since := now.Add(-24 * time.Hour)
+
+	var bars []UptimeBar
+	for _, sample := range samples {
+		x := int(sample.Time.Sub(since) * uptimeChartWidth / (24 * time.Hour))
+		if x == uptimeChartWidth {
+			x-- // the check that just finished
+		}
+		if x < 0 || x >= uptimeChartWidth {
+			continue
+		}
+
+		state := "passed"
+		if !sample.OK {
+			state = "failed"
+		}
+		bars = append(bars, UptimeBar{
+			X:     x,
+			OK:    sample.OK,
+			Title: fmt.Sprintf("%s %s in %.1fs", sample.Time.Local().Format("15:04"), state, sample.Duration),
+		})
+	}
+
+	return bars
+}
+
+// GET /monitors?namespace=ns
+func monitorsPage(w http.ResponseWriter, r *http.Request, backend string) {
+	namespace := getNamespace(r.FormValue("namespace"))
+	query := url.Values{"namespace": {namespace}}
+
+	body, err := callBackend(r.Context(), backend+"/monitors?"+query.Encode())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	var monitors []MonitorStatus
+	json.Unmarshal(body, &monitors)
+
+	view := MonitorsPageView{
+		Namespace:   namespace,
+		ChartWidth:  uptimeChartWidth,
+		Breadcrumbs: []Breadcrumb{{Title: namespace, URL: listURL(namespace, "")}, {Title: "monitors"}},
+	}
+	now := time.Now()
+	for _, monitor := range monitors {
+		body, err := callBackend(r.Context(), fmt.Sprintf("%s/monitors/%s/samples?%s", backend, url.PathEscape(monitor.Name), query.Encode()))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		var samples struct {
+			Samples []MonitorSample `json:"samples"`
+		}
+		json.Unmarshal(body, &samples)
+
+		view.Monitors = append(view.Monitors, MonitorView{
+			MonitorStatus: monitor,
+			UptimePercent: fmt.Sprintf("%.2f%%", monitor.Uptime*100),
+			Bars:          uptimeBars(samples.Samples, now),
+		})
+	}
+
+	renderTemplate(w, "monitors.html", view)
+}
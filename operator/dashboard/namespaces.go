@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// namespaceCookieName keeps the namespace picked last, so the job list opens with it.
+const namespaceCookieName = "pw_namespace"
+
+// NamespaceList are the namespaces the API can list runs in.
+type NamespaceList struct {
+	Namespaces []string `json:"namespaces"`
+	Default    string   `json:"default"`
+}
+
+// loadNamespaces returns the namespaces to pick from, always including selected. Without
+// an answer of the API only selected is offered.
+func loadNamespaces(ctx context.Context, backend, selected string) []string {
+	var list NamespaceList
+	if body, err := getBackend(ctx, backend+"/namespaces"); err == nil {
+		json.Unmarshal(body, &list)
+	}
+
+	for _, namespace := range list.Namespaces {
+		if namespace == selected {
+			return list.Namespaces
+		}
+	}
+
+	return append(list.Namespaces, selected)
+}
+
+// selectedNamespace is the namespace of the request, the one picked last without, or
+// DEFAULT_NAMESPACE for the first visit.
+func selectedNamespace(r *http.Request) string {
+	if namespace := r.FormValue("namespace"); namespace != "" {
+		return namespace
+	}
+	if c, err := r.Cookie(namespaceCookieName); err == nil && c.Value != "" {
+		return c.Value
+	}
+
+	return getNamespace("")
+}
+
+// rememberNamespace keeps the namespace picked for the next visit.
+func rememberNamespace(w http.ResponseWriter, namespace string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     namespaceCookieName,
+		Value:    namespace,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
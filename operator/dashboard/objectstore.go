@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"shared/objectstore"
+)
+
+// resultsStore is the bucket the API uploads reports to once their run finished, see
+// objectstore.Store. Objects are named <prefix><uid>/<path of the report>.
+type resultsStore struct {
+	*objectstore.Store
+}
+
+// resultsStoreFromEnv reads the bucket from RESULTS_STORE and the variables next to it, see
+// manifest/operator.yaml. It returns nil without RESULTS_STORE.
+func resultsStoreFromEnv() (*resultsStore, error) {
+	store, err := objectstore.FromEnv()
+	if store == nil || err != nil {
+		return nil, err
+	}
+
+	return &resultsStore{Store: store}, nil
+}
+
+// proxyHeaders are passed through between the browser and the bucket, so videos seek and
+// cached files are revalidated.
+var proxyHeaders = []string{"Range", "If-None-Match", "If-Modified-Since"}
+
+// serve proxies a file of the report of a run from the bucket, for reports that are not on
+// the results volume of this node.
+func (s *resultsStore) serve(w http.ResponseWriter, r *http.Request, uid, rel string) {
+	req, err := s.NewRequest(r.Context(), http.MethodGet, uid+"/"+rel, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, name := range proxyHeaders {
+		if v := r.Header.Get(name); v != "" {
+			req.Header.Set(name, v)
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		http.NotFound(w, r)
+		return
+	case resp.StatusCode >= 400:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		http.Error(w, fmt.Sprintf("results store: %s: %s", resp.Status, strings.TrimSpace(string(body))), http.StatusBadGateway)
+		return
+	}
+
+	for _, name := range []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified"} {
+		if v := resp.Header.Get(name); v != "" {
+			w.Header().Set(name, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
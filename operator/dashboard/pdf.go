@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// A4 in points, the unit of PDF.
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 50
+)
+
+// The standard fonts every PDF reader has, so none are embedded.
+const (
+	pdfFontRegular = "F1"
+	pdfFontBold    = "F2"
+	pdfFontMono    = "F3"
+)
+
+var pdfFonts = []struct{ name, base string }{
+	{pdfFontRegular, "Helvetica"},
+	{pdfFontBold, "Helvetica-Bold"},
+	{pdfFontMono, "Courier"},
+}
+
+// helveticaWidths are the widths of the printable ASCII characters of Helvetica, in
+// thousandths of the font size.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// winAnsiRunes are the characters of WinAnsiEncoding outside of Latin-1 that reports use.
+var winAnsiRunes = map[rune]byte{
+	'€': 0x80, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94,
+	'•': 0x95, '–': 0x96, '—': 0x97, '›': 0x9b, '‹': 0x8b, '™': 0x99,
+}
+
+// pdfImage is a JPEG drawn on a page.
+type pdfImage struct {
+	data          []byte
+	width, height int
+}
+
+// pdfDocument lays out text and images top down on A4 pages, starting new pages as they
+// fill. It only does what the run report needs.
+type pdfDocument struct {
+	title  string
+	pages  []*bytes.Buffer
+	images []pdfImage
+	// y is where the next line goes, from the bottom of the page.
+	y float64
+}
+
+func newPDFDocument(title string) *pdfDocument {
+	doc := &pdfDocument{title: title}
+	doc.newPage()
+
+	return doc
+}
+
+func (d *pdfDocument) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pdfPageHeight - pdfMargin
+}
+
+func (d *pdfDocument) page() *bytes.Buffer {
+	return d.pages[len(d.pages)-1]
+}
+
+// space makes room for height points, on a new page when the current one is full.
+func (d *pdfDocument) space(height float64) {
+	if d.y-height < pdfMargin {
+		d.newPage()
+	}
+	d.y -= height
+}
+
+// gap leaves height points empty, it does not start a new page.
+func (d *pdfDocument) gap(height float64) {
+	d.y -= height
+}
+
+// text writes s wrapped to the width of the page, lines of s are kept.
+func (d *pdfDocument) text(font string, size float64, s string) {
+	for _, line := range strings.Split(strings.TrimRight(s, "\n"), "\n") {
+		for _, wrapped := range wrapText(font, size, line, pdfPageWidth-2*pdfMargin) {
+			d.space(size * 1.3)
+			fmt.Fprintf(d.page(), "BT /%s %.1f Tf %d %.2f Td (%s) Tj ET\n", font, size, pdfMargin, d.y+size*0.3, pdfString(wrapped))
+		}
+	}
+}
+
+// line draws a horizontal rule over the width of the page.
+func (d *pdfDocument) line() {
+	d.space(6)
+	fmt.Fprintf(d.page(), "0.7 G %d %.2f m %d %.2f l S 0 G\n", pdfMargin, d.y+3, pdfPageWidth-pdfMargin, d.y+3)
+}
+
+// image draws img scaled to the width of the page and at most maxHeight points high.
+func (d *pdfDocument) image(img image.Image, maxHeight float64) error {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil
+	}
+
+	// JPEG in RGB, which DCTDecode takes as is, on white for transparent images
+	rgb := image.NewRGBA(bounds)
+	draw.Draw(rgb, bounds, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(rgb, bounds, img, bounds.Min, draw.Over)
+	var data bytes.Buffer
+	if err := jpeg.Encode(&data, rgb, &jpeg.Options{Quality: 80}); err != nil {
+		return err
+	}
+
+	width := float64(pdfPageWidth - 2*pdfMargin)
+	height := width * float64(bounds.Dy()) / float64(bounds.Dx())
+	if height > maxHeight {
+		width, height = width*maxHeight/height, maxHeight
+	}
+
+	d.images = append(d.images, pdfImage{data: data.Bytes(), width: bounds.Dx(), height: bounds.Dy()})
+	d.space(height)
+	fmt.Fprintf(d.page(), "q %.2f 0 0 %.2f %d %.2f cm /Im%d Do Q\n", width, height, pdfMargin, d.y, len(d.images))
+
+	return nil
+}
+
+// bytes returns the document: the catalog, the page tree, the fonts, the images, the info
+// and then a page and its content per page, with the cross-reference table of them.
+func (d *pdfDocument) bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(format string, args ...interface{}) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n", len(offsets))
+		fmt.Fprintf(&out, format, args...)
+		out.WriteString("\nendobj\n")
+	}
+	stream := func(dict string, data []byte) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n<< %s /Length %d >>\nstream\n", len(offsets), dict, len(data))
+		out.Write(data)
+		out.WriteString("\nendstream\nendobj\n")
+	}
+
+	fontsID := 3
+	imagesID := fontsID + len(pdfFonts)
+	infoID := imagesID + len(d.images)
+	pagesID := infoID + 1
+
+	var kids, fonts, images []string
+	for i := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", pagesID+2*i))
+	}
+	for i, font := range pdfFonts {
+		fonts = append(fonts, fmt.Sprintf("/%s %d 0 R", font.name, fontsID+i))
+	}
+	for i := range d.images {
+		images = append(images, fmt.Sprintf("/Im%d %d 0 R", i+1, imagesID+i))
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages))
+	for _, font := range pdfFonts {
+		object("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", font.base)
+	}
+	for _, img := range d.images {
+		stream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode", img.width, img.height), img.data)
+	}
+	object("<< /Title (%s) /Producer (Playwright Dashboard) /CreationDate (D:%s) >>", pdfString(d.title), time.Now().UTC().Format("20060102150405Z"))
+	resources := fmt.Sprintf("<< /Font << %s >> /XObject << %s >> >>", strings.Join(fonts, " "), strings.Join(images, " "))
+	for i, page := range d.pages {
+		object("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources %s /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, resources, pagesID+2*i+1)
+		var content bytes.Buffer
+		zw := zlib.NewWriter(&content)
+		zw.Write(page.Bytes())
+		zw.Close()
+		stream("/Filter /FlateDecode", content.Bytes())
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, infoID, xref)
+
+	return out.Bytes()
+}
+
+// pdfString encodes s in WinAnsiEncoding for a literal string, characters it lacks become
+// question marks.
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\t':
+			b.WriteString("    ")
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		case winAnsiRunes[r] != 0:
+			fmt.Fprintf(&b, "\\%03o", winAnsiRunes[r])
+		default:
+			b.WriteByte('?')
+		}
+	}
+
+	return b.String()
+}
+
+// textWidth is the width of s in points, Helvetica-Bold is taken as a tenth wider than
+// Helvetica.
+func textWidth(font string, size float64, s string) float64 {
+	if font == pdfFontMono {
+		return float64(utf8.RuneCountInString(s)) * 600 * size / 1000
+	}
+
+	var width int
+	for _, r := range s {
+		if r >= 0x20 && r < 0x7f {
+			width += helveticaWidths[r-0x20]
+		} else {
+			width += 556
+		}
+	}
+	if font == pdfFontBold {
+		width = width * 11 / 10
+	}
+
+	return float64(width) * size / 1000
+}
+
+// wrapText breaks s into lines of at most width points, at spaces where it can.
+func wrapText(font string, size float64, s string, width float64) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Split(s, " ") {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if textWidth(font, size, candidate) <= width {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		// words wider than a line, e.g. URLs, are broken anywhere
+		line = ""
+		for _, r := range word {
+			if line != "" && textWidth(font, size, line+string(r)) > width {
+				lines = append(lines, line)
+				line = ""
+			}
+			line += string(r)
+		}
+	}
+
+	return append(lines, line)
+}
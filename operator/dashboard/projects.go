@@ -0,0 +1,386 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// Project is a team whose partners reach its shared reports and badges under its own
+// domains, branded with its title, logo and color. Runs belong to a project by namespace
+// and, if it lists suites, by suite. The other pages of the dashboard are not served on
+// the hosts of projects.
+type Project struct {
+	Name      string   `json:"name"`
+	Hosts     []string `json:"hosts"`
+	Namespace string   `json:"namespace"`
+	Suites    []string `json:"suites,omitempty"`
+	Title     string   `json:"title,omitempty"`
+	// Logo is a data URL of an image, the content security policy loads no images from
+	// other origins.
+	Logo  string `json:"logo,omitempty"`
+	Color string `json:"color,omitempty"`
+}
+
+var projectColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// owns tells whether a run of a suite in a namespace belongs to the project.
+func (p *Project) owns(namespace, suite string) bool {
+	return p.Namespace == namespace && (len(p.Suites) == 0 || slices.Contains(p.Suites, suite))
+}
+
+// LogoURL is the logo for the src of an img, validated to be an image data URL.
+func (p *Project) LogoURL() template.URL {
+	return template.URL(p.Logo)
+}
+
+// DisplayTitle is the title of the project, its name without one.
+func (p *Project) DisplayTitle() string {
+	if p.Title != "" {
+		return p.Title
+	}
+	return p.Name
+}
+
+type projectConfig struct {
+	projects []Project
+	byHost   map[string]*Project
+}
+
+// projectsFromEnv reads the projects from the JSON array in the file PROJECTS_FILE, a
+// ConfigMap mounted into the dashboard, see manifest/operator.yaml. There are none
+// without.
+func projectsFromEnv() (projectConfig, error) {
+	cfg := projectConfig{byHost: map[string]*Project{}}
+	file := os.Getenv("PROJECTS_FILE")
+	if file == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg.projects); err != nil {
+		return cfg, fmt.Errorf("%s: %w", file, err)
+	}
+
+	for i := range cfg.projects {
+		p := &cfg.projects[i]
+		switch {
+		case p.Name == "" || p.Namespace == "":
+			return cfg, fmt.Errorf("project %d: name and namespace are required", i)
+		case len(p.Hosts) == 0:
+			return cfg, fmt.Errorf("project %s: hosts are required", p.Name)
+		case p.Color != "" && !projectColor.MatchString(p.Color):
+			return cfg, fmt.Errorf("project %s: color must be like #1f6feb, not %q", p.Name, p.Color)
+		case p.Logo != "" && !strings.HasPrefix(p.Logo, "data:image/"):
+			return cfg, fmt.Errorf("project %s: logo must be a data URL of an image", p.Name)
+		}
+		for _, host := range p.Hosts {
+			host = strings.ToLower(host)
+			if other, ok := cfg.byHost[host]; ok {
+				return cfg, fmt.Errorf("host %s is used by projects %s and %s", host, other.Name, p.Name)
+			}
+			cfg.byHost[host] = p
+		}
+	}
+
+	return cfg, nil
+}
+
+// forHost returns the project of the host a request reached the dashboard at, nil for the
+// hosts of the dashboard itself.
+func (cfg projectConfig) forHost(host string) *Project {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return cfg.byHost[strings.ToLower(host)]
+}
+
+// forRun returns the project a run belongs to, the first listed if several do.
+func (cfg projectConfig) forRun(namespace, suite string) *Project {
+	for i := range cfg.projects {
+		if cfg.projects[i].owns(namespace, suite) {
+			return &cfg.projects[i]
+		}
+	}
+	return nil
+}
+
+// projectHostMiddleware serves only the shared reports and the badges on the hosts of
+// projects, from public without sign in, and the dashboard on any other host.
+func projectHostMiddleware(cfg projectConfig, public, next http.Handler) http.Handler {
+	if len(cfg.byHost) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.forHost(r.Host) == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Path == "/healthz" || strings.HasPrefix(r.URL.Path, "/share/") || strings.HasPrefix(r.URL.Path, "/badges/") {
+			public.ServeHTTP(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	})
+}
+
+// defaultShareLinkTTL is how long share links are valid without SHARE_LINK_TTL.
+const defaultShareLinkTTL = 7 * 24 * time.Hour
+
+// shareToken grants access to the report of a run without sign in, signed with the
+// session key. Report is the report directory, that of the run or of its pod.
+type shareToken struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       string    `json:"uid"`
+	Suite     string    `json:"suite,omitempty"`
+	Report    string    `json:"report"`
+	Expires   time.Time `json:"expires"`
+}
+
+// shareLinkTTL reads SHARE_LINK_TTL, a duration like 72h.
+func shareLinkTTL() (time.Duration, error) {
+	v := os.Getenv("SHARE_LINK_TTL")
+	if v == "" {
+		return defaultShareLinkTTL, nil
+	}
+	ttl, err := time.ParseDuration(v)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid SHARE_LINK_TTL %q", v)
+	}
+	return ttl, nil
+}
+
+// parseShareToken verifies the token of a share link. On the host of a project, it must be
+// for a run of the project.
+func parseShareToken(auth authConfig, projects projectConfig, r *http.Request) (*shareToken, error) {
+	var token shareToken
+	if err := auth.verify(r.PathValue("token"), &token); err != nil {
+		return nil, err
+	}
+	// the session key signs other tokens too
+	if token.Namespace == "" || token.Name == "" || token.UID == "" || token.Report == "" {
+		return nil, errors.New("malformed share link")
+	}
+	if time.Now().After(token.Expires) {
+		return nil, errors.New("the share link expired")
+	}
+	if project := projects.forHost(r.Host); project != nil && !project.owns(token.Namespace, token.Suite) {
+		return nil, errors.New("the share link is for another project")
+	}
+
+	return &token, nil
+}
+
+// validShareToken tells whether a request for a shared report carries a valid token,
+// see sessionMiddleware.
+func validShareToken(cfg authConfig, r *http.Request) bool {
+	token, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/share/"), "/")
+	var share shareToken
+	return cfg.verify(token, &share) == nil && share.Report != "" && time.Now().Before(share.Expires)
+}
+
+// shareReport returns the report directory of a run to share, the one of the run for
+// sharded runs and that of its pod otherwise.
+func shareReport(details JobDetailsView, store *resultsStore) (string, error) {
+	uids := runReportUIDs(details.Job, details.Pods)
+	for _, uid := range uids {
+		if _, err := os.Stat(resultsDir + "/" + uid); err == nil {
+			return uid, nil
+		}
+	}
+	if store != nil && len(uids) > 0 {
+		return uids[0], nil
+	}
+
+	return "", errors.New("the run has no report to share")
+}
+
+// POST /frontend/job/share with the namespace and name of a run answers with a link to
+// its report that works without sign in until SHARE_LINK_TTL passed, on the host of the
+// project of the run if it has one.
+func shareJob(w http.ResponseWriter, r *http.Request, backend string, auth authConfig, projects projectConfig, store *resultsStore) {
+	namespace := getNamespace(r.FormValue("namespace"))
+	details, err := loadJobDetails(r.Context(), backend, namespace, r.FormValue("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if details.Job.Name == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if _, held := heldArtifacts(string(details.Job.UID)); held {
+		http.Error(w, errArtifactsHeld.Error(), http.StatusForbidden)
+		return
+	}
+	report, err := shareReport(details, store)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	ttl, err := shareLinkTTL()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	suite := details.Job.Labels["playwright.operator/suite"]
+	token, err := auth.sign(shareToken{Namespace: namespace, Name: details.Job.Name, UID: string(details.Job.UID), Suite: suite, Report: report, Expires: time.Now().Add(ttl)})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	origin := requestOrigin(r)
+	if project := projects.forRun(namespace, suite); project != nil {
+		origin = strings.SplitN(origin, "://", 2)[0] + "://" + project.Hosts[0]
+	}
+	link := origin + "/share/" + url.PathEscape(token)
+
+	fmt.Fprintf(w, `<div class="alert alert-primary">Share link, valid until %s: <a href="%s" class="alert-link text-break">%s</a></div>`,
+		time.Now().Add(ttl).Format("2006-01-02 15:04 MST"), template.HTMLEscapeString(link), template.HTMLEscapeString(link))
+}
+
+type ShareView struct {
+	Project *Project
+	Token   string
+	Run     string
+	Suite   string
+	Outcome string
+	Failed  bool
+	Finish  string
+	Expires time.Time
+}
+
+// GET /share/{token} is the branded page of a shared run, linking its report below
+// /share/{token}/report/.
+func viewSharedRun(w http.ResponseWriter, r *http.Request, backend string, auth authConfig, projects projectConfig) {
+	token, err := parseShareToken(auth, projects, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	details, err := loadJobDetails(r.Context(), backend, token.Namespace, token.Name)
+	if err != nil {
+		log.Printf("cannot load the shared run %s/%s: %v", token.Namespace, token.Name, err)
+	}
+
+	view := ShareView{
+		Project: projects.forRun(token.Namespace, token.Suite),
+		Token:   r.PathValue("token"),
+		Run:     token.Name,
+		Suite:   token.Suite,
+		Finish:  details.Finish,
+		Expires: token.Expires,
+	}
+	if details.Job.Name != "" {
+		view.Outcome = runOutcome(details.Job)
+		view.Failed = strings.HasPrefix(view.Outcome, "failed")
+	}
+	renderTemplate(w, "share.html", view)
+}
+
+// GET /share/{token}/report/{path...} serves the report of a shared run.
+func serveSharedReport(w http.ResponseWriter, r *http.Request, auth authConfig, projects projectConfig, store *resultsStore) {
+	token, err := parseShareToken(auth, projects, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if _, err := runDir(token.Report); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	// the scans are of the Job, not of the report directory
+	if _, held := heldArtifacts(token.UID); held {
+		http.Error(w, errArtifactsHeld.Error(), http.StatusForbidden)
+		return
+	}
+
+	serveReportFile(w, r, store, token.Report, "/share/"+r.PathValue("token")+"/report/")
+}
+
+// badgeColors are the colors of the status part of badges.
+var badgeColors = map[string]string{"passing": "#2da44e", "failing": "#cf222e", "unknown": "#8c959f"}
+
+// GET /badges/{namespace}/{suite} is an SVG badge with the outcome of the latest finished
+// run of a suite, labelled with the title and color of its project. On the hosts of
+// projects it is served without sign in for the suites of the project.
+func suiteBadge(w http.ResponseWriter, r *http.Request, backend string, projects projectConfig) {
+	namespace, suite := r.PathValue("namespace"), r.PathValue("suite")
+	host := projects.forHost(r.Host)
+	if host != nil && !host.owns(namespace, suite) {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := url.Values{"namespace": {namespace}, "suite": {suite}, "limit": {"10"}, "sort": {"completionTime"}, "order": {"desc"}}
+	body, err := getBackend(r.Context(), backend+"/jobs?"+query.Encode())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	var jobs struct {
+		Items []batchv1.Job `json:"items"`
+	}
+	if err := json.Unmarshal(body, &jobs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	status := "unknown"
+	for _, job := range jobs.Items {
+		outcome := runOutcome(job)
+		if outcome == "succeeded" {
+			status = "passing"
+			break
+		}
+		if strings.HasPrefix(outcome, "failed") {
+			status = "failing"
+			break
+		}
+	}
+	label, labelColor := suite, "#555"
+	if project := projects.forRun(namespace, suite); project != nil {
+		label = project.DisplayTitle() + " " + suite
+		if project.Color != "" {
+			labelColor = project.Color
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-cache, max-age=60")
+	renderBadge(w, label, labelColor, status, badgeColors[status])
+}
+
+// renderBadge writes a flat badge, the width of its texts estimated at 7 pixels per
+// character.
+func renderBadge(w http.ResponseWriter, label, labelColor, status, statusColor string) {
+	lw, sw := 10+7*len([]rune(label)), 10+7*len(status)
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`+
+		`<rect width="%d" height="20" fill="%s"/><rect x="%d" width="%d" height="20" fill="%s"/>`+
+		`<g fill="#fff" font-family="Verdana,sans-serif" font-size="11" text-anchor="middle">`+
+		`<text x="%d" y="14">%s</text><text x="%d" y="14">%s</text></g></svg>`,
+		lw+sw, template.HTMLEscapeString(label), status,
+		lw, labelColor, lw, sw, statusColor,
+		lw/2, template.HTMLEscapeString(label), lw+sw/2, status)
+}
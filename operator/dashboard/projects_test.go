@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeProjects(t *testing.T, content string) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "projects.json")
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PROJECTS_FILE", file)
+}
+
+func TestProjectsFromEnv(t *testing.T) {
+	writeProjects(t, `[
+		{"name": "shop", "hosts": ["Reports.Shop.Example"], "namespace": "shop", "suites": ["checkout"], "color": "#1f6feb"},
+		{"name": "blog", "hosts": ["reports.blog.example"], "namespace": "blog"}
+	]`)
+	projects, err := projectsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p := projects.forHost("reports.shop.example:8443"); p == nil || p.Name != "shop" {
+		t.Errorf("forHost matches case-insensitively and without the port, got %v", p)
+	}
+	if p := projects.forHost("dashboard.example"); p != nil {
+		t.Errorf("the dashboard host belongs to no project, got %s", p.Name)
+	}
+	if p := projects.forRun("shop", "search"); p != nil {
+		t.Errorf("suites not listed by a project are not its, got %s", p.Name)
+	}
+	if p := projects.forRun("blog", "anything"); p == nil || p.Name != "blog" {
+		t.Errorf("projects without suites own every suite of their namespace, got %v", p)
+	}
+
+	for name, content := range map[string]string{
+		"duplicate host": `[{"name": "a", "hosts": ["x.example"], "namespace": "a"}, {"name": "b", "hosts": ["X.example"], "namespace": "b"}]`,
+		"no hosts":       `[{"name": "a", "namespace": "a"}]`,
+		"bad color":      `[{"name": "a", "hosts": ["x.example"], "namespace": "a", "color": "red;"}]`,
+		"remote logo":    `[{"name": "a", "hosts": ["x.example"], "namespace": "a", "logo": "https://x.example/logo.png"}]`,
+	} {
+		writeProjects(t, content)
+		if _, err := projectsFromEnv(); err == nil {
+			t.Errorf("%s: want an error", name)
+		}
+	}
+}
+
+func TestParseShareToken(t *testing.T) {
+	auth := authConfig{sessionKey: []byte("secret")}
+	projects := projectConfig{
+		projects: []Project{{Name: "shop", Hosts: []string{"reports.shop.example"}, Namespace: "shop"}},
+	}
+	projects.byHost = map[string]*Project{"reports.shop.example": &projects.projects[0]}
+
+	sign := func(token interface{}) string {
+		value, err := auth.sign(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+	valid := shareToken{Namespace: "shop", Name: "run", UID: "job-uid", Report: "pod-uid", Expires: time.Now().Add(time.Hour)}
+	expired := valid
+	expired.Expires = time.Now().Add(-time.Minute)
+	other := valid
+	other.Namespace = "blog"
+	// a trace token carries an expiry but none of the run
+	trace := sign(traceToken{Trace: "/live/uid/trace.zip", Expires: time.Now().Add(time.Hour)})
+
+	for _, tc := range []struct {
+		name  string
+		host  string
+		token string
+		ok    bool
+	}{
+		{"valid", "dashboard.example", sign(valid), true},
+		{"valid on the project host", "reports.shop.example", sign(valid), true},
+		{"expired", "dashboard.example", sign(expired), false},
+		{"another project", "reports.shop.example", sign(other), false},
+		{"tampered", "dashboard.example", sign(valid) + "x", false},
+		{"trace token", "dashboard.example", trace, false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/share/"+tc.token, nil)
+		r.Host = tc.host
+		r.SetPathValue("token", tc.token)
+		if _, err := parseShareToken(auth, projects, r); (err == nil) != tc.ok {
+			t.Errorf("%s: parseShareToken error %v, want ok %v", tc.name, err, tc.ok)
+		}
+	}
+}
+
+func TestProjectHostMiddleware(t *testing.T) {
+	projects := projectConfig{projects: []Project{{Name: "shop", Hosts: []string{"reports.shop.example"}, Namespace: "shop"}}}
+	projects.byHost = map[string]*Project{"reports.shop.example": &projects.projects[0]}
+	public := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	dashboard := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	handler := projectHostMiddleware(projects, public, dashboard)
+
+	for _, tc := range []struct {
+		method, host, path string
+		want               int
+	}{
+		{http.MethodGet, "dashboard.example", "/frontend/jobs", http.StatusOK},
+		{http.MethodGet, "dashboard.example", "/share/token", http.StatusOK},
+		{http.MethodGet, "reports.shop.example", "/share/token/report/index.html", http.StatusTeapot},
+		{http.MethodGet, "reports.shop.example", "/badges/shop/checkout", http.StatusTeapot},
+		{http.MethodGet, "reports.shop.example", "/frontend/jobs", http.StatusNotFound},
+		{http.MethodGet, "reports.shop.example", "/pw/uid/index.html", http.StatusNotFound},
+		{http.MethodPost, "reports.shop.example", "/share/token", http.StatusMethodNotAllowed},
+	} {
+		r := httptest.NewRequest(tc.method, tc.path, nil)
+		r.Host = tc.host
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Errorf("%s %s%s = %d, want %d", tc.method, tc.host, tc.path, w.Code, tc.want)
+		}
+	}
+}
+
+func TestSharedReportPath(t *testing.T) {
+	for path, want := range map[string]bool{
+		"/share/token/report/index.html": true,
+		"/share/token":                   false,
+		"/share//report/index.html":      false,
+		"/pw/uid/index.html":             false,
+	} {
+		if got := sharedReportPath(path); got != want {
+			t.Errorf("sharedReportPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import "time"
+
+// QueueStatus explains why a run has not started yet, see the API for the reasons.
+type QueueStatus struct {
+	Position      int        `json:"position"`
+	Waiting       int        `json:"waiting"`
+	Reason        string     `json:"reason"`
+	Message       string     `json:"message"`
+	Since         time.Time  `json:"since"`
+	ExpectedStart *time.Time `json:"expectedStart"`
+}
+
+var queueReasonTitles = map[string]string{
+	"suspended":     "Waiting for admission",
+	"unschedulable": "Waiting for capacity",
+	"image-pull":    "Cannot pull the image",
+	"starting":      "Starting",
+	"pending":       "Waiting for a pod",
+}
+
+func (q QueueStatus) Title() string {
+	if title, ok := queueReasonTitles[q.Reason]; ok {
+		return title
+	}
+
+	return q.Reason
+}
+
+// WaitingFor is how long the run waits so far.
+func (q QueueStatus) WaitingFor() string {
+	return time.Since(q.Since).Round(time.Second).String()
+}
+
+// ExpectedIn is the time until the estimated start, empty without an estimate.
+func (q QueueStatus) ExpectedIn() string {
+	if q.ExpectedStart == nil {
+		return ""
+	}
+
+	return time.Until(*q.ExpectedStart).Round(time.Minute).String()
+}
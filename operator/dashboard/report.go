@@ -0,0 +1,367 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// The Playwright HTML report embeds its data as a base64 encoded zip in index.html, with
+// report.json holding the summary and a JSON file per test file holding the results.
+var reportDataPattern = regexp.MustCompile(`playwrightReportBase64 = "data:application/zip;base64,([A-Za-z0-9+/=]+)"`)
+
+// The data of a report is read on every render of its failures, the limits keep a huge
+// or crafted report from exhausting the memory of the dashboard.
+const (
+	// maxReportHTMLSize bounds index.html, the embedded data included.
+	maxReportHTMLSize = 256 << 20
+	// maxReportEntrySize bounds a decompressed file of the report data.
+	maxReportEntrySize = 64 << 20
+	// maxReportDataSize bounds the decompressed files of the report data read at once.
+	maxReportDataSize = 256 << 20
+)
+
+var errReportTooLarge = errors.New("report too large")
+
+// ansiEscapes match the terminal colors of error messages.
+var ansiEscapes = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+type reportLocation struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+func (l reportLocation) String() string {
+	if l.File == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+type reportStep struct {
+	Title    string          `json:"title"`
+	Location *reportLocation `json:"location"`
+	Error    json.RawMessage `json:"error"`
+	Steps    []reportStep    `json:"steps"`
+}
+
+type reportAttachment struct {
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	ContentType string `json:"contentType"`
+}
+
+type reportResult struct {
+	Errors      []json.RawMessage  `json:"errors"`
+	Steps       []reportStep       `json:"steps"`
+	Attachments []reportAttachment `json:"attachments"`
+}
+
+type reportTest struct {
+	TestID      string         `json:"testId"`
+	Title       string         `json:"title"`
+	Path        []string       `json:"path"`
+	ProjectName string         `json:"projectName"`
+	Location    reportLocation `json:"location"`
+	Outcome     string         `json:"outcome"`
+	Results     []reportResult `json:"results"`
+}
+
+type reportFile struct {
+	FileName string       `json:"fileName"`
+	Tests    []reportTest `json:"tests"`
+}
+
+// reportStats counts the tests of a report by outcome, expected ones passed or were
+// skipped as expected.
+type reportStats struct {
+	Total      int `json:"total"`
+	Expected   int `json:"expected"`
+	Unexpected int `json:"unexpected"`
+	Flaky      int `json:"flaky"`
+	Skipped    int `json:"skipped"`
+}
+
+// reportSummary is report.json of the report data, times in milliseconds.
+type reportSummary struct {
+	StartTime float64     `json:"startTime"`
+	Duration  float64     `json:"duration"`
+	Stats     reportStats `json:"stats"`
+}
+
+// FailedTest is a failed test of a report with links into the report and the trace of
+// its last attempt.
+type FailedTest struct {
+	Title    string
+	Project  string
+	Location string
+	Error    string
+	// Step is the innermost step that failed, with its location in the test.
+	Step         string
+	StepLocation string
+	ReportURL    string
+	// TraceURL opens the trace in the trace viewer of the report, which selects the
+	// failed action when it loads.
+	TraceURL string
+	// Screenshot is the path of the last image attached to the failed attempt in the
+	// report directory, e.g. the screenshot taken on failure.
+	Screenshot string
+	// Flaky is set when the test alternated between passing and failing in the recent
+	// runs of its suite, see markFlakyTests.
+	Flaky bool
+}
+
+type ReportFailuresView struct {
+	UID       string
+	Namespace string
+	Suite     string
+	Tests     []FailedTest
+}
+
+// markFlakyTests flags the failed tests that are flaky in the history of their suite.
+func markFlakyTests(tests []FailedTest, flaky []FlakyTest) {
+	known := map[[2]string]bool{}
+	for _, test := range flaky {
+		known[[2]string{test.Title, test.Project}] = true
+	}
+	for i := range tests {
+		tests[i].Flaky = known[[2]string{tests[i].Title, tests[i].Project}]
+	}
+}
+
+// errorMessage reads report errors, which are strings in older Playwright versions and
+// objects with a message since.
+func errorMessage(raw json.RawMessage) string {
+	var message string
+	if err := json.Unmarshal(raw, &message); err != nil {
+		var structured struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(raw, &structured)
+		message = structured.Message
+	}
+
+	return ansiEscapes.ReplaceAllString(message, "")
+}
+
+func failed(raw json.RawMessage) bool {
+	return len(raw) > 0 && string(raw) != "null"
+}
+
+// failedStep returns the innermost failed step, which is the action the test failed at.
+func failedStep(steps []reportStep) *reportStep {
+	for i := range steps {
+		if !failed(steps[i].Error) {
+			continue
+		}
+		if inner := failedStep(steps[i].Steps); inner != nil {
+			return inner
+		}
+		return &steps[i]
+	}
+
+	return nil
+}
+
+// reportArchive opens the data embedded in the HTML report of a run, nil for reports
+// without.
+func reportArchive(uid string) (*zip.Reader, error) {
+	dir, err := runDir(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filepath.Join(dir, "index.html"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	html, err := io.ReadAll(io.LimitReader(f, maxReportHTMLSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(html) > maxReportHTMLSize {
+		return nil, fmt.Errorf("%w: index.html exceeds %d MiB", errReportTooLarge, maxReportHTMLSize>>20)
+	}
+	match := reportDataPattern.FindSubmatch(html)
+	if match == nil {
+		return nil, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(string(match[1]))
+	if err != nil {
+		return nil, fmt.Errorf("decoding report data: %w", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("reading report data: %w", err)
+	}
+
+	return archive, nil
+}
+
+// readReportFiles decodes the data embedded in the HTML report of a run.
+func readReportFiles(uid string) ([]reportFile, error) {
+	archive, err := reportArchive(uid)
+	if archive == nil {
+		return nil, err
+	}
+
+	var files []reportFile
+	var total int64
+	for _, entry := range archive.File {
+		if entry.Name == "report.json" || !strings.HasSuffix(entry.Name, ".json") {
+			continue
+		}
+
+		content, err := readReportEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		if total += int64(len(content)); total > maxReportDataSize {
+			return nil, fmt.Errorf("%w: the report data exceeds %d MiB", errReportTooLarge, maxReportDataSize>>20)
+		}
+
+		var file reportFile
+		if err := json.Unmarshal(content, &file); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", entry.Name, err)
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// readReportEntry decompresses a file of the report data up to maxReportEntrySize, the
+// size in the zip header is checked first but not trusted.
+func readReportEntry(entry *zip.File) ([]byte, error) {
+	if entry.UncompressedSize64 > maxReportEntrySize {
+		return nil, fmt.Errorf("%w: %s exceeds %d MiB", errReportTooLarge, entry.Name, maxReportEntrySize>>20)
+	}
+
+	f, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	content, err := io.ReadAll(io.LimitReader(f, maxReportEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxReportEntrySize {
+		return nil, fmt.Errorf("%w: %s exceeds %d MiB", errReportTooLarge, entry.Name, maxReportEntrySize>>20)
+	}
+
+	return content, nil
+}
+
+// readReportSummary decodes the summary of the report of a run, nil for reports without
+// data.
+func readReportSummary(uid string) (*reportSummary, error) {
+	archive, err := reportArchive(uid)
+	if archive == nil {
+		return nil, err
+	}
+
+	var content []byte
+	for _, entry := range archive.File {
+		if entry.Name == "report.json" {
+			if content, err = readReportEntry(entry); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if content == nil {
+		return nil, fmt.Errorf("reading report data: %w", fs.ErrNotExist)
+	}
+
+	var summary reportSummary
+	if err := json.Unmarshal(content, &summary); err != nil {
+		return nil, fmt.Errorf("decoding report.json: %w", err)
+	}
+
+	return &summary, nil
+}
+
+// reportFailures lists the failed tests of the report of a run, in report order.
+func reportFailures(uid string) ([]FailedTest, error) {
+	files, err := readReportFiles(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	var tests []FailedTest
+	for _, file := range files {
+		for _, test := range file.Tests {
+			if test.Outcome != "unexpected" || len(test.Results) == 0 {
+				continue
+			}
+
+			last := test.Results[len(test.Results)-1]
+			failure := FailedTest{
+				Title:     strings.Join(append(test.Path, test.Title), " › "),
+				Project:   test.ProjectName,
+				Location:  test.Location.String(),
+				ReportURL: "/pw/" + uid + "/index.html#?testId=" + url.QueryEscape(test.TestID),
+			}
+			if len(last.Errors) > 0 {
+				failure.Error, _, _ = strings.Cut(errorMessage(last.Errors[0]), "\n")
+			}
+			if step := failedStep(last.Steps); step != nil {
+				failure.Step = step.Title
+				if step.Location != nil {
+					failure.StepLocation = step.Location.String()
+				}
+			}
+			for _, a := range last.Attachments {
+				if a.Name == "trace" && a.Path != "" {
+					failure.TraceURL = "/pw/" + uid + "/trace/index.html?trace=" + url.QueryEscape("/pw/"+uid+"/"+a.Path)
+				}
+				if strings.HasPrefix(a.ContentType, "image/") && a.Path != "" {
+					failure.Screenshot = a.Path
+				}
+			}
+			tests = append(tests, failure)
+		}
+	}
+
+	return tests, nil
+}
+
+// GET /frontend/report/{uid}/failures?namespace=ns&suite=name, with a suite the failed tests
+// that are flaky in its history are marked.
+func renderReportFailures(w http.ResponseWriter, r *http.Request, backend string) {
+	uid := r.PathValue("uid")
+	tests, err := reportFailures(uid)
+	if errors.Is(err, fs.ErrNotExist) {
+		tests, err = nil, nil
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	view := ReportFailuresView{UID: uid, Namespace: getNamespace(r.FormValue("namespace")), Suite: r.FormValue("suite"), Tests: tests}
+	if view.Suite != "" && len(tests) > 0 {
+		// the failures are shown without the badges when the history is not available
+		if flaky, err := loadFlakyTests(r.Context(), backend, view.Namespace, view.Suite, ""); err == nil {
+			markFlakyTests(tests, flaky.Tests)
+		}
+	}
+
+	renderTemplate(w, "report_failures.html", view)
+}
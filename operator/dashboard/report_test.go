@@ -0,0 +1,98 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeReport writes index.html of a run with the files embedded as report data.
+func writeReport(t *testing.T, uid string, write func(*zip.Writer)) {
+	t.Helper()
+	dir := t.TempDir()
+	previous := resultsDir
+	resultsDir = dir
+	t.Cleanup(func() { resultsDir = previous })
+
+	var data bytes.Buffer
+	archive := zip.NewWriter(&data)
+	write(archive)
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	html := `<script>window.playwrightReportBase64 = "data:application/zip;base64,` + base64.StdEncoding.EncodeToString(data.Bytes()) + `";</script>`
+	if err := os.MkdirAll(filepath.Join(dir, uid), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, uid, "index.html"), []byte(html), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func addReportEntry(t *testing.T, archive *zip.Writer, name, content string) {
+	t.Helper()
+	w, err := archive.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReportFailures(t *testing.T) {
+	writeReport(t, "run-uid", func(archive *zip.Writer) {
+		addReportEntry(t, archive, "report.json", `{"stats": {"total": 2, "expected": 1, "unexpected": 1}}`)
+		addReportEntry(t, archive, "a1b2.json", `{"fileName": "login.spec.ts", "tests": [
+			{"testId": "t1", "title": "logs in", "path": ["login"], "projectName": "chromium", "location": {"file": "login.spec.ts", "line": 3}, "outcome": "unexpected",
+			 "results": [{"errors": [{"message": "\u001b[31mtimeout\u001b[39m"}], "steps": [{"title": "click", "error": {"message": "timeout"}, "location": {"file": "login.spec.ts", "line": 5}}]}]},
+			{"testId": "t2", "title": "logs out", "outcome": "expected", "results": [{}]}
+		]}`)
+	})
+
+	summary, err := readReportSummary("run-uid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Stats.Total != 2 || summary.Stats.Unexpected != 1 {
+		t.Errorf("summary = %+v, want 2 tests with 1 failed", summary.Stats)
+	}
+
+	tests, err := reportFailures("run-uid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tests) != 1 || tests[0].Title != "login › logs in" || tests[0].Error != "timeout" || tests[0].Step != "click" || tests[0].StepLocation != "login.spec.ts:5" {
+		t.Errorf("failures = %+v, want logs in failed at click", tests)
+	}
+}
+
+func TestReportEntriesAreBounded(t *testing.T) {
+	// the size in the zip header is checked before decompressing
+	writeReport(t, "run-uid", func(archive *zip.Writer) {
+		var compressed bytes.Buffer
+		fw, _ := flate.NewWriter(&compressed, flate.DefaultCompression)
+		fw.Write([]byte(`{}`))
+		fw.Close()
+		w, err := archive.CreateRaw(&zip.FileHeader{
+			Name:               "a1b2.json",
+			Method:             zip.Deflate,
+			CompressedSize64:   uint64(compressed.Len()),
+			UncompressedSize64: maxReportEntrySize + 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(compressed.Bytes())
+	})
+
+	if _, err := readReportFiles("run-uid"); !errors.Is(err, errReportTooLarge) {
+		t.Errorf("readReportFiles() error = %v, want %v", err, errReportTooLarge)
+	}
+}
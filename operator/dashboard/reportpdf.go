@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/png"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"shared/buildinfo"
+)
+
+// maxReportScreenshots bounds the screenshots in the PDF report of a run, the failures
+// after are listed without.
+const maxReportScreenshots = 10
+
+// runReportUIDs returns the reports of a run: the merged report of sharded runs, the one
+// of each pod otherwise.
+func runReportUIDs(job batchv1.Job, pods []corev1.Pod) []string {
+	if dir, err := runDir(string(job.UID)); err == nil {
+		if _, err := os.Stat(filepath.Join(dir, "index.html")); err == nil {
+			return []string{string(job.UID)}
+		}
+	}
+
+	var uids []string
+	for _, pod := range pods {
+		uids = append(uids, string(pod.UID))
+	}
+
+	return uids
+}
+
+// runOutcome is the state of a run from its conditions.
+func runOutcome(job batchv1.Job) string {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return "succeeded"
+		case batchv1.JobFailed:
+			return "failed: " + c.Reason
+		}
+	}
+	if job.Status.Active > 0 {
+		return "running"
+	}
+
+	return "pending"
+}
+
+// readScreenshot decodes an image attached in the report uid, path is relative to the
+// report directory.
+func readScreenshot(uid, path string) (image.Image, error) {
+	dir, err := runDir(uid)
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsLocal(filepath.FromSlash(path)) {
+		return nil, fmt.Errorf("attachment %q outside of the report", path)
+	}
+
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(path)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+
+	return img, err
+}
+
+// GET /runs/{id}/report.pdf?namespace=ns
+//
+// The report of a run as a document to attach to sign-offs: the run, its test counts and
+// its failures with the screenshots of the first of them.
+func runReportPDF(w http.ResponseWriter, r *http.Request, backend string) {
+	run := lookupRun(w, r, backend)
+	if run == nil {
+		return
+	}
+
+	details, err := loadJobDetails(r.Context(), backend, run.Namespace, run.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	var stats reportStats
+	var reports int
+	type failure struct {
+		FailedTest
+		uid string
+	}
+	var failures []failure
+	for _, uid := range runReportUIDs(details.Job, details.Pods) {
+		summary, err := readReportSummary(uid)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if summary == nil {
+			continue
+		}
+		reports++
+		stats.Total += summary.Stats.Total
+		stats.Expected += summary.Stats.Expected
+		stats.Unexpected += summary.Stats.Unexpected
+		stats.Flaky += summary.Stats.Flaky
+		stats.Skipped += summary.Stats.Skipped
+
+		tests, err := reportFailures(uid)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, test := range tests {
+			failures = append(failures, failure{FailedTest: test, uid: uid})
+		}
+	}
+
+	doc := newPDFDocument("Playwright run " + run.Namespace + "/" + run.Name)
+	doc.text(pdfFontBold, 18, "Playwright run "+run.Name)
+	doc.gap(6)
+
+	fields := [][2]string{
+		{"Namespace", run.Namespace},
+		{"UID", run.UID},
+		{"Suite", details.Job.Labels["playwright.operator/suite"]},
+		{"Status", runOutcome(details.Job)},
+		{"Started", details.Start},
+		{"Finished", details.Finish},
+		{"Duration", details.Duration},
+	}
+	if cost := details.Cost; cost != nil {
+		source := "measured"
+		if cost.Source == "estimate" {
+			source = "estimated"
+		}
+		fields = append(fields, [2]string{"Cost", fmt.Sprintf("%.4f %s (%s)", cost.Amount, cost.Currency, source)})
+	}
+	for _, field := range fields {
+		if field[1] != "" {
+			doc.text(pdfFontRegular, 10, field[0]+": "+field[1])
+		}
+	}
+
+	doc.gap(8)
+	doc.text(pdfFontBold, 13, "Tests")
+	doc.line()
+	if reports == 0 {
+		doc.text(pdfFontRegular, 10, "No Playwright report was stored for this run.")
+	} else {
+		doc.text(pdfFontRegular, 10, fmt.Sprintf("%d tests: %d passed, %d failed, %d flaky, %d skipped",
+			stats.Total, stats.Expected, stats.Unexpected, stats.Flaky, stats.Skipped))
+	}
+
+	if len(failures) > 0 {
+		doc.gap(8)
+		doc.text(pdfFontBold, 13, fmt.Sprintf("Failures (%d)", len(failures)))
+		doc.line()
+	}
+	screenshots := 0
+	for _, f := range failures {
+		doc.gap(6)
+		doc.text(pdfFontBold, 10, f.Title)
+		var where []string
+		if f.Project != "" {
+			where = append(where, "project "+f.Project)
+		}
+		if f.Location != "" {
+			where = append(where, f.Location)
+		}
+		if len(where) > 0 {
+			doc.text(pdfFontRegular, 9, strings.Join(where, ", "))
+		}
+		if f.Step != "" {
+			step := "Failed at: " + f.Step
+			if f.StepLocation != "" {
+				step += " (" + f.StepLocation + ")"
+			}
+			doc.text(pdfFontRegular, 9, step)
+		}
+		if f.Error != "" {
+			doc.text(pdfFontMono, 8, f.Error)
+		}
+		if f.Screenshot != "" && screenshots < maxReportScreenshots {
+			img, err := readScreenshot(f.uid, f.Screenshot)
+			if err != nil {
+				log.Printf("cannot add screenshot %s of report %s to the PDF: %v", f.Screenshot, f.uid, err)
+				continue
+			}
+			doc.gap(4)
+			if err := doc.image(img, 300); err != nil {
+				log.Printf("cannot add screenshot %s of report %s to the PDF: %v", f.Screenshot, f.uid, err)
+				continue
+			}
+			screenshots++
+		}
+	}
+	if screenshots == maxReportScreenshots && len(failures) > maxReportScreenshots {
+		doc.gap(6)
+		doc.text(pdfFontRegular, 9, fmt.Sprintf("Screenshots are included for the first %d failures.", maxReportScreenshots))
+	}
+
+	if signOff := details.SignOff; signOff != nil {
+		doc.gap(8)
+		doc.text(pdfFontBold, 13, "Sign-off")
+		doc.line()
+		doc.text(pdfFontRegular, 10, fmt.Sprintf("Signed off by %s on %s, outcome %s", signOff.By, signOff.Time.Format(time.RFC3339), signOff.Outcome))
+		if signOff.Comment != "" {
+			doc.text(pdfFontRegular, 10, "Comment: "+signOff.Comment)
+		}
+		doc.text(pdfFontRegular, 9, fmt.Sprintf("Digest of the %d report files (SHA-256 of signoffs/%s.sha256 in the results volume):", signOff.Files, run.UID))
+		doc.text(pdfFontMono, 8, signOff.Archive)
+		doc.text(pdfFontRegular, 9, "Digest of the statement (SHA-256):")
+		doc.text(pdfFontMono, 8, signOff.Digest)
+		if signOff.Signature != "" {
+			doc.text(pdfFontRegular, 9, "Ed25519 signature of the statement with key "+signOff.KeyID+":")
+			doc.text(pdfFontMono, 8, signOff.Signature)
+		} else {
+			doc.text(pdfFontRegular, 9, "The statement is not signed.")
+		}
+		doc.text(pdfFontRegular, 9, "GET /runs/"+run.UID+"/signoff of the API verifies the sign-off, GET /signoff/key returns the public key.")
+	}
+
+	doc.gap(12)
+	doc.line()
+	info := buildinfo.Get()
+	doc.text(pdfFontRegular, 8, fmt.Sprintf("Generated %s by Playwright Dashboard %s from the run at /runs/%s",
+		time.Now().UTC().Format(time.RFC3339), info.Version, run.UID))
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", run.Name+"-report.pdf"))
+	w.Write(doc.bytes())
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var errRunNotFound = errors.New("run not found")
+
+// RunRef identifies a run by its Job UID, which stays unique when Job names are reused.
+type RunRef struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	UID       string `json:"uid"`
+}
+
+// allContainers is the container picked to show the logs of all containers of a pod, it
+// is no valid container name.
+const allContainers = "*"
+
+type PodLogsView struct {
+	Run         *RunRef
+	Breadcrumbs []Breadcrumb
+	Namespace   string
+	Pod         string
+	// Container is the picked container, the default one of the pod if empty.
+	Container string
+	// Containers are the containers of the pod to pick from.
+	Containers []PodContainer
+	Tail       string
+	Logs       string
+	// Lines numbers the logs for bookmarks, which refer to lines of the whole log and
+	// are not shown on tailed logs.
+	Lines     []LogLine
+	Bookmarks []LogBookmark
+	CSRFToken string
+	// Raw disables the log filters, Filtered counts the lines they hid or collapsed.
+	Raw      bool
+	Filtered int
+}
+
+type RunPageView struct {
+	Run     RunRef
+	Details JobDetailsView
+}
+
+// resolveRun maps a Job UID or name to its run.
+func resolveRun(backend, namespace, id string) (*RunRef, error) {
+	resp, err := http.Get(fmt.Sprintf("%s/runs/%s?namespace=%s", backend, url.PathEscape(id), url.QueryEscape(namespace)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errRunNotFound
+	}
+	if resp.StatusCode >= 400 {
+		return nil, backendError(resp, body)
+	}
+
+	var run RunRef
+	if err := json.Unmarshal(body, &run); err != nil {
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+// lookupRun resolves the run of a /runs/ request. Links using a Job name are redirected to
+// the stable UID link, keeping the rest of the path and the query.
+func lookupRun(w http.ResponseWriter, r *http.Request, backend string) *RunRef {
+	id := r.PathValue("id")
+	run, err := resolveRun(backend, getNamespace(r.URL.Query().Get("namespace")), id)
+	if errors.Is(err, errRunNotFound) {
+		http.NotFound(w, r)
+		return nil
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return nil
+	}
+
+	if id != run.UID {
+		query := r.URL.Query()
+		query.Set("namespace", run.Namespace)
+		target := "/runs/" + run.UID + strings.TrimPrefix(r.URL.Path, "/runs/"+id) + "?" + query.Encode()
+		http.Redirect(w, r, target, http.StatusFound)
+		return nil
+	}
+
+	return run
+}
+
+// GET /runs/{id}?namespace=ns
+func runPage(w http.ResponseWriter, r *http.Request, backend string) {
+	run := lookupRun(w, r, backend)
+	if run == nil {
+		return
+	}
+
+	details, err := loadJobDetails(r.Context(), backend, run.Namespace, run.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	renderTemplate(w, "run.html", RunPageView{Run: *run, Details: details})
+}
+
+// GET /runs/{id}/logs/{pod}?namespace=ns&container=c&tail=n
+func runLogsPage(w http.ResponseWriter, r *http.Request, backend string) {
+	run := lookupRun(w, r, backend)
+	if run == nil {
+		return
+	}
+
+	query := r.URL.Query()
+	logs, err := loadPodLogs(r.Context(), backend, run.Namespace, r.PathValue("pod"), query.Get("container"), query.Get("tail"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	logs.Run = run
+
+	details, err := loadJobDetails(r.Context(), backend, run.Namespace, run.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	logs.Breadcrumbs = runBreadcrumbs(run, details.Job.Labels["playwright.operator/suite"], logs.Pod)
+	logs.Containers = details.Containers[logs.Pod]
+
+	logs.Bookmarks, err = loadBookmarks(r.Context(), backend, run, logs.Pod)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if logs.Tail == "" {
+		logs.Lines = logLines(logs.Logs, logs.Container, logs.Bookmarks)
+	}
+	logs.Raw = query.Get("raw") == "true"
+	if !logs.Raw {
+		filters := loadLogFilters(r.Context(), backend, run.Namespace)
+		if logs.Lines != nil {
+			logs.Lines, logs.Filtered = filterLogLines(logs.Lines, filters)
+		} else {
+			logs.Logs, logs.Filtered = filterLogText(logs.Logs, filters)
+		}
+	}
+	logs.CSRFToken = csrfToken(r)
+
+	renderTemplate(w, "run_logs.html", logs)
+}
+
+func loadPodLogs(ctx context.Context, backend, namespace, pod, container, tail string) (PodLogsView, error) {
+	query := url.Values{"namespace": {namespace}, "pod": {pod}}
+	if container == allContainers {
+		query.Set("allContainers", "true")
+	} else if container != "" {
+		query.Set("container", container)
+	}
+	if tail != "" {
+		query.Set("tail", tail)
+	}
+
+	body, err := callBackend(ctx, backend+"/pod/logs?"+query.Encode())
+	if err != nil {
+		return PodLogsView{}, err
+	}
+
+	var data struct {
+		Logs string `json:"logs"`
+	}
+	json.Unmarshal(body, &data)
+
+	return PodLogsView{Namespace: namespace, Pod: pod, Container: container, Tail: tail, Logs: data.Logs}, nil
+}
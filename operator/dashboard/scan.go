@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// errArtifactsHeld answers requests for artifacts of runs held back by the malware scan.
+var errArtifactsHeld = errors.New("the artifacts of the run are held back by the malware scan")
+
+type ScanFinding struct {
+	File      string `json:"file"`
+	Signature string `json:"signature"`
+}
+
+type ScanRelease struct {
+	By     string    `json:"by"`
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+}
+
+// ArtifactScan is the verdict of the malware scan of the artifacts of a run, which the
+// API keeps in the results volume.
+type ArtifactScan struct {
+	Run      RunRef        `json:"run"`
+	Status   string        `json:"status"`
+	Scanner  string        `json:"scanner"`
+	Scanned  time.Time     `json:"scanned"`
+	Files    int           `json:"files"`
+	Skipped  []string      `json:"skipped,omitempty"`
+	Findings []ScanFinding `json:"findings,omitempty"`
+	Release  *ScanRelease  `json:"release,omitempty"`
+}
+
+type QuarantineView struct {
+	UID         string
+	Scan        *ArtifactScan
+	Breadcrumbs []Breadcrumb
+	CanRelease  bool
+	CSRFToken   string
+	Error       string
+	// AskName asks who releases the artifacts, without authentication.
+	AskName bool
+}
+
+// artifactScanRequired holds back the artifacts of runs the API has not scanned yet, with
+// ARTIFACT_SCAN_REQUIRED=true where the API scans them. Otherwise only quarantined
+// artifacts are held back.
+func artifactScanRequired() bool {
+	return os.Getenv("ARTIFACT_SCAN_REQUIRED") == "true"
+}
+
+func readArtifactScan(uid string) (*ArtifactScan, error) {
+	if _, err := runDir(uid); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(resultsDir, "scans", uid+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var scan ArtifactScan
+	err = json.Unmarshal(data, &scan)
+
+	return &scan, err
+}
+
+// heldArtifacts tells whether the artifacts of a run are held back, with the scan of the
+// run if there is one. Unreadable scans hold the artifacts back.
+func heldArtifacts(uid string) (*ArtifactScan, bool) {
+	scan, err := readArtifactScan(uid)
+	if err != nil {
+		log.Printf("cannot read the artifact scan of run %s: %v", uid, err)
+		return nil, true
+	}
+	if scan == nil {
+		return nil, artifactScanRequired()
+	}
+
+	return scan, scan.Status == "quarantined"
+}
+
+// renderQuarantine answers requests for held back artifacts with the findings of the scan
+// and, for those who may, a form releasing them.
+func renderQuarantine(w http.ResponseWriter, r *http.Request, uid string, scan *ArtifactScan, message string) {
+	view := QuarantineView{
+		UID:         uid,
+		Scan:        scan,
+		Breadcrumbs: []Breadcrumb{{Title: "quarantine"}},
+		CSRFToken:   csrfToken(r),
+		Error:       message,
+	}
+	if session := currentSession(r); session != nil {
+		view.CanRelease = session.ReleaseArtifacts
+	} else {
+		view.CanRelease, view.AskName = true, true
+	}
+	if scan != nil {
+		view.Breadcrumbs = currentPage(append(listBreadcrumbs(scan.Run.Namespace, ""),
+			Breadcrumb{Title: scan.Run.Name, URL: runURL(&scan.Run)}, Breadcrumb{Title: "quarantine"}))
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	renderTemplate(w, "quarantine.html", view)
+}
+
+// POST /admin/scans/{uid}/release with the form fields reason and by releases the
+// quarantined artifacts of a run. The releaser is the signed in user, the by field only
+// counts without authentication.
+func releaseQuarantine(w http.ResponseWriter, r *http.Request, backend string) {
+	uid := r.PathValue("uid")
+	scan, held := heldArtifacts(uid)
+	if scan == nil || !held {
+		http.Redirect(w, r, "/pw/"+uid+"/", http.StatusSeeOther)
+		return
+	}
+
+	by := r.FormValue("by")
+	if session := currentSession(r); session != nil {
+		if !session.ReleaseArtifacts {
+			http.Error(w, "you may not release quarantined artifacts", http.StatusForbidden)
+			return
+		}
+		by = session.Name
+	}
+
+	payload, err := json.Marshal(map[string]string{"by": by, "reason": strings.TrimSpace(r.FormValue("reason"))})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	query := url.Values{"namespace": {scan.Run.Namespace}}
+	if _, err := postBackend(r.Context(), backend+"/admin/scans/"+url.PathEscape(uid)+"/release?"+query.Encode(), payload); err != nil {
+		renderQuarantine(w, r, uid, scan, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/pw/"+uid+"/", http.StatusSeeOther)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type ScheduleStatus struct {
+	Name                       string      `json:"name"`
+	Schedule                   string      `json:"schedule"`
+	TimeZone                   string      `json:"timeZone"`
+	Suspended                  bool        `json:"suspended"`
+	SuccessfulRunsHistoryLimit int32       `json:"successfulRunsHistoryLimit"`
+	FailedRunsHistoryLimit     int32       `json:"failedRunsHistoryLimit"`
+	LastRun                    *time.Time  `json:"lastRun"`
+	LastSuccessfulRun          *time.Time  `json:"lastSuccessfulRun"`
+	Upcoming                   []time.Time `json:"upcoming"`
+	Active                     []string    `json:"active"`
+}
+
+type SchedulesPageView struct {
+	Namespace   string
+	Schedules   []ScheduleStatus
+	Breadcrumbs []Breadcrumb
+}
+
+// GET /schedules?namespace=ns
+func schedulesPage(w http.ResponseWriter, r *http.Request, backend string) {
+	namespace := getNamespace(r.FormValue("namespace"))
+
+	body, err := getBackend(r.Context(), backend+"/schedules?"+url.Values{"namespace": {namespace}}.Encode())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	var schedules []ScheduleStatus
+	json.Unmarshal(body, &schedules)
+
+	renderTemplate(w, "schedules.html", SchedulesPageView{
+		Namespace:   namespace,
+		Schedules:   schedules,
+		Breadcrumbs: []Breadcrumb{{Title: namespace, URL: listURL(namespace, "")}, {Title: "schedules"}},
+	})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The dashboard loads bootstrap and htmx from CDNs, and htmx needs eval for hx-on handlers
+// and inline styles for its indicators.
+const defaultContentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-eval' https://unpkg.com; " +
+	"style-src 'self' 'unsafe-inline' https://cdn.jsdelivr.net; " +
+	"img-src 'self' data:; " +
+	"connect-src 'self'; " +
+	"object-src 'none'; " +
+	"base-uri 'self'"
+
+// Playwright HTML reports are a single page with inline scripts that render
+// screenshots, videos and traces from data and blob URLs.
+const defaultReportContentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline' 'unsafe-eval'; " +
+	"style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self' data: blob:; " +
+	"media-src 'self' data: blob:; " +
+	"font-src 'self' data:; " +
+	"worker-src 'self' blob:; " +
+	"connect-src 'self' data: blob:; " +
+	"object-src 'none'; " +
+	"base-uri 'self'"
+
+// reportSandbox runs reports in an origin of their own, so HTML attachments of tests can
+// neither read the cookies of the dashboard nor send requests with the session of the
+// user. It is added to REPORT_CONTENT_SECURITY_POLICY too. Links open outside the sandbox.
+const reportSandbox = "sandbox allow-scripts allow-popups allow-popups-to-escape-sandbox allow-downloads"
+
+type securityConfig struct {
+	contentSecurityPolicy       string
+	reportContentSecurityPolicy string
+	// frameAncestors are the origins allowed to embed the dashboard in a frame.
+	frameAncestors []string
+	hstsMaxAge     int
+	referrerPolicy string
+}
+
+// securityConfigFromEnv reads CONTENT_SECURITY_POLICY, REPORT_CONTENT_SECURITY_POLICY,
+// FRAME_ANCESTORS (space separated origins), HSTS_MAX_AGE (seconds, 0 disables) and
+// REFERRER_POLICY.
+func securityConfigFromEnv() securityConfig {
+	cfg := securityConfig{
+		contentSecurityPolicy:       envOrDefault("CONTENT_SECURITY_POLICY", defaultContentSecurityPolicy),
+		reportContentSecurityPolicy: envOrDefault("REPORT_CONTENT_SECURITY_POLICY", defaultReportContentSecurityPolicy),
+		frameAncestors:              strings.Fields(os.Getenv("FRAME_ANCESTORS")),
+		referrerPolicy:              envOrDefault("REFERRER_POLICY", "strict-origin-when-cross-origin"),
+	}
+
+	if v := os.Getenv("HSTS_MAX_AGE"); v != "" {
+		maxAge, err := strconv.Atoi(v)
+		if err == nil && maxAge > 0 {
+			cfg.hstsMaxAge = maxAge
+		}
+	}
+
+	return cfg
+}
+
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return fallback
+}
+
+func (cfg securityConfig) policy(path string) string {
+	policy := cfg.contentSecurityPolicy
+	if rel, ok := reportPathFile(path); ok {
+		policy = cfg.reportContentSecurityPolicy
+		// the trace viewer Playwright copies next to the report registers a service worker,
+		// which sandboxed origins cannot, it is not written by tests
+		if !strings.HasPrefix(rel, "trace/") {
+			policy += "; " + reportSandbox
+		}
+	}
+
+	return policy + "; frame-ancestors " + strings.Join(append([]string{"'self'"}, cfg.frameAncestors...), " ")
+}
+
+// reportPathFile returns the path of a file of a report below /pw/{uid}/, /reports/{token}/ or
+// /share/{token}/report/.
+func reportPathFile(path string) (string, bool) {
+	switch {
+	case strings.HasPrefix(path, "/pw/"), strings.HasPrefix(path, "/reports/"):
+		_, rel, ok := strings.Cut(strings.SplitN(path, "/", 3)[2], "/")
+		return rel, ok
+	case sharedReportPath(path):
+		_, rest, _ := strings.Cut(strings.TrimPrefix(path, "/share/"), "/")
+		return strings.TrimPrefix(rest, "report/"), true
+	}
+
+	return "", false
+}
+
+// sharedReportPath tells whether a path is of the report of a shared run,
+// /share/{token}/report/...
+func sharedReportPath(path string) bool {
+	token, rest, ok := strings.Cut(strings.TrimPrefix(path, "/share/"), "/")
+	return ok && token != "" && strings.HasPrefix(path, "/share/") && strings.HasPrefix(rest, "report/")
+}
+
+func securityHeadersMiddleware(cfg securityConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Security-Policy", cfg.policy(r.URL.Path))
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", cfg.referrerPolicy)
+
+		// X-Frame-Options cannot express an allowlist, frame-ancestors takes over when one is configured
+		if len(cfg.frameAncestors) == 0 {
+			h.Set("X-Frame-Options", "SAMEORIGIN")
+		}
+
+		if cfg.hstsMaxAge > 0 {
+			h.Set("Strict-Transport-Security", "max-age="+strconv.Itoa(cfg.hstsMaxAge)+"; includeSubDomains")
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reportToken grants access to a report for as long as the session it was issued to. The
+// sandboxed reports load their files without the session cookie, which browsers do not
+// send for requests of opaque origins, so signed in users browse them below
+// /reports/{token}/.
+type reportToken struct {
+	Report  string    `json:"report"`
+	Expires time.Time `json:"expires"`
+}
+
+// reportRedirect redirects a request for a file of a report below /pw/{uid}/ to the same
+// file below /reports/{token}/ with a token of the session. It returns false without
+// authentication, when reports need no cookies to load.
+func reportRedirect(w http.ResponseWriter, r *http.Request, cfg authConfig, uid, rel string) bool {
+	session := currentSession(r)
+	if cfg.issuer == "" || session == nil {
+		return false
+	}
+	token, err := cfg.sign(reportToken{Report: uid, Expires: session.Expires})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+
+	target := "/reports/" + url.PathEscape(token) + "/" + rel
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+
+	return true
+}
+
+// parseReportToken returns the report directory the token of a request below
+// /reports/{token}/ grants access to.
+func parseReportToken(cfg authConfig, r *http.Request) (string, bool) {
+	token, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/reports/"), "/")
+	var report reportToken
+	if cfg.verify(token, &report) != nil || report.Report == "" || !time.Now().Before(report.Expires) {
+		return "", false
+	}
+
+	return report.Report, true
+}
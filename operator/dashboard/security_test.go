@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportsAreSandboxed(t *testing.T) {
+	cfg := securityConfig{contentSecurityPolicy: defaultContentSecurityPolicy, reportContentSecurityPolicy: defaultReportContentSecurityPolicy}
+	for path, sandboxed := range map[string]bool{
+		"/pw/3f1d/index.html":                 true,
+		"/pw/3f1d/data/attachment.html":       true,
+		"/reports/token/data/attachment.html": true,
+		"/share/token/report/index.html":      true,
+		"/pw/3f1d/trace/index.html":           false,
+		"/reports/token/trace/sw.bundle.js":   false,
+		"/runs":                               false,
+	} {
+		policy := cfg.policy(path)
+		if got := strings.Contains(policy, reportSandbox); got != sandboxed {
+			t.Errorf("%s: policy %q, sandboxed %v, want %v", path, policy, got, sandboxed)
+		}
+		if sandboxed && strings.Contains(policy, "allow-same-origin") {
+			t.Errorf("%s: reports share the origin of the dashboard: %q", path, policy)
+		}
+	}
+}
+
+func TestReportRedirect(t *testing.T) {
+	cfg := authConfig{issuer: "https://issuer.example", sessionKey: []byte("secret")}
+	session := &Session{Subject: "alice", Expires: time.Now().Add(time.Hour)}
+
+	req := httptest.NewRequest(http.MethodGet, "/pw/3f1d/index.html?filter=failed", nil)
+	req = req.WithContext(context.WithValue(req.Context(), sessionContextKey{}, session))
+	rec := httptest.NewRecorder()
+	if !reportRedirect(rec, req, cfg, "3f1d", "index.html") {
+		t.Fatal("signed in users are served reports below /pw/, which load without their cookie")
+	}
+	location := rec.Header().Get("Location")
+	if !strings.HasPrefix(location, "/reports/") || !strings.HasSuffix(location, "/index.html?filter=failed") {
+		t.Fatalf("Location = %q", location)
+	}
+
+	// the files of the report load with the token alone
+	handler := sessionMiddleware(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if uid, ok := parseReportToken(cfg, r); !ok || uid != "3f1d" {
+			t.Errorf("parseReportToken() = %q, %v", uid, ok)
+		}
+	}))
+	token, _, _ := strings.Cut(strings.TrimPrefix(location, "/reports/"), "/")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reports/"+token+"/data/screenshot.png", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("files of the report answered %d without the cookie", rec.Code)
+	}
+
+	expired, _ := cfg.sign(reportToken{Report: "3f1d", Expires: time.Now().Add(-time.Minute)})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reports/"+expired+"/index.html", nil))
+	if rec.Code != http.StatusFound || !strings.HasPrefix(rec.Header().Get("Location"), "/auth/login") {
+		t.Errorf("expired report links answered %d, want the sign in", rec.Code)
+	}
+
+	// without sign in reports load without cookies anyway
+	if reportRedirect(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/pw/3f1d/index.html", nil), authConfig{}, "3f1d", "index.html") {
+		t.Error("reports are redirected without authentication")
+	}
+}
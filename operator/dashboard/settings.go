@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// features are the feature flags of the settings, in the order the admin page lists them.
+var features = []Feature{
+	{Name: "videoPreviews", Title: "Video previews"},
+	{Name: "artifactRetention", Title: "Artifact retention of suite policies"},
+}
+
+type Feature struct {
+	Name  string
+	Title string
+}
+
+// Settings tune the API without redeploying it, unset fields fall back to its environment.
+type Settings struct {
+	RunTTLSecondsAfterFinished *int32          `json:"runTTLSecondsAfterFinished,omitempty"`
+	MaxRunningRuns             int             `json:"maxRunningRuns,omitempty"`
+	SLOAlertWebhook            string          `json:"sloAlertWebhook,omitempty"`
+	MonitorAlertWebhook        string          `json:"monitorAlertWebhook,omitempty"`
+	Features                   map[string]bool `json:"features,omitempty"`
+	Hooks                      []Hook          `json:"hooks,omitempty"`
+	AdmissionRules             []AdmissionRule `json:"admissionRules,omitempty"`
+	CostLabels                 []string        `json:"costLabels,omitempty"`
+}
+
+// Hook is an external endpoint the API calls at an extension point, the admin page lists
+// them but leaves changing them to the API.
+type Hook struct {
+	Point         string `json:"point"`
+	URL           string `json:"url"`
+	Timeout       string `json:"timeout,omitempty"`
+	FailurePolicy string `json:"failurePolicy,omitempty"`
+}
+
+// AdmissionRule rejects new runs its expression does not hold for, like hooks the admin
+// page only lists them.
+type AdmissionRule struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+	Message    string `json:"message,omitempty"`
+}
+
+type SettingsChange struct {
+	By     string    `json:"by"`
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+	Fields []string  `json:"fields"`
+}
+
+type SettingsResponse struct {
+	Settings  Settings         `json:"settings"`
+	Effective Settings         `json:"effective"`
+	Audit     []SettingsChange `json:"audit"`
+}
+
+type FeatureView struct {
+	Feature
+	Enabled bool
+}
+
+type SettingsView struct {
+	SettingsResponse
+	Features    []FeatureView
+	Breadcrumbs []Breadcrumb
+	CSRFToken   string
+	Error       string
+	Saved       bool
+}
+
+func renderSettings(w http.ResponseWriter, r *http.Request, resp SettingsResponse, message string, saved bool) {
+	view := SettingsView{
+		SettingsResponse: resp,
+		Breadcrumbs:      []Breadcrumb{{Title: "settings"}},
+		CSRFToken:        csrfToken(r),
+		Error:            message,
+		Saved:            saved,
+	}
+	for _, feature := range features {
+		enabled, ok := resp.Settings.Features[feature.Name]
+		view.Features = append(view.Features, FeatureView{Feature: feature, Enabled: !ok || enabled})
+	}
+	// newest changes first
+	for i, j := 0, len(view.Audit)-1; i < j; i, j = i+1, j-1 {
+		view.Audit[i], view.Audit[j] = view.Audit[j], view.Audit[i]
+	}
+
+	renderTemplate(w, "settings.html", view)
+}
+
+func loadSettings(ctx context.Context, backend string) (SettingsResponse, error) {
+	body, err := getBackend(ctx, backend+"/admin/settings")
+	if err != nil {
+		return SettingsResponse{}, err
+	}
+
+	var resp SettingsResponse
+	err = json.Unmarshal(body, &resp)
+
+	return resp, err
+}
+
+// GET /admin/settings shows the settings of the API and who changed them.
+func settingsPage(w http.ResponseWriter, r *http.Request, backend string) {
+	resp, err := loadSettings(r.Context(), backend)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	renderSettings(w, r, resp, "", false)
+}
+
+// settingsForm reads the settings of the form, empty fields are unset and only switched
+// off features are stored.
+func settingsForm(r *http.Request) (Settings, error) {
+	settings := Settings{
+		SLOAlertWebhook:     strings.TrimSpace(r.FormValue("sloAlertWebhook")),
+		MonitorAlertWebhook: strings.TrimSpace(r.FormValue("monitorAlertWebhook")),
+	}
+	if v := strings.TrimSpace(r.FormValue("runTTLSecondsAfterFinished")); v != "" {
+		ttl, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return settings, fmt.Errorf("run TTL must be a number of seconds")
+		}
+		seconds := int32(ttl)
+		settings.RunTTLSecondsAfterFinished = &seconds
+	}
+	if v := strings.TrimSpace(r.FormValue("maxRunningRuns")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return settings, fmt.Errorf("max running runs must be a number")
+		}
+		settings.MaxRunningRuns = n
+	}
+	for _, key := range strings.Split(r.FormValue("costLabels"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			settings.CostLabels = append(settings.CostLabels, key)
+		}
+	}
+	for _, feature := range features {
+		if r.FormValue("feature-"+feature.Name) != "on" {
+			if settings.Features == nil {
+				settings.Features = map[string]bool{}
+			}
+			settings.Features[feature.Name] = false
+		}
+	}
+
+	return settings, nil
+}
+
+// POST /admin/settings with the form of the settings page, by and reason, replaces the
+// settings of the API except for its hooks. Errors show the form again with the values entered.
+func saveSettings(w http.ResponseWriter, r *http.Request, backend string) {
+	current, err := loadSettings(r.Context(), backend)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	settings, err := settingsForm(r)
+	// the form has no fields for hooks and admission rules, they are kept as they are
+	settings.Hooks = current.Settings.Hooks
+	settings.AdmissionRules = current.Settings.AdmissionRules
+	if err != nil {
+		current.Settings = settings
+		renderSettings(w, r, current, err.Error(), false)
+		return
+	}
+
+	payload, err := json.Marshal(struct {
+		Settings
+		By     string `json:"by"`
+		Reason string `json:"reason"`
+	}{settings, r.FormValue("by"), r.FormValue("reason")})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	body, err := putBackend(r.Context(), backend+"/admin/settings", payload)
+	if err != nil {
+		current.Settings = settings
+		renderSettings(w, r, current, err.Error(), false)
+		return
+	}
+
+	var saved SettingsResponse
+	if err := json.Unmarshal(body, &saved); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	renderSettings(w, r, saved, "", true)
+}
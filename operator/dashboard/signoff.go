@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// SignOff is the signed statement of who signed off a run, see signOffRun of the API.
+type SignOff struct {
+	Run       RunRef    `json:"run"`
+	Outcome   string    `json:"outcome"`
+	By        string    `json:"by"`
+	Subject   string    `json:"subject"`
+	Comment   string    `json:"comment"`
+	Time      time.Time `json:"time"`
+	Archive   string    `json:"archive"`
+	Files     int       `json:"files"`
+	Digest    string    `json:"digest"`
+	Signature string    `json:"signature"`
+	KeyID     string    `json:"keyId"`
+}
+
+// POST /frontend/job/signoff with namespace, name, by and comment. The signer is the
+// signed in user, the by field only counts without authentication.
+func signOffJob(w http.ResponseWriter, r *http.Request, backend string) {
+	namespace := getNamespace(r.FormValue("namespace"))
+	name := r.FormValue("name")
+
+	by := r.FormValue("by")
+	if session := currentSession(r); session != nil {
+		if !session.SignOff {
+			http.Error(w, "you may not sign off runs", http.StatusForbidden)
+			return
+		}
+		by = session.Name
+	}
+
+	payload, err := json.Marshal(map[string]string{"by": by, "comment": r.FormValue("comment")})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	query := url.Values{"namespace": {namespace}}
+	if _, err := postBackend(r.Context(), backend+"/runs/"+url.PathEscape(name)+"/signoff?"+query.Encode(), payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	renderJobDetails(w, r, backend, namespace, name)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	soakChartWidth  = 600
+	soakChartHeight = 100
+)
+
+// soakColors tell the pods of a sharded soak run apart.
+var soakColors = []string{"#0d6efd", "#198754", "#fd7e14", "#6f42c1", "#d63384", "#20c997"}
+
+// RunSoak are the options of a soak run, see RunSoak of the API.
+type RunSoak struct {
+	Interval        string  `json:"interval,omitempty"`
+	Warmup          string  `json:"warmup,omitempty"`
+	MaxMemory       string  `json:"maxMemory,omitempty"`
+	MaxMemoryGrowth float64 `json:"maxMemoryGrowth,omitempty"`
+}
+
+type SoakPodUsage struct {
+	Pod                string `json:"pod"`
+	MemoryBytes        int64  `json:"memoryBytes"`
+	CPUMillicores      int64  `json:"cpuMillicores"`
+	BrowserMemoryBytes int64  `json:"browserMemoryBytes"`
+	BrowserCPU         int64  `json:"browserCpuMillicores"`
+}
+
+type SoakSnapshot struct {
+	Time  time.Time      `json:"time"`
+	Pods  []SoakPodUsage `json:"pods"`
+	Tests int            `json:"tests"`
+}
+
+type SoakReport struct {
+	RunRef
+	Soak      RunSoak        `json:"soak"`
+	Snapshots []SoakSnapshot `json:"snapshots"`
+	Violation string         `json:"violation,omitempty"`
+}
+
+// SoakSeries is a line of a chart, Points are SVG polyline points.
+type SoakSeries struct {
+	Name   string
+	Color  string
+	Dashed bool
+	Points string
+}
+
+// SoakChart plots a measure of the snapshots over the time of the run, Max labels its
+// top.
+type SoakChart struct {
+	Title  string
+	Max    string
+	Series []SoakSeries
+}
+
+type SoakView struct {
+	UID       string
+	Namespace string
+	Active    bool
+	Report    SoakReport
+	Charts    []SoakChart
+	// Latest is the usage of the last snapshot, formatted.
+	Latest []SoakPodUsageView
+	Tests  int
+	From   string
+	To     string
+}
+
+type SoakPodUsageView struct {
+	Pod           string
+	Memory        string
+	BrowserMemory string
+	CPU           string
+}
+
+func formatMiB(bytes int64) string {
+	return fmt.Sprintf("%.0f MiB", float64(bytes)/(1<<20))
+}
+
+// soakPoints returns the SVG polyline points of value over the time of the snapshots,
+// scaled to top. Snapshots without a value are left out.
+func soakPoints(snapshots []SoakSnapshot, top int64, value func(SoakSnapshot) (int64, bool)) string {
+	first, last := snapshots[0].Time, snapshots[len(snapshots)-1].Time
+	span := last.Sub(first).Seconds()
+
+	var points []string
+	for _, s := range snapshots {
+		v, ok := value(s)
+		if !ok {
+			continue
+		}
+		x, y := 0.0, float64(soakChartHeight)
+		if span > 0 {
+			x = s.Time.Sub(first).Seconds() / span * soakChartWidth
+		}
+		if top > 0 {
+			y -= float64(v) / float64(top) * soakChartHeight
+		}
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+
+	return strings.Join(points, " ")
+}
+
+// soakChart plots the values of every pod, the first value of a pod solid and the
+// second, if any, dashed.
+func soakChart(title string, snapshots []SoakSnapshot, format func(int64) string, values ...func(SoakPodUsage) int64) SoakChart {
+	var pods []string
+	seen := map[string]bool{}
+	var top int64
+	for _, s := range snapshots {
+		for _, pod := range s.Pods {
+			if !seen[pod.Pod] {
+				seen[pod.Pod] = true
+				pods = append(pods, pod.Pod)
+			}
+			for _, value := range values {
+				top = max(top, value(pod))
+			}
+		}
+	}
+
+	chart := SoakChart{Title: title, Max: format(top)}
+	for p, name := range pods {
+		for i, value := range values {
+			points := soakPoints(snapshots, top, func(s SoakSnapshot) (int64, bool) {
+				for _, pod := range s.Pods {
+					if pod.Pod == name {
+						return value(pod), true
+					}
+				}
+				return 0, false
+			})
+			chart.Series = append(chart.Series, SoakSeries{Name: name, Color: soakColors[p%len(soakColors)], Dashed: i > 0, Points: points})
+		}
+	}
+
+	return chart
+}
+
+// testsChart plots the tests that wrote their output over the time of the run.
+func testsChart(snapshots []SoakSnapshot) SoakChart {
+	var top int64
+	for _, s := range snapshots {
+		top = max(top, int64(s.Tests))
+	}
+	points := soakPoints(snapshots, top, func(s SoakSnapshot) (int64, bool) { return int64(s.Tests), true })
+
+	return SoakChart{Title: "Tests", Max: fmt.Sprint(top), Series: []SoakSeries{{Name: "tests", Color: soakColors[0], Points: points}}}
+}
+
+// GET /frontend/runs/{uid}/soak?namespace=ns&active=true renders the snapshots of a soak
+// run, polling while it is active.
+func renderSoak(w http.ResponseWriter, r *http.Request, backend string) {
+	uid := r.PathValue("uid")
+	namespace := getNamespace(r.URL.Query().Get("namespace"))
+	body, err := callBackend(r.Context(), backend+"/runs/"+url.PathEscape(uid)+"/soak?"+url.Values{"namespace": {namespace}}.Encode())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	view := SoakView{UID: uid, Namespace: namespace, Active: r.URL.Query().Get("active") == "true"}
+	if err := json.Unmarshal(body, &view.Report); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if snapshots := view.Report.Snapshots; len(snapshots) > 0 {
+		view.Charts = []SoakChart{
+			soakChart("Memory (pod, browser dashed)", snapshots, formatMiB,
+				func(u SoakPodUsage) int64 { return u.MemoryBytes },
+				func(u SoakPodUsage) int64 { return u.BrowserMemoryBytes }),
+			soakChart("CPU (pod, browser dashed)", snapshots, func(v int64) string { return fmt.Sprintf("%dm", v) },
+				func(u SoakPodUsage) int64 { return u.CPUMillicores },
+				func(u SoakPodUsage) int64 { return u.BrowserCPU }),
+			testsChart(snapshots),
+		}
+
+		latest := snapshots[len(snapshots)-1]
+		for _, pod := range latest.Pods {
+			view.Latest = append(view.Latest, SoakPodUsageView{
+				Pod:           pod.Pod,
+				Memory:        formatMiB(pod.MemoryBytes),
+				BrowserMemory: formatMiB(pod.BrowserMemoryBytes),
+				CPU:           fmt.Sprintf("%dm", pod.CPUMillicores),
+			})
+		}
+		view.Tests = latest.Tests
+		view.From = snapshots[0].Time.Local().Format("15:04")
+		view.To = latest.Time.Local().Format("15:04")
+	}
+
+	renderTemplate(w, "soak.html", view)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TraceabilityMatrix maps requirements to the tests covering them, see getTraceability of
+// the API.
+type TraceabilityMatrix struct {
+	Namespace  string        `json:"namespace"`
+	Annotation string        `json:"annotation"`
+	Generated  time.Time     `json:"generated"`
+	Runs       []RunRef      `json:"runs"`
+	Rows       []Requirement `json:"requirements"`
+}
+
+type Requirement struct {
+	ID     string         `json:"id"`
+	Status string         `json:"status"`
+	Tests  []CoveringTest `json:"tests"`
+}
+
+type CoveringTest struct {
+	Suite   string `json:"suite"`
+	Run     string `json:"run"`
+	File    string `json:"file"`
+	Title   string `json:"title"`
+	Project string `json:"project,omitempty"`
+	Status  string `json:"status"`
+}
+
+type TraceabilityPageView struct {
+	TraceabilityMatrix
+	Suite       string
+	ExportURL   string
+	Breadcrumbs []Breadcrumb
+}
+
+func traceabilityQuery(r *http.Request) url.Values {
+	query := url.Values{"namespace": {getNamespace(r.FormValue("namespace"))}}
+	for _, key := range []string{"suite", "annotation"} {
+		if v := r.FormValue(key); v != "" {
+			query.Set(key, v)
+		}
+	}
+
+	return query
+}
+
+// GET /traceability?namespace=ns&suite=name&annotation=requirement
+func traceabilityPage(w http.ResponseWriter, r *http.Request, backend string) {
+	query := traceabilityQuery(r)
+	body, err := getBackend(r.Context(), backend+"/traceability?"+query.Encode())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	var view TraceabilityPageView
+	if err := json.Unmarshal(body, &view.TraceabilityMatrix); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	view.Suite = query.Get("suite")
+	view.ExportURL = "/traceability/export?" + query.Encode()
+	view.Breadcrumbs = currentPage(append(listBreadcrumbs(view.Namespace, view.Suite), Breadcrumb{Title: "traceability"}))
+
+	renderTemplate(w, "traceability.html", view)
+}
+
+// GET /traceability/export?namespace=ns&suite=name&annotation=requirement downloads the
+// matrix as CSV.
+func exportTraceability(w http.ResponseWriter, r *http.Request, backend string) {
+	query := traceabilityQuery(r)
+	query.Set("format", "csv")
+	body, err := getBackend(r.Context(), backend+"/traceability?"+query.Encode())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "traceability-"+query.Get("namespace")+".csv"))
+	w.Write(body)
+}
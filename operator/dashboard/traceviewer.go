@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// traceTokenTTL is how long a hosted trace viewer may fetch a trace it was opened with.
+const traceTokenTTL = 10 * time.Minute
+
+// traceToken lets the hosted trace viewer fetch a trace without the session cookie, which
+// its requests from another origin do not carry.
+type traceToken struct {
+	Trace   string    `json:"trace"`
+	Expires time.Time `json:"expires"`
+}
+
+// traceViewerURL is the hosted trace viewer traces open in when no report of their run
+// brings one, TRACE_VIEWER_URL, e.g. https://trace.playwright.dev. The viewer runs in the
+// browser and fetches the trace from the dashboard.
+func traceViewerURL() string {
+	return strings.TrimSuffix(os.Getenv("TRACE_VIEWER_URL"), "/")
+}
+
+// traceFile returns the file of a trace served below /live/ or /pw/.
+func traceFile(trace string) (string, error) {
+	if path.Ext(trace) != ".zip" {
+		return "", errors.New("not a trace")
+	}
+
+	prefix, rest, _ := strings.Cut(strings.TrimPrefix(trace, "/"), "/")
+	uid, rel, ok := strings.Cut(rest, "/")
+	if !ok || !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return "", errors.New("invalid trace path")
+	}
+
+	var dir string
+	var err error
+	switch prefix {
+	case "live":
+		dir, err = checkpointRunDir(uid)
+	case "pw":
+		dir, err = runDir(uid)
+	default:
+		err = errors.New("invalid trace path")
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, held := heldArtifacts(uid); held {
+		return "", errArtifactsHeld
+	}
+
+	return filepath.Join(dir, filepath.FromSlash(rel)), nil
+}
+
+// reportTraceViewer returns the trace viewer that came with a report of a run, empty if
+// none of its reports has one.
+func reportTraceViewer(details JobDetailsView) string {
+	for _, uid := range runReportUIDs(details.Job, details.Pods) {
+		if _, err := os.Stat(filepath.Join(resultsDir, uid, "trace", "index.html")); err == nil {
+			return "/pw/" + uid + "/trace/index.html"
+		}
+	}
+
+	return ""
+}
+
+// requestOrigin is the origin the browser reached the dashboard at.
+func requestOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host
+}
+
+// GET /trace?namespace=ns&run=uid&trace=/live/<uid>/<path> opens a trace of a run in the
+// trace viewer of one of its reports, which runs on the dashboard, or in the hosted trace
+// viewer of TRACE_VIEWER_URL.
+func openTrace(w http.ResponseWriter, r *http.Request, backend string, cfg authConfig) {
+	trace := r.URL.Query().Get("trace")
+	file, err := traceFile(trace)
+	if errors.Is(err, errArtifactsHeld) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := os.Stat(file); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	run, err := resolveRun(backend, getNamespace(r.URL.Query().Get("namespace")), r.URL.Query().Get("run"))
+	if errors.Is(err, errRunNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	details, err := loadJobDetails(r.Context(), backend, run.Namespace, run.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if viewer := reportTraceViewer(details); viewer != "" {
+		http.Redirect(w, r, viewer+"?"+url.Values{"trace": {trace}}.Encode(), http.StatusFound)
+		return
+	}
+
+	viewer := traceViewerURL()
+	if viewer == "" {
+		http.Error(w, "no report of the run has a trace viewer and TRACE_VIEWER_URL is not set", http.StatusNotFound)
+		return
+	}
+	query := url.Values{"trace": {trace}}
+	if cfg.issuer != "" {
+		token, err := cfg.sign(traceToken{Trace: trace, Expires: time.Now().Add(traceTokenTTL)})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		query.Set("token", token)
+	}
+	target := requestOrigin(r) + "/traces?" + query.Encode()
+	http.Redirect(w, r, viewer+"/?"+url.Values{"trace": {target}}.Encode(), http.StatusFound)
+}
+
+// validTraceToken tells whether a request for a trace carries a token of openTrace for it.
+func validTraceToken(cfg authConfig, r *http.Request) bool {
+	var token traceToken
+	if err := cfg.verify(r.URL.Query().Get("token"), &token); err != nil {
+		return false
+	}
+
+	return token.Trace == r.URL.Query().Get("trace") && time.Now().Before(token.Expires)
+}
+
+// GET /traces?trace=/live/<uid>/<path>&token=t serves a trace to the hosted trace viewer,
+// with authentication only with the token of openTrace, see sessionMiddleware.
+func serveTrace(w http.ResponseWriter, r *http.Request) {
+	file, err := traceFile(r.URL.Query().Get("trace"))
+	if errors.Is(err, errArtifactsHeld) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if viewer, err := url.Parse(traceViewerURL()); err == nil && viewer.Host != "" {
+		w.Header().Set("Access-Control-Allow-Origin", viewer.Scheme+"://"+viewer.Host)
+		w.Header().Set("Vary", "Origin")
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	http.ServeFile(w, r, file)
+}
@@ -0,0 +1,15 @@
+import { defineConfig } from '@playwright/test';
+
+export default defineConfig({
+  testDir: './tests',
+  retries: 1,
+  use: {
+    baseURL: process.env.DASHBOARD_URL ?? 'http://localhost:3000',
+    trace: 'on',
+  },
+  reporter: [['html', { open: 'never' }]],
+  projects: [
+    { name: 'setup', testMatch: /auth\.setup\.ts/ },
+    { name: 'dashboard', dependencies: ['setup'], use: { storageState: '.auth/selftest.json' } },
+  ],
+});
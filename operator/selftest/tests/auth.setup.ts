@@ -0,0 +1,13 @@
+import { expect, test as setup } from '@playwright/test';
+
+// Dashboards requiring authentication sign the self-test in with the token of its service
+// account, which the operator passes as SELFTEST_TOKEN. The session is kept for the tests
+// in the storage state of playwright.config.ts.
+setup('sign in', async ({ request }) => {
+  const token = process.env.SELFTEST_TOKEN;
+  if (token) {
+    const response = await request.post('/auth/selftest', { headers: { Authorization: `Bearer ${token}` } });
+    expect(response.status(), await response.text()).toBe(204);
+  }
+  await request.storageState({ path: '.auth/selftest.json' });
+});
@@ -0,0 +1,30 @@
+import { expect, test } from '@playwright/test';
+
+test('the self-test is signed in', async ({ page }) => {
+  test.skip(!process.env.SELFTEST_TOKEN, 'the operator passes no token without SELFTEST_SERVICE_ACCOUNT');
+  await page.goto('/');
+  await expect(page).not.toHaveURL(/\/auth\/login/);
+  const response = await page.request.post('/auth/selftest', { headers: { Authorization: 'Bearer invalid' } });
+  expect(response.status()).toBe(401);
+});
+
+test('dashboard loads the job list', async ({ page }) => {
+  await page.goto('/');
+  await expect(page.getByRole('heading', { name: 'Playwright Dashboard' })).toBeVisible();
+  await expect(page.locator('#job-list')).not.toBeEmpty();
+});
+
+test('job details open from the list', async ({ page }) => {
+  await page.goto('/');
+  const job = page.locator('#job-list a').first();
+  await expect(job).toBeVisible();
+  await job.click();
+  await expect(page.locator('#job-details h3')).toContainText('Job ');
+});
+
+test('security headers are set', async ({ request }) => {
+  const response = await request.get('/');
+  expect(response.ok()).toBeTruthy();
+  expect(response.headers()['content-security-policy']).toBeTruthy();
+  expect(response.headers()['x-content-type-options']).toBe('nosniff');
+});
@@ -0,0 +1,38 @@
+// Package buildinfo identifies the build of the API and the dashboard.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// The build sets these with -ldflags "-X shared/buildinfo.version=... -X
+// shared/buildinfo.commit=... -X shared/buildinfo.buildDate=...", see the Dockerfiles.
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// Info identifies the build of a service, so a deployment can be traced back to its code.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns the build of the running binary.
+func Get() Info {
+	info := Info{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version()}
+	// go build in a checkout records the commit on its own
+	if bi, ok := debug.ReadBuildInfo(); ok && info.Commit == "unknown" {
+		for _, setting := range bi.Settings {
+			if setting.Key == "vcs.revision" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+
+	return info
+}
@@ -0,0 +1,193 @@
+// Package clientip finds the client address of requests behind trusted proxies and applies
+// the address lists of the route classes to them.
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// Route classes the address lists apply to.
+const (
+	// ClassAdmin are the requests under /admin/ and those changing something.
+	ClassAdmin = "admin"
+	ClassRead  = "read"
+)
+
+// NetworkList holds IP networks, single addresses count as /32 or /128 networks.
+type NetworkList []netip.Prefix
+
+// ParseNetworkList parses a comma separated list of addresses and CIDRs.
+func ParseNetworkList(s string) (NetworkList, error) {
+	var list NetworkList
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(item); err == nil {
+			list = append(list, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither an IP address nor a CIDR", item)
+		}
+		addr = addr.Unmap()
+		list = append(list, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return list, nil
+}
+
+// Contains tells whether an address is in one of the networks.
+func (l NetworkList) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range l {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Config are the trusted proxies and the address lists of the route classes.
+type Config struct {
+	// TrustedProxies are the ingress controllers and load balancers whose X-Forwarded-For
+	// is believed.
+	TrustedProxies NetworkList
+	Allow          map[string]NetworkList
+	Deny           map[string]NetworkList
+}
+
+// ConfigFromEnv reads TRUSTED_PROXIES and the allowlists and denylists of the route
+// classes, ADMIN_IP_ALLOWLIST, ADMIN_IP_DENYLIST, READ_IP_ALLOWLIST and READ_IP_DENYLIST,
+// all comma separated addresses and CIDRs. Classes without allowlist admit every address
+// that is not denied.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{Allow: map[string]NetworkList{}, Deny: map[string]NetworkList{}}
+
+	var err error
+	if cfg.TrustedProxies, err = ParseNetworkList(os.Getenv("TRUSTED_PROXIES")); err != nil {
+		return cfg, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	for _, class := range []string{ClassAdmin, ClassRead} {
+		prefix := strings.ToUpper(class) + "_IP_"
+		if cfg.Allow[class], err = ParseNetworkList(os.Getenv(prefix + "ALLOWLIST")); err != nil {
+			return cfg, fmt.Errorf("%sALLOWLIST: %w", prefix, err)
+		}
+		if cfg.Deny[class], err = ParseNetworkList(os.Getenv(prefix + "DENYLIST")); err != nil {
+			return cfg, fmt.Errorf("%sDENYLIST: %w", prefix, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+func parseHostAddr(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap(), true
+	}
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+
+	return netip.Addr{}, false
+}
+
+// ClientIP returns the address of the client of a request: the peer, or for peers that
+// are trusted proxies the last address of X-Forwarded-For that is not a trusted proxy.
+func (cfg Config) ClientIP(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, ok := parseHostAddr(host)
+	if !ok || !cfg.TrustedProxies.Contains(addr) {
+		return addr, ok
+	}
+
+	// each proxy appends the address it got the request from
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, ok := parseHostAddr(forwarded[i])
+		if !ok {
+			break
+		}
+		addr = hop
+		if !cfg.TrustedProxies.Contains(hop) {
+			break
+		}
+	}
+
+	return addr, true
+}
+
+// RouteClass returns the route class of a request.
+func RouteClass(r *http.Request) string {
+	if strings.HasPrefix(r.URL.Path, "/admin/") {
+		return ClassAdmin
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ClassRead
+	}
+
+	return ClassAdmin
+}
+
+// Permitted tells whether an address may make requests of a route class, denylists win.
+// Loopback clients, like the dashboard and the API in the same pod, are always permitted.
+func (cfg Config) Permitted(class string, addr netip.Addr, known bool) bool {
+	if known && addr.IsLoopback() {
+		return true
+	}
+	if !known {
+		return len(cfg.Allow[class]) == 0 && len(cfg.Deny[class]) == 0
+	}
+	if cfg.Deny[class].Contains(addr) {
+		return false
+	}
+
+	return len(cfg.Allow[class]) == 0 || cfg.Allow[class].Contains(addr)
+}
+
+type contextKey struct{}
+
+// FromRequest returns the client address Middleware found, or the peer.
+func FromRequest(r *http.Request) string {
+	if addr, ok := r.Context().Value(contextKey{}).(netip.Addr); ok {
+		return addr.String()
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+
+	return r.RemoteAddr
+}
+
+// Middleware finds the client address of requests for the handlers and logs and answers
+// requests from addresses the lists of their route class exclude with deny. The lists do
+// not apply to the inCluster paths, which probes and other services call.
+func Middleware(cfg Config, inCluster map[string]bool, deny func(w http.ResponseWriter, message string, status int), next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, known := cfg.ClientIP(r)
+		if !inCluster[r.URL.Path] && !cfg.Permitted(RouteClass(r), addr, known) {
+			log.Printf("denied %s %s from %s", r.Method, r.URL.Path, addr)
+			deny(w, "requests from your address are not allowed", http.StatusForbidden)
+			return
+		}
+		if known {
+			r = r.WithContext(context.WithValue(r.Context(), contextKey{}, addr))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,77 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIPBehindTrustedProxies(t *testing.T) {
+	proxies, err := ParseNetworkList("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{TrustedProxies: proxies}
+
+	for _, tc := range []struct {
+		remote, forwarded, want string
+	}{
+		{"203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"10.1.2.3:5000", "198.51.100.1, 192.168.1.1", "198.51.100.1"},
+		// a client cannot hide behind an address it forwards itself
+		{"10.1.2.3:5000", "192.0.2.9, 198.51.100.1", "198.51.100.1"},
+		{"10.1.2.3:5000", "", "10.1.2.3"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remote
+		if tc.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tc.forwarded)
+		}
+		if addr, ok := cfg.ClientIP(r); !ok || addr.String() != tc.want {
+			t.Errorf("%s forwarding %q: ClientIP() = %s, %v, want %s", tc.remote, tc.forwarded, addr, ok, tc.want)
+		}
+	}
+}
+
+func TestPermitted(t *testing.T) {
+	allow, _ := ParseNetworkList("198.51.100.0/24")
+	deny, _ := ParseNetworkList("198.51.100.66")
+	cfg := Config{
+		Allow: map[string]NetworkList{ClassAdmin: allow},
+		Deny:  map[string]NetworkList{ClassAdmin: deny},
+	}
+
+	for _, tc := range []struct {
+		class, addr string
+		want        bool
+	}{
+		{ClassAdmin, "198.51.100.1", true},
+		{ClassAdmin, "198.51.100.66", false},
+		{ClassAdmin, "203.0.113.7", false},
+		{ClassAdmin, "127.0.0.1", true},
+		{ClassRead, "203.0.113.7", true},
+	} {
+		if got := cfg.Permitted(tc.class, netip.MustParseAddr(tc.addr), true); got != tc.want {
+			t.Errorf("Permitted(%s, %s) = %v, want %v", tc.class, tc.addr, got, tc.want)
+		}
+	}
+}
+
+func TestMiddlewareSkipsInClusterPaths(t *testing.T) {
+	allow, _ := ParseNetworkList("198.51.100.0/24")
+	cfg := Config{Allow: map[string]NetworkList{ClassRead: allow}}
+	handler := Middleware(cfg, map[string]bool{"/healthz": true}, http.Error, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(FromRequest(r)))
+	}))
+
+	for path, want := range map[string]int{"/healthz": http.StatusOK, "/jobs": http.StatusForbidden} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = "203.0.113.7:5000"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Errorf("%s: status %d, want %d", path, w.Code, want)
+		}
+	}
+}
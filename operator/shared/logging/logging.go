@@ -0,0 +1,151 @@
+// Package logging sets up slog and logs the requests of the API and the dashboard with
+// their IDs.
+package logging
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"shared/clientip"
+)
+
+// RequestIDHeader carries the ID of a request from the ingress or the dashboard, back in
+// the response and on to the API. Requests without one get a new ID.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDContextKey struct{}
+
+// RequestID returns the ID of the request of a context, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// Setup makes slog with the level debug, info, warn or error and the format text or json
+// the default logger. The messages of the log package have no level, they are logged at
+// info or the level set, if higher, so they are never dropped.
+func Setup(level, format string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch format {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+	slog.SetDefault(slog.New(handler))
+	slog.SetLogLoggerLevel(max(lvl, slog.LevelInfo))
+
+	return nil
+}
+
+// validRequestID accepts IDs of up to 128 letters, digits and -_.: of other services, so
+// they cannot forge log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Middleware logs requests with their ID, status and latency, failed ones as warnings and
+// errors, and those of the quiet paths, like probes and scrapes, at debug level.
+func Middleware(quiet map[string]bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+			// proxies forward the header
+			r.Header.Set(RequestIDHeader, id)
+		}
+		w.Header().Set(RequestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDContextKey{}, id))
+
+		recorder := &StatusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		if recorder.Status == 0 {
+			recorder.Status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case recorder.Status >= 500:
+			level = slog.LevelError
+		case recorder.Status >= 400:
+			level = slog.LevelWarn
+		case quiet[r.URL.Path]:
+			level = slog.LevelDebug
+		}
+		slog.LogAttrs(r.Context(), level, "request",
+			slog.String("id", id),
+			slog.String("client", clientip.FromRequest(r)),
+			slog.String("host", r.Host),
+			slog.String("method", r.Method),
+			slog.String("url", r.URL.String()),
+			slog.Int("status", recorder.Status),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("userAgent", r.UserAgent()),
+		)
+	})
+}
+
+// StatusRecorder keeps the status code of a response. Log streams and WebSockets reach the
+// underlying writer through Unwrap and Hijack.
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status int
+}
+
+func (s *StatusRecorder) WriteHeader(status int) {
+	if s.Status == 0 {
+		s.Status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *StatusRecorder) Write(b []byte) (int, error) {
+	if s.Status == 0 {
+		s.Status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *StatusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+func (s *StatusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	s.Status = http.StatusSwitchingProtocols
+	return http.NewResponseController(s.ResponseWriter).Hijack()
+}
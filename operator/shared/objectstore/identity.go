@@ -0,0 +1,222 @@
+package objectstore
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// credentials authorize requests to the bucket, keys signing them for S3 and GCS or a
+// bearer token of an OAuth identity for GCS and Azure.
+type credentials struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	token        string
+	expires      time.Time
+}
+
+// identity fetches the short-lived credentials of the workload identity of the pod and
+// fetches them again before they expire, instead of long-lived keys in Secrets.
+type identity struct {
+	name  string
+	fetch func(ctx context.Context) (credentials, error)
+
+	mu      sync.Mutex
+	current credentials
+}
+
+// identityRefresh is how long before they expire credentials are fetched again, so no
+// request is signed with credentials expiring on the way.
+const identityRefresh = 5 * time.Minute
+
+var identityClient = &http.Client{Timeout: 30 * time.Second}
+
+func (id *identity) credentials(ctx context.Context) (credentials, error) {
+	id.mu.Lock()
+	defer id.mu.Unlock()
+	if time.Until(id.current.expires) > identityRefresh {
+		return id.current, nil
+	}
+
+	c, err := id.fetch(ctx)
+	if err != nil {
+		return credentials{}, fmt.Errorf("cannot fetch the credentials of the %s: %w", id.name, err)
+	}
+	id.current = c
+
+	return c, nil
+}
+
+// identityFromEnv returns the workload identity the environment of the pod provides for
+// provider, or nil without one.
+func identityFromEnv(provider string) *identity {
+	switch provider {
+	case "s3":
+		// IRSA of EKS projects a token of the service account and names the role of the
+		// eks.amazonaws.com/role-arn annotation
+		tokenFile, role := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN")
+		if tokenFile == "" || role == "" {
+			return nil
+		}
+		endpoint := os.Getenv("RESULTS_STORE_STS_ENDPOINT")
+		if endpoint == "" {
+			region := os.Getenv("AWS_REGION")
+			if region == "" {
+				region = os.Getenv("RESULTS_STORE_REGION")
+			}
+			if region == "" {
+				region = "us-east-1"
+			}
+			endpoint = "https://sts." + region + ".amazonaws.com"
+		}
+		session := os.Getenv("AWS_ROLE_SESSION_NAME")
+		if session == "" {
+			session = "playwright-operator"
+		}
+		return &identity{name: "web identity " + role, fetch: func(ctx context.Context) (credentials, error) {
+			return assumeRoleWithWebIdentity(ctx, endpoint, role, session, tokenFile)
+		}}
+	case "gcs":
+		// Workload Identity of GKE hands out the tokens of the bound Google service account
+		// on the metadata server of the node
+		host := os.Getenv("GCE_METADATA_HOST")
+		if host == "" {
+			host = "metadata.google.internal"
+		}
+		return &identity{name: "metadata server", fetch: func(ctx context.Context) (credentials, error) {
+			return metadataToken(ctx, "http://"+host)
+		}}
+	case "azure":
+		// the workload identity webhook of AKS projects a token of the service account and
+		// names the managed identity of the azure.workload.identity/client-id annotation
+		tokenFile, client, tenant := os.Getenv("AZURE_FEDERATED_TOKEN_FILE"), os.Getenv("AZURE_CLIENT_ID"), os.Getenv("AZURE_TENANT_ID")
+		if tokenFile == "" || client == "" || tenant == "" {
+			return nil
+		}
+		authority := os.Getenv("AZURE_AUTHORITY_HOST")
+		if authority == "" {
+			authority = "https://login.microsoftonline.com/"
+		}
+		return &identity{name: "workload identity " + client, fetch: func(ctx context.Context) (credentials, error) {
+			return azureToken(ctx, strings.TrimSuffix(authority, "/")+"/"+tenant+"/oauth2/v2.0/token", client, tokenFile)
+		}}
+	}
+
+	return nil
+}
+
+// assumeRoleWithWebIdentity exchanges the projected token of the service account for
+// temporary credentials of role at the STS endpoint.
+func assumeRoleWithWebIdentity(ctx context.Context, endpoint, role, session, tokenFile string) (credentials, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return credentials{}, err
+	}
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {role},
+		"RoleSessionName":  {session},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return credentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var resp struct {
+		Credentials struct {
+			AccessKeyId     string
+			SecretAccessKey string
+			SessionToken    string
+			Expiration      time.Time
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := fetchIdentity(req, func(body io.Reader) error { return xml.NewDecoder(body).Decode(&resp) }); err != nil {
+		return credentials{}, err
+	}
+
+	return credentials{
+		accessKey:    resp.Credentials.AccessKeyId,
+		secretKey:    resp.Credentials.SecretAccessKey,
+		sessionToken: resp.Credentials.SessionToken,
+		expires:      resp.Credentials.Expiration,
+	}, nil
+}
+
+// metadataToken fetches an access token of the default service account of the pod from the
+// metadata server.
+func metadataToken(ctx context.Context, server string) (credentials, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return credentials{}, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	return fetchToken(req)
+}
+
+// azureToken exchanges the projected token of the service account for an access token of
+// the managed identity client to Azure Storage.
+func azureToken(ctx context.Context, endpoint, client, tokenFile string) (credentials, error) {
+	assertion, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return credentials{}, err
+	}
+	form := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_id":             {client},
+		"scope":                 {"https://storage.azure.com/.default"},
+		"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+		"client_assertion":      {strings.TrimSpace(string(assertion))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return credentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return fetchToken(req)
+}
+
+// fetchToken reads an OAuth access token, which expires expires_in seconds after it was
+// handed out.
+func fetchToken(req *http.Request) (credentials, error) {
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	issued := time.Now()
+	if err := fetchIdentity(req, func(body io.Reader) error { return json.NewDecoder(body).Decode(&resp) }); err != nil {
+		return credentials{}, err
+	}
+	if resp.AccessToken == "" {
+		return credentials{}, fmt.Errorf("%s returned no access token", req.URL.Host)
+	}
+
+	return credentials{token: resp.AccessToken, expires: issued.Add(time.Duration(resp.ExpiresIn) * time.Second)}, nil
+}
+
+func fetchIdentity(req *http.Request, decode func(io.Reader) error) error {
+	resp, err := identityClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return decode(resp.Body)
+}
@@ -0,0 +1,168 @@
+package objectstore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// projectedToken writes a token of the service account the way the kubelet projects it.
+func projectedToken(t *testing.T, token string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestWebIdentityCredentialsSignRequests(t *testing.T) {
+	var calls atomic.Int32
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		r.ParseForm()
+		if r.Form.Get("Action") != "AssumeRoleWithWebIdentity" || r.Form.Get("RoleArn") != "arn:aws:iam::123:role/results" || r.Form.Get("WebIdentityToken") != "sa-token" {
+			http.Error(w, "unexpected form "+r.Form.Encode(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>ASIAEXAMPLE</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>session</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer sts.Close()
+
+	t.Setenv("RESULTS_STORE", "s3")
+	t.Setenv("RESULTS_STORE_BUCKET", "reports")
+	t.Setenv("RESULTS_STORE_STS_ENDPOINT", sts.URL)
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123:role/results")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", projectedToken(t, "sa-token"))
+	store, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		req, err := store.NewRequest(context.Background(), http.MethodPut, "3f1d/index.html", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ASIAEXAMPLE/") || req.Header.Get("X-Amz-Security-Token") != "session" {
+			t.Errorf("headers = %v, want a signature with the temporary credentials", req.Header)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("assumed the role %d times, want the credentials reused until they expire", calls.Load())
+	}
+}
+
+func TestWebIdentityIsOptional(t *testing.T) {
+	t.Setenv("RESULTS_STORE", "s3")
+	t.Setenv("RESULTS_STORE_BUCKET", "reports")
+	t.Setenv("AWS_ROLE_ARN", "")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+	if _, err := FromEnv(); err == nil {
+		t.Error("FromEnv() accepts s3 without keys or a web identity")
+	}
+}
+
+func TestMetadataServerTokens(t *testing.T) {
+	var calls atomic.Int32
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" || r.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/token" {
+			http.NotFound(w, r)
+			return
+		}
+		// tokens expiring within the refresh margin are fetched again
+		fmt.Fprintf(w, `{"access_token":"ya29.token-%d","expires_in":60,"token_type":"Bearer"}`, calls.Add(1))
+	}))
+	defer metadata.Close()
+
+	t.Setenv("RESULTS_STORE", "gcs")
+	t.Setenv("RESULTS_STORE_BUCKET", "reports")
+	t.Setenv("RESULTS_STORE_ACCESS_KEY_ID", "")
+	t.Setenv("RESULTS_STORE_SECRET_ACCESS_KEY", "")
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(metadata.URL, "http://"))
+	store, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		req, err := store.NewRequest(context.Background(), http.MethodGet, "3f1d/index.html", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := req.Header.Get("Authorization"), fmt.Sprintf("Bearer ya29.token-%d", i); got != want {
+			t.Errorf("Authorization = %q, want %q", got, want)
+		}
+		if req.Header.Get("X-Amz-Date") != "" {
+			t.Errorf("headers = %v, want no signature next to the token", req.Header)
+		}
+	}
+}
+
+func TestAzureWorkloadIdentity(t *testing.T) {
+	entra := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.URL.Path != "/tenant/oauth2/v2.0/token" || r.Form.Get("client_id") != "client" || r.Form.Get("client_assertion") != "sa-token" || r.Form.Get("scope") != "https://storage.azure.com/.default" {
+			http.Error(w, "unexpected request "+r.URL.Path+" "+r.Form.Encode(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"eyJ0eXAi","expires_in":3599,"token_type":"Bearer"}`)
+	}))
+	defer entra.Close()
+
+	t.Setenv("RESULTS_STORE", "azure")
+	t.Setenv("RESULTS_STORE_BUCKET", "reports")
+	t.Setenv("RESULTS_STORE_SAS_TOKEN", "")
+	t.Setenv("AZURE_STORAGE_ACCOUNT", "account")
+	t.Setenv("AZURE_CLIENT_ID", "client")
+	t.Setenv("AZURE_TENANT_ID", "tenant")
+	t.Setenv("AZURE_AUTHORITY_HOST", entra.URL+"/")
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", projectedToken(t, "sa-token"))
+	store, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := store.NewRequest(context.Background(), http.MethodPut, "3f1d/index.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := req.URL.String(), "https://account.blob.core.windows.net/reports/3f1d/index.html"; got != want {
+		t.Errorf("URL = %s, want %s without a SAS token", got, want)
+	}
+	if req.Header.Get("Authorization") != "Bearer eyJ0eXAi" || req.Header.Get("X-Ms-Version") == "" {
+		t.Errorf("headers = %v, want the token and the version", req.Header)
+	}
+}
+
+func TestIdentityErrorsFailRequests(t *testing.T) {
+	denied := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+	}))
+	defer denied.Close()
+
+	store := &Store{Provider: "s3", Endpoint: "https://s3.us-east-1.amazonaws.com", Bucket: "reports", Region: "us-east-1",
+		identity: &identity{name: "web identity", fetch: func(ctx context.Context) (credentials, error) {
+			return assumeRoleWithWebIdentity(ctx, denied.URL, "role", "session", projectedToken(t, "sa-token"))
+		}}}
+	if _, err := store.NewRequest(context.Background(), http.MethodGet, "3f1d/index.html", nil); err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("NewRequest() error = %v, want the refusal of STS", err)
+	}
+}
@@ -0,0 +1,212 @@
+// Package objectstore authorizes requests to the bucket reports are uploaded to, which the
+// API writes and the dashboard serves from.
+package objectstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Store is an S3 compatible bucket, Google Cloud Storage through its XML API or an Azure
+// blob container. Requests are authorized with static keys or a SAS token, or otherwise
+// with the workload identity of the pod. Objects are named <Prefix><key>.
+type Store struct {
+	Provider string
+	Endpoint string
+	Bucket   string
+	Prefix   string
+	Region   string
+	// AccessKey and SecretKey sign requests to S3 and GCS, SessionToken is the token of
+	// temporary S3 credentials.
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// SASToken authorizes requests to Azure.
+	SASToken string
+
+	identity *identity
+}
+
+// FromEnv reads the bucket from RESULTS_STORE and the variables next to it, see
+// manifest/operator.yaml. It returns nil without RESULTS_STORE.
+func FromEnv() (*Store, error) {
+	provider := os.Getenv("RESULTS_STORE")
+	if provider == "" {
+		return nil, nil
+	}
+
+	s := &Store{
+		Provider:     provider,
+		Endpoint:     strings.TrimSuffix(os.Getenv("RESULTS_STORE_ENDPOINT"), "/"),
+		Bucket:       os.Getenv("RESULTS_STORE_BUCKET"),
+		Prefix:       os.Getenv("RESULTS_STORE_PREFIX"),
+		Region:       os.Getenv("RESULTS_STORE_REGION"),
+		AccessKey:    os.Getenv("RESULTS_STORE_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("RESULTS_STORE_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("RESULTS_STORE_SESSION_TOKEN"),
+		SASToken:     strings.TrimPrefix(os.Getenv("RESULTS_STORE_SAS_TOKEN"), "?"),
+	}
+	if s.Bucket == "" {
+		return nil, fmt.Errorf("RESULTS_STORE_BUCKET is required")
+	}
+	if s.Prefix != "" && !strings.HasSuffix(s.Prefix, "/") {
+		s.Prefix += "/"
+	}
+
+	switch provider {
+	case "s3":
+		if s.Region == "" {
+			s.Region = "us-east-1"
+		}
+		if s.Endpoint == "" {
+			s.Endpoint = "https://s3." + s.Region + ".amazonaws.com"
+		}
+	case "gcs":
+		// the XML API takes signatures of the S3 API made with HMAC keys
+		if s.Region == "" {
+			s.Region = "auto"
+		}
+		if s.Endpoint == "" {
+			s.Endpoint = "https://storage.googleapis.com"
+		}
+	case "azure":
+		if s.Endpoint == "" {
+			account := os.Getenv("AZURE_STORAGE_ACCOUNT")
+			if account == "" {
+				return nil, fmt.Errorf("RESULTS_STORE_ENDPOINT or AZURE_STORAGE_ACCOUNT is required for azure")
+			}
+			s.Endpoint = "https://" + account + ".blob.core.windows.net"
+		}
+		if s.SASToken != "" {
+			return s, nil
+		}
+	default:
+		return nil, fmt.Errorf("RESULTS_STORE must be s3, gcs or azure, not %q", provider)
+	}
+	if s.SASToken != "" || s.AccessKey != "" && s.SecretKey != "" {
+		return s, nil
+	}
+
+	if s.identity = identityFromEnv(provider); s.identity == nil {
+		switch provider {
+		case "s3":
+			return nil, fmt.Errorf("RESULTS_STORE_ACCESS_KEY_ID and RESULTS_STORE_SECRET_ACCESS_KEY or a web identity (AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN) are required for s3")
+		default:
+			return nil, fmt.Errorf("RESULTS_STORE_SAS_TOKEN or a workload identity (AZURE_FEDERATED_TOKEN_FILE, AZURE_CLIENT_ID and AZURE_TENANT_ID) is required for azure")
+		}
+	}
+
+	return s, nil
+}
+
+// EscapeKey escapes all but the unreserved characters of every segment of key, the way
+// signatures of the S3 API expect the path.
+func EscapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		var b strings.Builder
+		for _, c := range []byte(segment) {
+			if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~", c) >= 0 {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, "%%%02X", c)
+			}
+		}
+		segments[i] = b.String()
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// NewRequest returns an authorized request for the object key below the prefix of the
+// store.
+func (s *Store) NewRequest(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	c := credentials{accessKey: s.AccessKey, secretKey: s.SecretKey, sessionToken: s.SessionToken}
+	if s.identity != nil {
+		var err error
+		if c, err = s.identity.credentials(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	raw := s.Endpoint + "/" + EscapeKey(s.Bucket+"/"+s.Prefix+key)
+	if s.Provider == "azure" && c.token == "" {
+		raw += "?" + s.SASToken
+	}
+	req, err := http.NewRequestWithContext(ctx, method, raw, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Provider == "azure" {
+		// tokens of Microsoft Entra ID are taken since the version 2017-11-09
+		req.Header.Set("X-Ms-Version", "2021-12-02")
+	}
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case s.Provider != "azure":
+		s.signV4(req, time.Now(), c)
+	}
+
+	return req, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// signV4 signs a request with the Signature Version 4 of the S3 API. The payload is left
+// unsigned, uploads are streamed from the results volume.
+func (s *Store) signV4(req *http.Request, now time.Time, c credentials) {
+	date := now.UTC().Format("20060102T150405Z")
+	day := date[:8]
+	req.Header.Set("X-Amz-Date", date)
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	headers := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:UNSIGNED-PAYLOAD\n" +
+		"x-amz-date:" + date + "\n"
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	if c.sessionToken != "" {
+		headers += "x-amz-security-token:" + c.sessionToken + "\n"
+		signed += ";x-amz-security-token"
+	}
+	canonical := strings.Join([]string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery, headers, signed, "UNSIGNED-PAYLOAD"}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s/%s/s3/aws4_request, SignedHeaders=%s, Signature=%s",
+		c.accessKey, day, s.Region, signed, signatureV4(c.secretKey, s.Region, "s3", date, canonical)))
+}
+
+// signatureV4 returns the Signature Version 4 of a canonical request to a service of a
+// region at date, in the basic ISO 8601 format of X-Amz-Date.
+func signatureV4(secretKey, region, service, date, canonical string) string {
+	day := date[:8]
+	digest := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + date + "\n" + day + "/" + region + "/" + service + "/aws4_request\n" + hex.EncodeToString(digest[:])
+
+	return hex.EncodeToString(hmacSHA256(signingKeyV4(secretKey, region, service, day), toSign))
+}
+
+// signingKeyV4 derives the key of a day, region and service from the secret key.
+func signingKeyV4(secretKey, region, service, day string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	return key
+}
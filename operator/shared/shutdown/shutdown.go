@@ -0,0 +1,79 @@
+// Package shutdown drains the servers of the API and the dashboard on SIGTERM.
+package shutdown
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// delay keeps serving after SIGTERM until the endpoints of the Service no longer route
+	// to the pod, which Kubernetes updates at the same time.
+	delay = 5 * time.Second
+	// timeout bounds waiting for requests in flight, within the default grace period of
+	// 30s of the pod.
+	timeout = 20 * time.Second
+)
+
+// draining is closed when the server shuts down. Streams, which would hold up the shutdown
+// for as long as their client stays, end then and their clients reconnect to another pod.
+var draining = make(chan struct{})
+
+// Draining returns a channel that is closed when the server shuts down.
+func Draining() <-chan struct{} {
+	return draining
+}
+
+// StreamContext returns a context of the request that is also cancelled when the server
+// shuts down.
+func StreamContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(r.Context())
+	go func() {
+		select {
+		case <-draining:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// IsDraining tells whether the server shuts down.
+func IsDraining() bool {
+	select {
+	case <-draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// Serve runs srv until ctx is cancelled, then stops accepting connections and waits for
+// the requests in flight.
+func Serve(ctx context.Context, srv *http.Server) error {
+	srv.RegisterOnShutdown(func() { close(draining) })
+
+	errs := make(chan error, 1)
+	go func() { errs <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down in %s", delay)
+	time.Sleep(delay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	log.Printf("shut down")
+
+	return nil
+}